@@ -0,0 +1,449 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diff computes the difference between two versions of
+// an application package
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/schema"
+
+	"github.com/gravitational/trace"
+)
+
+// ChangeType describes how an item differs between two application packages
+type ChangeType string
+
+const (
+	// ChangeAdded means the item is only present in the newer package
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved means the item is only present in the older package
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified means the item is present in both packages but differs
+	ChangeModified ChangeType = "modified"
+)
+
+// Change describes a single difference between two application packages
+type Change struct {
+	// Type is the change type
+	Type ChangeType `json:"type"`
+	// Path identifies the changed item, e.g. a manifest field path
+	// or an image repository
+	Path string `json:"path"`
+	// Old is the value in the older package
+	Old interface{} `json:"old,omitempty"`
+	// New is the value in the newer package
+	New interface{} `json:"new,omitempty"`
+}
+
+// ResourceChange describes a difference in a single Kubernetes resource
+type ResourceChange struct {
+	// Type is the change type
+	Type ChangeType `json:"type"`
+	// Kind is the resource kind
+	Kind string `json:"kind"`
+	// Namespace is the resource namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the resource name
+	Name string `json:"name"`
+	// Fields lists changed fields of a modified resource
+	Fields []Change `json:"fields,omitempty"`
+}
+
+// String returns the resource identifier, e.g. Deployment/default/nginx
+func (r ResourceChange) String() string {
+	return resourceKey{kind: r.Kind, namespace: r.Namespace, name: r.Name}.String()
+}
+
+// Diff is the difference between two application packages
+type Diff struct {
+	// From is the older application package
+	From string `json:"from"`
+	// To is the newer application package
+	To string `json:"to"`
+	// Manifest lists application manifest changes
+	Manifest []Change `json:"manifest,omitempty"`
+	// Dependencies lists changes in package and application dependencies
+	Dependencies []Change `json:"dependencies,omitempty"`
+	// Images lists changes in container images
+	Images []Change `json:"images,omitempty"`
+	// Resources lists changes in Kubernetes resources
+	Resources []ResourceChange `json:"resources,omitempty"`
+}
+
+// IsEmpty returns true if the packages do not differ
+func (d Diff) IsEmpty() bool {
+	return len(d.Manifest) == 0 && len(d.Dependencies) == 0 &&
+		len(d.Images) == 0 && len(d.Resources) == 0
+}
+
+// Package is the contents of an application package the diff is computed over
+type Package struct {
+	// Locator is the application package locator
+	Locator loc.Locator
+	// Manifest is the application manifest
+	Manifest schema.Manifest
+	// Resources lists Kubernetes resources shipped with the application
+	Resources []Object
+	// Images lists container images referenced by the application
+	Images []string
+}
+
+// Object is a Kubernetes resource in its generic form
+type Object map[string]interface{}
+
+// Compute returns the difference between the application packages from and to
+func Compute(from, to Package) (*Diff, error) {
+	manifest, err := diffManifests(from.Manifest, to.Manifest)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	resources, err := diffResources(from.Resources, to.Resources)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Diff{
+		From:         from.Locator.String(),
+		To:           to.Locator.String(),
+		Manifest:     manifest,
+		Dependencies: diffDependencies(from.Manifest.Dependencies, to.Manifest.Dependencies),
+		Images:       diffImages(from.Images, to.Images),
+		Resources:    resources,
+	}, nil
+}
+
+// diffManifests compares the manifests field by field.
+// Dependencies are reported separately and are not included
+func diffManifests(from, to schema.Manifest) ([]Change, error) {
+	from.Dependencies, to.Dependencies = schema.Dependencies{}, schema.Dependencies{}
+	old, err := toGeneric(from)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	new, err := toGeneric(to)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return diffValues("", old, new), nil
+}
+
+func diffDependencies(from, to schema.Dependencies) []Change {
+	old := dependencyVersions(from)
+	new := dependencyVersions(to)
+	var changes []Change
+	for name, version := range new {
+		oldVersion, ok := old[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: ChangeAdded, Path: name, New: version})
+		case oldVersion != version:
+			changes = append(changes, Change{Type: ChangeModified, Path: name, Old: oldVersion, New: version})
+		}
+	}
+	for name, version := range old {
+		if _, ok := new[name]; !ok {
+			changes = append(changes, Change{Type: ChangeRemoved, Path: name, Old: version})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+// dependencyVersions maps package repository/name to version
+// for all dependencies
+func dependencyVersions(deps schema.Dependencies) map[string]string {
+	versions := make(map[string]string)
+	for _, dep := range append(deps.Packages, deps.Apps...) {
+		name := fmt.Sprintf("%v/%v", dep.Locator.Repository, dep.Locator.Name)
+		versions[name] = dep.Locator.Version
+	}
+	return versions
+}
+
+// diffImages compares images by repository. A repository that has a single
+// version in each package is reported as modified
+func diffImages(from, to []string) []Change {
+	old := imageVersions(from)
+	new := imageVersions(to)
+	var changes []Change
+	for _, repo := range unionKeys(old, new) {
+		removed := subtract(old[repo], new[repo])
+		added := subtract(new[repo], old[repo])
+		if len(removed) == 1 && len(added) == 1 {
+			changes = append(changes, Change{Type: ChangeModified, Path: repo, Old: removed[0], New: added[0]})
+			continue
+		}
+		for _, version := range removed {
+			changes = append(changes, Change{Type: ChangeRemoved, Path: repo, Old: version})
+		}
+		for _, version := range added {
+			changes = append(changes, Change{Type: ChangeAdded, Path: repo, New: version})
+		}
+	}
+	return changes
+}
+
+// imageVersions maps image repository to the set of its tags or digests
+func imageVersions(images []string) map[string]map[string]struct{} {
+	versions := make(map[string]map[string]struct{})
+	for _, image := range images {
+		repo, version := splitImage(image)
+		if versions[repo] == nil {
+			versions[repo] = make(map[string]struct{})
+		}
+		versions[repo][version] = struct{}{}
+	}
+	return versions
+}
+
+// splitImage splits the image reference into repository and tag or digest
+func splitImage(image string) (repo, version string) {
+	if idx := strings.Index(image, "@"); idx > 0 {
+		return image[:idx], image[idx+1:]
+	}
+	idx := strings.LastIndex(image, ":")
+	if idx <= 0 || strings.Contains(image[idx+1:], "/") {
+		return image, "latest"
+	}
+	return image[:idx], image[idx+1:]
+}
+
+// subtract returns sorted elements of a not present in b
+func subtract(a, b map[string]struct{}) (out []string) {
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func unionKeys(a, b map[string]map[string]struct{}) (keys []string) {
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func diffResources(from, to []Object) ([]ResourceChange, error) {
+	old, err := indexResources(from)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	new, err := indexResources(to)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var changes []ResourceChange
+	for key, object := range new {
+		change := ResourceChange{Kind: key.kind, Namespace: key.namespace, Name: key.name}
+		oldObject, ok := old[key]
+		if !ok {
+			change.Type = ChangeAdded
+			changes = append(changes, change)
+			continue
+		}
+		fields := diffValues("", map[string]interface{}(oldObject), map[string]interface{}(object))
+		if len(fields) != 0 {
+			change.Type = ChangeModified
+			change.Fields = fields
+			changes = append(changes, change)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			changes = append(changes, ResourceChange{
+				Type:      ChangeRemoved,
+				Kind:      key.kind,
+				Namespace: key.namespace,
+				Name:      key.name,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].String() < changes[j].String()
+	})
+	return changes, nil
+}
+
+func indexResources(objects []Object) (map[resourceKey]Object, error) {
+	index := make(map[resourceKey]Object, len(objects))
+	for _, object := range objects {
+		key := newResourceKey(object)
+		if key.kind == "" || key.name == "" {
+			return nil, trace.BadParameter("resource is missing kind or name: %v", object)
+		}
+		if _, ok := index[key]; ok {
+			return nil, trace.AlreadyExists("duplicate resource %v", key)
+		}
+		index[key] = object
+	}
+	return index, nil
+}
+
+func newResourceKey(object Object) resourceKey {
+	key := resourceKey{kind: stringField(object, "kind")}
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		key.namespace = stringField(metadata, "namespace")
+		key.name = stringField(metadata, "name")
+	}
+	return key
+}
+
+// resourceKey identifies a Kubernetes resource
+type resourceKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// String returns the resource identifier in kind/namespace/name format
+func (r resourceKey) String() string {
+	if r.namespace == "" {
+		return fmt.Sprintf("%v/%v", r.kind, r.name)
+	}
+	return fmt.Sprintf("%v/%v/%v", r.kind, r.namespace, r.name)
+}
+
+// diffValues recursively compares two values in their generic JSON form
+// and returns the list of changed fields.
+//
+// Lists of objects with unique names (e.g. containers or node profiles)
+// are compared by name, other lists of the same length are compared
+// element-wise and all remaining values are compared as a whole
+func diffValues(path string, old, new interface{}) []Change {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	switch {
+	case old == nil:
+		return []Change{{Type: ChangeAdded, Path: path, New: new}}
+	case new == nil:
+		return []Change{{Type: ChangeRemoved, Path: path, Old: old}}
+	}
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		return diffMaps(path, oldMap, newMap, fieldPath)
+	}
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList {
+		oldNamed, oldOk := namedItems(oldList)
+		newNamed, newOk := namedItems(newList)
+		if oldOk && newOk {
+			return diffMaps(path, oldNamed, newNamed, namedPath)
+		}
+		if len(oldList) == len(newList) {
+			var changes []Change
+			for i := range oldList {
+				changes = append(changes, diffValues(fmt.Sprintf("%v[%v]", path, i), oldList[i], newList[i])...)
+			}
+			return changes
+		}
+	}
+	return []Change{{Type: ChangeModified, Path: path, Old: old, New: new}}
+}
+
+func diffMaps(path string, old, new map[string]interface{}, join func(path, key string) string) []Change {
+	keys := make([]string, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var changes []Change
+	for _, key := range keys {
+		changes = append(changes, diffValues(join(path, key), old[key], new[key])...)
+	}
+	return changes
+}
+
+// namedItems indexes the list by the name attribute of its items.
+// Returns false if any item is not an object or has no unique name
+func namedItems(list []interface{}) (map[string]interface{}, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name := stringField(object, "name")
+		if name == "" {
+			return nil, false
+		}
+		if _, ok := items[name]; ok {
+			return nil, false
+		}
+		items[name] = item
+	}
+	return items, true
+}
+
+func fieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%v.%v", path, key)
+}
+
+func namedPath(path, name string) string {
+	return fmt.Sprintf("%v[%v]", path, name)
+}
+
+func stringField(object map[string]interface{}, name string) string {
+	value, _ := object[name].(string)
+	return value
+}
+
+// toGeneric converts the value into its generic JSON form
+func toGeneric(value interface{}) (out map[string]interface{}, err error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return out, nil
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/app/service"
+	apptest "github.com/gravitational/gravity/lib/app/service/test"
+	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/blob/fs"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack/localpack"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestDiff(t *testing.T) { TestingT(t) }
+
+type DiffSuite struct {
+	apps app.Applications
+}
+
+var _ = Suite(&DiffSuite{})
+
+func (s *DiffSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, "bolt.db")})
+	c.Assert(err, IsNil)
+	objects, err := fs.New(dir)
+	c.Assert(err, IsNil)
+	packages, err := localpack.New(localpack.Config{
+		Backend:     backend,
+		UnpackedDir: filepath.Join(dir, defaults.UnpackedDir),
+		Objects:     objects,
+	})
+	c.Assert(err, IsNil)
+	s.apps, err = service.New(service.Config{
+		Backend:  backend,
+		StateDir: filepath.Join(dir, defaults.ImportDir),
+		Packages: packages,
+	})
+	c.Assert(err, IsNil)
+	apptest.CreateRuntimeApplication(s.apps, c)
+}
+
+func (s *DiffSuite) TestComparesApplications(c *C) {
+	from := s.createApp(c, "1.0.0", manifestV1, resourcesV1)
+	to := s.createApp(c, "2.0.0", manifestV2, resourcesV2)
+
+	diff, err := Compare(s.apps, from, to)
+	c.Assert(err, IsNil)
+	c.Assert(diff.From, Equals, from.String())
+	c.Assert(diff.To, Equals, to.String())
+
+	var buf bytes.Buffer
+	c.Assert(Write(&buf, *diff, constants.EncodingText), IsNil)
+	c.Assert(buf.String(), Equals, expectedText)
+
+	buf.Reset()
+	c.Assert(Write(&buf, *diff, constants.EncodingJSON), IsNil)
+	var decoded Diff
+	c.Assert(json.Unmarshal(buf.Bytes(), &decoded), IsNil)
+	c.Assert(decoded.Resources, HasLen, len(diff.Resources))
+
+	c.Assert(diff.Manifest, HasLen, 4)
+	c.Assert(diff.Manifest[1].Type, Equals, ChangeAdded)
+	c.Assert(diff.Manifest[1].Path, Equals, "nodeProfiles[db]")
+	c.Assert(diff.Manifest[1].New.(map[string]interface{})["description"], Equals, "database")
+	diff.Manifest[1].New = nil
+	c.Assert(diff.Manifest, DeepEquals, []Change{
+		{Type: ChangeModified, Path: "metadata.resourceVersion", Old: "1.0.0", New: "2.0.0"},
+		{Type: ChangeAdded, Path: "nodeProfiles[db]"},
+		{Type: ChangeModified, Path: "nodeProfiles[node].description", Old: "worker", New: "worker node"},
+		{Type: ChangeModified, Path: "systemOptions.docker.storageDriver", Old: "overlay", New: "overlay2"},
+	})
+	c.Assert(diff.Dependencies, DeepEquals, []Change{
+		{Type: ChangeModified, Path: "example.com/dep", Old: "1.0.0", New: "1.1.0"},
+		{Type: ChangeRemoved, Path: "example.com/legacy", Old: "0.0.1"},
+	})
+	c.Assert(diff.Images, DeepEquals, []Change{
+		{Type: ChangeModified, Path: "nginx", Old: "1.9", New: "1.10"},
+		{Type: ChangeAdded, Path: "redis", New: "4.0"},
+	})
+	c.Assert(diff.Resources, DeepEquals, []ResourceChange{
+		{Type: ChangeRemoved, Kind: "ConfigMap", Namespace: "default", Name: "config"},
+		{Type: ChangeAdded, Kind: "Deployment", Namespace: "default", Name: "cache"},
+		{Type: ChangeModified, Kind: "Deployment", Namespace: "default", Name: "web", Fields: []Change{
+			{Type: ChangeModified, Path: "spec.template.spec.containers[nginx].image", Old: "nginx:1.9", New: "nginx:1.10"},
+		}},
+	})
+}
+
+func (s *DiffSuite) TestSameApplicationHasNoChanges(c *C) {
+	locator := s.createApp(c, "1.0.0", manifestV1, resourcesV1)
+	diff, err := Compare(s.apps, locator, locator)
+	c.Assert(err, IsNil)
+	c.Assert(diff.IsEmpty(), Equals, true, Commentf("%#v", diff))
+}
+
+func (s *DiffSuite) TestSplitsImages(c *C) {
+	var testCases = []struct {
+		image   string
+		repo    string
+		version string
+	}{
+		{image: "nginx", repo: "nginx", version: "latest"},
+		{image: "nginx:1.9", repo: "nginx", version: "1.9"},
+		{image: "registry:5000/nginx", repo: "registry:5000/nginx", version: "latest"},
+		{image: "registry:5000/nginx:1.9", repo: "registry:5000/nginx", version: "1.9"},
+		{image: "nginx@sha256:abc", repo: "nginx", version: "sha256:abc"},
+	}
+	for _, tc := range testCases {
+		repo, version := splitImage(tc.image)
+		c.Assert(repo, Equals, tc.repo, Commentf(tc.image))
+		c.Assert(version, Equals, tc.version, Commentf(tc.image))
+	}
+}
+
+func (s *DiffSuite) createApp(c *C, version, manifest, resources string) loc.Locator {
+	locator := loc.MustParseLocator("example.com/app:" + version)
+	apptest.CreateApplicationFromData(s.apps, locator, []*archive.Item{
+		archive.DirItem("resources"),
+		archive.ItemFromString("resources/app.yaml", manifest),
+		archive.ItemFromString("resources/resources.yaml", resources),
+	}, c)
+	return locator
+}
+
+const manifestV1 = `apiVersion: bundle.gravitational.io/v2
+kind: Bundle
+metadata:
+  name: app
+  resourceVersion: 1.0.0
+installer:
+  flavors:
+    items:
+    - name: one
+      nodes:
+      - profile: node
+        count: 1
+dependencies:
+  packages:
+  - example.com/dep:1.0.0
+  - example.com/legacy:0.0.1
+nodeProfiles:
+- name: node
+  description: worker
+systemOptions:
+  runtime:
+    version: 0.0.1
+  docker:
+    storageDriver: overlay
+`
+
+const manifestV2 = `apiVersion: bundle.gravitational.io/v2
+kind: Bundle
+metadata:
+  name: app
+  resourceVersion: 2.0.0
+installer:
+  flavors:
+    items:
+    - name: one
+      nodes:
+      - profile: node
+        count: 1
+dependencies:
+  packages:
+  - example.com/dep:1.1.0
+nodeProfiles:
+- name: node
+  description: worker node
+- name: db
+  description: database
+systemOptions:
+  runtime:
+    version: 0.0.1
+  docker:
+    storageDriver: overlay2
+`
+
+const resourcesV1 = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.9
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+data:
+  key: value
+`
+
+const resourcesV2 = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.10
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: cache
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: redis
+        image: redis:4.0
+`
+
+const expectedText = `Comparing example.com/app:1.0.0 with example.com/app:2.0.0
+
+Manifest:
+  ~ metadata.resourceVersion: 1.0.0 -> 2.0.0
+  + nodeProfiles[db]: (...)
+  ~ nodeProfiles[node].description: worker -> worker node
+  ~ systemOptions.docker.storageDriver: overlay -> overlay2
+
+Dependencies:
+  ~ example.com/dep: 1.0.0 -> 1.1.0
+  - example.com/legacy: 0.0.1
+
+Images:
+  ~ nginx: 1.9 -> 1.10
+  + redis: 4.0
+
+Resources:
+  - ConfigMap/default/config
+  + Deployment/default/cache
+  ~ Deployment/default/web
+      ~ spec.template.spec.containers[nginx].image: nginx:1.9 -> nginx:1.10
+`
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/constants"
+
+	"github.com/gravitational/trace"
+)
+
+// Write outputs the diff to w in the specified format
+func Write(w io.Writer, diff Diff, format constants.Format) error {
+	switch format {
+	case constants.EncodingText:
+		return trace.Wrap(writeText(w, diff))
+	case constants.EncodingJSON:
+		data, err := json.MarshalIndent(diff, "", "    ")
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return trace.Wrap(err)
+	}
+	return trace.BadParameter("unsupported output format %q, supported are: %v, %v",
+		format, constants.EncodingText, constants.EncodingJSON)
+}
+
+func writeText(w io.Writer, diff Diff) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Comparing %v with %v\n", diff.From, diff.To)
+	if diff.IsEmpty() {
+		fmt.Fprintln(&buf, "No changes.")
+	}
+	writeSection(&buf, "Manifest", diff.Manifest)
+	writeSection(&buf, "Dependencies", diff.Dependencies)
+	writeSection(&buf, "Images", diff.Images)
+	if len(diff.Resources) != 0 {
+		fmt.Fprintln(&buf, "\nResources:")
+		for _, resource := range diff.Resources {
+			fmt.Fprintf(&buf, "  %v %v\n", changeSymbol(resource.Type), resource)
+			for _, field := range resource.Fields {
+				fmt.Fprintf(&buf, "      %v\n", formatChange(field))
+			}
+		}
+	}
+	_, err := io.Copy(w, &buf)
+	return trace.Wrap(err)
+}
+
+func writeSection(w io.Writer, title string, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%v:\n", title)
+	for _, change := range changes {
+		fmt.Fprintf(w, "  %v\n", formatChange(change))
+	}
+}
+
+func formatChange(change Change) string {
+	symbol := changeSymbol(change.Type)
+	switch change.Type {
+	case ChangeAdded:
+		return fmt.Sprintf("%v %v: %v", symbol, change.Path, formatValue(change.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("%v %v: %v", symbol, change.Path, formatValue(change.Old))
+	default:
+		return fmt.Sprintf("%v %v: %v -> %v", symbol, change.Path,
+			formatValue(change.Old), formatValue(change.New))
+	}
+}
+
+func changeSymbol(changeType ChangeType) string {
+	switch changeType {
+	case ChangeAdded:
+		return "+"
+	case ChangeRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// formatValue formats the value for text output. Multi-line and
+// long values are elided, the JSON output contains them in full
+func formatValue(value interface{}) string {
+	var out string
+	switch v := value.(type) {
+	case string:
+		out = v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		out = string(data)
+	}
+	if strings.Contains(out, "\n") || len(out) > maxValueLength {
+		return "(...)"
+	}
+	return out
+}
+
+// maxValueLength is the maximum length of a value displayed in text output
+const maxValueLength = 64
@@ -0,0 +1,176 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/app/resources"
+	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/schema"
+
+	dockerarchive "github.com/docker/docker/pkg/archive"
+	"github.com/gravitational/trace"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Compare returns the difference between the application packages
+// from and to found in the specified application service
+func Compare(apps app.Applications, from, to loc.Locator) (*Diff, error) {
+	fromPackage, err := ReadPackage(apps, from)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	toPackage, err := ReadPackage(apps, to)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return Compute(*fromPackage, *toPackage)
+}
+
+// ReadPackage reads the manifest, resources and images of the
+// application package specified with locator
+func ReadPackage(apps app.Applications, locator loc.Locator) (*Package, error) {
+	manifest, err := readManifest(apps, locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	files, err := readResourceFiles(apps, locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	pkg := Package{
+		Locator:  locator,
+		Manifest: *manifest,
+	}
+	decoded := resources.Resources{resources.NewResource(manifest)}
+	for _, path := range sortedKeys(files) {
+		objects, err := decodeObjects(files[path])
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to decode %v", path)
+		}
+		pkg.Resources = append(pkg.Resources, objects...)
+		resource, err := resources.Decode(bytes.NewReader(files[path]), resources.SkipUnrecognized())
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to decode %v", path)
+		}
+		decoded = append(decoded, *resource)
+	}
+	pkg.Images, err = decoded.Images()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &pkg, nil
+}
+
+func readManifest(apps app.Applications, locator loc.Locator) (*schema.Manifest, error) {
+	reader, err := apps.GetAppManifest(locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	manifest, err := schema.ParseManifestYAMLNoValidate(data)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return manifest, nil
+}
+
+// readResourceFiles returns the contents of Kubernetes resource files found
+// at the top level of the application's resources directory
+func readResourceFiles(apps app.Applications, locator loc.Locator) (map[string][]byte, error) {
+	reader, err := apps.GetAppResources(locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer reader.Close()
+	stream, err := dockerarchive.DecompressStream(reader)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer stream.Close()
+	files := make(map[string][]byte)
+	err = archive.TarGlob(
+		tar.NewReader(stream),
+		defaults.ResourcesDir,
+		[]string{"*.yaml", "*.yml", "*.json"},
+		func(path string, reader io.Reader) error {
+			// skip the manifest and nested directories such as helm charts
+			if path == defaults.ManifestFileName || filepath.Dir(path) != "." {
+				return nil
+			}
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			files[path] = data
+			return nil
+		})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return files, nil
+}
+
+// decodeObjects decodes all Kubernetes resources from the specified
+// YAML or JSON data in their generic form
+func decodeObjects(data []byte) (objects []Object, err error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), defaults.DecoderBufferSize)
+	for {
+		var object Object
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		if stringField(object, "kind") == "List" {
+			items, _ := object["items"].([]interface{})
+			for _, item := range items {
+				if itemObject, ok := item.(map[string]interface{}); ok {
+					objects = append(objects, Object(itemObject))
+				}
+			}
+			continue
+		}
+		objects = append(objects, object)
+	}
+}
+
+func sortedKeys(files map[string][]byte) (keys []string) {
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -39,6 +39,7 @@ import (
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/registry/api/errcode"
 	registryclient "github.com/docker/distribution/registry/client"
 	registrystorage "github.com/docker/distribution/registry/storage"
@@ -94,22 +95,39 @@ func (r RegistryConnectionRequest) String() string {
 		r.RegistryAddress, r.CACertPath, r.ClientCertPath, r.ClientKeyPath)
 }
 
+// ImageServiceOption configures an image service
+type ImageServiceOption func(*imageService)
+
+// WithLockPolicy sets the policy used to verify image lock files during sync
+func WithLockPolicy(policy LockPolicy) ImageServiceOption {
+	return func(r *imageService) {
+		r.lockPolicy = policy
+	}
+}
+
 // NewImageService creates an image service using the supplied
 // address and certificate name to connect to the remote registry
-func NewImageService(req RegistryConnectionRequest) (ImageService, error) {
+func NewImageService(req RegistryConnectionRequest, options ...ImageServiceOption) (ImageService, error) {
 	err := req.CheckAndSetDefaults()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	return &imageService{
+	service := &imageService{
 		RegistryConnectionRequest: req,
 		FieldLogger:               log.WithField("registry", req.RegistryAddress),
-	}, nil
+	}
+	for _, option := range options {
+		option(service)
+	}
+	if err := service.lockPolicy.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return service, nil
 }
 
 // NewClusterImageService returns an in-cluster image service for the
 // specified registry address.
-func NewClusterImageService(registry string) (ImageService, error) {
+func NewClusterImageService(registry string, options ...ImageServiceOption) (ImageService, error) {
 	stateDir, err := state.GetStateDir()
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -120,7 +138,7 @@ func NewClusterImageService(registry string) (ImageService, error) {
 		CACertPath:      state.Secret(stateDir, defaults.RootCertFilename),
 		ClientCertPath:  state.Secret(stateDir, "kubelet.cert"),
 		ClientKeyPath:   state.Secret(stateDir, "kubelet.key"),
-	})
+	}, options...)
 }
 
 // imageService implements ImageService using provided remote registry address
@@ -130,17 +148,41 @@ type imageService struct {
 	log.FieldLogger
 
 	remoteStore *remoteStore
+	// lockPolicy defines how image lock files are verified
+	lockPolicy LockPolicy
 }
 
 // Sync synchronizes the contents of the local directory specified with dir
 // with the contents of the remote registry.
-// dir is expected to be in docker registry 2.x format.
+// dir is expected to be either in docker registry 2.x format or an OCI image layout.
+//
+// If the directory contains an image lock file, the images are verified
+// against the locked digests both before and after they are pushed.
 //
 // Upon success, returns a list of images pushed to the registry.
 func (r *imageService) Sync(ctx context.Context, dir string, progress utils.Emitter) (installedTags []TagSpec, err error) {
 	if err = r.connect(ctx); err != nil {
 		return nil, trace.Wrap(err)
 	}
+	lock, err := ReadImageLock(dir, r.lockPolicy)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if lock == nil && r.lockPolicy.RequireSignature {
+		return nil, trace.AccessDenied("%v does not have a signed image lock", dir)
+	}
+	if IsOCILayout(dir) {
+		registryDir, err := ioutil.TempDir("", "registry")
+		if err != nil {
+			return nil, trace.ConvertSystemError(err)
+		}
+		defer os.RemoveAll(registryDir)
+		r.Debugf("Importing OCI image layout %q.", dir)
+		if _, err := ImportOCILayout(ctx, dir, registryDir); err != nil {
+			return nil, trace.Wrap(err, "failed to import OCI image layout %q", dir)
+		}
+		dir = registryDir
+	}
 	r.Debugf("Synchronizing local directory %q.", dir)
 	localStore, err := openLocal(dir)
 	if err != nil {
@@ -199,6 +241,11 @@ func (r *imageService) Sync(ctx context.Context, dir string, progress utils.Emit
 				Name:    localRepoName,
 				Version: tag,
 			}
+			if lock != nil {
+				if err := lock.verifyTag(tagSpec, desc.Digest); err != nil {
+					return nil, trace.Wrap(err)
+				}
+			}
 			// remote registry either does not have this reference, or it is
 			// different from the local one
 			if remoteManifest == nil || !compareManifests(localManifest, remoteManifest) {
@@ -209,6 +256,15 @@ func (r *imageService) Sync(ctx context.Context, dir string, progress utils.Emit
 			} else {
 				progress.PrintStep("Image %s is up-to-date", tagSpec)
 			}
+			if lock != nil {
+				remoteDesc, err := remoteTags.Get(ctx, tag)
+				if err != nil {
+					return nil, trace.Wrap(err)
+				}
+				if err := lock.verifyTag(tagSpec, remoteDesc.Digest); err != nil {
+					return nil, trace.Wrap(err, "registry returned unexpected digest after push")
+				}
+			}
 			installedTags = append(installedTags, tagSpec)
 		}
 	}
@@ -478,10 +534,35 @@ func compareManifests(a, b distribution.Manifest) bool {
 // to the local one.
 func (s *remoteStore) updateRepo(ctx context.Context, remote, local distribution.Repository, manifest distribution.Manifest, tag string) error {
 	s.Debugf("Pushing %[1]v --> %[2]v/%[1]v.", local.Named(), s.addr)
+	return trace.Wrap(s.pushManifest(ctx, remote, local, manifest, distribution.WithTag(tag)))
+}
+
+// pushManifest pushes the specified manifest and all its references from the local
+// repository to the remote one.
+// The manifests referenced by a manifest list are pushed before the list itself
+func (s *remoteStore) pushManifest(ctx context.Context, remote, local distribution.Repository, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) error {
 	remoteManifests, err := remote.Manifests(ctx)
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		localManifests, err := local.Manifests(ctx)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		for _, ref := range list.References() {
+			child, err := localManifests.Get(ctx, ref.Digest)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			if err := s.pushManifest(ctx, remote, local, child); err != nil {
+				return trace.Wrap(err)
+			}
+		}
+		s.Debugf("Updating manifest list for %v.", local.Named())
+		_, err = remoteManifests.Put(ctx, manifest, options...)
+		return trace.Wrap(err)
+	}
 	localBlobs := local.Blobs(ctx)
 	remoteBlobs := remote.Blobs(ctx)
 	// copy layers:
@@ -513,6 +594,6 @@ func (s *remoteStore) updateRepo(ctx context.Context, remote, local distribution
 		s.Debugf("Written %v bytes.", written)
 	}
 	s.Debugf("Updating manifest for %v.", local.Named())
-	_, err = remoteManifests.Put(ctx, manifest, distribution.WithTag(tag))
+	_, err = remoteManifests.Put(ctx, manifest, options...)
 	return trace.Wrap(err)
 }
@@ -0,0 +1,253 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/gravitational/gravity/lib/defaults"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/libtrust"
+	"github.com/gravitational/trace"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// ImageLockFile is the name of the image lock file stored in the root
+	// of an application's registry directory
+	ImageLockFile = "images.lock"
+	// imageLockSignatureKey is the name of the JSON attribute
+	// with the image lock signatures
+	imageLockSignatureKey = "signatures"
+	// imageLockVersion is the version of the image lock format
+	imageLockVersion = "v1"
+)
+
+// ImageLock records immutable digests of the images in an application's registry
+type ImageLock struct {
+	// Version is the lock format version
+	Version string `json:"version"`
+	// Images lists the locked images
+	Images []LockedImage `json:"images"`
+}
+
+// LockedImage is a single image recorded in the lock file
+type LockedImage struct {
+	// Image is the image reference without registry, e.g. repo:tag
+	Image string `json:"image"`
+	// Digest is the digest of the image manifest
+	Digest digest.Digest `json:"digest"`
+	// MediaType is the media type of the image manifest
+	MediaType string `json:"mediaType"`
+}
+
+// Digest returns the locked digest of the specified image
+func (l ImageLock) Digest(image string) (digest.Digest, bool) {
+	tag := TagFromString(image)
+	for _, locked := range l.Images {
+		if TagFromString(locked.Image) == tag {
+			return locked.Digest, true
+		}
+	}
+	return "", false
+}
+
+// NewImageLock computes the image lock for all tagged images in the
+// registry directory given with dir
+func NewImageLock(ctx context.Context, dir string) (*ImageLock, error) {
+	store, err := openLocal(dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	repos, err := ListRepos(ctx, store)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	lock := ImageLock{Version: imageLockVersion}
+	for _, name := range repos {
+		repo, err := store.Repository(ctx, name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		tagService := repo.Tags(ctx)
+		tags, err := tagService.All(ctx)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		for _, tag := range tags {
+			desc, err := tagService.Get(ctx, tag)
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			manifest, err := manifests.Get(ctx, desc.Digest)
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			image := TagSpec{Name: name, Version: tag}
+			mediaType, _, err := manifest.Payload()
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			if _, ok := manifest.(*schema1.SignedManifest); ok {
+				return nil, trace.BadParameter("image %v uses a schema1 manifest "+
+					"which cannot be pinned to a digest", image)
+			}
+			lock.Images = append(lock.Images, LockedImage{
+				Image:     image.String(),
+				Digest:    desc.Digest,
+				MediaType: mediaType,
+			})
+		}
+	}
+	sort.Slice(lock.Images, func(i, j int) bool {
+		return lock.Images[i].Image < lock.Images[j].Image
+	})
+	return &lock, nil
+}
+
+// WriteImageLock writes the lock into the registry directory given with dir.
+// If key is not nil, the lock is signed with it
+func WriteImageLock(dir string, lock ImageLock, key libtrust.PrivateKey) error {
+	data, err := json.MarshalIndent(lock, "", "   ")
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key != nil {
+		signature, err := libtrust.NewJSONSignature(data)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if err := signature.Sign(key); err != nil {
+			return trace.Wrap(err)
+		}
+		data, err = signature.PrettySignature(imageLockSignatureKey)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ImageLockFile), data, defaults.SharedReadMask)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+// LockPolicy defines how image lock files are verified
+type LockPolicy struct {
+	// TrustedKeys lists the public keys image locks are accepted from.
+	// If empty, signatures are verified for integrity only
+	TrustedKeys []libtrust.PublicKey
+	// RequireSignature rejects images that do not have a lock signed
+	// with one of the trusted keys
+	RequireSignature bool
+}
+
+// CheckAndSetDefaults validates the policy
+func (p LockPolicy) CheckAndSetDefaults() error {
+	if p.RequireSignature && len(p.TrustedKeys) == 0 {
+		return trace.BadParameter("signature verification requires at least one trusted key")
+	}
+	return nil
+}
+
+// isTrusted returns true if the key is one of the policy's trusted keys
+// or no trusted keys have been configured
+func (p LockPolicy) isTrusted(key libtrust.PublicKey) bool {
+	if len(p.TrustedKeys) == 0 {
+		return true
+	}
+	for _, trusted := range p.TrustedKeys {
+		if trusted.KeyID() == key.KeyID() {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadImageLock reads the image lock from the registry directory given with dir
+// and verifies its signature according to the policy.
+//
+// Returns trace.NotFound if the directory does not have a lock file
+func ReadImageLock(dir string, policy LockPolicy) (*ImageLock, error) {
+	if err := policy.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, ImageLockFile))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	payload, err := verifyLockSignature(data, policy)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var lock ImageLock
+	if err := json.Unmarshal(payload, &lock); err != nil {
+		return nil, trace.Wrap(err, "invalid image lock file")
+	}
+	if lock.Version != imageLockVersion {
+		return nil, trace.BadParameter("unsupported image lock version %q", lock.Version)
+	}
+	return &lock, nil
+}
+
+// verifyLockSignature verifies the signatures of the lock file given with data
+// and returns the lock payload
+func verifyLockSignature(data []byte, policy LockPolicy) (payload []byte, err error) {
+	signature, err := libtrust.ParsePrettySignature(data, imageLockSignatureKey)
+	if err == libtrust.ErrMissingSignatureKey {
+		if policy.RequireSignature {
+			return nil, trace.AccessDenied("image lock is not signed")
+		}
+		return data, nil
+	}
+	if err != nil {
+		return nil, trace.Wrap(err, "invalid image lock signature")
+	}
+	keys, err := signature.Verify()
+	if err != nil {
+		return nil, trace.AccessDenied("image lock signature verification failed: %v", err)
+	}
+	for _, key := range keys {
+		if policy.isTrusted(key) {
+			return signature.Payload()
+		}
+	}
+	return nil, trace.AccessDenied("image lock is not signed by a trusted key")
+}
+
+// verifyTag makes sure the tag given with image resolves to the
+// locked digest
+func (l ImageLock) verifyTag(image TagSpec, dgst digest.Digest) error {
+	locked, ok := l.Digest(image.String())
+	if !ok {
+		return trace.AccessDenied("image %v is not in the image lock", image)
+	}
+	if locked != dgst {
+		return trace.AccessDenied("image %v digest %v does not match locked digest %v",
+			image, dgst, locked)
+	}
+	return nil
+}
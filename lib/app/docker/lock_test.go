@@ -0,0 +1,113 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/libtrust"
+	"github.com/gravitational/trace"
+	"github.com/opencontainers/go-digest"
+	. "gopkg.in/check.v1"
+)
+
+type LockSuite struct {
+	dir   string
+	image TagSpec
+	key   libtrust.PrivateKey
+}
+
+var _ = Suite(&LockSuite{})
+
+func (s *LockSuite) SetUpTest(c *C) {
+	ctx := context.Background()
+	s.dir = c.MkDir()
+	s.image = TagSpec{Name: "test/image", Version: "1.0.0"}
+	desc := createImage(ctx, c, s.dir, s.image.Name, "layer")
+	repo := openRepository(ctx, c, s.dir, s.image.Name)
+	c.Assert(repo.Tags(ctx).Tag(ctx, s.image.Version, desc), IsNil)
+	var err error
+	s.key, err = libtrust.GenerateECP256PrivateKey()
+	c.Assert(err, IsNil)
+}
+
+func (s *LockSuite) TestLocksImageDigests(c *C) {
+	lock, err := NewImageLock(context.Background(), s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(lock.Images, HasLen, 1)
+	c.Assert(lock.Images[0].Image, Equals, s.image.String())
+
+	dgst, ok := lock.Digest(s.image.String())
+	c.Assert(ok, Equals, true)
+	c.Assert(lock.verifyTag(s.image, dgst), IsNil)
+	c.Assert(trace.IsAccessDenied(lock.verifyTag(s.image, digest.FromString("other"))), Equals, true)
+	c.Assert(trace.IsAccessDenied(lock.verifyTag(TagSpec{Name: "other", Version: "latest"}, dgst)), Equals, true)
+}
+
+func (s *LockSuite) TestVerifiesSignedLock(c *C) {
+	lock, err := NewImageLock(context.Background(), s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(WriteImageLock(s.dir, *lock, s.key), IsNil)
+
+	verified, err := ReadImageLock(s.dir, LockPolicy{
+		TrustedKeys:      []libtrust.PublicKey{s.key.PublicKey()},
+		RequireSignature: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(verified, DeepEquals, lock)
+
+	otherKey, err := libtrust.GenerateECP256PrivateKey()
+	c.Assert(err, IsNil)
+	_, err = ReadImageLock(s.dir, LockPolicy{
+		TrustedKeys: []libtrust.PublicKey{otherKey.PublicKey()},
+	})
+	c.Assert(trace.IsAccessDenied(err), Equals, true, Commentf("%v", err))
+}
+
+func (s *LockSuite) TestRejectsTamperedLock(c *C) {
+	lock, err := NewImageLock(context.Background(), s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(WriteImageLock(s.dir, *lock, s.key), IsNil)
+
+	path := filepath.Join(s.dir, ImageLockFile)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	data = bytes.Replace(data, []byte(s.image.Version), []byte("6.6.6"), -1)
+	c.Assert(ioutil.WriteFile(path, data, 0644), IsNil)
+
+	_, err = ReadImageLock(s.dir, LockPolicy{})
+	c.Assert(err, NotNil)
+}
+
+func (s *LockSuite) TestRequiresSignature(c *C) {
+	lock, err := NewImageLock(context.Background(), s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(WriteImageLock(s.dir, *lock, nil), IsNil)
+
+	verified, err := ReadImageLock(s.dir, LockPolicy{})
+	c.Assert(err, IsNil)
+	c.Assert(verified, DeepEquals, lock)
+
+	_, err = ReadImageLock(s.dir, LockPolicy{
+		TrustedKeys:      []libtrust.PublicKey{s.key.PublicKey()},
+		RequireSignature: true,
+	})
+	c.Assert(trace.IsAccessDenied(err), Equals, true, Commentf("%v", err))
+}
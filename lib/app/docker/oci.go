@@ -0,0 +1,545 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gravitational/gravity/lib/defaults"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/gravitational/trace"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// MediaTypeOCIIndex is the media type of an OCI image index
+	MediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeOCIManifest is the media type of an OCI image manifest
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeOCIConfig is the media type of an OCI image configuration
+	MediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+	// MediaTypeOCILayer is the media type of a gzip-compressed OCI image layer
+	MediaTypeOCILayer = "application/vnd.oci.image.layer.v1.tar+gzip"
+	// MediaTypeOCIForeignLayer is the media type of a non-distributable OCI image layer
+	MediaTypeOCIForeignLayer = "application/vnd.oci.image.layer.nondistributable.v1.tar+gzip"
+
+	// AnnotationRefName is the OCI annotation that names the image reference
+	// an index entry corresponds to
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+	// AnnotationSourceDigest is the annotation that records the digest of the
+	// original manifest list an index entry was filtered from
+	AnnotationSourceDigest = "io.gravitational.image.source.digest"
+
+	// ociLayoutFile is the name of the file marking the root of an OCI image layout
+	ociLayoutFile = "oci-layout"
+	// ociIndexFile is the name of the image index file of an OCI image layout
+	ociIndexFile = "index.json"
+	// ociBlobsDir is the name of the blobs directory of an OCI image layout
+	ociBlobsDir = "blobs"
+	// ociLayoutVersion is the supported version of the OCI image layout
+	ociLayoutVersion = "1.0.0"
+)
+
+// Platform identifies the operating system and CPU architecture
+// an image has been built for
+type Platform struct {
+	// OS is the operating system, e.g. linux
+	OS string `json:"os"`
+	// Architecture is the CPU architecture, e.g. amd64
+	Architecture string `json:"architecture"`
+	// Variant is the optional CPU variant, e.g. v7 for arm
+	Variant string `json:"variant,omitempty"`
+}
+
+// DefaultPlatform is the platform images are vendored for unless specified otherwise
+var DefaultPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// ParsePlatform parses the platform specification in the os/arch[/variant] format
+func ParsePlatform(spec string) (*Platform, error) {
+	parts := strings.Split(strings.TrimSpace(spec), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, trace.BadParameter("invalid platform %q, expected os/arch[/variant]", spec)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, trace.BadParameter("invalid platform %q, expected os/arch[/variant]", spec)
+		}
+	}
+	platform := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return &platform, nil
+}
+
+// String returns the platform in the os/arch[/variant] format
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%v/%v/%v", p.OS, p.Architecture, p.Variant)
+	}
+	return fmt.Sprintf("%v/%v", p.OS, p.Architecture)
+}
+
+// Matches returns true if this platform is satisfied by the specified
+// manifest list platform
+func (p Platform) Matches(spec manifestlist.PlatformSpec) bool {
+	if p.OS != spec.OS || p.Architecture != spec.Architecture {
+		return false
+	}
+	return p.Variant == "" || p.Variant == spec.Variant
+}
+
+// OCIDescriptor describes an entry of an OCI image index
+type OCIDescriptor struct {
+	// MediaType is the media type of the referenced content
+	MediaType string `json:"mediaType,omitempty"`
+	// Digest is the digest of the referenced content
+	Digest digest.Digest `json:"digest"`
+	// Size is the size of the referenced content in bytes
+	Size int64 `json:"size"`
+	// Annotations contains arbitrary metadata for the entry
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// RefName returns the image reference this index entry has been tagged with
+func (d OCIDescriptor) RefName() string {
+	return d.Annotations[AnnotationRefName]
+}
+
+// ociIndex is the top-level image index of an OCI image layout
+type ociIndex struct {
+	// SchemaVersion is the image index schema version
+	SchemaVersion int `json:"schemaVersion"`
+	// Manifests lists the manifests available in the layout
+	Manifests []OCIDescriptor `json:"manifests"`
+}
+
+// ociLayoutMarker is the contents of the oci-layout file
+type ociLayoutMarker struct {
+	// Version is the image layout version
+	Version string `json:"imageLayoutVersion"`
+}
+
+// OCILayout is an OCI image layout directory
+type OCILayout struct {
+	dir string
+	// mu protects the index
+	mu    sync.Mutex
+	index ociIndex
+}
+
+// IsOCILayout returns true if the specified directory contains an OCI image layout
+func IsOCILayout(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ociLayoutFile))
+	return err == nil
+}
+
+// NewOCILayout opens the OCI image layout in the specified directory
+// or initializes a new one if the directory does not have one
+func NewOCILayout(dir string) (*OCILayout, error) {
+	if IsOCILayout(dir) {
+		return OpenOCILayout(dir)
+	}
+	err := os.MkdirAll(filepath.Join(dir, ociBlobsDir), defaults.SharedDirMask)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	marker, err := json.Marshal(ociLayoutMarker{Version: ociLayoutVersion})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ociLayoutFile), marker, defaults.SharedReadMask)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	layout := &OCILayout{
+		dir:   dir,
+		index: ociIndex{SchemaVersion: 2},
+	}
+	if err := layout.writeIndex(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return layout, nil
+}
+
+// OpenOCILayout opens an existing OCI image layout in the specified directory
+func OpenOCILayout(dir string) (*OCILayout, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ociLayoutFile))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	var marker ociLayoutMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return nil, trace.Wrap(err, "invalid %v file in %v", ociLayoutFile, dir)
+	}
+	if marker.Version != ociLayoutVersion {
+		return nil, trace.BadParameter("unsupported OCI image layout version %q", marker.Version)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, ociIndexFile))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	layout := &OCILayout{dir: dir}
+	if err := json.Unmarshal(data, &layout.index); err != nil {
+		return nil, trace.Wrap(err, "invalid %v file in %v", ociIndexFile, dir)
+	}
+	return layout, nil
+}
+
+// Dir returns the root directory of this layout
+func (l *OCILayout) Dir() string {
+	return l.dir
+}
+
+// Manifests returns the list of entries in the image index
+func (l *OCILayout) Manifests() []OCIDescriptor {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	manifests := make([]OCIDescriptor, len(l.index.Manifests))
+	copy(manifests, l.index.Manifests)
+	return manifests
+}
+
+// HasBlob returns true if the blob with the specified digest is present in the layout
+func (l *OCILayout) HasBlob(dgst digest.Digest) bool {
+	_, err := os.Stat(l.blobPath(dgst))
+	return err == nil
+}
+
+// OpenBlob opens the blob with the specified digest for reading
+func (l *OCILayout) OpenBlob(dgst digest.Digest) (io.ReadCloser, error) {
+	f, err := os.Open(l.blobPath(dgst))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	return f, nil
+}
+
+// ReadBlob returns the contents of the blob with the specified digest
+func (l *OCILayout) ReadBlob(dgst digest.Digest) ([]byte, error) {
+	data, err := ioutil.ReadFile(l.blobPath(dgst))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	return data, nil
+}
+
+// WriteBlob writes the data from the specified reader as a blob with the given digest.
+// The contents are verified against the digest before the blob is committed
+func (l *OCILayout) WriteBlob(dgst digest.Digest, r io.Reader) error {
+	if err := dgst.Validate(); err != nil {
+		return trace.Wrap(err)
+	}
+	dir := filepath.Dir(l.blobPath(dgst))
+	if err := os.MkdirAll(dir, defaults.SharedDirMask); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	f, err := ioutil.TempFile(dir, ".blob")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.Remove(f.Name())
+	verifier := dgst.Verifier()
+	_, err = io.Copy(io.MultiWriter(f, verifier), r)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	if !verifier.Verified() {
+		return trace.BadParameter("blob contents do not match digest %v", dgst)
+	}
+	if err := os.Rename(f.Name(), l.blobPath(dgst)); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+// Tag records the manifest given with desc in the image index under the specified
+// image reference replacing the existing entry with the same reference
+func (l *OCILayout) Tag(ref string, desc OCIDescriptor) error {
+	if !l.HasBlob(desc.Digest) {
+		return trace.NotFound("manifest %v is not in the layout", desc.Digest)
+	}
+	if desc.Annotations == nil {
+		desc.Annotations = make(map[string]string)
+	}
+	desc.Annotations[AnnotationRefName] = ref
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	manifests := l.index.Manifests[:0]
+	for _, existing := range l.index.Manifests {
+		if existing.RefName() != ref {
+			manifests = append(manifests, existing)
+		}
+	}
+	l.index.Manifests = append(manifests, desc)
+	return l.writeIndex()
+}
+
+func (l *OCILayout) writeIndex() error {
+	data, err := json.Marshal(l.index)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(l.dir, ociIndexFile), data, defaults.SharedReadMask)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+func (l *OCILayout) blobPath(dgst digest.Digest) string {
+	return filepath.Join(l.dir, ociBlobsDir, dgst.Algorithm().String(), dgst.Hex())
+}
+
+// ImportOCILayout imports all images recorded in the OCI image layout in layoutDir
+// into the docker registry directory registryDir.
+// Image manifests using OCI media types are converted to their docker
+// schema2 counterparts during import.
+//
+// Returns the list of imported images
+func ImportOCILayout(ctx context.Context, layoutDir, registryDir string) (tags []TagSpec, err error) {
+	layout, err := OpenOCILayout(layoutDir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := os.MkdirAll(registryDir, defaults.SharedDirMask); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	store, err := openLocal(registryDir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, desc := range layout.Manifests() {
+		name, pinned, isPinned := parseDigestReference(desc.RefName())
+		tag := TagFromString(desc.RefName())
+		if isPinned {
+			tag = TagSpec{Name: name}
+		} else if !tag.IsValid() || !strings.Contains(desc.RefName(), ":") {
+			return nil, trace.BadParameter("index entry %v does not specify a repository:tag "+
+				"or a repository@digest reference", desc.Digest)
+		}
+		repo, err := store.Repository(ctx, tag.Name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		importer := layoutImporter{layout: layout, repo: repo}
+		imported, err := importer.importManifest(ctx, desc.MediaType, desc.Digest)
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to import %v", desc.RefName())
+		}
+		if isPinned {
+			// images pinned by digest are only addressable by the digest
+			if imported.Digest != pinned {
+				return nil, trace.BadParameter("image %v has digest %v in the registry, "+
+					"reference it by tag instead", desc.RefName(), imported.Digest)
+			}
+			continue
+		}
+		if err := repo.Tags(ctx).Tag(ctx, tag.Version, *imported); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// parseDigestReference returns the repository name and the digest of the
+// image reference pinned by digest, e.g. repository[:tag]@sha256:<hex>
+func parseDigestReference(ref string) (name string, dgst digest.Digest, ok bool) {
+	i := strings.LastIndex(ref, "@")
+	if i <= 0 {
+		return "", "", false
+	}
+	dgst, err := digest.Parse(ref[i+1:])
+	if err != nil {
+		return "", "", false
+	}
+	name = ref[:i]
+	if n := strings.LastIndex(name, ":"); n > 0 && !strings.Contains(name[n+1:], "/") {
+		name = name[:n]
+	}
+	return name, dgst, true
+}
+
+// layoutImporter copies manifests and blobs from an OCI image layout
+// into a registry repository
+type layoutImporter struct {
+	layout *OCILayout
+	repo   distribution.Repository
+}
+
+// importManifest imports the manifest with the specified digest with all
+// its references into the repository and returns the descriptor of the imported manifest
+func (r layoutImporter) importManifest(ctx context.Context, mediaType string, dgst digest.Digest) (*distribution.Descriptor, error) {
+	payload, err := r.layout.ReadBlob(dgst)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	mediaType, payload, err = convertOCIManifest(mediaType, payload)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	manifest, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to parse manifest %v", dgst)
+	}
+	switch m := manifest.(type) {
+	case *manifestlist.DeserializedManifestList:
+		var descriptors []manifestlist.ManifestDescriptor
+		for _, ref := range m.Manifests {
+			imported, err := r.importManifest(ctx, ref.MediaType, ref.Digest)
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			ref.Descriptor = *imported
+			descriptors = append(descriptors, ref)
+		}
+		if manifest, err = manifestlist.FromDescriptors(descriptors); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	case *schema2.DeserializedManifest:
+		for _, ref := range m.References() {
+			if err := r.importBlob(ctx, ref); err != nil {
+				return nil, trace.Wrap(err)
+			}
+		}
+	default:
+		return nil, trace.BadParameter("unsupported manifest type %q", mediaType)
+	}
+	manifests, err := r.repo.Manifests(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	imported, err := manifests.Put(ctx, manifest)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	mediaType, payload, err = manifest.Payload()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    imported,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+func (r layoutImporter) importBlob(ctx context.Context, desc distribution.Descriptor) error {
+	if len(desc.URLs) != 0 {
+		// foreign layers are not distributed with the image
+		return nil
+	}
+	blobs := r.repo.Blobs(ctx)
+	if _, err := blobs.Stat(ctx, desc.Digest); err == nil {
+		return nil
+	}
+	reader, err := r.layout.OpenBlob(desc.Digest)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	writer, err := blobs.Create(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer writer.Close()
+	if _, err := io.Copy(writer, reader); err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = writer.Commit(ctx, distribution.Descriptor{Digest: desc.Digest})
+	return trace.Wrap(err)
+}
+
+// convertOCIManifest translates the manifest given with payload from the OCI
+// media types to the docker distribution media types.
+// Manifests with docker media types are returned unchanged
+func convertOCIManifest(mediaType string, payload []byte) (string, []byte, error) {
+	var versioned struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(payload, &versioned); err != nil {
+		return "", nil, trace.Wrap(err)
+	}
+	if versioned.MediaType != "" {
+		mediaType = versioned.MediaType
+	}
+	switch mediaType {
+	case MediaTypeOCIIndex:
+		var index struct {
+			SchemaVersion int                               `json:"schemaVersion"`
+			Manifests     []manifestlist.ManifestDescriptor `json:"manifests"`
+		}
+		if err := json.Unmarshal(payload, &index); err != nil {
+			return "", nil, trace.Wrap(err)
+		}
+		for i := range index.Manifests {
+			index.Manifests[i].MediaType = convertOCIMediaType(index.Manifests[i].MediaType)
+		}
+		list, err := manifestlist.FromDescriptors(index.Manifests)
+		if err != nil {
+			return "", nil, trace.Wrap(err)
+		}
+		_, payload, err := list.Payload()
+		return manifestlist.MediaTypeManifestList, payload, trace.Wrap(err)
+	case MediaTypeOCIManifest:
+		var manifest schema2.Manifest
+		if err := json.Unmarshal(payload, &manifest); err != nil {
+			return "", nil, trace.Wrap(err)
+		}
+		manifest.Versioned = schema2.SchemaVersion
+		manifest.Config.MediaType = convertOCIMediaType(manifest.Config.MediaType)
+		for i := range manifest.Layers {
+			manifest.Layers[i].MediaType = convertOCIMediaType(manifest.Layers[i].MediaType)
+		}
+		deserialized, err := schema2.FromStruct(manifest)
+		if err != nil {
+			return "", nil, trace.Wrap(err)
+		}
+		_, payload, err := deserialized.Payload()
+		return schema2.MediaTypeManifest, payload, trace.Wrap(err)
+	}
+	return mediaType, payload, nil
+}
+
+func convertOCIMediaType(mediaType string) string {
+	switch mediaType {
+	case MediaTypeOCIManifest:
+		return schema2.MediaTypeManifest
+	case MediaTypeOCIConfig:
+		return schema2.MediaTypeImageConfig
+	case MediaTypeOCILayer:
+		return schema2.MediaTypeLayer
+	case MediaTypeOCIForeignLayer:
+		return schema2.MediaTypeForeignLayer
+	}
+	return mediaType
+}
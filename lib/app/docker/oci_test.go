@@ -0,0 +1,382 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	dockerapi "github.com/fsouza/go-dockerclient"
+	"github.com/opencontainers/go-digest"
+	. "gopkg.in/check.v1"
+)
+
+type OCISuite struct{}
+
+var _ = Suite(&OCISuite{})
+
+func (s *OCISuite) TestParsesPlatform(c *C) {
+	var testCases = []struct {
+		spec     string
+		platform *Platform
+		comment  string
+	}{
+		{
+			spec:     "linux/amd64",
+			platform: &Platform{OS: "linux", Architecture: "amd64"},
+			comment:  "os and architecture",
+		},
+		{
+			spec:     "linux/arm/v7",
+			platform: &Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			comment:  "os, architecture and variant",
+		},
+		{
+			spec:    "linux",
+			comment: "missing architecture",
+		},
+		{
+			spec:    "linux//v7",
+			comment: "empty architecture",
+		},
+	}
+	for _, tc := range testCases {
+		comment := Commentf(tc.comment)
+		platform, err := ParsePlatform(tc.spec)
+		if tc.platform == nil {
+			c.Assert(err, NotNil, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		c.Assert(platform, DeepEquals, tc.platform, comment)
+		c.Assert(platform.String(), Equals, tc.spec, comment)
+	}
+}
+
+func (s *OCISuite) TestPullsMultiPlatformImageIntoLayout(c *C) {
+	ctx := context.Background()
+	registryDir := c.MkDir()
+	amd64 := createImage(ctx, c, registryDir, "test/image", "amd64-layer")
+	arm64 := createImage(ctx, c, registryDir, "test/image", "arm64-layer")
+	createManifestList(ctx, c, registryDir, "test/image", "1.0.0", map[string]distribution.Descriptor{
+		"amd64": amd64,
+		"arm64": arm64,
+	})
+
+	registry, err := NewRegistry(BasicConfiguration("127.0.0.1:0", registryDir))
+	c.Assert(err, IsNil)
+	c.Assert(registry.Start(), IsNil)
+	defer registry.Close()
+
+	layout, err := NewOCILayout(c.MkDir())
+	c.Assert(err, IsNil)
+	puller, err := NewRegistryPuller(RegistryPullerConfig{
+		Platforms: []Platform{{OS: "linux", Architecture: "amd64"}},
+	})
+	c.Assert(err, IsNil)
+	err = puller.Pull(ctx, fmt.Sprintf("%v/test/image:1.0.0", registry.Addr()), "test/image:1.0.0", layout)
+	c.Assert(err, IsNil)
+
+	manifests := layout.Manifests()
+	c.Assert(manifests, HasLen, 1)
+	c.Assert(manifests[0].RefName(), Equals, "test/image:1.0.0")
+	c.Assert(manifests[0].MediaType, Equals, manifestlist.MediaTypeManifestList)
+	c.Assert(manifests[0].Annotations[AnnotationSourceDigest], Not(Equals), "")
+	c.Assert(layout.HasBlob(amd64.Digest), Equals, true)
+	c.Assert(layout.HasBlob(arm64.Digest), Equals, false)
+	c.Assert(layout.HasBlob(digest.FromString("amd64-layer")), Equals, true)
+	c.Assert(layout.HasBlob(digest.FromString("arm64-layer")), Equals, false)
+
+	reopened, err := OpenOCILayout(layout.Dir())
+	c.Assert(err, IsNil)
+	c.Assert(reopened.Manifests(), DeepEquals, manifests)
+
+	importDir := c.MkDir()
+	tags, err := ImportOCILayout(ctx, layout.Dir(), importDir)
+	c.Assert(err, IsNil)
+	c.Assert(tags, DeepEquals, []TagSpec{{Name: "test/image", Version: "1.0.0"}})
+
+	manifest := getManifest(ctx, c, importDir, "test/image", "1.0.0")
+	list, ok := manifest.(*manifestlist.DeserializedManifestList)
+	c.Assert(ok, Equals, true)
+	c.Assert(list.Manifests, HasLen, 1)
+	c.Assert(list.Manifests[0].Digest, Equals, amd64.Digest)
+	c.Assert(list.Manifests[0].Platform.Architecture, Equals, "amd64")
+}
+
+func (s *OCISuite) TestImportsOCIManifest(c *C) {
+	ctx := context.Background()
+	layout, err := NewOCILayout(c.MkDir())
+	c.Assert(err, IsNil)
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer")
+	for _, blob := range [][]byte{config, layer} {
+		c.Assert(layout.WriteBlob(digest.FromBytes(blob), bytes.NewReader(blob)), IsNil)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeOCIManifest,
+		"config": distribution.Descriptor{
+			MediaType: MediaTypeOCIConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		"layers": []distribution.Descriptor{{
+			MediaType: MediaTypeOCILayer,
+			Digest:    digest.FromBytes(layer),
+			Size:      int64(len(layer)),
+		}},
+	})
+	c.Assert(err, IsNil)
+	dgst := digest.FromBytes(payload)
+	c.Assert(layout.WriteBlob(dgst, bytes.NewReader(payload)), IsNil)
+	err = layout.Tag("test/oci:latest", OCIDescriptor{
+		MediaType: MediaTypeOCIManifest,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	})
+	c.Assert(err, IsNil)
+
+	importDir := c.MkDir()
+	_, err = ImportOCILayout(ctx, layout.Dir(), importDir)
+	c.Assert(err, IsNil)
+
+	manifest := getManifest(ctx, c, importDir, "test/oci", "latest")
+	imported, ok := manifest.(*schema2.DeserializedManifest)
+	c.Assert(ok, Equals, true)
+	c.Assert(imported.Config.MediaType, Equals, schema2.MediaTypeImageConfig)
+	c.Assert(imported.Layers[0].MediaType, Equals, schema2.MediaTypeLayer)
+}
+
+func (s *OCISuite) TestImportsImagePinnedByDigest(c *C) {
+	ctx := context.Background()
+	registryDir := c.MkDir()
+	image := createImage(ctx, c, registryDir, "test/image", "layer")
+
+	registry, err := NewRegistry(BasicConfiguration("127.0.0.1:0", registryDir))
+	c.Assert(err, IsNil)
+	c.Assert(registry.Start(), IsNil)
+	defer registry.Close()
+
+	layout, err := NewOCILayout(c.MkDir())
+	c.Assert(err, IsNil)
+	puller, err := NewRegistryPuller(RegistryPullerConfig{})
+	c.Assert(err, IsNil)
+	ref := fmt.Sprintf("test/image@%v", image.Digest)
+	err = puller.Pull(ctx, fmt.Sprintf("%v/%v", registry.Addr(), ref), ref, layout)
+	c.Assert(err, IsNil)
+
+	importDir := c.MkDir()
+	tags, err := ImportOCILayout(ctx, layout.Dir(), importDir)
+	c.Assert(err, IsNil)
+	c.Assert(tags, HasLen, 0)
+
+	manifests, err := openRepository(ctx, c, importDir, "test/image").Manifests(ctx)
+	c.Assert(err, IsNil)
+	exists, err := manifests.Exists(ctx, image.Digest)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+}
+
+func (s *OCISuite) TestPullsOCIIndexFromPrivateRegistry(c *C) {
+	ctx := context.Background()
+	content := make(map[digest.Digest][]byte)
+	put := func(data []byte) distribution.Descriptor {
+		dgst := digest.FromBytes(data)
+		content[dgst] = data
+		return distribution.Descriptor{Digest: dgst, Size: int64(len(data))}
+	}
+	manifestFor := func(layer string) distribution.Descriptor {
+		config := put([]byte(fmt.Sprintf(`{"layer":%q}`, layer)))
+		config.MediaType = MediaTypeOCIConfig
+		layerDesc := put([]byte(layer))
+		layerDesc.MediaType = MediaTypeOCILayer
+		payload, err := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"mediaType":     MediaTypeOCIManifest,
+			"config":        config,
+			"layers":        []distribution.Descriptor{layerDesc},
+		})
+		c.Assert(err, IsNil)
+		desc := put(payload)
+		desc.MediaType = MediaTypeOCIManifest
+		return desc
+	}
+	amd64 := manifestFor("amd64-layer")
+	arm64 := manifestFor("arm64-layer")
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeOCIIndex,
+		"manifests": []manifestlist.ManifestDescriptor{
+			{Descriptor: amd64, Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+			{Descriptor: arm64, Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "arm64"}},
+		},
+	})
+	c.Assert(err, IsNil)
+	indexDigest := put(index).Digest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(r.URL.Path, "/")
+		name := parts[len(parts)-1]
+		dgst := digest.Digest(name)
+		if name == "1.0.0" {
+			dgst = indexDigest
+		}
+		data, ok := content[dgst]
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+			return
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			var versioned struct {
+				MediaType string `json:"mediaType"`
+			}
+			c.Assert(json.Unmarshal(data, &versioned), IsNil)
+			w.Header().Set("Content-Type", versioned.MediaType)
+		}
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	layout, err := NewOCILayout(c.MkDir())
+	c.Assert(err, IsNil)
+	puller, err := NewRegistryPuller(RegistryPullerConfig{
+		Platforms: []Platform{{OS: "linux", Architecture: "amd64"}},
+		Auth: &dockerapi.AuthConfigurations{
+			Configs: map[string]dockerapi.AuthConfiguration{
+				addr: {Username: "user", Password: "secret", ServerAddress: "http://" + addr},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	err = puller.Pull(ctx, fmt.Sprintf("%v/test/image:1.0.0", addr), "test/image:1.0.0", layout)
+	c.Assert(err, IsNil)
+
+	manifests := layout.Manifests()
+	c.Assert(manifests, HasLen, 1)
+	c.Assert(manifests[0].MediaType, Equals, MediaTypeOCIIndex)
+	c.Assert(manifests[0].Annotations[AnnotationSourceDigest], Equals, indexDigest.String())
+	c.Assert(layout.HasBlob(amd64.Digest), Equals, true)
+	c.Assert(layout.HasBlob(arm64.Digest), Equals, false)
+	c.Assert(layout.HasBlob(digest.FromString("amd64-layer")), Equals, true)
+
+	importDir := c.MkDir()
+	_, err = ImportOCILayout(ctx, layout.Dir(), importDir)
+	c.Assert(err, IsNil)
+	manifest := getManifest(ctx, c, importDir, "test/image", "1.0.0")
+	list, ok := manifest.(*manifestlist.DeserializedManifestList)
+	c.Assert(ok, Equals, true)
+	c.Assert(list.Manifests, HasLen, 1)
+	c.Assert(list.Manifests[0].MediaType, Equals, schema2.MediaTypeManifest)
+}
+
+func (s *OCISuite) TestRejectsCorruptBlob(c *C) {
+	layout, err := NewOCILayout(c.MkDir())
+	c.Assert(err, IsNil)
+	dgst := digest.FromString("expected")
+	err = layout.WriteBlob(dgst, bytes.NewReader([]byte("actual")))
+	c.Assert(err, NotNil)
+	c.Assert(layout.HasBlob(dgst), Equals, false)
+}
+
+// createImage creates a single-layer image in the registry directory and
+// returns the descriptor of its manifest
+func createImage(ctx context.Context, c *C, dir, name, layer string) distribution.Descriptor {
+	repo := openRepository(ctx, c, dir, name)
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeImageConfig, []byte(fmt.Sprintf(`{"layer":%q}`, layer)))
+	c.Assert(err, IsNil)
+	layerDesc, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte(layer))
+	c.Assert(err, IsNil)
+	config.MediaType = schema2.MediaTypeImageConfig
+	layerDesc.MediaType = schema2.MediaTypeLayer
+	manifest, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layerDesc},
+	})
+	c.Assert(err, IsNil)
+	return putManifest(ctx, c, repo, manifest)
+}
+
+// createManifestList creates a manifest list for the specified per-architecture
+// manifests and tags it with the given tag
+func createManifestList(ctx context.Context, c *C, dir, name, tag string, manifests map[string]distribution.Descriptor) {
+	repo := openRepository(ctx, c, dir, name)
+	var descriptors []manifestlist.ManifestDescriptor
+	for arch, desc := range manifests {
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: desc,
+			Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: arch},
+		})
+	}
+	list, err := manifestlist.FromDescriptors(descriptors)
+	c.Assert(err, IsNil)
+	desc := putManifest(ctx, c, repo, list)
+	c.Assert(repo.Tags(ctx).Tag(ctx, tag, desc), IsNil)
+}
+
+func putManifest(ctx context.Context, c *C, repo distribution.Repository, manifest distribution.Manifest) distribution.Descriptor {
+	manifests, err := repo.Manifests(ctx)
+	c.Assert(err, IsNil)
+	dgst, err := manifests.Put(ctx, manifest)
+	c.Assert(err, IsNil)
+	mediaType, payload, err := manifest.Payload()
+	c.Assert(err, IsNil)
+	return distribution.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(payload))}
+}
+
+func getManifest(ctx context.Context, c *C, dir, name, tag string) distribution.Manifest {
+	repo := openRepository(ctx, c, dir, name)
+	desc, err := repo.Tags(ctx).Get(ctx, tag)
+	c.Assert(err, IsNil)
+	manifests, err := repo.Manifests(ctx)
+	c.Assert(err, IsNil)
+	manifest, err := manifests.Get(ctx, desc.Digest)
+	c.Assert(err, IsNil)
+	return manifest
+}
+
+func openRepository(ctx context.Context, c *C, dir, name string) distribution.Repository {
+	store, err := openLocal(dir)
+	c.Assert(err, IsNil)
+	repo, err := store.Repository(ctx, name)
+	c.Assert(err, IsNil)
+	return repo
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/gravitational/trace"
+	"github.com/opencontainers/go-digest"
+)
+
+func init() {
+	// register OCI media types with the registry client so that registries
+	// serving OCI images and indexes can be pulled from
+	ociManifestFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+		m := new(ociImageManifest)
+		if err := m.UnmarshalJSON(b); err != nil {
+			return nil, distribution.Descriptor{}, err
+		}
+		return m, distribution.Descriptor{
+			MediaType: MediaTypeOCIManifest,
+			Digest:    digest.FromBytes(b),
+			Size:      int64(len(b)),
+		}, nil
+	}
+	if err := distribution.RegisterManifestSchema(MediaTypeOCIManifest, ociManifestFunc); err != nil {
+		panic(fmt.Sprintf("failed to register OCI manifest: %v", err))
+	}
+	ociIndexFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+		m := new(ociImageIndex)
+		if err := m.UnmarshalJSON(b); err != nil {
+			return nil, distribution.Descriptor{}, err
+		}
+		return m, distribution.Descriptor{
+			MediaType: MediaTypeOCIIndex,
+			Digest:    digest.FromBytes(b),
+			Size:      int64(len(b)),
+		}, nil
+	}
+	if err := distribution.RegisterManifestSchema(MediaTypeOCIIndex, ociIndexFunc); err != nil {
+		panic(fmt.Sprintf("failed to register OCI index: %v", err))
+	}
+}
+
+// ociImageManifest is an OCI image manifest served by a registry.
+// It has the same structure as the docker schema2 manifest
+type ociImageManifest struct {
+	schema2.Manifest
+	// canonical is the manifest as served by the registry
+	canonical []byte
+}
+
+// UnmarshalJSON decodes the manifest from the specified payload
+func (m *ociImageManifest) UnmarshalJSON(b []byte) error {
+	var manifest schema2.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return trace.Wrap(err)
+	}
+	m.Manifest = manifest
+	m.canonical = append([]byte(nil), b...)
+	return nil
+}
+
+// MarshalJSON returns the manifest as served by the registry
+func (m *ociImageManifest) MarshalJSON() ([]byte, error) {
+	return m.canonical, nil
+}
+
+// Payload returns the media type and the contents of the manifest
+func (m ociImageManifest) Payload() (string, []byte, error) {
+	return MediaTypeOCIManifest, m.canonical, nil
+}
+
+// ociImageIndex is an OCI image index served by a registry.
+// It has the same structure as the docker manifest list
+type ociImageIndex struct {
+	manifestlist.ManifestList
+	// canonical is the index as served by the registry
+	canonical []byte
+}
+
+// newOCIImageIndex returns a new OCI image index with the specified manifests
+func newOCIImageIndex(descriptors []manifestlist.ManifestDescriptor) (*ociImageIndex, error) {
+	index := manifestlist.ManifestList{Manifests: descriptors}
+	index.SchemaVersion = 2
+	index.MediaType = MediaTypeOCIIndex
+	canonical, err := json.MarshalIndent(&index, "", "   ")
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &ociImageIndex{ManifestList: index, canonical: canonical}, nil
+}
+
+// UnmarshalJSON decodes the index from the specified payload
+func (m *ociImageIndex) UnmarshalJSON(b []byte) error {
+	var index manifestlist.ManifestList
+	if err := json.Unmarshal(b, &index); err != nil {
+		return trace.Wrap(err)
+	}
+	m.ManifestList = index
+	m.canonical = append([]byte(nil), b...)
+	return nil
+}
+
+// MarshalJSON returns the index as served by the registry
+func (m *ociImageIndex) MarshalJSON() ([]byte, error) {
+	return m.canonical, nil
+}
+
+// Payload returns the media type and the contents of the index
+func (m ociImageIndex) Payload() (string, []byte, error) {
+	return MediaTypeOCIIndex, m.canonical, nil
+}
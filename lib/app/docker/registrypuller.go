@@ -0,0 +1,427 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	registryclient "github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	registrytransport "github.com/docker/distribution/registry/client/transport"
+	dockerapi "github.com/fsouza/go-dockerclient"
+	"github.com/gravitational/trace"
+	"github.com/opencontainers/go-digest"
+	log "github.com/sirupsen/logrus"
+)
+
+// RegistryPullerConfig defines the configuration of the registry puller
+type RegistryPullerConfig struct {
+	// Platforms lists the platforms to retain from multi-platform images.
+	// Defaults to DefaultPlatform
+	Platforms []Platform
+	// InsecureRegistries lists registries that are accessed over plain HTTP.
+	// Registries on loopback addresses are always accessed over plain HTTP
+	InsecureRegistries []string
+	// Transport is the base HTTP transport to use for registry requests
+	Transport http.RoundTripper
+	// Auth specifies the credentials for private registries, usually read
+	// from the docker client configuration.
+	// Registries without credentials are accessed anonymously
+	Auth *dockerapi.AuthConfigurations
+	// FieldLogger is used for logging
+	log.FieldLogger
+}
+
+// CheckAndSetDefaults validates the configuration and sets defaults
+func (r *RegistryPullerConfig) CheckAndSetDefaults() error {
+	if len(r.Platforms) == 0 {
+		r.Platforms = []Platform{DefaultPlatform}
+	}
+	if r.Transport == nil {
+		r.Transport = http.DefaultTransport
+	}
+	if r.FieldLogger == nil {
+		r.FieldLogger = log.WithField(trace.Component, "registry-puller")
+	}
+	return nil
+}
+
+// NewRegistryPuller returns a new puller that downloads images
+// directly from docker registries without a docker daemon
+func NewRegistryPuller(config RegistryPullerConfig) (*RegistryPuller, error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &RegistryPuller{RegistryPullerConfig: config}, nil
+}
+
+// RegistryPuller downloads images from docker registries into OCI image layouts
+type RegistryPuller struct {
+	RegistryPullerConfig
+}
+
+// Pull downloads the image given with source into the specified layout
+// and records it in the layout's index under the target reference.
+//
+// Manifest lists and OCI image indexes are preserved but filtered to the configured platforms
+// and only the manifests for these platforms are downloaded
+func (p *RegistryPuller) Pull(ctx context.Context, source, target string, layout *OCILayout) error {
+	ref, err := Parse(source)
+	if err != nil {
+		return trace.Wrap(err, "invalid image reference %q", source)
+	}
+	named, ok := ref.(Named)
+	if !ok {
+		return trace.BadParameter("image reference %q has no name", source)
+	}
+	repo, err := p.repository(ctx, named)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	var dgst digest.Digest
+	var options []distribution.ManifestServiceOption
+	if digested, ok := ref.(Digested); ok {
+		dgst = digested.Digest()
+	} else if tagged, ok := ref.(Tagged); ok {
+		options = append(options, distribution.WithTag(tagged.Tag()))
+	} else {
+		options = append(options, distribution.WithTag("latest"))
+	}
+	p.Debugf("Pulling %v.", source)
+	manifest, err := manifests.Get(ctx, dgst, options...)
+	if err != nil {
+		return trace.Wrap(err, "failed to fetch manifest for %v", source)
+	}
+	desc, err := p.pullManifest(ctx, repo, manifests, manifest, layout)
+	if err != nil {
+		return trace.Wrap(err, "failed to pull %v", source)
+	}
+	return trace.Wrap(layout.Tag(target, *desc))
+}
+
+func (p *RegistryPuller) pullManifest(ctx context.Context, repo distribution.Repository, manifests distribution.ManifestService, manifest distribution.Manifest, layout *OCILayout) (*OCIDescriptor, error) {
+	switch m := manifest.(type) {
+	case *manifestlist.DeserializedManifestList:
+		return p.pullIndex(ctx, repo, manifests, m, m.Manifests, layout,
+			func(descriptors []manifestlist.ManifestDescriptor) (distribution.Manifest, error) {
+				return manifestlist.FromDescriptors(descriptors)
+			})
+	case *ociImageIndex:
+		return p.pullIndex(ctx, repo, manifests, m, m.Manifests, layout,
+			func(descriptors []manifestlist.ManifestDescriptor) (distribution.Manifest, error) {
+				return newOCIImageIndex(descriptors)
+			})
+	case *schema2.DeserializedManifest, *ociImageManifest:
+		blobs := repo.Blobs(ctx)
+		for _, ref := range m.References() {
+			if err := pullBlob(ctx, blobs, ref, layout); err != nil {
+				return nil, trace.Wrap(err)
+			}
+		}
+		return writeManifest(layout, m)
+	}
+	return nil, trace.BadParameter("unsupported manifest type %T, only docker "+
+		"schema2 and OCI manifests, manifest lists and indexes are supported", manifest)
+}
+
+// pullIndex downloads the manifests for the configured platforms from the
+// manifest list or OCI image index given with index and writes the index
+// into layout.
+//
+// If any manifests have been filtered out, the index is rewritten with
+// the filtered manifests using newIndex
+func (p *RegistryPuller) pullIndex(
+	ctx context.Context,
+	repo distribution.Repository,
+	manifests distribution.ManifestService,
+	index distribution.Manifest,
+	refs []manifestlist.ManifestDescriptor,
+	layout *OCILayout,
+	newIndex func([]manifestlist.ManifestDescriptor) (distribution.Manifest, error),
+) (*OCIDescriptor, error) {
+	_, payload, err := index.Payload()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, ref := range refs {
+		if !p.matchesPlatform(ref.Platform) {
+			p.Debugf("Skipping manifest %v for platform %v/%v.",
+				ref.Digest, ref.Platform.OS, ref.Platform.Architecture)
+			continue
+		}
+		child, err := manifests.Get(ctx, ref.Digest)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if _, err := p.pullManifest(ctx, repo, manifests, child, layout); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		descriptors = append(descriptors, ref)
+	}
+	if len(descriptors) == 0 {
+		return nil, trace.NotFound("no image manifest for platforms %v", p.Platforms)
+	}
+	if len(descriptors) == len(refs) {
+		// nothing has been filtered out so keep the index as-is
+		return writeManifest(layout, index)
+	}
+	filtered, err := newIndex(descriptors)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	desc, err := writeManifest(layout, filtered)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	desc.Annotations = map[string]string{
+		AnnotationSourceDigest: digest.FromBytes(payload).String(),
+	}
+	return desc, nil
+}
+
+func (p *RegistryPuller) matchesPlatform(spec manifestlist.PlatformSpec) bool {
+	for _, platform := range p.Platforms {
+		if platform.Matches(spec) {
+			return true
+		}
+	}
+	return false
+}
+
+// repository returns the remote repository for the specified image reference
+func (p *RegistryPuller) repository(ctx context.Context, named Named) (distribution.Repository, error) {
+	domain, path := Domain(named), Path(named)
+	if isDockerHub(domain) && !strings.Contains(path, "/") {
+		path = fmt.Sprintf("%v/%v", officialRepoName, path)
+	}
+	name, err := parseNamed(path)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	endpoint := p.endpoint(domain)
+	manager := challenge.NewSimpleManager()
+	if err := p.ping(manager, endpoint); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	creds := p.credentials(domain)
+	authorizer := auth.NewAuthorizer(manager,
+		auth.NewTokenHandler(p.Transport, creds, path, "pull"),
+		auth.NewBasicHandler(creds))
+	transport := registrytransport.NewTransport(p.Transport, authorizer)
+	repo, err := registryclient.NewRepository(ctx, name, endpoint, transport)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return repo, nil
+}
+
+// ReadAuthConfigurations reads the registry credentials from the docker client
+// configuration in $DOCKER_CONFIG or ~/.docker.
+//
+// Entries managed by credential helpers are skipped.
+// Returns nil if there is no docker client configuration
+func ReadAuthConfigurations() (*dockerapi.AuthConfigurations, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, trace.ConvertSystemError(err)
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, trace.Wrap(err, "failed to parse docker client configuration")
+	}
+	auth := &dockerapi.AuthConfigurations{Configs: make(map[string]dockerapi.AuthConfiguration)}
+	for server, entry := range config.Auths {
+		if entry.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, trace.Wrap(err, "invalid credentials for registry %v", server)
+		}
+		userpass := strings.SplitN(string(decoded), ":", 2)
+		if len(userpass) != 2 {
+			return nil, trace.BadParameter("invalid credentials for registry %v", server)
+		}
+		auth.Configs[server] = dockerapi.AuthConfiguration{
+			Username:      userpass[0],
+			Password:      userpass[1],
+			ServerAddress: server,
+		}
+	}
+	return auth, nil
+}
+
+// credentials returns the credential store for the registry with the specified domain
+func (p *RegistryPuller) credentials(domain string) *credentialStore {
+	creds := &credentialStore{refreshTokens: make(map[string]string)}
+	if p.Auth == nil {
+		return creds
+	}
+	for server, config := range p.Auth.Configs {
+		if config.ServerAddress != "" {
+			server = config.ServerAddress
+		}
+		if registryDomain(server) == registryDomain(domain) {
+			creds.username, creds.password = config.Username, config.Password
+			break
+		}
+	}
+	return creds
+}
+
+// ping queries the registry API endpoint and records the authentication
+// challenges the registry responds with
+func (p *RegistryPuller) ping(manager challenge.Manager, endpoint string) error {
+	client := &http.Client{Transport: p.Transport}
+	resp, err := client.Get(endpoint + "/v2/")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer resp.Body.Close()
+	return trace.Wrap(manager.AddResponse(resp))
+}
+
+// endpoint returns the API endpoint of the registry with the specified domain
+func (p *RegistryPuller) endpoint(domain string) string {
+	if isDockerHub(domain) {
+		return "https://" + dockerHubRegistry
+	}
+	host, _ := utils.SplitHostPort(domain, "")
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) ||
+		utils.StringInSlice(p.InsecureRegistries, domain) {
+		return "http://" + domain
+	}
+	return "https://" + domain
+}
+
+// writeManifest writes the specified manifest into the layout
+// and returns its descriptor
+func writeManifest(layout *OCILayout, manifest distribution.Manifest) (*OCIDescriptor, error) {
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	dgst := digest.FromBytes(payload)
+	if err := layout.WriteBlob(dgst, bytes.NewReader(payload)); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+// pullBlob downloads the blob given with desc into layout unless it is already there
+func pullBlob(ctx context.Context, blobs distribution.BlobStore, desc distribution.Descriptor, layout *OCILayout) error {
+	if len(desc.URLs) != 0 || layout.HasBlob(desc.Digest) {
+		return nil
+	}
+	reader, err := blobs.Open(ctx, desc.Digest)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	return trace.Wrap(layout.WriteBlob(desc.Digest, reader))
+}
+
+// registryDomain returns the domain of the registry with the specified address.
+// The address can be given as a URL, as found in the docker client configuration
+func registryDomain(addr string) string {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+	addr = strings.SplitN(addr, "/", 2)[0]
+	if isDockerHub(addr) || addr == dockerHubRegistry {
+		return defaultDomain
+	}
+	return addr
+}
+
+// credentialStore provides the credentials of a single registry
+// to the registry authentication handlers
+type credentialStore struct {
+	username string
+	password string
+	// mu protects refreshTokens
+	mu sync.Mutex
+	// refreshTokens maps token service realm and name to refresh token
+	refreshTokens map[string]string
+}
+
+// Basic returns the username and password for the registry
+func (r *credentialStore) Basic(*url.URL) (string, string) {
+	return r.username, r.password
+}
+
+// RefreshToken returns the refresh token for the specified token service
+func (r *credentialStore) RefreshToken(realm *url.URL, service string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refreshTokens[refreshTokenKey(realm, service)]
+}
+
+// SetRefreshToken records the refresh token for the specified token service
+func (r *credentialStore) SetRefreshToken(realm *url.URL, service, token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshTokens[refreshTokenKey(realm, service)] = token
+}
+
+func refreshTokenKey(realm *url.URL, service string) string {
+	return fmt.Sprintf("%v/%v", realm, service)
+}
+
+func isDockerHub(domain string) bool {
+	return domain == "" || domain == defaultDomain || domain == "index.docker.io"
+}
+
+// dockerHubRegistry is the address of the Docker Hub registry API
+const dockerHubRegistry = "registry-1.docker.io"
@@ -375,6 +375,9 @@ func (r *applications) ListApps(req appservice.ListAppsRequest) (apps []appservi
 		if item.Manifest == nil { // app packages have non-nil manifests
 			continue
 		}
+		if item.Type == pack.PurposeHelmChart { // chart packages carry chart metadata instead
+			continue
+		}
 		if item.Hidden && req.ExcludeHidden {
 			continue
 		}
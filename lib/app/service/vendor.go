@@ -43,6 +43,7 @@ import (
 	"github.com/gravitational/gravity/lib/utils"
 
 	dockerarchive "github.com/docker/docker/pkg/archive"
+	"github.com/docker/libtrust"
 	teleutils "github.com/gravitational/teleport/lib/utils"
 	"github.com/gravitational/trace"
 	log "github.com/sirupsen/logrus"
@@ -132,6 +133,18 @@ type VendorRequest struct {
 	// ProgressReporter is a special writer, if set, vendorer will output user-friendly
 	// information during vendoring
 	ProgressReporter utils.Progress
+	// Daemonless specifies whether to pull images directly from registries
+	// into an OCI image layout instead of going through the local docker daemon
+	Daemonless bool
+	// Platforms lists the platforms to retain from multi-platform images
+	// when pulling images directly from registries.
+	// Defaults to docker.DefaultPlatform
+	Platforms []docker.Platform
+	// PinDigests specifies whether to rewrite image references in the application
+	// resources to immutable digests and record an image lock in the application
+	PinDigests bool
+	// SigningKey is the optional key to sign the image lock with
+	SigningKey libtrust.PrivateKey
 }
 
 // vendorer is a helper struct that encapsulates all services needed to vendor/rewrite images in
@@ -247,9 +260,18 @@ func (v *vendorer) VendorDir(ctx context.Context, unpackedDir string, req Vendor
 		return trace.Wrap(err)
 	}
 
+	if req.Daemonless && len(runtimeImages) != 0 {
+		return trace.BadParameter("runtime base images %v can only be vendored "+
+			"with a docker daemon", runtimeImages)
+	}
+
 	// pull the default container image along with the rest of images
 	imagesToPull := append(images, defaults.ContainerImage)
 	imagesToPull = append(imagesToPull, runtimeImages...)
+	if req.Daemonless {
+		// images are pulled directly from registries during export
+		imagesToPull = nil
+	}
 
 	group, groupCtx := run.WithContext(ctx, run.WithParallel(req.Parallel))
 	for _, image := range imagesToPull {
@@ -290,11 +312,31 @@ func (v *vendorer) VendorDir(ctx context.Context, unpackedDir string, req Vendor
 		return trace.Wrap(err)
 	}
 
+	if err = v.exportImages(ctx, unpackedDir, resourceFiles, images, chartImages, req); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if req.PinDigests {
+		return trace.Wrap(v.pinImageDigests(ctx, unpackedDir, resourceFiles, req))
+	}
+
+	return nil
+}
+
+// exportImages exports the specified images into the registry directory
+// of the application unless the application already contains one
+func (v *vendorer) exportImages(ctx context.Context, unpackedDir string, resourceFiles resources.ResourceFiles, images, chartImages []string, req VendorRequest) (err error) {
 	if ok, _ := utils.IsDirectory(filepath.Join(unpackedDir, defaults.RegistryDir)); ok {
 		log.Debug("Registry layers are present.")
 		return nil
 	}
 
+	if req.Daemonless {
+		sources := append(images, chartImages...)
+		log.Infof("Will pull images %q from registries without docker daemon.", sources)
+		return trace.Wrap(v.pullAndExportImagesFromRegistries(ctx, teleutils.Deduplicate(sources), unpackedDir, req))
+	}
+
 	// if the application package does not contain the dump of docker images of the referenced
 	// containers, pull all the necessary images, then export those images to disk
 	images, err = resourceFiles.Images()
@@ -319,6 +361,32 @@ func (v *vendorer) VendorDir(ctx context.Context, unpackedDir string, req Vendor
 	return nil
 }
 
+// pinImageDigests rewrites image references in the application resources to
+// the immutable digests of the vendored images and records the image lock
+// in the application's registry directory.
+//
+// Images referenced from Helm charts are locked but not rewritten since
+// chart templates are only rendered at install time
+func (v *vendorer) pinImageDigests(ctx context.Context, unpackedDir string, resourceFiles resources.ResourceFiles, req VendorRequest) error {
+	registryDir := filepath.Join(unpackedDir, defaults.RegistryDir)
+	lock, err := docker.NewImageLock(ctx, registryDir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = resourceFiles.RewriteImages(makeRewritePinDigestsFunc(*lock, v.imageService))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err = resourceFiles.Write(); err != nil {
+		return trace.Wrap(err)
+	}
+	if err = docker.WriteImageLock(registryDir, *lock, req.SigningKey); err != nil {
+		return trace.Wrap(err)
+	}
+	req.ProgressReporter.PrintSubStep("Pinned %v images to digests", len(lock.Images))
+	return nil
+}
+
 // printResourceStatus prints a user-friendly status message about the provided
 // resource file which gives the user a high-level visibility into the process
 // of discovering images from resources
@@ -378,6 +446,82 @@ func (v *vendorer) pullAndExportImages(ctx context.Context, images []string, exp
 	return nil
 }
 
+// pullAndExportImagesFromRegistries pulls the specified images directly from their
+// registries into an OCI image layout and imports the layout into the registry
+// directory in exportDir.
+//
+// Images are stored without their registry, the same way they are referenced after
+// being rewritten to point to the cluster registry
+func (v *vendorer) pullAndExportImagesFromRegistries(ctx context.Context, images []string, exportDir string, req VendorRequest) error {
+	sources, err := v.imageSources(append(images, hooks.InitContainerImage))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	layoutDir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(layoutDir)
+	layout, err := docker.NewOCILayout(layoutDir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	auth, err := docker.ReadAuthConfigurations()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	puller, err := docker.NewRegistryPuller(docker.RegistryPullerConfig{
+		Platforms: req.Platforms,
+		Auth:      auth,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	group, groupCtx := run.WithContext(ctx, run.WithParallel(req.Parallel))
+	for target, source := range sources {
+		target, source := target, source
+		group.Go(groupCtx, func() error {
+			req.ProgressReporter.PrintSubStep("Pulling remote image %v", source)
+			if err := puller.Pull(groupCtx, source, target, layout); err != nil {
+				return trace.Wrap(err)
+			}
+			req.ProgressReporter.PrintSubStep("Vendored image %v", source)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = docker.ImportOCILayout(ctx, layoutDir, filepath.Join(exportDir, defaults.RegistryDir))
+	return trace.Wrap(err)
+}
+
+// imageSources maps the specified images to the references they should be
+// pulled from. The keys of the resulting map are the image references without registry.
+// Images pinned by digest keep the digest, images without tag get the "latest" tag
+func (v *vendorer) imageSources(images []string) (map[string]string, error) {
+	sources := make(map[string]string)
+	for _, image := range images {
+		source := image
+		switch {
+		case image == hooks.InitContainerImage:
+			source = defaults.ContainerImage
+		case strings.HasPrefix(image, v.registryURL):
+			source = v.imageService.Unwrap(image)
+		}
+		parsed, err := loc.ParseDockerImage(image)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		parsed.Registry = ""
+		if parsed.Tag == "" {
+			parsed.Tag = "latest"
+		}
+		sources[parsed.String()] = source
+	}
+	return sources, nil
+}
+
 func (v *vendorer) translateRuntimeImages(m *schema.Manifest) error {
 	if m.SystemOptions != nil && m.SystemOptions.BaseImage != "" {
 		_, tag, err := parseImageNameTag(m.SystemOptions.BaseImage)
@@ -522,6 +666,29 @@ func makeRewriteSetImagesFunc(setImages []loc.DockerImage) rewriteFunc {
 	}
 }
 
+// makeRewritePinDigestsFunc returns a function that rewrites vendored images
+// to reference the digests recorded in the specified image lock
+func makeRewritePinDigestsFunc(lock docker.ImageLock, imageService docker.ImageService) rewriteFunc {
+	return func(image string) string {
+		parsed, err := loc.ParseDockerImage(image)
+		if err != nil {
+			log.Warningf("Failed to pin %v: %v.", image, trace.DebugReport(err))
+			return image
+		}
+		if strings.HasPrefix(parsed.Tag, "sha256:") {
+			return image
+		}
+		dgst, ok := lock.Digest(imageService.Unwrap(image))
+		if !ok {
+			log.Warningf("Image %v is not in the image lock.", image)
+			return image
+		}
+		parsed.Tag = dgst.String()
+		log.Infof("Image %v pinned to %v.", image, parsed.String())
+		return parsed.String()
+	}
+}
+
 // makeRewriteAppMetadataFunc returns a function to rewrite application metadata: repository, name or version
 func makeRewriteAppMetadataFunc(setRepository, setName, setVersion string) resources.ManifestRewriteFunc {
 	return func(m *schema.Manifest) error {
@@ -18,16 +18,20 @@ package service
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/gravitational/gravity/lib/app/docker"
+	"github.com/gravitational/gravity/lib/app/hooks"
 	"github.com/gravitational/gravity/lib/app/resources"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/loc"
 	"github.com/gravitational/gravity/lib/schema"
 
+	"github.com/opencontainers/go-digest"
 	. "gopkg.in/check.v1"
 )
 
@@ -202,6 +206,50 @@ func (*VendorSuite) TestGeneratesProperPackageNames(c *C) {
 	}
 }
 
+func (*VendorSuite) TestMapsImagesToRegistrySources(c *C) {
+	imageService, err := docker.NewImageService(docker.RegistryConnectionRequest{
+		RegistryAddress: "leader.telekube.local:5000",
+	})
+	c.Assert(err, IsNil)
+	v := &vendorer{
+		imageService: imageService,
+		registryURL:  "leader.telekube.local:5000",
+	}
+	dgst := digest.FromString("manifest")
+	sources, err := v.imageSources([]string{
+		"quay.io/gravitational/nginx:1.0.0",
+		"postgres",
+		"leader.telekube.local:5000/gravitational/app:2.0.0",
+		fmt.Sprintf("quay.io/gravitational/redis@%v", dgst),
+		hooks.InitContainerImage,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(sources, DeepEquals, map[string]string{
+		"gravitational/nginx:1.0.0":                 "quay.io/gravitational/nginx:1.0.0",
+		"postgres:latest":                           "postgres",
+		"gravitational/app:2.0.0":                   "gravitational/app:2.0.0",
+		fmt.Sprintf("gravitational/redis@%v", dgst): fmt.Sprintf("quay.io/gravitational/redis@%v", dgst),
+		defaults.HookContainerNameTag:               defaults.ContainerImage,
+	})
+}
+
+func (*VendorSuite) TestPinsImagesToDigests(c *C) {
+	imageService, err := docker.NewImageService(docker.RegistryConnectionRequest{
+		RegistryAddress: "leader.telekube.local:5000",
+	})
+	c.Assert(err, IsNil)
+	dgst := digest.FromString("manifest")
+	rewrite := makeRewritePinDigestsFunc(docker.ImageLock{
+		Images: []docker.LockedImage{{Image: "nginx:1.0.0", Digest: dgst}},
+	}, imageService)
+	c.Assert(rewrite("leader.telekube.local:5000/nginx:1.0.0"), Equals,
+		fmt.Sprintf("leader.telekube.local:5000/nginx@%v", dgst))
+	c.Assert(rewrite("leader.telekube.local:5000/redis:1.0.0"), Equals,
+		"leader.telekube.local:5000/redis:1.0.0")
+	pinned := fmt.Sprintf("leader.telekube.local:5000/nginx@%v", digest.FromString("other"))
+	c.Assert(rewrite(pinned), Equals, pinned)
+}
+
 func createResourceFile(path, manifest string, c *C) resources.ResourceFiles {
 	dir := c.MkDir()
 	fileName := filepath.Join(dir, path)
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup implements cluster backup bundles used for disaster
+// recovery.
+//
+// A bundle is a tarball with the cluster state (users, roles, auth
+// connectors and trusted clusters), the cluster packages including the
+// certificate authority and, optionally, the results of the application
+// backup hook. A bundle is restored by installing a new cluster with the
+// same name with gravity install --restore.
+//
+// Kubernetes objects are not part of the bundle: the etcd data references
+// the nodes and addresses of the original cluster so it can not be applied
+// to new hardware. The application backup hook is responsible for backing
+// up the application resources.
+package backup
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/blob/fs"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/pack/localpack"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	"github.com/gravitational/trace"
+)
+
+const (
+	// FormatVersion is the version of the bundle layout
+	FormatVersion = 1
+
+	// metadataFile is the name of the file with bundle metadata
+	metadataFile = "metadata.json"
+	// stateFile is the name of the database with the exported cluster state
+	stateFile = "cluster.db"
+	// packagesDir is the name of the directory with the cluster packages
+	packagesDir = "packages"
+	// appFile is the name of the tarball with the application backup
+	appFile = "app.tar.gz"
+)
+
+// Metadata describes the cluster a bundle was taken from
+type Metadata struct {
+	// Version is the bundle format version
+	Version int `json:"version"`
+	// ClusterName is the name of the backed up cluster
+	ClusterName string `json:"cluster_name"`
+	// Application is the cluster application package
+	Application loc.Locator `json:"application"`
+	// Created is the time the bundle was created
+	Created time.Time `json:"created"`
+	// Servers is the list of cluster servers at the time of backup
+	Servers []storage.Server `json:"servers"`
+	// HasAppBackup is true if the bundle contains the application backup
+	HasAppBackup bool `json:"has_app_backup"`
+}
+
+// Check makes sure the metadata describes a bundle this version can restore
+func (m Metadata) Check() error {
+	if m.Version != FormatVersion {
+		return trace.BadParameter("unsupported backup format version %v, expected %v",
+			m.Version, FormatVersion)
+	}
+	if m.ClusterName == "" {
+		return trace.BadParameter("backup is missing cluster name")
+	}
+	if m.Application.IsEmpty() {
+		return trace.BadParameter("backup is missing cluster application")
+	}
+	return nil
+}
+
+// BundleLocator returns the locator of the package the backup of the
+// specified cluster is uploaded as to the installer restoring the cluster
+func BundleLocator(clusterName string) loc.Locator {
+	return loc.Locator{
+		Repository: clusterName,
+		Name:       defaults.ClusterBackupPackage,
+		Version:    "0.0.1",
+	}
+}
+
+// Bundle is a cluster backup bundle unpacked into a directory
+type Bundle struct {
+	// Metadata describes the backed up cluster
+	Metadata
+	// Dir is the directory with bundle contents
+	Dir string
+}
+
+// New returns a new empty bundle in the specified directory
+func New(dir string, metadata Metadata) (*Bundle, error) {
+	if err := os.MkdirAll(filepath.Join(dir, packagesDir), defaults.SharedDirMask); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	metadata.Version = FormatVersion
+	return &Bundle{Metadata: metadata, Dir: dir}, nil
+}
+
+// Open returns the bundle unpacked into the specified directory
+func Open(dir string) (*Bundle, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := metadata.Check(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Bundle{Metadata: metadata, Dir: dir}, nil
+}
+
+// StatePath returns the path to the database with the cluster state
+func (b *Bundle) StatePath() string {
+	return filepath.Join(b.Dir, stateFile)
+}
+
+// AppPath returns the path to the tarball with the application backup
+func (b *Bundle) AppPath() string {
+	return filepath.Join(b.Dir, appFile)
+}
+
+// Packages returns the package service with the bundle packages.
+// The caller is responsible for closing the returned backend
+func (b *Bundle) Packages() (pack.PackageService, storage.Backend, error) {
+	dir := filepath.Join(b.Dir, packagesDir)
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, defaults.GravityDBFile)})
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	objects, err := fs.New(dir)
+	if err != nil {
+		backend.Close()
+		return nil, nil, trace.Wrap(err)
+	}
+	packages, err := localpack.New(localpack.Config{
+		Backend:     backend,
+		UnpackedDir: filepath.Join(dir, defaults.UnpackedDir),
+		Objects:     objects,
+	})
+	if err != nil {
+		backend.Close()
+		return nil, nil, trace.Wrap(err)
+	}
+	return packages, backend, nil
+}
+
+// Write writes the bundle as a tarball into w.
+// The metadata is written first so it can be read without
+// reading the whole bundle
+func (b *Bundle) Write(w io.Writer) error {
+	data, err := json.Marshal(b.Metadata)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = archive.CompressDirectory(b.Dir, w, archive.ItemFromString(metadataFile, string(data)))
+	return trace.Wrap(err)
+}
+
+// Unpack unpacks the bundle tarball read from r into the specified directory
+func Unpack(r io.Reader, dir string) (*Bundle, error) {
+	if err := archive.Extract(r, dir); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	bundle, err := Open(dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return bundle, nil
+}
+
+// ReadMetadata returns the metadata of the bundle tarball at the specified path
+func ReadMetadata(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+	var metadata *Metadata
+	err = archive.TarGlob(tar.NewReader(f), ".", []string{metadataFile},
+		func(_ string, r io.Reader) error {
+			metadata = &Metadata{}
+			if err := json.NewDecoder(r).Decode(metadata); err != nil {
+				return trace.Wrap(err)
+			}
+			return archive.Abort
+		})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if metadata == nil {
+		return nil, trace.BadParameter("%v is not a cluster backup", path)
+	}
+	if err := metadata.Check(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/blob/fs"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/pack/localpack"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+	"github.com/gravitational/gravity/lib/users"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestBackup(t *testing.T) { TestingT(t) }
+
+type BackupSuite struct{}
+
+var _ = Suite(&BackupSuite{})
+
+func (s *BackupSuite) TestExportImportState(c *C) {
+	src := newBackend(c)
+	role, err := users.NewAdminRole()
+	c.Assert(err, IsNil)
+	c.Assert(src.UpsertRole(role, storage.Forever), IsNil)
+	_, err = src.UpsertUser(storage.NewUser("admin@example.com", storage.UserSpecV2{
+		Type:     storage.AdminUser,
+		Password: "hash",
+		Roles:    []string{role.GetName()},
+	}))
+	c.Assert(err, IsNil)
+	_, err = src.UpsertAPIKey(storage.APIKey{Token: "token", UserEmail: "admin@example.com"})
+	c.Assert(err, IsNil)
+	_, err = src.UpsertUser(storage.NewUser("agent@example.com", storage.UserSpecV2{
+		Type: storage.AgentUser,
+	}))
+	c.Assert(err, IsNil)
+	err = src.UpsertGithubConnector(storage.NewGithubConnector("github", teleservices.GithubConnectorSpecV3{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		RedirectURL:  "https://example.com",
+		TeamsToLogins: []teleservices.TeamMapping{{
+			Organization: "example",
+			Team:         "admins",
+			Logins:       []string{constants.RoleAdmin},
+		}},
+	}))
+	c.Assert(err, IsNil)
+	for _, cluster := range []storage.TrustedCluster{
+		storage.NewTrustedCluster("ops.example.com", storage.TrustedClusterSpecV2{
+			Enabled:              true,
+			ProxyAddress:         "ops.example.com:32009",
+			ReverseTunnelAddress: "ops.example.com:32024",
+			Roles:                []string{constants.RoleAdmin},
+			Token:                "secret",
+		}),
+		storage.NewTrustedCluster("installer", storage.TrustedClusterSpecV2{
+			Enabled:              true,
+			ProxyAddress:         "192.168.1.1:32009",
+			ReverseTunnelAddress: "192.168.1.1:32024",
+			Roles:                []string{constants.RoleAdmin},
+			Token:                "secret",
+			Wizard:               true,
+		}),
+	} {
+		_, err = src.UpsertTrustedCluster(cluster)
+		c.Assert(err, IsNil)
+	}
+
+	path := filepath.Join(c.MkDir(), stateFile)
+	c.Assert(ExportState(src, path), IsNil)
+	dst := newBackend(c)
+	c.Assert(ImportState(path, dst), IsNil)
+
+	users, err := dst.GetAllUsers()
+	c.Assert(err, IsNil)
+	c.Assert(users, HasLen, 1)
+	c.Assert(users[0].GetName(), Equals, "admin@example.com")
+	c.Assert(users[0].GetPassword(), Equals, "hash")
+	keys, err := dst.GetAPIKeys("admin@example.com")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	_, err = dst.GetRole(role.GetName())
+	c.Assert(err, IsNil)
+	connector, err := dst.GetGithubConnector("github", true)
+	c.Assert(err, IsNil)
+	c.Assert(connector.GetClientSecret(), Equals, "secret")
+	clusters, err := dst.GetTrustedClusters()
+	c.Assert(err, IsNil)
+	c.Assert(clusters, HasLen, 1)
+	c.Assert(clusters[0].GetName(), Equals, "ops.example.com")
+}
+
+func (s *BackupSuite) TestExportsClusterPackages(c *C) {
+	src, _ := newPackages(c, c.MkDir())
+	for _, p := range []struct {
+		locator string
+		labels  map[string]string
+	}{
+		{locator: "gravitational.io/planet:1.0.0"},
+		{locator: "example.com/ca:0.0.1", labels: map[string]string{pack.PurposeLabel: pack.PurposeCA}},
+		{locator: "example.com/license:0.0.1", labels: map[string]string{pack.PurposeLabel: pack.PurposeLicense}},
+		{locator: "example.com/planet-secrets:0.0.1", labels: map[string]string{pack.PurposeLabel: pack.PurposePlanetSecrets}},
+		{locator: "example.com/etcd-snapshot:0.0.1", labels: map[string]string{pack.PurposeLabel: pack.PurposeEtcdSnapshot}},
+		{locator: "example.com/planet-config:0.0.1", labels: map[string]string{pack.ConfigLabel: "gravitational.io/planet:1.0.0"}},
+		{locator: "vendor.io/app:1.0.0"},
+	} {
+		locator := loc.MustParseLocator(p.locator)
+		c.Assert(src.UpsertRepository(locator.Repository, time.Time{}), IsNil)
+		_, err := src.CreatePackage(locator, strings.NewReader(p.locator), pack.WithLabels(p.labels))
+		c.Assert(err, IsNil)
+	}
+
+	dir := c.MkDir()
+	bundle, err := New(dir, Metadata{
+		ClusterName: "example.com",
+		Application: loc.MustParseLocator("vendor.io/app:1.0.0"),
+		Created:     time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC),
+	})
+	c.Assert(err, IsNil)
+	dst, backend, err := bundle.Packages()
+	c.Assert(err, IsNil)
+	c.Assert(ExportPackages(src, dst, "example.com", logrus.StandardLogger()), IsNil)
+	c.Assert(packageNames(c, dst), DeepEquals, []string{
+		"example.com/ca:0.0.1",
+		"example.com/license:0.0.1",
+		"vendor.io/app:1.0.0",
+	})
+	envelope, err := dst.ReadPackageEnvelope(loc.MustParseLocator("example.com/ca:0.0.1"))
+	c.Assert(err, IsNil)
+	c.Assert(envelope.HasLabel(pack.PurposeLabel, pack.PurposeCA), Equals, true)
+	c.Assert(backend.Close(), IsNil)
+
+	// existing packages are not overwritten on import
+	restored, _ := newPackages(c, c.MkDir())
+	c.Assert(restored.UpsertRepository("example.com", time.Time{}), IsNil)
+	_, err = restored.CreatePackage(loc.MustParseLocator("example.com/ca:0.0.1"), strings.NewReader("new"))
+	c.Assert(err, IsNil)
+	dst, backend, err = bundle.Packages()
+	c.Assert(err, IsNil)
+	defer backend.Close()
+	c.Assert(ImportPackages(dst, restored, logrus.StandardLogger()), IsNil)
+	c.Assert(packageNames(c, restored), DeepEquals, []string{
+		"example.com/ca:0.0.1",
+		"example.com/license:0.0.1",
+		"vendor.io/app:1.0.0",
+	})
+	envelope, err = restored.ReadPackageEnvelope(loc.MustParseLocator("example.com/ca:0.0.1"))
+	c.Assert(err, IsNil)
+	c.Assert(envelope.SizeBytes, Equals, int64(len("new")))
+}
+
+func (s *BackupSuite) TestWritesAndUnpacksBundle(c *C) {
+	metadata := Metadata{
+		ClusterName:  "example.com",
+		Application:  loc.MustParseLocator("vendor.io/app:1.0.0"),
+		Created:      time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC),
+		Servers:      []storage.Server{{AdvertiseIP: "192.168.1.1", Hostname: "node-1"}},
+		HasAppBackup: true,
+	}
+	bundle, err := New(c.MkDir(), metadata)
+	c.Assert(err, IsNil)
+	c.Assert(ExportState(newBackend(c), bundle.StatePath()), IsNil)
+	f, err := os.Create(bundle.AppPath())
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	path := filepath.Join(c.MkDir(), "backup.tar")
+	f, err = os.Create(path)
+	c.Assert(err, IsNil)
+	c.Assert(bundle.Write(f), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	metadata.Version = FormatVersion
+	read, err := ReadMetadata(path)
+	c.Assert(err, IsNil)
+	c.Assert(*read, DeepEquals, metadata)
+
+	f, err = os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	unpacked, err := Unpack(f, c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(unpacked.Metadata, DeepEquals, metadata)
+	_, err = os.Stat(unpacked.AppPath())
+	c.Assert(err, IsNil)
+	c.Assert(ImportState(unpacked.StatePath(), newBackend(c)), IsNil)
+}
+
+func (s *BackupSuite) TestRejectsUnsupportedVersion(c *C) {
+	err := Metadata{Version: FormatVersion + 1, ClusterName: "example.com",
+		Application: loc.MustParseLocator("vendor.io/app:1.0.0")}.Check()
+	c.Assert(err, NotNil)
+}
+
+func newBackend(c *C) storage.Backend {
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(c.MkDir(), "bolt.db")})
+	c.Assert(err, IsNil)
+	return backend
+}
+
+func newPackages(c *C, dir string) (pack.PackageService, storage.Backend) {
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, "bolt.db")})
+	c.Assert(err, IsNil)
+	objects, err := fs.New(dir)
+	c.Assert(err, IsNil)
+	packages, err := localpack.New(localpack.Config{
+		Backend:     backend,
+		UnpackedDir: filepath.Join(dir, defaults.UnpackedDir),
+		Objects:     objects,
+	})
+	c.Assert(err, IsNil)
+	return packages, backend
+}
+
+func packageNames(c *C, packages pack.PackageService) (names []string) {
+	err := pack.ForeachPackage(packages, func(envelope pack.PackageEnvelope) error {
+		names = append(names, envelope.Locator.String())
+		return nil
+	})
+	c.Assert(err, IsNil)
+	sort.Strings(names)
+	return names
+}
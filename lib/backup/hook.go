@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/app/hooks"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleutils "github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+)
+
+// HookRequest returns a request to run the backup or restore hook of the
+// specified application on the specified node along with the directory
+// on the node's host that is mounted into the hook container as the
+// backup directory
+func HookRequest(application loc.Locator, node storage.Server) (req *app.HookRunRequest, dir string, err error) {
+	id, err := teleutils.CryptoRandomHex(3)
+	if err != nil {
+		return nil, "", trace.Wrap(err, "failed to generate random ID")
+	}
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+	req = &app.HookRunRequest{
+		Application: application,
+		Volumes: []v1.Volume{{
+			Name: hooks.VolumeBackup,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: fmt.Sprintf("/ext/state/%v/backup", id),
+				},
+			},
+		}},
+		VolumeMounts: []v1.VolumeMount{{
+			Name:      hooks.VolumeBackup,
+			MountPath: hooks.ContainerBackupDir,
+		}},
+		NodeSelector: map[string]string{
+			defaults.KubernetesHostnameLabel: node.KubeNodeID(),
+		},
+	}
+	dir = filepath.Join(stateDir, "planet", "state", id, "backup")
+	return req, dir, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// nodePackagePurposes lists purposes of the cluster packages that are
+// generated for specific nodes or operations and are not backed up
+// since the restored cluster generates its own
+var nodePackagePurposes = map[string][]string{
+	pack.PurposeLabel: {
+		pack.PurposePlanetSecrets,
+		pack.PurposePlanetConfig,
+		pack.PurposeTeleportMasterConfig,
+		pack.PurposeTeleportNodeConfig,
+		pack.PurposeRPCCredentials,
+		pack.PurposeExport,
+		pack.PurposeEtcdSnapshot,
+	},
+}
+
+// IsClusterPackage returns true if the package should be backed up.
+//
+// Packages from the system repository are not backed up since they
+// are shipped with the installer of the cluster application
+func IsClusterPackage(envelope pack.PackageEnvelope, clusterName string) bool {
+	switch envelope.Locator.Repository {
+	case defaults.SystemAccountOrg:
+		return false
+	case clusterName:
+		if envelope.HasAnyLabel(nodePackagePurposes) {
+			return false
+		}
+		if _, ok := envelope.RuntimeLabels[pack.ConfigLabel]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportPackages copies the cluster packages of the specified cluster
+// from src to dst
+func ExportPackages(src, dst pack.PackageService, clusterName string, log logrus.FieldLogger) error {
+	return pack.ForeachPackage(src, func(envelope pack.PackageEnvelope) error {
+		if !IsClusterPackage(envelope, clusterName) {
+			return nil
+		}
+		return trace.Wrap(CopyPackage(src, dst, envelope.Locator, log))
+	})
+}
+
+// ImportPackages copies all packages from src to dst skipping packages
+// that already exist
+func ImportPackages(src, dst pack.PackageService, log logrus.FieldLogger) error {
+	return pack.ForeachPackage(src, func(envelope pack.PackageEnvelope) error {
+		err := CopyPackage(src, dst, envelope.Locator, log)
+		if err != nil && !trace.IsAlreadyExists(err) {
+			return trace.Wrap(err)
+		}
+		return nil
+	})
+}
+
+// CopyPackage copies the specified package from src to dst preserving
+// its labels, type and manifest
+func CopyPackage(src, dst pack.PackageService, locator loc.Locator, log logrus.FieldLogger) error {
+	_, err := dst.ReadPackageEnvelope(locator)
+	if err == nil {
+		return trace.AlreadyExists("package %v already exists", locator)
+	}
+	if !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	envelope, reader, err := src.ReadPackage(locator)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	if err := dst.UpsertRepository(locator.Repository, time.Time{}); err != nil {
+		return trace.Wrap(err)
+	}
+	log.Infof("Copying package %v.", locator)
+	_, err = dst.CreatePackage(locator, reader,
+		pack.WithLabels(envelope.RuntimeLabels),
+		pack.WithHidden(envelope.Hidden),
+		pack.WithEncrypted(envelope.Encrypted),
+		pack.WithManifest(envelope.Type, envelope.Manifest),
+		pack.WithCreatedBy(envelope.CreatedBy))
+	return trace.Wrap(err)
+}
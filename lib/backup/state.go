@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	"github.com/gravitational/trace"
+)
+
+// ExportState exports the cluster users with their API keys, roles,
+// auth connectors, auth preference and trusted clusters from the src
+// backend into a new database at the specified path.
+//
+// Agent users and the installer trusted cluster are not exported since
+// the restored cluster creates its own during installation
+func ExportState(src storage.Backend, path string) error {
+	dst, err := keyval.NewBolt(keyval.BoltConfig{Path: path})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer dst.Close()
+	return trace.Wrap(copyState(src, dst))
+}
+
+// ImportState imports the cluster state from the database at the
+// specified path into the dst backend, replacing the existing
+// items with the same names
+func ImportState(path string, dst storage.Backend) error {
+	src, err := keyval.NewBolt(keyval.BoltConfig{Path: path})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer src.Close()
+	return trace.Wrap(copyState(src, dst))
+}
+
+func copyState(src, dst storage.Backend) error {
+	roles, err := src.GetRoles()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, role := range roles {
+		if err := dst.UpsertRole(role, storage.Forever); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	users, err := src.GetAllUsers()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, user := range users {
+		if user.GetType() == storage.AgentUser {
+			continue
+		}
+		if _, err := dst.UpsertUser(user); err != nil {
+			return trace.Wrap(err)
+		}
+		keys, err := src.GetAPIKeys(user.GetName())
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		for _, key := range keys {
+			if _, err := dst.UpsertAPIKey(key); err != nil {
+				return trace.Wrap(err)
+			}
+		}
+	}
+	if err := copyConnectors(src, dst); err != nil {
+		return trace.Wrap(err)
+	}
+	authPreference, err := src.GetAuthPreference()
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	if authPreference != nil {
+		if err := dst.UpsertAuthPreference(authPreference); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	clusters, err := src.GetTrustedClusters()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, cluster := range clusters {
+		if trustedCluster, ok := cluster.(storage.TrustedCluster); ok && trustedCluster.GetWizard() {
+			continue
+		}
+		if _, err := dst.UpsertTrustedCluster(cluster); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func copyConnectors(src, dst storage.Backend) error {
+	oidc, err := src.GetOIDCConnectors(true)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range oidc {
+		if err := dst.UpsertOIDCConnector(connector); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	saml, err := src.GetSAMLConnectors(true)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range saml {
+		if err := dst.UpsertSAMLConnector(connector); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	github, err := src.GetGithubConnectors(true)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range github {
+		if err := dst.UpsertGithubConnector(connector); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
@@ -34,7 +34,7 @@ import (
 
 // Build builds the standalone application installer using the provided builder
 func Build(ctx context.Context, builder *Builder) error {
-	err := checkBuildEnv()
+	err := checkBuildEnv(!builder.VendorReq.Daemonless)
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -109,12 +109,15 @@ func Build(ctx context.Context, builder *Builder) error {
 }
 
 // checkBuildEnv makes sure that the environment "tele build" is invoked in is
-// suitable, for example, OS is supported and Docker is running
-func checkBuildEnv() error {
+// suitable, for example, OS is supported and Docker is running if requireDocker is set
+func checkBuildEnv(requireDocker bool) error {
 	if runtime.GOOS != "linux" {
 		return trace.BadParameter("tele build is not supported on %v, only "+
 			"Linux is supported", runtime.GOOS)
 	}
+	if !requireDocker {
+		return nil
+	}
 	client, err := docker.NewClient(constants.DockerEngineURL)
 	if err != nil {
 		return trace.Wrap(err)
@@ -125,7 +128,8 @@ func checkBuildEnv() error {
 		return trace.BadParameter("docker is not running on this machine, " +
 			"please install it (https://docs.docker.com/engine/installation/) " +
 			"and make sure it can be used by a non-root user " +
-			"(https://docs.docker.com/engine/installation/linux/linux-postinstall/)")
+			"(https://docs.docker.com/engine/installation/linux/linux-postinstall/), " +
+			"or use --no-docker to pull images directly from registries")
 	}
 	return nil
 }
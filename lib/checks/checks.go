@@ -30,6 +30,7 @@ import (
 	"github.com/gravitational/gravity/lib/checks/autofix"
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/devicemapper"
 	validationpb "github.com/gravitational/gravity/lib/network/validation/proto"
 	"github.com/gravitational/gravity/lib/schema"
 	"github.com/gravitational/gravity/lib/state"
@@ -298,6 +299,9 @@ type Features struct {
 	// TestDockerDevice specifies if the docker device test should be executed.
 	// Docker device test is only applicable during install.
 	TestDockerDevice bool
+	// TestBlockDevices specifies if the block devices of node profiles should be checked.
+	// Block devices are only provisioned during install and expand.
+	TestBlockDevices bool
 }
 
 // String return textual representation of this server object
@@ -340,6 +344,8 @@ type Requirements struct {
 	Network Network
 	// Volumes describes volumes requirements
 	Volumes []schema.Volume
+	// BlockDevices describes block devices to provision
+	BlockDevices []schema.BlockDevice
 }
 
 // Network describes network requirements
@@ -396,6 +402,13 @@ func (r *checker) Run(ctx context.Context) error {
 			}
 		}
 
+		if r.TestBlockDevices {
+			err = checkBlockDevices(server, requirements.BlockDevices)
+			if err != nil {
+				errors = append(errors, err)
+			}
+		}
+
 		err = checkSystemPackages(server, dockerConfig)
 		if err != nil {
 			errors = append(errors, err)
@@ -776,6 +789,33 @@ func checkDockerDevice(server Server, docker schema.Docker) error {
 	return nil
 }
 
+// checkBlockDevices makes sure the server has unallocated devices
+// for all block devices of its profile
+func checkBlockDevices(server Server, blockDevices []schema.BlockDevice) error {
+	if len(blockDevices) == 0 {
+		return nil
+	}
+
+	dockerDevice := storage.DeviceName(server.DockerDevice)
+	if dockerDevice == "" {
+		dockerDevice = server.Docker.Device.Name
+	}
+	systemDevice := storage.DeviceName(server.SystemDevice)
+	if systemDevice == "" {
+		systemDevice = server.SystemState.Device.Name
+	}
+
+	devices, err := devicemapper.AssignDevices(blockDevices, server.GetDevices(),
+		dockerDevice, systemDevice)
+	if err != nil {
+		return trace.BadParameter("server %q: %v", server.ServerInfo.GetHostname(), err)
+	}
+
+	log.Infof("Server %q passed block devices check: %v.", server.ServerInfo.GetHostname(),
+		devicemapper.FormatAssignment(devices))
+	return nil
+}
+
 // checkSameOS makes sure all servers have the same OS/version
 func checkSameOS(servers []Server) error {
 	osToNodes := make(map[string][]string)
@@ -940,7 +980,7 @@ func constructPingPongRequest(servers []Server, requirements map[string]Requirem
 		}
 		for _, port := range profile.Network.Ports.TCP {
 			listenServer := validationpb.Addr{
-				Addr:    fmt.Sprintf("%v:%v", server.AdvertiseIP, port),
+				Addr:    utils.JoinHostPort(server.AdvertiseIP, port),
 				Network: "tcp",
 			}
 			req.Listen = append(req.Listen, listenServer)
@@ -948,7 +988,7 @@ func constructPingPongRequest(servers []Server, requirements map[string]Requirem
 		}
 		for _, port := range profile.Network.Ports.UDP {
 			listenServer := validationpb.Addr{
-				Addr:    fmt.Sprintf("%v:%v", server.AdvertiseIP, port),
+				Addr:    utils.JoinHostPort(server.AdvertiseIP, port),
 				Network: "udp",
 			}
 			req.Listen = append(req.Listen, listenServer)
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checks
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/devicemapper"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// CheckNodeProfile checks the system information collected on an existing
+// cluster node against the CPU, RAM, volume and block device requirements
+// of the profile the node is moved to from its current profile
+func CheckNodeProfile(server storage.Server, info storage.System, current, profile schema.NodeProfile) error {
+	if info.GetHostname() != server.Hostname {
+		return trace.BadParameter("system information was collected on %v, not on node %v",
+			info.GetHostname(), server.Hostname)
+	}
+	requirements := profile.Requirements
+	err := checkServerProfile(Server{ServerInfo: ServerInfo{System: info}}, Requirements{
+		CPU: &requirements.CPU,
+		RAM: &requirements.RAM,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, volume := range requirements.Volumes {
+		if hasVolume(current.Requirements.Volumes, volume) {
+			// the volume is already in use by the node
+			continue
+		}
+		if err := checkVolume(server, info, volume); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	var blockDevices []schema.BlockDevice
+	for _, blockDevice := range requirements.BlockDevices {
+		if !hasBlockDevice(server.BlockDevices, blockDevice) {
+			blockDevices = append(blockDevices, blockDevice)
+		}
+	}
+	if len(blockDevices) != 0 {
+		_, err := devicemapper.AssignDevices(blockDevices, info.GetDevices(),
+			server.Docker.Device.Name, server.SystemState.Device.Name)
+		if err != nil {
+			return trace.BadParameter("server %q: %v", server.Hostname, err)
+		}
+	}
+	return nil
+}
+
+// checkVolume makes sure the file system the volume resides on
+// satisfies the file system and capacity requirements of the volume
+func checkVolume(server storage.Server, info storage.System, volume schema.Volume) error {
+	if utils.BoolValue(volume.SkipIfMissing) {
+		log.Debugf("Skip check for optional volume %v.", volume.Path)
+		return nil
+	}
+	path := volume.Path
+	if path == defaults.GravityDir {
+		path = server.StateDir()
+	}
+	filesystem := findFilesystem(info.GetFilesystems(), path)
+	if filesystem == nil {
+		return trace.NotFound("server %q has no file system mounted for volume %v",
+			server.Hostname, path)
+	}
+	if len(volume.Filesystems) != 0 && !utils.StringInSlice(volume.Filesystems, filesystem.Type) {
+		return trace.BadParameter("volume %v on server %q is on %v file system, "+
+			"supported are: %v", path, server.Hostname, filesystem.Type,
+			strings.Join(volume.Filesystems, ", "))
+	}
+	free := info.GetFilesystemStats()[filesystem.DirName].FreeKB * 1024
+	if free < volume.Capacity.Bytes() {
+		return trace.BadParameter("volume %v on server %q has %v free which is less "+
+			"than required %v", path, server.Hostname, humanize.Bytes(free),
+			volume.Capacity.String())
+	}
+	log.Infof("Server %q passed volume check: %v.", server.Hostname, path)
+	return nil
+}
+
+// findFilesystem returns the file system with the longest mount point
+// the specified path is located under
+func findFilesystem(filesystems []storage.Filesystem, path string) (result *storage.Filesystem) {
+	path = filepath.Clean(path)
+	for i, filesystem := range filesystems {
+		dir := filepath.Clean(filesystem.DirName)
+		if path != dir && !strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			continue
+		}
+		if result == nil || len(dir) > len(filepath.Clean(result.DirName)) {
+			result = &filesystems[i]
+		}
+	}
+	return result
+}
+
+// hasVolume returns true if volumes have a volume with the same path
+// and at least the capacity of the specified volume
+func hasVolume(volumes []schema.Volume, volume schema.Volume) bool {
+	for _, v := range volumes {
+		if v.Path == volume.Path && v.Capacity.Bytes() >= volume.Capacity.Bytes() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBlockDevice returns true if the block device with the same name
+// has already been assigned a device of sufficient size
+func hasBlockDevice(assigned []storage.BlockDevice, blockDevice schema.BlockDevice) bool {
+	for _, device := range assigned {
+		if device.Name == blockDevice.Name && device.Device.SizeMB*1000000 >= blockDevice.Capacity.Bytes() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checks
+
+import (
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+)
+
+type ProfileSuite struct {
+	server storage.Server
+	info   storage.System
+}
+
+var _ = Suite(&ProfileSuite{})
+
+func (s *ProfileSuite) SetUpTest(c *C) {
+	s.server = storage.Server{
+		Hostname: "node-1",
+		Docker:   storage.Docker{Device: storage.Device{Name: "/dev/sdb"}},
+		BlockDevices: []storage.BlockDevice{
+			{Name: "data", Device: storage.Device{Name: "/dev/sdc", SizeMB: 10000}},
+		},
+	}
+	s.info = storage.NewSystemInfo(storage.SystemSpecV2{
+		Hostname: "node-1",
+		Filesystems: []storage.Filesystem{
+			{DirName: "/", Type: "ext4"},
+			{DirName: "/var/lib/data", Type: "xfs"},
+		},
+		FilesystemStats: storage.FilesystemStats{
+			"/":             {TotalKB: 10000000, FreeKB: 5000000},
+			"/var/lib/data": {TotalKB: 2000000, FreeKB: 1000000},
+		},
+		Memory: storage.Memory{Total: 4000000000},
+		NumCPU: 4,
+		Devices: storage.Devices{
+			{Name: "/dev/sdb", SizeMB: 50000},
+			{Name: "/dev/sdd", SizeMB: 20000},
+		},
+	})
+}
+
+func (s *ProfileSuite) TestChecksNodeProfile(c *C) {
+	current := schema.NodeProfile{Name: "worker"}
+	profile := schema.NodeProfile{
+		Name: "db",
+		Requirements: schema.Requirements{
+			CPU: schema.CPU{Min: 2},
+			RAM: schema.RAM{Min: utils.MustParseCapacity("2GB")},
+			Volumes: []schema.Volume{
+				{Path: "/var/lib/data/db", Capacity: utils.MustParseCapacity("500MB"), Filesystems: []string{"xfs"}},
+				{Path: "/opt/db", Capacity: utils.MustParseCapacity("4GB")},
+			},
+			BlockDevices: []schema.BlockDevice{
+				{Name: "data", Capacity: utils.MustParseCapacity("5GB")},
+				{Name: "logs", Capacity: utils.MustParseCapacity("10GB")},
+			},
+		},
+	}
+	c.Assert(CheckNodeProfile(s.server, s.info, current, profile), IsNil)
+
+	var testCases = []struct {
+		update  func(*schema.NodeProfile)
+		comment string
+	}{
+		{
+			update:  func(p *schema.NodeProfile) { p.Requirements.CPU.Min = 8 },
+			comment: "not enough CPUs",
+		},
+		{
+			update:  func(p *schema.NodeProfile) { p.Requirements.RAM.Min = utils.MustParseCapacity("8GB") },
+			comment: "not enough RAM",
+		},
+		{
+			update:  func(p *schema.NodeProfile) { p.Requirements.Volumes[0].Filesystems = []string{"ext4"} },
+			comment: "unsupported file system",
+		},
+		{
+			update:  func(p *schema.NodeProfile) { p.Requirements.Volumes[0].Capacity = utils.MustParseCapacity("2GB") },
+			comment: "not enough free space",
+		},
+		{
+			update:  func(p *schema.NodeProfile) { p.Requirements.BlockDevices[1].Capacity = utils.MustParseCapacity("30GB") },
+			comment: "no unallocated device, docker device is excluded",
+		},
+	}
+	for _, tc := range testCases {
+		p := profile
+		p.Requirements.Volumes = append([]schema.Volume{}, profile.Requirements.Volumes...)
+		p.Requirements.BlockDevices = append([]schema.BlockDevice{}, profile.Requirements.BlockDevices...)
+		tc.update(&p)
+		err := CheckNodeProfile(s.server, s.info, current, p)
+		c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("%v: %v", tc.comment, err))
+	}
+
+	// volumes already used by the current profile are not checked again
+	profile.Requirements.Volumes[0].Capacity = utils.MustParseCapacity("2GB")
+	current.Requirements.Volumes = profile.Requirements.Volumes
+	c.Assert(CheckNodeProfile(s.server, s.info, current, profile), IsNil)
+
+	s.server.Hostname = "node-2"
+	c.Assert(trace.IsBadParameter(CheckNodeProfile(s.server, s.info, current, profile)), Equals, true)
+}
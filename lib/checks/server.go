@@ -36,7 +36,7 @@ func (r ServerInfos) FindByIP(addr string) (*ServerInfo, error) {
 	ip, _ := utils.SplitHostPort(addr, "")
 	for _, info := range r {
 		for _, iface := range info.GetNetworkInterfaces() {
-			if iface.IPv4 == ip {
+			if iface.HasAddr(ip) {
 				return &info, nil
 			}
 		}
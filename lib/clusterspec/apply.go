@@ -0,0 +1,291 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/resources"
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/trace"
+)
+
+const (
+	// ActionCreate creates a new configuration resource
+	ActionCreate = "create"
+	// ActionUpdate updates an existing configuration resource
+	ActionUpdate = "update"
+	// ActionUpgrade upgrades the cluster application
+	ActionUpgrade = "upgrade"
+	// ActionExpand means more nodes need to join the cluster
+	ActionExpand = "expand"
+	// ActionShrink means nodes need to be removed from the cluster,
+	// specifications with this change are rejected
+	ActionShrink = "shrink"
+
+	// kindApp identifies the cluster application in changes
+	kindApp = "app"
+	// kindNodes identifies node profiles in changes
+	kindNodes = "nodes"
+)
+
+// Change describes a single difference between the desired and the current
+// state of the cluster
+type Change struct {
+	// Action is the action that brings the cluster to the desired state
+	Action string `json:"action"`
+	// Kind is the kind of the changed object
+	Kind string `json:"kind"`
+	// Name is the name of the changed object
+	Name string `json:"name"`
+	// Details describes the change
+	Details string `json:"details,omitempty"`
+	// Resource is the desired resource for create and update actions
+	Resource *teleservices.UnknownResource `json:"-"`
+	// App is the desired application package for the upgrade action
+	App *loc.Locator `json:"-"`
+}
+
+// IsManual returns true if the change can not be applied automatically
+// and requires an action from the user, e.g. joining new nodes
+func (c Change) IsManual() bool {
+	return c.Action == ActionExpand
+}
+
+// CheckChanges returns an error if the changes can not be applied.
+//
+// Specifications with fewer nodes than the cluster has are rejected since
+// they do not say which nodes to remove
+func CheckChanges(changes []Change) error {
+	for _, change := range changes {
+		if change.Action == ActionShrink {
+			return trace.BadParameter("node profile %q has more nodes than the specification (%v), "+
+				"remove the extra nodes with 'gravity remove' before applying it", change.Name, change.Details)
+		}
+	}
+	return nil
+}
+
+// Diff computes the changes required to bring the cluster to the state
+// described by spec. Resources present in the cluster but missing from
+// the specification are left untouched.
+func Diff(spec ClusterSpecV2, cluster ops.Site, controller resources.Resources) (changes []Change, err error) {
+	for _, resource := range spec.Resources() {
+		change, err := diffResource(resource, controller)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	nodeChanges, err := diffNodes(spec.Spec.Nodes, cluster)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	changes = append(changes, nodeChanges...)
+	if spec.Spec.App != "" {
+		app, err := loc.ParseLocator(spec.Spec.App)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if !cluster.App.Package.IsEqualTo(*app) {
+			changes = append(changes, Change{
+				Action:  ActionUpgrade,
+				Kind:    kindApp,
+				Name:    app.Name,
+				Details: fmt.Sprintf("%v -> %v", cluster.App.Package.Version, app.Version),
+				App:     app,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// ApplyConfig defines the configuration for applying changes
+type ApplyConfig struct {
+	// Resources is the cluster resource controller
+	Resources resources.Resources
+	// Upgrade starts the cluster upgrade to the specified application package
+	Upgrade func(app loc.Locator) error
+}
+
+// Apply executes the changes computed by Diff. Configuration resources are
+// upserted first and the application upgrade, if any, is started last.
+// Manual changes are skipped, changes that remove nodes are rejected
+// before anything is applied.
+func Apply(config ApplyConfig, changes []Change) error {
+	if err := CheckChanges(changes); err != nil {
+		return trace.Wrap(err)
+	}
+	var upgrade *Change
+	for i, change := range changes {
+		switch change.Action {
+		case ActionCreate, ActionUpdate:
+			err := config.Resources.Create(resources.CreateRequest{
+				Resource: *change.Resource,
+				Upsert:   true,
+			})
+			if err != nil {
+				return trace.Wrap(err, "failed to %v %v %q", change.Action, change.Kind, change.Name)
+			}
+		case ActionUpgrade:
+			upgrade = &changes[i]
+		}
+	}
+	if upgrade == nil {
+		return nil
+	}
+	if config.Upgrade == nil {
+		return trace.BadParameter("cluster upgrade is not supported")
+	}
+	return trace.Wrap(config.Upgrade(*upgrade.App))
+}
+
+func diffResource(resource teleservices.UnknownResource, controller resources.Resources) (*Change, error) {
+	change := &Change{
+		Action:   ActionCreate,
+		Kind:     resource.Kind,
+		Name:     resource.Metadata.Name,
+		Resource: &resource,
+	}
+	collection, err := controller.GetCollection(resources.ListRequest{
+		Kind:        resource.Kind,
+		Name:        resource.Metadata.Name,
+		WithSecrets: true,
+	})
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return change, nil
+		}
+		return nil, trace.Wrap(err)
+	}
+	existing, err := collection.Resources()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	current := findResource(existing, resource)
+	if current == nil {
+		return change, nil
+	}
+	equal, err := specIsSubset(resource, *current)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if equal {
+		return nil, nil
+	}
+	change.Action = ActionUpdate
+	return change, nil
+}
+
+// findResource returns the resource matching the desired resource from
+// the list of existing resources
+func findResource(existing []teleservices.UnknownResource, resource teleservices.UnknownResource) *teleservices.UnknownResource {
+	for i, item := range existing {
+		switch resource.Kind {
+		case storage.KindTLSKeyPair, storage.KindSMTPConfig:
+			// singleton resources are matched regardless of name
+			return &existing[i]
+		}
+		if item.Metadata.Name == resource.Metadata.Name {
+			return &existing[i]
+		}
+	}
+	return nil
+}
+
+func diffNodes(nodes []NodesV2, cluster ops.Site) (changes []Change, err error) {
+	counts := make(map[string]int)
+	for _, server := range cluster.ClusterState.Servers {
+		counts[server.Role]++
+	}
+	for _, desired := range nodes {
+		_, err := cluster.App.Manifest.NodeProfiles.ByName(desired.Profile)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		current := counts[desired.Profile]
+		switch {
+		case desired.Count > current:
+			changes = append(changes, Change{
+				Action:  ActionExpand,
+				Kind:    kindNodes,
+				Name:    desired.Profile,
+				Details: fmt.Sprintf("%v -> %v, join %v node(s)", current, desired.Count, desired.Count-current),
+			})
+		case desired.Count < current:
+			changes = append(changes, Change{
+				Action:  ActionShrink,
+				Kind:    kindNodes,
+				Name:    desired.Profile,
+				Details: fmt.Sprintf("%v -> %v, remove %v node(s)", current, desired.Count, current-desired.Count),
+			})
+		}
+	}
+	return changes, nil
+}
+
+// specIsSubset returns true if all fields set in the spec of the desired
+// resource have the same values in the spec of the current resource.
+// Fields omitted from the desired resource are assumed to have defaults.
+func specIsSubset(desired, current teleservices.UnknownResource) (bool, error) {
+	var desiredObject, currentObject struct {
+		Spec interface{} `json:"spec"`
+	}
+	if err := json.Unmarshal(desired.Raw, &desiredObject); err != nil {
+		return false, trace.Wrap(err)
+	}
+	if err := json.Unmarshal(current.Raw, &currentObject); err != nil {
+		return false, trace.Wrap(err)
+	}
+	return isSubset(desiredObject.Spec, currentObject.Spec), nil
+}
+
+func isSubset(desired, current interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		current, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range desired {
+			if !isSubset(value, current[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		current, ok := current.([]interface{})
+		if !ok || len(desired) != len(current) {
+			return false
+		}
+		for i := range desired {
+			if !isSubset(desired[i], current[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(desired, current)
+}
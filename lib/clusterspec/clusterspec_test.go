@@ -0,0 +1,262 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterspec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/resources"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+)
+
+func TestClusterSpec(t *testing.T) { TestingT(t) }
+
+type ClusterSpecSuite struct {
+	cluster   ops.Site
+	resources *testResources
+}
+
+var _ = Suite(&ClusterSpecSuite{})
+
+func (s *ClusterSpecSuite) SetUpTest(c *C) {
+	s.cluster = ops.Site{
+		Domain: "example.com",
+		App: ops.Application{
+			Package: loc.MustParseLocator("gravitational.io/app:1.0.0"),
+			Manifest: schema.Manifest{
+				NodeProfiles: schema.NodeProfiles{{Name: "master"}, {Name: "worker"}},
+			},
+		},
+		ClusterState: storage.ClusterState{
+			Servers: storage.Servers{
+				{Hostname: "node-1", Role: "master"},
+				{Hostname: "node-2", Role: "worker"},
+				{Hostname: "node-3", Role: "worker"},
+			},
+		},
+	}
+	s.resources = &testResources{objects: map[string]teleservices.UnknownResource{}}
+	s.resources.add(c, `{"kind": "logforwarder", "version": "v2", "metadata": {"name": "forwarder1"},
+		"spec": {"address": "192.168.1.1:514", "protocol": "udp", "output": "syslog"}}`)
+	s.resources.add(c, `{"kind": "alert", "version": "v2", "metadata": {"name": "cpu"},
+		"spec": {"formula": "old"}}`)
+}
+
+func (s *ClusterSpecSuite) TestUnmarshal(c *C) {
+	spec, err := Unmarshal([]byte(testSpec))
+	c.Assert(err, IsNil)
+	c.Assert(spec.Spec.App, Equals, "gravitational.io/app:2.0.0")
+	c.Assert(spec.Spec.Nodes, DeepEquals, []NodesV2{{Profile: "master", Count: 1}, {Profile: "worker", Count: 3}})
+	resources := spec.Resources()
+	c.Assert(resources, HasLen, 4)
+	// kind and version are set on embedded resources
+	for _, resource := range resources {
+		c.Assert(resource.Version, Equals, teleservices.V2)
+	}
+	c.Assert(resources[0].Kind, Equals, storage.KindTLSKeyPair)
+	c.Assert(resources[3].Kind, Equals, storage.KindAlert)
+
+	_, err = Unmarshal([]byte(`kind: clusterspec
+version: v2
+metadata:
+  name: example.com
+spec:
+  nodes:
+  - profile: worker
+    count: 0`))
+	c.Assert(trace.IsBadParameter(err), Equals, true)
+
+	_, err = Unmarshal([]byte(`kind: clusterspec
+version: v2
+metadata:
+  name: example.com
+spec:
+  log_forwarders:
+  - kind: alert
+    metadata:
+      name: forwarder1`))
+	c.Assert(trace.IsBadParameter(err), Equals, true)
+}
+
+func (s *ClusterSpecSuite) TestDiff(c *C) {
+	changes := s.diff(c)
+	c.Assert(changes, DeepEquals, []Change{
+		{Action: ActionCreate, Kind: storage.KindTLSKeyPair, Name: "keypair"},
+		{Action: ActionCreate, Kind: storage.KindLogForwarder, Name: "forwarder2"},
+		{Action: ActionUpdate, Kind: storage.KindAlert, Name: "cpu"},
+		{Action: ActionExpand, Kind: kindNodes, Name: "worker", Details: "2 -> 3, join 1 node(s)"},
+		{Action: ActionUpgrade, Kind: kindApp, Name: "app", Details: "1.0.0 -> 2.0.0"},
+	})
+}
+
+func (s *ClusterSpecSuite) TestApply(c *C) {
+	spec, err := Unmarshal([]byte(testSpec))
+	c.Assert(err, IsNil)
+	changes, err := Diff(*spec, s.cluster, s.resources)
+	c.Assert(err, IsNil)
+
+	var upgraded []loc.Locator
+	err = Apply(ApplyConfig{
+		Resources: s.resources,
+		Upgrade: func(app loc.Locator) error {
+			upgraded = append(upgraded, app)
+			return nil
+		},
+	}, changes)
+	c.Assert(err, IsNil)
+	c.Assert(upgraded, DeepEquals, []loc.Locator{loc.MustParseLocator("gravitational.io/app:2.0.0")})
+	c.Assert(s.resources.created, DeepEquals, []string{"tlskeypair/keypair", "logforwarder/forwarder2", "alert/cpu"})
+
+	// once applied, only the changes that require user actions remain
+	s.cluster.App.Package = loc.MustParseLocator("gravitational.io/app:2.0.0")
+	changes = s.diff(c)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].IsManual(), Equals, true)
+}
+
+func (s *ClusterSpecSuite) TestRejectsNodeRemoval(c *C) {
+	s.cluster.ClusterState.Servers = append(s.cluster.ClusterState.Servers,
+		storage.Server{Hostname: "node-4", Role: "worker"},
+		storage.Server{Hostname: "node-5", Role: "worker"})
+	spec, err := Unmarshal([]byte(testSpec))
+	c.Assert(err, IsNil)
+	changes, err := Diff(*spec, s.cluster, s.resources)
+	c.Assert(err, IsNil)
+	c.Assert(changes[3].Action, Equals, ActionShrink)
+	c.Assert(changes[3].IsManual(), Equals, false)
+	c.Assert(trace.IsBadParameter(CheckChanges(changes)), Equals, true)
+
+	var upgraded []loc.Locator
+	err = Apply(ApplyConfig{
+		Resources: s.resources,
+		Upgrade: func(app loc.Locator) error {
+			upgraded = append(upgraded, app)
+			return nil
+		},
+	}, changes)
+	c.Assert(trace.IsBadParameter(err), Equals, true)
+	// nothing is applied
+	c.Assert(s.resources.created, HasLen, 0)
+	c.Assert(upgraded, HasLen, 0)
+}
+
+func (s *ClusterSpecSuite) TestWritesText(c *C) {
+	var buf bytes.Buffer
+	err := Write(&buf, s.diff(c)[3:], constants.EncodingText)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, `Action           Kind   Name    Details
+------           ----   ----    -------
+expand (manual)  nodes  worker  2 -> 3, join 1 node(s)
+upgrade          app    app     1.0.0 -> 2.0.0
+`)
+}
+
+func (s *ClusterSpecSuite) diff(c *C) []Change {
+	spec, err := Unmarshal([]byte(testSpec))
+	c.Assert(err, IsNil)
+	changes, err := Diff(*spec, s.cluster, s.resources)
+	c.Assert(err, IsNil)
+	for i := range changes {
+		changes[i].Resource = nil
+		changes[i].App = nil
+	}
+	return changes
+}
+
+// testResources is an in-memory resource controller
+type testResources struct {
+	objects map[string]teleservices.UnknownResource
+	created []string
+}
+
+func (r *testResources) add(c *C, data string) {
+	var resource teleservices.UnknownResource
+	c.Assert(resource.UnmarshalJSON([]byte(data)), IsNil)
+	r.objects[resource.Kind+"/"+resource.Metadata.Name] = resource
+}
+
+func (r *testResources) Create(req resources.CreateRequest) error {
+	key := req.Resource.Kind + "/" + req.Resource.Metadata.Name
+	r.objects[key] = req.Resource
+	r.created = append(r.created, key)
+	return nil
+}
+
+func (r *testResources) GetCollection(req resources.ListRequest) (resources.Collection, error) {
+	resource, ok := r.objects[req.Kind+"/"+req.Name]
+	if !ok {
+		return nil, trace.NotFound("%v %v not found", req.Kind, req.Name)
+	}
+	return testCollection{resource}, nil
+}
+
+func (r *testResources) Remove(req resources.RemoveRequest) error {
+	return trace.NotImplemented("not implemented")
+}
+
+type testCollection []teleservices.UnknownResource
+
+func (c testCollection) WriteText(w io.Writer) error { return nil }
+func (c testCollection) WriteJSON(w io.Writer) error { return nil }
+func (c testCollection) WriteYAML(w io.Writer) error { return nil }
+func (c testCollection) Resources() ([]teleservices.UnknownResource, error) {
+	return c, nil
+}
+
+const testSpec = `kind: clusterspec
+version: v2
+metadata:
+  name: example.com
+spec:
+  app: gravitational.io/app:2.0.0
+  nodes:
+  - profile: master
+    count: 1
+  - profile: worker
+    count: 3
+  tls_keypair:
+    metadata:
+      name: keypair
+    spec:
+      cert: cert
+      private_key: key
+  log_forwarders:
+  - metadata:
+      name: forwarder1
+    spec:
+      address: 192.168.1.1:514
+      protocol: udp
+  - metadata:
+      name: forwarder2
+    spec:
+      address: 192.168.1.2:514
+  alerts:
+  - metadata:
+      name: cpu
+    spec:
+      formula: new
+`
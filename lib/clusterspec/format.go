@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/gravitational/gravity/lib/constants"
+
+	"github.com/gravitational/trace"
+)
+
+// Write outputs the changes to w in the specified format
+func Write(w io.Writer, changes []Change, format constants.Format) error {
+	switch format {
+	case constants.EncodingText:
+		return trace.Wrap(writeText(w, changes))
+	case constants.EncodingJSON:
+		if changes == nil {
+			changes = []Change{}
+		}
+		data, err := json.MarshalIndent(changes, "", "    ")
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return trace.Wrap(err)
+	}
+	return trace.BadParameter("unsupported output format %q, supported are: %v, %v",
+		format, constants.EncodingText, constants.EncodingJSON)
+}
+
+func writeText(w io.Writer, changes []Change) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "Cluster is up-to-date with the specification.")
+		return trace.Wrap(err)
+	}
+	t := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(t, "Action\tKind\tName\tDetails")
+	fmt.Fprintln(t, "------\t----\t----\t-------")
+	for _, change := range changes {
+		action := change.Action
+		switch {
+		case change.IsManual():
+			action = fmt.Sprintf("%v (manual)", action)
+		case change.Action == ActionShrink:
+			action = fmt.Sprintf("%v (rejected)", action)
+		}
+		fmt.Fprintf(t, "%v\t%v\t%v\t%v\n", action, change.Kind, change.Name, change.Details)
+	}
+	return trace.Wrap(t.Flush())
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package clusterspec implements the declarative cluster specification:
+// a single document that describes the desired application version, node
+// counts and configuration resources of a cluster, and the logic to compute
+// and apply the difference with the current cluster state
+package clusterspec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	teleutils "github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/trace"
+)
+
+// ClusterSpecV2 describes the desired state of a cluster
+type ClusterSpecV2 struct {
+	// Kind is the resource kind, always "clusterspec"
+	Kind string `json:"kind"`
+	// Version is the resource version
+	Version string `json:"version"`
+	// Metadata is the resource metadata
+	Metadata teleservices.Metadata `json:"metadata"`
+	// Spec is the desired cluster state
+	Spec SpecV2 `json:"spec"`
+}
+
+// SpecV2 defines the desired cluster state
+type SpecV2 struct {
+	// App is the application package the cluster should be running
+	App string `json:"app,omitempty"`
+	// Nodes defines the desired number of nodes per node profile
+	Nodes []NodesV2 `json:"nodes,omitempty"`
+	// LogForwarders lists log forwarder resources
+	LogForwarders []teleservices.UnknownResource `json:"log_forwarders,omitempty"`
+	// AuthConnectors lists authentication connector resources
+	AuthConnectors []teleservices.UnknownResource `json:"auth_connectors,omitempty"`
+	// Alerts lists monitoring alert resources
+	Alerts []teleservices.UnknownResource `json:"alerts,omitempty"`
+	// TLSKeyPair is the cluster web certificate resource
+	TLSKeyPair *teleservices.UnknownResource `json:"tls_keypair,omitempty"`
+	// SMTP is the cluster SMTP configuration resource
+	SMTP *teleservices.UnknownResource `json:"smtp,omitempty"`
+}
+
+// NodesV2 defines the desired number of nodes of a node profile
+type NodesV2 struct {
+	// Profile is the node profile name
+	Profile string `json:"profile"`
+	// Count is the desired number of nodes
+	Count int `json:"count"`
+}
+
+// CheckAndSetDefaults validates the specification and sets defaults
+func (s *ClusterSpecV2) CheckAndSetDefaults() error {
+	if s.Spec.App != "" {
+		if _, err := loc.ParseLocator(s.Spec.App); err != nil {
+			return trace.Wrap(err, "invalid spec.app, expected a package locator, e.g. gravitational.io/app:1.0.0")
+		}
+	}
+	profiles := make(map[string]struct{})
+	for _, nodes := range s.Spec.Nodes {
+		if _, ok := profiles[nodes.Profile]; ok {
+			return trace.BadParameter("node profile %q appears more than once in spec.nodes", nodes.Profile)
+		}
+		profiles[nodes.Profile] = struct{}{}
+		if nodes.Count < 1 {
+			return trace.BadParameter("node profile %q: count must be positive", nodes.Profile)
+		}
+	}
+	for i := range s.Spec.LogForwarders {
+		if err := setKind(&s.Spec.LogForwarders[i], storage.KindLogForwarder); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	for i := range s.Spec.Alerts {
+		if err := setKind(&s.Spec.Alerts[i], storage.KindAlert); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	for _, connector := range s.Spec.AuthConnectors {
+		switch connector.Kind {
+		case teleservices.KindGithubConnector, teleservices.KindOIDCConnector, teleservices.KindSAMLConnector:
+		default:
+			return trace.BadParameter("unsupported auth connector kind %q, supported are: %v, %v, %v",
+				connector.Kind, teleservices.KindGithubConnector,
+				teleservices.KindOIDCConnector, teleservices.KindSAMLConnector)
+		}
+	}
+	if s.Spec.TLSKeyPair != nil {
+		if err := setKind(s.Spec.TLSKeyPair, storage.KindTLSKeyPair); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if s.Spec.SMTP != nil {
+		if err := setKind(s.Spec.SMTP, storage.KindSMTPConfig); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// Resources returns all configuration resources in the specification
+// in the order they should be applied
+func (s *ClusterSpecV2) Resources() (resources []teleservices.UnknownResource) {
+	resources = append(resources, s.Spec.AuthConnectors...)
+	if s.Spec.TLSKeyPair != nil {
+		resources = append(resources, *s.Spec.TLSKeyPair)
+	}
+	if s.Spec.SMTP != nil {
+		resources = append(resources, *s.Spec.SMTP)
+	}
+	resources = append(resources, s.Spec.LogForwarders...)
+	resources = append(resources, s.Spec.Alerts...)
+	return resources
+}
+
+// Unmarshal parses the cluster specification from JSON or YAML
+func Unmarshal(data []byte) (*ClusterSpecV2, error) {
+	if len(data) == 0 {
+		return nil, trace.BadParameter("empty cluster specification")
+	}
+	jsonData, err := teleutils.ToJSON(data)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var header teleservices.ResourceHeader
+	if err := json.Unmarshal(jsonData, &header); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if header.Kind != storage.KindClusterSpec {
+		return nil, trace.BadParameter("expected %q resource, got %q",
+			storage.KindClusterSpec, header.Kind)
+	}
+	switch header.Version {
+	case teleservices.V2:
+		var spec ClusterSpecV2
+		err := teleutils.UnmarshalWithSchema(GetSchema(), &spec, jsonData)
+		if err != nil {
+			return nil, trace.BadParameter("%v", err)
+		}
+		spec.Metadata.CheckAndSetDefaults()
+		if err := spec.CheckAndSetDefaults(); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return &spec, nil
+	}
+	return nil, trace.BadParameter("%v resource version %q is not supported",
+		storage.KindClusterSpec, header.Version)
+}
+
+// setKind fills in the kind and the default version of the embedded
+// resource unless they have been specified
+func setKind(resource *teleservices.UnknownResource, kind string) error {
+	if resource.Kind == kind && resource.Version != "" {
+		return nil
+	}
+	if resource.Kind != "" && resource.Kind != kind {
+		return trace.BadParameter("expected %q resource, got %q", kind, resource.Kind)
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(resource.Raw, &object); err != nil {
+		return trace.Wrap(err)
+	}
+	object["kind"] = kind
+	if resource.Version == "" {
+		object["version"] = teleservices.V2
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(resource.UnmarshalJSON(data))
+}
+
+// SpecV2Schema is the JSON schema for the cluster specification
+const SpecV2Schema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "app": {"type": "string"},
+    "nodes": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["profile", "count"],
+        "properties": {
+          "profile": {"type": "string"},
+          "count": {"type": "integer"}
+        }
+      }
+    },
+    "log_forwarders": {"type": "array", "items": {"type": "object"}},
+    "auth_connectors": {"type": "array", "items": {"type": "object"}},
+    "alerts": {"type": "array", "items": {"type": "object"}},
+    "tls_keypair": {"type": "object"},
+    "smtp": {"type": "object"}
+  }
+}`
+
+// GetSchema returns the JSON schema for the cluster specification
+func GetSchema() string {
+	return fmt.Sprintf(teleservices.V2SchemaTemplate, teleservices.MetadataSchema,
+		SpecV2Schema, "")
+}
@@ -492,6 +492,12 @@ const (
 	// DockerStorageDriverOverlay2 identifes the overlay2 docker storage driver
 	DockerStorageDriverOverlay2 = "overlay2"
 
+	// FilesystemExt4 identifies the ext4 filesystem
+	FilesystemExt4 = "ext4"
+
+	// FilesystemXFS identifies the xfs filesystem
+	FilesystemXFS = "xfs"
+
 	// ClusterControllerChangeset names the changeset with cluster controller resources
 	// of the currently installed version
 	ClusterControllerChangeset = "old-cluster-controller"
@@ -516,12 +522,19 @@ const (
 	// AlertTargetConfigMap specifies the name of the ConfigMap with alert target configuration
 	AlertTargetConfigMap = "alert-target-update"
 
+	// AlertDeliveriesConfigMap specifies the name of the ConfigMap with the history of alert deliveries
+	AlertDeliveriesConfigMap = "alert-deliveries"
+
 	// MonitoringType specifies the name of the type label for monitoring
 	MonitoringType = "monitoring"
 
 	// MonitoringTypeAlertTarget specifies the value of the component label for monitoring alert targets
 	MonitoringTypeAlertTarget = "alert-target"
 
+	// MonitoringTypeAlertTargetHTTP specifies the value of the component label for
+	// webhook, chat and incident management alert targets
+	MonitoringTypeAlertTargetHTTP = "alert-target-http"
+
 	// MonitoringTypeAlert specifies the value of the component label for monitoring alerts
 	MonitoringTypeAlert = "alert"
 
@@ -678,6 +691,13 @@ var (
 		DockerStorageDriverOverlay2,
 	}
 
+	// SupportedFilesystems is a list of filesystems provisioned block devices
+	// can be formatted with
+	SupportedFilesystems = []string{
+		FilesystemExt4,
+		FilesystemXFS,
+	}
+
 	// DockerSupportedTargetDrivers is a list of docker storage drivers
 	// that the existing storage driver can be switched to
 	DockerSupportedTargetDrivers = []string{
@@ -0,0 +1,403 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// Config defines the custom resource controller configuration
+type Config struct {
+	// Client is the Kubernetes client used to access custom resources
+	Client dynamic.Interface
+	// Operator is the cluster operator service
+	Operator ops.Operator
+	// Runner executes gravity commands on cluster nodes
+	Runner Runner
+	// Cluster identifies the local cluster
+	Cluster ops.SiteKey
+	// Interval is how often custom resources are reconciled
+	Interval time.Duration
+	// OperationsLimit is the number of most recent operations mirrored
+	// as GravityOperation resources
+	OperationsLimit int
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+}
+
+func (c *Config) checkAndSetDefaults() error {
+	if c.Client == nil {
+		return trace.BadParameter("missing Client")
+	}
+	if c.Operator == nil {
+		return trace.BadParameter("missing Operator")
+	}
+	if c.Runner == nil {
+		return trace.BadParameter("missing Runner")
+	}
+	if c.Cluster.SiteDomain == "" {
+		return trace.BadParameter("missing Cluster")
+	}
+	if c.Interval == 0 {
+		c.Interval = defaults.CustomResourceSyncInterval
+	}
+	if c.OperationsLimit == 0 {
+		c.OperationsLimit = defaults.CustomResourceOperationsLimit
+	}
+	if c.FieldLogger == nil {
+		c.FieldLogger = logrus.WithField(trace.Component, "crd")
+	}
+	return nil
+}
+
+// Runner executes gravity commands on cluster nodes
+type Runner interface {
+	// RunOnMaster executes the gravity command with the specified arguments
+	// on one of the cluster master nodes and returns its output
+	RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error)
+}
+
+// Controller reconciles gravity custom resources with the cluster operator
+// and writes the results back to the resource status
+type Controller struct {
+	Config
+	handlers map[string]handler
+}
+
+// New returns a new controller for the specified configuration
+func New(config Config) (*Controller, error) {
+	if err := config.checkAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Controller{
+		Config: config,
+		handlers: map[string]handler{
+			KindLogForwarder:   &logForwarderHandler{Config: config},
+			KindTLSKeyPair:     &tlsKeyPairHandler{Config: config},
+			KindAlert:          &alertHandler{Config: config},
+			KindClusterUpgrade: &upgradeHandler{Config: config},
+		},
+	}, nil
+}
+
+// Run reconciles custom resources periodically until the context is canceled
+func (c *Controller) Run(ctx context.Context) error {
+	c.Info("Starting custom resource controller.")
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Reconcile(); err != nil {
+				c.Warnf("Failed to reconcile custom resources: %v.", trace.DebugReport(err))
+			}
+		case <-ctx.Done():
+			c.Info("Stopping custom resource controller.")
+			return nil
+		}
+	}
+}
+
+// Reconcile runs a single reconciliation pass over all custom resources
+func (c *Controller) Reconcile() error {
+	var errors []error
+	if err := c.syncOperations(); err != nil {
+		errors = append(errors, err)
+	}
+	for _, kind := range Kinds {
+		handler, ok := c.handlers[kind]
+		if !ok {
+			continue
+		}
+		if err := c.reconcileKind(kind, handler); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return trace.NewAggregate(errors...)
+}
+
+// handler reconciles custom resources of a specific kind
+type handler interface {
+	// sync applies the resource to the cluster and returns its new status
+	sync(obj *unstructured.Unstructured, status Status) (*Status, error)
+	// delete removes the cluster resource created for obj
+	delete(obj *unstructured.Unstructured) error
+}
+
+func (c *Controller) reconcileKind(kind string, handler handler) error {
+	client := c.Client.Resource(Resource(kind))
+	list, err := client.List(metav1.ListOptions{})
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	var errors []error
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if err := c.reconcile(client, handler, obj); err != nil {
+			c.Warnf("Failed to reconcile %v %v: %v.", kind, obj.GetName(), trace.DebugReport(err))
+			errors = append(errors, err)
+		}
+	}
+	return trace.NewAggregate(errors...)
+}
+
+func (c *Controller) reconcile(client dynamic.ResourceInterface, handler handler, obj *unstructured.Unstructured) (err error) {
+	if obj.GetDeletionTimestamp() != nil {
+		if !utils.StringInSlice(obj.GetFinalizers(), Finalizer) {
+			return nil
+		}
+		err = handler.delete(obj)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+		obj.SetFinalizers(removeFinalizer(obj.GetFinalizers()))
+		_, err = client.Update(obj, metav1.UpdateOptions{})
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	if !utils.StringInSlice(obj.GetFinalizers(), Finalizer) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), Finalizer))
+		obj, err = client.Update(obj, metav1.UpdateOptions{})
+		if err != nil {
+			return trace.Wrap(rigging.ConvertError(err))
+		}
+	}
+	existing, err := getStatus(obj)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	status, syncErr := handler.sync(obj, *existing)
+	if syncErr != nil {
+		status = &Status{
+			Phase:       PhaseFailed,
+			Message:     trace.UserMessage(syncErr),
+			OperationID: existing.OperationID,
+		}
+	}
+	status.ObservedGeneration = obj.GetGeneration()
+	if reflect.DeepEqual(*status, *existing) {
+		return trace.Wrap(syncErr)
+	}
+	if err := updateStatus(client, obj, *status); err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(syncErr)
+}
+
+// syncOperations mirrors the most recent cluster operations as
+// GravityOperation resources and removes the resources of older
+// or deleted operations.
+//
+// GravityOperation resources not created by the controller are kept
+// and rejected with a failed status since operations are started with
+// the resources that request them, like ClusterUpgrade
+func (c *Controller) syncOperations() error {
+	operations, err := c.Operator.GetSiteOperations(c.Cluster)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(operations) > c.OperationsLimit {
+		// operations are returned in the last-to-first order
+		operations = operations[:c.OperationsLimit]
+	}
+	client := c.Client.Resource(Resource(KindGravityOperation))
+	mirrored := make(map[string]bool, len(operations))
+	for _, operation := range operations {
+		op := ops.SiteOperation(operation)
+		mirrored[op.ID] = true
+		status, err := getOperationStatus(c.Operator, op.Key())
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		obj, err := client.Get(op.ID, metav1.GetOptions{})
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+		if trace.IsNotFound(err) {
+			obj, err = client.Create(newOperation(op), metav1.CreateOptions{})
+			if err != nil {
+				return trace.Wrap(rigging.ConvertError(err))
+			}
+		}
+		existing, err := getStatus(obj)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if reflect.DeepEqual(*status, *existing) {
+			continue
+		}
+		if err := updateStatus(client, obj, *status); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	list, err := client.List(metav1.ListOptions{})
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if mirrored[obj.GetName()] {
+			continue
+		}
+		if obj.GetLabels()[MirrorLabel] != "true" {
+			if err := rejectOperation(client, obj); err != nil {
+				return trace.Wrap(err)
+			}
+			continue
+		}
+		err := rigging.ConvertError(client.Delete(obj.GetName(), &metav1.DeleteOptions{}))
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// rejectOperation marks the GravityOperation resource created outside
+// of the controller as failed
+func rejectOperation(client dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	existing, err := getStatus(obj)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	status := Status{
+		Phase: PhaseFailed,
+		Message: "GravityOperation resources mirror cluster operations and cannot be created, " +
+			"use ClusterUpgrade to upgrade the cluster",
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if reflect.DeepEqual(status, *existing) {
+		return nil
+	}
+	return trace.Wrap(updateStatus(client, obj, status))
+}
+
+func newOperation(op ops.SiteOperation) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"type":    op.Type,
+			"created": op.Created.Format(time.RFC3339),
+		},
+	}}
+	obj.SetAPIVersion(Group + "/" + Version)
+	obj.SetKind(KindGravityOperation)
+	obj.SetName(op.ID)
+	obj.SetLabels(map[string]string{MirrorLabel: "true"})
+	return obj
+}
+
+// getOperationStatus returns the status of the specified cluster operation
+func getOperationStatus(operator ops.Operator, key ops.SiteOperationKey) (*Status, error) {
+	operation, err := operator.GetSiteOperation(key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	progress, err := operator.GetSiteOperationProgress(key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	status := &Status{
+		Phase:       PhaseInProgress,
+		Message:     progress.Message,
+		OperationID: operation.ID,
+		Progress:    progress.Completion,
+	}
+	switch {
+	case operation.IsCompleted():
+		status.Phase = PhaseCompleted
+	case operation.IsFailed():
+		status.Phase = PhaseFailed
+	}
+	return status, nil
+}
+
+// Status describes the state of a custom resource as observed by the controller
+type Status struct {
+	// Phase is the reconciliation phase, one of Synced, InProgress, Completed or Failed
+	Phase string `json:"phase,omitempty"`
+	// Message describes the last reconciliation result
+	Message string `json:"message,omitempty"`
+	// ObservedGeneration is the resource generation the status applies to
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// OperationID is the ID of the cluster operation driven by the resource
+	OperationID string `json:"operationID,omitempty"`
+	// Progress is the operation completion percentage
+	Progress int `json:"progress,omitempty"`
+}
+
+// isFinished returns true if the status describes a completed or failed operation
+func (s Status) isFinished() bool {
+	return s.Phase == PhaseCompleted || s.Phase == PhaseFailed
+}
+
+const (
+	// PhaseSynced means the resource has been applied to the cluster
+	PhaseSynced = "Synced"
+	// PhaseInProgress means the operation driven by the resource is in progress
+	PhaseInProgress = "InProgress"
+	// PhaseCompleted means the operation driven by the resource has completed
+	PhaseCompleted = "Completed"
+	// PhaseFailed means the resource could not be applied or its operation has failed
+	PhaseFailed = "Failed"
+)
+
+func removeFinalizer(finalizers []string) (result []string) {
+	for _, finalizer := range finalizers {
+		if finalizer != Finalizer {
+			result = append(result, finalizer)
+		}
+	}
+	return result
+}
+
+func getStatus(obj *unstructured.Unstructured) (*Status, error) {
+	var status Status
+	data, ok := obj.Object["status"].(map[string]interface{})
+	if !ok {
+		return &status, nil
+	}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(data, &status)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &status, nil
+}
+
+func updateStatus(client dynamic.ResourceInterface, obj *unstructured.Unstructured, status Status) error {
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	obj = obj.DeepCopy()
+	obj.Object["status"] = data
+	_, err = client.UpdateStatus(obj, metav1.UpdateOptions{})
+	return trace.Wrap(rigging.ConvertError(err))
+}
@@ -0,0 +1,523 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+func TestCRD(t *testing.T) { TestingT(t) }
+
+type ControllerSuite struct {
+	client     *fakeClient
+	operator   *fakeOperator
+	controller *Controller
+}
+
+var _ = Suite(&ControllerSuite{})
+
+func (s *ControllerSuite) SetUpTest(c *C) {
+	s.client = newFakeClient()
+	s.operator = &fakeOperator{
+		cluster: ops.Site{
+			AccountID: "system",
+			Domain:    "example.com",
+			App: ops.Application{
+				Package: loc.MustParseLocator("gravitational.io/app:1.0.0"),
+			},
+		},
+		operations: map[string]*storage.SiteOperation{},
+	}
+	var err error
+	s.controller, err = New(Config{
+		Client:   s.client,
+		Operator: s.operator,
+		Runner:   s.operator,
+		Cluster:  s.operator.cluster.Key(),
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *ControllerSuite) TestLogForwarderLifecycle(c *C) {
+	s.client.create(KindLogForwarder, "forwarder", map[string]interface{}{
+		"address":  "192.168.1.1:514",
+		"protocol": "udp",
+	})
+	c.Assert(s.controller.Reconcile(), IsNil)
+
+	c.Assert(s.operator.forwarders, HasLen, 1)
+	forwarder := s.operator.forwarders[0]
+	c.Assert(forwarder.GetName(), Equals, "forwarder")
+	c.Assert(forwarder.GetAddress(), Equals, "192.168.1.1:514")
+	obj := s.client.get(KindLogForwarder, "forwarder")
+	c.Assert(obj.GetFinalizers(), DeepEquals, []string{Finalizer})
+	c.Assert(s.status(c, obj).Phase, Equals, PhaseSynced)
+
+	// unchanged resource does not trigger an update
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.forwarderUpdates, Equals, 0)
+
+	obj.Object["spec"] = map[string]interface{}{"address": "192.168.1.2:514"}
+	s.client.update(KindLogForwarder, obj)
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.forwarderUpdates, Equals, 1)
+	c.Assert(s.operator.forwarders[0].GetAddress(), Equals, "192.168.1.2:514")
+
+	s.client.markDeleted(KindLogForwarder, "forwarder")
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.forwarders, HasLen, 0)
+	// the resource is removed once the finalizer has been cleared
+	c.Assert(s.client.get(KindLogForwarder, "forwarder"), IsNil)
+}
+
+func (s *ControllerSuite) TestInvalidResourceReportsFailure(c *C) {
+	s.client.create(KindLogForwarder, "forwarder", map[string]interface{}{
+		"address":  "192.168.1.1:514",
+		"protocol": "sctp",
+	})
+	c.Assert(s.controller.Reconcile(), NotNil)
+
+	c.Assert(s.operator.forwarders, HasLen, 0)
+	status := s.status(c, s.client.get(KindLogForwarder, "forwarder"))
+	c.Assert(status.Phase, Equals, PhaseFailed)
+	c.Assert(status.Message, Not(Equals), "")
+}
+
+func (s *ControllerSuite) TestAlertAndKeyPair(c *C) {
+	s.client.create(KindAlert, "cpu", map[string]interface{}{
+		"formula": `node["cpu"] > 90`,
+	})
+	s.client.create(KindTLSKeyPair, "keypair", map[string]interface{}{
+		"cert":        "cert",
+		"private_key": "key",
+	})
+	c.Assert(s.controller.Reconcile(), IsNil)
+
+	c.Assert(s.operator.alerts, HasLen, 1)
+	c.Assert(s.operator.alerts[0].GetFormula(), Equals, `node["cpu"] > 90`)
+	c.Assert(string(s.operator.certificate.Certificate), Equals, "cert")
+	c.Assert(string(s.operator.certificate.PrivateKey), Equals, "key")
+
+	// unchanged alert does not trigger an update
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.alertUpdates, Equals, 1)
+
+	obj := s.client.get(KindAlert, "cpu")
+	obj.Object["spec"] = map[string]interface{}{"formula": `node["cpu"] > 80`}
+	s.client.update(KindAlert, obj)
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.alertUpdates, Equals, 2)
+	c.Assert(s.operator.alerts, HasLen, 1)
+	c.Assert(s.operator.alerts[0].GetFormula(), Equals, `node["cpu"] > 80`)
+
+	s.client.markDeleted(KindAlert, "cpu")
+	s.client.markDeleted(KindTLSKeyPair, "keypair")
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.alerts, HasLen, 0)
+	c.Assert(s.operator.certificate, IsNil)
+}
+
+func (s *ControllerSuite) TestClusterUpgrade(c *C) {
+	s.client.create(KindClusterUpgrade, "upgrade", map[string]interface{}{
+		"package": "gravitational.io/app:2.0.0",
+	})
+	c.Assert(s.controller.Reconcile(), IsNil)
+
+	// the upgrade is started on a master the same way 'gravity upgrade' does
+	c.Assert(s.operator.commands, DeepEquals, [][]string{
+		{"upgrade", "gravitational.io/app:2.0.0", "--quiet"},
+	})
+	c.Assert(s.operator.updates, DeepEquals, []string{"gravitational.io/app:2.0.0"})
+	status := s.status(c, s.client.get(KindClusterUpgrade, "upgrade"))
+	c.Assert(status.Phase, Equals, PhaseInProgress)
+	c.Assert(status.OperationID, Not(Equals), "")
+
+	// operation progress is written back to the resource
+	s.operator.progress = ops.ProgressEntry{Completion: 100, Message: "upgraded"}
+	s.operator.operations[status.OperationID].State = ops.OperationStateCompleted
+	c.Assert(s.controller.Reconcile(), IsNil)
+	status = s.status(c, s.client.get(KindClusterUpgrade, "upgrade"))
+	c.Assert(status.Phase, Equals, PhaseCompleted)
+	c.Assert(status.Progress, Equals, 100)
+	c.Assert(status.Message, Equals, "upgraded")
+
+	// the operation is mirrored as a GravityOperation resource
+	operation := s.client.get(KindGravityOperation, status.OperationID)
+	c.Assert(operation, NotNil)
+	c.Assert(s.status(c, operation).Phase, Equals, PhaseCompleted)
+
+	// finished upgrade is not restarted until the spec changes
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.operator.updates, HasLen, 1)
+}
+
+func (s *ControllerSuite) TestFailedUpgradeStartReportsFailure(c *C) {
+	s.operator.runErr = trace.BadParameter("cluster is not active")
+	s.client.create(KindClusterUpgrade, "upgrade", map[string]interface{}{
+		"package": "gravitational.io/app:2.0.0",
+	})
+	c.Assert(s.controller.Reconcile(), NotNil)
+
+	status := s.status(c, s.client.get(KindClusterUpgrade, "upgrade"))
+	c.Assert(status.Phase, Equals, PhaseFailed)
+	c.Assert(status.OperationID, Equals, "")
+}
+
+func (s *ControllerSuite) TestRemovesOldOperations(c *C) {
+	s.controller.OperationsLimit = 1
+	for i, id := range []string{"op-1", "op-2"} {
+		s.operator.operations[id] = &storage.SiteOperation{
+			ID:         id,
+			AccountID:  "system",
+			SiteDomain: "example.com",
+			Type:       ops.OperationUpdate,
+			State:      ops.OperationStateCompleted,
+			Created:    time.Now().Add(time.Duration(i) * time.Minute),
+		}
+	}
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.client.get(KindGravityOperation, "op-2"), NotNil)
+	c.Assert(s.client.get(KindGravityOperation, "op-1"), IsNil)
+
+	// resources of deleted operations are removed
+	delete(s.operator.operations, "op-2")
+	c.Assert(s.controller.Reconcile(), IsNil)
+	c.Assert(s.client.get(KindGravityOperation, "op-2"), IsNil)
+}
+
+func (s *ControllerSuite) TestRejectsUserOperations(c *C) {
+	s.client.create(KindGravityOperation, "expand", map[string]interface{}{
+		"type": ops.OperationExpand,
+	})
+	c.Assert(s.controller.Reconcile(), IsNil)
+
+	// the resource is kept and marked as failed
+	obj := s.client.get(KindGravityOperation, "expand")
+	c.Assert(obj, NotNil)
+	status := s.status(c, obj)
+	c.Assert(status.Phase, Equals, PhaseFailed)
+	c.Assert(status.Message, Not(Equals), "")
+	c.Assert(s.operator.operations, HasLen, 0)
+}
+
+func (s *ControllerSuite) TestDefinitions(c *C) {
+	definitions := Definitions()
+	c.Assert(definitions, HasLen, len(Kinds))
+	c.Assert(definitions[0].Name, Equals, "gravityoperations.ops.gravitational.io")
+	c.Assert(definitions[0].Spec.Names.Kind, Equals, KindGravityOperation)
+	c.Assert(definitions[0].Spec.Subresources.Status, NotNil)
+}
+
+func (s *ControllerSuite) status(c *C, obj *unstructured.Unstructured) Status {
+	status, err := getStatus(obj)
+	c.Assert(err, IsNil)
+	return *status
+}
+
+// fakeOperator implements the subset of ops.Operator used by the controller
+type fakeOperator struct {
+	ops.Operator
+	cluster          ops.Site
+	forwarders       []storage.LogForwarder
+	forwarderUpdates int
+	alerts           []storage.Alert
+	alertUpdates     int
+	certificate      *ops.ClusterCertificate
+	updates          []string
+	commands         [][]string
+	runErr           error
+	operations       map[string]*storage.SiteOperation
+	progress         ops.ProgressEntry
+}
+
+func (o *fakeOperator) GetSite(ops.SiteKey) (*ops.Site, error) {
+	return &o.cluster, nil
+}
+
+func (o *fakeOperator) GetLogForwarders(ops.SiteKey) ([]storage.LogForwarder, error) {
+	return o.forwarders, nil
+}
+
+func (o *fakeOperator) CreateLogForwarder(key ops.SiteKey, forwarder storage.LogForwarder) error {
+	o.forwarders = append(o.forwarders, forwarder)
+	return nil
+}
+
+func (o *fakeOperator) UpdateLogForwarder(key ops.SiteKey, forwarder storage.LogForwarder) error {
+	o.forwarderUpdates++
+	for i := range o.forwarders {
+		if o.forwarders[i].GetName() == forwarder.GetName() {
+			o.forwarders[i] = forwarder
+			return nil
+		}
+	}
+	return trace.NotFound("log forwarder %v not found", forwarder.GetName())
+}
+
+func (o *fakeOperator) DeleteLogForwarder(key ops.SiteKey, name string) error {
+	for i := range o.forwarders {
+		if o.forwarders[i].GetName() == name {
+			o.forwarders = append(o.forwarders[:i], o.forwarders[i+1:]...)
+			return nil
+		}
+	}
+	return trace.NotFound("log forwarder %v not found", name)
+}
+
+func (o *fakeOperator) GetAlerts(ops.SiteKey) ([]storage.Alert, error) {
+	return o.alerts, nil
+}
+
+func (o *fakeOperator) UpdateAlert(key ops.SiteKey, alert storage.Alert) error {
+	o.alertUpdates++
+	for i := range o.alerts {
+		if o.alerts[i].GetName() == alert.GetName() {
+			o.alerts[i] = alert
+			return nil
+		}
+	}
+	o.alerts = append(o.alerts, alert)
+	return nil
+}
+
+func (o *fakeOperator) DeleteAlert(key ops.SiteKey, name string) error {
+	o.alerts = nil
+	return nil
+}
+
+func (o *fakeOperator) GetClusterCertificate(key ops.SiteKey, withSecrets bool) (*ops.ClusterCertificate, error) {
+	if o.certificate == nil {
+		return nil, trace.NotFound("cluster certificate not found")
+	}
+	return o.certificate, nil
+}
+
+func (o *fakeOperator) UpdateClusterCertificate(req ops.UpdateCertificateRequest) (*ops.ClusterCertificate, error) {
+	o.certificate = &ops.ClusterCertificate{
+		Certificate: req.Certificate,
+		PrivateKey:  req.PrivateKey,
+	}
+	return o.certificate, nil
+}
+
+func (o *fakeOperator) DeleteClusterCertificate(ops.SiteKey) error {
+	o.certificate = nil
+	return nil
+}
+
+func (o *fakeOperator) CreateSiteAppUpdateOperation(req ops.CreateSiteAppUpdateOperationRequest) (*ops.SiteOperationKey, error) {
+	o.updates = append(o.updates, req.App)
+	operation := &storage.SiteOperation{
+		ID:         "op-1",
+		AccountID:  req.AccountID,
+		SiteDomain: req.SiteDomain,
+		Type:       ops.OperationUpdate,
+		State:      ops.OperationStateUpdateInProgress,
+		Created:    time.Now(),
+	}
+	o.operations[operation.ID] = operation
+	key := (*ops.SiteOperation)(operation).Key()
+	return &key, nil
+}
+
+// RunOnMaster emulates 'gravity upgrade <package> --quiet' which creates
+// the update operation and outputs its ID
+func (o *fakeOperator) RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error) {
+	o.commands = append(o.commands, args)
+	if o.runErr != nil {
+		return nil, o.runErr
+	}
+	opKey, err := o.CreateSiteAppUpdateOperation(ops.CreateSiteAppUpdateOperationRequest{
+		AccountID:  key.AccountID,
+		SiteDomain: key.SiteDomain,
+		App:        args[1],
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return []byte(opKey.OperationID), nil
+}
+
+func (o *fakeOperator) GetSiteOperations(ops.SiteKey) (ops.SiteOperations, error) {
+	var operations ops.SiteOperations
+	for _, operation := range o.operations {
+		operations = append(operations, *operation)
+	}
+	// operations are returned in the last-to-first order
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Created.After(operations[j].Created)
+	})
+	return operations, nil
+}
+
+func (o *fakeOperator) GetSiteOperation(key ops.SiteOperationKey) (*ops.SiteOperation, error) {
+	operation, ok := o.operations[key.OperationID]
+	if !ok {
+		return nil, trace.NotFound("operation %v not found", key.OperationID)
+	}
+	return (*ops.SiteOperation)(operation), nil
+}
+
+func (o *fakeOperator) GetSiteOperationProgress(ops.SiteOperationKey) (*ops.ProgressEntry, error) {
+	return &o.progress, nil
+}
+
+// fakeClient is an in-memory implementation of the dynamic Kubernetes client
+type fakeClient struct {
+	objects map[schema.GroupVersionResource]map[string]*unstructured.Unstructured
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		objects: make(map[schema.GroupVersionResource]map[string]*unstructured.Unstructured),
+	}
+}
+
+func (f *fakeClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	if _, ok := f.objects[resource]; !ok {
+		f.objects[resource] = make(map[string]*unstructured.Unstructured)
+	}
+	return &fakeResource{resource: resource, objects: f.objects[resource]}
+}
+
+func (f *fakeClient) create(kind, name string, spec map[string]interface{}) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(Group + "/" + Version)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	f.Resource(Resource(kind)).Create(obj, metav1.CreateOptions{})
+}
+
+func (f *fakeClient) update(kind string, obj *unstructured.Unstructured) {
+	f.Resource(Resource(kind)).Update(obj, metav1.UpdateOptions{})
+}
+
+func (f *fakeClient) get(kind, name string) *unstructured.Unstructured {
+	obj, err := f.Resource(Resource(kind)).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+func (f *fakeClient) markDeleted(kind, name string) {
+	now := metav1.Now()
+	f.objects[Resource(kind)][name].SetDeletionTimestamp(&now)
+}
+
+// fakeResource implements the dynamic resource client over an in-memory
+// object map and emulates the generation and status subresource semantics
+type fakeResource struct {
+	resource schema.GroupVersionResource
+	objects  map[string]*unstructured.Unstructured
+}
+
+func (r *fakeResource) Namespace(string) dynamic.ResourceInterface {
+	return r
+}
+
+func (r *fakeResource) Create(obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if _, ok := r.objects[obj.GetName()]; ok {
+		return nil, errors.NewAlreadyExists(r.resource.GroupResource(), obj.GetName())
+	}
+	obj = obj.DeepCopy()
+	delete(obj.Object, "status")
+	obj.SetGeneration(1)
+	r.objects[obj.GetName()] = obj
+	return obj.DeepCopy(), nil
+}
+
+func (r *fakeResource) Update(obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	existing, ok := r.objects[obj.GetName()]
+	if !ok {
+		return nil, errors.NewNotFound(r.resource.GroupResource(), obj.GetName())
+	}
+	obj = obj.DeepCopy()
+	obj.Object["status"] = existing.Object["status"]
+	obj.SetGeneration(existing.GetGeneration())
+	if !reflect.DeepEqual(obj.Object["spec"], existing.Object["spec"]) {
+		obj.SetGeneration(existing.GetGeneration() + 1)
+	}
+	if obj.GetDeletionTimestamp() != nil && len(obj.GetFinalizers()) == 0 {
+		delete(r.objects, obj.GetName())
+		return obj, nil
+	}
+	r.objects[obj.GetName()] = obj
+	return obj.DeepCopy(), nil
+}
+
+func (r *fakeResource) UpdateStatus(obj *unstructured.Unstructured, options metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	existing, ok := r.objects[obj.GetName()]
+	if !ok {
+		return nil, errors.NewNotFound(r.resource.GroupResource(), obj.GetName())
+	}
+	existing.Object["status"] = obj.DeepCopy().Object["status"]
+	return existing.DeepCopy(), nil
+}
+
+func (r *fakeResource) Delete(name string, options *metav1.DeleteOptions, subresources ...string) error {
+	if _, ok := r.objects[name]; !ok {
+		return errors.NewNotFound(r.resource.GroupResource(), name)
+	}
+	delete(r.objects, name)
+	return nil
+}
+
+func (r *fakeResource) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	return trace.NotImplemented("not implemented")
+}
+
+func (r *fakeResource) Get(name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj, ok := r.objects[name]
+	if !ok {
+		return nil, errors.NewNotFound(r.resource.GroupResource(), name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (r *fakeResource) List(opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	for _, obj := range r.objects {
+		list.Items = append(list.Items, *obj.DeepCopy())
+	}
+	return list, nil
+}
+
+func (r *fakeResource) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return nil, trace.NotImplemented("not implemented")
+}
+
+func (r *fakeResource) Patch(name string, pt types.PatchType, data []byte, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return nil, trace.NotImplemented("not implemented")
+}
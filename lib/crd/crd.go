@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crd implements a controller that exposes cluster operations and
+// configuration resources as Kubernetes custom resources and reconciles
+// them with the cluster operator
+package crd
+
+import (
+	"strings"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Group is the API group of gravity custom resources
+	Group = "ops.gravitational.io"
+	// Version is the API version of gravity custom resources
+	Version = "v1"
+
+	// KindGravityOperation is the kind of resource that mirrors a cluster operation
+	KindGravityOperation = "GravityOperation"
+	// KindLogForwarder is the kind of resource that defines a log forwarder
+	KindLogForwarder = "LogForwarder"
+	// KindTLSKeyPair is the kind of resource that defines the cluster web certificate
+	KindTLSKeyPair = "TLSKeyPair"
+	// KindAlert is the kind of resource that defines a monitoring alert
+	KindAlert = "Alert"
+	// KindClusterUpgrade is the kind of resource that requests a cluster upgrade
+	KindClusterUpgrade = "ClusterUpgrade"
+
+	// Finalizer is set on custom resources reconciled by the controller
+	// so the matching cluster resource is removed when they are deleted
+	Finalizer = "ops.gravitational.io/cleanup"
+	// MirrorLabel is set on GravityOperation resources created by the controller
+	// to mirror cluster operations
+	MirrorLabel = "ops.gravitational.io/mirrored"
+)
+
+// Kinds lists all gravity custom resource kinds
+var Kinds = []string{
+	KindGravityOperation,
+	KindLogForwarder,
+	KindTLSKeyPair,
+	KindAlert,
+	KindClusterUpgrade,
+}
+
+// Resource returns the group/version/resource for the specified kind
+func Resource(kind string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    Group,
+		Version:  Version,
+		Resource: plural(kind),
+	}
+}
+
+// Definitions returns the custom resource definitions for all gravity kinds
+func Definitions() []apiextensionsv1beta1.CustomResourceDefinition {
+	var definitions []apiextensionsv1beta1.CustomResourceDefinition
+	for _, kind := range Kinds {
+		definitions = append(definitions, definition(kind))
+	}
+	return definitions
+}
+
+// EnsureDefinitions creates custom resource definitions for all gravity
+// kinds unless they already exist
+func EnsureDefinitions(client apiextensionsclientset.Interface) error {
+	for _, definition := range Definitions() {
+		_, err := client.ApiextensionsV1beta1().CustomResourceDefinitions().Create(&definition)
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsAlreadyExists(err) {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func definition(kind string) apiextensionsv1beta1.CustomResourceDefinition {
+	resource := plural(kind)
+	return apiextensionsv1beta1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CustomResourceDefinition",
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: resource + "." + Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group:   Group,
+			Version: Version,
+			Scope:   apiextensionsv1beta1.ClusterScoped,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Plural:   resource,
+				Singular: strings.ToLower(kind),
+				Kind:     kind,
+				ListKind: kind + "List",
+			},
+			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
+				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+			},
+			AdditionalPrinterColumns: []apiextensionsv1beta1.CustomResourceColumnDefinition{
+				{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+				{Name: "Message", Type: "string", JSONPath: ".status.message"},
+			},
+		},
+	}
+}
+
+func plural(kind string) string {
+	return strings.ToLower(kind) + "s"
+}
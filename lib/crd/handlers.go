@@ -0,0 +1,271 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// logForwarderHandler reconciles LogForwarder resources with cluster log forwarders
+type logForwarderHandler struct {
+	Config
+}
+
+func (r *logForwarderHandler) sync(obj *unstructured.Unstructured, status Status) (*Status, error) {
+	forwarder := &storage.LogForwarderV2{
+		Kind:    storage.KindLogForwarder,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name:      obj.GetName(),
+			Namespace: defaults.Namespace,
+		},
+	}
+	if err := decodeSpec(obj, &forwarder.Spec); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := forwarder.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	forwarders, err := r.Operator.GetLogForwarders(r.Cluster)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, existing := range forwarders {
+		if existing.GetName() != forwarder.GetName() {
+			continue
+		}
+		existingV2, ok := existing.(*storage.LogForwarderV2)
+		if !ok {
+			return nil, trace.BadParameter("unsupported log forwarder %T", existing)
+		}
+		// client keys are not returned by the cluster
+		withoutSecrets, ok := forwarder.WithoutSecrets().(*storage.LogForwarderV2)
+		if !ok {
+			return nil, trace.BadParameter("unsupported log forwarder %T", withoutSecrets)
+		}
+		equal, err := equalSpecs(existingV2.Spec, withoutSecrets.Spec)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if !equal {
+			err = r.Operator.UpdateLogForwarder(r.Cluster, forwarder)
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+		}
+		return &Status{Phase: PhaseSynced}, nil
+	}
+	err = r.Operator.CreateLogForwarder(r.Cluster, forwarder)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Status{Phase: PhaseSynced}, nil
+}
+
+func (r *logForwarderHandler) delete(obj *unstructured.Unstructured) error {
+	return trace.Wrap(r.Operator.DeleteLogForwarder(r.Cluster, obj.GetName()))
+}
+
+// alertHandler reconciles Alert resources with cluster monitoring alerts
+type alertHandler struct {
+	Config
+}
+
+func (r *alertHandler) sync(obj *unstructured.Unstructured, status Status) (*Status, error) {
+	alert := &storage.AlertV2{
+		Kind:    storage.KindAlert,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name:      obj.GetName(),
+			Namespace: defaults.Namespace,
+		},
+	}
+	if err := decodeSpec(obj, &alert.Spec); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := alert.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	alerts, err := r.Operator.GetAlerts(r.Cluster)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, existing := range alerts {
+		if existing.GetName() != alert.GetName() {
+			continue
+		}
+		existingV2, ok := existing.(*storage.AlertV2)
+		if !ok {
+			return nil, trace.BadParameter("unsupported alert %T", existing)
+		}
+		equal, err := equalSpecs(existingV2.Spec, alert.Spec)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if equal {
+			return &Status{Phase: PhaseSynced}, nil
+		}
+	}
+	err = r.Operator.UpdateAlert(r.Cluster, alert)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Status{Phase: PhaseSynced}, nil
+}
+
+func (r *alertHandler) delete(obj *unstructured.Unstructured) error {
+	return trace.Wrap(r.Operator.DeleteAlert(r.Cluster, obj.GetName()))
+}
+
+// tlsKeyPairHandler reconciles TLSKeyPair resources with the cluster
+// web certificate
+type tlsKeyPairHandler struct {
+	Config
+}
+
+func (r *tlsKeyPairHandler) sync(obj *unstructured.Unstructured, status Status) (*Status, error) {
+	var spec storage.TLSKeyPairSpecV2
+	if err := decodeSpec(obj, &spec); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	certificate, err := r.Operator.GetClusterCertificate(r.Cluster, true)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if certificate != nil &&
+		bytes.Equal(certificate.Certificate, []byte(spec.Cert)) &&
+		bytes.Equal(certificate.PrivateKey, []byte(spec.PrivateKey)) {
+		return &Status{Phase: PhaseSynced}, nil
+	}
+	_, err = r.Operator.UpdateClusterCertificate(ops.UpdateCertificateRequest{
+		AccountID:   r.Cluster.AccountID,
+		SiteDomain:  r.Cluster.SiteDomain,
+		Certificate: []byte(spec.Cert),
+		PrivateKey:  []byte(spec.PrivateKey),
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Status{Phase: PhaseSynced}, nil
+}
+
+func (r *tlsKeyPairHandler) delete(obj *unstructured.Unstructured) error {
+	return trace.Wrap(r.Operator.DeleteClusterCertificate(r.Cluster))
+}
+
+// upgradeHandler reconciles ClusterUpgrade resources by starting cluster
+// updates and tracking their progress
+type upgradeHandler struct {
+	Config
+}
+
+// upgradeSpec defines the ClusterUpgrade resource spec
+type upgradeSpec struct {
+	// Package is the application package to upgrade the cluster to
+	Package string `json:"package"`
+}
+
+func (r *upgradeHandler) sync(obj *unstructured.Unstructured, status Status) (*Status, error) {
+	if status.OperationID != "" && !status.isFinished() {
+		return getOperationStatus(r.Operator, ops.SiteOperationKey{
+			AccountID:   r.Cluster.AccountID,
+			SiteDomain:  r.Cluster.SiteDomain,
+			OperationID: status.OperationID,
+		})
+	}
+	if status.Phase != "" && status.ObservedGeneration == obj.GetGeneration() {
+		// the spec has not changed since the last upgrade attempt
+		return &status, nil
+	}
+	var spec upgradeSpec
+	if err := decodeSpec(obj, &spec); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	locator, err := loc.ParseLocator(spec.Package)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	cluster, err := r.Operator.GetSite(r.Cluster)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if cluster.App.Package.IsEqualTo(*locator) {
+		return &Status{
+			Phase:   PhaseCompleted,
+			Message: fmt.Sprintf("cluster is running %v", locator),
+		}, nil
+	}
+	// start the update the same way 'gravity upgrade' does: the command
+	// creates the operation and deploys the update agents which execute
+	// the plan in the background
+	out, err := r.Runner.RunOnMaster(r.Cluster, "upgrade", locator.String(), "--quiet")
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to start upgrade: %s", out)
+	}
+	operationID := utils.LastLine(out)
+	if operationID == "" {
+		return nil, trace.BadParameter("failed to start upgrade: no operation ID in output")
+	}
+	return getOperationStatus(r.Operator, ops.SiteOperationKey{
+		AccountID:   r.Cluster.AccountID,
+		SiteDomain:  r.Cluster.SiteDomain,
+		OperationID: operationID,
+	})
+}
+
+// delete is a no-op as a started upgrade can not be undone by deleting
+// the resource
+func (r *upgradeHandler) delete(obj *unstructured.Unstructured) error {
+	return nil
+}
+
+func decodeSpec(obj *unstructured.Unstructured, spec interface{}) error {
+	data, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = json.Unmarshal(data, spec)
+	if err != nil {
+		return trace.BadParameter("invalid %v spec: %v", obj.GetKind(), err)
+	}
+	return nil
+}
+
+// equalSpecs returns true if both resource specs have the same configuration
+func equalSpecs(a, b interface{}) (bool, error) {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return bytes.Equal(left, right), nil
+}
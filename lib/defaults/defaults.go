@@ -19,7 +19,9 @@ package defaults
 import (
 	"context"
 	"fmt"
+	"net"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/gravitational/gravity/lib/constants"
@@ -165,6 +167,14 @@ const (
 	// DevicemapperAutoextendStep defines the devicemapper extension step in percent
 	DevicemapperAutoextendStep = 20
 
+	// ThinPoolExtents is the default size of a thin pool created
+	// in a volume group of a node profile
+	ThinPoolExtents = "95%VG"
+
+	// LocalStorageClass is the default storage class of the local persistent
+	// volumes created for provisioned filesystems
+	LocalStorageClass = "local-storage"
+
 	// DatabaseSchemaVersion is a running counter for the current version of the database schema.
 	// The version is used when generating an empty database as a stamp for a subsequent migration step.
 	// It is important to keep the schema version up-to-date with the tip version of the migration state.
@@ -368,6 +378,10 @@ const (
 	// UpdateDir is the gravity subdirectory where update related data is stored
 	UpdateDir = "update"
 
+	// EtcdRestoreDir is the gravity subdirectory where the etcd restore
+	// plan is stored
+	EtcdRestoreDir = "etcd-restore"
+
 	// AgentDir is the gravity subdirectory where update agent stores its data
 	AgentDir = "agent"
 
@@ -513,6 +527,25 @@ const (
 	// LogForwardersConfigMap is the name of the config map that contains log forwarders configuration
 	LogForwardersConfigMap = "log-forwarders"
 
+	// LogForwardersSecret is the name of the secret with log forwarders TLS material
+	// and the log collector configuration
+	LogForwardersSecret = "log-forwarders"
+
+	// LogForwardersDir is the directory the log forwarders secret is mounted at in the log collector
+	LogForwardersDir = "/etc/gravity/log-forwarders"
+
+	// LogForwardersConfigFile is the name of the log collector configuration file in the log forwarders secret
+	LogForwardersConfigFile = "forwarders.conf"
+
+	// LogForwardersConfigPath is the location of the log collector configuration file in the log collector
+	LogForwardersConfigPath = "/etc/rsyslog.d/90-gravity-forwarders.conf"
+
+	// LogForwarderElasticsearchIndex is the default Elasticsearch index for forwarded logs
+	LogForwarderElasticsearchIndex = "gravity-logs"
+
+	// LogForwarderBufferSize is the default number of messages buffered by a log forwarder
+	LogForwarderBufferSize = 10000
+
 	// GrafanaServiceName is the name of Grafana service
 	GrafanaServiceName = "grafana"
 	// GrafanaServicePort is the port Grafana service is listening on
@@ -527,6 +560,20 @@ const (
 	// InfluxDBAdminPassword is the InfluxDB admin user password
 	InfluxDBAdminPassword = "root"
 
+	// KapacitorServiceAddr is the address of Kapacitor service
+	KapacitorServiceAddr = "kapacitor.monitoring.svc.cluster.local"
+	// KapacitorServicePort is the API port of Kapacitor service
+	KapacitorServicePort = 9092
+
+	// AlertDeliveryTimeout is the timeout of a single alert delivery attempt
+	AlertDeliveryTimeout = 10 * time.Second
+	// AlertDeliveryAttempts is the number of attempts to deliver an alert to an alert target
+	AlertDeliveryAttempts = 5
+	// AlertDeliveryBackoff is the delay before the first alert delivery retry
+	AlertDeliveryBackoff = 2 * time.Second
+	// AlertDeliveryHistory is the number of recent alert deliveries kept for inspection
+	AlertDeliveryHistory = 100
+
 	// WriteFactor is a default amount of acknowledged writes for object storage
 	// to be considered successfull
 	WriteFactor = 1
@@ -566,6 +613,46 @@ const (
 	// RegistrySyncInterval is how often app's images are synced with the local registry
 	RegistrySyncInterval = 20 * time.Second
 
+	// CustomResourceSyncInterval is how often gravity custom resources are
+	// reconciled with the cluster state
+	CustomResourceSyncInterval = 10 * time.Second
+
+	// CustomResourceOperationsLimit is the number of most recent cluster
+	// operations mirrored as GravityOperation resources
+	CustomResourceOperationsLimit = 10
+
+	// ScheduleCheckInterval is how often scheduled operations are checked
+	// against their maintenance windows
+	ScheduleCheckInterval = time.Minute
+
+	// EtcdMaintenanceCheckInterval is how often gravity-site checks the etcd
+	// status and whether a snapshot or defragmentation is due
+	EtcdMaintenanceCheckInterval = 5 * time.Minute
+
+	// EtcdSnapshotInterval is how often gravity-site takes etcd snapshots
+	EtcdSnapshotInterval = 6 * time.Hour
+
+	// EtcdSnapshotRetention is the number of most recent etcd snapshots
+	// kept in the cluster package service
+	EtcdSnapshotRetention = 10
+
+	// EtcdSnapshotPackage is the name of the etcd snapshot packages
+	EtcdSnapshotPackage = "etcd-snapshot"
+
+	// ClusterBackupPackage is the name of the package with the cluster
+	// backup uploaded to the installer restoring the cluster
+	ClusterBackupPackage = "cluster-backup"
+
+	// EtcdDefragInterval is how often gravity-site defragments etcd members
+	EtcdDefragInterval = 7 * 24 * time.Hour
+
+	// EtcdDefragTimeout is the timeout of defragmenting a single etcd member
+	EtcdDefragTimeout = 5 * time.Minute
+
+	// EtcdDBSizeThreshold is the etcd database size in bytes that triggers
+	// an alert. The default etcd storage quota is 2GB
+	EtcdDBSizeThreshold = 1536 * 1024 * 1024
+
 	// KubeSystemNamespace is the name of k8s namespace where all our system stuff goes
 	KubeSystemNamespace = "kube-system"
 	// MonitoringNamespace is the name of k8s namespace for the monitoring-related resources
@@ -622,6 +709,10 @@ const (
 	ServiceSubnet = "10.100.0.0/16"
 	// PodSubnet is a subnet dedicated to the pods in the cluster
 	PodSubnet = "10.244.0.0/16"
+	// ServiceSubnetIPv6 is a subnet dedicated to the services in IPv6 clusters
+	ServiceSubnetIPv6 = "fd00:100::/112"
+	// PodSubnetIPv6 is a subnet dedicated to the pods in IPv6 clusters
+	PodSubnetIPv6 = "fd00:244::/56"
 
 	// MaxRouterIdleConnsPerHost defines tha maximum number of idle connections for "opsroute" transport
 	MaxRouterIdleConnsPerHost = 5
@@ -870,6 +961,10 @@ const (
 	// EndpointsWaitTimeout specifies the timeout for waiting for system service endpoints
 	EndpointsWaitTimeout = 5 * time.Minute
 
+	// NodeHealthTimeout specifies the timeout for waiting for a node to become healthy
+	// after its system software has been updated
+	NodeHealthTimeout = 10 * time.Minute
+
 	// DrainErrorTimeout specifies the timeout for the initial failures of drain operation.
 	// Drain operation might experience transient errors (e.g. api server connect failures)
 	// in which case the timeout defines the maximum time frame to retry such failed attempts.
@@ -1118,7 +1213,7 @@ var BaseUpdateVersion = semver.Must(semver.NewVersion("3.51.0"))
 
 // DockerRegistryAddr returns the address of docker registry running on server
 func DockerRegistryAddr(server string) string {
-	return fmt.Sprintf("%v:%v", server, constants.DockerRegistryPort)
+	return net.JoinHostPort(server, constants.DockerRegistryPort)
 }
 
 // InSystemUnitDir returns the path of the user service given with serviceName
@@ -1133,7 +1228,7 @@ func InTempDir(path ...string) string {
 
 // GravityRPCAgentAddr returns default RPC agent advertise address
 func GravityRPCAgentAddr(host string) string {
-	return fmt.Sprintf("%v:%v", host, GravityRPCAgentPort)
+	return net.JoinHostPort(host, strconv.Itoa(GravityRPCAgentPort))
 }
 
 // WithTimeout returns a default timeout context
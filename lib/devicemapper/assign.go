@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devicemapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gravitational/trace"
+)
+
+// AssignDevices selects a host device for each of the specified block devices
+// from the list of unallocated devices reported by the node.
+//
+// Devices listed in exclude (e.g. the Docker and system state devices) are never assigned.
+// Each block device gets the smallest available device that satisfies its capacity
+// requirement, with the largest block devices assigned first.
+func AssignDevices(blockDevices []schema.BlockDevice, available storage.Devices, exclude ...storage.DeviceName) ([]storage.BlockDevice, error) {
+	var candidates storage.Devices
+	for _, device := range available {
+		if !isExcluded(device.Name, exclude) {
+			candidates = append(candidates, device)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].SizeMB < candidates[j].SizeMB
+	})
+
+	requested := make([]schema.BlockDevice, len(blockDevices))
+	copy(requested, blockDevices)
+	sort.SliceStable(requested, func(i, j int) bool {
+		return requested[i].Capacity > requested[j].Capacity
+	})
+
+	var assigned []storage.BlockDevice
+	var missing []string
+	for _, blockDevice := range requested {
+		i := findDevice(candidates, blockDevice.Capacity.Bytes())
+		if i < 0 {
+			missing = append(missing, fmt.Sprintf("%v (%v)",
+				blockDevice.Name, blockDevice.Capacity))
+			continue
+		}
+		assigned = append(assigned, storage.BlockDevice{
+			Name:   blockDevice.Name,
+			Device: candidates[i],
+		})
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	if len(missing) != 0 {
+		return nil, trace.NotFound("no suitable devices found for block devices %v, "+
+			"unallocated devices: %v", strings.Join(missing, ", "),
+			FormatDevices(available, exclude...))
+	}
+
+	// keep the order of the block devices in the profile
+	sort.SliceStable(assigned, func(i, j int) bool {
+		return indexOf(blockDevices, assigned[i].Name) < indexOf(blockDevices, assigned[j].Name)
+	})
+	return assigned, nil
+}
+
+// FormatDevices returns the device discovery report for the specified list of devices
+func FormatDevices(devices storage.Devices, exclude ...storage.DeviceName) string {
+	if len(devices) == 0 {
+		return "none"
+	}
+	formatted := make([]string, 0, len(devices))
+	for _, device := range devices {
+		var note string
+		if isExcluded(device.Name, exclude) {
+			note = ", in use"
+		}
+		formatted = append(formatted, fmt.Sprintf("%v (%v, %v%v)", device.Path(),
+			device.Type, humanize.Bytes(deviceSizeBytes(device)), note))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// FormatAssignment returns the block device assignment as text
+func FormatAssignment(devices []storage.BlockDevice) string {
+	formatted := make([]string, 0, len(devices))
+	for _, device := range devices {
+		formatted = append(formatted, fmt.Sprintf("%v=%v", device.Name, device.Device.Path()))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func findDevice(devices storage.Devices, capacity uint64) int {
+	for i, device := range devices {
+		if deviceSizeBytes(device) >= capacity {
+			return i
+		}
+	}
+	return -1
+}
+
+func isExcluded(name storage.DeviceName, exclude []storage.DeviceName) bool {
+	for _, excluded := range exclude {
+		if excluded.Path() != "" && excluded.Path() == name.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(blockDevices []schema.BlockDevice, name string) int {
+	for i, device := range blockDevices {
+		if device.Name == name {
+			return i
+		}
+	}
+	return len(blockDevices)
+}
+
+// deviceSizeBytes returns the size of the device in bytes.
+// Device discovery reports sizes in mebibytes
+func deviceSizeBytes(device storage.Device) uint64 {
+	return device.SizeMB << 20
+}
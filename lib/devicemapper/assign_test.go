@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devicemapper
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+)
+
+type AssignSuite struct{}
+
+var _ = Suite(&AssignSuite{})
+
+func (r *AssignSuite) TestAssignsSmallestSuitableDevices(c *C) {
+	available := storage.Devices{
+		{Name: "/dev/xvdb", Type: storage.DeviceDisk, SizeMB: 100 * 1024},
+		{Name: "/dev/xvdc", Type: storage.DeviceDisk, SizeMB: 10 * 1024},
+		{Name: "/dev/xvdd", Type: storage.DeviceDisk, SizeMB: 50 * 1024},
+		{Name: "/dev/xvde", Type: storage.DeviceDisk, SizeMB: 20 * 1024},
+	}
+	blockDevices := []schema.BlockDevice{
+		{Name: "data", Capacity: 5 * utils.Capacity(1<<30)},
+		{Name: "logs", Capacity: 40 * utils.Capacity(1<<30)},
+	}
+
+	devices, err := AssignDevices(blockDevices, available, "/dev/xvdc")
+	c.Assert(err, IsNil)
+	c.Assert(devices, DeepEquals, []storage.BlockDevice{
+		{Name: "data", Device: available[3]},
+		{Name: "logs", Device: available[2]},
+	})
+}
+
+func (r *AssignSuite) TestReportsMissingDevices(c *C) {
+	available := storage.Devices{
+		{Name: "/dev/xvdb", Type: storage.DeviceDisk, SizeMB: 10 * 1024},
+	}
+	blockDevices := []schema.BlockDevice{
+		{Name: "data", Capacity: 5 * utils.Capacity(1<<30)},
+		{Name: "logs", Capacity: 40 * utils.Capacity(1<<30)},
+	}
+
+	devices, err := AssignDevices(blockDevices, available)
+	c.Assert(trace.IsNotFound(err), Equals, true)
+	c.Assert(err, ErrorMatches, "no suitable devices found for block devices logs .*"+
+		"unallocated devices: /dev/xvdb .*")
+	c.Assert(devices, IsNil)
+}
+
+func (r *AssignSuite) TestAddsFstabEntryOnce(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "fstab")
+	err := ioutil.WriteFile(path, []byte("# comment\n/dev/xvda1\t/\txfs\tdefaults\t0 0"), 0644)
+	c.Assert(err, IsNil)
+
+	entry := fstabEntry{device: "UUID=1234", path: "/var/data", fsType: "ext4"}
+	for i := 0; i < 2; i++ {
+		c.Assert(addFstabEntry(path, entry), IsNil)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# comment\n/dev/xvda1\t/\txfs\tdefaults\t0 0\n"+
+		"UUID=1234\t/var/data\text4\tdefaults\t0 0\n")
+}
+
+func (r *AssignSuite) TestCreatesFstab(c *C) {
+	path := filepath.Join(c.MkDir(), "fstab")
+	entry := fstabEntry{device: "UUID=1234", path: "/var/data", fsType: "xfs"}
+	c.Assert(addFstabEntry(path, entry), IsNil)
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "UUID=1234\t/var/data\txfs\tdefaults\t0 0\n")
+}
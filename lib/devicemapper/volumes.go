@@ -0,0 +1,318 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devicemapper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// VolumesConfig defines the configuration for provisioning
+// block devices of a node profile
+type VolumesConfig struct {
+	// FieldLogger is used for logging
+	log.FieldLogger
+	// Requirements lists block devices and volume groups of the node profile
+	Requirements schema.Requirements
+	// Devices lists host devices assigned to the block devices
+	Devices []storage.BlockDevice
+	// UID is the default owner of the mount directories
+	UID int
+	// GID is the default group of the mount directories
+	GID int
+	// Out receives the output of the executed commands
+	Out io.Writer
+}
+
+// ProvisionVolumes formats and mounts block devices, creates LVM volume groups,
+// thin pools and logical volumes declared by the node profile.
+//
+// Provisioning is idempotent: existing filesystems, mounts and LVM
+// objects are reused, so it is safe to run it again after a failure
+func ProvisionVolumes(config VolumesConfig) error {
+	r := &volumes{VolumesConfig: config}
+	for _, device := range config.Requirements.BlockDevices {
+		if device.Filesystem == nil {
+			continue
+		}
+		path, err := r.devicePath(device.Name)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if err := r.mountFilesystem(path, *device.Filesystem); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	for _, group := range config.Requirements.VolumeGroups {
+		if err := r.createVolumeGroup(group); err != nil {
+			return trace.Wrap(err)
+		}
+		for _, volume := range group.LogicalVolumes {
+			if err := r.createLogicalVolume(group, volume); err != nil {
+				return trace.Wrap(err)
+			}
+			err := r.mountFilesystem(LogicalVolumePath(group.Name, volume.Name), volume.Filesystem)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+		}
+	}
+	return nil
+}
+
+// LogicalVolumePath returns the device path of the specified logical volume
+func LogicalVolumePath(group, volume string) string {
+	return fmt.Sprintf("/dev/%v/%v", group, volume)
+}
+
+func (r *volumes) devicePath(name string) (string, error) {
+	for _, device := range r.Devices {
+		if device.Name == name {
+			return device.Device.Path(), nil
+		}
+	}
+	return "", trace.NotFound("no device has been assigned to block device %q", name)
+}
+
+func (r *volumes) createVolumeGroup(group schema.VolumeGroup) error {
+	var disks []string
+	for _, device := range r.Requirements.BlockDevices {
+		if device.VolumeGroup != group.Name {
+			continue
+		}
+		path, err := r.devicePath(device.Name)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		disks = append(disks, path)
+	}
+	if r.exists(exec.Command("vgs", "--noheadings", "-o", "vg_name", group.Name)) {
+		r.Infof("Volume group %v already exists.", group.Name)
+	} else {
+		for _, disk := range disks {
+			r.Infof("Creating physical volume on %v.", disk)
+			if err := r.exec(exec.Command("pvcreate", disk)); err != nil {
+				return trace.Wrap(err, "failed to create physical volume on disk %v", disk)
+			}
+		}
+		r.Infof("Creating volume group %v on %v.", group.Name, disks)
+		args := append([]string{group.Name}, disks...)
+		if err := r.exec(exec.Command("vgcreate", args...)); err != nil {
+			return trace.Wrap(err, "failed to create volume group %v", group.Name)
+		}
+	}
+	if group.ThinPool == nil {
+		return nil
+	}
+	pool := fmt.Sprintf("%v/%v", group.Name, group.ThinPool.Name)
+	if r.exists(exec.Command("lvs", "--noheadings", "-o", "lv_name", pool)) {
+		r.Infof("Thin pool %v already exists.", pool)
+		return nil
+	}
+	extents := group.ThinPool.Extents
+	if extents == "" {
+		extents = defaults.ThinPoolExtents
+	}
+	r.Infof("Creating thin pool %v.", pool)
+	err := r.exec(exec.Command("lvcreate", "--yes", "--wipesignatures", "y", "--type", "thin-pool",
+		"-l", extents, "-n", group.ThinPool.Name, group.Name))
+	if err != nil {
+		return trace.Wrap(err, "failed to create thin pool %v", pool)
+	}
+	return nil
+}
+
+func (r *volumes) createLogicalVolume(group schema.VolumeGroup, volume schema.LogicalVolume) error {
+	name := fmt.Sprintf("%v/%v", group.Name, volume.Name)
+	if r.exists(exec.Command("lvs", "--noheadings", "-o", "lv_name", name)) {
+		r.Infof("Logical volume %v already exists.", name)
+		return nil
+	}
+	size := fmt.Sprintf("%vb", volume.Size.Bytes())
+	args := []string{"--yes", "--wipesignatures", "y", "-n", volume.Name}
+	if group.ThinPool != nil {
+		args = append(args, "--type", "thin", "-V", size,
+			"--thinpool", group.ThinPool.Name, group.Name)
+	} else {
+		args = append(args, "-L", size, group.Name)
+	}
+	r.Infof("Creating logical volume %v.", name)
+	if err := r.exec(exec.Command("lvcreate", args...)); err != nil {
+		return trace.Wrap(err, "failed to create logical volume %v", name)
+	}
+	return nil
+}
+
+// mountFilesystem formats the device unless it already has a filesystem,
+// mounts it and records the mount in fstab so it persists across reboots
+func (r *volumes) mountFilesystem(device string, filesystem schema.Filesystem) error {
+	fsType, err := r.blkid(device, "TYPE")
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	switch fsType {
+	case "":
+		r.Infof("Creating %v filesystem on %v.", filesystem.FilesystemType(), device)
+		err := r.exec(exec.Command("mkfs", "-t", filesystem.FilesystemType(), device))
+		if err != nil {
+			return trace.Wrap(err, "failed to create filesystem on %v", device)
+		}
+	case filesystem.FilesystemType():
+		r.Infof("Device %v already has %v filesystem.", device, fsType)
+	default:
+		return trace.BadParameter("device %v has %v filesystem, expected %v",
+			device, fsType, filesystem.FilesystemType())
+	}
+	uuid, err := r.blkid(device, "UUID")
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := os.MkdirAll(filesystem.Path, defaults.SharedDirMask); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	err = addFstabEntry(fstabPath, fstabEntry{
+		device: fmt.Sprintf("UUID=%v", uuid),
+		path:   filesystem.Path,
+		fsType: filesystem.FilesystemType(),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if r.exists(exec.Command("mountpoint", "-q", filesystem.Path)) {
+		r.Infof("%v is already mounted.", filesystem.Path)
+	} else {
+		r.Infof("Mounting %v at %v.", device, filesystem.Path)
+		if err := r.exec(exec.Command("mount", filesystem.Path)); err != nil {
+			return trace.Wrap(err, "failed to mount %v at %v", device, filesystem.Path)
+		}
+	}
+	return trace.Wrap(r.setOwnership(filesystem))
+}
+
+// setOwnership sets the owner and mode of the mounted filesystem root.
+// The service user owns the directory unless the profile specifies otherwise
+func (r *volumes) setOwnership(filesystem schema.Filesystem) error {
+	uid, gid := r.UID, r.GID
+	if filesystem.UID != nil {
+		uid = *filesystem.UID
+	}
+	if filesystem.GID != nil {
+		gid = *filesystem.GID
+	}
+	r.Infof("Setting ownership on %v to %v:%v.", filesystem.Path, uid, gid)
+	if err := os.Chown(filesystem.Path, uid, gid); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	if filesystem.Mode == "" {
+		return nil
+	}
+	mode, err := strconv.ParseUint(filesystem.Mode, 8, 32)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Infof("Setting mode on %v to %v.", filesystem.Path, os.FileMode(mode))
+	return trace.ConvertSystemError(os.Chmod(filesystem.Path, os.FileMode(mode)))
+}
+
+// blkid returns the value of the specified tag of the device,
+// or an empty string if the device does not have it
+func (r *volumes) blkid(device, tag string) (string, error) {
+	var out bytes.Buffer
+	err := utils.ExecL(exec.Command("blkid", "-o", "value", "-s", tag, device), &out, r.FieldLogger)
+	if exitErr, ok := trace.Unwrap(err).(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == blkidNotFoundStatus {
+			return "", nil
+		}
+	}
+	if err != nil {
+		return "", trace.Wrap(err, "failed to query %v of device %v", tag, device)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// exists runs the specified query command and returns true if it succeeds
+func (r *volumes) exists(cmd *exec.Cmd) bool {
+	return utils.ExecL(cmd, ioutil.Discard, r.FieldLogger) == nil
+}
+
+func (r *volumes) exec(cmd *exec.Cmd) error {
+	return utils.ExecL(cmd, r.Out, r.FieldLogger)
+}
+
+// addFstabEntry adds the entry to the fstab file at the specified path
+// unless the file already has an entry for the same mount path
+func addFstabEntry(path string, entry fstabEntry) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return trace.ConvertSystemError(err)
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[1] == entry.path {
+			return nil
+		}
+	}
+	if len(data) != 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, []byte(entry.String())...)
+	return trace.ConvertSystemError(ioutil.WriteFile(path, data, defaults.SharedReadMask))
+}
+
+// String formats the entry as an fstab line
+func (r fstabEntry) String() string {
+	return fmt.Sprintf("%v\t%v\t%v\tdefaults\t0 0\n", r.device, r.path, r.fsType)
+}
+
+type fstabEntry struct {
+	// device is the device specification, e.g. UUID=<uuid>
+	device string
+	// path is the mount path
+	path string
+	// fsType is the filesystem type
+	fsType string
+}
+
+type volumes struct {
+	VolumesConfig
+}
+
+// fstabPath is the path to the filesystem table
+var fstabPath = "/etc/fstab"
+
+// blkidNotFoundStatus is the blkid exit status when the requested tag is not found
+const blkidNotFoundStatus = 2
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// Collect detects drift on each of the specified servers by running
+// the detection on the node through its RPC agent and returns
+// the reports in the order of servers
+func Collect(ctx context.Context, agents fsm.AgentRepository, servers []storage.Server) (reports []Report, err error) {
+	for _, server := range servers {
+		report, err := collect(ctx, agents, server)
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to detect drift on node %v (%v)",
+				server.Hostname, server.AdvertiseIP)
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// Repair repairs the drift described by the reports by running the repair
+// on each node with drift through its RPC agent. The output of the repair
+// is written to w
+func Repair(ctx context.Context, agents fsm.AgentRepository, reports []Report, w io.Writer) error {
+	for _, report := range reports {
+		if report.IsEmpty() {
+			continue
+		}
+		clt, err := agents.GetClient(ctx, report.Server.AdvertiseIP)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		err = clt.GravityCommand(ctx, logger(report.Server), w,
+			"status", "--drift", "--local", "--repair")
+		if err != nil {
+			return trace.Wrap(err, "failed to repair drift on node %v (%v)",
+				report.Server.Hostname, report.Server.AdvertiseIP)
+		}
+	}
+	return nil
+}
+
+func collect(ctx context.Context, agents fsm.AgentRepository, server storage.Server) (*Report, error) {
+	clt, err := agents.GetClient(ctx, server.AdvertiseIP)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var out bytes.Buffer
+	err = clt.GravityCommand(ctx, logger(server), &out,
+		"status", "--drift", "--local", "--output", string(constants.EncodingJSON))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return parseReport(out.Bytes())
+}
+
+// parseReport returns the node report from the JSON output of the
+// drift detection command. The output might be preceded by warnings
+// the command writes to stderr
+func parseReport(out []byte) (*Report, error) {
+	start := bytes.IndexByte(out, '[')
+	if start == -1 {
+		return nil, trace.BadParameter("unexpected drift detection output: %s", out)
+	}
+	var reports []Report
+	if err := json.Unmarshal(out[start:], &reports); err != nil {
+		return nil, trace.Wrap(err, "failed to parse drift detection output: %s", out)
+	}
+	if len(reports) != 1 {
+		return nil, trace.BadParameter("expected a single report, got %v", len(reports))
+	}
+	return &reports[0], nil
+}
+
+func logger(server storage.Server) logrus.FieldLogger {
+	return logrus.WithFields(logrus.Fields{
+		trace.Component: "drift",
+		"server":        server.AdvertiseIP,
+	})
+}
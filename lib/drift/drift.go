@@ -0,0 +1,472 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package drift detects differences between the system packages and
+// services installed on a cluster node and the state the cluster expects
+// the node to be in, and repairs them
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/systemservice"
+
+	"github.com/gravitational/trace"
+)
+
+// Config defines the drift detection configuration
+type Config struct {
+	// Operator is the cluster operator service
+	Operator ops.Operator
+	// ClusterPackages is the cluster package service
+	ClusterPackages pack.PackageService
+	// LocalPackages is the package service of the node
+	LocalPackages pack.PackageService
+	// Services manages package services on the node
+	Services Services
+	// Server is the cluster server the node is registered as
+	Server storage.Server
+}
+
+// CheckAndSetDefaults validates the config
+func (c Config) CheckAndSetDefaults() error {
+	if c.Operator == nil {
+		return trace.BadParameter("missing Operator")
+	}
+	if c.ClusterPackages == nil {
+		return trace.BadParameter("missing ClusterPackages")
+	}
+	if c.LocalPackages == nil {
+		return trace.BadParameter("missing LocalPackages")
+	}
+	if c.Services == nil {
+		return trace.BadParameter("missing Services")
+	}
+	if c.Server.AdvertiseIP == "" {
+		return trace.BadParameter("missing Server")
+	}
+	return nil
+}
+
+// Services defines the subset of the system service manager
+// used to inspect and repair package services
+type Services interface {
+	// ListPackageServices lists installed package services
+	ListPackageServices() ([]systemservice.PackageServiceStatus, error)
+	// RestartPackageService restarts package service
+	RestartPackageService(loc.Locator) error
+	// GetPackageServiceUnit returns the systemd unit of a package service
+	GetPackageServiceUnit(loc.Locator) (*systemservice.PackageServiceUnit, error)
+}
+
+// Type identifies the kind of drift
+type Type string
+
+const (
+	// TypeMissing means the expected package is not present on the node
+	TypeMissing Type = "missing"
+	// TypeVersion means a different version of the package is installed
+	TypeVersion Type = "version"
+	// TypeChecksum means the node copy of the package differs from the cluster one
+	TypeChecksum Type = "checksum"
+	// TypeServiceMissing means the package service is not installed
+	TypeServiceMissing Type = "service-missing"
+	// TypeServiceVersion means the service runs a different package version
+	TypeServiceVersion Type = "service-version"
+	// TypeServiceInactive means the package service is not running
+	TypeServiceInactive Type = "service-inactive"
+	// TypeServiceConfig means the package service is started with
+	// a configuration package other than the latest one
+	TypeServiceConfig Type = "service-config"
+	// TypeServiceModified means the service unit file has been changed
+	// on disk since systemd loaded it
+	TypeServiceModified Type = "service-modified"
+	// TypeServiceOverride means the service unit is overridden with drop-in files
+	TypeServiceOverride Type = "service-override"
+)
+
+// Drift describes a single difference between the expected and actual node state
+type Drift struct {
+	// Type is the drift type
+	Type Type `json:"type"`
+	// Package is the package the cluster expects on the node
+	Package loc.Locator `json:"package"`
+	// Actual is the package found on the node, if any
+	Actual *loc.Locator `json:"actual,omitempty"`
+	// Labels are the labels the package has in the cluster package service
+	Labels map[string]string `json:"labels,omitempty"`
+	// Message describes the drift
+	Message string `json:"message"`
+}
+
+// Report is the result of drift detection on a single node
+type Report struct {
+	// Server is the server the report is for
+	Server storage.Server `json:"server"`
+	// OperationID is the ID of the last completed operation
+	OperationID string `json:"operation_id,omitempty"`
+	// OperationType is the type of the last completed operation
+	OperationType string `json:"operation_type,omitempty"`
+	// RuntimePackage is the runtime package expected on the node
+	RuntimePackage loc.Locator `json:"runtime_package"`
+	// TeleportPackage is the teleport package expected on the node
+	TeleportPackage loc.Locator `json:"teleport_package"`
+	// Drifts lists detected differences
+	Drifts []Drift `json:"drifts"`
+}
+
+// IsEmpty returns true if no drift has been detected
+func (r Report) IsEmpty() bool {
+	return len(r.Drifts) == 0
+}
+
+// Detect compares packages, services and their configuration on the node
+// with the state expected by the cluster
+func Detect(config Config) (*Report, error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	cluster, err := config.Operator.GetLocalSite()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	active, err := ops.GetActiveOperations(cluster.Key(), config.Operator)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if len(active) != 0 {
+		return nil, trace.BadParameter("operation %v is in progress, "+
+			"drift can only be detected in an idle cluster", active[0])
+	}
+	report := Report{Server: config.Server}
+	var plan *storage.OperationPlan
+	operation, _, err := ops.GetLastCompletedOperation(cluster.Key(), config.Operator)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if operation != nil {
+		report.OperationID = operation.ID
+		report.OperationType = operation.Type
+		plan, err = config.Operator.GetOperationPlan(operation.Key())
+		if err != nil && !trace.IsNotFound(err) {
+			return nil, trace.Wrap(err)
+		}
+	}
+	expected, err := expectedPackages(*cluster, plan, config.ClusterPackages, config.Server)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	report.RuntimePackage = expected[0].envelope.Locator
+	report.TeleportPackage = expected[1].envelope.Locator
+	report.Drifts, err = compare(expected, config.LocalPackages, config.Services)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &report, nil
+}
+
+// expectedPackage is a package the cluster expects to be present on the node
+type expectedPackage struct {
+	// envelope describes the package
+	envelope pack.PackageEnvelope
+	// system is whether this is a system package installed
+	// with the "installed" label
+	system bool
+	// service is whether the package runs as a package service
+	service bool
+	// config is the configuration package the service is expected
+	// to be started with
+	config *loc.Locator
+}
+
+// expectedPackages returns packages the cluster expects on the specified server:
+// the runtime, teleport and gravity packages followed by configuration packages.
+//
+// The runtime package is taken from the plan of the last completed operation
+// if it updated the server, otherwise from the application manifest
+func expectedPackages(cluster ops.Site, plan *storage.OperationPlan, packages pack.PackageService, server storage.Server) (expected []expectedPackage, err error) {
+	runtimePackage := runtimeFromPlan(plan, server)
+	if runtimePackage == nil {
+		runtimePackage, err = cluster.App.Manifest.RuntimePackageForProfile(server.Role)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	expected = append(expected, expectedPackage{
+		envelope: pack.PackageEnvelope{Locator: *runtimePackage},
+		system:   true,
+		service:  true,
+	})
+	for _, name := range []string{constants.TeleportPackage, constants.GravityPackage} {
+		locator, err := cluster.App.Manifest.Dependencies.ByName(name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		expected = append(expected, expectedPackage{
+			envelope: pack.PackageEnvelope{Locator: *locator},
+			system:   true,
+			service:  name == constants.TeleportPackage,
+		})
+	}
+	// configuration and secrets packages are regenerated by operations,
+	// the node is expected to have the latest version of each
+	latest := make(map[string]pack.PackageEnvelope)
+	err = pack.ForeachPackageInRepo(packages, cluster.Domain, func(e pack.PackageEnvelope) error {
+		if !e.HasLabel(pack.AdvertiseIPLabel, server.AdvertiseIP) {
+			return nil
+		}
+		existing, ok := latest[e.Locator.Name]
+		if !ok {
+			latest[e.Locator.Name] = e
+			return nil
+		}
+		newer, err := isNewer(e.Locator, existing.Locator)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if newer {
+			latest[e.Locator.Name] = e
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var names []string
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		envelope := latest[name]
+		switch envelope.RuntimeLabels[pack.PurposeLabel] {
+		case pack.PurposePlanetConfig:
+			expected[0].config = &envelope.Locator
+		case pack.PurposeTeleportNodeConfig:
+			expected[1].config = &envelope.Locator
+		}
+		expected = append(expected, expectedPackage{envelope: envelope})
+	}
+	return expected, nil
+}
+
+// runtimeFromPlan returns the runtime package the specified server
+// has been updated to by the plan or nil if the plan did not update it
+func runtimeFromPlan(plan *storage.OperationPlan, server storage.Server) *loc.Locator {
+	if plan == nil {
+		return nil
+	}
+	var runtimePackage *loc.Locator
+	for _, phase := range flatten(plan.Phases) {
+		if phase.Data == nil || phase.Data.Server == nil || phase.Data.RuntimePackage == nil {
+			continue
+		}
+		if phase.Data.Server.AdvertiseIP == server.AdvertiseIP {
+			runtimePackage = phase.Data.RuntimePackage
+		}
+	}
+	return runtimePackage
+}
+
+// compare returns the list of differences between the expected packages
+// and the packages and services found on the node
+func compare(expected []expectedPackage, packages pack.PackageService, services Services) (drifts []Drift, err error) {
+	statuses, err := services.ListPackageServices()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, e := range expected {
+		var drift *Drift
+		if e.system {
+			drift, err = compareSystemPackage(e, packages, statuses)
+		} else {
+			drift, err = comparePackage(e, packages)
+		}
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+		if !e.service || !isServiceRunning(drift) {
+			continue
+		}
+		unitDrifts, err := compareServiceUnit(e, services)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		drifts = append(drifts, unitDrifts...)
+	}
+	return drifts, nil
+}
+
+// isServiceRunning returns true if the expected version of the package
+// service is installed given the drift detected for its package
+func isServiceRunning(drift *Drift) bool {
+	return drift == nil || drift.Type == TypeServiceInactive
+}
+
+// compareServiceUnit returns the list of differences between the systemd unit
+// of the package service and the configuration expected by the cluster
+func compareServiceUnit(e expectedPackage, services Services) (drifts []Drift, err error) {
+	expected := e.envelope.Locator
+	unit, err := services.GetPackageServiceUnit(expected)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if e.config != nil && (unit.ConfigPackage == nil || !unit.ConfigPackage.IsEqualTo(*e.config)) {
+		drift := Drift{
+			Type:    TypeServiceConfig,
+			Package: expected,
+			Actual:  unit.ConfigPackage,
+			Message: fmt.Sprintf("service is started with configuration package %v instead of %v",
+				unit.ConfigPackage, e.config),
+		}
+		if unit.ConfigPackage == nil {
+			drift.Message = fmt.Sprintf("service is not started with configuration package %v", e.config)
+		}
+		drifts = append(drifts, drift)
+	}
+	if unit.NeedsReload {
+		drifts = append(drifts, Drift{
+			Type:    TypeServiceModified,
+			Package: expected,
+			Message: "service unit file has been changed on disk",
+		})
+	}
+	if len(unit.DropIns) != 0 {
+		drifts = append(drifts, Drift{
+			Type:    TypeServiceOverride,
+			Package: expected,
+			Message: fmt.Sprintf("service unit is overridden with %v",
+				strings.Join(unit.DropIns, ", ")),
+		})
+	}
+	return drifts, nil
+}
+
+func compareSystemPackage(e expectedPackage, packages pack.PackageService, statuses []systemservice.PackageServiceStatus) (*Drift, error) {
+	expected := e.envelope.Locator
+	installed, err := pack.FindInstalledPackage(packages, expected)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if installed == nil {
+		return &Drift{
+			Type:    TypeMissing,
+			Package: expected,
+			Message: fmt.Sprintf("package %v is not installed", expected),
+		}, nil
+	}
+	if installed.Version != expected.Version {
+		return &Drift{
+			Type:    TypeVersion,
+			Package: expected,
+			Actual:  installed,
+			Message: fmt.Sprintf("version %v is installed instead of %v",
+				installed.Version, expected.Version),
+		}, nil
+	}
+	if !e.service {
+		return nil, nil
+	}
+	var status *systemservice.PackageServiceStatus
+	for i, s := range statuses {
+		if s.Package.Repository == expected.Repository && s.Package.Name == expected.Name {
+			status = &statuses[i]
+			break
+		}
+	}
+	switch {
+	case status == nil:
+		return &Drift{
+			Type:    TypeServiceMissing,
+			Package: expected,
+			Message: fmt.Sprintf("service for package %v is not installed", expected),
+		}, nil
+	case status.Package.Version != expected.Version:
+		return &Drift{
+			Type:    TypeServiceVersion,
+			Package: expected,
+			Actual:  &status.Package,
+			Message: fmt.Sprintf("service runs version %v instead of %v",
+				status.Package.Version, expected.Version),
+		}, nil
+	case status.Status != serviceActive:
+		return &Drift{
+			Type:    TypeServiceInactive,
+			Package: expected,
+			Message: fmt.Sprintf("service for package %v is %v", expected, status.Status),
+		}, nil
+	}
+	return nil, nil
+}
+
+func comparePackage(e expectedPackage, packages pack.PackageService) (*Drift, error) {
+	expected := e.envelope.Locator
+	envelope, err := packages.ReadPackageEnvelope(expected)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if envelope == nil {
+		return &Drift{
+			Type:    TypeMissing,
+			Package: expected,
+			Labels:  e.envelope.RuntimeLabels,
+			Message: fmt.Sprintf("package %v has not been pulled", expected),
+		}, nil
+	}
+	if envelope.SHA512 != e.envelope.SHA512 {
+		return &Drift{
+			Type:    TypeChecksum,
+			Package: expected,
+			Labels:  e.envelope.RuntimeLabels,
+			Message: fmt.Sprintf("contents of package %v differ from the cluster copy", expected),
+		}, nil
+	}
+	return nil, nil
+}
+
+// isNewer returns true if package a has a greater version than package b
+func isNewer(a, b loc.Locator) (bool, error) {
+	versionA, err := a.SemVer()
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	versionB, err := b.SemVer()
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return versionB.LessThan(*versionA), nil
+}
+
+func flatten(phases []storage.OperationPhase) (result []storage.OperationPhase) {
+	for _, phase := range phases {
+		result = append(result, phase)
+		result = append(result, flatten(phase.Phases)...)
+	}
+	return result
+}
+
+// serviceActive is the systemd state of a running service
+const serviceActive = "active"
@@ -0,0 +1,361 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/blob/fs"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/pack/localpack"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+	"github.com/gravitational/gravity/lib/systemservice"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestDrift(t *testing.T) { TestingT(t) }
+
+type DriftSuite struct {
+	clusterPackages pack.PackageService
+	localPackages   pack.PackageService
+	services        *testServices
+	cluster         ops.Site
+	server          storage.Server
+}
+
+var _ = Suite(&DriftSuite{})
+
+func (s *DriftSuite) SetUpTest(c *C) {
+	s.clusterPackages = newPackages(c)
+	s.localPackages = newPackages(c)
+	s.server = storage.Server{
+		AdvertiseIP: "10.0.0.1",
+		Hostname:    "node-1",
+		Role:        "node",
+	}
+	s.cluster = ops.Site{
+		Domain: "example.com",
+		App: ops.Application{
+			Manifest: schema.Manifest{
+				NodeProfiles: schema.NodeProfiles{{Name: "node"}},
+				SystemOptions: &schema.SystemOptions{
+					Dependencies: schema.SystemDependencies{
+						Runtime: &schema.Dependency{Locator: planet},
+					},
+				},
+				Dependencies: schema.Dependencies{
+					Packages: []schema.Dependency{
+						{Locator: teleport},
+						{Locator: gravity},
+					},
+				},
+			},
+		},
+	}
+	s.services = &testServices{
+		statuses: []systemservice.PackageServiceStatus{
+			{Package: planet, Status: serviceActive},
+			{Package: teleport, Status: serviceActive},
+		},
+		units: map[string]systemservice.PackageServiceUnit{
+			planet.Name: {Package: planet, ConfigPackage: &planetConfigV2},
+		},
+	}
+	for _, locator := range []loc.Locator{planet, teleport, gravity} {
+		createPackage(c, s.localPackages, locator, "system", map[string]string{
+			pack.InstalledLabel: pack.InstalledLabel,
+		})
+	}
+	for _, locator := range []loc.Locator{planetConfig, planetConfigV2} {
+		createPackage(c, s.clusterPackages, locator, locator.Version, planetConfigLabels)
+	}
+	createPackage(c, s.localPackages, planetConfigV2, planetConfigV2.Version, planetConfigLabels)
+}
+
+func (s *DriftSuite) TestNoDrift(c *C) {
+	drifts := s.detect(c, nil)
+	c.Assert(drifts, HasLen, 0)
+}
+
+func (s *DriftSuite) TestDetectsDrift(c *C) {
+	s.services.statuses = []systemservice.PackageServiceStatus{
+		{Package: planet, Status: "failed"},
+	}
+	c.Assert(s.localPackages.DeletePackage(planetConfigV2), IsNil)
+	createPackage(c, s.localPackages, planetConfigV2, "modified", planetConfigLabels)
+	c.Assert(s.localPackages.DeletePackage(gravity), IsNil)
+
+	drifts := s.detect(c, nil)
+	for i := range drifts {
+		drifts[i].Message = ""
+	}
+	c.Assert(drifts, DeepEquals, []Drift{
+		{Type: TypeServiceInactive, Package: planet},
+		{Type: TypeServiceMissing, Package: teleport},
+		{Type: TypeMissing, Package: gravity},
+		{Type: TypeChecksum, Package: planetConfigV2, Labels: planetConfigLabels},
+	})
+}
+
+func (s *DriftSuite) TestDetectsServiceUnitDrift(c *C) {
+	s.services.units[planet.Name] = systemservice.PackageServiceUnit{
+		Package:       planet,
+		ConfigPackage: &planetConfig,
+		DropIns:       []string{"/etc/systemd/system/planet.service.d/override.conf"},
+		NeedsReload:   true,
+	}
+	drifts := s.detect(c, nil)
+	for i := range drifts {
+		drifts[i].Message = ""
+	}
+	c.Assert(drifts, DeepEquals, []Drift{
+		{Type: TypeServiceConfig, Package: planet, Actual: &planetConfig},
+		{Type: TypeServiceModified, Package: planet},
+		{Type: TypeServiceOverride, Package: planet},
+	})
+
+	plan, err := NewRepairPlan(Report{Server: s.server, RuntimePackage: planet, Drifts: drifts})
+	c.Assert(err, IsNil)
+	c.Assert(phaseIDs(plan.Phases), DeepEquals, []string{"/reinstall", "/reinstall/planet"})
+
+	// overrides are not repaired
+	_, err = NewRepairPlan(Report{Server: s.server, Drifts: drifts[2:]})
+	c.Assert(trace.IsNotFound(err), Equals, true)
+}
+
+func (s *DriftSuite) TestRuntimeFromPlan(c *C) {
+	updated := loc.MustParseLocator("gravitational.io/planet:0.0.2")
+	plan := &storage.OperationPlan{
+		Phases: []storage.OperationPhase{{
+			ID: "/masters",
+			Phases: []storage.OperationPhase{{
+				ID: "/masters/node-1",
+				Data: &storage.OperationPhaseData{
+					Server:         &s.server,
+					RuntimePackage: &updated,
+				},
+			}},
+		}},
+	}
+	drifts := s.detect(c, plan)
+	c.Assert(drifts, HasLen, 1)
+	c.Assert(drifts[0].Type, Equals, TypeVersion)
+	c.Assert(drifts[0].Package, DeepEquals, updated)
+	c.Assert(*drifts[0].Actual, DeepEquals, planet)
+}
+
+func (s *DriftSuite) TestRepairPlan(c *C) {
+	report := Report{
+		Server:          s.server,
+		RuntimePackage:  planet,
+		TeleportPackage: teleport,
+		Drifts: []Drift{
+			{Type: TypeServiceInactive, Package: teleport},
+			{Type: TypeMissing, Package: gravity},
+			{Type: TypeChecksum, Package: planetConfigV2, Labels: planetConfigLabels},
+		},
+	}
+	plan, err := NewRepairPlan(report)
+	c.Assert(err, IsNil)
+	c.Assert(phaseIDs(plan.Phases), DeepEquals, []string{
+		"/pull", "/pull/planet-config-10_0_0_1",
+		"/reinstall", "/reinstall/planet",
+		"/restart", "/restart/teleport",
+	})
+	c.Assert(plan.Phases[1].Requires, DeepEquals, []string{"/pull"})
+	c.Assert(plan.Phases[1].Phases[0].Data.Labels, DeepEquals, map[string]string{
+		pack.InstalledLabel: pack.InstalledLabel,
+		pack.PurposeLabel:   pack.PurposeRuntime,
+	})
+
+	// system package version drift requires a cluster update
+	_, err = NewRepairPlan(Report{
+		Server: s.server,
+		Drifts: []Drift{{Type: TypeVersion, Package: planet}},
+	})
+	c.Assert(err, NotNil)
+}
+
+func (s *DriftSuite) TestExecutesRepairPlan(c *C) {
+	c.Assert(s.localPackages.DeletePackage(planetConfigV2), IsNil)
+	s.services.statuses[1].Status = "failed"
+	drifts := s.detect(c, nil)
+	c.Assert(drifts, HasLen, 2)
+
+	plan, err := NewRepairPlan(Report{Server: s.server, Drifts: []Drift{drifts[1]}})
+	c.Assert(err, IsNil)
+	// restart the inactive service in addition to pulling the package
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID: repairRestartPhase,
+		Phases: []storage.OperationPhase{{
+			ID:       "/restart/teleport",
+			Executor: repairRestartPhase,
+			Data:     &storage.OperationPhaseData{Package: &teleport},
+		}},
+	})
+	engine := &repairEngine{
+		Config: Config{
+			ClusterPackages: s.clusterPackages,
+			LocalPackages:   s.localPackages,
+			Services:        s.services,
+			Server:          s.server,
+		},
+		FieldLogger: logrus.WithField("test", "drift"),
+		plan:        *plan,
+	}
+	machine, err := fsm.New(fsm.Config{Engine: engine})
+	c.Assert(err, IsNil)
+	c.Assert(machine.ExecutePlan(context.TODO(), utils.NewNopProgress(), false), IsNil)
+
+	resolved, err := engine.GetPlan()
+	c.Assert(err, IsNil)
+	c.Assert(fsm.IsCompleted(resolved), Equals, true)
+	c.Assert(s.services.restarted, DeepEquals, []loc.Locator{teleport})
+	envelope, err := s.localPackages.ReadPackageEnvelope(planetConfigV2)
+	c.Assert(err, IsNil)
+	c.Assert(envelope.HasLabels(planetConfigLabels), Equals, true)
+}
+
+func (s *DriftSuite) TestWritesText(c *C) {
+	var buf bytes.Buffer
+	err := writeText(&buf, Report{
+		Server:        s.server,
+		OperationID:   "1",
+		OperationType: ops.OperationUpdate,
+		Drifts: []Drift{
+			{Type: TypeMissing, Package: gravity, Message: "package is not installed"},
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, `Node node-1 (10.0.0.1), last completed operation operation_update (1)
+Type     Package                         Details
+----     -------                         -------
+missing  gravitational.io/gravity:0.0.1  package is not installed
+`)
+}
+
+func (s *DriftSuite) TestWritesReports(c *C) {
+	reports := []Report{
+		{Server: s.server, Drifts: []Drift{{Type: TypeMissing, Package: gravity, Message: "package is not installed"}}},
+		{Server: storage.Server{AdvertiseIP: "10.0.0.2", Hostname: "node-2"}},
+	}
+	var buf bytes.Buffer
+	c.Assert(Write(&buf, reports, constants.EncodingText), IsNil)
+	c.Assert(buf.String(), Equals, `Node node-1 (10.0.0.1)
+Type     Package                         Details
+----     -------                         -------
+missing  gravitational.io/gravity:0.0.1  package is not installed
+
+Node node-2 (10.0.0.2)
+No drift detected.
+`)
+
+	buf.Reset()
+	c.Assert(Write(&buf, reports[:1], constants.EncodingJSON), IsNil)
+	report, err := parseReport(append([]byte("warning: something\n"), buf.Bytes()...))
+	c.Assert(err, IsNil)
+	c.Assert(*report, DeepEquals, reports[0])
+}
+
+func (s *DriftSuite) detect(c *C, plan *storage.OperationPlan) []Drift {
+	expected, err := expectedPackages(s.cluster, plan, s.clusterPackages, s.server)
+	c.Assert(err, IsNil)
+	drifts, err := compare(expected, s.localPackages, s.services)
+	c.Assert(err, IsNil)
+	return drifts
+}
+
+type testServices struct {
+	statuses  []systemservice.PackageServiceStatus
+	units     map[string]systemservice.PackageServiceUnit
+	restarted []loc.Locator
+}
+
+func (r *testServices) ListPackageServices() ([]systemservice.PackageServiceStatus, error) {
+	return r.statuses, nil
+}
+
+func (r *testServices) RestartPackageService(locator loc.Locator) error {
+	r.restarted = append(r.restarted, locator)
+	return nil
+}
+
+func (r *testServices) GetPackageServiceUnit(locator loc.Locator) (*systemservice.PackageServiceUnit, error) {
+	unit, ok := r.units[locator.Name]
+	if !ok {
+		return &systemservice.PackageServiceUnit{Package: locator}, nil
+	}
+	return &unit, nil
+}
+
+func newPackages(c *C) pack.PackageService {
+	dir := c.MkDir()
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, "bolt.db")})
+	c.Assert(err, IsNil)
+	objects, err := fs.New(dir)
+	c.Assert(err, IsNil)
+	packages, err := localpack.New(localpack.Config{
+		Backend:     backend,
+		UnpackedDir: filepath.Join(dir, defaults.UnpackedDir),
+		Objects:     objects,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(packages.UpsertRepository(defaults.SystemAccountOrg, time.Time{}), IsNil)
+	c.Assert(packages.UpsertRepository("example.com", time.Time{}), IsNil)
+	return packages
+}
+
+func createPackage(c *C, packages pack.PackageService, locator loc.Locator, data string, labels map[string]string) {
+	_, err := packages.CreatePackage(locator, bytes.NewBufferString(data), pack.WithLabels(labels))
+	c.Assert(err, IsNil)
+}
+
+func phaseIDs(phases []storage.OperationPhase) (ids []string) {
+	for _, phase := range phases {
+		ids = append(ids, phase.ID)
+		ids = append(ids, phaseIDs(phase.Phases)...)
+	}
+	return ids
+}
+
+var (
+	planet         = loc.MustParseLocator("gravitational.io/planet:0.0.1")
+	teleport       = loc.MustParseLocator("gravitational.io/teleport:0.0.1")
+	gravity        = loc.MustParseLocator("gravitational.io/gravity:0.0.1")
+	planetConfig   = loc.MustParseLocator("example.com/planet-config-10_0_0_1:0.0.1")
+	planetConfigV2 = loc.MustParseLocator("example.com/planet-config-10_0_0_1:0.0.2")
+
+	planetConfigLabels = map[string]string{
+		pack.PurposeLabel:     pack.PurposePlanetConfig,
+		pack.AdvertiseIPLabel: "10.0.0.1",
+	}
+)
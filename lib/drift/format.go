@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/gravitational/gravity/lib/constants"
+
+	"github.com/gravitational/trace"
+)
+
+// Write outputs the reports to w in the specified format
+func Write(w io.Writer, reports []Report, format constants.Format) error {
+	switch format {
+	case constants.EncodingText:
+		for i, report := range reports {
+			if i != 0 {
+				fmt.Fprintln(w)
+			}
+			if err := writeText(w, report); err != nil {
+				return trace.Wrap(err)
+			}
+		}
+		return nil
+	case constants.EncodingJSON:
+		data, err := json.MarshalIndent(reports, "", "    ")
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return trace.Wrap(err)
+	}
+	return trace.BadParameter("unsupported output format %q, supported are: %v, %v",
+		format, constants.EncodingText, constants.EncodingJSON)
+}
+
+func writeText(w io.Writer, report Report) error {
+	fmt.Fprintf(w, "Node %v (%v)", report.Server.Hostname, report.Server.AdvertiseIP)
+	if report.OperationID != "" {
+		fmt.Fprintf(w, ", last completed operation %v (%v)", report.OperationType, report.OperationID)
+	}
+	fmt.Fprintln(w)
+	if report.IsEmpty() {
+		_, err := fmt.Fprintln(w, "No drift detected.")
+		return trace.Wrap(err)
+	}
+	t := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(t, "Type\tPackage\tDetails")
+	fmt.Fprintln(t, "----\t-------\t-------")
+	for _, drift := range report.Drifts {
+		fmt.Fprintf(t, "%v\t%v\t%v\n", drift.Type, drift.Package, drift.Message)
+	}
+	return trace.Wrap(t.Flush())
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitational/gravity/lib/app/service"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/configure"
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// NewRepairPlan returns a plan that repairs the drift described by the report.
+//
+// The plan pulls missing or modified configuration packages from the cluster,
+// reinstalls services that do not match the installed packages, use
+// outdated configuration or have modified unit files and restarts inactive
+// services. Drift in system package versions requires a cluster update
+// and service unit overrides are left to the administrator, so neither
+// is repaired.
+// Returns NotFound if the report has no drift that can be repaired
+func NewRepairPlan(report Report) (*storage.OperationPlan, error) {
+	var pulls, reinstalls, restarts []storage.OperationPhase
+	reinstalled := make(map[string]bool)
+	reinstall := func(locator loc.Locator, labels map[string]string) {
+		if reinstalled[locator.Name] {
+			return
+		}
+		reinstalled[locator.Name] = true
+		reinstalls = append(reinstalls, storage.OperationPhase{
+			ID:          path.Join(repairReinstallPhase, locator.Name),
+			Executor:    repairReinstallPhase,
+			Description: fmt.Sprintf("Reinstall package %v", locator),
+			Data: &storage.OperationPhaseData{
+				Package: &locator,
+				Labels:  labels,
+			},
+		})
+	}
+	for _, drift := range report.Drifts {
+		switch drift.Type {
+		case TypeMissing, TypeChecksum:
+			if drift.Labels[pack.AdvertiseIPLabel] == "" {
+				// system package
+				continue
+			}
+			locator := drift.Package
+			pulls = append(pulls, storage.OperationPhase{
+				ID:          path.Join(repairPullPhase, locator.Name),
+				Executor:    repairPullPhase,
+				Description: fmt.Sprintf("Pull package %v from the cluster", locator),
+				Data: &storage.OperationPhaseData{
+					Package: &locator,
+					Labels:  drift.Labels,
+				},
+			})
+			if isSecretsPackage(drift.Labels) {
+				reinstall(locator, nil)
+			}
+		case TypeServiceMissing, TypeServiceVersion, TypeServiceConfig, TypeServiceModified:
+			reinstall(drift.Package, serviceLabels(drift.Package))
+		}
+	}
+	// packages have been pulled but the services still use the old
+	// configuration - reinstall them to pick up the pulled packages
+	for _, drift := range report.Drifts {
+		if drift.Type != TypeMissing && drift.Type != TypeChecksum {
+			continue
+		}
+		switch drift.Labels[pack.PurposeLabel] {
+		case pack.PurposePlanetConfig, pack.PurposePlanetSecrets:
+			if isInstalled(report, report.RuntimePackage) {
+				reinstall(report.RuntimePackage, serviceLabels(report.RuntimePackage))
+			}
+		case pack.PurposeTeleportNodeConfig, pack.PurposeTeleportMasterConfig:
+			if isInstalled(report, report.TeleportPackage) {
+				reinstall(report.TeleportPackage, nil)
+			}
+		}
+	}
+	for _, drift := range report.Drifts {
+		if drift.Type != TypeServiceInactive || reinstalled[drift.Package.Name] {
+			continue
+		}
+		locator := drift.Package
+		restarts = append(restarts, storage.OperationPhase{
+			ID:          path.Join(repairRestartPhase, locator.Name),
+			Executor:    repairRestartPhase,
+			Description: fmt.Sprintf("Restart service for package %v", locator),
+			Data: &storage.OperationPhaseData{
+				Package: &locator,
+			},
+		})
+	}
+	plan := storage.OperationPlan{
+		OperationID:   uuid.New(),
+		OperationType: OperationRepair,
+		Servers:       []storage.Server{report.Server},
+	}
+	if len(pulls) != 0 {
+		plan.Phases = append(plan.Phases, storage.OperationPhase{
+			ID:          repairPullPhase,
+			Description: "Pull packages from the cluster",
+			Phases:      pulls,
+		})
+	}
+	if len(reinstalls) != 0 {
+		plan.Phases = append(plan.Phases, storage.OperationPhase{
+			ID:          repairReinstallPhase,
+			Description: "Reinstall package services",
+			Phases:      reinstalls,
+			Requires:    fsm.RequireIfPresent(&plan, repairPullPhase),
+		})
+	}
+	if len(restarts) != 0 {
+		plan.Phases = append(plan.Phases, storage.OperationPhase{
+			ID:          repairRestartPhase,
+			Description: "Restart inactive services",
+			Phases:      restarts,
+			Requires:    fsm.RequireIfPresent(&plan, repairReinstallPhase),
+		})
+	}
+	if len(plan.Phases) == 0 {
+		return nil, trace.NotFound("no drift that can be repaired automatically")
+	}
+	return &plan, nil
+}
+
+// NewRepairFSM returns a state machine that executes the repair plan
+// on the local node.
+//
+// The plan is not persisted: the state of its phases is only kept in memory
+func NewRepairFSM(config Config, plan storage.OperationPlan) (*fsm.FSM, error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	gravityPath, err := os.Executable()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	logger := logrus.WithField(trace.Component, "drift")
+	engine := &repairEngine{
+		Config:      config,
+		FieldLogger: logger,
+		plan:        plan,
+		gravityPath: gravityPath,
+	}
+	machine, err := fsm.New(fsm.Config{
+		Engine: engine,
+		Logger: logger,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	machine.SetPreExec(engine.updateProgress)
+	return machine, nil
+}
+
+// repairEngine is the fsm engine for the drift repair plan
+type repairEngine struct {
+	Config
+	logrus.FieldLogger
+	// gravityPath is the path to the gravity binary used to reinstall packages
+	gravityPath string
+	mu          sync.Mutex
+	plan        storage.OperationPlan
+	changelog   storage.PlanChangelog
+}
+
+// GetExecutor returns the executor for the specified phase
+func (e *repairEngine) GetExecutor(params fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Package == nil {
+		return nil, trace.BadParameter("phase %q does not specify a package", params.Phase.ID)
+	}
+	executor := &repairExecutor{
+		FieldLogger: e.WithField(constants.FieldPhase, params.Phase.ID),
+		data:        *params.Phase.Data,
+	}
+	switch params.Phase.Executor {
+	case repairPullPhase:
+		executor.execute = e.pull
+	case repairReinstallPhase:
+		executor.execute = e.reinstall
+	case repairRestartPhase:
+		executor.execute = e.restart
+	default:
+		return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+	}
+	return executor, nil
+}
+
+// ChangePhaseState records the phase state change
+func (e *repairEngine) ChangePhaseState(ctx context.Context, change fsm.StateChange) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.changelog = append(e.changelog, storage.PlanChange{
+		ID:          uuid.New(),
+		ClusterName: e.plan.ClusterName,
+		OperationID: e.plan.OperationID,
+		PhaseID:     change.Phase,
+		NewState:    change.State,
+		Error:       utils.ToRawTrace(change.Error),
+		Created:     time.Now().UTC(),
+	})
+	e.Debugf("Applied %v.", change)
+	return nil
+}
+
+// GetPlan returns the up-to-date repair plan
+func (e *repairEngine) GetPlan() (*storage.OperationPlan, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	plan := e.plan
+	plan.Phases = copyPhases(e.plan.Phases)
+	return fsm.ResolvePlan(plan, e.changelog), nil
+}
+
+// RunCommand is not supported as the repair plan is always executed locally
+func (e *repairEngine) RunCommand(context.Context, fsm.RemoteRunner, storage.Server, fsm.Params) error {
+	return trace.BadParameter("drift repair phases can only be executed locally")
+}
+
+// Complete is a no-op as the repair plan does not correspond to a cluster operation
+func (e *repairEngine) Complete(error) error {
+	return nil
+}
+
+func (e *repairEngine) updateProgress(ctx context.Context, params fsm.Params) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	phase, err := fsm.FindPhase(plan, params.PhaseID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	params.Progress.NextStep(phase.Description)
+	return nil
+}
+
+// pull pulls the package from the cluster package service
+func (e *repairEngine) pull(data storage.OperationPhaseData) error {
+	_, err := service.PullPackage(service.PackagePullRequest{
+		FieldLogger: e.FieldLogger,
+		SrcPack:     e.ClusterPackages,
+		DstPack:     e.LocalPackages,
+		Package:     *data.Package,
+		Labels:      data.Labels,
+		Upsert:      true,
+	})
+	return trace.Wrap(err)
+}
+
+// reinstall reinstalls the package and its service
+func (e *repairEngine) reinstall(data storage.OperationPhaseData) error {
+	args := []string{e.gravityPath, "system", "reinstall", data.Package.String()}
+	if len(data.Labels) != 0 {
+		labels := configure.KeyVal(data.Labels)
+		args = append(args, "--labels", labels.String())
+	}
+	out, err := fsm.RunCommand(args)
+	if err != nil {
+		return trace.Wrap(err, "failed to reinstall %v: %s", data.Package, out)
+	}
+	e.Infof("Reinstalled %v: %s.", data.Package, out)
+	return nil
+}
+
+// restart restarts the package service
+func (e *repairEngine) restart(data storage.OperationPhaseData) error {
+	return trace.Wrap(e.Services.RestartPackageService(*data.Package))
+}
+
+// repairExecutor executes a single phase of the repair plan
+type repairExecutor struct {
+	logrus.FieldLogger
+	data    storage.OperationPhaseData
+	execute func(storage.OperationPhaseData) error
+}
+
+// PreCheck is a no-op
+func (*repairExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (*repairExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// Execute executes the phase
+func (p *repairExecutor) Execute(context.Context) error {
+	return trace.Wrap(p.execute(p.data))
+}
+
+// Rollback is a no-op as repair phases only bring the node
+// closer to the expected state
+func (*repairExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+// isInstalled returns true if the expected version of the specified
+// system package is installed on the node
+func isInstalled(report Report, locator loc.Locator) bool {
+	if locator.IsEmpty() {
+		return false
+	}
+	for _, drift := range report.Drifts {
+		if drift.Package.Name != locator.Name {
+			continue
+		}
+		if drift.Type == TypeMissing || drift.Type == TypeVersion {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceLabels returns labels to reinstall the specified package with
+func serviceLabels(locator loc.Locator) map[string]string {
+	if isRuntimePackage(locator) {
+		return map[string]string{
+			pack.InstalledLabel: pack.InstalledLabel,
+			pack.PurposeLabel:   pack.PurposeRuntime,
+		}
+	}
+	return nil
+}
+
+func isRuntimePackage(locator loc.Locator) bool {
+	return strings.HasPrefix(locator.Name, constants.PlanetPackage)
+}
+
+func isSecretsPackage(labels map[string]string) bool {
+	return labels[pack.PurposeLabel] == pack.PurposePlanetSecrets
+}
+
+func copyPhases(phases []storage.OperationPhase) []storage.OperationPhase {
+	result := make([]storage.OperationPhase, len(phases))
+	for i, phase := range phases {
+		result[i] = phase
+		result[i].Phases = copyPhases(phase.Phases)
+	}
+	return result
+}
+
+const (
+	// OperationRepair is the type of the drift repair plan
+	OperationRepair = "drift_repair"
+
+	repairPullPhase      = "/pull"
+	repairReinstallPhase = "/reinstall"
+	repairRestartPhase   = "/restart"
+)
@@ -0,0 +1,240 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcd implements day-2 maintenance of the cluster etcd:
+// snapshots stored as cluster packages, defragmentation of members
+// and status checks that raise alerts
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/pkg/transport"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// Client is the subset of etcd API used for maintenance
+type Client interface {
+	// MemberList lists the current cluster membership
+	MemberList(ctx context.Context) (*clientv3.MemberListResponse, error)
+	// Status returns the status of the member with the specified endpoint
+	Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error)
+	// Defragment defragments the storage of the member with the specified endpoint
+	Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error)
+	// AlarmList returns active alarms
+	AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error)
+}
+
+// NewClient returns a new etcd client talking to the members
+// running on the specified master servers
+func NewClient(servers []storage.Server, secretsDir string) (*clientv3.Client, error) {
+	tlsConfig, err := transport.TLSInfo{
+		CAFile:   filepath.Join(secretsDir, defaults.RootCertFilename),
+		CertFile: filepath.Join(secretsDir, defaults.EtcdCertFilename),
+		KeyFile:  filepath.Join(secretsDir, defaults.EtcdKeyFilename),
+	}.ClientConfig()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   Endpoints(servers),
+		TLS:         tlsConfig,
+		DialTimeout: defaults.DialTimeout,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client, nil
+}
+
+// Endpoints returns the etcd client endpoints of the specified master servers
+func Endpoints(servers []storage.Server) (endpoints []string) {
+	masters, _ := fsm.SplitServers(servers)
+	for _, master := range masters {
+		endpoints = append(endpoints, fmt.Sprintf("https://%v",
+			utils.JoinHostPort(master.AdvertiseIP, defaults.EtcdAPIPort)))
+	}
+	return endpoints
+}
+
+// Status describes the state of the etcd cluster
+type Status struct {
+	// Members lists the status of individual members
+	Members []MemberStatus `json:"members"`
+	// Leader is the ID of the current leader
+	Leader string `json:"leader,omitempty"`
+	// RaftTerm is the current raft term, it increases with every election
+	RaftTerm uint64 `json:"raft_term"`
+	// Alarms lists active alarms
+	Alarms []Alarm `json:"alarms,omitempty"`
+}
+
+// MemberStatus describes the state of a single etcd member
+type MemberStatus struct {
+	// ID is the member ID
+	ID string `json:"id"`
+	// Name is the member name
+	Name string `json:"name"`
+	// Endpoint is the member client endpoint
+	Endpoint string `json:"endpoint"`
+	// Version is the etcd version the member runs
+	Version string `json:"version,omitempty"`
+	// DBSize is the size of the member database in bytes
+	DBSize int64 `json:"db_size"`
+	// Leader is whether the member is the cluster leader
+	Leader bool `json:"leader"`
+	// Error is the error querying the member status
+	Error string `json:"error,omitempty"`
+}
+
+// Healthy returns true if the member status has been queried successfully
+func (r MemberStatus) Healthy() bool {
+	return r.Error == ""
+}
+
+// Alarm describes an active etcd alarm, e.g. when a member ran out of space
+type Alarm struct {
+	// MemberID is the ID of the member that raised the alarm
+	MemberID string `json:"member_id"`
+	// Type is the alarm type, e.g. NOSPACE
+	Type string `json:"type"`
+}
+
+// GetStatus returns the status of all etcd members
+func GetStatus(ctx context.Context, client Client) (*Status, error) {
+	members, err := client.MemberList(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var status Status
+	for _, member := range members.Members {
+		memberStatus := MemberStatus{
+			ID:   formatID(member.ID),
+			Name: member.Name,
+		}
+		if len(member.ClientURLs) == 0 {
+			memberStatus.Error = "member has not started"
+			status.Members = append(status.Members, memberStatus)
+			continue
+		}
+		memberStatus.Endpoint = member.ClientURLs[0]
+		resp, err := client.Status(ctx, memberStatus.Endpoint)
+		if err != nil {
+			memberStatus.Error = trace.UserMessage(err)
+			status.Members = append(status.Members, memberStatus)
+			continue
+		}
+		memberStatus.Version = resp.Version
+		memberStatus.DBSize = resp.DbSize
+		memberStatus.Leader = resp.Leader == member.ID
+		if resp.Leader != 0 {
+			status.Leader = formatID(resp.Leader)
+		}
+		if resp.RaftTerm > status.RaftTerm {
+			status.RaftTerm = resp.RaftTerm
+		}
+		status.Members = append(status.Members, memberStatus)
+	}
+	sort.Slice(status.Members, func(i, j int) bool {
+		return status.Members[i].Name < status.Members[j].Name
+	})
+	alarms, err := client.AlarmList(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, alarm := range alarms.Alarms {
+		status.Alarms = append(status.Alarms, Alarm{
+			MemberID: formatID(alarm.MemberID),
+			Type:     alarm.Alarm.String(),
+		})
+	}
+	return &status, nil
+}
+
+// Defragment defragments the etcd members one at a time, the leader last.
+// Defragmentation blocks the member, so the next member is only
+// defragmented after the previous one has become responsive again
+func Defragment(ctx context.Context, client Client, log logrus.FieldLogger) error {
+	status, err := GetStatus(ctx, client)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, member := range status.Members {
+		if !member.Healthy() {
+			return trace.BadParameter("etcd member %v is unhealthy: %v, "+
+				"defragmentation requires all members to be healthy", member.Name, member.Error)
+		}
+	}
+	members := make([]MemberStatus, len(status.Members))
+	copy(members, status.Members)
+	sort.SliceStable(members, func(i, j int) bool {
+		return !members[i].Leader && members[j].Leader
+	})
+	for _, member := range members {
+		log.Infof("Defragmenting etcd member %v (%v).", member.Name, member.Endpoint)
+		if err := defragment(ctx, client, member); err != nil {
+			return trace.Wrap(err, "failed to defragment etcd member %v", member.Name)
+		}
+		resp, err := waitForMember(ctx, client, member.Endpoint)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		log.Infof("Defragmented etcd member %v, database size %v -> %v bytes.",
+			member.Name, member.DBSize, resp.DbSize)
+	}
+	return nil
+}
+
+func defragment(ctx context.Context, client Client, member MemberStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, defaults.EtcdDefragTimeout)
+	defer cancel()
+	_, err := client.Defragment(ctx, member.Endpoint)
+	return trace.Wrap(err)
+}
+
+// waitForMember waits until the member with the specified endpoint
+// responds to status requests
+func waitForMember(ctx context.Context, client Client, endpoint string) (resp *clientv3.StatusResponse, err error) {
+	ctx, cancel := context.WithTimeout(ctx, defaults.EtcdDefragTimeout)
+	defer cancel()
+	for {
+		resp, err = client.Status(ctx, endpoint)
+		if err == nil {
+			return resp, nil
+		}
+		select {
+		case <-time.After(defaults.EtcdRetryInterval):
+		case <-ctx.Done():
+			return nil, trace.Wrap(err, "etcd member %v has not become healthy", endpoint)
+		}
+	}
+}
+
+// formatID formats the etcd member ID the way etcdctl does
+func formatID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
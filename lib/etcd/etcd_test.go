@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/blob/fs"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/pack/localpack"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	"github.com/coreos/etcd/clientv3"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func TestEtcd(t *testing.T) { TestingT(t) }
+
+type EtcdSuite struct {
+	packages pack.PackageService
+}
+
+var _ = Suite(&EtcdSuite{})
+
+func (s *EtcdSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, "bolt.db")})
+	c.Assert(err, IsNil)
+	objects, err := fs.New(dir)
+	c.Assert(err, IsNil)
+	s.packages, err = localpack.New(localpack.Config{
+		Backend:     backend,
+		UnpackedDir: filepath.Join(dir, defaults.UnpackedDir),
+		Objects:     objects,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.packages.UpsertRepository("example.com", time.Time{}), IsNil)
+}
+
+func (s *EtcdSuite) TestStatus(c *C) {
+	client := newTestClient()
+	client.dbSize["https://node-2:2379"] = 2048
+	client.alarms = []*pb.AlarmMember{{MemberID: 2, Alarm: pb.AlarmType_NOSPACE}}
+	delete(client.status, "https://node-3:2379")
+
+	status, err := GetStatus(context.TODO(), client)
+	c.Assert(err, IsNil)
+	c.Assert(status.Leader, Equals, "1")
+	c.Assert(status.RaftTerm, Equals, uint64(5))
+	c.Assert(status.Alarms, DeepEquals, []Alarm{{MemberID: "2", Type: "NOSPACE"}})
+	c.Assert(status.Members, HasLen, 3)
+	c.Assert(status.Members[0].Leader, Equals, true)
+	c.Assert(status.Members[1].DBSize, Equals, int64(2048))
+	c.Assert(status.Members[1].Healthy(), Equals, true)
+	c.Assert(status.Members[2].Healthy(), Equals, false)
+}
+
+func (s *EtcdSuite) TestDefragmentsLeaderLast(c *C) {
+	client := newTestClient()
+
+	err := Defragment(context.TODO(), client, logrus.StandardLogger())
+	c.Assert(err, IsNil)
+	c.Assert(client.defragmented, DeepEquals, []string{
+		"https://node-2:2379",
+		"https://node-3:2379",
+		"https://node-1:2379",
+	})
+}
+
+func (s *EtcdSuite) TestDoesNotDefragmentUnhealthyCluster(c *C) {
+	client := newTestClient()
+	delete(client.status, "https://node-2:2379")
+
+	err := Defragment(context.TODO(), client, logrus.StandardLogger())
+	c.Assert(err, NotNil)
+	c.Assert(client.defragmented, HasLen, 0)
+}
+
+func (s *EtcdSuite) TestSnapshotRetention(c *C) {
+	start := time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		_, err := CreateSnapshot(s.packages, "example.com", start.Add(time.Duration(i)*time.Hour),
+			strings.NewReader("snapshot"), 3)
+		c.Assert(err, IsNil)
+	}
+
+	snapshots, err := GetSnapshots(s.packages, "example.com")
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 3)
+	c.Assert(snapshots[0].Created, Equals, start.Add(3*time.Hour))
+	c.Assert(snapshots[2].Created, Equals, start.Add(time.Hour))
+
+	latest, err := FindSnapshot(s.packages, "example.com", "")
+	c.Assert(err, IsNil)
+	c.Assert(latest.Locator, Equals, SnapshotLocator("example.com", start.Add(3*time.Hour)))
+
+	_, err = FindSnapshot(s.packages, "example.com", SnapshotLocator("example.com", start).Version)
+	c.Assert(trace.IsNotFound(err), Equals, true)
+
+	deleted, err := PruneSnapshots(s.packages, "example.com", 1)
+	c.Assert(err, IsNil)
+	c.Assert(deleted, HasLen, 2)
+}
+
+func newTestClient() *testClient {
+	client := &testClient{
+		members: []*pb.Member{
+			{ID: 1, Name: "node-1", ClientURLs: []string{"https://node-1:2379"}},
+			{ID: 3, Name: "node-3", ClientURLs: []string{"https://node-3:2379"}},
+			{ID: 2, Name: "node-2", ClientURLs: []string{"https://node-2:2379"}},
+		},
+		status: make(map[string]bool),
+		dbSize: make(map[string]int64),
+	}
+	for _, member := range client.members {
+		client.status[member.ClientURLs[0]] = true
+	}
+	return client
+}
+
+type testClient struct {
+	members      []*pb.Member
+	status       map[string]bool
+	dbSize       map[string]int64
+	alarms       []*pb.AlarmMember
+	defragmented []string
+}
+
+func (r *testClient) MemberList(context.Context) (*clientv3.MemberListResponse, error) {
+	return &clientv3.MemberListResponse{Members: r.members}, nil
+}
+
+func (r *testClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	if !r.status[endpoint] {
+		return nil, trace.ConnectionProblem(nil, "%v is unavailable", endpoint)
+	}
+	return &clientv3.StatusResponse{
+		Version:  "3.3.4",
+		DbSize:   r.dbSize[endpoint],
+		Leader:   1,
+		RaftTerm: 5,
+	}, nil
+}
+
+func (r *testClient) Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	r.defragmented = append(r.defragmented, endpoint)
+	return &clientv3.DefragmentResponse{}, nil
+}
+
+func (r *testClient) AlarmList(context.Context) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{Alarms: r.alarms}, nil
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/monitoring"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AlertDBSize is the ID of the alert raised when the etcd database
+	// of any member grows past the threshold
+	AlertDBSize = "etcd-db-size"
+	// AlertLeaderChange is the ID of the alert raised when the etcd
+	// cluster has elected a new leader
+	AlertLeaderChange = "etcd-leader-change"
+	// AlertAlarm is the ID of the alert raised when etcd has active alarms
+	AlertAlarm = "etcd-alarm"
+	// MetricMeasurement is the name of the measurement with the etcd
+	// status the alert resources are evaluated on
+	MetricMeasurement = "etcd_maintenance"
+)
+
+// Runner executes gravity commands on cluster nodes
+type Runner interface {
+	// RunOnMaster executes the gravity command with the specified arguments
+	// on one of the cluster master nodes and returns its output
+	RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error)
+}
+
+// Notifier delivers alerts to the configured alert targets
+type Notifier interface {
+	// NotifyAlert delivers the alert to the configured alert targets
+	NotifyAlert(ops.SiteKey, monitoring.Alert) error
+}
+
+// Alerts manages the cluster alert resources and the metrics they are
+// evaluated on
+type Alerts interface {
+	// GetAlerts returns the cluster alert resources
+	GetAlerts(ops.SiteKey) ([]storage.Alert, error)
+	// UpdateAlert creates or updates the alert resource
+	UpdateAlert(ops.SiteKey, storage.Alert) error
+	// WriteMetric writes the metric to the monitoring database
+	WriteMetric(ops.SiteKey, monitoring.Metric) error
+}
+
+// MaintainerConfig defines the etcd maintainer configuration
+type MaintainerConfig struct {
+	// Runner executes gravity etcd commands on master nodes
+	Runner Runner
+	// Notifier delivers the raised alerts
+	Notifier Notifier
+	// Alerts manages the etcd alert resources
+	Alerts Alerts
+	// Packages is the cluster package service with etcd snapshots
+	Packages pack.PackageService
+	// Cluster identifies the local cluster
+	Cluster ops.SiteKey
+	// CheckInterval is how often the etcd status is checked
+	CheckInterval time.Duration
+	// SnapshotInterval is how often snapshots are taken
+	SnapshotInterval time.Duration
+	// Retention is the number of most recent snapshots to keep
+	Retention int
+	// DefragInterval is how often etcd members are defragmented
+	DefragInterval time.Duration
+	// DBSizeThreshold is the database size in bytes that raises an alert
+	DBSizeThreshold int64
+	// Clock is used to schedule maintenance, can be overridden in tests
+	Clock clockwork.Clock
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+}
+
+func (c *MaintainerConfig) checkAndSetDefaults() error {
+	if c.Runner == nil {
+		return trace.BadParameter("missing Runner")
+	}
+	if c.Notifier == nil {
+		return trace.BadParameter("missing Notifier")
+	}
+	if c.Alerts == nil {
+		return trace.BadParameter("missing Alerts")
+	}
+	if c.Packages == nil {
+		return trace.BadParameter("missing Packages")
+	}
+	if c.Cluster.SiteDomain == "" {
+		return trace.BadParameter("missing Cluster")
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = defaults.EtcdMaintenanceCheckInterval
+	}
+	if c.SnapshotInterval == 0 {
+		c.SnapshotInterval = defaults.EtcdSnapshotInterval
+	}
+	if c.Retention == 0 {
+		c.Retention = defaults.EtcdSnapshotRetention
+	}
+	if c.DefragInterval == 0 {
+		c.DefragInterval = defaults.EtcdDefragInterval
+	}
+	if c.DBSizeThreshold == 0 {
+		c.DBSizeThreshold = defaults.EtcdDBSizeThreshold
+	}
+	if c.Clock == nil {
+		c.Clock = clockwork.NewRealClock()
+	}
+	if c.FieldLogger == nil {
+		c.FieldLogger = logrus.WithField(trace.Component, "etcd")
+	}
+	return nil
+}
+
+// Maintainer takes etcd snapshots and defragments etcd members
+// periodically and raises alerts when the etcd status needs attention
+type Maintainer struct {
+	MaintainerConfig
+	// lastDefrag is the time members were last defragmented
+	lastDefrag time.Time
+	// lastStatus is the etcd status from the previous check
+	lastStatus *Status
+	// raised is the set of IDs of the raised alerts
+	raised map[string]bool
+	// alertsCreated is whether the etcd alert resources have been created
+	alertsCreated bool
+}
+
+// NewMaintainer returns a new etcd maintainer
+func NewMaintainer(config MaintainerConfig) (*Maintainer, error) {
+	if err := config.checkAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Maintainer{
+		MaintainerConfig: config,
+		lastDefrag:       config.Clock.Now(),
+		raised:           make(map[string]bool),
+	}, nil
+}
+
+// Run performs etcd maintenance periodically until the context is canceled
+func (m *Maintainer) Run(ctx context.Context) error {
+	m.Info("Starting etcd maintenance.")
+	ticker := time.NewTicker(m.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Check(); err != nil {
+				m.Errorf("Failed to perform etcd maintenance: %v.", trace.DebugReport(err))
+			}
+		case <-ctx.Done():
+			m.Info("Stopping etcd maintenance.")
+			return nil
+		}
+	}
+}
+
+// Check checks the etcd status and takes a snapshot or defragments
+// the members if either is due
+func (m *Maintainer) Check() error {
+	var errors []error
+	if err := m.checkStatus(); err != nil {
+		errors = append(errors, trace.Wrap(err, "failed to check etcd status"))
+	}
+	if err := m.checkSnapshot(); err != nil {
+		errors = append(errors, trace.Wrap(err, "failed to take etcd snapshot"))
+	}
+	if err := m.checkDefrag(); err != nil {
+		errors = append(errors, trace.Wrap(err, "failed to defragment etcd"))
+	}
+	return trace.NewAggregate(errors...)
+}
+
+func (m *Maintainer) checkStatus() error {
+	out, err := m.Runner.RunOnMaster(m.Cluster, "etcd", "status",
+		fmt.Sprintf("--output=%v", constants.EncodingJSON))
+	if err != nil {
+		return trace.Wrap(err, "%s", out)
+	}
+	var status Status
+	if err := json.Unmarshal(out, &status); err != nil {
+		return trace.Wrap(err)
+	}
+	var errors []error
+	if err := m.createAlerts(); err != nil {
+		errors = append(errors, trace.Wrap(err, "failed to create etcd alerts"))
+	}
+	if err := m.Alerts.WriteMetric(m.Cluster, m.metric(status)); err != nil {
+		errors = append(errors, trace.Wrap(err, "failed to write etcd metrics"))
+	}
+	for _, alert := range m.alerts(status) {
+		if err := m.notify(alert); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	m.lastStatus = &status
+	return trace.NewAggregate(errors...)
+}
+
+// createAlerts creates the alert resources for the etcd database size
+// and leader changes unless they exist. Existing resources are left
+// intact so they can be customized
+func (m *Maintainer) createAlerts() error {
+	if m.alertsCreated {
+		return nil
+	}
+	existing, err := m.Alerts.GetAlerts(m.Cluster)
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	names := make(map[string]bool)
+	for _, alert := range existing {
+		names[alert.GetName()] = true
+	}
+	for _, alert := range m.alertResources() {
+		if names[alert.GetName()] {
+			continue
+		}
+		m.Infof("Creating alert %v.", alert.GetName())
+		if err := m.Alerts.UpdateAlert(m.Cluster, alert); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	m.alertsCreated = true
+	return nil
+}
+
+// alertResources returns the Kapacitor alerts evaluated on the etcd metric
+func (m *Maintainer) alertResources() []storage.Alert {
+	return []storage.Alert{
+		storage.NewAlert(AlertDBSize, storage.AlertSpecV2{
+			Formula: fmt.Sprintf(alertFormula, AlertDBSize,
+				`etcd database size is {{ index .Fields "db_size" }} bytes`,
+				fmt.Sprintf(`"db_size" >= %v`, m.DBSizeThreshold)),
+		}),
+		storage.NewAlert(AlertLeaderChange, storage.AlertSpecV2{
+			Formula: fmt.Sprintf(alertFormula, AlertLeaderChange,
+				`etcd leader changed`, `"leader_changes" > 0`),
+		}),
+	}
+}
+
+// metric returns the metric with the etcd status: the size of the largest
+// member database, whether the leader has changed since the last check and
+// the number of active alarms
+func (m *Maintainer) metric(status Status) monitoring.Metric {
+	var dbSize, leaderChanges int64
+	for _, member := range status.Members {
+		if member.DBSize > dbSize {
+			dbSize = member.DBSize
+		}
+	}
+	if m.leaderChanged(status) {
+		leaderChanges = 1
+	}
+	return monitoring.Metric{
+		Measurement: MetricMeasurement,
+		Tags:        map[string]string{"cluster": m.Cluster.SiteDomain},
+		Fields: map[string]int64{
+			"db_size":        dbSize,
+			"leader_changes": leaderChanges,
+			"alarms":         int64(len(status.Alarms)),
+		},
+		Time: m.Clock.Now(),
+	}
+}
+
+// leaderChanged returns whether a new leader has been elected since the
+// last check. The raft term grows with every election so a leader change
+// is detected even if the same member has been re-elected
+func (m *Maintainer) leaderChanged(status Status) bool {
+	prev := m.lastStatus
+	return prev != nil && prev.Leader != "" && status.Leader != "" &&
+		(prev.Leader != status.Leader || prev.RaftTerm < status.RaftTerm)
+}
+
+// alerts returns the alerts raised or resolved by the status
+func (m *Maintainer) alerts(status Status) (alerts []monitoring.Alert) {
+	now := m.Clock.Now()
+	// update adds the alert with the specified ID if it is raised or
+	// it has been resolved since it was last raised
+	update := func(id string, raised bool, level, message, resolved string) {
+		switch {
+		case raised:
+			alerts = append(alerts, monitoring.Alert{ID: id, Level: level, Message: message, Time: now})
+		case m.raised[id]:
+			alerts = append(alerts, monitoring.Alert{ID: id, Level: monitoring.AlertLevelOK, Message: resolved, Time: now})
+		}
+	}
+
+	var large []string
+	for _, member := range status.Members {
+		if member.DBSize >= m.DBSizeThreshold {
+			large = append(large, fmt.Sprintf("%v (%v)",
+				member.Name, humanize.IBytes(uint64(member.DBSize))))
+		}
+	}
+	update(AlertDBSize, len(large) != 0, monitoring.AlertLevelWarning,
+		fmt.Sprintf("etcd database size exceeds %v on %v",
+			humanize.IBytes(uint64(m.DBSizeThreshold)), strings.Join(large, ", ")),
+		"etcd database size is below the threshold")
+
+	var alarms []string
+	for _, alarm := range status.Alarms {
+		alarms = append(alarms, fmt.Sprintf("%v on member %v", alarm.Type, alarm.MemberID))
+	}
+	update(AlertAlarm, len(alarms) != 0, monitoring.AlertLevelCritical,
+		fmt.Sprintf("etcd has active alarms: %v", strings.Join(alarms, ", ")),
+		"etcd has no active alarms")
+
+	prev := m.lastStatus
+	changed := m.leaderChanged(status)
+	var message string
+	if changed {
+		message = fmt.Sprintf("etcd leader changed from %v to %v, raft term %v -> %v",
+			prev.Leader, status.Leader, prev.RaftTerm, status.RaftTerm)
+	}
+	update(AlertLeaderChange, changed, monitoring.AlertLevelWarning,
+		message, "etcd leader is stable")
+	return alerts
+}
+
+func (m *Maintainer) notify(alert monitoring.Alert) error {
+	m.Infof("%v: %v.", alert.Level, alert.Message)
+	err := m.Notifier.NotifyAlert(m.Cluster, alert)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	m.raised[alert.ID] = !alert.IsResolved()
+	return nil
+}
+
+func (m *Maintainer) checkSnapshot() error {
+	snapshots, err := GetSnapshots(m.Packages, m.Cluster.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(snapshots) != 0 && m.Clock.Now().Sub(snapshots[0].Created) < m.SnapshotInterval {
+		return nil
+	}
+	m.Info("Taking etcd snapshot.")
+	out, err := m.Runner.RunOnMaster(m.Cluster, "etcd", "snapshot",
+		"--retain", strconv.Itoa(m.Retention))
+	if err != nil {
+		return trace.Wrap(err, "%s", out)
+	}
+	return nil
+}
+
+func (m *Maintainer) checkDefrag() error {
+	if m.Clock.Now().Sub(m.lastDefrag) < m.DefragInterval {
+		return nil
+	}
+	m.Info("Defragmenting etcd members.")
+	out, err := m.Runner.RunOnMaster(m.Cluster, "etcd", "defrag")
+	if err != nil {
+		return trace.Wrap(err, "%s", out)
+	}
+	m.lastDefrag = m.Clock.Now()
+	return nil
+}
+
+// alertFormula is the Kapacitor TICKscript of the etcd alerts formatted
+// with the alert ID, message and the warning condition
+const alertFormula = `stream
+  |from()
+    .measurement('` + MetricMeasurement + `')
+  |alert()
+    .id('%v')
+    .message('%v')
+    .warn(lambda: %v)
+    .stateChangesOnly()
+    .email()
+`
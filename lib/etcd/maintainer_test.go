@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/monitoring"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/jonboulle/clockwork"
+	. "gopkg.in/check.v1"
+)
+
+func (s *EtcdSuite) TestRaisesAndResolvesAlerts(c *C) {
+	maintainer, runner, notifier := s.newMaintainer(c)
+
+	runner.status = Status{Leader: "1", RaftTerm: 5, Members: []MemberStatus{
+		{Name: "node-1", DBSize: 100},
+		{Name: "node-2", DBSize: 2000},
+	}}
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(notifier.levels(), DeepEquals, []string{AlertDBSize + ":" + monitoring.AlertLevelWarning})
+	c.Assert(notifier.alerts[0].Message, Matches, ".*node-2.*")
+	c.Assert(notifier.resources, HasLen, 2)
+	c.Assert(notifier.resources[0].GetName(), Equals, AlertDBSize)
+	c.Assert(notifier.resources[0].GetFormula(), Matches, `(?s).*"db_size" >= 1024.*`)
+	c.Assert(notifier.resources[1].GetName(), Equals, AlertLeaderChange)
+
+	runner.status = Status{Leader: "2", RaftTerm: 6,
+		Alarms:  []Alarm{{MemberID: "2", Type: "NOSPACE"}},
+		Members: []MemberStatus{{Name: "node-1", DBSize: 100}, {Name: "node-2", DBSize: 2000}},
+	}
+	notifier.alerts = nil
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(notifier.levels(), DeepEquals, []string{
+		AlertDBSize + ":" + monitoring.AlertLevelWarning,
+		AlertAlarm + ":" + monitoring.AlertLevelCritical,
+		AlertLeaderChange + ":" + monitoring.AlertLevelWarning,
+	})
+	c.Assert(notifier.resources, HasLen, 2)
+	c.Assert(notifier.metrics, HasLen, 2)
+	c.Assert(notifier.metrics[1].Fields, DeepEquals, map[string]int64{
+		"db_size": 2000, "leader_changes": 1, "alarms": 1,
+	})
+
+	runner.status = Status{Leader: "2", RaftTerm: 6, Members: []MemberStatus{
+		{Name: "node-1", DBSize: 100},
+		{Name: "node-2", DBSize: 500},
+	}}
+	notifier.alerts = nil
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(notifier.levels(), DeepEquals, []string{
+		AlertDBSize + ":" + monitoring.AlertLevelOK,
+		AlertAlarm + ":" + monitoring.AlertLevelOK,
+		AlertLeaderChange + ":" + monitoring.AlertLevelOK,
+	})
+
+	notifier.alerts = nil
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(notifier.alerts, HasLen, 0)
+}
+
+func (s *EtcdSuite) TestSchedulesSnapshotsAndDefragmentation(c *C) {
+	maintainer, runner, _ := s.newMaintainer(c)
+	clock := maintainer.Clock.(clockwork.FakeClock)
+
+	// no snapshots yet
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(runner.commands, DeepEquals, []string{"etcd snapshot --retain 3"})
+
+	_, err := CreateSnapshot(s.packages, "example.com", clock.Now(), strings.NewReader("snapshot"), 3)
+	c.Assert(err, IsNil)
+	runner.commands = nil
+	clock.Advance(time.Hour)
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(runner.commands, HasLen, 0)
+
+	clock.Advance(6 * time.Hour)
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(runner.commands, DeepEquals, []string{"etcd snapshot --retain 3"})
+
+	_, err = CreateSnapshot(s.packages, "example.com", clock.Now(), strings.NewReader("snapshot"), 3)
+	c.Assert(err, IsNil)
+	runner.commands = nil
+	clock.Advance(18 * time.Hour)
+	c.Assert(maintainer.Check(), IsNil)
+	c.Assert(runner.commands, DeepEquals, []string{"etcd snapshot --retain 3", "etcd defrag"})
+}
+
+func (s *EtcdSuite) newMaintainer(c *C) (*Maintainer, *testRunner, *testNotifier) {
+	runner := &testRunner{}
+	notifier := &testNotifier{}
+	maintainer, err := NewMaintainer(MaintainerConfig{
+		Runner:           runner,
+		Notifier:         notifier,
+		Alerts:           notifier,
+		Packages:         s.packages,
+		Cluster:          ops.SiteKey{AccountID: defaults.SystemAccountID, SiteDomain: "example.com"},
+		SnapshotInterval: 6 * time.Hour,
+		Retention:        3,
+		DefragInterval:   24 * time.Hour,
+		DBSizeThreshold:  1024,
+		Clock:            clockwork.NewFakeClockAt(time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC)),
+	})
+	c.Assert(err, IsNil)
+	return maintainer, runner, notifier
+}
+
+type testRunner struct {
+	status   Status
+	commands []string
+}
+
+func (r *testRunner) RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error) {
+	if len(args) > 1 && args[1] == "status" {
+		return json.Marshal(r.status)
+	}
+	r.commands = append(r.commands, strings.Join(args, " "))
+	return nil, nil
+}
+
+type testNotifier struct {
+	alerts    []monitoring.Alert
+	resources []storage.Alert
+	metrics   []monitoring.Metric
+}
+
+func (r *testNotifier) GetAlerts(key ops.SiteKey) ([]storage.Alert, error) {
+	return r.resources, nil
+}
+
+func (r *testNotifier) UpdateAlert(key ops.SiteKey, alert storage.Alert) error {
+	r.resources = append(r.resources, alert)
+	return nil
+}
+
+func (r *testNotifier) WriteMetric(key ops.SiteKey, metric monitoring.Metric) error {
+	r.metrics = append(r.metrics, metric)
+	return nil
+}
+
+func (r *testNotifier) NotifyAlert(key ops.SiteKey, alert monitoring.Alert) error {
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func (r *testNotifier) levels() (levels []string) {
+	for _, alert := range r.alerts {
+		levels = append(levels, alert.ID+":"+alert.Level)
+	}
+	return levels
+}
@@ -0,0 +1,534 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+	kubeapi "k8s.io/client-go/kubernetes"
+)
+
+// NewRestorePlan returns the plan that replaces the etcd data on all master
+// nodes with the data from the snapshot.
+//
+// The plan follows the etcd upgrade procedure: etcd is disabled on all
+// masters, then started as the isolated etcd-upgrade service with a fresh
+// data directory that only listens on 127.0.0.2 so neither Kubernetes nor
+// gravity-site can write to it. The snapshot is restored into the isolated
+// cluster from the local master, after that etcd is restarted on the regular
+// address one master at a time and gravity-site is restarted.
+// Rolling back the plan starts etcd with the data it had before the restore.
+//
+// Etcd on regular nodes runs in proxy mode without data so only the masters
+// are part of the plan
+func NewRestorePlan(cluster string, snapshot loc.Locator, local storage.Server, servers []storage.Server) (*storage.OperationPlan, error) {
+	if !local.IsMaster() {
+		return nil, trace.BadParameter("etcd data can only be restored on a master node")
+	}
+	// the local master goes first so etcd is re-enabled on it last
+	// when the plan is rolled back
+	masters := []storage.Server{local}
+	others, _ := fsm.SplitServers(servers)
+	for _, master := range others {
+		if master.AdvertiseIP != local.AdvertiseIP {
+			masters = append(masters, master)
+		}
+	}
+	plan := storage.OperationPlan{
+		OperationID:   RestoreOperationID,
+		OperationType: OperationRestore,
+		AccountID:     defaults.SystemAccountID,
+		ClusterName:   cluster,
+		Servers:       masters,
+	}
+	serverPhases := func(id, description string) (phases []storage.OperationPhase) {
+		for i, master := range masters {
+			master := master
+			phases = append(phases, storage.OperationPhase{
+				ID:          path.Join(id, master.Hostname),
+				Executor:    id,
+				Description: fmt.Sprintf(description, master.Hostname),
+				Data: &storage.OperationPhaseData{
+					Server:     &master,
+					ExecServer: &local,
+					Data:       strconv.FormatBool(i == 0),
+				},
+			})
+		}
+		return phases
+	}
+	restart := serverPhases(restoreRestartPhase, "Restart etcd on node %q")
+	restart = append(restart, storage.OperationPhase{
+		ID:          path.Join(restoreRestartPhase, constants.GravityServiceName),
+		Executor:    restoreGravitySitePhase,
+		Description: fmt.Sprint("Restart ", constants.GravityServiceName, " service"),
+		Data: &storage.OperationPhaseData{
+			Server:     &local,
+			ExecServer: &local,
+		},
+	})
+	plan.Phases = []storage.OperationPhase{
+		{
+			ID:          restoreDownloadPhase,
+			Executor:    restoreDownloadPhase,
+			Description: fmt.Sprintf("Download etcd snapshot %v", snapshot.Version),
+			Data: &storage.OperationPhaseData{
+				Server:     &local,
+				ExecServer: &local,
+				Package:    &snapshot,
+			},
+		},
+		{
+			ID:          restoreShutdownPhase,
+			Description: "Shutdown etcd cluster",
+			Phases:      serverPhases(restoreShutdownPhase, "Shutdown etcd on node %q"),
+			Requires:    []string{restoreDownloadPhase},
+		},
+		{
+			ID:          restoreUpgradePhase,
+			Description: "Start isolated etcd servers with empty data",
+			Phases:      serverPhases(restoreUpgradePhase, "Start isolated etcd on node %q"),
+			Requires:    []string{restoreShutdownPhase},
+		},
+		{
+			ID:          restoreDataPhase,
+			Executor:    restoreDataPhase,
+			Description: fmt.Sprintf("Restore etcd data from snapshot %v", snapshot.Version),
+			Data: &storage.OperationPhaseData{
+				Server:     &local,
+				ExecServer: &local,
+			},
+			Requires: []string{restoreUpgradePhase},
+		},
+		{
+			ID:          restoreRestartPhase,
+			Description: "Restart etcd servers",
+			Phases:      restart,
+			Requires:    []string{restoreDataPhase},
+		},
+	}
+	return &plan, nil
+}
+
+// GetRestorePlan returns the up-to-date etcd restore plan from the
+// backend dedicated to the restore. The backend does not depend on etcd
+// so the plan is available while etcd is down.
+// Returns NotFound if there is no restore plan
+func GetRestorePlan(backend storage.Backend) (*storage.OperationPlan, error) {
+	cluster, err := backend.GetLocalSite(defaults.SystemAccountID)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	plan, err := backend.GetOperationPlan(cluster.Domain, RestoreOperationID)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	changelog, err := backend.GetOperationPlanChangelog(cluster.Domain, RestoreOperationID)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return fsm.ResolvePlan(*plan, changelog), nil
+}
+
+// CreateRestorePlan saves the restore plan in the backend dedicated to
+// the restore replacing the plan of the previous restore, which must have
+// been completed or rolled back
+func CreateRestorePlan(backend storage.Backend, plan storage.OperationPlan) error {
+	previous, err := GetRestorePlan(backend)
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	if previous != nil {
+		if !fsm.IsCompleted(previous) && !fsm.IsRolledBack(previous) {
+			return trace.AlreadyExists("another etcd restore is in progress")
+		}
+		err := backend.DeleteSite(previous.ClusterName)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+	}
+	_, err = backend.CreateSite(storage.Site{
+		AccountID: defaults.SystemAccountID,
+		Domain:    plan.ClusterName,
+		Created:   time.Now().UTC(),
+		Local:     true,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = backend.CreateOperationPlan(plan)
+	return trace.Wrap(err)
+}
+
+// RestoreConfig describes the restore of etcd data from a snapshot
+type RestoreConfig struct {
+	// Backend is the backend dedicated to the restore that persists
+	// the restore plan and the progress of its phases
+	Backend storage.Backend
+	// Agents provides access to the RPC agents running on the master nodes
+	Agents fsm.AgentRepository
+	// Packages is the cluster package service with etcd snapshots
+	Packages pack.PackageService
+	// Client is the Kubernetes client used to restart gravity-site
+	Client *kubeapi.Clientset
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+}
+
+// CheckAndSetDefaults validates the restore configuration
+func (r *RestoreConfig) CheckAndSetDefaults() error {
+	if r.Backend == nil {
+		return trace.BadParameter("missing Backend")
+	}
+	if r.Agents == nil {
+		return trace.BadParameter("missing Agents")
+	}
+	if r.Packages == nil {
+		return trace.BadParameter("missing Packages")
+	}
+	if r.Client == nil {
+		return trace.BadParameter("missing Client")
+	}
+	if r.FieldLogger == nil {
+		r.FieldLogger = logrus.WithField(trace.Component, "etcd")
+	}
+	return nil
+}
+
+// NewRestoreFSM returns a state machine that executes the restore plan
+// saved with CreateRestorePlan.
+//
+// The state of the phases is persisted in the backend so an interrupted
+// restore can be resumed or rolled back
+func NewRestoreFSM(config RestoreConfig) (*fsm.FSM, error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	plan, err := GetRestorePlan(config.Backend)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	engine := &restoreEngine{
+		RestoreConfig: config,
+		cluster:       plan.ClusterName,
+	}
+	machine, err := fsm.New(fsm.Config{
+		Engine: engine,
+		Runner: config.Agents,
+		Logger: config.FieldLogger,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	machine.SetPreExec(engine.updateProgress)
+	return machine, nil
+}
+
+// restoreEngine is the fsm engine for the etcd restore plan
+type restoreEngine struct {
+	RestoreConfig
+	// cluster is the name of the cluster the plan restores etcd data of
+	cluster string
+}
+
+// GetExecutor returns the executor for the specified phase
+func (e *restoreEngine) GetExecutor(params fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+	data := params.Phase.Data
+	if data == nil || data.Server == nil {
+		return nil, trace.BadParameter("phase %q does not specify a server", params.Phase.ID)
+	}
+	server := *data.Server
+	logger := e.WithField(constants.FieldPhase, params.Phase.ID)
+	executor := &restoreExecutor{FieldLogger: logger}
+	switch params.Phase.Executor {
+	case restoreDownloadPhase:
+		if data.Package == nil {
+			return nil, trace.BadParameter("phase %q does not specify a package", params.Phase.ID)
+		}
+		executor.execute = func(context.Context) error {
+			return trace.Wrap(e.download(*data.Package))
+		}
+	case restoreShutdownPhase:
+		executor.execute = func(ctx context.Context) error {
+			return trace.Wrap(e.planet(ctx, logger, server, "etcd", "disable"))
+		}
+		executor.rollback = func(ctx context.Context) error {
+			if err := e.planet(ctx, logger, server, "etcd", "enable"); err != nil {
+				return trace.Wrap(err)
+			}
+			if data.Data == "true" {
+				return trace.Wrap(restartGravitySite(ctx, e.Client, logger))
+			}
+			return nil
+		}
+	case restoreUpgradePhase:
+		executor.execute = func(ctx context.Context) error {
+			return trace.Wrap(e.planetSteps(ctx, logger, server,
+				[]string{"etcd", "upgrade"}, []string{"etcd", "enable", "--upgrade"}))
+		}
+		executor.rollback = func(ctx context.Context) error {
+			return trace.Wrap(e.planetSteps(ctx, logger, server,
+				[]string{"etcd", "disable", "--upgrade"}, []string{"etcd", "rollback"}))
+		}
+	case restoreDataPhase:
+		executor.preCheck = func(ctx context.Context) error {
+			// wait for the isolated etcd to form a cluster
+			out, err := utils.RunCommand(ctx, logger,
+				utils.PlanetCommandArgs(defaults.WaitForEtcdScript, "https://127.0.0.2:2379")...)
+			return trace.Wrap(err, "etcd is not available: %s", out)
+		}
+		executor.execute = func(ctx context.Context) error {
+			return trace.Wrap(e.restore(ctx, logger))
+		}
+	case restoreRestartPhase:
+		executor.execute = func(ctx context.Context) error {
+			return trace.Wrap(e.planetSteps(ctx, logger, server,
+				[]string{"etcd", "disable", "--upgrade"}, []string{"etcd", "enable"}))
+		}
+		executor.rollback = func(ctx context.Context) error {
+			return trace.Wrap(e.planetSteps(ctx, logger, server,
+				[]string{"etcd", "disable"}, []string{"etcd", "enable", "--upgrade"}))
+		}
+	case restoreGravitySitePhase:
+		executor.execute = func(ctx context.Context) error {
+			return trace.Wrap(restartGravitySite(ctx, e.Client, logger))
+		}
+	default:
+		return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+	}
+	return executor, nil
+}
+
+// ChangePhaseState records the phase state change in the backend
+func (e *restoreEngine) ChangePhaseState(ctx context.Context, change fsm.StateChange) error {
+	_, err := e.Backend.CreateOperationPlanChange(storage.PlanChange{
+		ID:          uuid.New(),
+		ClusterName: e.cluster,
+		OperationID: RestoreOperationID,
+		PhaseID:     change.Phase,
+		NewState:    change.State,
+		Error:       utils.ToRawTrace(change.Error),
+		Created:     time.Now().UTC(),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	e.Debugf("Applied %v.", change)
+	return nil
+}
+
+// GetPlan returns the up-to-date restore plan
+func (e *restoreEngine) GetPlan() (*storage.OperationPlan, error) {
+	plan, err := GetRestorePlan(e.Backend)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return plan, nil
+}
+
+// RunCommand is not supported as the restore plan is always executed
+// on the local master, which manages the other masters through their agents
+func (e *restoreEngine) RunCommand(context.Context, fsm.RemoteRunner, storage.Server, fsm.Params) error {
+	return trace.BadParameter("etcd restore phases can only be executed locally")
+}
+
+// Complete removes the downloaded snapshot once the plan has been
+// completed or rolled back
+func (e *restoreEngine) Complete(error) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !fsm.IsCompleted(plan) && !fsm.IsRolledBack(plan) {
+		return nil
+	}
+	path, err := restorePath()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+func (e *restoreEngine) updateProgress(ctx context.Context, params fsm.Params) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	phase, err := fsm.FindPhase(plan, params.PhaseID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	params.Progress.NextStep(phase.Description)
+	return nil
+}
+
+// download saves the snapshot from the cluster package service into the
+// file the restore phase reads it from
+func (e *restoreEngine) download(locator loc.Locator) error {
+	path, err := restorePath()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, reader, err := e.Packages.ReadPackage(locator)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	return trace.Wrap(utils.CopyReaderWithPerms(path, reader, defaults.SharedReadMask))
+}
+
+// restore restores the downloaded snapshot into the isolated etcd cluster
+func (e *restoreEngine) restore(ctx context.Context, logger logrus.FieldLogger) error {
+	path, err := restorePath()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	out, err := utils.RunPlanetCommand(ctx, logger, "etcd", "restore", path)
+	if err != nil {
+		return trace.Wrap(err, "failed to restore etcd data: %s", out)
+	}
+	logger.Info("Restored etcd data.")
+	return nil
+}
+
+// planetSteps runs the planet commands on the server one after another
+func (e *restoreEngine) planetSteps(ctx context.Context, logger logrus.FieldLogger, server storage.Server, steps ...[]string) error {
+	for _, args := range steps {
+		if err := e.planet(ctx, logger, server, args...); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// planet runs the planet command on the server through its RPC agent
+func (e *restoreEngine) planet(ctx context.Context, logger logrus.FieldLogger, server storage.Server, args ...string) error {
+	agent, err := e.Agents.GetClient(ctx, server.AdvertiseIP)
+	if err != nil {
+		return trace.Wrap(err, "failed to connect to the agent on %v", server.Hostname)
+	}
+	var out bytes.Buffer
+	err = agent.Command(ctx, logger, &out,
+		utils.PlanetEnterCommand(append([]string{defaults.PlanetBin}, args...)...)...)
+	if err != nil {
+		return trace.Wrap(err, "failed to run planet %v on %v: %s",
+			strings.Join(args, " "), server.Hostname, out.String())
+	}
+	logger.Infof("Executed planet %v on %v: %s.", strings.Join(args, " "), server.Hostname, out.String())
+	return nil
+}
+
+// restoreExecutor executes a single phase of the restore plan
+type restoreExecutor struct {
+	logrus.FieldLogger
+	execute  func(context.Context) error
+	rollback func(context.Context) error
+	preCheck func(context.Context) error
+}
+
+// PreCheck makes sure the phase can be executed
+func (p *restoreExecutor) PreCheck(ctx context.Context) error {
+	if p.preCheck == nil {
+		return nil
+	}
+	return trace.Wrap(p.preCheck(ctx))
+}
+
+// PostCheck is a no-op
+func (*restoreExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// Execute executes the phase
+func (p *restoreExecutor) Execute(ctx context.Context) error {
+	return trace.Wrap(p.execute(ctx))
+}
+
+// Rollback rolls back the phase if it has changed the etcd state
+func (p *restoreExecutor) Rollback(ctx context.Context) error {
+	if p.rollback == nil {
+		return nil
+	}
+	return trace.Wrap(p.rollback(ctx))
+}
+
+// restartGravitySite deletes the gravity-site pods once etcd is available
+// to force them to restart, as the leader election breaks when etcd is
+// replaced underneath it
+func restartGravitySite(ctx context.Context, client *kubeapi.Clientset, logger logrus.FieldLogger) error {
+	out, err := utils.RunCommand(ctx, logger, utils.PlanetCommandArgs(defaults.WaitForEtcdScript)...)
+	if err != nil {
+		return trace.Wrap(err, "etcd is not available: %s", out)
+	}
+	label := map[string]string{"app": constants.GravityServiceName}
+	logger.Infof("Deleting pods with label %v.", label)
+	return utils.Retry(defaults.RetryInterval, defaults.RetryLessAttempts, func() error {
+		return trace.Wrap(kubernetes.DeletePods(client, constants.KubeSystemNamespace, label))
+	})
+}
+
+// restorePath returns the path of the snapshot file to restore
+// accessible both on host and inside the planet container
+func restorePath() (string, error) {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	dir := state.GravityUpdateDir(stateDir)
+	if err := os.MkdirAll(dir, defaults.SharedDirMask); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%v.restore", defaults.EtcdSnapshotPackage)), nil
+}
+
+const (
+	// OperationRestore is the type of the etcd restore plan
+	OperationRestore = "etcd_restore"
+	// RestoreOperationID identifies the etcd restore plan of the cluster
+	RestoreOperationID = "etcd-restore"
+
+	restoreDownloadPhase    = "/download"
+	restoreShutdownPhase    = "/shutdown"
+	restoreUpgradePhase     = "/upgrade"
+	restoreDataPhase        = "/restore"
+	restoreRestartPhase     = "/restart"
+	restoreGravitySitePhase = "/gravity-site"
+)
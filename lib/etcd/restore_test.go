@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+)
+
+func (s *EtcdSuite) TestRestorePlan(c *C) {
+	plan := s.newRestorePlan(c)
+	c.Assert(plan.Servers, HasLen, 2)
+	c.Assert(plan.Servers[0].Hostname, Equals, "node-2")
+
+	var ids []string
+	for _, phase := range fsm.FlattenPlan(plan) {
+		ids = append(ids, phase.ID)
+		if phase.Data != nil {
+			c.Assert(phase.Data.ExecServer.Hostname, Equals, "node-2", Commentf("phase %v", phase.ID))
+		}
+	}
+	c.Assert(ids, DeepEquals, []string{
+		"/download",
+		"/shutdown", "/shutdown/node-2", "/shutdown/node-1",
+		"/upgrade", "/upgrade/node-2", "/upgrade/node-1",
+		"/restore",
+		"/restart", "/restart/node-2", "/restart/node-1", "/restart/gravity-site",
+	})
+	shutdown, err := fsm.FindPhase(plan, "/shutdown/node-1")
+	c.Assert(err, IsNil)
+	c.Assert(shutdown.Data.Server.Hostname, Equals, "node-1")
+	c.Assert(shutdown.Data.Data, Equals, "false")
+}
+
+func (s *EtcdSuite) TestReplacesFinishedRestorePlan(c *C) {
+	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(c.MkDir(), "bolt.db")})
+	c.Assert(err, IsNil)
+	_, err = GetRestorePlan(backend)
+	c.Assert(trace.IsNotFound(err), Equals, true)
+
+	plan := s.newRestorePlan(c)
+	c.Assert(CreateRestorePlan(backend, *plan), IsNil)
+	// unstarted plan can be replaced
+	c.Assert(CreateRestorePlan(backend, *plan), IsNil)
+
+	created := time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC)
+	changeState := func(phaseID, state string) {
+		created = created.Add(time.Second)
+		_, err := backend.CreateOperationPlanChange(storage.PlanChange{
+			ClusterName: plan.ClusterName,
+			OperationID: plan.OperationID,
+			PhaseID:     phaseID,
+			NewState:    state,
+			Created:     created,
+		})
+		c.Assert(err, IsNil)
+	}
+	changeState("/download", storage.OperationPhaseStateInProgress)
+	err = CreateRestorePlan(backend, *plan)
+	c.Assert(trace.IsAlreadyExists(err), Equals, true, Commentf("%v", err))
+
+	for _, phase := range fsm.FlattenPlan(plan) {
+		if !phase.HasSubphases() {
+			changeState(phase.ID, storage.OperationPhaseStateCompleted)
+		}
+	}
+	stored, err := GetRestorePlan(backend)
+	c.Assert(err, IsNil)
+	c.Assert(fsm.IsCompleted(stored), Equals, true)
+
+	c.Assert(CreateRestorePlan(backend, *plan), IsNil)
+	stored, err = GetRestorePlan(backend)
+	c.Assert(err, IsNil)
+	c.Assert(fsm.IsCompleted(stored), Equals, false)
+}
+
+func (s *EtcdSuite) newRestorePlan(c *C) *storage.OperationPlan {
+	master := string(schema.ServiceRoleMaster)
+	servers := []storage.Server{
+		{Hostname: "node-1", AdvertiseIP: "10.0.0.1", ClusterRole: master},
+		{Hostname: "node-2", AdvertiseIP: "10.0.0.2", ClusterRole: master},
+		{Hostname: "node-3", AdvertiseIP: "10.0.0.3", ClusterRole: string(schema.ServiceRoleNode)},
+	}
+	snapshot := loc.MustParseLocator("example.com/etcd-snapshot:0.0.1")
+	plan, err := NewRestorePlan("example.com", snapshot, servers[1], servers)
+	c.Assert(err, IsNil)
+	return plan
+}
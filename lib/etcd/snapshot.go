@@ -0,0 +1,193 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot describes an etcd snapshot stored in the cluster package service
+type Snapshot struct {
+	// Locator is the snapshot package locator
+	Locator loc.Locator `json:"locator"`
+	// Created is the time the snapshot was taken at
+	Created time.Time `json:"created"`
+	// SizeBytes is the size of the snapshot in bytes
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// SnapshotLocator returns the locator of the snapshot package of the
+// specified cluster taken at the specified time.
+//
+// The package version encodes the snapshot time so snapshots sort
+// by the time they were taken at
+func SnapshotLocator(clusterName string, created time.Time) loc.Locator {
+	return loc.Locator{
+		Repository: clusterName,
+		Name:       defaults.EtcdSnapshotPackage,
+		Version:    fmt.Sprintf("0.0.%v", created.Unix()),
+	}
+}
+
+// SnapshotTime returns the time the snapshot package was taken at
+func SnapshotTime(locator loc.Locator) (time.Time, error) {
+	version, err := locator.SemVer()
+	if err != nil {
+		return time.Time{}, trace.Wrap(err)
+	}
+	return time.Unix(version.Patch, 0).UTC(), nil
+}
+
+// IsSnapshot returns true if the package is an etcd snapshot
+func IsSnapshot(envelope pack.PackageEnvelope) bool {
+	return envelope.Locator.Name == defaults.EtcdSnapshotPackage &&
+		envelope.HasLabel(pack.PurposeLabel, pack.PurposeEtcdSnapshot)
+}
+
+// GetSnapshots returns the etcd snapshots of the specified cluster,
+// the most recent first
+func GetSnapshots(packages pack.PackageService, clusterName string) ([]Snapshot, error) {
+	envelopes, err := packages.GetPackages(clusterName)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	var snapshots []Snapshot
+	for _, envelope := range envelopes {
+		if !IsSnapshot(envelope) {
+			continue
+		}
+		created, err := SnapshotTime(envelope.Locator)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		snapshots = append(snapshots, Snapshot{
+			Locator:   envelope.Locator,
+			Created:   created,
+			SizeBytes: envelope.SizeBytes,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// FindSnapshot returns the snapshot with the specified version or
+// the most recent snapshot if the version is empty
+func FindSnapshot(packages pack.PackageService, clusterName, version string) (*Snapshot, error) {
+	snapshots, err := GetSnapshots(packages, clusterName)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, snapshot := range snapshots {
+		if version == "" || snapshot.Locator.Version == version {
+			return &snapshot, nil
+		}
+	}
+	if version == "" {
+		return nil, trace.NotFound("cluster %v has no etcd snapshots", clusterName)
+	}
+	return nil, trace.NotFound("etcd snapshot %v not found", version)
+}
+
+// CreateSnapshot stores the snapshot read from data as a package in the
+// cluster package service and deletes all but the retain most recent
+// snapshots
+func CreateSnapshot(packages pack.PackageService, clusterName string, created time.Time, data io.Reader, retain int) (*Snapshot, error) {
+	locator := SnapshotLocator(clusterName, created)
+	envelope, err := packages.CreatePackage(locator, data,
+		pack.WithLabels(map[string]string{pack.PurposeLabel: pack.PurposeEtcdSnapshot}),
+		pack.WithHidden(true))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	_, err = PruneSnapshots(packages, clusterName, retain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Snapshot{
+		Locator:   locator,
+		Created:   created.UTC(),
+		SizeBytes: envelope.SizeBytes,
+	}, nil
+}
+
+// PruneSnapshots deletes all but the retain most recent snapshots of
+// the specified cluster and returns the deleted snapshots
+func PruneSnapshots(packages pack.PackageService, clusterName string, retain int) ([]Snapshot, error) {
+	if retain < 1 {
+		return nil, trace.BadParameter("at least one snapshot must be retained")
+	}
+	snapshots, err := GetSnapshots(packages, clusterName)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if len(snapshots) <= retain {
+		return nil, nil
+	}
+	for _, snapshot := range snapshots[retain:] {
+		err := packages.DeletePackage(snapshot.Locator)
+		if err != nil && !trace.IsNotFound(err) {
+			return nil, trace.Wrap(err)
+		}
+	}
+	return snapshots[retain:], nil
+}
+
+// Backup writes the backup of the data of the etcd member running
+// on the local node into a temporary file and returns its path.
+// The caller is responsible for removing the file
+func Backup(ctx context.Context, log logrus.FieldLogger) (path string, err error) {
+	path, err = backupPath()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	out, err := utils.RunPlanetCommand(ctx, log, "etcd", "backup", path)
+	if err != nil {
+		return "", trace.Wrap(err, "failed to backup etcd: %s", out)
+	}
+	return path, nil
+}
+
+// backupPath returns the path of the temporary file with etcd backup
+// accessible both on host and inside the planet container
+func backupPath() (string, error) {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	dir := state.GravityUpdateDir(stateDir)
+	if err := os.MkdirAll(dir, defaults.SharedDirMask); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%v.backup", defaults.EtcdSnapshotPackage)), nil
+}
@@ -91,6 +91,22 @@ func (b *planBuilder) AddBootstrapPhase(plan *storage.OperationPlan) {
 	})
 }
 
+// AddVolumesPhase appends the phase that provisions block devices
+// of the joining node profile to the plan
+func (b *planBuilder) AddVolumesPhase(plan *storage.OperationPlan) {
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID:          installphases.VolumesPhase,
+		Description: "Provision block devices on the joining node",
+		Data: &storage.OperationPhaseData{
+			Server:      &b.JoiningNode,
+			ExecServer:  &b.JoiningNode,
+			Package:     &b.Application.Package,
+			ServiceUser: &b.ServiceUser,
+		},
+		Requires: []string{installphases.BootstrapPhase},
+	})
+}
+
 // AddPullPhase appends package pull phase to the plan
 func (b *planBuilder) AddPullPhase(plan *storage.OperationPlan) {
 	plan.Phases = append(plan.Phases, storage.OperationPhase{
@@ -228,6 +244,20 @@ func (b *planBuilder) AddWaitPhase(plan *storage.OperationPlan) {
 	})
 }
 
+// AddPersistentVolumesPhase appends the phase that creates local persistent
+// volumes for the filesystems provisioned on the joining node to the plan
+func (b *planBuilder) AddPersistentVolumesPhase(plan *storage.OperationPlan) {
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID:          installphases.PersistentVolumesPhase,
+		Description: "Create local persistent volumes for the joining node",
+		Data: &storage.OperationPhaseData{
+			Server:     &b.JoiningNode,
+			ExecServer: &b.JoiningNode,
+		},
+		Requires: []string{installphases.WaitPhase},
+	})
+}
+
 // AddStopAgentPhase appends phase that stops RPC agent on a master node
 func (b *planBuilder) AddStopAgentPhase(plan *storage.OperationPlan) {
 	plan.Phases = append(plan.Phases, storage.OperationPhase{
@@ -42,6 +42,12 @@ func FSMSpec(config FSMConfig) fsm.FSMSpecFunc {
 				config.LocalBackend,
 				remote)
 
+		case strings.HasPrefix(p.Phase.ID, installphases.VolumesPhase):
+			return installphases.NewVolumes(p,
+				config.Operator,
+				config.Apps,
+				remote)
+
 		case strings.HasPrefix(p.Phase.ID, installphases.PullPhase):
 			return installphases.NewPull(p,
 				config.Operator,
@@ -90,6 +96,10 @@ func FSMSpec(config FSMConfig) fsm.FSMSpecFunc {
 				config.Operator,
 				config.DNSConfig)
 
+		case strings.HasPrefix(p.Phase.ID, installphases.PersistentVolumesPhase):
+			return phases.NewPersistentVolumes(p,
+				config.Operator)
+
 		case strings.HasPrefix(p.Phase.ID, PostHookPhase):
 			return installphases.NewHook(p,
 				config.Operator,
@@ -170,7 +170,7 @@ func formatClusterURL(addr string) string {
 	if strings.Contains(addr, "http") {
 		return addr
 	}
-	return fmt.Sprintf("https://%v:%v", addr, defaults.GravitySiteNodePort)
+	return fmt.Sprintf("https://%v", utils.JoinHostPort(addr, defaults.GravitySiteNodePort))
 }
 
 func (p *Peer) dialSite(addr string) (*operationContext, error) {
@@ -49,8 +49,8 @@ func NewEtcd(p fsm.ExecutorParams, operator ops.Operator, runner fsm.AgentReposi
 	}
 	var endpoints []string
 	for _, master := range masters {
-		endpoints = append(endpoints, fmt.Sprintf("https://%v:%v",
-			master.AdvertiseIP, defaults.EtcdAPIPort))
+		endpoints = append(endpoints, fmt.Sprintf("https://%v",
+			utils.JoinHostPort(master.AdvertiseIP, defaults.EtcdAPIPort)))
 	}
 	stateDir, err := state.GetStateDir()
 	if err != nil {
@@ -96,8 +96,8 @@ type etcdExecutor struct {
 // Execute adds the joining node to the cluster's etcd cluster
 func (p *etcdExecutor) Execute(ctx context.Context) error {
 	p.Progress.NextStep("Adding etcd member")
-	member, err := p.Etcd.Add(ctx, fmt.Sprintf("https://%v:%v",
-		p.Phase.Data.Server.AdvertiseIP, defaults.EtcdPeerPort))
+	member, err := p.Etcd.Add(ctx, fmt.Sprintf("https://%v",
+		utils.JoinHostPort(p.Phase.Data.Server.AdvertiseIP, defaults.EtcdPeerPort)))
 	if err != nil {
 		return trace.Wrap(err)
 	}
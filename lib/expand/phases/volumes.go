@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// NewPersistentVolumes returns executor that creates local persistent volumes
+// for the filesystems provisioned on the joining node
+func NewPersistentVolumes(p fsm.ExecutorParams, operator ops.Operator) (fsm.PhaseExecutor, error) {
+	logger := &fsm.Logger{
+		FieldLogger: logrus.WithFields(logrus.Fields{
+			constants.FieldPhase:       p.Phase.ID,
+			constants.FieldAdvertiseIP: p.Phase.Data.Server.AdvertiseIP,
+			constants.FieldHostname:    p.Phase.Data.Server.Hostname,
+		}),
+		Key:      opKey(p.Plan),
+		Operator: operator,
+		Server:   p.Phase.Data.Server,
+	}
+	return &persistentVolumesExecutor{
+		FieldLogger:    logger,
+		ExecutorParams: p,
+		Operator:       operator,
+	}, nil
+}
+
+type persistentVolumesExecutor struct {
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+	// ExecutorParams is common executor params
+	fsm.ExecutorParams
+	// Operator is the cluster operator service
+	Operator ops.Operator
+}
+
+// Execute has the cluster controller create persistent volumes for the joining node.
+// Regular nodes are not allowed to create cluster-scoped resources themselves
+func (p *persistentVolumesExecutor) Execute(ctx context.Context) error {
+	p.Progress.NextStep("Creating local persistent volumes")
+	err := p.Operator.CreatePersistentVolumes(ops.CreatePersistentVolumesRequest{
+		AccountID:  p.Plan.AccountID,
+		SiteDomain: p.Plan.ClusterName,
+		Server:     *p.Phase.Data.Server,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	p.Info("Created local persistent volumes.")
+	return nil
+}
+
+// Rollback is no-op for this phase
+func (*persistentVolumesExecutor) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// PreCheck is no-op for this phase
+func (*persistentVolumesExecutor) PreCheck(ctx context.Context) error {
+	return nil
+}
+
+// PostCheck is no-op for this phase
+func (*persistentVolumesExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
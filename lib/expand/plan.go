@@ -63,6 +63,11 @@ func (p *Peer) getOperationPlan(ctx operationContext) (*storage.OperationPlan, e
 	// bootstrap local state on the joining node
 	builder.AddBootstrapPhase(plan)
 
+	// format and mount block devices of the joining node profile
+	if len(builder.JoiningNode.BlockDevices) != 0 {
+		builder.AddVolumesPhase(plan)
+	}
+
 	// download configured packages to the joining node and unpack them
 	builder.AddPullPhase(plan)
 
@@ -93,6 +98,11 @@ func (p *Peer) getOperationPlan(ctx operationContext) (*storage.OperationPlan, e
 	// wait for the planet to start up and the new Kubernetes node to register
 	builder.AddWaitPhase(plan)
 
+	// expose provisioned filesystems as local persistent volumes
+	if hasPersistentVolumes(builder.Application.Manifest, builder.JoiningNode) {
+		builder.AddPersistentVolumesPhase(plan)
+	}
+
 	// everything has started correctly so if we started a recovery agent
 	// above, we don't need it anymore
 	if builder.JoiningNode.IsMaster() && len(builder.ClusterNodes.Masters()) == 1 {
@@ -112,3 +122,16 @@ func (p *Peer) getOperationPlan(ctx operationContext) (*storage.OperationPlan, e
 	fillSteps(plan)
 	return plan, nil
 }
+
+// hasPersistentVolumes returns true if the profile of the specified server
+// exposes the filesystems provisioned on it as persistent volumes
+func hasPersistentVolumes(manifest schema.Manifest, server storage.Server) bool {
+	if len(server.BlockDevices) == 0 {
+		return false
+	}
+	profile, err := manifest.NodeProfiles.ByName(server.Role)
+	if err != nil {
+		return false
+	}
+	return profile.Requirements.HasPersistentVolumes()
+}
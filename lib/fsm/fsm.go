@@ -44,6 +44,14 @@ type Engine interface {
 	Complete(error) error
 }
 
+// RemoteRollbackEngine is implemented by engines that can roll back
+// phases on remote servers
+type RemoteRollbackEngine interface {
+	// RunRollbackCommand rolls back the phase specified by params on the
+	// specified server using the provided runner
+	RunRollbackCommand(context.Context, RemoteRunner, storage.Server, Params) error
+}
+
 // ExecutorParams combines parameters needed for creating a new executor
 type ExecutorParams struct {
 	// Plan is the operation plan
@@ -95,11 +103,17 @@ type FSM struct {
 	preExecFn PhaseHookFn
 	// postExecFn is called after phase execution if set
 	postExecFn PhaseHookFn
+	// gateFn is called before each top-level phase when executing the plan
+	gateFn PlanGateFn
 }
 
 // PhaseHookFn defines the phase hook function
 type PhaseHookFn func(context.Context, Params) error
 
+// PlanGateFn defines the function that decides whether plan execution
+// may proceed with the specified phase
+type PlanGateFn func(context.Context, storage.OperationPhase) error
+
 // Config represents config
 type Config struct {
 	// Engine is the specific FSM engine
@@ -142,6 +156,11 @@ func (f *FSM) ExecutePlan(ctx context.Context, progress utils.Progress, force bo
 		return trace.Wrap(err)
 	}
 	for _, phase := range plan.Phases {
+		if f.gateFn != nil && !phase.IsCompleted() {
+			if err := f.gateFn(ctx, phase); err != nil {
+				return trace.Wrap(&PausedError{PhaseID: phase.ID, Err: err})
+			}
+		}
 		f.Debugf("Executing phase %q.", phase.ID)
 		err := f.ExecutePhase(ctx, Params{
 			PhaseID:  phase.ID,
@@ -155,6 +174,33 @@ func (f *FSM) ExecutePlan(ctx context.Context, progress utils.Progress, force bo
 	return nil
 }
 
+// ResetInterruptedPhases marks the phases that have been left in progress,
+// for example by a process that has been terminated while executing them,
+// as failed so they can be executed again.
+//
+// Must only be called when the plan is not being executed by anyone else
+func (f *FSM) ResetInterruptedPhases(ctx context.Context) error {
+	plan, err := f.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, phase := range FlattenPlan(plan) {
+		if !phase.IsInProgress() || phase.HasSubphases() {
+			continue
+		}
+		f.Warnf("Phase %q has been interrupted and will be executed again.", phase.ID)
+		err := f.ChangePhaseState(ctx, StateChange{
+			Phase: phase.ID,
+			State: storage.OperationPhaseStateFailed,
+			Error: trace.Wrap(trace.BadParameter("phase %q has been interrupted", phase.ID)),
+		})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
 // ExecutePhase executes the specified phase of the plan
 func (f *FSM) ExecutePhase(ctx context.Context, p Params) error {
 	err := p.CheckAndSetDefaults()
@@ -237,6 +283,10 @@ func (f *FSM) RollbackPhase(ctx context.Context, p Params) error {
 			if err != nil {
 				return trace.Wrap(err)
 			}
+			engine, ok := f.Engine.(RemoteRollbackEngine)
+			if execWhere == CanRunRemotely && ok {
+				return trace.Wrap(f.rollbackPhaseRemotely(ctx, engine, p, *phase, *execServer))
+			}
 			if execWhere != CanRunLocally {
 				return trace.BadParameter("rollback phase %v must be run from server %v", p.PhaseID, execServer.Hostname)
 			}
@@ -259,6 +309,37 @@ func (f *FSM) RollbackPhase(ctx context.Context, p Params) error {
 	return nil
 }
 
+// RollbackPlan rolls back all phases of the plan that have been started,
+// in the reverse order of their requirements, and returns the IDs of the
+// rolled back phases.
+// Rollback stops at the first phase that fails to roll back
+func (f *FSM) RollbackPlan(ctx context.Context, progress utils.Progress, force bool) (rolledBack []string, err error) {
+	plan, err := f.GetPlan()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	phases, err := rollbackOrder(plan)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, phase := range phases {
+		if phase.IsUnstarted() || phase.IsRolledBack() {
+			continue
+		}
+		f.Debugf("Rolling back phase %q.", phase.ID)
+		err := f.RollbackPhase(ctx, Params{
+			PhaseID:  phase.ID,
+			Progress: progress,
+			Force:    force,
+		})
+		if err != nil {
+			return rolledBack, trace.Wrap(err, "failed to rollback phase %q", phase.ID)
+		}
+		rolledBack = append(rolledBack, phase.ID)
+	}
+	return rolledBack, nil
+}
+
 // SetPreExec sets the hook that's called before phase execution
 func (f *FSM) SetPreExec(fn PhaseHookFn) {
 	f.preExecFn = fn
@@ -269,6 +350,13 @@ func (f *FSM) SetPostExec(fn PhaseHookFn) {
 	f.postExecFn = fn
 }
 
+// SetPlanGate sets the function consulted before each top-level phase
+// when executing the entire plan. If it returns an error, plan execution
+// stops with a PausedError and can be resumed later
+func (f *FSM) SetPlanGate(fn PlanGateFn) {
+	f.gateFn = fn
+}
+
 // Close releases all FSM resources
 func (f *FSM) Close() error {
 	return trace.Wrap(f.Runner.Close())
@@ -331,6 +419,22 @@ func (f *FSM) executePhase(ctx context.Context, p Params, phase storage.Operatio
 	return nil
 }
 
+// rollbackPhaseRemotely rolls back the specified operation phase on the specified server
+func (f *FSM) rollbackPhaseRemotely(ctx context.Context, engine RemoteRollbackEngine, p Params, phase storage.OperationPhase, server storage.Server) error {
+	p.Progress.NextStep("Rolling back %q on remote node %v", phase.ID,
+		server.Hostname)
+	err := engine.RunRollbackCommand(ctx, f.Runner, server, p)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	// mark the phase as rolled back in the local database as well since
+	// the changes might not be synchronized back from the remote node
+	return trace.Wrap(f.ChangePhaseState(ctx, StateChange{
+		Phase: phase.ID,
+		State: storage.OperationPhaseStateRolledBack,
+	}))
+}
+
 // executePhaseRemotely executes the specified operation phase on the specified server
 func (f *FSM) executePhaseRemotely(ctx context.Context, p Params, phase storage.OperationPhase, server storage.Server) error {
 	if phase.HasSubphases() {
@@ -543,3 +647,24 @@ func (c StateChange) String() string {
 
 // RootPhase is the name of the top-level phase
 const RootPhase = "/"
+
+// PausedError is returned when the plan gate stops plan execution
+// before a phase
+type PausedError struct {
+	// PhaseID is the phase the execution stopped at
+	PhaseID string
+	// Err is the reason the execution has been paused
+	Err error
+}
+
+// Error returns the error message
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("plan execution paused before phase %q: %v", e.PhaseID, e.Err)
+}
+
+// IsPaused returns true if the error indicates that plan execution
+// has been paused by the plan gate
+func IsPaused(err error) bool {
+	_, ok := trace.Unwrap(err).(*PausedError)
+	return ok
+}
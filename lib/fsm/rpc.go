@@ -198,7 +198,7 @@ const (
 func findLocalServer(servers []storage.Server, localIfaces []storage.NetworkInterface) *storage.Server {
 	for _, iface := range localIfaces {
 		for _, server := range servers {
-			if server.AdvertiseIP == iface.IPv4 {
+			if iface.HasAddr(server.AdvertiseIP) {
 				return &server
 			}
 		}
@@ -78,6 +78,19 @@ func IsFailed(plan *storage.OperationPlan) bool {
 	return true
 }
 
+// IsRolledBack returns true if all leaf phases of the provided plan are either rolled back or unstarted
+func IsRolledBack(plan *storage.OperationPlan) bool {
+	for _, phase := range FlattenPlan(plan) {
+		if phase.HasSubphases() {
+			continue
+		}
+		if !phase.IsRolledBack() && !phase.IsUnstarted() {
+			return false
+		}
+	}
+	return true
+}
+
 // FindPhase finds a phase with the specified id in the provided plan
 func FindPhase(plan *storage.OperationPlan, phaseID string) (*storage.OperationPhase, error) {
 	allPhases := FlattenPlan(plan)
@@ -98,6 +111,79 @@ func FlattenPlan(plan *storage.OperationPlan) []*storage.OperationPhase {
 	return result
 }
 
+// rollbackOrder returns the leaf phases of the plan in the order they should
+// be rolled back: a phase comes after all phases that require it, either directly
+// or through their parent phases. Phases not ordered by requirements are returned
+// in the reverse order of the plan
+func rollbackOrder(plan *storage.OperationPlan) ([]*storage.OperationPhase, error) {
+	allPhases := FlattenPlan(plan)
+	var leaves []*storage.OperationPhase
+	index := make(map[string]int)
+	for _, phase := range allPhases {
+		if !phase.HasSubphases() {
+			index[phase.ID] = len(leaves)
+			leaves = append(leaves, phase)
+		}
+	}
+	// requires maps a leaf phase to the leaf phases it requires
+	requires := make([]map[int]struct{}, len(leaves))
+	// dependents is the number of leaf phases requiring a leaf phase
+	dependents := make([]int, len(leaves))
+	for _, phase := range allPhases {
+		for _, id := range phase.Requires {
+			required, err := FindPhase(plan, id)
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			for _, leaf := range leafPhases(phase) {
+				i := index[leaf.ID]
+				if requires[i] == nil {
+					requires[i] = make(map[int]struct{})
+				}
+				for _, requiredLeaf := range leafPhases(required) {
+					j := index[requiredLeaf.ID]
+					if _, ok := requires[i][j]; ok || i == j {
+						continue
+					}
+					requires[i][j] = struct{}{}
+					dependents[j]++
+				}
+			}
+		}
+	}
+	result := make([]*storage.OperationPhase, 0, len(leaves))
+	done := make([]bool, len(leaves))
+	for len(result) < len(leaves) {
+		next := -1
+		for i := len(leaves) - 1; i >= 0; i-- {
+			if !done[i] && dependents[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, trace.BadParameter("plan has circular phase requirements")
+		}
+		done[next] = true
+		result = append(result, leaves[next])
+		for j := range requires[next] {
+			dependents[j]--
+		}
+	}
+	return result, nil
+}
+
+// leafPhases returns the phase itself if it has no subphases, or all of its leaf subphases
+func leafPhases(phase *storage.OperationPhase) (result []*storage.OperationPhase) {
+	if !phase.HasSubphases() {
+		return []*storage.OperationPhase{phase}
+	}
+	for i := range phase.Phases {
+		result = append(result, leafPhases(&phase.Phases[i])...)
+	}
+	return result
+}
+
 // SplitServers splits the specified server list into servers with master cluster role
 // and regular nodes.
 func SplitServers(servers []storage.Server) (masters, nodes []storage.Server) {
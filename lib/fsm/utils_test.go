@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsm
+
+import (
+	"testing"
+
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"gopkg.in/check.v1"
+)
+
+func TestFSM(t *testing.T) { check.TestingT(t) }
+
+type UtilsSuite struct{}
+
+var _ = check.Suite(&UtilsSuite{})
+
+func (s *UtilsSuite) TestRollbackOrderFollowsRequirements(c *check.C) {
+	plan := &storage.OperationPlan{Phases: []storage.OperationPhase{
+		{ID: "/init"},
+		{ID: "/nodes", Requires: []string{"/masters"}, Phases: []storage.OperationPhase{
+			{ID: "/nodes/node-3"},
+		}},
+		{ID: "/masters", Requires: []string{"/init"}, Phases: []storage.OperationPhase{
+			{ID: "/masters/node-1"},
+			{ID: "/masters/node-2", Requires: []string{"/masters/node-1"}},
+		}},
+		{ID: "/cleanup"},
+	}}
+	phases, err := rollbackOrder(plan)
+	c.Assert(err, check.IsNil)
+	c.Assert(phaseIDs(phases), check.DeepEquals, []string{
+		"/cleanup", "/nodes/node-3", "/masters/node-2", "/masters/node-1", "/init"})
+}
+
+func (s *UtilsSuite) TestRollbackOrderWithoutRequirements(c *check.C) {
+	plan := &storage.OperationPlan{Phases: []storage.OperationPhase{
+		{ID: "/phase1", Phases: []storage.OperationPhase{
+			{ID: "/phase1/sub1"},
+			{ID: "/phase1/sub2"},
+		}},
+		{ID: "/phase2"},
+	}}
+	phases, err := rollbackOrder(plan)
+	c.Assert(err, check.IsNil)
+	c.Assert(phaseIDs(phases), check.DeepEquals, []string{"/phase2", "/phase1/sub2", "/phase1/sub1"})
+}
+
+func (s *UtilsSuite) TestRollbackOrderRejectsCircularRequirements(c *check.C) {
+	plan := &storage.OperationPlan{Phases: []storage.OperationPhase{
+		{ID: "/phase1", Requires: []string{"/phase2"}},
+		{ID: "/phase2", Requires: []string{"/phase1"}},
+	}}
+	_, err := rollbackOrder(plan)
+	c.Assert(trace.IsBadParameter(err), check.Equals, true)
+
+	plan = &storage.OperationPlan{Phases: []storage.OperationPhase{
+		{ID: "/phase1", Requires: []string{"/phase3"}},
+	}}
+	_, err = rollbackOrder(plan)
+	c.Assert(trace.IsNotFound(err), check.Equals, true)
+}
+
+func (s *UtilsSuite) TestIsRolledBack(c *check.C) {
+	plan := &storage.OperationPlan{Phases: []storage.OperationPhase{
+		{ID: "/phase1", State: storage.OperationPhaseStateRolledBack},
+		{ID: "/phase2", Phases: []storage.OperationPhase{
+			{ID: "/phase2/sub1", State: storage.OperationPhaseStateRolledBack},
+			{ID: "/phase2/sub2", State: storage.OperationPhaseStateFailed},
+		}},
+		{ID: "/phase3", State: storage.OperationPhaseStateUnstarted},
+	}}
+	c.Assert(plan.Phases[0].IsRolledBack(), check.Equals, true)
+	c.Assert(IsRolledBack(plan), check.Equals, false)
+
+	plan.Phases[1].Phases[1].State = storage.OperationPhaseStateRolledBack
+	c.Assert(IsRolledBack(plan), check.Equals, true)
+}
+
+func phaseIDs(phases []*storage.OperationPhase) (ids []string) {
+	for _, phase := range phases {
+		ids = append(ids, phase.ID)
+	}
+	return ids
+}
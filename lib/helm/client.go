@@ -46,14 +46,24 @@ type Client struct {
 type ClientConfig struct {
 	// DNSAddress is an optional in-cluster DNS address.
 	DNSAddress string
+	// KubeClient is an optional Kubernetes client to use.
+	//
+	// If unspecified, the client is created based on DNSAddress.
+	KubeClient *kubernetes.Clientset
+	// KubeConfig is the configuration of KubeClient.
+	KubeConfig *rest.Config
 	// TODO Add Helm TLS flags.
 }
 
 // NewClient returns a new Helm client instance.
 func NewClient(conf ClientConfig) (*Client, error) {
-	kubeClient, kubeConfig, err := getKubeClient(conf.DNSAddress)
-	if err != nil {
-		return nil, trace.Wrap(err)
+	kubeClient, kubeConfig := conf.KubeClient, conf.KubeConfig
+	if kubeClient == nil || kubeConfig == nil {
+		var err error
+		kubeClient, kubeConfig, err = getKubeClient(conf.DNSAddress)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
 	}
 	tunnel, err := portforwarder.New("kube-system", kubeClient, kubeConfig)
 	if err != nil {
@@ -80,11 +90,13 @@ type InstallParameters struct {
 	Name string
 	// Namespace is a namespace to install release into.
 	Namespace string
+	// Context is an optional context to render values files with.
+	Context *ValuesContext
 }
 
 // Install installs a Helm chart and returns release information.
 func (c *Client) Install(p InstallParameters) (*Release, error) {
-	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "")
+	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "", p.Context)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -92,6 +104,9 @@ func (c *Client) Install(p InstallParameters) (*Release, error) {
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
+	if err := ValidateValues(chart, rawVals); err != nil {
+		return nil, trace.Wrap(err)
+	}
 	response, err := c.client.InstallReleaseFromChart(
 		chart, p.Namespace,
 		helm.ValueOverrides(rawVals),
@@ -149,18 +164,23 @@ type UpgradeParameters struct {
 	Values []string
 	// Set is a list of values set on the CLI.
 	Set []string
+	// Context is an optional context to render values files with.
+	Context *ValuesContext
 }
 
 // Upgrade upgrades a release.
 func (c *Client) Upgrade(p UpgradeParameters) (*Release, error) {
-	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "")
+	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "", p.Context)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	_, err = chartutil.Load(p.Path)
+	chart, err := chartutil.Load(p.Path)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
+	if err := ValidateValues(chart, rawVals); err != nil {
+		return nil, trace.Wrap(err)
+	}
 	response, err := c.client.UpdateRelease(
 		p.Release, p.Path,
 		helm.UpdateValueOverrides(rawVals))
@@ -42,7 +42,7 @@ type RenderParameters struct {
 
 // RenderHelm renders templates of a provided Helm chart.
 func Render(p RenderParameters) ([]byte, error) {
-	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "")
+	rawVals, err := vals(p.Values, p.Set, nil, nil, "", "", "", nil)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -33,7 +33,10 @@ import (
 // This function was copied from Helm:
 //
 // https://github.com/helm/helm/blob/v2.12.0/cmd/helm/install.go#L363
-func vals(valueFiles valueFiles, values []string, stringValues []string, fileValues []string, CertFile, KeyFile, CAFile string) ([]byte, error) {
+//
+// It has been modified to render values templates (files with the .tpl
+// extension) with the provided context before parsing them.
+func vals(valueFiles valueFiles, values []string, stringValues []string, fileValues []string, CertFile, KeyFile, CAFile string, context *ValuesContext) ([]byte, error) {
 	base := map[string]interface{}{}
 
 	// User specified a values files via -f/--values
@@ -52,6 +55,17 @@ func vals(valueFiles valueFiles, values []string, stringValues []string, fileVal
 			return []byte{}, trace.Wrap(err)
 		}
 
+		if IsValuesTemplate(filePath) {
+			if context == nil {
+				return []byte{}, trace.BadParameter("values template %v references "+
+					"cluster facts which are not available", filePath)
+			}
+			bytes, err = context.render(filePath, bytes)
+			if err != nil {
+				return []byte{}, trace.Wrap(err)
+			}
+		}
+
 		if err := yaml.Unmarshal(bytes, &currentMap); err != nil {
 			return []byte{}, trace.Wrap(err, "failed to parse %s", filePath)
 		}
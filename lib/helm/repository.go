@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/gravitational/trace"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const (
+	// ChartRepository is the package repository charts are uploaded to
+	ChartRepository = "charts"
+	// IndexFileName is the name of the chart repository index file
+	IndexFileName = "index.yaml"
+	// ChartsPath is the path relative to the repository URL
+	// chart archives are served from
+	ChartsPath = "charts"
+	// indexAPIVersion is the version of the chart repository index format
+	indexAPIVersion = "v1"
+	// chartExtension is the file extension of chart archives
+	chartExtension = ".tgz"
+)
+
+// IndexFile is the chart repository index as understood by Helm
+type IndexFile struct {
+	// APIVersion is the index format version
+	APIVersion string `json:"apiVersion"`
+	// Generated is the time the index was generated
+	Generated time.Time `json:"generated"`
+	// Entries maps chart names to all versions of the chart,
+	// newest version first
+	Entries map[string][]*ChartVersion `json:"entries"`
+}
+
+// ChartVersion describes a single version of a chart in the repository
+type ChartVersion struct {
+	// Metadata is the chart metadata from Chart.yaml
+	*chart.Metadata
+	// URLs lists the locations the chart archive can be downloaded from
+	URLs []string `json:"urls"`
+	// Created is the time the chart was uploaded
+	Created time.Time `json:"created,omitempty"`
+	// Digest is the SHA256 digest of the chart archive
+	Digest string `json:"digest,omitempty"`
+}
+
+// Filename returns the name of the chart archive, e.g. nginx-1.0.0.tgz
+func (c ChartVersion) Filename() string {
+	return ChartFilename(c.Name, c.Version)
+}
+
+// ChartFilename returns the name of the archive for the specified chart version
+func ChartFilename(name, version string) string {
+	return fmt.Sprintf("%v-%v%v", name, version, chartExtension)
+}
+
+// ChartLocator returns the locator of the package the chart archive
+// with the specified filename is stored in
+func ChartLocator(repository, filename string) (*loc.Locator, error) {
+	base := strings.TrimSuffix(filename, chartExtension)
+	if base == filename {
+		return nil, trace.BadParameter("%v is not a chart archive", filename)
+	}
+	// chart names may contain dashes, so pick the first dash
+	// followed by a valid version
+	for i := strings.Index(base, "-"); i > 0; i = nextDash(base, i) {
+		if _, err := semver.NewVersion(base[i+1:]); err == nil {
+			return loc.NewLocator(repository, base[:i], base[i+1:])
+		}
+	}
+	return nil, trace.BadParameter("%v is not a valid chart archive name", filename)
+}
+
+func nextDash(s string, i int) int {
+	next := strings.Index(s[i+1:], "-")
+	if next < 0 {
+		return -1
+	}
+	return i + 1 + next
+}
+
+// PushChart validates the chart archive read from reader and stores it in the
+// specified repository of the package service.
+//
+// Charts can only be pushed to the dedicated chart repository.
+// If upsert is set, an existing chart with the same name and version is replaced
+func PushChart(packages pack.PackageService, repository string, reader io.Reader, upsert bool) (*ChartVersion, error) {
+	if repository != ChartRepository {
+		return nil, trace.AccessDenied("charts can only be pushed to the %q repository, not %q",
+			ChartRepository, repository)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	ch, err := chartutil.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, trace.BadParameter("invalid chart archive: %v", err)
+	}
+	if ch.Metadata == nil {
+		return nil, trace.BadParameter("chart archive is missing Chart.yaml")
+	}
+	locator, err := loc.NewLocator(repository, ch.Metadata.Name, ch.Metadata.Version)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	digest := sha256.Sum256(data)
+	version := ChartVersion{
+		Metadata: ch.Metadata,
+		Created:  time.Now().UTC(),
+		Digest:   hex.EncodeToString(digest[:]),
+	}
+	manifest, err := json.Marshal(version)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if _, err := packages.GetRepository(repository); err != nil {
+		if !trace.IsNotFound(err) {
+			return nil, trace.Wrap(err)
+		}
+		if err := packages.UpsertRepository(repository, time.Time{}); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	options := []pack.PackageOption{
+		pack.WithLabels(map[string]string{pack.PurposeLabel: pack.PurposeHelmChart}),
+		pack.WithManifest(pack.PurposeHelmChart, manifest),
+	}
+	envelope, err := packages.ReadPackageEnvelope(*locator)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if envelope != nil && envelope.Type != pack.PurposeHelmChart {
+		return nil, trace.AlreadyExists("package %v already exists and is not a chart", locator)
+	}
+	if upsert {
+		_, err = packages.UpsertPackage(*locator, bytes.NewReader(data), options...)
+	} else {
+		_, err = packages.CreatePackage(*locator, bytes.NewReader(data), options...)
+	}
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &version, nil
+}
+
+// GenerateIndexFile returns the index of all charts in the specified
+// repository of the package service
+func GenerateIndexFile(packages pack.PackageService, repository string) (*IndexFile, error) {
+	envelopes, err := packages.GetPackages(repository)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	index := IndexFile{
+		APIVersion: indexAPIVersion,
+		Generated:  time.Now().UTC(),
+		Entries:    make(map[string][]*ChartVersion),
+	}
+	for _, envelope := range envelopes {
+		if envelope.Type != pack.PurposeHelmChart {
+			continue
+		}
+		var version ChartVersion
+		if err := json.Unmarshal(envelope.Manifest, &version); err != nil {
+			return nil, trace.Wrap(err, "invalid chart metadata in %v", envelope.Locator)
+		}
+		version.URLs = []string{path.Join(ChartsPath, version.Filename())}
+		index.Entries[version.Name] = append(index.Entries[version.Name], &version)
+	}
+	for _, versions := range index.Entries {
+		sort.Slice(versions, func(i, j int) bool {
+			return versionLess(versions[j].Version, versions[i].Version)
+		})
+	}
+	return &index, nil
+}
+
+func versionLess(a, b string) bool {
+	verA, errA := semver.NewVersion(a)
+	verB, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return verA.LessThan(*verB)
+}
+
+// FetchChart returns the archive of the chart specified with locator
+func FetchChart(packages pack.PackageService, locator loc.Locator) (io.ReadCloser, error) {
+	envelope, reader, err := packages.ReadPackage(locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if envelope.Type != pack.PurposeHelmChart {
+		reader.Close()
+		return nil, trace.NotFound("%v is not a chart", locator)
+	}
+	return reader, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/gravitational/trace"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const (
+	// ValuesSchemaFileName is the name of the file with the JSON schema of the
+	// chart values, located in the chart root directory
+	ValuesSchemaFileName = "values.schema.json"
+	// ValuesTemplateExtension is the file extension of values files that are
+	// rendered as templates with the cluster facts, e.g. values.yaml.tpl
+	ValuesTemplateExtension = ".tpl"
+)
+
+// IsValuesTemplate returns true if the values file at path
+// should be rendered as a template
+func IsValuesTemplate(path string) bool {
+	return strings.HasSuffix(path, ValuesTemplateExtension)
+}
+
+// ValuesContext defines the data available to values files as template
+// variables, e.g. {{ .Cluster.Name }}
+type ValuesContext struct {
+	// Cluster describes the cluster the chart is installed into
+	Cluster ClusterFacts
+}
+
+// ClusterFacts describes the cluster a chart is installed into
+type ClusterFacts struct {
+	// Name is the cluster name
+	Name string
+	// RegistryAddress is the address of the cluster docker registry
+	RegistryAddress string
+	// NodeCount is the number of nodes in the cluster
+	NodeCount int
+	// Flavor is the name of the flavor the cluster was installed with
+	Flavor string
+}
+
+// render executes the values file at path as a template with this context
+func (c ValuesContext) render(path string, data []byte) ([]byte, error) {
+	tpl, err := template.New(path).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, trace.BadParameter("failed to parse values file %v: %v", path, err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, c); err != nil {
+		return nil, trace.BadParameter("failed to render values file %v: %v", path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateValues validates the values against the JSON schema shipped
+// with the chart, if any.
+//
+// The values are merged with the chart defaults before validation so the
+// schema applies to the values the chart is actually rendered with
+func ValidateValues(ch *chart.Chart, rawVals []byte) error {
+	schema := valuesSchema(ch)
+	if schema == nil {
+		return nil
+	}
+	values, err := chartutil.CoalesceValues(ch, &chart.Config{Raw: string(rawVals)})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewStringLoader(string(schema)),
+		gojsonschema.NewGoLoader(values.AsMap()))
+	if err != nil {
+		return trace.BadParameter("invalid %v in chart %v: %v",
+			ValuesSchemaFileName, ch.Metadata.Name, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+	var errors []string
+	for _, resultErr := range result.Errors() {
+		errors = append(errors, fmt.Sprintf("  - %v: %v",
+			resultErr.Field(), resultErr.Description()))
+	}
+	return trace.BadParameter("values do not match the schema of chart %v:\n%v",
+		ch.Metadata.Name, strings.Join(errors, "\n"))
+}
+
+// valuesSchema returns the contents of the values schema file of the chart
+// or nil if the chart does not have one
+func valuesSchema(ch *chart.Chart) []byte {
+	for _, file := range ch.Files {
+		if file.TypeUrl == ValuesSchemaFileName {
+			return file.Value
+		}
+	}
+	return nil
+}
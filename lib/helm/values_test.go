@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func TestHelm(t *testing.T) { TestingT(t) }
+
+type ValuesSuite struct{}
+
+var _ = Suite(&ValuesSuite{})
+
+func (s *ValuesSuite) TestRendersValuesTemplates(c *C) {
+	path := filepath.Join(c.MkDir(), "values.yaml.tpl")
+	c.Assert(ioutil.WriteFile(path, []byte(`cluster: {{ .Cluster.Name }}
+image: {{ .Cluster.RegistryAddress }}/nginx:1.9
+replicas: {{ .Cluster.NodeCount }}
+flavor: {{ .Cluster.Flavor }}
+`), 0644), IsNil)
+	context := &ValuesContext{
+		Cluster: ClusterFacts{
+			Name:            "example.com",
+			RegistryAddress: "leader.telekube.local:5000",
+			NodeCount:       3,
+			Flavor:          "ha",
+		},
+	}
+	rawVals, err := vals([]string{path}, []string{"replicas=5"}, nil, nil, "", "", "", context)
+	c.Assert(err, IsNil)
+	c.Assert(string(rawVals), Equals, `cluster: example.com
+flavor: ha
+image: leader.telekube.local:5000/nginx:1.9
+replicas: 5
+`)
+}
+
+func (s *ValuesSuite) TestRejectsUnknownTemplateVariables(c *C) {
+	path := filepath.Join(c.MkDir(), "values.yaml.tpl")
+	c.Assert(ioutil.WriteFile(path, []byte("name: {{ .Cluster.Unknown }}\n"), 0644), IsNil)
+	_, err := vals([]string{path}, nil, nil, nil, "", "", "", &ValuesContext{})
+	c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("%v", err))
+}
+
+func (s *ValuesSuite) TestRejectsValuesTemplatesWithoutContext(c *C) {
+	path := filepath.Join(c.MkDir(), "values.yaml.tpl")
+	c.Assert(ioutil.WriteFile(path, []byte("name: {{ .Cluster.Name }}\n"), 0644), IsNil)
+	_, err := vals([]string{path}, nil, nil, nil, "", "", "", nil)
+	c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("%v", err))
+}
+
+func (s *ValuesSuite) TestKeepsPlainValuesFilesVerbatim(c *C) {
+	path := filepath.Join(c.MkDir(), "values.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(`config: "{{ .Release.Name }}-config"`+"\n"), 0644), IsNil)
+	rawVals, err := vals([]string{path}, nil, nil, nil, "", "", "", &ValuesContext{})
+	c.Assert(err, IsNil)
+	c.Assert(string(rawVals), Equals, "config: '{{ .Release.Name }}-config'\n")
+}
+
+func (s *ValuesSuite) TestValidatesValuesAgainstSchema(c *C) {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Version: "0.0.1"},
+		Values:   &chart.Config{Raw: "replicas: 1\nimage: nginx\n"},
+		Files: []*any.Any{{
+			TypeUrl: ValuesSchemaFileName,
+			Value:   []byte(testSchema),
+		}},
+	}
+	c.Assert(ValidateValues(ch, []byte("replicas: 3\n")), IsNil)
+
+	err := ValidateValues(ch, []byte("replicas: many\n"))
+	c.Assert(trace.IsBadParameter(err), Equals, true)
+	c.Assert(err, ErrorMatches, "(?s)values do not match the schema of chart app:.*replicas: Invalid type.*")
+
+	err = ValidateValues(ch, []byte("image: null\n"))
+	c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("%v", err))
+}
+
+func (s *ValuesSuite) TestSkipsValidationWithoutSchema(c *C) {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Version: "0.0.1"},
+		Values:   &chart.Config{Raw: "replicas: 1\n"},
+	}
+	c.Assert(ValidateValues(ch, []byte("replicas: many\n")), IsNil)
+}
+
+const testSchema = `{
+  "type": "object",
+  "required": ["image"],
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "image": {"type": "string"}
+  }
+}`
@@ -45,7 +45,7 @@ func NewAgent(ctx context.Context, config AgentConfig, log log.FieldLogger, watc
 	// Assume addr to be a complete address if it's prefixed with `http`
 	if !strings.Contains(addr, "http") {
 		host, port := utils.SplitHostPort(addr, strconv.Itoa(defaults.GravitySiteNodePort))
-		addr = fmt.Sprintf("https://%v:%v", host, port)
+		addr = fmt.Sprintf("https://%v", net.JoinHostPort(host, port))
 	}
 
 	httpClient := roundtrip.HTTPClient(httplib.GetClient(true))
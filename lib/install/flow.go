@@ -102,6 +102,10 @@ func (i *Installer) StartInteractiveInstall() error {
 
 // NewClusterRequest constructs a request to create a new cluster
 func (i *Installer) NewClusterRequest() ops.NewSiteRequest {
+	var labels map[string]string
+	if i.Flavor != "" {
+		labels = map[string]string{ops.SiteLabelFlavor: i.Flavor}
+	}
 	return ops.NewSiteRequest{
 		AppPackage:   i.AppPackage.String(),
 		AccountID:    i.AccountID,
@@ -121,6 +125,7 @@ func (i *Installer) NewClusterRequest() ops.NewSiteRequest {
 		DNSOverrides: i.DNSOverrides,
 		DNSConfig:    i.DNSConfig,
 		Docker:       i.Docker,
+		Labels:       labels,
 	}
 }
 
@@ -130,6 +135,12 @@ func (i *Installer) StartCLIInstall() (err error) {
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	if i.Restore != "" {
+		i.PrintStep("Importing cluster backup %v", i.Restore)
+		if err := i.importBackup(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
 	i.flavor, err = i.getFlavor()
 	if err != nil {
 		return trace.Wrap(err)
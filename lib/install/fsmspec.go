@@ -47,6 +47,11 @@ func FSMSpec(config FSMConfig) fsm.FSMSpecFunc {
 				config.Apps,
 				config.LocalBackend, remote)
 
+		case strings.HasPrefix(p.Phase.ID, phases.VolumesPhase):
+			return phases.NewVolumes(p,
+				config.Operator,
+				config.Apps, remote)
+
 		case strings.HasPrefix(p.Phase.ID, phases.PullPhase):
 			return phases.NewPull(p,
 				config.Operator,
@@ -82,6 +87,16 @@ func FSMSpec(config FSMConfig) fsm.FSMSpecFunc {
 				config.LocalApps,
 				client)
 
+		case p.Phase.ID == phases.PersistentVolumesPhase:
+			client, _, err := httplib.GetClusterKubeClient(config.DNSConfig.Addr())
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			return phases.NewPersistentVolumes(p,
+				config.Operator,
+				config.Apps,
+				client)
+
 		case p.Phase.ID == phases.CorednsPhase:
 			client, _, err := httplib.GetClusterKubeClient(config.DNSConfig.Addr())
 			if err != nil {
@@ -106,6 +121,12 @@ func FSMSpec(config FSMConfig) fsm.FSMSpecFunc {
 				config.Operator,
 				config.LocalApps)
 
+		case p.Phase.ID == phases.RestorePhase:
+			return phases.NewRestore(p,
+				config.Operator,
+				config.Packages,
+				config.LocalApps)
+
 		case p.Phase.ID == phases.ConnectInstallerPhase:
 			return phases.NewConnectInstaller(p,
 				config.Operator)
@@ -199,6 +199,8 @@ type Config struct {
 	GCENodeTags []string
 	// NewProcess is used to launch gravity API server process
 	NewProcess process.NewGravityProcess
+	// Restore is the path to the cluster backup to restore the cluster from
+	Restore string
 	// Silent allows installer to output its progress
 	localenv.Silent
 }
@@ -220,6 +222,9 @@ func (c *Config) CheckAndSetDefaults() (err error) {
 	if err := CheckAddr(c.AdvertiseAddr); err != nil {
 		return trace.Wrap(err)
 	}
+	if err := c.checkAndSetSubnets(); err != nil {
+		return trace.Wrap(err)
+	}
 	if err := c.Docker.Check(); err != nil {
 		return trace.Wrap(err)
 	}
@@ -242,6 +247,10 @@ func (c *Config) CheckAndSetDefaults() (err error) {
 	if c.AppPackage == nil {
 		return trace.BadParameter("missing AppPackage")
 	}
+	if c.Restore != "" && c.Mode != constants.InstallModeCLI {
+		return trace.BadParameter("cluster can only be restored from backup in %v install mode",
+			constants.InstallModeCLI)
+	}
 	if c.SiteDomain == "" {
 		rand.Seed(time.Now().UnixNano())
 		c.SiteDomain = fmt.Sprintf(
@@ -469,6 +478,35 @@ func (i *Installer) timeSinceBeginning(key ops.SiteOperationKey) string {
 	return fmt.Sprintf("%v", time.Since(operation.Created))
 }
 
+// checkAndSetSubnets selects the IPv6 pod and service subnets if the node
+// advertises an IPv6 address and the subnets have not been customized, and
+// validates that the subnets can be used with the advertise address.
+// Dual-stack subnets are rejected as the runtime does not support them
+func (c *Config) checkAndSetSubnets() error {
+	if utils.IsIPv6(c.AdvertiseAddr) {
+		if c.PodCIDR == "" || c.PodCIDR == defaults.PodSubnet {
+			c.PodCIDR = defaults.PodSubnetIPv6
+		}
+		if c.ServiceCIDR == "" || c.ServiceCIDR == defaults.ServiceSubnet {
+			c.ServiceCIDR = defaults.ServiceSubnetIPv6
+		}
+	}
+	if err := utils.ValidateKubernetesSubnets(c.PodCIDR, c.ServiceCIDR); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := utils.CheckSingleStack(c.PodCIDR, c.ServiceCIDR); err != nil {
+		return trace.Wrap(err)
+	}
+	for _, cidr := range []string{c.PodCIDR, c.ServiceCIDR} {
+		if cidr != "" && !utils.HasAddrFamily(cidr, c.AdvertiseAddr) {
+			return trace.BadParameter(
+				"subnet %v has no range of the same IP family as the advertise address %v",
+				cidr, c.AdvertiseAddr)
+		}
+	}
+	return nil
+}
+
 func getSystemAccount(operator ops.Operator) (account *ops.Account, err error) {
 	if err = utils.RetryOnNetworkError(defaults.RetryInterval, defaults.RetryAttempts, func() error {
 		account, err = UpsertSystemAccount(operator)
@@ -489,10 +527,10 @@ func CheckAddr(addr string) error {
 	}
 	availableAddrs := make([]string, 0, len(ifaces))
 	for _, iface := range ifaces {
-		if iface.IPv4 == addr {
+		if iface.HasAddr(addr) {
 			return nil
 		}
-		availableAddrs = append(availableAddrs, iface.IPv4)
+		availableAddrs = append(availableAddrs, iface.Addrs()...)
 	}
 	return trace.BadParameter(
 		"%v matches none of the available addresses %v",
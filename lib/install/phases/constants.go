@@ -27,6 +27,8 @@ const (
 	ConfigurePhase = "/configure"
 	// BootstrapPhase is a phase that prepares the nodes for installation
 	BootstrapPhase = "/bootstrap"
+	// VolumesPhase is a phase that provisions block devices of node profiles
+	VolumesPhase = "/volumes"
 	// PullPhase is a phase that pulls configured packages
 	PullPhase = "/pull"
 	// MastersPhase is a phase that installs system software on master nodes
@@ -39,6 +41,9 @@ const (
 	HealthPhase = "/health"
 	// RBACPhase is a phase that creates Kubernetes RBAC resources
 	RBACPhase = "/rbac"
+	// PersistentVolumesPhase is a phase that creates local persistent volumes
+	// for the provisioned filesystems
+	PersistentVolumesPhase = "/persistentVolumes"
 	// CorednsPhase is a phase that generates coredns configuration for the cluster
 	CorednsPhase = "/coredns"
 	// ResourcesPhase is a phase that creates user supplied Kubernetes resources
@@ -49,6 +54,8 @@ const (
 	RuntimePhase = "/runtime"
 	// AppPhase is a phase that installs user application
 	AppPhase = "/app"
+	// RestorePhase is a phase that restores the cluster state from backup
+	RestorePhase = "/restore"
 	// ConnectInstallerPhase is a phase that connects cluster to the installer
 	ConnectInstallerPhase = "/connect-installer"
 	// EnableElectionPhase turns on election participation for master nodes
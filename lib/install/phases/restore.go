@@ -0,0 +1,241 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/backup"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	dockerarchive "github.com/docker/docker/pkg/archive"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// NewRestore returns executor that restores the cluster state from
+// the cluster backup
+func NewRestore(p fsm.ExecutorParams, operator ops.Operator, packages pack.PackageService, apps app.Applications) (*restoreExecutor, error) {
+	err := checkRestoreData(p.Phase.Data)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	bundle, err := loc.ParseLocator(p.Phase.Data.Data)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	logger := &fsm.Logger{
+		FieldLogger: logrus.WithFields(logrus.Fields{
+			constants.FieldPhase: p.Phase.ID,
+		}),
+		Key:      opKey(p.Plan),
+		Operator: operator,
+		Server:   p.Phase.Data.Server,
+	}
+	return &restoreExecutor{
+		FieldLogger:    logger,
+		Operator:       operator,
+		Packages:       packages,
+		Apps:           apps,
+		Bundle:         *bundle,
+		ExecutorParams: p,
+	}, nil
+}
+
+// checkRestoreData makes sure the provided data contains everything needed
+// for the restore phase
+func checkRestoreData(data *storage.OperationPhaseData) error {
+	if data == nil {
+		return trace.BadParameter("phase data is missing")
+	}
+	if data.Server == nil {
+		return trace.BadParameter("phase data is missing server: %#v", data)
+	}
+	if data.Package == nil {
+		return trace.BadParameter("phase data is missing application package: %#v", data)
+	}
+	if data.ServiceUser == nil {
+		return trace.BadParameter("phase data is missing service user: %#v", data)
+	}
+	if data.Data == "" {
+		return trace.BadParameter("phase data is missing backup package: %#v", data)
+	}
+	return nil
+}
+
+type restoreExecutor struct {
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+	// Operator is installer ops service
+	Operator ops.Operator
+	// Packages is the installer package service with the backup package
+	Packages pack.PackageService
+	// Apps is the app service that runs the restore hook
+	Apps app.Applications
+	// Bundle is the locator of the backup package
+	Bundle loc.Locator
+	// ExecutorParams is common executor params
+	fsm.ExecutorParams
+}
+
+// Execute restores the cluster users, auth connectors and packages
+// and runs the application restore hook with the backed up data.
+// Kubernetes objects are not restored since the bundle does not contain
+// the etcd data of the original cluster
+func (p *restoreExecutor) Execute(ctx context.Context) error {
+	p.Progress.NextStep("Restoring cluster from backup")
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	dir, err := ioutil.TempDir(state.GravityUpdateDir(stateDir), "backup")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle, err := p.unpackBundle(dir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	p.Infof("Restoring cluster %v backed up at %v with %v nodes.",
+		bundle.ClusterName, bundle.Created, len(bundle.Servers))
+
+	clusterEnv, err := localenv.NewClusterEnvironment()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer clusterEnv.Backend.Close()
+	p.Progress.NextStep("Restoring users and auth connectors")
+	if err := backup.ImportState(bundle.StatePath(), clusterEnv.Backend); err != nil {
+		return trace.Wrap(err)
+	}
+
+	p.Progress.NextStep("Restoring cluster packages")
+	if err := p.importPackages(bundle); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if !bundle.HasAppBackup {
+		p.Info("Backup does not contain application data.")
+		return nil
+	}
+	return trace.Wrap(p.restoreApp(ctx, bundle))
+}
+
+func (p *restoreExecutor) unpackBundle(dir string) (*backup.Bundle, error) {
+	_, reader, err := p.Packages.ReadPackage(p.Bundle)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer reader.Close()
+	bundle, err := backup.Unpack(reader, dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if bundle.ClusterName != p.Plan.ClusterName {
+		return nil, trace.BadParameter("backup of cluster %v can not be restored as cluster %v",
+			bundle.ClusterName, p.Plan.ClusterName)
+	}
+	return bundle, nil
+}
+
+func (p *restoreExecutor) importPackages(bundle *backup.Bundle) error {
+	clusterPackages, err := localenv.ClusterPackages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	packages, backend, err := bundle.Packages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer backend.Close()
+	return trace.Wrap(backup.ImportPackages(packages, clusterPackages, p.FieldLogger))
+}
+
+// restoreApp runs the application restore hook on this node with
+// the application backup from the bundle
+func (p *restoreExecutor) restoreApp(ctx context.Context, bundle *backup.Bundle) error {
+	locator := *p.Phase.Data.Package
+	req, backupDir, err := backup.HookRequest(locator, *p.Phase.Data.Server)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer os.RemoveAll(backupDir)
+	f, err := os.Open(bundle.AppPath())
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+	if err := dockerarchive.Untar(f, backupDir, archive.DefaultOptions()); err != nil {
+		return trace.Wrap(err)
+	}
+	req.Hook = schema.HookRestore
+	req.ServiceUser = *p.Phase.Data.ServiceUser
+	p.Progress.NextStep("Executing %v hook for %v:%v", req.Hook,
+		locator.Name, locator.Version)
+	p.Infof("Executing %v hook for %v:%v.", req.Hook, locator.Name, locator.Version)
+	reader, writer := io.Pipe()
+	go func() {
+		defer reader.Close()
+		err := p.Operator.StreamOperationLogs(p.Key(), reader)
+		if err != nil && !utils.IsStreamClosedError(err) {
+			logrus.Warnf("Error streaming hook logs: %v.",
+				trace.DebugReport(err))
+		}
+	}()
+	_, err = app.StreamAppHook(ctx, p.Apps, *req, writer)
+	if err != nil {
+		return trace.Wrap(err, "%v %s hook failed", locator, req.Hook)
+	}
+	if err := writer.Close(); err != nil {
+		logrus.Warnf("Failed to close pipe writer: %v.", err)
+	}
+	return nil
+}
+
+// Rollback is no-op for this phase
+func (*restoreExecutor) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// PreCheck makes sure the phase is executed on a master node
+func (p *restoreExecutor) PreCheck(ctx context.Context) error {
+	err := fsm.CheckMasterServer(p.Plan.Servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// PostCheck is no-op for this phase
+func (*restoreExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
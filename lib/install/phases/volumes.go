@@ -0,0 +1,208 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"os"
+
+	"github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/devicemapper"
+	"github.com/gravitational/gravity/lib/fsm"
+	libkubernetes "github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/opsservice"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/systeminfo"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewVolumes returns a new "volumes" phase executor that provisions
+// block devices of the node profile
+func NewVolumes(p fsm.ExecutorParams, operator ops.Operator, apps app.Applications, remote fsm.Remote) (*volumesExecutor, error) {
+	if p.Phase.Data == nil || p.Phase.Data.ServiceUser == nil {
+		return nil, trace.BadParameter("service user is required: %#v", p.Phase.Data)
+	}
+	if p.Phase.Data.Package == nil {
+		return nil, trace.BadParameter("application package is required: %#v", p.Phase.Data)
+	}
+
+	serviceUser, err := userFromOSUser(*p.Phase.Data.ServiceUser)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	application, err := apps.GetApp(*p.Phase.Data.Package)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	profile, err := application.Manifest.NodeProfiles.ByName(p.Phase.Data.Server.Role)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	logger := &fsm.Logger{
+		FieldLogger: logrus.WithFields(logrus.Fields{
+			constants.FieldPhase:       p.Phase.ID,
+			constants.FieldAdvertiseIP: p.Phase.Data.Server.AdvertiseIP,
+			constants.FieldHostname:    p.Phase.Data.Server.Hostname,
+		}),
+		Key:      opKey(p.Plan),
+		Operator: operator,
+		Server:   p.Phase.Data.Server,
+	}
+	return &volumesExecutor{
+		FieldLogger:    logger,
+		ExecutorParams: p,
+		Requirements:   profile.Requirements,
+		ServiceUser:    *serviceUser,
+		remote:         remote,
+	}, nil
+}
+
+type volumesExecutor struct {
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+	// ExecutorParams is common executor params
+	fsm.ExecutorParams
+	// Requirements lists block devices and volume groups of the node profile
+	Requirements schema.Requirements
+	// ServiceUser is the user that owns the provisioned filesystems
+	ServiceUser systeminfo.User
+	// remote specifies the server remote control interface
+	remote fsm.Remote
+}
+
+// Execute formats and mounts the block devices and creates LVM volume groups
+func (p *volumesExecutor) Execute(ctx context.Context) error {
+	p.Progress.NextStep("Provisioning block devices")
+	node := p.Phase.Data.Server
+	p.Infof("Provisioning block devices: %v.", devicemapper.FormatAssignment(node.BlockDevices))
+	err := devicemapper.ProvisionVolumes(devicemapper.VolumesConfig{
+		FieldLogger:  p.FieldLogger,
+		Requirements: p.Requirements,
+		Devices:      node.BlockDevices,
+		UID:          p.ServiceUser.UID,
+		GID:          p.ServiceUser.GID,
+		Out:          os.Stderr,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// Rollback is no-op for this phase
+func (*volumesExecutor) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// PreCheck makes sure this phase is executed on a proper server
+func (p *volumesExecutor) PreCheck(ctx context.Context) error {
+	err := p.remote.CheckServer(ctx, *p.Phase.Data.Server)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// PostCheck is no-op for this phase
+func (*volumesExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
+
+// NewPersistentVolumes returns a new "persistentVolumes" phase executor that creates
+// local persistent volumes for the filesystems provisioned on the node
+func NewPersistentVolumes(p fsm.ExecutorParams, operator ops.Operator, apps app.Applications, client *kubernetes.Clientset) (*persistentVolumesExecutor, error) {
+	if p.Phase.Data == nil || p.Phase.Data.Package == nil {
+		return nil, trace.BadParameter("application package is required: %#v", p.Phase.Data)
+	}
+
+	application, err := apps.GetApp(*p.Phase.Data.Package)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	logger := &fsm.Logger{
+		FieldLogger: logrus.WithFields(logrus.Fields{
+			constants.FieldPhase: p.Phase.ID,
+		}),
+		Key:      opKey(p.Plan),
+		Operator: operator,
+	}
+	return &persistentVolumesExecutor{
+		FieldLogger:    logger,
+		ExecutorParams: p,
+		Manifest:       application.Manifest,
+		Client:         client,
+	}, nil
+}
+
+type persistentVolumesExecutor struct {
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+	// ExecutorParams is common executor params
+	fsm.ExecutorParams
+	// Manifest is the manifest of the application being installed
+	Manifest schema.Manifest
+	// Client is the Kubernetes client
+	Client *kubernetes.Clientset
+}
+
+// Execute creates local persistent volumes
+func (p *persistentVolumesExecutor) Execute(ctx context.Context) error {
+	p.Progress.NextStep("Creating local persistent volumes")
+	for _, server := range p.Plan.Servers {
+		if len(server.BlockDevices) == 0 {
+			continue
+		}
+		persistentVolumes, err := opsservice.GetPersistentVolumes(p.Manifest, server)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if len(persistentVolumes) == 0 {
+			continue
+		}
+		p.Infof("Creating %v persistent volume(-s) for node %v.",
+			len(persistentVolumes), server.Hostname)
+		err = libkubernetes.CreateLocalPersistentVolumes(p.Client, persistentVolumes)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// Rollback is no-op for this phase
+func (*persistentVolumesExecutor) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// PreCheck is no-op for this phase
+func (*persistentVolumesExecutor) PreCheck(ctx context.Context) error {
+	return nil
+}
+
+// PostCheck is no-op for this phase
+func (*persistentVolumesExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
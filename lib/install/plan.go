@@ -17,6 +17,7 @@ limitations under the License.
 package install
 
 import (
+	"github.com/gravitational/gravity/lib/backup"
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/ops"
@@ -85,6 +86,11 @@ func (i *Installer) GetOperationPlan(cluster ops.Site, op ops.SiteOperation) (*s
 	// bootstrap each node: setup directories, users, etc.
 	builder.AddBootstrapPhase(plan)
 
+	// (optional) format and mount block devices, create volume groups
+	if hasBlockDevices(plan.Servers) {
+		builder.AddVolumesPhase(plan)
+	}
+
 	// pull configured packages on each node
 	builder.AddPullPhase(plan)
 
@@ -102,6 +108,11 @@ func (i *Installer) GetOperationPlan(cluster ops.Site, op ops.SiteOperation) (*s
 	builder.AddRBACPhase(plan)
 	builder.AddCorednsPhase(plan)
 
+	// (optional) expose provisioned filesystems as local persistent volumes
+	if hasPersistentVolumes(cluster.App.Manifest, plan.Servers) {
+		builder.AddPersistentVolumesPhase(plan)
+	}
+
 	// if installing a regular app, the resources might have been
 	// provided by a user
 	if len(i.Cluster.Resources) != 0 {
@@ -128,6 +139,12 @@ func (i *Installer) GetOperationPlan(cluster ops.Site, op ops.SiteOperation) (*s
 		return nil, trace.Wrap(err)
 	}
 
+	// restore users, auth connectors, packages and application data
+	// of the backed up cluster
+	if i.Restore != "" {
+		builder.AddRestorePhase(plan, backup.BundleLocator(op.SiteDomain))
+	}
+
 	// establish trust b/w installed cluster and installer process
 	err = builder.AddConnectInstallerPhase(plan)
 	if err != nil {
@@ -139,3 +156,29 @@ func (i *Installer) GetOperationPlan(cluster ops.Site, op ops.SiteOperation) (*s
 
 	return plan, nil
 }
+
+// hasBlockDevices returns true if block devices have been assigned
+// to any of the specified servers
+func hasBlockDevices(servers []storage.Server) bool {
+	for _, server := range servers {
+		if len(server.BlockDevices) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPersistentVolumes returns true if the profile of any of the
+// specified servers exposes its filesystems as persistent volumes
+func hasPersistentVolumes(manifest schema.Manifest, servers []storage.Server) bool {
+	for _, server := range servers {
+		profile, err := manifest.NodeProfiles.ByName(server.Role)
+		if err != nil {
+			continue
+		}
+		if len(server.BlockDevices) != 0 && profile.Requirements.HasPersistentVolumes() {
+			return true
+		}
+	}
+	return false
+}
@@ -125,6 +125,37 @@ func (b *PlanBuilder) AddBootstrapPhase(plan *storage.OperationPlan) {
 	})
 }
 
+// AddVolumesPhase appends the phase that provisions block devices
+// of the node profiles to the provided plan
+func (b *PlanBuilder) AddVolumesPhase(plan *storage.OperationPlan) {
+	var volumePhases []storage.OperationPhase
+	allNodes := append(b.Masters, b.Nodes...)
+	for i, node := range allNodes {
+		if len(node.BlockDevices) == 0 {
+			continue
+		}
+		volumePhases = append(volumePhases, storage.OperationPhase{
+			ID:          fmt.Sprintf("%v/%v", phases.VolumesPhase, node.Hostname),
+			Description: fmt.Sprintf("Provision block devices on node %v", node.Hostname),
+			Data: &storage.OperationPhaseData{
+				Server:      &allNodes[i],
+				ExecServer:  &allNodes[i],
+				Package:     &b.Application.Package,
+				ServiceUser: &b.ServiceUser,
+			},
+			Requires: []string{fmt.Sprintf("%v/%v", phases.BootstrapPhase, node.Hostname)},
+			Step:     3,
+		})
+	}
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID:          phases.VolumesPhase,
+		Description: "Provision block devices",
+		Phases:      volumePhases,
+		Parallel:    true,
+		Step:        3,
+	})
+}
+
 // AddPullPhase appends package download phase to the provided plan
 func (b *PlanBuilder) AddPullPhase(plan *storage.OperationPlan) {
 	var pullPhases []storage.OperationPhase
@@ -307,6 +338,21 @@ func (b *PlanBuilder) AddRBACPhase(plan *storage.OperationPlan) {
 	})
 }
 
+// AddPersistentVolumesPhase appends the phase that creates local
+// persistent volumes for the provisioned filesystems to the provided plan
+func (b *PlanBuilder) AddPersistentVolumesPhase(plan *storage.OperationPlan) {
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID:          phases.PersistentVolumesPhase,
+		Description: "Create local persistent volumes",
+		Data: &storage.OperationPhaseData{
+			Server:  &b.Master,
+			Package: &b.Application.Package,
+		},
+		Requires: []string{phases.RBACPhase},
+		Step:     4,
+	})
+}
+
 // AddInstallOverlayPhase appends a phase to install a non-flannel overlay network
 func (b *PlanBuilder) AddInstallOverlayPhase(plan *storage.OperationPlan, locator *loc.Locator) {
 	plan.Phases = append(plan.Phases, storage.OperationPhase{
@@ -441,6 +487,23 @@ func (b *PlanBuilder) AddApplicationPhase(plan *storage.OperationPlan) error {
 	return nil
 }
 
+// AddRestorePhase appends the phase that restores the cluster state from
+// the backup uploaded as the specified package
+func (b *PlanBuilder) AddRestorePhase(plan *storage.OperationPlan, bundle loc.Locator) {
+	plan.Phases = append(plan.Phases, storage.OperationPhase{
+		ID:          phases.RestorePhase,
+		Description: "Restore cluster state from backup",
+		Data: &storage.OperationPhaseData{
+			Server:      &b.Master,
+			Package:     &b.Application.Package,
+			ServiceUser: &b.ServiceUser,
+			Data:        bundle.String(),
+		},
+		Requires: []string{phases.AppPhase},
+		Step:     7,
+	})
+}
+
 // AddConnectInstallerPhase appends installer/cluster connection phase
 func (b *PlanBuilder) AddConnectInstallerPhase(plan *storage.OperationPlan) error {
 	bytes, err := storage.MarshalTrustedCluster(b.InstallerTrustedCluster)
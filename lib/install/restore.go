@@ -0,0 +1,79 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gravitational/gravity/lib/backup"
+	"github.com/gravitational/gravity/lib/ops/opsservice"
+	"github.com/gravitational/gravity/lib/pack"
+
+	"github.com/gravitational/trace"
+)
+
+// importBackup makes the cluster backup available to the install operation.
+//
+// The certificate authority of the backed up cluster is imported into the
+// installer package service so the cluster is configured with the same
+// identity, and the backup is uploaded as a package for the restore phase
+func (i *Installer) importBackup() error {
+	f, err := os.Open(i.Restore)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+	dir, err := ioutil.TempDir(i.WriteStateDir, "backup")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle, err := backup.Unpack(f, dir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if bundle.ClusterName != i.Cluster.Domain {
+		return trace.BadParameter("backup of cluster %v can not be restored as cluster %v",
+			bundle.ClusterName, i.Cluster.Domain)
+	}
+	packages, backend, err := bundle.Packages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer backend.Close()
+	caPackage, err := opsservice.PlanetCertAuthorityPackage(i.Cluster.Domain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = backup.CopyPackage(packages, i.Packages, *caPackage, i.FieldLogger)
+	if err != nil && !trace.IsAlreadyExists(err) {
+		return trace.Wrap(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	_, err = i.Packages.UpsertPackage(backup.BundleLocator(i.Cluster.Domain), f,
+		pack.WithLabels(map[string]string{pack.PurposeLabel: pack.PurposeClusterBackup}),
+		pack.WithHidden(true))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	i.Infof("Imported backup of cluster %v taken at %v.", bundle.ClusterName, bundle.Created)
+	return nil
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package installconfig implements the install answer file: a single
+// document that captures the complete configuration of a cluster install,
+// including the role and devices of every expected node, so unattended
+// installs can be reproduced with `gravity install --from` and
+// `gravity join --from`
+package installconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	teleutils "github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/trace"
+)
+
+// InstallConfigV2 describes the configuration of a cluster install
+type InstallConfigV2 struct {
+	// Kind is the resource kind, always "installconfig"
+	Kind string `json:"kind"`
+	// Version is the resource version
+	Version string `json:"version"`
+	// Metadata is the resource metadata
+	Metadata teleservices.Metadata `json:"metadata"`
+	// Spec is the install configuration
+	Spec SpecV2 `json:"spec"`
+}
+
+// SpecV2 defines the install configuration
+type SpecV2 struct {
+	// Cluster is the cluster name
+	Cluster string `json:"cluster,omitempty"`
+	// App is the application package to install
+	App string `json:"app,omitempty"`
+	// Flavor is the application flavor to install
+	Flavor string `json:"flavor,omitempty"`
+	// Token is the token used to authorize nodes joining the install
+	Token string `json:"token,omitempty"`
+	// CloudProvider is the cloud provider integration
+	CloudProvider string `json:"cloud_provider,omitempty"`
+	// ResourcesPath is the path to Kubernetes resources to create during install
+	ResourcesPath string `json:"resources_path,omitempty"`
+	// Network is the cluster network configuration
+	Network NetworkV2 `json:"network,omitempty"`
+	// DNS is the cluster DNS configuration
+	DNS DNSV2 `json:"dns,omitempty"`
+	// Docker is the Docker configuration
+	Docker DockerV2 `json:"docker,omitempty"`
+	// ServiceUser is the service user configuration
+	ServiceUser ServiceUserV2 `json:"service_user,omitempty"`
+	// GCENodeTags overrides node tags of the instances on GCE
+	GCENodeTags []string `json:"gce_node_tags,omitempty"`
+	// Nodes lists all nodes expected to take part in the install
+	Nodes []NodeV2 `json:"nodes"`
+}
+
+// NetworkV2 defines the cluster network configuration
+type NetworkV2 struct {
+	// PodCIDR is the pod network subnet
+	PodCIDR string `json:"pod_cidr,omitempty"`
+	// ServiceCIDR is the service network subnet
+	ServiceCIDR string `json:"service_cidr,omitempty"`
+	// VxlanPort is the overlay network port
+	VxlanPort int `json:"vxlan_port,omitempty"`
+}
+
+// DNSV2 defines the cluster DNS configuration
+type DNSV2 struct {
+	// ListenAddrs lists listen addresses for in-cluster DNS
+	ListenAddrs []string `json:"listen_addrs,omitempty"`
+	// Port is the in-cluster DNS port
+	Port int `json:"port,omitempty"`
+	// Hosts maps domain names to IP addresses returned for them within the cluster
+	Hosts map[string]string `json:"hosts,omitempty"`
+	// Zones maps DNS zones to upstream nameservers
+	Zones map[string][]string `json:"zones,omitempty"`
+}
+
+// DockerV2 defines the Docker configuration
+type DockerV2 struct {
+	// StorageDriver is the Docker storage driver
+	StorageDriver string `json:"storage_driver,omitempty"`
+	// Args lists additional Docker arguments
+	Args []string `json:"args,omitempty"`
+}
+
+// ServiceUserV2 defines the service user
+type ServiceUserV2 struct {
+	// UID is the service user ID
+	UID string `json:"uid,omitempty"`
+	// GID is the service group ID
+	GID string `json:"gid,omitempty"`
+}
+
+// NodeV2 defines a single node of the install
+type NodeV2 struct {
+	// AdvertiseAddr is the IP address the node is advertised with
+	AdvertiseAddr string `json:"advertise_addr"`
+	// Role is the node profile
+	Role string `json:"role"`
+	// SystemDevice is the block device for gravity data
+	SystemDevice string `json:"system_device,omitempty"`
+	// DockerDevice is the block device for Docker data
+	DockerDevice string `json:"docker_device,omitempty"`
+	// Mounts maps the application volume names to host paths
+	Mounts map[string]string `json:"mounts,omitempty"`
+}
+
+// CheckAndSetDefaults validates the configuration and sets defaults
+func (c *InstallConfigV2) CheckAndSetDefaults() error {
+	if c.Spec.App != "" {
+		if _, err := loc.ParseLocator(c.Spec.App); err != nil {
+			return trace.Wrap(err, "invalid spec.app, expected a package locator, e.g. gravitational.io/app:1.0.0")
+		}
+	}
+	for _, cidr := range []string{c.Spec.Network.PodCIDR, c.Spec.Network.ServiceCIDR} {
+		if cidr == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return trace.BadParameter("invalid CIDR %q: %v", cidr, err)
+		}
+	}
+	if port := c.Spec.Network.VxlanPort; port < 0 || port > 65535 {
+		return trace.BadParameter("invalid spec.network.vxlan_port: must be in range 1-65535")
+	}
+	if port := c.Spec.DNS.Port; port < 0 || port > 65535 {
+		return trace.BadParameter("invalid spec.dns.port: must be in range 1-65535")
+	}
+	if driver := c.Spec.Docker.StorageDriver; driver != "" &&
+		!utils.StringInSlice(constants.DockerSupportedDrivers, driver) {
+		return trace.BadParameter("unsupported docker storage driver %q, supported are: %v",
+			driver, strings.Join(constants.DockerSupportedDrivers, ", "))
+	}
+	for _, addr := range c.Spec.DNS.ListenAddrs {
+		if net.ParseIP(addr) == nil {
+			return trace.BadParameter("invalid DNS listen address %q", addr)
+		}
+	}
+	for _, host := range c.Spec.DNS.HostOverrides() {
+		if _, _, err := utils.ParseHostOverride(host); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	for _, zone := range c.Spec.DNS.ZoneOverrides() {
+		if _, _, err := utils.ParseZoneOverride(zone); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if len(c.Spec.Nodes) == 0 {
+		return trace.BadParameter("spec.nodes must list at least one node")
+	}
+	addrs := make(map[string]struct{})
+	for _, node := range c.Spec.Nodes {
+		if net.ParseIP(node.AdvertiseAddr) == nil {
+			return trace.BadParameter("invalid advertise address %q", node.AdvertiseAddr)
+		}
+		if _, ok := addrs[node.AdvertiseAddr]; ok {
+			return trace.BadParameter("node %v appears more than once in spec.nodes", node.AdvertiseAddr)
+		}
+		addrs[node.AdvertiseAddr] = struct{}{}
+		if node.Role == "" {
+			return trace.BadParameter("node %v: role is required", node.AdvertiseAddr)
+		}
+	}
+	return nil
+}
+
+// LocalNode returns the node of this configuration the install is run on.
+// If advertiseAddr is specified, the node with this advertise address is
+// returned, otherwise the node is looked up among the addresses of the
+// provided local networks
+func (c *InstallConfigV2) LocalNode(advertiseAddr string, local []net.IPNet) (*NodeV2, error) {
+	for i, node := range c.Spec.Nodes {
+		if advertiseAddr != "" {
+			if node.AdvertiseAddr == advertiseAddr {
+				return &c.Spec.Nodes[i], nil
+			}
+			continue
+		}
+		ip := net.ParseIP(node.AdvertiseAddr)
+		for _, block := range local {
+			if block.IP.Equal(ip) {
+				return &c.Spec.Nodes[i], nil
+			}
+		}
+	}
+	if advertiseAddr != "" {
+		return nil, trace.NotFound("node with advertise address %v is not listed in spec.nodes", advertiseAddr)
+	}
+	return nil, trace.NotFound("none of the nodes in spec.nodes has an address of this host, " +
+		"please set the advertise address via --advertise-addr flag")
+}
+
+// Peers returns the advertise addresses of all nodes other than the specified node
+func (c *InstallConfigV2) Peers(node NodeV2) (peers []string) {
+	for _, peer := range c.Spec.Nodes {
+		if peer.AdvertiseAddr != node.AdvertiseAddr {
+			peers = append(peers, peer.AdvertiseAddr)
+		}
+	}
+	return peers
+}
+
+// HostOverrides returns the DNS host overrides in the <domain>/<ip> format
+func (d DNSV2) HostOverrides() (hosts []string) {
+	domains := make([]string, 0, len(d.Hosts))
+	for domain := range d.Hosts {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		hosts = append(hosts, fmt.Sprintf("%v/%v", domain, d.Hosts[domain]))
+	}
+	return hosts
+}
+
+// ZoneOverrides returns the DNS zone overrides in the <zone>/<nameserver> format
+func (d DNSV2) ZoneOverrides() (zones []string) {
+	names := make([]string, 0, len(d.Zones))
+	for zone := range d.Zones {
+		names = append(names, zone)
+	}
+	sort.Strings(names)
+	for _, zone := range names {
+		for _, nameserver := range d.Zones[zone] {
+			zones = append(zones, fmt.Sprintf("%v/%v", zone, nameserver))
+		}
+	}
+	return zones
+}
+
+// Unmarshal parses the install configuration from JSON or YAML
+func Unmarshal(data []byte) (*InstallConfigV2, error) {
+	if len(data) == 0 {
+		return nil, trace.BadParameter("empty install configuration")
+	}
+	jsonData, err := teleutils.ToJSON(data)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var header teleservices.ResourceHeader
+	if err := json.Unmarshal(jsonData, &header); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if header.Kind != storage.KindInstallConfig {
+		return nil, trace.BadParameter("expected %q resource, got %q",
+			storage.KindInstallConfig, header.Kind)
+	}
+	switch header.Version {
+	case teleservices.V2:
+		var config InstallConfigV2
+		err := teleutils.UnmarshalWithSchema(GetSchema(), &config, jsonData)
+		if err != nil {
+			return nil, trace.BadParameter("%v", err)
+		}
+		config.Metadata.CheckAndSetDefaults()
+		if err := config.CheckAndSetDefaults(); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return &config, nil
+	}
+	return nil, trace.BadParameter("%v resource version %q is not supported",
+		storage.KindInstallConfig, header.Version)
+}
+
+// SpecV2Schema is the JSON schema for the install configuration
+const SpecV2Schema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["nodes"],
+  "properties": {
+    "cluster": {"type": "string"},
+    "app": {"type": "string"},
+    "flavor": {"type": "string"},
+    "token": {"type": "string"},
+    "cloud_provider": {"type": "string"},
+    "resources_path": {"type": "string"},
+    "network": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "pod_cidr": {"type": "string"},
+        "service_cidr": {"type": "string"},
+        "vxlan_port": {"type": "integer"}
+      }
+    },
+    "dns": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "listen_addrs": {"type": "array", "items": {"type": "string"}},
+        "port": {"type": "integer"},
+        "hosts": {"type": "object", "additionalProperties": {"type": "string"}},
+        "zones": {
+          "type": "object",
+          "additionalProperties": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "docker": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "storage_driver": {"type": "string"},
+        "args": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "service_user": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "uid": {"type": "string"},
+        "gid": {"type": "string"}
+      }
+    },
+    "gce_node_tags": {"type": "array", "items": {"type": "string"}},
+    "nodes": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["advertise_addr", "role"],
+        "properties": {
+          "advertise_addr": {"type": "string"},
+          "role": {"type": "string"},
+          "system_device": {"type": "string"},
+          "docker_device": {"type": "string"},
+          "mounts": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`
+
+// GetSchema returns the JSON schema for the install configuration
+func GetSchema() string {
+	return fmt.Sprintf(teleservices.V2SchemaTemplate, teleservices.MetadataSchema,
+		SpecV2Schema, "")
+}
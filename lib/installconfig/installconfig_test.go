@@ -0,0 +1,200 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package installconfig
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gravitational/gravity/lib/schema"
+
+	"github.com/gravitational/trace"
+	. "gopkg.in/check.v1"
+)
+
+func TestInstallConfig(t *testing.T) { TestingT(t) }
+
+type InstallConfigSuite struct {
+	manifest schema.Manifest
+}
+
+var _ = Suite(&InstallConfigSuite{})
+
+func (s *InstallConfigSuite) SetUpTest(c *C) {
+	s.manifest = schema.Manifest{
+		Installer: &schema.Installer{
+			Flavors: schema.Flavors{
+				Default: "one",
+				Items: []schema.Flavor{
+					{Name: "one", Nodes: []schema.FlavorNode{{Profile: "master", Count: 1}}},
+					{Name: "three", Nodes: []schema.FlavorNode{
+						{Profile: "master", Count: 1},
+						{Profile: "worker", Count: 2},
+					}},
+				},
+			},
+		},
+		NodeProfiles: schema.NodeProfiles{
+			{Name: "master"},
+			{Name: "worker", Requirements: schema.Requirements{
+				Volumes: []schema.Volume{{Name: "data", TargetPath: "/data"}},
+			}},
+		},
+	}
+}
+
+const installConfig = `kind: installconfig
+version: v2
+metadata:
+  name: install
+spec:
+  cluster: example.com
+  flavor: three
+  token: secret
+  network:
+    pod_cidr: 10.200.0.0/16
+    vxlan_port: 8999
+  dns:
+    hosts:
+      example.com: 10.0.0.1
+    zones:
+      internal: [10.0.0.2, 10.0.0.3]
+  docker:
+    storage_driver: overlay2
+  nodes:
+  - advertise_addr: 192.168.1.1
+    role: master
+  - advertise_addr: 192.168.1.2
+    role: worker
+    docker_device: /dev/xvdb
+    mounts:
+      data: /var/lib/data
+  - advertise_addr: 192.168.1.3
+    role: worker`
+
+func (s *InstallConfigSuite) TestUnmarshal(c *C) {
+	config, err := Unmarshal([]byte(installConfig))
+	c.Assert(err, IsNil)
+	c.Assert(config.Spec.Cluster, Equals, "example.com")
+	c.Assert(config.Spec.Network.VxlanPort, Equals, 8999)
+	c.Assert(config.Spec.DNS.HostOverrides(), DeepEquals, []string{"example.com/10.0.0.1"})
+	c.Assert(config.Spec.DNS.ZoneOverrides(), DeepEquals, []string{"internal/10.0.0.2", "internal/10.0.0.3"})
+	c.Assert(config.Spec.Nodes, HasLen, 3)
+	c.Assert(config.Spec.Nodes[1], DeepEquals, NodeV2{
+		AdvertiseAddr: "192.168.1.2",
+		Role:          "worker",
+		DockerDevice:  "/dev/xvdb",
+		Mounts:        map[string]string{"data": "/var/lib/data"},
+	})
+}
+
+func (s *InstallConfigSuite) TestUnmarshalRejectsInvalidConfig(c *C) {
+	var testCases = []struct {
+		config  string
+		comment string
+	}{
+		{
+			config:  "kind: clusterspec\nversion: v2\nspec: {}",
+			comment: "wrong kind",
+		},
+		{
+			config:  "kind: installconfig\nversion: v2\nspec: {}",
+			comment: "no nodes",
+		},
+		{
+			config:  "kind: installconfig\nversion: v2\nspec:\n  nodes: [{advertise_addr: 192.168.1.1, role: master, devices: /dev/xvdb}]",
+			comment: "unknown node field",
+		},
+		{
+			config:  "kind: installconfig\nversion: v2\nspec:\n  nodes: [{advertise_addr: node-1, role: master}]",
+			comment: "invalid advertise address",
+		},
+		{
+			config: "kind: installconfig\nversion: v2\nspec:\n  nodes:\n" +
+				"  - {advertise_addr: 192.168.1.1, role: master}\n  - {advertise_addr: 192.168.1.1, role: worker}",
+			comment: "duplicate node",
+		},
+		{
+			config:  "kind: installconfig\nversion: v2\nspec:\n  network: {pod_cidr: 10.200.0.0}\n  nodes: [{advertise_addr: 192.168.1.1, role: master}]",
+			comment: "invalid pod CIDR",
+		},
+		{
+			config:  "kind: installconfig\nversion: v2\nspec:\n  docker: {storage_driver: aufs}\n  nodes: [{advertise_addr: 192.168.1.1, role: master}]",
+			comment: "unsupported storage driver",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := Unmarshal([]byte(tc.config))
+		c.Assert(err, NotNil, Commentf(tc.comment))
+		c.Assert(trace.IsBadParameter(err), Equals, true, Commentf(tc.comment))
+	}
+}
+
+func (s *InstallConfigSuite) TestValidate(c *C) {
+	config, err := Unmarshal([]byte(installConfig))
+	c.Assert(err, IsNil)
+	c.Assert(config.Validate(s.manifest), IsNil)
+
+	config.Spec.Flavor = "one"
+	c.Assert(config.Validate(s.manifest), ErrorMatches, `flavor "one" does not include nodes with role "worker", spec.nodes lists 2`)
+
+	config.Spec.Flavor = "five"
+	c.Assert(config.Validate(s.manifest), ErrorMatches, `unknown flavor "five", the application defines: one, three`)
+
+	config.Spec.Flavor = "three"
+	config.Spec.Nodes[2].Role = "master"
+	c.Assert(config.Validate(s.manifest), ErrorMatches, `flavor "three" requires 1 node\(s\) with role "master", spec.nodes lists 2`)
+
+	config.Spec.Nodes[2].Role = "db"
+	c.Assert(config.Validate(s.manifest), ErrorMatches, `node 192.168.1.3: unknown role "db", the application defines: master, worker`)
+
+	config.Spec.Nodes[2].Role = "master"
+	config.Spec.Nodes[2].Mounts = map[string]string{"data": "/var/lib/data"}
+	c.Assert(config.Validate(s.manifest), ErrorMatches, `node 192.168.1.3: role "master" does not define volume "data"`)
+}
+
+func (s *InstallConfigSuite) TestValidateSetsDefaultFlavor(c *C) {
+	config := InstallConfigV2{Spec: SpecV2{
+		Nodes: []NodeV2{{AdvertiseAddr: "192.168.1.1", Role: "master"}},
+	}}
+	c.Assert(config.Validate(s.manifest), IsNil)
+	c.Assert(config.Spec.Flavor, Equals, "one")
+}
+
+func (s *InstallConfigSuite) TestLocalNode(c *C) {
+	config, err := Unmarshal([]byte(installConfig))
+	c.Assert(err, IsNil)
+
+	node, err := config.LocalNode("192.168.1.3", nil)
+	c.Assert(err, IsNil)
+	c.Assert(node.AdvertiseAddr, Equals, "192.168.1.3")
+
+	_, err = config.LocalNode("192.168.1.4", nil)
+	c.Assert(trace.IsNotFound(err), Equals, true)
+
+	local := []net.IPNet{
+		{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+		{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)},
+	}
+	node, err = config.LocalNode("", local)
+	c.Assert(err, IsNil)
+	c.Assert(node.AdvertiseAddr, Equals, "192.168.1.2")
+	c.Assert(config.Peers(*node), DeepEquals, []string{"192.168.1.1", "192.168.1.3"})
+
+	_, err = config.LocalNode("", local[:1])
+	c.Assert(trace.IsNotFound(err), Equals, true)
+}
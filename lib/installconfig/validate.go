@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package installconfig
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/schema"
+
+	"github.com/gravitational/trace"
+)
+
+// Validate verifies the configuration against the manifest of the application
+// being installed: the flavor has to be defined in the manifest, every node
+// has to have one of the manifest's node profiles with only the volumes this
+// profile defines mounted, and the number of nodes of each profile has to
+// match the flavor.
+// If the configuration does not specify a flavor, the default flavor is set
+func (c *InstallConfigV2) Validate(manifest schema.Manifest) error {
+	for _, node := range c.Spec.Nodes {
+		profile, err := manifest.NodeProfiles.ByName(node.Role)
+		if err != nil {
+			return trace.BadParameter("node %v: unknown role %q, the application defines: %v",
+				node.AdvertiseAddr, node.Role, strings.Join(profileNames(manifest), ", "))
+		}
+		for name := range node.Mounts {
+			if !hasVolume(*profile, name) {
+				return trace.BadParameter("node %v: role %q does not define volume %q",
+					node.AdvertiseAddr, node.Role, name)
+			}
+		}
+	}
+	if c.Spec.Flavor == "" {
+		c.Spec.Flavor = manifest.DefaultFlavor()
+	}
+	if c.Spec.Flavor == "" {
+		return nil
+	}
+	flavor := manifest.FindFlavor(c.Spec.Flavor)
+	if flavor == nil {
+		return trace.BadParameter("unknown flavor %q, the application defines: %v",
+			c.Spec.Flavor, strings.Join(manifest.FlavorNames(), ", "))
+	}
+	counts := make(map[string]int)
+	for _, node := range c.Spec.Nodes {
+		counts[node.Role]++
+	}
+	for _, flavorNode := range flavor.Nodes {
+		if counts[flavorNode.Profile] != flavorNode.Count {
+			return trace.BadParameter("flavor %q requires %v node(s) with role %q, spec.nodes lists %v",
+				flavor.Name, flavorNode.Count, flavorNode.Profile, counts[flavorNode.Profile])
+		}
+		delete(counts, flavorNode.Profile)
+	}
+	roles := make([]string, 0, len(counts))
+	for role := range counts {
+		roles = append(roles, role)
+	}
+	if len(roles) != 0 {
+		sort.Strings(roles)
+		return trace.BadParameter("flavor %q does not include nodes with role %q, spec.nodes lists %v",
+			flavor.Name, roles[0], counts[roles[0]])
+	}
+	return nil
+}
+
+func profileNames(manifest schema.Manifest) (names []string) {
+	for _, profile := range manifest.NodeProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+func hasVolume(profile schema.NodeProfile, name string) bool {
+	for _, volume := range profile.Requirements.Volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
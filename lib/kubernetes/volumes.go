@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CreateLocalPersistentVolumes creates the specified local persistent volumes
+// and their storage classes.
+//
+// Volumes and storage classes that already exist are left intact
+func CreateLocalPersistentVolumes(client kubernetes.Interface, volumes []v1.PersistentVolume) error {
+	storageClasses := make(map[string]bool)
+	for _, volume := range volumes {
+		if volume.Spec.StorageClassName != "" && !storageClasses[volume.Spec.StorageClassName] {
+			err := createLocalStorageClass(client, volume.Spec.StorageClassName)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			storageClasses[volume.Spec.StorageClassName] = true
+		}
+		_, err := client.CoreV1().PersistentVolumes().Create(&volume)
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsAlreadyExists(err) {
+			return trace.Wrap(err)
+		}
+		if err != nil {
+			log.Infof("Persistent volume %v already exists.", volume.Name)
+			continue
+		}
+		log.Infof("Created persistent volume %v.", volume.Name)
+	}
+	return nil
+}
+
+// createLocalStorageClass creates the storage class for statically provisioned
+// local volumes unless it already exists.
+//
+// Binding of the claims is delayed until a pod is scheduled so that the
+// scheduler takes the node affinity of the volumes into account
+func createLocalStorageClass(client kubernetes.Interface, name string) error {
+	bindingMode := storagev1.VolumeBindingWaitForFirstConsumer
+	_, err := client.StorageV1().StorageClasses().Create(&storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Provisioner:       localVolumeProvisioner,
+		VolumeBindingMode: &bindingMode,
+	})
+	err = rigging.ConvertError(err)
+	if err != nil && !trace.IsAlreadyExists(err) {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// localVolumeProvisioner is the provisioner of storage classes for
+// statically provisioned volumes
+const localVolumeProvisioner = "kubernetes.io/no-provisioner"
@@ -18,6 +18,7 @@ package localenv
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -147,7 +148,7 @@ func (w *RemoteEnvironment) LoginWizard(addr string) (entry *storage.LoginEntry,
 	} else {
 		host, port = utils.SplitHostPort(addr, wizardPort)
 	}
-	url := fmt.Sprintf("https://%v:%v", host, port)
+	url := fmt.Sprintf("https://%v", net.JoinHostPort(host, port))
 	w.Debugf("Logging into wizard: %v.", url)
 	err = w.clearWizardEntry()
 	if err != nil {
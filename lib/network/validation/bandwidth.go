@@ -17,7 +17,6 @@ limitations under the License.
 package validation
 
 import (
-	"fmt"
 	"io"
 	"net"
 	"os"
@@ -49,7 +48,7 @@ func (r *Server) CheckBandwidth(ctx context.Context, req *pb.CheckBandwidthReque
 		remoteIPs = append(remoteIPs, ping.Addr)
 	}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf("%v:%v", req.Listen.Addr, defaults.BandwidthTestPort))
+	listener, err := net.Listen("tcp", utils.JoinHostPort(req.Listen.Addr, defaults.BandwidthTestPort))
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -139,7 +138,7 @@ func serve(listener net.Listener, deadline time.Time, w *utils.BandwidthWriter)
 func startSendingData(server string, deadline time.Time, w *utils.BandwidthWriter) error {
 	var conn net.Conn
 	var err error
-	addr := fmt.Sprintf("%v:%v", server, defaults.BandwidthTestPort)
+	addr := utils.JoinHostPort(server, defaults.BandwidthTestPort)
 	// try connecting to remote servers a few times
 	// as they may still be starting up
 	err = utils.Retry(time.Second, 4, func() error {
@@ -17,10 +17,15 @@ limitations under the License.
 package validation
 
 import (
+	"context"
+	"net"
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/gravitational/gravity/lib/defaults"
 	pb "github.com/gravitational/gravity/lib/network/validation/proto"
+	"github.com/gravitational/gravity/lib/utils"
 
 	"gopkg.in/check.v1"
 )
@@ -61,6 +66,83 @@ func (r *ValidationSuite) TestComputesDiff(c *check.C) {
 	}
 }
 
+func (r *ValidationSuite) TestPingPongIPv4(c *check.C) {
+	testPingPong(c, "127.0.0.1")
+}
+
+func (r *ValidationSuite) TestPingPongIPv6(c *check.C) {
+	if !hasIPv6Loopback() {
+		c.Skip("IPv6 loopback is not available")
+	}
+	testPingPong(c, "::1")
+}
+
+func testPingPong(c *check.C, host string) {
+	const duration = 2 * time.Second
+	for _, network := range []string{"tcp", "udp"} {
+		addr := net.JoinHostPort(host, "0")
+		// pick a free port first as the listeners do not report the port they bind to
+		addr = freeAddr(c, network, addr)
+		ctx, cancel := context.WithCancel(context.TODO())
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- listen(ctx, pb.Addr{Network: network, Addr: addr}, duration)
+		}()
+		err := retryPing(pb.Addr{Network: network, Addr: addr}, duration)
+		c.Assert(err, check.IsNil, check.Commentf("%v %v", network, addr))
+		cancel()
+		c.Assert(<-errCh, check.IsNil)
+	}
+}
+
+func (r *ValidationSuite) TestBandwidth(c *check.C) {
+	hosts := []string{"127.0.0.1"}
+	if hasIPv6Loopback() {
+		hosts = append(hosts, "::1")
+	}
+	for _, host := range hosts {
+		listener, err := net.Listen("tcp", utils.JoinHostPort(host, defaults.BandwidthTestPort))
+		c.Assert(err, check.IsNil)
+		bandwidth, err := checkBandwidth(listener, []string{host}, 1500*time.Millisecond)
+		listener.Close()
+		c.Assert(err, check.IsNil, check.Commentf(host))
+		c.Assert(bandwidth > 0, check.Equals, true, check.Commentf(host))
+	}
+}
+
+// retryPing pings the specified server while it is starting up
+func retryPing(server pb.Addr, duration time.Duration) (err error) {
+	for i := 0; i < 10; i++ {
+		if err = ping(server, duration); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
+
+func freeAddr(c *check.C, network, addr string) string {
+	if network == "tcp" {
+		listener, err := net.Listen(network, addr)
+		c.Assert(err, check.IsNil)
+		defer listener.Close()
+		return listener.Addr().String()
+	}
+	conn, err := net.ListenPacket(network, addr)
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func hasIPv6Loopback() bool {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
 func sorted(servers []*pb.Addr) []*pb.Addr {
 	sort.Sort(byIPPort(servers))
 	return servers
@@ -53,6 +53,7 @@ func CheckServers(ctx context.Context, opKey SiteOperationKey,
 	}
 	c.TestBandwidth = true
 	c.TestDockerDevice = true
+	c.TestBlockDevices = true
 	return trace.Wrap(c.Run(ctx))
 }
 
@@ -116,10 +117,11 @@ func requirementsFromManifest(manifest schema.Manifest) (map[string]checks.Requi
 			return nil, trace.Wrap(err)
 		}
 		req := checks.Requirements{
-			CPU:     &manifest.NodeProfiles[i].Requirements.CPU,
-			RAM:     &manifest.NodeProfiles[i].Requirements.RAM,
-			OS:      profile.Requirements.OS,
-			Volumes: profile.Requirements.Volumes,
+			CPU:          &manifest.NodeProfiles[i].Requirements.CPU,
+			RAM:          &manifest.NodeProfiles[i].Requirements.RAM,
+			OS:           profile.Requirements.OS,
+			Volumes:      profile.Requirements.Volumes,
+			BlockDevices: profile.Requirements.BlockDevices,
 			Network: checks.Network{
 				MinTransferRate: profile.Requirements.Network.MinTransferRate,
 				Ports:           checks.Ports{TCP: tcp, UDP: udp},
@@ -56,6 +56,7 @@ import (
 
 const (
 	SiteLabelName                 = "Name"
+	SiteLabelFlavor               = "Flavor"
 	SystemRepository              = "gravitational.io"
 	ProviderGeneric               = "generic"
 	TeleportProxyAddress          = "teleport_proxy_address"
@@ -85,6 +86,8 @@ const (
 	SiteStateUninstalling = "uninstalling"
 	// SiteStateGarbageCollecting is the state of the cluster when it's removing unused resources
 	SiteStateGarbageCollecting = "collecting_garbage"
+	// SiteStateReconfiguring is the state of the cluster when its network settings are being changed
+	SiteStateReconfiguring = "reconfiguring"
 	// SiteStateDegraded means that the application installed on a deployed site is failing its health check
 	SiteStateDegraded = "degraded"
 	// SiteStateOffline means that OpsCenter cannot connect to remote site
@@ -124,6 +127,18 @@ const (
 	OperationGarbageCollect           = "operation_gc"
 	OperationGarbageCollectInProgress = "gc_in_progress"
 
+	// network reconfiguration operation
+	OperationReconfigureNetwork           = "operation_reconfigure_network"
+	OperationReconfigureNetworkInProgress = "reconfigure_network_in_progress"
+
+	// node advertise address reconfiguration operation
+	OperationReconfigureNode           = "operation_reconfigure_node"
+	OperationReconfigureNodeInProgress = "reconfigure_node_in_progress"
+
+	// node Docker storage driver reconfiguration operation
+	OperationReconfigureDocker           = "operation_reconfigure_docker"
+	OperationReconfigureDockerInProgress = "reconfigure_docker_in_progress"
+
 	// common operation states
 	OperationStateCompleted = "completed"
 	OperationStateFailed    = "failed"
@@ -208,23 +223,29 @@ var (
 	// OperationStartedToClusterState defines states the cluster transitions
 	// into when a certain operation starts
 	OperationStartedToClusterState = map[string]string{
-		OperationInstall:        SiteStateInstalling,
-		OperationExpand:         SiteStateExpanding,
-		OperationUpdate:         SiteStateUpdating,
-		OperationShrink:         SiteStateShrinking,
-		OperationUninstall:      SiteStateUninstalling,
-		OperationGarbageCollect: SiteStateGarbageCollecting,
+		OperationInstall:            SiteStateInstalling,
+		OperationExpand:             SiteStateExpanding,
+		OperationUpdate:             SiteStateUpdating,
+		OperationShrink:             SiteStateShrinking,
+		OperationUninstall:          SiteStateUninstalling,
+		OperationGarbageCollect:     SiteStateGarbageCollecting,
+		OperationReconfigureNetwork: SiteStateReconfiguring,
+		OperationReconfigureNode:    SiteStateReconfiguring,
+		OperationReconfigureDocker:  SiteStateReconfiguring,
 	}
 
 	// OperationSucceededToClusterState defines states the cluster transitions
 	// into when a certain operation completes successfully
 	OperationSucceededToClusterState = map[string]string{
-		OperationInstall:        SiteStateActive,
-		OperationExpand:         SiteStateActive,
-		OperationUpdate:         SiteStateActive,
-		OperationShrink:         SiteStateActive,
-		OperationUninstall:      SiteStateNotInstalled,
-		OperationGarbageCollect: SiteStateActive,
+		OperationInstall:            SiteStateActive,
+		OperationExpand:             SiteStateActive,
+		OperationUpdate:             SiteStateActive,
+		OperationShrink:             SiteStateActive,
+		OperationUninstall:          SiteStateNotInstalled,
+		OperationGarbageCollect:     SiteStateActive,
+		OperationReconfigureNetwork: SiteStateActive,
+		OperationReconfigureNode:    SiteStateActive,
+		OperationReconfigureDocker:  SiteStateActive,
 	}
 
 	// OperationFailedToClusterState defines states the cluster transitions
@@ -232,11 +253,14 @@ var (
 	// If an state transition for a specific operation is missing, the cluster
 	// state is left unchanged
 	OperationFailedToClusterState = map[string]string{
-		OperationInstall:        SiteStateFailed,
-		OperationExpand:         SiteStateActive,
-		OperationUpdate:         SiteStateUpdating,
-		OperationShrink:         SiteStateActive,
-		OperationUninstall:      SiteStateFailed,
-		OperationGarbageCollect: SiteStateActive,
+		OperationInstall:            SiteStateFailed,
+		OperationExpand:             SiteStateActive,
+		OperationUpdate:             SiteStateUpdating,
+		OperationShrink:             SiteStateActive,
+		OperationUninstall:          SiteStateFailed,
+		OperationGarbageCollect:     SiteStateActive,
+		OperationReconfigureNetwork: SiteStateActive,
+		OperationReconfigureNode:    SiteStateActive,
+		OperationReconfigureDocker:  SiteStateActive,
 	}
 )
@@ -0,0 +1,384 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/sirupsen/logrus"
+)
+
+// Alert is an alert event posted to the cluster.
+//
+// The format is compatible with the alert data posted by Kapacitor's HTTP handler
+type Alert struct {
+	// ID is the alert ID, unique per alert rule and group
+	ID string `json:"id"`
+	// Message is the alert message
+	Message string `json:"message"`
+	// Details is optional alert details
+	Details string `json:"details,omitempty"`
+	// Time is the time the alert was raised
+	Time time.Time `json:"time"`
+	// Level is the alert level, one of OK, INFO, WARNING or CRITICAL
+	Level string `json:"level"`
+	// Cluster is the name of the cluster the alert was raised in
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// IsResolved returns true if the alert signals recovery
+func (r Alert) IsResolved() bool {
+	return strings.EqualFold(r.Level, AlertLevelOK)
+}
+
+// AlertDelivery describes the delivery of an alert to a single alert target
+type AlertDelivery struct {
+	// AlertID is the ID of the delivered alert
+	AlertID string `json:"alert_id"`
+	// Target is the name of the alert target
+	Target string `json:"target"`
+	// Type is the alert target type
+	Type string `json:"type"`
+	// Attempts is the number of delivery attempts
+	Attempts int `json:"attempts"`
+	// Delivered is whether the alert has been delivered
+	Delivered bool `json:"delivered"`
+	// Error is the last delivery error
+	Error string `json:"error,omitempty"`
+	// Time is the time of the last delivery attempt
+	Time time.Time `json:"time"`
+}
+
+// NotifierConfig is the alert notifier configuration
+type NotifierConfig struct {
+	// Client is the HTTP client used to deliver alerts
+	Client *http.Client
+	// Attempts is the maximum number of delivery attempts per alert target
+	Attempts int
+	// Backoff is the delay before the first retry, doubled with each retry
+	Backoff time.Duration
+	// History is the number of recent deliveries to keep
+	History int
+	// Store keeps the history of deliveries, in memory if unspecified
+	Store DeliveryStore
+	// Clock is used to wait between retries
+	Clock clockwork.Clock
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+}
+
+// CheckAndSetDefaults sets defaults for unset parameters
+func (r *NotifierConfig) CheckAndSetDefaults() {
+	if r.Client == nil {
+		r.Client = &http.Client{Timeout: defaults.AlertDeliveryTimeout}
+	}
+	if r.Attempts == 0 {
+		r.Attempts = defaults.AlertDeliveryAttempts
+	}
+	if r.Backoff == 0 {
+		r.Backoff = defaults.AlertDeliveryBackoff
+	}
+	if r.History == 0 {
+		r.History = defaults.AlertDeliveryHistory
+	}
+	if r.Store == nil {
+		r.Store = newMemoryDeliveryStore()
+	}
+	if r.Clock == nil {
+		r.Clock = clockwork.NewRealClock()
+	}
+	if r.FieldLogger == nil {
+		r.FieldLogger = logrus.WithField(trace.Component, "alerts")
+	}
+}
+
+// NewNotifier returns a new notifier that delivers alerts to
+// webhook, chat and incident management alert targets
+func NewNotifier(config NotifierConfig) *Notifier {
+	config.CheckAndSetDefaults()
+	return &Notifier{NotifierConfig: config}
+}
+
+// Notifier delivers alerts to HTTP alert targets, retrying failed
+// deliveries, and keeps the history of recent deliveries
+type Notifier struct {
+	NotifierConfig
+}
+
+// NotifyAlert delivers the alert to the specified alert targets.
+//
+// Email targets are delivered by the monitoring stack using the cluster
+// SMTP configuration and are skipped
+func (n *Notifier) NotifyAlert(ctx context.Context, alert Alert, targets []storage.AlertTarget) error {
+	var errors []error
+	for _, target := range targets {
+		if target.GetType() == storage.AlertTargetEmail {
+			continue
+		}
+		err := n.deliver(ctx, alert, target)
+		if err != nil {
+			errors = append(errors, trace.Wrap(err, "failed to deliver alert %v to %v",
+				alert.ID, target.GetName()))
+		}
+	}
+	return trace.NewAggregate(errors...)
+}
+
+// GetAlertDeliveries returns the recent alert deliveries, oldest first
+func (n *Notifier) GetAlertDeliveries() ([]AlertDelivery, error) {
+	deliveries, err := n.Store.GetAlertDeliveries()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+func (n *Notifier) deliver(ctx context.Context, alert Alert, target storage.AlertTarget) error {
+	delivery := AlertDelivery{
+		AlertID: alert.ID,
+		Target:  target.GetName(),
+		Type:    target.GetType(),
+	}
+	defer n.record(&delivery)
+	backoff := n.Backoff
+	for {
+		delivery.Attempts++
+		delivery.Time = n.Clock.Now().UTC()
+		err := n.send(ctx, alert, target)
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			return nil
+		}
+		delivery.Error = err.Error()
+		if !trace.IsRetryError(err) || delivery.Attempts >= n.Attempts {
+			return trace.Wrap(err)
+		}
+		n.Debugf("Failed to deliver alert %v to %v, will retry in %v: %v.",
+			alert.ID, target.GetName(), backoff, err)
+		select {
+		case <-n.Clock.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return trace.Wrap(ctx.Err())
+		}
+	}
+}
+
+func (n *Notifier) record(delivery *AlertDelivery) {
+	if err := n.Store.AddAlertDelivery(*delivery, n.History); err != nil {
+		n.Warnf("Failed to record delivery of alert %v to %v: %v.",
+			delivery.AlertID, delivery.Target, trace.DebugReport(err))
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, alert Alert, target storage.AlertTarget) error {
+	req, err := newAlertRequest(alert, target)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	resp, err := n.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return trace.Retry(err, "failed to send alert")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = trace.BadParameter("alert target responded with %v: %s",
+		resp.Status, bytes.TrimSpace(body))
+	// client errors other than rate limiting will not go away on retry
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return trace.Retry(err, "alert target is unavailable")
+	}
+	return err
+}
+
+// newAlertRequest returns the HTTP request that delivers the alert to the target
+func newAlertRequest(alert Alert, target storage.AlertTarget) (*http.Request, error) {
+	var url string
+	var body []byte
+	var err error
+	headers := map[string]string{"Content-Type": "application/json"}
+	switch target.GetType() {
+	case storage.AlertTargetWebhook:
+		webhook := target.GetWebhook()
+		url = webhook.URL
+		body, err = webhookPayload(*webhook, alert)
+		for name, value := range webhook.Headers {
+			headers[name] = value
+		}
+		if err == nil && webhook.Secret != "" {
+			headers[AlertSignatureHeader] = SignAlertPayload(webhook.Secret, body)
+		}
+	case storage.AlertTargetSlack:
+		slack := target.GetSlack()
+		url = slack.URL
+		body, err = slackPayload(*slack, alert)
+	case storage.AlertTargetPagerDuty:
+		pagerDuty := target.GetPagerDuty()
+		if err := pagerDuty.CheckAndSetDefaults(); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		url = pagerDuty.URL
+		body, err = pagerDutyPayload(*pagerDuty, alert)
+	default:
+		return nil, trace.BadParameter("unsupported alert target type %q", target.GetType())
+	}
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// SignAlertPayload returns the value of the signature header for the
+// specified request body signed with secret
+func SignAlertPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%v", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// webhookPayload renders the webhook request body. Without a payload
+// template the alert is sent as JSON
+func webhookPayload(webhook storage.AlertWebhook, alert Alert) ([]byte, error) {
+	if webhook.Payload == "" {
+		return json.Marshal(alert)
+	}
+	tpl, err := template.New("payload").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(webhook.Payload)
+	if err != nil {
+		return nil, trace.BadParameter("invalid webhook payload template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, alert); err != nil {
+		return nil, trace.BadParameter("failed to render webhook payload: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, trace.BadParameter("webhook payload is not valid JSON: %s", buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+func slackPayload(slack storage.AlertSlack, alert Alert) ([]byte, error) {
+	text := fmt.Sprintf("[%v] %v", alert.Level, alert.Message)
+	if alert.Cluster != "" {
+		text = fmt.Sprintf("[%v] %v: %v", alert.Level, alert.Cluster, alert.Message)
+	}
+	return json.Marshal(slackMessage{
+		Text:     text,
+		Channel:  slack.Channel,
+		Username: slack.Username,
+	})
+}
+
+func pagerDutyPayload(pagerDuty storage.AlertPagerDuty, alert Alert) ([]byte, error) {
+	event := pagerDutyEvent{
+		RoutingKey:  pagerDuty.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    alert.ID,
+	}
+	if alert.IsResolved() {
+		event.EventAction = "resolve"
+	} else {
+		source := alert.Cluster
+		if source == "" {
+			source = alert.ID
+		}
+		event.Payload = &pagerDutyEventPayload{
+			Summary:   alert.Message,
+			Source:    source,
+			Severity:  pagerDutySeverity(alert.Level),
+			Timestamp: alert.Time.UTC().Format(time.RFC3339),
+		}
+	}
+	return json.Marshal(event)
+}
+
+// pagerDutySeverity maps the alert level to the event severity
+func pagerDutySeverity(level string) string {
+	switch strings.ToUpper(level) {
+	case AlertLevelCritical:
+		return "critical"
+	case AlertLevelWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+type slackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string                 `json:"routing_key"`
+	EventAction string                 `json:"event_action"`
+	DedupKey    string                 `json:"dedup_key"`
+	Payload     *pagerDutyEventPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyEventPayload struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+const (
+	// AlertSignatureHeader is the webhook request header with the
+	// HMAC-SHA256 signature of the request body
+	AlertSignatureHeader = "X-Gravity-Signature"
+
+	// AlertLevelOK is the level of recovery alerts
+	AlertLevelOK = "OK"
+	// AlertLevelWarning is the level of warning alerts
+	AlertLevelWarning = "WARNING"
+	// AlertLevelCritical is the level of critical alerts
+	AlertLevelCritical = "CRITICAL"
+)
@@ -0,0 +1,342 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	"gopkg.in/check.v1"
+)
+
+func TestMonitoring(t *testing.T) { check.TestingT(t) }
+
+type AlertsSuite struct {
+	// requests receives the requests accepted by the local receiver
+	requests chan receivedRequest
+	// mu guards statuses
+	mu sync.Mutex
+	// statuses is the list of response codes the receiver replies with,
+	// the last one is repeated
+	statuses []int
+	server   *httptest.Server
+	notifier *Notifier
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+	err    error
+}
+
+var _ = check.Suite(&AlertsSuite{})
+
+func (s *AlertsSuite) SetUpTest(c *check.C) {
+	s.requests = make(chan receivedRequest, 10)
+	s.statuses = []int{http.StatusOK}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		s.requests <- receivedRequest{header: r.Header, body: body, err: err}
+		w.WriteHeader(s.nextStatus())
+	}))
+	s.notifier = NewNotifier(NotifierConfig{
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+	})
+}
+
+func (s *AlertsSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+// receive returns the next request accepted by the receiver
+func (s *AlertsSuite) receive(c *check.C) receivedRequest {
+	req := <-s.requests
+	c.Assert(req.err, check.IsNil)
+	return req
+}
+
+func (s *AlertsSuite) setStatuses(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = statuses
+}
+
+func (s *AlertsSuite) nextStatus() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statuses[0]
+	if len(s.statuses) > 1 {
+		s.statuses = s.statuses[1:]
+	}
+	return status
+}
+
+func (s *AlertsSuite) TestSignsTemplatedWebhookPayload(c *check.C) {
+	target := newTarget("hook", storage.AlertTargetSpecV2{
+		Webhook: &storage.AlertWebhook{
+			URL:     s.server.URL,
+			Payload: `{"summary": {{json .Message}}, "level": "{{.Level}}"}`,
+			Secret:  "secret",
+			Headers: map[string]string{"X-Team": "ops"},
+		},
+	})
+	err := s.notifier.NotifyAlert(context.TODO(), testAlert, []storage.AlertTarget{target})
+	c.Assert(err, check.IsNil)
+
+	req := s.receive(c)
+	c.Assert(string(req.body), check.Equals, `{"summary": "CPU usage is \"high\"", "level": "CRITICAL"}`)
+	c.Assert(req.header.Get(AlertSignatureHeader), check.Equals, SignAlertPayload("secret", req.body))
+	c.Assert(req.header.Get("X-Team"), check.Equals, "ops")
+	c.Assert(req.header.Get("Content-Type"), check.Equals, "application/json")
+}
+
+func (s *AlertsSuite) TestSendsAlertAsJSONWithoutTemplate(c *check.C) {
+	target := newTarget("hook", storage.AlertTargetSpecV2{
+		Webhook: &storage.AlertWebhook{URL: s.server.URL},
+	})
+	err := s.notifier.NotifyAlert(context.TODO(), testAlert, []storage.AlertTarget{target})
+	c.Assert(err, check.IsNil)
+
+	req := s.receive(c)
+	var alert Alert
+	c.Assert(json.Unmarshal(req.body, &alert), check.IsNil)
+	c.Assert(alert, check.DeepEquals, testAlert)
+	c.Assert(req.header.Get(AlertSignatureHeader), check.Equals, "")
+}
+
+func (s *AlertsSuite) TestRetriesUnavailableTarget(c *check.C) {
+	s.setStatuses(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	target := newTarget("chat", storage.AlertTargetSpecV2{
+		Slack: &storage.AlertSlack{URL: s.server.URL, Channel: "#alerts"},
+	})
+	err := s.notifier.NotifyAlert(context.TODO(), testAlert, []storage.AlertTarget{target})
+	c.Assert(err, check.IsNil)
+
+	var message slackMessage
+	c.Assert(json.Unmarshal(s.receive(c).body, &message), check.IsNil)
+	c.Assert(message, check.DeepEquals, slackMessage{
+		Text:    `[CRITICAL] example.com: CPU usage is "high"`,
+		Channel: "#alerts",
+	})
+	s.assertDelivery(c, AlertDelivery{
+		AlertID:   testAlert.ID,
+		Target:    "chat",
+		Type:      storage.AlertTargetSlack,
+		Attempts:  3,
+		Delivered: true,
+	})
+}
+
+func (s *AlertsSuite) TestDoesNotRetryRejectedAlert(c *check.C) {
+	s.setStatuses(http.StatusBadRequest)
+	target := newTarget("incidents", storage.AlertTargetSpecV2{
+		PagerDuty: &storage.AlertPagerDuty{URL: s.server.URL, RoutingKey: "key"},
+	})
+	err := s.notifier.NotifyAlert(context.TODO(), testAlert, []storage.AlertTarget{target})
+	c.Assert(err, check.NotNil)
+
+	var event pagerDutyEvent
+	c.Assert(json.Unmarshal(s.receive(c).body, &event), check.IsNil)
+	c.Assert(event, check.DeepEquals, pagerDutyEvent{
+		RoutingKey:  "key",
+		EventAction: "trigger",
+		DedupKey:    testAlert.ID,
+		Payload: &pagerDutyEventPayload{
+			Summary:   testAlert.Message,
+			Source:    testAlert.Cluster,
+			Severity:  "critical",
+			Timestamp: "2018-06-01T10:00:00Z",
+		},
+	})
+	deliveries, err := s.notifier.GetAlertDeliveries()
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Attempts, check.Equals, 1)
+	c.Assert(deliveries[0].Delivered, check.Equals, false)
+	c.Assert(deliveries[0].Error, check.Matches, ".*400 Bad Request.*")
+}
+
+func (s *AlertsSuite) TestResolvesIncident(c *check.C) {
+	target := newTarget("incidents", storage.AlertTargetSpecV2{
+		PagerDuty: &storage.AlertPagerDuty{URL: s.server.URL, RoutingKey: "key"},
+	})
+	alert := testAlert
+	alert.Level = AlertLevelOK
+	err := s.notifier.NotifyAlert(context.TODO(), alert, []storage.AlertTarget{target})
+	c.Assert(err, check.IsNil)
+
+	var event pagerDutyEvent
+	c.Assert(json.Unmarshal(s.receive(c).body, &event), check.IsNil)
+	c.Assert(event, check.DeepEquals, pagerDutyEvent{
+		RoutingKey:  "key",
+		EventAction: "resolve",
+		DedupKey:    testAlert.ID,
+	})
+}
+
+func (s *AlertsSuite) TestSkipsEmailTargets(c *check.C) {
+	target := newTarget("email", storage.AlertTargetSpecV2{Email: "ops@example.com"})
+	err := s.notifier.NotifyAlert(context.TODO(), testAlert, []storage.AlertTarget{target})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.requests, check.HasLen, 0)
+	deliveries, err := s.notifier.GetAlertDeliveries()
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 0)
+}
+
+func (s *AlertsSuite) TestValidatesTargets(c *check.C) {
+	var testCases = []struct {
+		spec    storage.AlertTargetSpecV2
+		comment string
+	}{
+		{
+			spec:    storage.AlertTargetSpecV2{},
+			comment: "no target",
+		},
+		{
+			spec: storage.AlertTargetSpecV2{
+				Email: "ops@example.com",
+				Slack: &storage.AlertSlack{URL: "https://hooks.example.com"},
+			},
+			comment: "multiple targets",
+		},
+		{
+			spec:    storage.AlertTargetSpecV2{Webhook: &storage.AlertWebhook{URL: "ftp://example.com"}},
+			comment: "unsupported URL scheme",
+		},
+		{
+			spec: storage.AlertTargetSpecV2{Webhook: &storage.AlertWebhook{
+				URL:     "https://example.com",
+				Payload: "{{.Message",
+			}},
+			comment: "invalid payload template",
+		},
+		{
+			spec:    storage.AlertTargetSpecV2{PagerDuty: &storage.AlertPagerDuty{}},
+			comment: "missing routing key",
+		},
+		{
+			spec: storage.AlertTargetSpecV2{PagerDuty: &storage.AlertPagerDuty{
+				RoutingKey: storage.RedactedValue,
+			}},
+			comment: "redacted routing key",
+		},
+		{
+			spec: storage.AlertTargetSpecV2{Webhook: &storage.AlertWebhook{
+				URL:    "https://example.com",
+				Secret: storage.RedactedValue,
+			}},
+			comment: "redacted webhook secret",
+		},
+	}
+	for _, tc := range testCases {
+		target := newTarget("target", tc.spec)
+		c.Assert(target.CheckAndSetDefaults(), check.NotNil, check.Commentf(tc.comment))
+	}
+
+	target := newTarget("incidents", storage.AlertTargetSpecV2{
+		PagerDuty: &storage.AlertPagerDuty{RoutingKey: "key"},
+	})
+	c.Assert(target.CheckAndSetDefaults(), check.IsNil)
+	c.Assert(target.GetPagerDuty().URL, check.Equals, storage.AlertPagerDutyURL)
+}
+
+func (s *AlertsSuite) TestRedactsCredentials(c *check.C) {
+	target := newTarget("hook", storage.AlertTargetSpecV2{
+		Webhook: &storage.AlertWebhook{
+			URL:    "https://example.com",
+			Secret: "secret",
+		},
+	})
+	redacted := target.WithoutSecrets()
+	c.Assert(redacted.GetWebhook().Secret, check.Equals, storage.RedactedValue)
+	c.Assert(redacted.GetWebhook().URL, check.Equals, "https://example.com")
+	c.Assert(target.GetWebhook().Secret, check.Equals, "secret")
+
+	target = newTarget("chat", storage.AlertTargetSpecV2{
+		Slack: &storage.AlertSlack{URL: "https://hooks.example.com/token"},
+	})
+	c.Assert(target.WithoutSecrets().GetSlack().URL, check.Equals, storage.RedactedValue)
+	c.Assert(target.GetSlack().URL, check.Equals, "https://hooks.example.com/token")
+
+	target = newTarget("incidents", storage.AlertTargetSpecV2{
+		PagerDuty: &storage.AlertPagerDuty{RoutingKey: "key"},
+	})
+	c.Assert(target.WithoutSecrets().GetPagerDuty().RoutingKey, check.Equals, storage.RedactedValue)
+	c.Assert(target.GetPagerDuty().RoutingKey, check.Equals, "key")
+}
+
+func (s *AlertsSuite) TestSharesDeliveryHistoryThroughStore(c *check.C) {
+	store := newMemoryDeliveryStore()
+	config := NotifierConfig{History: 2, Store: store}
+	notifier := NewNotifier(config)
+	target := newTarget("hook", storage.AlertTargetSpecV2{
+		Webhook: &storage.AlertWebhook{URL: s.server.URL},
+	})
+	for _, id := range []string{"first", "second", "third"} {
+		alert := testAlert
+		alert.ID = id
+		err := notifier.NotifyAlert(context.TODO(), alert, []storage.AlertTarget{target})
+		c.Assert(err, check.IsNil)
+		s.receive(c)
+	}
+
+	// another replica sees the most recent deliveries
+	deliveries, err := NewNotifier(config).GetAlertDeliveries()
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 2)
+	c.Assert(deliveries[0].AlertID, check.Equals, "second")
+	c.Assert(deliveries[1].AlertID, check.Equals, "third")
+}
+
+func (s *AlertsSuite) assertDelivery(c *check.C, expected AlertDelivery) {
+	deliveries, err := s.notifier.GetAlertDeliveries()
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	delivery := deliveries[0]
+	delivery.Time = time.Time{}
+	c.Assert(delivery, check.DeepEquals, expected)
+}
+
+func newTarget(name string, spec storage.AlertTargetSpecV2) *storage.AlertTargetV2 {
+	return &storage.AlertTargetV2{
+		Kind:    storage.KindAlertTarget,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+var testAlert = Alert{
+	ID:      "high-cpu:node-1",
+	Message: `CPU usage is "high"`,
+	Time:    time.Date(2018, time.June, 1, 10, 0, 0, 0, time.UTC),
+	Level:   AlertLevelCritical,
+	Cluster: "example.com",
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// DeliveryStore keeps the history of alert deliveries
+type DeliveryStore interface {
+	// AddAlertDelivery records the delivery keeping at most history recent deliveries
+	AddAlertDelivery(delivery AlertDelivery, history int) error
+	// GetAlertDeliveries returns the recorded deliveries, oldest first
+	GetAlertDeliveries() ([]AlertDelivery, error)
+}
+
+// NewConfigMapDeliveryStore returns a delivery store that keeps the history
+// in a ConfigMap so that it survives restarts and is shared by all gravity-site
+// replicas
+func NewConfigMapDeliveryStore(client kubernetes.Interface) DeliveryStore {
+	return &configMapDeliveryStore{
+		client: client.CoreV1().ConfigMaps(defaults.MonitoringNamespace),
+	}
+}
+
+type configMapDeliveryStore struct {
+	client corev1.ConfigMapInterface
+}
+
+// AddAlertDelivery records the delivery keeping at most history recent deliveries
+func (r *configMapDeliveryStore) AddAlertDelivery(delivery AlertDelivery, history int) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config, err := r.client.Get(constants.AlertDeliveriesConfigMap, metav1.GetOptions{})
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+		if trace.IsNotFound(err) {
+			config = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      constants.AlertDeliveriesConfigMap,
+					Namespace: defaults.MonitoringNamespace,
+				},
+			}
+		}
+		deliveries, err := unmarshalDeliveries(config)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		deliveries = appendDelivery(deliveries, delivery, history)
+		data, err := json.Marshal(deliveries)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		config.Data = map[string]string{constants.ResourceSpecKey: string(data)}
+		if config.ResourceVersion == "" {
+			_, err = r.client.Create(config)
+		} else {
+			_, err = r.client.Update(config)
+		}
+		// conflicts are returned as is to be retried
+		return err
+	})
+	return trace.Wrap(rigging.ConvertError(err))
+}
+
+// GetAlertDeliveries returns the recorded deliveries, oldest first
+func (r *configMapDeliveryStore) GetAlertDeliveries() ([]AlertDelivery, error) {
+	config, err := r.client.Get(constants.AlertDeliveriesConfigMap, metav1.GetOptions{})
+	err = rigging.ConvertError(err)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, trace.Wrap(err)
+	}
+	deliveries, err := unmarshalDeliveries(config)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+func unmarshalDeliveries(config *v1.ConfigMap) (deliveries []AlertDelivery, err error) {
+	data, ok := config.Data[constants.ResourceSpecKey]
+	if !ok {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(data), &deliveries); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+// newMemoryDeliveryStore returns a delivery store that keeps the history in memory
+func newMemoryDeliveryStore() *memoryDeliveryStore {
+	return &memoryDeliveryStore{}
+}
+
+type memoryDeliveryStore struct {
+	mu         sync.Mutex
+	deliveries []AlertDelivery
+}
+
+// AddAlertDelivery records the delivery keeping at most history recent deliveries
+func (r *memoryDeliveryStore) AddAlertDelivery(delivery AlertDelivery, history int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = appendDelivery(r.deliveries, delivery, history)
+	return nil
+}
+
+// GetAlertDeliveries returns the recorded deliveries, oldest first
+func (r *memoryDeliveryStore) GetAlertDeliveries() ([]AlertDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AlertDelivery(nil), r.deliveries...), nil
+}
+
+func appendDelivery(deliveries []AlertDelivery, delivery AlertDelivery, history int) []AlertDelivery {
+	deliveries = append(deliveries, delivery)
+	if len(deliveries) > history {
+		deliveries = deliveries[len(deliveries)-history:]
+	}
+	return deliveries
+}
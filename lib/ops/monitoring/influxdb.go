@@ -19,7 +19,9 @@ package monitoring
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gravitational/gravity/lib/defaults"
@@ -30,17 +32,32 @@ import (
 
 type influxDB struct {
 	*roundtrip.Client
+	// Notifier delivers alerts to HTTP alert targets
+	*Notifier
+	// kapacitor configures the alert handlers of Kapacitor
+	kapacitor *kapacitor
 }
 
-// NewInfluxDB returns a new InfluxDB monitoring provider
-func NewInfluxDB() (Monitoring, error) {
+// NewInfluxDB returns a new InfluxDB monitoring provider.
+// The history of alert deliveries is kept in the specified store,
+// or in memory if it is nil
+func NewInfluxDB(deliveries DeliveryStore) (Monitoring, error) {
 	client, err := roundtrip.NewClient(
 		fmt.Sprintf("http://%v:%v", defaults.InfluxDBServiceAddr, defaults.InfluxDBServicePort), "",
 		roundtrip.BasicAuth(defaults.InfluxDBAdminUser, defaults.InfluxDBAdminPassword))
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	return &influxDB{Client: client}, nil
+	kapacitorClient, err := roundtrip.NewClient(
+		fmt.Sprintf("http://%v:%v", defaults.KapacitorServiceAddr, defaults.KapacitorServicePort), "")
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &influxDB{
+		Client:    client,
+		Notifier:  NewNotifier(NotifierConfig{Store: deliveries}),
+		kapacitor: &kapacitor{Client: kapacitorClient},
+	}, nil
 }
 
 // GetRetentionPolicies returns a list of retention policies for the site
@@ -105,6 +122,26 @@ func (i *influxDB) UpdateRetentionPolicy(policy RetentionPolicy) error {
 	return trace.Wrap(err)
 }
 
+// ConfigureAlertEndpoint configures Kapacitor to post the alerts
+// to the cluster alert notification API
+func (i *influxDB) ConfigureAlertEndpoint(config AlertEndpointConfig) error {
+	return i.kapacitor.ConfigureAlertEndpoint(config)
+}
+
+// WriteMetric writes the metric to the k8s database
+func (i *influxDB) WriteMetric(metric Metric) error {
+	endpoint := i.Endpoint("write") + "?" + url.Values{"db": []string{database}}.Encode()
+	_, err := httplib.ConvertResponse(i.RoundTrip(func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(metric.String()))
+		if err != nil {
+			return nil, err
+		}
+		i.SetAuthHeader(req.Header)
+		return i.HTTPClient().Do(req)
+	}))
+	return trace.Wrap(err)
+}
+
 // Get is like roundtrip.Client.Get but converts returned HTTP errors into trace errors
 func (i *influxDB) Get(endpoint string, params url.Values) (*roundtrip.Response, error) {
 	return httplib.ConvertResponse(i.Client.Get(endpoint, params))
@@ -138,6 +175,8 @@ type influxDBSeries struct {
 }
 
 var (
+	// database is the InfluxDB database with the cluster metrics
+	database = "k8s"
 	// showQuery is InfluxDB query to list retention policies
 	showQuery = "show retention policies on k8s"
 	// updateQuery is InfluxDB query to update retention policy
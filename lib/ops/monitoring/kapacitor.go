@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gravitational/roundtrip"
+	"github.com/gravitational/teleport/lib/httplib"
+	"github.com/gravitational/trace"
+)
+
+// AlertEndpoint is the name of the Kapacitor HTTP post endpoint
+// that posts the alerts raised by Kapacitor to the cluster
+const AlertEndpoint = "gravity"
+
+// AlertEndpointConfig configures the Kapacitor HTTP post endpoint
+// the alerts are posted to
+type AlertEndpointConfig struct {
+	// URL is the URL of the cluster alert notification API
+	URL string
+	// Username is the name of the user to post the alerts as
+	Username string
+	// Password is the user password or API key
+	Password string
+}
+
+// kapacitor configures Kapacitor using its HTTP API
+type kapacitor struct {
+	*roundtrip.Client
+}
+
+// ConfigureAlertEndpoint creates or updates the Kapacitor HTTP post
+// endpoint the alerts are posted to
+func (k *kapacitor) ConfigureAlertEndpoint(config AlertEndpointConfig) error {
+	options := map[string]interface{}{
+		"endpoint": AlertEndpoint,
+		"url":      config.URL,
+		"basic-auth": map[string]string{
+			"username": config.Username,
+			"password": config.Password,
+		},
+	}
+	_, err := httplib.ConvertResponse(k.PostJSON(
+		k.Endpoint("kapacitor", "v1", "config", "httppost", AlertEndpoint),
+		map[string]interface{}{"set": options}))
+	if err == nil || !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	_, err = httplib.ConvertResponse(k.PostJSON(
+		k.Endpoint("kapacitor", "v1", "config", "httppost"),
+		map[string]interface{}{"add": options}))
+	return trace.Wrap(err)
+}
+
+// AddAlertEndpoint adds the handler that posts the alerts to the cluster to the
+// alert node of the TICKscript specified with formula.
+// The formula is returned unchanged if its pipeline does not end with an alert node
+// or already has the handler
+func AddAlertEndpoint(formula string) string {
+	script := strings.TrimRightFunc(formula, unicode.IsSpace)
+	if strings.HasSuffix(script, alertEndpointHandler) || lastNode(script) != "alert" {
+		return formula
+	}
+	return script + alertEndpointHandler + formula[len(script):]
+}
+
+// RemoveAlertEndpoint removes the handler added with AddAlertEndpoint
+// from the TICKscript specified with formula
+func RemoveAlertEndpoint(formula string) string {
+	script := strings.TrimRightFunc(formula, unicode.IsSpace)
+	if !strings.HasSuffix(script, alertEndpointHandler) {
+		return formula
+	}
+	return strings.TrimSuffix(script, alertEndpointHandler) + formula[len(script):]
+}
+
+// lastNode returns the name of the last node chained in the TICKscript,
+// string literals and comments are skipped
+func lastNode(script string) (name string) {
+	for i := 0; i < len(script); i++ {
+		switch {
+		case strings.HasPrefix(script[i:], "'''"):
+			end := strings.Index(script[i+3:], "'''")
+			if end < 0 {
+				return ""
+			}
+			i += end + 5
+		case script[i] == '\'':
+			for i++; i < len(script) && script[i] != '\''; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case strings.HasPrefix(script[i:], "//"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				return name
+			}
+			i += end
+		case script[i] == '|':
+			rest := strings.TrimLeftFunc(script[i+1:], unicode.IsSpace)
+			end := strings.IndexFunc(rest, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+			})
+			if end < 0 {
+				end = len(rest)
+			}
+			name = rest[:end]
+		}
+	}
+	return name
+}
+
+// alertEndpointHandler is the alert handler that posts the alerts
+// to the cluster using the alert endpoint
+const alertEndpointHandler = "\n    .post()\n        .endpoint('" + AlertEndpoint + "')"
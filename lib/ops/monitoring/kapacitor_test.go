@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gravitational/roundtrip"
+	"gopkg.in/check.v1"
+)
+
+type KapacitorSuite struct{}
+
+var _ = check.Suite(&KapacitorSuite{})
+
+func (s *KapacitorSuite) TestAddsAlertEndpoint(c *check.C) {
+	formula := `stream
+  |from()
+    .measurement('cpu')
+  |alert()
+    .id('cpu')
+    .message('cpu | usage is high')
+    .crit(lambda: "usage" > 90)
+    .email()
+`
+	withEndpoint := AddAlertEndpoint(formula)
+	c.Assert(withEndpoint, check.Equals, `stream
+  |from()
+    .measurement('cpu')
+  |alert()
+    .id('cpu')
+    .message('cpu | usage is high')
+    .crit(lambda: "usage" > 90)
+    .email()
+    .post()
+        .endpoint('gravity')
+`)
+	c.Assert(AddAlertEndpoint(withEndpoint), check.Equals, withEndpoint)
+	c.Assert(RemoveAlertEndpoint(withEndpoint), check.Equals, formula)
+}
+
+func (s *KapacitorSuite) TestSkipsFormulasNotEndingWithAlert(c *check.C) {
+	for _, formula := range []string{
+		"stream\n  |from()\n    .measurement('cpu')\n  |influxDBOut()\n    .database('k8s')\n",
+		"stream\n  |from()\n    .measurement('cpu')\n    .where(lambda: \"host\" == '|alert()')\n",
+		"stream\n  |from()\n    .measurement('cpu')\n// |alert()\n",
+		"",
+	} {
+		c.Assert(AddAlertEndpoint(formula), check.Equals, formula)
+		c.Assert(RemoveAlertEndpoint(formula), check.Equals, formula)
+	}
+}
+
+func (s *KapacitorSuite) TestConfiguresAlertEndpoint(c *check.C) {
+	var requests []kapacitorRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		var options map[string]map[string]interface{}
+		c.Check(json.Unmarshal(body, &options), check.IsNil)
+		requests = append(requests, kapacitorRequest{path: r.URL.Path, options: options})
+		// the endpoint does not exist yet
+		if r.URL.Path == "/kapacitor/v1/config/httppost/gravity" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client, err := roundtrip.NewClient(server.URL, "")
+	c.Assert(err, check.IsNil)
+
+	err = (&kapacitor{Client: client}).ConfigureAlertEndpoint(AlertEndpointConfig{
+		URL:      "https://gravity-site:3009/notify",
+		Username: "agent@example.com",
+		Password: "secret",
+	})
+	c.Assert(err, check.IsNil)
+
+	options := map[string]interface{}{
+		"endpoint": "gravity",
+		"url":      "https://gravity-site:3009/notify",
+		"basic-auth": map[string]interface{}{
+			"username": "agent@example.com",
+			"password": "secret",
+		},
+	}
+	c.Assert(requests, check.DeepEquals, []kapacitorRequest{
+		{path: "/kapacitor/v1/config/httppost/gravity", options: map[string]map[string]interface{}{"set": options}},
+		{path: "/kapacitor/v1/config/httppost", options: map[string]map[string]interface{}{"add": options}},
+	})
+}
+
+type kapacitorRequest struct {
+	path    string
+	options map[string]map[string]interface{}
+}
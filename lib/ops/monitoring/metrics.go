@@ -0,0 +1,70 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metric is a single measurement written to the monitoring database.
+// Monitoring alerts can be evaluated on the written metrics
+type Metric struct {
+	// Measurement is the name of the measurement
+	Measurement string
+	// Tags are the metric tags
+	Tags map[string]string
+	// Fields are the measured values
+	Fields map[string]int64
+	// Time is the time of the measurement
+	Time time.Time
+}
+
+// String formats the metric in InfluxDB line protocol
+func (m Metric) String() string {
+	var b strings.Builder
+	b.WriteString(escapeKey(m.Measurement))
+	for _, key := range sortedKeys(m.Tags) {
+		fmt.Fprintf(&b, ",%v=%v", escapeKey(key), escapeKey(m.Tags[key]))
+	}
+	fields := make([]string, 0, len(m.Fields))
+	for key, value := range m.Fields {
+		fields = append(fields, fmt.Sprintf("%v=%vi", escapeKey(key), value))
+	}
+	sort.Strings(fields)
+	fmt.Fprintf(&b, " %v %v", strings.Join(fields, ","), m.Time.UnixNano())
+	return b.String()
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeKey escapes the characters with special meaning in measurement
+// names, tags and field keys of the line protocol
+func escapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+var keyEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitoring
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type MetricsSuite struct{}
+
+var _ = check.Suite(&MetricsSuite{})
+
+func (s *MetricsSuite) TestFormatsLineProtocol(c *check.C) {
+	metric := Metric{
+		Measurement: "etcd maintenance",
+		Tags:        map[string]string{"cluster": "example.com", "node": "a=b,c"},
+		Fields:      map[string]int64{"leader_changes": 1, "db_size": 2048},
+		Time:        time.Unix(0, 1527901200000000000),
+	}
+	c.Assert(metric.String(), check.Equals,
+		`etcd\ maintenance,cluster=example.com,node=a\=b\,c db_size=2048i,leader_changes=1i 1527901200000000000`)
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package monitoring
 
 import (
+	"context"
 	"time"
 
 	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/rigging"
 	"github.com/gravitational/trace"
 
@@ -33,6 +35,15 @@ type Monitoring interface {
 	GetRetentionPolicies() ([]RetentionPolicy, error)
 	// UpdateRetentionPolicy updates a retention policy
 	UpdateRetentionPolicy(RetentionPolicy) error
+	// NotifyAlert delivers the alert to the specified alert targets
+	NotifyAlert(context.Context, Alert, []storage.AlertTarget) error
+	// GetAlertDeliveries returns the recent alert deliveries
+	GetAlertDeliveries() ([]AlertDelivery, error)
+	// WriteMetric writes the metric to the monitoring database
+	WriteMetric(Metric) error
+	// ConfigureAlertEndpoint configures Kapacitor to post the alerts
+	// to the cluster alert notification API
+	ConfigureAlertEndpoint(AlertEndpointConfig) error
 }
 
 // RetentionPolicy represents a single retention policy
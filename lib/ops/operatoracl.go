@@ -140,6 +140,16 @@ func (o *OperatorACL) userActions(actions ...string) error {
 	return nil
 }
 
+// roleActions checks access to the specified actions on the "role" resource
+func (o *OperatorACL) roleActions(actions ...string) error {
+	for _, action := range actions {
+		if err := o.Action(teleservices.KindRole, action); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
 // authPreferenceActions checks access to the specified actions on the "cluster
 // auth preference" resource
 func (o *OperatorACL) authPreferenceActions(actions ...string) error {
@@ -229,6 +239,38 @@ func (o *OperatorACL) GetClusterNodes(key SiteKey) ([]Node, error) {
 	return o.operator.GetClusterNodes(key)
 }
 
+// UpdateNodeLabels adds and removes Kubernetes labels of a cluster node
+func (o *OperatorACL) UpdateNodeLabels(req UpdateNodeLabelsRequest) error {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpdateNodeLabels(req)
+}
+
+// UpdateNodeTaints adds and removes Kubernetes taints of a cluster node
+func (o *OperatorACL) UpdateNodeTaints(req UpdateNodeTaintsRequest) error {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpdateNodeTaints(req)
+}
+
+// UpdateNodeProfile changes the profile of a cluster node
+func (o *OperatorACL) UpdateNodeProfile(req UpdateNodeProfileRequest) error {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpdateNodeProfile(req)
+}
+
+// CreatePersistentVolumes creates local persistent volumes for the filesystems provisioned on a node
+func (o *OperatorACL) CreatePersistentVolumes(req CreatePersistentVolumesRequest) error {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.CreatePersistentVolumes(req)
+}
+
 func (o *OperatorACL) ResetUserPassword(req ResetUserPasswordRequest) (string, error) {
 	if err := o.Action(teleservices.KindUser, teleservices.VerbUpdate); err != nil {
 		return "", trace.Wrap(err)
@@ -445,6 +487,13 @@ func (o *OperatorACL) ResumeShrink(key SiteKey) (*SiteOperationKey, error) {
 	return o.operator.ResumeShrink(key)
 }
 
+func (o *OperatorACL) ExecuteShrinkPhase(req ShrinkPhaseRequest) error {
+	if err := o.ClusterAction(req.Key.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.ExecuteShrinkPhase(req)
+}
+
 func (o *OperatorACL) CreateSiteExpandOperation(req CreateSiteExpandOperationRequest) (*SiteOperationKey, error) {
 	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
 		return nil, trace.Wrap(err)
@@ -487,6 +536,13 @@ func (o *OperatorACL) CreateSiteUninstallOperation(req CreateSiteUninstallOperat
 	return o.operator.CreateSiteUninstallOperation(req)
 }
 
+func (o *OperatorACL) ExecuteUninstallPhase(req UninstallPhaseRequest) error {
+	if err := o.ClusterAction(req.Key.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.ExecuteUninstallPhase(req)
+}
+
 // CreateClusterGarbageCollectOperation creates a new garbage collection operation in the cluster
 func (o *OperatorACL) CreateClusterGarbageCollectOperation(req CreateClusterGarbageCollectOperationRequest) (*SiteOperationKey, error) {
 	if err := o.ClusterAction(req.ClusterName, storage.KindCluster, teleservices.VerbUpdate); err != nil {
@@ -495,6 +551,30 @@ func (o *OperatorACL) CreateClusterGarbageCollectOperation(req CreateClusterGarb
 	return o.operator.CreateClusterGarbageCollectOperation(req)
 }
 
+// CreateClusterReconfigureNetworkOperation creates a new network reconfiguration operation in the cluster
+func (o *OperatorACL) CreateClusterReconfigureNetworkOperation(req CreateClusterReconfigureNetworkOperationRequest) (*SiteOperationKey, error) {
+	if err := o.ClusterAction(req.ClusterName, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.CreateClusterReconfigureNetworkOperation(req)
+}
+
+// CreateClusterReconfigureNodeOperation creates a new node reconfiguration operation in the cluster
+func (o *OperatorACL) CreateClusterReconfigureNodeOperation(req CreateClusterReconfigureNodeOperationRequest) (*SiteOperationKey, error) {
+	if err := o.ClusterAction(req.ClusterName, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.CreateClusterReconfigureNodeOperation(req)
+}
+
+// CreateClusterReconfigureDockerOperation creates a new Docker storage driver reconfiguration operation in the cluster
+func (o *OperatorACL) CreateClusterReconfigureDockerOperation(req CreateClusterReconfigureDockerOperationRequest) (*SiteOperationKey, error) {
+	if err := o.ClusterAction(req.ClusterName, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.CreateClusterReconfigureDockerOperation(req)
+}
+
 func (o *OperatorACL) GetSiteOperationLogs(key SiteOperationKey) (io.ReadCloser, error) {
 	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbRead); err != nil {
 		return nil, trace.Wrap(err)
@@ -699,6 +779,30 @@ func (o *OperatorACL) DeleteLogForwarder(key SiteKey, forwarderName string) erro
 	return o.operator.DeleteLogForwarder(key, forwarderName)
 }
 
+// CreateSchedule schedules a new operation
+func (o *OperatorACL) CreateSchedule(req CreateScheduleRequest) (*storage.Schedule, error) {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.CreateSchedule(req)
+}
+
+// GetSchedules returns all scheduled operations of the cluster
+func (o *OperatorACL) GetSchedules(key SiteKey) ([]storage.Schedule, error) {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetSchedules(key)
+}
+
+// DeleteSchedule deletes the scheduled operation by ID
+func (o *OperatorACL) DeleteSchedule(key SiteKey, id string) error {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.DeleteSchedule(key, id)
+}
+
 func (o *OperatorACL) GetRetentionPolicies(key SiteKey) ([]monitoring.RetentionPolicy, error) {
 	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbRead); err != nil {
 		return nil, trace.Wrap(err)
@@ -769,11 +873,25 @@ func (o *OperatorACL) UpdateAlertTarget(key SiteKey, target storage.AlertTarget)
 	return o.operator.UpdateAlertTarget(key, target)
 }
 
-func (o *OperatorACL) DeleteAlertTarget(key SiteKey) error {
+func (o *OperatorACL) DeleteAlertTarget(key SiteKey, name string) error {
 	if err := o.ClusterAction(key.SiteDomain, storage.KindAlertTarget, teleservices.VerbUpdate); err != nil {
 		return trace.Wrap(err)
 	}
-	return o.operator.DeleteAlertTarget(key)
+	return o.operator.DeleteAlertTarget(key, name)
+}
+
+func (o *OperatorACL) NotifyAlert(key SiteKey, alert monitoring.Alert) error {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindAlertTarget, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.NotifyAlert(key, alert)
+}
+
+func (o *OperatorACL) GetAlertDeliveries(key SiteKey) ([]monitoring.AlertDelivery, error) {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindAlertTarget, teleservices.VerbList); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetAlertDeliveries(key)
 }
 
 func (o *OperatorACL) GetApplicationEndpoints(key SiteKey) ([]Endpoint, error) {
@@ -783,6 +901,46 @@ func (o *OperatorACL) GetApplicationEndpoints(key SiteKey) ([]Endpoint, error) {
 	return o.operator.GetApplicationEndpoints(key)
 }
 
+// ListReleases returns all application releases of the specified cluster
+func (o *OperatorACL) ListReleases(key SiteKey) ([]Release, error) {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.ListReleases(key)
+}
+
+// GetRelease returns the application release with the specified name
+func (o *OperatorACL) GetRelease(key SiteKey, name string) (*Release, error) {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetRelease(key, name)
+}
+
+// InstallRelease installs a new application release
+func (o *OperatorACL) InstallRelease(req InstallReleaseRequest) (*Release, error) {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.InstallRelease(req)
+}
+
+// UpgradeRelease upgrades an existing application release
+func (o *OperatorACL) UpgradeRelease(req UpgradeReleaseRequest) (*Release, error) {
+	if err := o.ClusterAction(req.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.UpgradeRelease(req)
+}
+
+// UninstallRelease uninstalls the release with the specified name
+func (o *OperatorACL) UninstallRelease(key SiteKey, name string) (*Release, error) {
+	if err := o.ClusterAction(key.SiteDomain, storage.KindCluster, teleservices.VerbUpdate); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.UninstallRelease(key, name)
+}
+
 // SignTLSKey signs X509 Public Key with X509 certificate authority of this site
 func (o *OperatorACL) SignTLSKey(req TLSSignRequest) (*TLSSignResponse, error) {
 	ctx, cluster, err := o.clusterContext(req.SiteDomain)
@@ -971,3 +1129,107 @@ func (o *OperatorACL) DeleteGithubConnector(key SiteKey, name string) error {
 	}
 	return o.operator.DeleteGithubConnector(key, name)
 }
+
+// UpsertOIDCConnector creates or updates an OIDC connector
+func (o *OperatorACL) UpsertOIDCConnector(key SiteKey, connector teleservices.OIDCConnector) error {
+	if err := o.AuthConnectorActions(teleservices.KindOIDCConnector, teleservices.VerbCreate, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpsertOIDCConnector(key, connector)
+}
+
+// GetOIDCConnector returns an OIDC connector by name
+//
+// Returned connector exclude client secret unless withSecrets is true.
+func (o *OperatorACL) GetOIDCConnector(key SiteKey, name string, withSecrets bool) (teleservices.OIDCConnector, error) {
+	if err := o.AuthConnectorActions(teleservices.KindOIDCConnector, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetOIDCConnector(key, name, withSecrets)
+}
+
+// GetOIDCConnectors returns all OIDC connectors
+//
+// Returned connectors exclude client secret unless withSecrets is true.
+func (o *OperatorACL) GetOIDCConnectors(key SiteKey, withSecrets bool) ([]teleservices.OIDCConnector, error) {
+	if err := o.AuthConnectorActions(teleservices.KindOIDCConnector, teleservices.VerbList, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetOIDCConnectors(key, withSecrets)
+}
+
+// DeleteOIDCConnector deletes an OIDC connector by name
+func (o *OperatorACL) DeleteOIDCConnector(key SiteKey, name string) error {
+	if err := o.AuthConnectorActions(teleservices.KindOIDCConnector, teleservices.VerbDelete); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.DeleteOIDCConnector(key, name)
+}
+
+// UpsertSAMLConnector creates or updates a SAML connector
+func (o *OperatorACL) UpsertSAMLConnector(key SiteKey, connector teleservices.SAMLConnector) error {
+	if err := o.AuthConnectorActions(teleservices.KindSAMLConnector, teleservices.VerbCreate, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpsertSAMLConnector(key, connector)
+}
+
+// GetSAMLConnector returns a SAML connector by name
+//
+// Returned connector exclude signing key unless withSecrets is true.
+func (o *OperatorACL) GetSAMLConnector(key SiteKey, name string, withSecrets bool) (teleservices.SAMLConnector, error) {
+	if err := o.AuthConnectorActions(teleservices.KindSAMLConnector, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetSAMLConnector(key, name, withSecrets)
+}
+
+// GetSAMLConnectors returns all SAML connectors
+//
+// Returned connectors exclude signing key unless withSecrets is true.
+func (o *OperatorACL) GetSAMLConnectors(key SiteKey, withSecrets bool) ([]teleservices.SAMLConnector, error) {
+	if err := o.AuthConnectorActions(teleservices.KindSAMLConnector, teleservices.VerbList, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetSAMLConnectors(key, withSecrets)
+}
+
+// DeleteSAMLConnector deletes a SAML connector by name
+func (o *OperatorACL) DeleteSAMLConnector(key SiteKey, name string) error {
+	if err := o.AuthConnectorActions(teleservices.KindSAMLConnector, teleservices.VerbDelete); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.DeleteSAMLConnector(key, name)
+}
+
+// UpsertRole creates or updates a role
+func (o *OperatorACL) UpsertRole(key SiteKey, role teleservices.Role) error {
+	if err := o.roleActions(teleservices.VerbCreate, teleservices.VerbUpdate); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.UpsertRole(key, role)
+}
+
+// GetRole returns a role by name
+func (o *OperatorACL) GetRole(key SiteKey, name string) (teleservices.Role, error) {
+	if err := o.roleActions(teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetRole(key, name)
+}
+
+// GetRoles returns all roles
+func (o *OperatorACL) GetRoles(key SiteKey) ([]teleservices.Role, error) {
+	if err := o.roleActions(teleservices.VerbList, teleservices.VerbRead); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return o.operator.GetRoles(key)
+}
+
+// DeleteRole deletes a role by name
+func (o *OperatorACL) DeleteRole(key SiteKey, name string) error {
+	if err := o.roleActions(teleservices.VerbDelete); err != nil {
+		return trace.Wrap(err)
+	}
+	return o.operator.DeleteRole(key, name)
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"strings"
 	"time"
@@ -45,6 +46,8 @@ import (
 	teleclient "github.com/gravitational/teleport/lib/client"
 	teleservices "github.com/gravitational/teleport/lib/services"
 	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // TeleportProxyService is SSH proxy access portal - gives
@@ -112,12 +115,15 @@ type Operator interface {
 	APIKeys
 	Sites
 	Status
+	Nodes
 	Operations
 	Validation
 	LogForwarders
+	Schedules
 	Monitoring
 	SMTP
 	Endpoints
+	Releases
 	Tokens
 	Certificates
 	Leader
@@ -549,6 +555,190 @@ type Node struct {
 	InstanceType string `json:"instance_type"`
 }
 
+// Nodes defines operations that change the configuration of cluster nodes.
+//
+// The changes are recorded in the cluster state so they are preserved
+// when the node configuration is regenerated, e.g. during update
+type Nodes interface {
+	// UpdateNodeLabels adds and removes Kubernetes labels of a cluster node
+	UpdateNodeLabels(UpdateNodeLabelsRequest) error
+	// UpdateNodeTaints adds and removes Kubernetes taints of a cluster node
+	UpdateNodeTaints(UpdateNodeTaintsRequest) error
+	// UpdateNodeProfile changes the profile of a cluster node
+	UpdateNodeProfile(UpdateNodeProfileRequest) error
+	// CreatePersistentVolumes creates local persistent volumes
+	// for the filesystems provisioned on a node
+	CreatePersistentVolumes(CreatePersistentVolumesRequest) error
+}
+
+// UpdateNodeLabelsRequest is a request to change labels of a cluster node
+type UpdateNodeLabelsRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Node is the hostname or the advertise address of the node
+	Node string `json:"node"`
+	// Add is a set of labels to add or overwrite
+	Add map[string]string `json:"add,omitempty"`
+	// Remove is a list of keys of the labels to remove
+	Remove []string `json:"remove,omitempty"`
+}
+
+// Check makes sure the request is correct
+func (r UpdateNodeLabelsRequest) Check() error {
+	if r.Node == "" {
+		return trace.BadParameter("missing node")
+	}
+	if len(r.Add) == 0 && len(r.Remove) == 0 {
+		return trace.BadParameter("no labels to add or remove")
+	}
+	for key, value := range r.Add {
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return trace.BadParameter("invalid label key %q: %v", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+			return trace.BadParameter("invalid value of label %q: %v", key, strings.Join(errs, "; "))
+		}
+	}
+	for _, key := range r.Remove {
+		if _, ok := r.Add[key]; ok {
+			return trace.BadParameter("label %q is both added and removed", key)
+		}
+	}
+	return nil
+}
+
+// SiteKey returns the cluster key for this request
+func (r UpdateNodeLabelsRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
+// UpdateNodeTaintsRequest is a request to change taints of a cluster node
+type UpdateNodeTaintsRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Node is the hostname or the advertise address of the node
+	Node string `json:"node"`
+	// Add is a list of taints to add or overwrite
+	Add []v1.Taint `json:"add,omitempty"`
+	// Remove is a list of taints to remove.
+	// Taints without effect remove all taints with the same key
+	Remove []v1.Taint `json:"remove,omitempty"`
+}
+
+// Check makes sure the request is correct
+func (r UpdateNodeTaintsRequest) Check() error {
+	if r.Node == "" {
+		return trace.BadParameter("missing node")
+	}
+	if len(r.Add) == 0 && len(r.Remove) == 0 {
+		return trace.BadParameter("no taints to add or remove")
+	}
+	for _, taint := range r.Add {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) != 0 {
+			return trace.BadParameter("invalid taint key %q: %v", taint.Key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) != 0 {
+			return trace.BadParameter("invalid value of taint %q: %v", taint.Key, strings.Join(errs, "; "))
+		}
+		if err := checkTaintEffect(taint.Effect); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	for _, taint := range r.Remove {
+		if taint.Key == "" {
+			return trace.BadParameter("missing key of the taint to remove")
+		}
+		if taint.Effect == "" {
+			continue
+		}
+		if err := checkTaintEffect(taint.Effect); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// SiteKey returns the cluster key for this request
+func (r UpdateNodeTaintsRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
+func checkTaintEffect(effect v1.TaintEffect) error {
+	switch effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		return nil
+	}
+	return trace.BadParameter("unsupported taint effect %q, supported are: %v, %v, %v", effect,
+		v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute)
+}
+
+// UpdateNodeProfileRequest is a request to change the profile of a cluster node
+type UpdateNodeProfileRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Node is the hostname or the advertise address of the node
+	Node string `json:"node"`
+	// Profile is the name of the new node profile
+	Profile string `json:"profile"`
+	// SystemInfo is the JSON-encoded system information collected on the node.
+	// The node is validated against the requirements of the new profile
+	SystemInfo []byte `json:"system_info,omitempty"`
+	// Force changes the profile without validating the profile requirements
+	Force bool `json:"force,omitempty"`
+}
+
+// Check makes sure the request is correct
+func (r UpdateNodeProfileRequest) Check() error {
+	if r.Node == "" {
+		return trace.BadParameter("missing node")
+	}
+	if r.Profile == "" {
+		return trace.BadParameter("missing profile")
+	}
+	if len(r.SystemInfo) == 0 && !r.Force {
+		return trace.BadParameter("missing system information of the node")
+	}
+	return nil
+}
+
+// SiteKey returns the cluster key for this request
+func (r UpdateNodeProfileRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
+// CreatePersistentVolumesRequest is a request to create local persistent
+// volumes for the filesystems provisioned on a node
+type CreatePersistentVolumesRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Server is the node with provisioned filesystems
+	Server storage.Server `json:"server"`
+}
+
+// Check makes sure the request is correct
+func (r CreatePersistentVolumesRequest) Check() error {
+	if r.Server.Hostname == "" {
+		return trace.BadParameter("missing server hostname")
+	}
+	if r.Server.Role == "" {
+		return trace.BadParameter("missing server profile")
+	}
+	return nil
+}
+
+// SiteKey returns the cluster key for this request
+func (r CreatePersistentVolumesRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
 // Operations installs and uninstalls gravity on a given site,
 // it takes care of provisioning, configuring and deploying end user application
 // as well as our system packages like planet and teleport
@@ -586,10 +776,26 @@ type Operations interface {
 	// it kicks off uninstall of the site immediatelly
 	CreateSiteUninstallOperation(CreateSiteUninstallOperationRequest) (*SiteOperationKey, error)
 
+	// ExecuteUninstallPhase executes or skips the specified phase of
+	// the uninstall operation plan
+	ExecuteUninstallPhase(UninstallPhaseRequest) error
+
 	// CreateClusterGarbageCollectOperation creates a new garbage collection operation
 	// in the cluster
 	CreateClusterGarbageCollectOperation(CreateClusterGarbageCollectOperationRequest) (*SiteOperationKey, error)
 
+	// CreateClusterReconfigureNetworkOperation creates a new operation to change
+	// the pod/service subnets and the overlay network port of the cluster
+	CreateClusterReconfigureNetworkOperation(CreateClusterReconfigureNetworkOperationRequest) (*SiteOperationKey, error)
+
+	// CreateClusterReconfigureNodeOperation creates a new operation to change
+	// the advertise address of a cluster node
+	CreateClusterReconfigureNodeOperation(CreateClusterReconfigureNodeOperationRequest) (*SiteOperationKey, error)
+
+	// CreateClusterReconfigureDockerOperation creates a new operation to migrate
+	// a cluster node to a different Docker storage driver
+	CreateClusterReconfigureDockerOperation(CreateClusterReconfigureDockerOperationRequest) (*SiteOperationKey, error)
+
 	// GetsiteOperation returns the operation information based on it's key
 	GetSiteOperation(SiteOperationKey) (*SiteOperation, error)
 
@@ -651,6 +857,10 @@ type Operations interface {
 	// its leadership
 	ResumeShrink(key SiteKey) (*SiteOperationKey, error)
 
+	// ExecuteShrinkPhase executes or rolls back the specified phase of
+	// the shrink operation plan
+	ExecuteShrinkPhase(ShrinkPhaseRequest) error
+
 	// UpdateInstallOperationState updates the state of an install operation
 	UpdateInstallOperationState(key SiteOperationKey, req OperationUpdateRequest) error
 
@@ -773,6 +983,8 @@ type RotateSecretsRequest struct {
 	ClusterName string `json:"cluster_name"`
 	// Server is the server to rotate secrets for
 	Server storage.Server `json:"server"`
+	// OperationID optionally specifies the operation the secrets are rotated for
+	OperationID string `json:"operation_id,omitempty"`
 }
 
 // SiteKey returns a cluster key from this request
@@ -783,6 +995,15 @@ func (r RotateSecretsRequest) SiteKey() SiteKey {
 	}
 }
 
+// SiteOperationKey returns an operation key from this request
+func (r RotateSecretsRequest) SiteOperationKey() SiteOperationKey {
+	return SiteOperationKey{
+		AccountID:   r.AccountID,
+		SiteDomain:  r.ClusterName,
+		OperationID: r.OperationID,
+	}
+}
+
 // RotateConfigPackageRequest is a request to rotate server's configuration package
 type RotateConfigPackageRequest struct {
 	// AccountID is the account id of the local cluster
@@ -929,6 +1150,12 @@ func (s *SiteOperation) String() string {
 		typeS = "uninstall"
 	case OperationGarbageCollect:
 		typeS = "garbage collect"
+	case OperationReconfigureNetwork:
+		typeS = "reconfigure network"
+	case OperationReconfigureNode:
+		typeS = "reconfigure node"
+	case OperationReconfigureDocker:
+		typeS = "reconfigure docker"
 	}
 	return fmt.Sprintf("operation(%v, cluster=%v, state=%s)", typeS, s.SiteDomain, s.State)
 }
@@ -1000,6 +1227,10 @@ func (r *CreateSiteInstallOperationRequest) CheckAndSetDefaults() error {
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	err = utils.CheckSingleStack(r.Variables.OnPrem.PodCIDR, r.Variables.OnPrem.ServiceCIDR)
+	if err != nil {
+		return trace.Wrap(err)
+	}
 	return nil
 }
 
@@ -1018,6 +1249,32 @@ type CreateSiteUninstallOperationRequest struct {
 	Variables storage.OperationVariables `json:"variables"`
 }
 
+// UninstallPhaseRequest is a request to execute or skip a phase
+// of the uninstall operation plan
+type UninstallPhaseRequest struct {
+	// Key identifies the uninstall operation
+	Key SiteOperationKey `json:"key"`
+	// PhaseID is the ID of the phase to execute.
+	// Executing the root phase resumes the operation
+	PhaseID string `json:"phase_id"`
+	// Force forces phase execution
+	Force bool `json:"force"`
+	// Skip marks the node uninstall phase completed without
+	// executing it, e.g. when the node is unreachable
+	Skip bool `json:"skip"`
+}
+
+// Check makes sure the request is correct
+func (r UninstallPhaseRequest) Check() error {
+	if err := r.Key.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+	if r.PhaseID == "" {
+		return trace.BadParameter("missing PhaseID")
+	}
+	return nil
+}
+
 // CreateSiteExpandOperationRequest is a request to add new nodes
 // to the cluster
 type CreateSiteExpandOperationRequest struct {
@@ -1091,6 +1348,31 @@ func (r *CreateSiteShrinkOperationRequest) CheckAndSetDefaults() error {
 	return nil
 }
 
+// ShrinkPhaseRequest is a request to execute or roll back a phase
+// of the shrink operation plan
+type ShrinkPhaseRequest struct {
+	// Key identifies the shrink operation
+	Key SiteOperationKey `json:"key"`
+	// PhaseID is the ID of the phase to execute or roll back.
+	// Executing the root phase resumes the operation
+	PhaseID string `json:"phase_id"`
+	// Force forces phase execution or rollback
+	Force bool `json:"force"`
+	// Rollback specifies whether to roll back the phase instead of executing it
+	Rollback bool `json:"rollback"`
+}
+
+// Check makes sure the request is correct
+func (r ShrinkPhaseRequest) Check() error {
+	if err := r.Key.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+	if r.PhaseID == "" {
+		return trace.BadParameter("missing PhaseID")
+	}
+	return nil
+}
+
 // CreateSiteAppUpdateOperationRequest is a request to update an application
 // installed on a site to a new version
 type CreateSiteAppUpdateOperationRequest struct {
@@ -1103,6 +1385,10 @@ type CreateSiteAppUpdateOperationRequest struct {
 	// Manual specifies whether a manual update mode is requested.
 	// Deprecated.
 	Manual bool `json:"manual"`
+	// Strategy optionally defines how regular nodes are rolled out
+	Strategy *storage.RolloutStrategy `json:"strategy,omitempty"`
+	// AutoRollback enables automatic rollback of the failed update
+	AutoRollback bool `json:"auto_rollback,omitempty"`
 }
 
 // Check validates this request
@@ -1125,6 +1411,107 @@ type CreateClusterGarbageCollectOperationRequest struct {
 	ClusterName string `json:"cluster_name"`
 }
 
+// Check validates this request
+func (r CreateClusterReconfigureNetworkOperationRequest) Check() error {
+	if r.AccountID == "" {
+		return trace.BadParameter("missing AccountID")
+	}
+	if r.ClusterName == "" {
+		return trace.BadParameter("missing ClusterName")
+	}
+	if r.PodCIDR == "" && r.ServiceCIDR == "" && r.VxlanPort == 0 {
+		return trace.BadParameter("at least one of pod network CIDR, service CIDR or vxlan port is required")
+	}
+	if r.VxlanPort < 0 || r.VxlanPort > 65535 {
+		return trace.BadParameter("invalid vxlan port: %v", r.VxlanPort)
+	}
+	if err := utils.ValidateKubernetesSubnets(r.PodCIDR, r.ServiceCIDR); err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(utils.CheckSingleStack(r.PodCIDR, r.ServiceCIDR))
+}
+
+// CreateClusterReconfigureNetworkOperationRequest is a request to change
+// the network settings of the cluster.
+//
+// Unset settings are left unchanged
+type CreateClusterReconfigureNetworkOperationRequest struct {
+	// AccountID is id of the account
+	AccountID string `json:"account_id"`
+	// ClusterName is the name of the cluster
+	ClusterName string `json:"cluster_name"`
+	// PodCIDR is the new pod network CIDR
+	PodCIDR string `json:"pod_cidr,omitempty"`
+	// ServiceCIDR is the new service network CIDR
+	ServiceCIDR string `json:"service_cidr,omitempty"`
+	// VxlanPort is the new overlay network port
+	VxlanPort int `json:"vxlan_port,omitempty"`
+}
+
+// Check validates this request
+func (r CreateClusterReconfigureNodeOperationRequest) Check() error {
+	if r.AccountID == "" {
+		return trace.BadParameter("missing AccountID")
+	}
+	if r.ClusterName == "" {
+		return trace.BadParameter("missing ClusterName")
+	}
+	if net.ParseIP(r.AdvertiseIP) == nil {
+		return trace.BadParameter("invalid advertise address: %q", r.AdvertiseIP)
+	}
+	if net.ParseIP(r.NewAdvertiseIP) == nil {
+		return trace.BadParameter("invalid new advertise address: %q", r.NewAdvertiseIP)
+	}
+	if net.ParseIP(r.AdvertiseIP).Equal(net.ParseIP(r.NewAdvertiseIP)) {
+		return trace.BadParameter("node already uses advertise address %v", r.AdvertiseIP)
+	}
+	return nil
+}
+
+// CreateClusterReconfigureNodeOperationRequest is a request to change
+// the advertise address of a cluster node
+type CreateClusterReconfigureNodeOperationRequest struct {
+	// AccountID is id of the account
+	AccountID string `json:"account_id"`
+	// ClusterName is the name of the cluster
+	ClusterName string `json:"cluster_name"`
+	// AdvertiseIP is the current advertise address of the node
+	AdvertiseIP string `json:"advertise_ip"`
+	// NewAdvertiseIP is the new advertise address of the node
+	NewAdvertiseIP string `json:"new_advertise_ip"`
+}
+
+// Check validates this request
+func (r CreateClusterReconfigureDockerOperationRequest) Check() error {
+	if r.AccountID == "" {
+		return trace.BadParameter("missing AccountID")
+	}
+	if r.ClusterName == "" {
+		return trace.BadParameter("missing ClusterName")
+	}
+	if net.ParseIP(r.AdvertiseIP) == nil {
+		return trace.BadParameter("invalid advertise address: %q", r.AdvertiseIP)
+	}
+	if !utils.StringInSlice(constants.DockerSupportedTargetDrivers, r.StorageDriver) {
+		return trace.BadParameter("unsupported Docker storage driver %q, supported are: %q",
+			r.StorageDriver, constants.DockerSupportedTargetDrivers)
+	}
+	return nil
+}
+
+// CreateClusterReconfigureDockerOperationRequest is a request to migrate
+// a cluster node to a different Docker storage driver
+type CreateClusterReconfigureDockerOperationRequest struct {
+	// AccountID is id of the account
+	AccountID string `json:"account_id"`
+	// ClusterName is the name of the cluster
+	ClusterName string `json:"cluster_name"`
+	// AdvertiseIP is the advertise address of the node
+	AdvertiseIP string `json:"advertise_ip"`
+	// StorageDriver is the new Docker storage driver of the node
+	StorageDriver string `json:"storage_driver"`
+}
+
 // AgentService coordinates install agents that are started on every server
 // and report system information as well as receive instructions from
 // the operator service
@@ -1584,6 +1971,36 @@ type LogForwarders interface {
 	DeleteLogForwarder(key SiteKey, name string) error
 }
 
+// Schedules defines the interface to manage operations scheduled
+// to run in maintenance windows
+type Schedules interface {
+	// CreateSchedule schedules a new operation
+	CreateSchedule(CreateScheduleRequest) (*storage.Schedule, error)
+	// GetSchedules returns all scheduled operations of the cluster
+	GetSchedules(SiteKey) ([]storage.Schedule, error)
+	// DeleteSchedule deletes the scheduled operation by ID
+	DeleteSchedule(key SiteKey, id string) error
+}
+
+// CreateScheduleRequest is a request to schedule a cluster operation
+type CreateScheduleRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Operation is the type of the operation to schedule
+	Operation string `json:"operation"`
+	// App is the application package to update to, for update operations
+	App string `json:"app,omitempty"`
+	// Window is the maintenance window to run the operation in
+	Window storage.MaintenanceWindow `json:"window"`
+}
+
+// SiteKey returns the cluster key from the request
+func (r CreateScheduleRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
 // SMTP defines the interface to manage cluster SMTP configuration
 type SMTP interface {
 	// GetSMTPConfig returns the cluster SMTP configuration
@@ -1610,8 +2027,14 @@ type Monitoring interface {
 	GetAlertTargets(SiteKey) ([]storage.AlertTarget, error)
 	// UpdateAlertTarget updates cluster's alert target to the specified
 	UpdateAlertTarget(SiteKey, storage.AlertTarget) error
-	// DeleteAlertTarget deletes the monitoring alert target
-	DeleteAlertTarget(SiteKey) error
+	// DeleteAlertTarget deletes the monitoring alert target specified with name.
+	// Empty name deletes the email alert target
+	DeleteAlertTarget(key SiteKey, name string) error
+	// NotifyAlert delivers the alert posted to the cluster to the
+	// configured webhook, chat and incident management alert targets
+	NotifyAlert(SiteKey, monitoring.Alert) error
+	// GetAlertDeliveries returns the recent alert deliveries
+	GetAlertDeliveries(SiteKey) ([]monitoring.AlertDelivery, error)
 }
 
 // UpdateRetentionPolicyRequest is a request to update retention policy
@@ -1659,6 +2082,92 @@ type Endpoint struct {
 	Addresses []string `json:"addresses"`
 }
 
+// Releases defines the application releases management interface
+type Releases interface {
+	// ListReleases returns all application releases of the specified cluster
+	ListReleases(SiteKey) ([]Release, error)
+	// GetRelease returns the application release with the specified name
+	GetRelease(key SiteKey, name string) (*Release, error)
+	// InstallRelease installs an application image or a chart from the
+	// cluster package service as a new release
+	InstallRelease(InstallReleaseRequest) (*Release, error)
+	// UpgradeRelease upgrades an existing release to the specified
+	// application image or chart
+	UpgradeRelease(UpgradeReleaseRequest) (*Release, error)
+	// UninstallRelease uninstalls the release with the specified name
+	UninstallRelease(key SiteKey, name string) (*Release, error)
+}
+
+// Release describes an application release
+type Release struct {
+	// Name is the release name
+	Name string `json:"name"`
+	// Status is the release status
+	Status string `json:"status"`
+	// Chart is the deployed chart name and version
+	Chart string `json:"chart"`
+	// Namespace is the namespace the release is deployed in
+	Namespace string `json:"namespace"`
+	// Updated is when the release was last updated
+	Updated time.Time `json:"updated"`
+	// Revision is the release revision number
+	Revision int `json:"revision"`
+	// Description is the release description
+	Description string `json:"description,omitempty"`
+}
+
+// InstallReleaseRequest is a request to install an application release
+type InstallReleaseRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Locator references the application image or the chart to install
+	// in the cluster package service
+	Locator loc.Locator `json:"locator"`
+	// Name is an optional release name
+	Name string `json:"name,omitempty"`
+	// Namespace is the namespace to install the release into
+	Namespace string `json:"namespace,omitempty"`
+	// Values is the optional values file contents
+	Values []byte `json:"values,omitempty"`
+	// ValuesTemplate specifies whether Values is a template
+	// referencing the cluster facts
+	ValuesTemplate bool `json:"values_template,omitempty"`
+	// Set is a list of values in key=value format
+	Set []string `json:"set,omitempty"`
+}
+
+// SiteKey returns the cluster key from the request
+func (r InstallReleaseRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
+// UpgradeReleaseRequest is a request to upgrade an application release
+type UpgradeReleaseRequest struct {
+	// AccountID is the cluster account ID
+	AccountID string `json:"account_id"`
+	// SiteDomain is the cluster name
+	SiteDomain string `json:"site_domain"`
+	// Release is the name of the release to upgrade
+	Release string `json:"release"`
+	// Locator references the application image or the chart to upgrade
+	// to in the cluster package service
+	Locator loc.Locator `json:"locator"`
+	// Values is the optional values file contents
+	Values []byte `json:"values,omitempty"`
+	// ValuesTemplate specifies whether Values is a template
+	// referencing the cluster facts
+	ValuesTemplate bool `json:"values_template,omitempty"`
+	// Set is a list of values in key=value format
+	Set []string `json:"set,omitempty"`
+}
+
+// SiteKey returns the cluster key from the request
+func (r UpgradeReleaseRequest) SiteKey() SiteKey {
+	return SiteKey{AccountID: r.AccountID, SiteDomain: r.SiteDomain}
+}
+
 // SeedConfig defines optional configuration to apply on OpsCenter start
 type SeedConfig struct {
 	// Account defines an optional account to create on OpsCenter start
@@ -1725,4 +2234,28 @@ type Identity interface {
 	GetGithubConnectors(key SiteKey, withSecrets bool) ([]teleservices.GithubConnector, error)
 	// DeleteGithubConnector deletes a Github connector by name
 	DeleteGithubConnector(key SiteKey, name string) error
+	// UpsertOIDCConnector creates or updates an OIDC connector
+	UpsertOIDCConnector(key SiteKey, conn teleservices.OIDCConnector) error
+	// GetOIDCConnector returns an OIDC connector by its name
+	GetOIDCConnector(key SiteKey, name string, withSecrets bool) (teleservices.OIDCConnector, error)
+	// GetOIDCConnectors returns all OIDC connectors
+	GetOIDCConnectors(key SiteKey, withSecrets bool) ([]teleservices.OIDCConnector, error)
+	// DeleteOIDCConnector deletes an OIDC connector by name
+	DeleteOIDCConnector(key SiteKey, name string) error
+	// UpsertSAMLConnector creates or updates a SAML connector
+	UpsertSAMLConnector(key SiteKey, conn teleservices.SAMLConnector) error
+	// GetSAMLConnector returns a SAML connector by its name
+	GetSAMLConnector(key SiteKey, name string, withSecrets bool) (teleservices.SAMLConnector, error)
+	// GetSAMLConnectors returns all SAML connectors
+	GetSAMLConnectors(key SiteKey, withSecrets bool) ([]teleservices.SAMLConnector, error)
+	// DeleteSAMLConnector deletes a SAML connector by name
+	DeleteSAMLConnector(key SiteKey, name string) error
+	// UpsertRole creates or updates a role
+	UpsertRole(key SiteKey, role teleservices.Role) error
+	// GetRole returns a role by name
+	GetRole(key SiteKey, name string) (teleservices.Role, error)
+	// GetRoles returns all roles
+	GetRoles(key SiteKey) ([]teleservices.Role, error)
+	// DeleteRole deletes a role by name
+	DeleteRole(key SiteKey, name string) error
 }
@@ -357,6 +357,30 @@ func (c *Client) GetClusterNodes(key ops.SiteKey) ([]ops.Node, error) {
 	return nodes, nil
 }
 
+// UpdateNodeLabels adds and removes Kubernetes labels of a cluster node
+func (c *Client) UpdateNodeLabels(req ops.UpdateNodeLabelsRequest) error {
+	_, err := c.PutJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "nodes", req.Node, "labels"), req)
+	return trace.Wrap(err)
+}
+
+// UpdateNodeTaints adds and removes Kubernetes taints of a cluster node
+func (c *Client) UpdateNodeTaints(req ops.UpdateNodeTaintsRequest) error {
+	_, err := c.PutJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "nodes", req.Node, "taints"), req)
+	return trace.Wrap(err)
+}
+
+// UpdateNodeProfile changes the profile of a cluster node
+func (c *Client) UpdateNodeProfile(req ops.UpdateNodeProfileRequest) error {
+	_, err := c.PutJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "nodes", req.Node, "profile"), req)
+	return trace.Wrap(err)
+}
+
+// CreatePersistentVolumes creates local persistent volumes for the filesystems provisioned on a node
+func (c *Client) CreatePersistentVolumes(req ops.CreatePersistentVolumesRequest) error {
+	_, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "persistent-volumes"), req)
+	return trace.Wrap(err)
+}
+
 func (c *Client) ResetUserPassword(req ops.ResetUserPasswordRequest) (string, error) {
 	out, err := c.PutJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "reset-password"), req)
 	if err != nil {
@@ -470,6 +494,14 @@ func (c *Client) ResumeShrink(key ops.SiteKey) (*ops.SiteOperationKey, error) {
 	return &opKey, trace.Wrap(err)
 }
 
+// ExecuteShrinkPhase executes or rolls back the specified phase of
+// the shrink operation plan
+func (c *Client) ExecuteShrinkPhase(req ops.ShrinkPhaseRequest) error {
+	_, err := c.PostJSON(c.Endpoint(
+		"accounts", req.Key.AccountID, "sites", req.Key.SiteDomain, "operations", "shrink", "phase"), req)
+	return trace.Wrap(err)
+}
+
 func (c *Client) GetSiteInstallOperationAgentReport(key ops.SiteOperationKey) (*ops.AgentReport, error) {
 	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "operations", "install",
 		key.OperationID, "agent-report"), url.Values{})
@@ -551,6 +583,56 @@ func (c *Client) CreateClusterGarbageCollectOperation(req ops.CreateClusterGarba
 	return &key, nil
 }
 
+// CreateClusterReconfigureNetworkOperation creates a new network reconfiguration operation in the cluster
+func (c *Client) CreateClusterReconfigureNetworkOperation(req ops.CreateClusterReconfigureNetworkOperationRequest) (*ops.SiteOperationKey, error) {
+	out, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.ClusterName, "operations", "reconfigure", "network"), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var key ops.SiteOperationKey
+	if err := json.Unmarshal(out.Bytes(), &key); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &key, nil
+}
+
+// CreateClusterReconfigureNodeOperation creates a new node reconfiguration operation in the cluster
+func (c *Client) CreateClusterReconfigureNodeOperation(req ops.CreateClusterReconfigureNodeOperationRequest) (*ops.SiteOperationKey, error) {
+	out, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.ClusterName, "operations", "reconfigure", "node"), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var key ops.SiteOperationKey
+	if err := json.Unmarshal(out.Bytes(), &key); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &key, nil
+}
+
+// CreateClusterReconfigureDockerOperation creates a new Docker storage driver reconfiguration operation in the cluster
+func (c *Client) CreateClusterReconfigureDockerOperation(req ops.CreateClusterReconfigureDockerOperationRequest) (*ops.SiteOperationKey, error) {
+	out, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.ClusterName, "operations", "reconfigure", "docker"), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var key ops.SiteOperationKey
+	if err := json.Unmarshal(out.Bytes(), &key); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &key, nil
+}
+
+// ExecuteUninstallPhase executes or skips the specified phase of
+// the uninstall operation plan
+func (c *Client) ExecuteUninstallPhase(req ops.UninstallPhaseRequest) error {
+	_, err := c.PostJSON(c.Endpoint(
+		"accounts", req.Key.AccountID, "sites", req.Key.SiteDomain, "operations", "uninstall", "phase"), req)
+	return trace.Wrap(err)
+}
+
 func (c *Client) SiteUninstallOperationStart(req ops.SiteOperationKey) error {
 	_, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "operations", "uninstall", req.OperationID, "start"), map[string]interface{}{})
 	if err != nil {
@@ -905,6 +987,38 @@ func (c *Client) GetLogForwarders(key ops.SiteKey) ([]storage.LogForwarder, erro
 	return forwarders, nil
 }
 
+// CreateSchedule schedules a new operation
+func (c *Client) CreateSchedule(req ops.CreateScheduleRequest) (*storage.Schedule, error) {
+	out, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "schedules"), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var schedule storage.Schedule
+	if err := json.Unmarshal(out.Bytes(), &schedule); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &schedule, nil
+}
+
+// GetSchedules returns all scheduled operations of the cluster
+func (c *Client) GetSchedules(key ops.SiteKey) ([]storage.Schedule, error) {
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "schedules"), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var schedules []storage.Schedule
+	if err := json.Unmarshal(out.Bytes(), &schedules); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes the scheduled operation by ID
+func (c *Client) DeleteSchedule(key ops.SiteKey, id string) error {
+	_, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "schedules", id))
+	return trace.Wrap(err)
+}
+
 // UpdateForwarders replaces the list of active log forwarders
 // TODO(r0mant,alexeyk) this is a legacy method used only by UI, alexeyk to remove it when
 // refactoring resources and use upsert/delete instead
@@ -1085,11 +1199,35 @@ func (c *Client) UpdateAlertTarget(key ops.SiteKey, target storage.AlertTarget)
 }
 
 // DeleteAlertTarget deletes the cluster monitoring alert target
-func (c *Client) DeleteAlertTarget(key ops.SiteKey) error {
-	_, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "monitoring", "alert-targets"))
+func (c *Client) DeleteAlertTarget(key ops.SiteKey, name string) error {
+	endpoint := c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "monitoring", "alert-targets")
+	if name != "" {
+		endpoint = c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "monitoring", "alert-targets", name)
+	}
+	_, err := c.Delete(endpoint)
 	return trace.Wrap(err)
 }
 
+// NotifyAlert delivers the alert to the cluster alert targets
+func (c *Client) NotifyAlert(key ops.SiteKey, alert monitoring.Alert) error {
+	_, err := c.PostJSON(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "monitoring", "alerts", "notify"), alert)
+	return trace.Wrap(err)
+}
+
+// GetAlertDeliveries returns the recent alert deliveries
+func (c *Client) GetAlertDeliveries(key ops.SiteKey) ([]monitoring.AlertDelivery, error) {
+	response, err := c.Get(c.Endpoint(
+		"accounts", key.AccountID, "sites", key.SiteDomain, "monitoring", "alert-deliveries"), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var deliveries []monitoring.AlertDelivery
+	if err = json.Unmarshal(response.Bytes(), &deliveries); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return deliveries, nil
+}
+
 func (c *Client) GetApplicationEndpoints(key ops.SiteKey) ([]ops.Endpoint, error) {
 	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "endpoints"), url.Values{})
 	if err != nil {
@@ -1102,6 +1240,74 @@ func (c *Client) GetApplicationEndpoints(key ops.SiteKey) ([]ops.Endpoint, error
 	return endpoints, nil
 }
 
+// ListReleases returns all application releases of the specified cluster
+func (c *Client) ListReleases(key ops.SiteKey) ([]ops.Release, error) {
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "releases"), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var releases []ops.Release
+	if err := json.Unmarshal(out.Bytes(), &releases); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return releases, nil
+}
+
+// GetRelease returns the application release with the specified name
+func (c *Client) GetRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	if name == "" {
+		return nil, trace.BadParameter("missing release name")
+	}
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "releases", name), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return unmarshalRelease(out.Bytes())
+}
+
+// InstallRelease installs an application image or a chart from the cluster
+// package service as a new release
+func (c *Client) InstallRelease(req ops.InstallReleaseRequest) (*ops.Release, error) {
+	out, err := c.PostJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "releases"), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return unmarshalRelease(out.Bytes())
+}
+
+// UpgradeRelease upgrades an existing release to the specified application
+// image or chart
+func (c *Client) UpgradeRelease(req ops.UpgradeReleaseRequest) (*ops.Release, error) {
+	if req.Release == "" {
+		return nil, trace.BadParameter("missing release name")
+	}
+	out, err := c.PutJSON(c.Endpoint("accounts", req.AccountID, "sites", req.SiteDomain, "releases", req.Release), req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return unmarshalRelease(out.Bytes())
+}
+
+// UninstallRelease uninstalls the release with the specified name
+func (c *Client) UninstallRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	if name == "" {
+		return nil, trace.BadParameter("missing release name")
+	}
+	out, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "releases", name))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return unmarshalRelease(out.Bytes())
+}
+
+func unmarshalRelease(data []byte) (*ops.Release, error) {
+	var release ops.Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &release, nil
+}
+
 // ValidateServers runs pre-installation checks
 func (c *Client) ValidateServers(req ops.ValidateServersRequest) error {
 	_, err := c.PostJSON(c.Endpoint(
@@ -1388,6 +1594,192 @@ func (c *Client) DeleteGithubConnector(key ops.SiteKey, name string) error {
 	return trace.Wrap(err)
 }
 
+// UpsertOIDCConnector creates or updates an OIDC connector
+func (c *Client) UpsertOIDCConnector(key ops.SiteKey, connector teleservices.OIDCConnector) error {
+	data, err := teleservices.GetOIDCConnectorMarshaler().MarshalOIDCConnector(connector)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = c.PostJSON(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "oidc", "connectors"),
+		&UpsertResourceRawReq{
+			Resource: data,
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// GetOIDCConnector returns an OIDC connector by name
+//
+// Returned connector exclude client secret unless withSecrets is true.
+func (c *Client) GetOIDCConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.OIDCConnector, error) {
+	if name == "" {
+		return nil, trace.BadParameter("missing connector name")
+	}
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "oidc", "connectors", name),
+		url.Values{constants.WithSecretsParam: []string{fmt.Sprintf("%t", withSecrets)}})
+	if err != nil {
+		return nil, err
+	}
+	return teleservices.GetOIDCConnectorMarshaler().UnmarshalOIDCConnector(out.Bytes())
+}
+
+// GetOIDCConnectors returns all OIDC connectors
+//
+// Returned connectors exclude client secret unless withSecrets is true.
+func (c *Client) GetOIDCConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.OIDCConnector, error) {
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "oidc", "connectors"),
+		url.Values{constants.WithSecretsParam: []string{fmt.Sprintf("%t", withSecrets)}})
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	connectors := make([]teleservices.OIDCConnector, len(items))
+	for i, raw := range items {
+		connector, err := teleservices.GetOIDCConnectorMarshaler().UnmarshalOIDCConnector(raw)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		connectors[i] = connector
+	}
+	return connectors, nil
+}
+
+// DeleteOIDCConnector deletes an OIDC connector by name
+func (c *Client) DeleteOIDCConnector(key ops.SiteKey, name string) error {
+	if name == "" {
+		return trace.BadParameter("missing connector name")
+	}
+	_, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "oidc", "connectors", name))
+	return trace.Wrap(err)
+}
+
+// UpsertSAMLConnector creates or updates a SAML connector
+func (c *Client) UpsertSAMLConnector(key ops.SiteKey, connector teleservices.SAMLConnector) error {
+	data, err := teleservices.GetSAMLConnectorMarshaler().MarshalSAMLConnector(connector)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = c.PostJSON(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "saml", "connectors"),
+		&UpsertResourceRawReq{
+			Resource: data,
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// GetSAMLConnector returns a SAML connector by name
+//
+// Returned connector exclude signing key unless withSecrets is true.
+func (c *Client) GetSAMLConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.SAMLConnector, error) {
+	if name == "" {
+		return nil, trace.BadParameter("missing connector name")
+	}
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "saml", "connectors", name),
+		url.Values{constants.WithSecretsParam: []string{fmt.Sprintf("%t", withSecrets)}})
+	if err != nil {
+		return nil, err
+	}
+	return teleservices.GetSAMLConnectorMarshaler().UnmarshalSAMLConnector(out.Bytes())
+}
+
+// GetSAMLConnectors returns all SAML connectors
+//
+// Returned connectors exclude signing key unless withSecrets is true.
+func (c *Client) GetSAMLConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.SAMLConnector, error) {
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "saml", "connectors"),
+		url.Values{constants.WithSecretsParam: []string{fmt.Sprintf("%t", withSecrets)}})
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	connectors := make([]teleservices.SAMLConnector, len(items))
+	for i, raw := range items {
+		connector, err := teleservices.GetSAMLConnectorMarshaler().UnmarshalSAMLConnector(raw)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		connectors[i] = connector
+	}
+	return connectors, nil
+}
+
+// DeleteSAMLConnector deletes a SAML connector by name
+func (c *Client) DeleteSAMLConnector(key ops.SiteKey, name string) error {
+	if name == "" {
+		return trace.BadParameter("missing connector name")
+	}
+	_, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "saml", "connectors", name))
+	return trace.Wrap(err)
+}
+
+// UpsertRole creates or updates a role
+func (c *Client) UpsertRole(key ops.SiteKey, role teleservices.Role) error {
+	data, err := teleservices.GetRoleMarshaler().MarshalRole(role)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = c.PostJSON(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "roles"),
+		&UpsertResourceRawReq{
+			Resource: data,
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// GetRole returns a role by name
+func (c *Client) GetRole(key ops.SiteKey, name string) (teleservices.Role, error) {
+	if name == "" {
+		return nil, trace.BadParameter("missing role name")
+	}
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "roles", name), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return teleservices.GetRoleMarshaler().UnmarshalRole(out.Bytes())
+}
+
+// GetRoles returns all roles
+func (c *Client) GetRoles(key ops.SiteKey) ([]teleservices.Role, error) {
+	out, err := c.Get(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "roles"), url.Values{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	roles := make([]teleservices.Role, len(items))
+	for i, raw := range items {
+		role, err := teleservices.GetRoleMarshaler().UnmarshalRole(raw)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		roles[i] = role
+	}
+	return roles, nil
+}
+
+// DeleteRole deletes a role by name
+func (c *Client) DeleteRole(key ops.SiteKey, name string) error {
+	if name == "" {
+		return trace.BadParameter("missing role name")
+	}
+	_, err := c.Delete(c.Endpoint("accounts", key.AccountID, "sites", key.SiteDomain, "roles", name))
+	return trace.Wrap(err)
+}
+
 // PostJSON issues HTTP POST request to the server with the provided JSON data
 func (c *Client) PostJSON(endpoint string, data interface{}) (*roundtrip.Response, error) {
 	return telehttplib.ConvertResponse(c.Client.PostJSON(endpoint, data))
@@ -21,6 +21,7 @@ import (
 	"net/http"
 
 	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/monitoring"
 	"github.com/gravitational/gravity/lib/ops/opsclient"
 	"github.com/gravitational/gravity/lib/storage"
 
@@ -194,6 +195,7 @@ func (h *WebHandler) updateAlertTarget(w http.ResponseWriter, r *http.Request, p
 /* deleteAlertTarget deletes cluster's monitoring alert target
 
    DELETE /portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets
+   DELETE /portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets/:name
 
    Success Response:
 
@@ -202,7 +204,7 @@ func (h *WebHandler) updateAlertTarget(w http.ResponseWriter, r *http.Request, p
      }
 */
 func (h *WebHandler) deleteAlertTarget(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
-	err := context.Operator.DeleteAlertTarget(siteKey(p))
+	err := context.Operator.DeleteAlertTarget(siteKey(p), p.ByName("name"))
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -210,3 +212,47 @@ func (h *WebHandler) deleteAlertTarget(w http.ResponseWriter, r *http.Request, p
 	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("alert target deleted"))
 	return nil
 }
+
+/* notifyAlert delivers the alert posted by a client to the cluster HTTP alert targets
+
+     POST /portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alerts/notify
+
+     monitoring.Alert
+
+   Success Response:
+
+     {
+       "message": "alert accepted"
+     }
+*/
+func (h *WebHandler) notifyAlert(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var alert monitoring.Alert
+	if err := telehttplib.ReadJSON(r, &alert); err != nil {
+		return trace.Wrap(err)
+	}
+
+	err := context.Operator.NotifyAlert(siteKey(p), alert)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("alert accepted"))
+	return nil
+}
+
+/* getAlertDeliveries returns the recent deliveries of alerts to the cluster alert targets
+
+     GET /portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-deliveries
+
+   Success Response:
+
+     []monitoring.AlertDelivery
+*/
+func (h *WebHandler) getAlertDeliveries(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	deliveries, err := context.Operator.GetAlertDeliveries(siteKey(p))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	roundtrip.ReplyJSON(w, http.StatusOK, deliveries)
+	return nil
+}
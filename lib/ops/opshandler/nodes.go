@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opshandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gravitational/gravity/lib/ops"
+
+	"github.com/gravitational/roundtrip"
+	"github.com/gravitational/trace"
+	"github.com/julienschmidt/httprouter"
+)
+
+/* updateNodeLabels adds and removes Kubernetes labels of a cluster node
+
+     PUT /portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/labels
+
+   Input: ops.UpdateNodeLabelsRequest
+
+   Success Response:
+
+     {
+       "message": "node labels updated"
+     }
+*/
+func (h *WebHandler) updateNodeLabels(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.UpdateNodeLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	req.Node = p.ByName("node")
+	if err := context.Operator.UpdateNodeLabels(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("node labels updated"))
+	return nil
+}
+
+/* updateNodeTaints adds and removes Kubernetes taints of a cluster node
+
+     PUT /portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/taints
+
+   Input: ops.UpdateNodeTaintsRequest
+
+   Success Response:
+
+     {
+       "message": "node taints updated"
+     }
+*/
+func (h *WebHandler) updateNodeTaints(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.UpdateNodeTaintsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	req.Node = p.ByName("node")
+	if err := context.Operator.UpdateNodeTaints(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("node taints updated"))
+	return nil
+}
+
+/* updateNodeProfile changes the profile of a cluster node
+
+     PUT /portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/profile
+
+   Input: ops.UpdateNodeProfileRequest
+
+   Success Response:
+
+     {
+       "message": "node profile updated"
+     }
+*/
+func (h *WebHandler) updateNodeProfile(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.UpdateNodeProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	req.Node = p.ByName("node")
+	if err := context.Operator.UpdateNodeProfile(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("node profile updated"))
+	return nil
+}
+
+/* createPersistentVolumes creates local persistent volumes for the filesystems provisioned on a node
+
+     POST /portal/v1/accounts/:account_id/sites/:site_domain/persistent-volumes
+
+   Input: ops.CreatePersistentVolumesRequest
+
+   Success Response:
+
+     {
+       "message": "persistent volumes created"
+     }
+*/
+func (h *WebHandler) createPersistentVolumes(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.CreatePersistentVolumesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	if err := context.Operator.CreatePersistentVolumes(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("persistent volumes created"))
+	return nil
+}
@@ -141,6 +141,10 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/reset-password", h.needsAuth(h.resetUserPassword))
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/agent", h.needsAuth(h.getClusterAgent))
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/nodes", h.needsAuth(h.getClusterNodes))
+	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/labels", h.needsAuth(h.updateNodeLabels))
+	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/taints", h.needsAuth(h.updateNodeTaints))
+	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/nodes/:node/profile", h.needsAuth(h.updateNodeProfile))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/persistent-volumes", h.needsAuth(h.createPersistentVolumes))
 
 	// Status API
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/status", h.needsAuth(h.checkSiteStatus))
@@ -184,13 +188,18 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 
 	// uninstall - nuke everything
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/uninstall", h.needsAuth(h.createSiteUninstallOperation))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/uninstall/phase", h.needsAuth(h.executeUninstallPhase))
 
 	// shrink - remove servers
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/shrink", h.needsAuth(h.createSiteShrinkOperation))
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/shrink/resume", h.needsAuth(h.resumeShrink))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/shrink/phase", h.needsAuth(h.executeShrinkPhase))
 
 	// garbage collection
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/gc", h.needsAuth(h.createClusterGarbageCollectOperation))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/network", h.needsAuth(h.createClusterReconfigureNetworkOperation))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/node", h.needsAuth(h.createClusterReconfigureNodeOperation))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/docker", h.needsAuth(h.createClusterReconfigureDockerOperation))
 
 	// update - update installed application to a new version
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/operations/update", h.needsAuth(h.createSiteUpdateOperation))
@@ -219,6 +228,11 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/logs/forwarders/:name", h.needsAuth(h.updateLogForwarder))
 	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/logs/forwarders/:name", h.needsAuth(h.deleteLogForwarder))
 
+	// scheduled operations
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/schedules", h.needsAuth(h.createSchedule))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/schedules", h.needsAuth(h.getSchedules))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/schedules/:id", h.needsAuth(h.deleteSchedule))
+
 	// smtp
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/smtp", h.needsAuth(h.getSMTPConfig))
 	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/smtp", h.needsAuth(h.updateSMTPConfig))
@@ -233,6 +247,9 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets", h.needsAuth(h.getAlertTargets))
 	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets", h.needsAuth(h.updateAlertTarget))
 	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets", h.needsAuth(h.deleteAlertTarget))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-targets/:name", h.needsAuth(h.deleteAlertTarget))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alerts/notify", h.needsAuth(h.notifyAlert))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/monitoring/alert-deliveries", h.needsAuth(h.getAlertDeliveries))
 
 	// validation
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/validation/remoteaccess", h.needsAuth(h.validateRemoteAccess))
@@ -240,6 +257,13 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 	// cluster and application endpoints
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/endpoints", h.needsAuth(h.getApplicationEndpoints))
 
+	// application releases
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/releases", h.needsAuth(h.listReleases))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/releases/:name", h.needsAuth(h.getRelease))
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/releases", h.needsAuth(h.installRelease))
+	h.PUT("/portal/v1/accounts/:account_id/sites/:site_domain/releases/:name", h.needsAuth(h.upgradeRelease))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/releases/:name", h.needsAuth(h.uninstallRelease))
+
 	// app installer
 	h.GET("/portal/v1/accounts/:account_id/apps/:repository_id/:package_name/:version/installer", h.needsAuth(h.getAppInstaller))
 
@@ -256,6 +280,32 @@ func NewWebHandler(cfg WebHandlerConfig) (*WebHandler, error) {
 	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/github/connectors/:id",
 		h.needsAuth(h.deleteGithubConnector))
 
+	// OIDC connector handlers
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors",
+		h.needsAuth(h.upsertOIDCConnector))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors/:id",
+		h.needsAuth(h.getOIDCConnector))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors",
+		h.needsAuth(h.getOIDCConnectors))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors/:id",
+		h.needsAuth(h.deleteOIDCConnector))
+
+	// SAML connector handlers
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors",
+		h.needsAuth(h.upsertSAMLConnector))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors/:id",
+		h.needsAuth(h.getSAMLConnector))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors",
+		h.needsAuth(h.getSAMLConnectors))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors/:id",
+		h.needsAuth(h.deleteSAMLConnector))
+
+	// role handlers
+	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/roles", h.needsAuth(h.upsertRole))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/roles/:name", h.needsAuth(h.getRole))
+	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/roles", h.needsAuth(h.getRoles))
+	h.DELETE("/portal/v1/accounts/:account_id/sites/:site_domain/roles/:name", h.needsAuth(h.deleteRole))
+
 	// user handlers
 	h.POST("/portal/v1/accounts/:account_id/sites/:site_domain/users", h.needsAuth(h.upsertUser))
 	h.GET("/portal/v1/accounts/:account_id/sites/:site_domain/users/:name", h.needsAuth(h.getUser))
@@ -1267,6 +1317,37 @@ func (h *WebHandler) resumeShrink(w http.ResponseWriter, r *http.Request, p http
 	return nil
 }
 
+/* executeShrinkPhase executes or rolls back the specified phase of the shrink operation
+
+   POST	/portal/v1/accounts/:account_id/sites/:site_domain/operations/shrink/phase
+
+   {
+       "key": {"account_id": "account id", "site_domain": "site domain", "operation_id": "operation id"},
+       "phase_id": "/unregister",
+       "force": false,
+       "rollback": false
+   }
+
+Success response:
+
+{
+    "message": "ok"
+}
+*/
+func (h *WebHandler) executeShrinkPhase(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.ShrinkPhaseRequest
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	req.Key.AccountID = p.ByName("account_id")
+	req.Key.SiteDomain = p.ByName("site_domain")
+	if err := context.Operator.ExecuteShrinkPhase(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("ok"))
+	return nil
+}
+
 /* createSiteInstallOperation creates site install operation. Note that
 it does not starts actuall uninstall, but rather creates a record to configure
 and track uninstall
@@ -1668,6 +1749,37 @@ func (h *WebHandler) createSiteUninstallOperation(w http.ResponseWriter, r *http
 	return nil
 }
 
+/* executeUninstallPhase executes or skips the specified phase of the uninstall operation
+
+   POST	/portal/v1/accounts/:account_id/sites/:site_domain/operations/uninstall/phase
+
+   {
+       "key": {"account_id": "account id", "site_domain": "site domain", "operation_id": "operation id"},
+       "phase_id": "/system/node-1",
+       "force": false,
+       "skip": false
+   }
+
+Success response:
+
+{
+    "message": "ok"
+}
+*/
+func (h *WebHandler) executeUninstallPhase(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.UninstallPhaseRequest
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	req.Key.AccountID = p.ByName("account_id")
+	req.Key.SiteDomain = p.ByName("site_domain")
+	if err := context.Operator.ExecuteUninstallPhase(req); err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("ok"))
+	return nil
+}
+
 /*getSiteOperationLogs is a web socket method that returns a stream of logs for this operation
 
   GET /portal/v1/accounts/:account_id/sites/:site_domain/operations/common/:operation_id/logs
@@ -1901,6 +2013,121 @@ func (h *WebHandler) createClusterGarbageCollectOperation(w http.ResponseWriter,
 	return nil
 }
 
+/* createClusterReconfigureNetworkOperation creates a new network reconfiguration operation for the cluster
+
+   POST	/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/network
+
+   {
+      "pod_cidr": "10.200.0.0/16",
+      "service_cidr": "10.210.0.0/16",
+      "vxlan_port": 8999
+   }
+
+
+Success response:
+
+   {
+      "account_id": "account id",
+      "site_id": "cluster_name",
+      "operation_id": "operation id"
+   }
+*/
+func (h *WebHandler) createClusterReconfigureNetworkOperation(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	d := json.NewDecoder(r.Body)
+	var req ops.CreateClusterReconfigureNetworkOperationRequest
+	if err := d.Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.ClusterName = key.SiteDomain
+	op, err := context.Operator.CreateClusterReconfigureNetworkOperation(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Infof("got operation: %#v", op)
+	roundtrip.ReplyJSON(w, http.StatusOK, op)
+	return nil
+}
+
+/* createClusterReconfigureNodeOperation creates a new operation to change the advertise address of a cluster node
+
+   POST	/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/node
+
+   {
+      "advertise_ip": "192.168.1.10",
+      "new_advertise_ip": "192.168.2.10"
+   }
+
+
+Success response:
+
+   {
+      "account_id": "account id",
+      "site_id": "cluster_name",
+      "operation_id": "operation id"
+   }
+*/
+func (h *WebHandler) createClusterReconfigureNodeOperation(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	d := json.NewDecoder(r.Body)
+	var req ops.CreateClusterReconfigureNodeOperationRequest
+	if err := d.Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.ClusterName = key.SiteDomain
+	op, err := context.Operator.CreateClusterReconfigureNodeOperation(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Infof("got operation: %#v", op)
+	roundtrip.ReplyJSON(w, http.StatusOK, op)
+	return nil
+}
+
+/* createClusterReconfigureDockerOperation creates a new operation to migrate a cluster node to a different Docker storage driver
+
+   POST	/portal/v1/accounts/:account_id/sites/:site_domain/operations/reconfigure/docker
+
+   {
+      "advertise_ip": "192.168.1.10",
+      "storage_driver": "overlay2"
+   }
+
+
+Success response:
+
+   {
+      "account_id": "account id",
+      "site_id": "cluster_name",
+      "operation_id": "operation id"
+   }
+*/
+func (h *WebHandler) createClusterReconfigureDockerOperation(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	d := json.NewDecoder(r.Body)
+	var req ops.CreateClusterReconfigureDockerOperationRequest
+	if err := d.Decode(&req); err != nil {
+		return trace.BadParameter(err.Error())
+	}
+
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.ClusterName = key.SiteDomain
+	op, err := context.Operator.CreateClusterReconfigureDockerOperation(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Infof("got operation: %#v", op)
+	roundtrip.ReplyJSON(w, http.StatusOK, op)
+	return nil
+}
+
 /* getLogForwarders returns a list of configured log forwarders
 
    GET /portal/v1/accounts/:account_id/sites/:site_domain/logs/forwarders
@@ -1987,6 +2214,65 @@ func (h *WebHandler) deleteLogForwarder(w http.ResponseWriter, r *http.Request,
 	return nil
 }
 
+/* createSchedule schedules a new operation
+
+   POST /portal/v1/accounts/:account_id/sites/:site_domain/schedules
+
+Input: ops.CreateScheduleRequest
+
+Success response:
+
+   storage.Schedule
+*/
+func (h *WebHandler) createSchedule(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.CreateScheduleRequest
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	schedule, err := context.Operator.CreateSchedule(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, schedule)
+	return nil
+}
+
+/* getSchedules returns all scheduled operations of the cluster
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/schedules
+
+Success response:
+
+   []storage.Schedule
+*/
+func (h *WebHandler) getSchedules(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	schedules, err := context.Operator.GetSchedules(siteKey(p))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if schedules == nil {
+		schedules = []storage.Schedule{}
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, schedules)
+	return nil
+}
+
+/* deleteSchedule deletes the scheduled operation
+
+   DELETE /portal/v1/accounts/:account_id/sites/:site_domain/schedules/:id
+*/
+func (h *WebHandler) deleteSchedule(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	err := context.Operator.DeleteSchedule(siteKey(p), p.ByName("id"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, statusOK("schedule deleted"))
+	return nil
+}
+
 /* getSMTPConfig returns the cluster SMTP configuration
 
      GET /portal/v1/accounts/:account_id/sites/:site_domain/smtp
@@ -2073,6 +2359,113 @@ func (h *WebHandler) getApplicationEndpoints(w http.ResponseWriter, r *http.Requ
 	return nil
 }
 
+/* listReleases returns all application releases of the cluster
+
+     GET /portal/v1/accounts/:account_id/sites/:site_domain/releases
+
+   Success Response:
+
+     []ops.Release
+*/
+func (h *WebHandler) listReleases(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	releases, err := context.Operator.ListReleases(siteKey(p))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if releases == nil {
+		releases = []ops.Release{}
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, releases)
+	return nil
+}
+
+/* getRelease returns the application release with the specified name
+
+     GET /portal/v1/accounts/:account_id/sites/:site_domain/releases/:name
+
+   Success Response:
+
+     ops.Release
+*/
+func (h *WebHandler) getRelease(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	release, err := context.Operator.GetRelease(siteKey(p), p.ByName("name"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, release)
+	return nil
+}
+
+/* installRelease installs a new application release
+
+     POST /portal/v1/accounts/:account_id/sites/:site_domain/releases
+
+   Input: ops.InstallReleaseRequest
+
+   Success Response:
+
+     ops.Release
+*/
+func (h *WebHandler) installRelease(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.InstallReleaseRequest
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	release, err := context.Operator.InstallRelease(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, release)
+	return nil
+}
+
+/* upgradeRelease upgrades the application release with the specified name
+
+     PUT /portal/v1/accounts/:account_id/sites/:site_domain/releases/:name
+
+   Input: ops.UpgradeReleaseRequest
+
+   Success Response:
+
+     ops.Release
+*/
+func (h *WebHandler) upgradeRelease(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	var req ops.UpgradeReleaseRequest
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	key := siteKey(p)
+	req.AccountID = key.AccountID
+	req.SiteDomain = key.SiteDomain
+	req.Release = p.ByName("name")
+	release, err := context.Operator.UpgradeRelease(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, release)
+	return nil
+}
+
+/* uninstallRelease uninstalls the application release with the specified name
+
+     DELETE /portal/v1/accounts/:account_id/sites/:site_domain/releases/:name
+
+   Success Response:
+
+     ops.Release
+*/
+func (h *WebHandler) uninstallRelease(w http.ResponseWriter, r *http.Request, p httprouter.Params, context *HandlerContext) error {
+	release, err := context.Operator.UninstallRelease(siteKey(p), p.ByName("name"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, release)
+	return nil
+}
+
 /* getAppInstaller returns a standalone installer for the specified application
 
 GET /portal/v1/accounts/:account_id/apps/:repository_id/:package_name/:version/installer
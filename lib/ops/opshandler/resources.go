@@ -231,6 +231,232 @@ func (h *WebHandler) deleteGithubConnector(w http.ResponseWriter, r *http.Reques
 	return nil
 }
 
+/* upsertOIDCConnector creates or updates an OIDC connector
+
+   POST /portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors
+*/
+func (h *WebHandler) upsertOIDCConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	var req *opsclient.UpsertResourceRawReq
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	connector, err := teleservices.GetOIDCConnectorMarshaler().UnmarshalOIDCConnector(req.Resource)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if req.TTL != 0 {
+		connector.SetTTL(clockwork.NewRealClock(), req.TTL)
+	}
+	err = ctx.Identity.UpsertOIDCConnector(connector)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("upserted OIDC connector"))
+	return nil
+}
+
+/* getOIDCConnector returns an OIDC connector by name
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors/:id
+*/
+func (h *WebHandler) getOIDCConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	withSecrets, _, err := telehttplib.ParseBool(r.URL.Query(), constants.WithSecretsParam)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	connector, err := ctx.Identity.GetOIDCConnector(p.ByName("id"), withSecrets)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	out, err := teleservices.GetOIDCConnectorMarshaler().MarshalOIDCConnector(connector)
+	return rawMessage(w, out, err)
+}
+
+/* getOIDCConnectors returns all OIDC connectors
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors
+*/
+func (h *WebHandler) getOIDCConnectors(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	withSecrets, _, err := telehttplib.ParseBool(r.URL.Query(), constants.WithSecretsParam)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	connectors, err := ctx.Identity.GetOIDCConnectors(withSecrets)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	items := make([]json.RawMessage, len(connectors))
+	for i, connector := range connectors {
+		data, err := teleservices.GetOIDCConnectorMarshaler().MarshalOIDCConnector(connector)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		items[i] = data
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, items)
+	return nil
+}
+
+/* deleteOIDCConnector deletes an OIDC connector by its name
+
+   DELETE /portal/v1/accounts/:account_id/sites/:site_domain/oidc/connectors/:id
+*/
+func (h *WebHandler) deleteOIDCConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	err := ctx.Identity.DeleteOIDCConnector(p.ByName("id"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("OIDC connector deleted"))
+	return nil
+}
+
+/* upsertSAMLConnector creates or updates a SAML connector
+
+   POST /portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors
+*/
+func (h *WebHandler) upsertSAMLConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	var req *opsclient.UpsertResourceRawReq
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	connector, err := teleservices.GetSAMLConnectorMarshaler().UnmarshalSAMLConnector(req.Resource)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if req.TTL != 0 {
+		connector.SetTTL(clockwork.NewRealClock(), req.TTL)
+	}
+	err = ctx.Identity.UpsertSAMLConnector(connector)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("upserted SAML connector"))
+	return nil
+}
+
+/* getSAMLConnector returns a SAML connector by name
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors/:id
+*/
+func (h *WebHandler) getSAMLConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	withSecrets, _, err := telehttplib.ParseBool(r.URL.Query(), constants.WithSecretsParam)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	connector, err := ctx.Identity.GetSAMLConnector(p.ByName("id"), withSecrets)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	out, err := teleservices.GetSAMLConnectorMarshaler().MarshalSAMLConnector(connector)
+	return rawMessage(w, out, err)
+}
+
+/* getSAMLConnectors returns all SAML connectors
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors
+*/
+func (h *WebHandler) getSAMLConnectors(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	withSecrets, _, err := telehttplib.ParseBool(r.URL.Query(), constants.WithSecretsParam)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	connectors, err := ctx.Identity.GetSAMLConnectors(withSecrets)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	items := make([]json.RawMessage, len(connectors))
+	for i, connector := range connectors {
+		data, err := teleservices.GetSAMLConnectorMarshaler().MarshalSAMLConnector(connector)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		items[i] = data
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, items)
+	return nil
+}
+
+/* deleteSAMLConnector deletes a SAML connector by its name
+
+   DELETE /portal/v1/accounts/:account_id/sites/:site_domain/saml/connectors/:id
+*/
+func (h *WebHandler) deleteSAMLConnector(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	err := ctx.Identity.DeleteSAMLConnector(p.ByName("id"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("SAML connector deleted"))
+	return nil
+}
+
+/* upsertRole creates or updates a role
+
+   POST /portal/v1/accounts/:account_id/sites/:site_domain/roles
+*/
+func (h *WebHandler) upsertRole(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	var req opsclient.UpsertResourceRawReq
+	if err := telehttplib.ReadJSON(r, &req); err != nil {
+		return trace.Wrap(err)
+	}
+	role, err := teleservices.GetRoleMarshaler().UnmarshalRole(req.Resource)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = ctx.Identity.UpsertRole(role, req.TTL)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("role upserted"))
+	return nil
+}
+
+/* getRole returns a role by name
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/roles/:name
+*/
+func (h *WebHandler) getRole(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	role, err := ctx.Identity.GetRole(p.ByName("name"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	out, err := teleservices.GetRoleMarshaler().MarshalRole(role)
+	return rawMessage(w, out, err)
+}
+
+/* getRoles returns all roles
+
+   GET /portal/v1/accounts/:account_id/sites/:site_domain/roles
+*/
+func (h *WebHandler) getRoles(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	roles, err := ctx.Identity.GetRoles()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	items := make([]json.RawMessage, len(roles))
+	for i, role := range roles {
+		data, err := teleservices.GetRoleMarshaler().MarshalRole(role)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		items[i] = data
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, items)
+	return nil
+}
+
+/* deleteRole deletes a role by name
+
+   DELETE /portal/v1/accounts/:account_id/sites/:site_domain/roles/:name
+*/
+func (h *WebHandler) deleteRole(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *HandlerContext) error {
+	err := ctx.Identity.DeleteRole(p.ByName("name"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusOK, message("role %v deleted", p.ByName("name")))
+	return nil
+}
+
 func rawMessage(w http.ResponseWriter, data []byte, err error) error {
 	if err != nil {
 		return trace.Wrap(err)
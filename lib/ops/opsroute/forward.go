@@ -172,6 +172,42 @@ func (r *Router) GetClusterNodes(key ops.SiteKey) ([]ops.Node, error) {
 	return client.GetClusterNodes(key)
 }
 
+// UpdateNodeLabels adds and removes Kubernetes labels of a cluster node
+func (r *Router) UpdateNodeLabels(req ops.UpdateNodeLabelsRequest) error {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpdateNodeLabels(req)
+}
+
+// UpdateNodeTaints adds and removes Kubernetes taints of a cluster node
+func (r *Router) UpdateNodeTaints(req ops.UpdateNodeTaintsRequest) error {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpdateNodeTaints(req)
+}
+
+// UpdateNodeProfile changes the profile of a cluster node
+func (r *Router) UpdateNodeProfile(req ops.UpdateNodeProfileRequest) error {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpdateNodeProfile(req)
+}
+
+// CreatePersistentVolumes creates local persistent volumes for the filesystems provisioned on a node
+func (r *Router) CreatePersistentVolumes(req ops.CreatePersistentVolumesRequest) error {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.CreatePersistentVolumes(req)
+}
+
 func (r *Router) ResetUserPassword(req ops.ResetUserPasswordRequest) (string, error) {
 	client, err := r.PickClient(req.SiteDomain)
 	if err != nil {
@@ -293,6 +329,10 @@ func (r *Router) ResumeShrink(key ops.SiteKey) (*ops.SiteOperationKey, error) {
 	return r.Local.ResumeShrink(key)
 }
 
+func (r *Router) ExecuteShrinkPhase(req ops.ShrinkPhaseRequest) error {
+	return r.Local.ExecuteShrinkPhase(req)
+}
+
 func (r *Router) CreateSiteExpandOperation(req ops.CreateSiteExpandOperationRequest) (*ops.SiteOperationKey, error) {
 	client, err := r.PickOperationClient(req.SiteDomain)
 	if err != nil {
@@ -333,11 +373,30 @@ func (r *Router) CreateSiteUninstallOperation(req ops.CreateSiteUninstallOperati
 	return r.Local.CreateSiteUninstallOperation(req)
 }
 
+func (r *Router) ExecuteUninstallPhase(req ops.UninstallPhaseRequest) error {
+	return r.Local.ExecuteUninstallPhase(req)
+}
+
 // CreateClusterGarbageCollectOperation creates a new garbage collection operation in the cluster
 func (r *Router) CreateClusterGarbageCollectOperation(req ops.CreateClusterGarbageCollectOperationRequest) (*ops.SiteOperationKey, error) {
 	return r.Local.CreateClusterGarbageCollectOperation(req)
 }
 
+// CreateClusterReconfigureNetworkOperation creates a new network reconfiguration operation in the cluster
+func (r *Router) CreateClusterReconfigureNetworkOperation(req ops.CreateClusterReconfigureNetworkOperationRequest) (*ops.SiteOperationKey, error) {
+	return r.Local.CreateClusterReconfigureNetworkOperation(req)
+}
+
+// CreateClusterReconfigureNodeOperation creates a new node reconfiguration operation in the cluster
+func (r *Router) CreateClusterReconfigureNodeOperation(req ops.CreateClusterReconfigureNodeOperationRequest) (*ops.SiteOperationKey, error) {
+	return r.Local.CreateClusterReconfigureNodeOperation(req)
+}
+
+// CreateClusterReconfigureDockerOperation creates a new Docker storage driver reconfiguration operation in the cluster
+func (r *Router) CreateClusterReconfigureDockerOperation(req ops.CreateClusterReconfigureDockerOperationRequest) (*ops.SiteOperationKey, error) {
+	return r.Local.CreateClusterReconfigureDockerOperation(req)
+}
+
 func (r *Router) GetSiteOperationLogs(key ops.SiteOperationKey) (io.ReadCloser, error) {
 	client, err := r.PickOperationClient(key.SiteDomain)
 	if err != nil {
@@ -555,6 +614,33 @@ func (r *Router) DeleteLogForwarder(key ops.SiteKey, forwarderName string) error
 	return client.DeleteLogForwarder(key, forwarderName)
 }
 
+// CreateSchedule schedules a new operation
+func (r *Router) CreateSchedule(req ops.CreateScheduleRequest) (*storage.Schedule, error) {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.CreateSchedule(req)
+}
+
+// GetSchedules returns all scheduled operations of the cluster
+func (r *Router) GetSchedules(key ops.SiteKey) ([]storage.Schedule, error) {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetSchedules(key)
+}
+
+// DeleteSchedule deletes the scheduled operation by ID
+func (r *Router) DeleteSchedule(key ops.SiteKey, id string) error {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.DeleteSchedule(key, id)
+}
+
 // GetRetentionPolicies returns a list of retention policies for the site
 func (r *Router) GetRetentionPolicies(key ops.SiteKey) ([]monitoring.RetentionPolicy, error) {
 	client, err := r.RemoteClient(key.SiteDomain)
@@ -646,12 +732,30 @@ func (r *Router) UpdateAlertTarget(key ops.SiteKey, target storage.AlertTarget)
 }
 
 // DeleteAlertTarget deletes the cluster monitoring alert target
-func (r *Router) DeleteAlertTarget(key ops.SiteKey) error {
+func (r *Router) DeleteAlertTarget(key ops.SiteKey, name string) error {
 	client, err := r.RemoteClient(key.SiteDomain)
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	return client.DeleteAlertTarget(key)
+	return client.DeleteAlertTarget(key, name)
+}
+
+// NotifyAlert delivers the alert to the cluster alert targets
+func (r *Router) NotifyAlert(key ops.SiteKey, alert monitoring.Alert) error {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.NotifyAlert(key, alert)
+}
+
+// GetAlertDeliveries returns the recent alert deliveries
+func (r *Router) GetAlertDeliveries(key ops.SiteKey) ([]monitoring.AlertDelivery, error) {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetAlertDeliveries(key)
 }
 
 func (r *Router) GetApplicationEndpoints(key ops.SiteKey) ([]ops.Endpoint, error) {
@@ -662,6 +766,51 @@ func (r *Router) GetApplicationEndpoints(key ops.SiteKey) ([]ops.Endpoint, error
 	return client.GetApplicationEndpoints(key)
 }
 
+// ListReleases returns all application releases of the specified cluster
+func (r *Router) ListReleases(key ops.SiteKey) ([]ops.Release, error) {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.ListReleases(key)
+}
+
+// GetRelease returns the application release with the specified name
+func (r *Router) GetRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetRelease(key, name)
+}
+
+// InstallRelease installs a new application release
+func (r *Router) InstallRelease(req ops.InstallReleaseRequest) (*ops.Release, error) {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.InstallRelease(req)
+}
+
+// UpgradeRelease upgrades an existing application release
+func (r *Router) UpgradeRelease(req ops.UpgradeReleaseRequest) (*ops.Release, error) {
+	client, err := r.RemoteClient(req.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.UpgradeRelease(req)
+}
+
+// UninstallRelease uninstalls the release with the specified name
+func (r *Router) UninstallRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	client, err := r.RemoteClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.UninstallRelease(key, name)
+}
+
 func (r *Router) CreateInstallToken(req ops.NewInstallTokenRequest) (*storage.InstallToken, error) {
 	return r.Local.CreateInstallToken(req)
 }
@@ -822,3 +971,111 @@ func (r *Router) DeleteGithubConnector(key ops.SiteKey, name string) error {
 	}
 	return client.DeleteGithubConnector(key, name)
 }
+
+// UpsertOIDCConnector creates or updates an OIDC connector
+func (r *Router) UpsertOIDCConnector(key ops.SiteKey, connector teleservices.OIDCConnector) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpsertOIDCConnector(key, connector)
+}
+
+// GetOIDCConnector returns an OIDC connector by name
+func (r *Router) GetOIDCConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.OIDCConnector, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetOIDCConnector(key, name, withSecrets)
+}
+
+// GetOIDCConnectors returns all OIDC connectors
+func (r *Router) GetOIDCConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.OIDCConnector, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetOIDCConnectors(key, withSecrets)
+}
+
+// DeleteOIDCConnector deletes an OIDC connector by name
+func (r *Router) DeleteOIDCConnector(key ops.SiteKey, name string) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.DeleteOIDCConnector(key, name)
+}
+
+// UpsertSAMLConnector creates or updates a SAML connector
+func (r *Router) UpsertSAMLConnector(key ops.SiteKey, connector teleservices.SAMLConnector) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpsertSAMLConnector(key, connector)
+}
+
+// GetSAMLConnector returns a SAML connector by name
+func (r *Router) GetSAMLConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.SAMLConnector, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetSAMLConnector(key, name, withSecrets)
+}
+
+// GetSAMLConnectors returns all SAML connectors
+func (r *Router) GetSAMLConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.SAMLConnector, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetSAMLConnectors(key, withSecrets)
+}
+
+// DeleteSAMLConnector deletes a SAML connector by name
+func (r *Router) DeleteSAMLConnector(key ops.SiteKey, name string) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.DeleteSAMLConnector(key, name)
+}
+
+// UpsertRole creates or updates a role
+func (r *Router) UpsertRole(key ops.SiteKey, role teleservices.Role) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.UpsertRole(key, role)
+}
+
+// GetRole returns a role by name
+func (r *Router) GetRole(key ops.SiteKey, name string) (teleservices.Role, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetRole(key, name)
+}
+
+// GetRoles returns all roles
+func (r *Router) GetRoles(key ops.SiteKey) ([]teleservices.Role, error) {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client.GetRoles(key)
+}
+
+// DeleteRole deletes a role by name
+func (r *Router) DeleteRole(key ops.SiteKey, name string) error {
+	client, err := r.PickClient(key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return client.DeleteRole(key, name)
+}
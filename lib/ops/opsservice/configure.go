@@ -936,11 +936,11 @@ func (s *site) getPlanetConfigPackage(
 		args = append(args, fmt.Sprintf("--device=%v", device.Format()))
 	}
 
-	for _, taint := range profile.Taints {
+	for _, taint := range getNodeTaints(node.Server, *profile) {
 		args = append(args, fmt.Sprintf("--taint=%v=%v:%v", taint.Key, taint.Value, taint.Effect))
 	}
 
-	for k, v := range getNodeLabels(node, profile) {
+	for k, v := range getNodeLabels(node.Server, *profile) {
 		args = append(args, fmt.Sprintf("--node-label=%v=%v", k, v))
 	}
 
@@ -968,23 +968,6 @@ func (s *site) getPlanetConfigPackage(
 	}, nil
 }
 
-// getNodeLabels returns labels a Kubernetes node should register with
-func getNodeLabels(node *ProvisionedServer, profile *schema.NodeProfile) map[string]string {
-	labels := profile.Labels
-	if labels == nil {
-		labels = make(map[string]string)
-	}
-	if _, ok := labels[defaults.KubernetesRoleLabel]; ok {
-		role := schema.ServiceRoleNode
-		if node.IsMaster() {
-			role = schema.ServiceRoleMaster
-		}
-		labels[defaults.KubernetesRoleLabel] = string(role)
-	}
-	labels[defaults.KubernetesAdvertiseIPLabel] = node.AdvertiseIP
-	return labels
-}
-
 func (s *site) configurePlanetServer(node *ProvisionedServer, installOrExpand ops.SiteOperation, config planetConfig) error {
 	resp, err := s.getPlanetConfigPackage(node, installOrExpand, config, s.app.Manifest)
 	if err != nil {
@@ -1016,7 +999,7 @@ func (s *site) getTeleportMasterConfig(ctx *operationContext, master *Provisione
 	secretsDir := defaults.InGravity(defaults.SecretsDir)
 	// Config represents JSON config for etcd backend
 	params, err := toObject(teleetcd.Config{
-		Nodes:       []string{fmt.Sprintf("https://%v:%v", master.AdvertiseIP, etcdEndpointPort)},
+		Nodes:       []string{fmt.Sprintf("https://%v", utils.JoinHostPort(master.AdvertiseIP, etcdEndpointPort))},
 		Key:         "/teleport",
 		TLSKeyFile:  filepath.Join(secretsDir, "etcd.key"),
 		TLSCertFile: filepath.Join(secretsDir, "etcd.cert"),
@@ -122,7 +122,7 @@ func (c *operationContext) profiles() (result map[string]storage.ServerProfile)
 // getNumServers returns the number of servers configured for the operation
 func (c *operationContext) getNumServers() (servers int) {
 	switch c.operation.Type {
-	case ops.OperationShrink:
+	case ops.OperationShrink, ops.OperationUninstall:
 		return len(c.serversToRemove)
 	default:
 		for _, profile := range c.profiles() {
@@ -17,9 +17,11 @@ limitations under the License.
 package opsservice
 
 import (
+	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/ops"
 
 	teleservices "github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/trace"
 )
 
 // UpsertUser creates or updates a user
@@ -75,3 +77,85 @@ func (o *Operator) GetGithubConnectors(key ops.SiteKey, withSecrets bool) ([]tel
 func (o *Operator) DeleteGithubConnector(key ops.SiteKey, name string) error {
 	return o.cfg.Users.DeleteGithubConnector(name)
 }
+
+// UpsertOIDCConnector creates or updates an OIDC connector
+func (o *Operator) UpsertOIDCConnector(key ops.SiteKey, connector teleservices.OIDCConnector) error {
+	return o.cfg.Users.UpsertOIDCConnector(connector)
+}
+
+// GetOIDCConnector returns an OIDC connector by name
+//
+// Returned connector exclude client secret unless withSecrets is true.
+func (o *Operator) GetOIDCConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.OIDCConnector, error) {
+	return o.cfg.Users.GetOIDCConnector(name, withSecrets)
+}
+
+// GetOIDCConnectors returns all OIDC connectors
+//
+// Returned connectors exclude client secret unless withSecrets is true.
+func (o *Operator) GetOIDCConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.OIDCConnector, error) {
+	return o.cfg.Users.GetOIDCConnectors(withSecrets)
+}
+
+// DeleteOIDCConnector deletes an OIDC connector by name
+func (o *Operator) DeleteOIDCConnector(key ops.SiteKey, name string) error {
+	return o.cfg.Users.DeleteOIDCConnector(name)
+}
+
+// UpsertSAMLConnector creates or updates a SAML connector
+func (o *Operator) UpsertSAMLConnector(key ops.SiteKey, connector teleservices.SAMLConnector) error {
+	return o.cfg.Users.UpsertSAMLConnector(connector)
+}
+
+// GetSAMLConnector returns a SAML connector by name
+//
+// Returned connector exclude signing key unless withSecrets is true.
+func (o *Operator) GetSAMLConnector(key ops.SiteKey, name string, withSecrets bool) (teleservices.SAMLConnector, error) {
+	return o.cfg.Users.GetSAMLConnector(name, withSecrets)
+}
+
+// GetSAMLConnectors returns all SAML connectors
+//
+// Returned connectors exclude signing key unless withSecrets is true.
+func (o *Operator) GetSAMLConnectors(key ops.SiteKey, withSecrets bool) ([]teleservices.SAMLConnector, error) {
+	return o.cfg.Users.GetSAMLConnectors(withSecrets)
+}
+
+// DeleteSAMLConnector deletes a SAML connector by name
+func (o *Operator) DeleteSAMLConnector(key ops.SiteKey, name string) error {
+	return o.cfg.Users.DeleteSAMLConnector(name)
+}
+
+// UpsertRole creates or updates a role
+//
+// System roles cannot be modified
+func (o *Operator) UpsertRole(key ops.SiteKey, role teleservices.Role) error {
+	if role.GetMetadata().Labels[constants.SystemLabel] == constants.True {
+		return trace.AccessDenied("modifying roles with %v label is prohibited", constants.SystemLabel)
+	}
+	return o.cfg.Users.UpsertRole(role, 0)
+}
+
+// GetRole returns a role by name
+func (o *Operator) GetRole(key ops.SiteKey, name string) (teleservices.Role, error) {
+	return o.cfg.Users.GetRole(name)
+}
+
+// GetRoles returns all roles
+func (o *Operator) GetRoles(key ops.SiteKey) ([]teleservices.Role, error) {
+	return o.cfg.Users.GetRoles()
+}
+
+// DeleteRole deletes a role by name
+//
+// System roles cannot be deleted
+func (o *Operator) DeleteRole(key ops.SiteKey, name string) error {
+	role, err := o.cfg.Users.GetRole(name)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if role.GetMetadata().Labels[constants.SystemLabel] == constants.True {
+		return trace.AccessDenied("deleting roles with %v label is prohibited", constants.SystemLabel)
+	}
+	return o.cfg.Users.DeleteRole(name)
+}
@@ -675,6 +675,10 @@ func (s *site) configureOnPremServers(ctx *operationContext, servers []storage.S
 		}
 		servers[i].Docker.Device = info.GetDevices().GetByName(dockerDevice)
 		servers[i].Docker.LVMSystemDirectory = info.GetLVMSystemDirectory()
+		err = AssignBlockDevices(s.app.Manifest, &servers[i], info.GetDevices())
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
 		servers[i].User = info.GetUser()
 		servers[i].Provisioner = schema.ProvisionerOnPrem
 		servers[i].Created = time.Now().UTC()
@@ -0,0 +1,363 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+// renderCollectorConfig renders the rsyslog configuration of the log collector
+// that ships logs to the specified forwarders.
+//
+// The collector reads container logs from files named
+// <pod>_<namespace>_<container>-<id>.log so the namespace and pod filters
+// are matched against the log file name. Label filters require pod metadata
+// and are evaluated with the mmkubernetes module.
+// TLS material is read from the log forwarders secret mounted into the collector
+func renderCollectorConfig(forwarders []storage.LogForwarder) (string, error) {
+	forwarders = append([]storage.LogForwarder(nil), forwarders...)
+	sort.Slice(forwarders, func(i, j int) bool {
+		return forwarders[i].GetName() < forwarders[j].GetName()
+	})
+
+	var modules []string
+	var labels bool
+	for _, forwarder := range forwarders {
+		switch forwarder.GetOutput() {
+		case storage.LogForwarderOutputHTTP:
+			modules = appendModule(modules, "omhttp")
+		case storage.LogForwarderOutputElasticsearch:
+			modules = appendModule(modules, "omelasticsearch")
+		}
+		if filter := forwarder.GetFilter(); filter != nil && len(filter.Labels) != 0 {
+			labels = true
+		}
+	}
+	if labels {
+		modules = appendModule(modules, "mmkubernetes")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Log forwarders generated by gravity from logforwarder resources, do not edit\n")
+	for _, module := range modules {
+		fmt.Fprintf(&buf, "module(load=%v)\n", quote(module))
+	}
+	if len(forwarders) == 0 {
+		return buf.String(), nil
+	}
+	fmt.Fprintf(&buf, `template(name=%v type="list" option.jsonf="on") {
+  property(outname="@timestamp" name="timereported" dateFormat="rfc3339" format="jsonf")
+  property(outname="host" name="hostname" format="jsonf")
+  property(outname="namespace" name="$.namespace" format="jsonf")
+  property(outname="pod" name="$.pod" format="jsonf")
+  property(outname="message" name="msg" format="jsonf")
+}
+`, quote(collectorJSONTemplate))
+	fmt.Fprintf(&buf, "set $.pod = re_extract($!metadata!filename, %v, 0, 1, \"\");\n", quote(containerLogPattern))
+	fmt.Fprintf(&buf, "set $.namespace = re_extract($!metadata!filename, %v, 0, 2, \"\");\n", quote(containerLogPattern))
+	if labels {
+		buf.WriteString("action(type=\"mmkubernetes\")\n")
+	}
+	for _, forwarder := range forwarders {
+		action, err := collectorAction(forwarder)
+		if err != nil {
+			return "", trace.Wrap(err, "invalid log forwarder %q", forwarder.GetName())
+		}
+		fmt.Fprintf(&buf, "# %v\n", forwarder.GetName())
+		if condition := collectorFilter(forwarder.GetFilter()); condition != "" {
+			fmt.Fprintf(&buf, "if %v then {\n  %v\n}\n", condition, action)
+		} else {
+			fmt.Fprintf(&buf, "%v\n", action)
+		}
+	}
+	return buf.String(), nil
+}
+
+// collectorFilter returns the rsyslog expression that matches logs selected
+// by the filter or an empty string if all logs are forwarded
+func collectorFilter(filter *storage.LogForwarderFilter) string {
+	if filter == nil {
+		return ""
+	}
+	var conditions []string
+	if len(filter.Namespaces) != 0 {
+		var namespaces []string
+		for _, namespace := range filter.Namespaces {
+			namespaces = append(namespaces, quote(namespace))
+		}
+		conditions = append(conditions, fmt.Sprintf("$.namespace == [%v]",
+			strings.Join(namespaces, ", ")))
+	}
+	if len(filter.Pods) != 0 {
+		var pods []string
+		for _, pattern := range filter.Pods {
+			pods = append(pods, fmt.Sprintf("re_match($.pod, %v)", quote(globToRegexp(pattern))))
+		}
+		conditions = append(conditions, fmt.Sprintf("(%v)", strings.Join(pods, " or ")))
+	}
+	var keys []string
+	for key := range filter.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("$!kubernetes!labels!%v == %v",
+			labelProperty(key), quote(filter.Labels[key])))
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// collectorAction returns the rsyslog action that ships logs to the forwarder
+func collectorAction(forwarder storage.LogForwarder) (string, error) {
+	v2, ok := forwarder.(*storage.LogForwarderV2)
+	if !ok {
+		return "", trace.BadParameter("unsupported log forwarder %T", forwarder)
+	}
+	template := "RSYSLOG_SyslogProtocol23Format"
+	if forwarder.GetFormat() == storage.LogForwarderFormatJSON {
+		template = collectorJSONTemplate
+	}
+	var params [][2]string
+	switch forwarder.GetOutput() {
+	case storage.LogForwarderOutputSyslog:
+		host, port, err := net.SplitHostPort(forwarder.GetAddress())
+		if err != nil {
+			return "", trace.BadParameter("invalid address %q: %v", forwarder.GetAddress(), err)
+		}
+		params = append(params,
+			[2]string{"type", "omfwd"},
+			[2]string{"target", host},
+			[2]string{"port", port},
+			[2]string{"protocol", forwarder.GetProtocol()},
+			[2]string{"template", template})
+		if tls := forwarder.GetTLS(); tls != nil {
+			authMode, peer := "x509/name", tls.ServerName
+			if peer == "" {
+				peer = host
+			}
+			if tls.InsecureSkipVerify {
+				authMode = "anon"
+			}
+			params = append(params,
+				[2]string{"StreamDriver", "gtls"},
+				[2]string{"StreamDriverMode", "1"},
+				[2]string{"StreamDriverAuthMode", authMode})
+			if !tls.InsecureSkipVerify {
+				params = append(params, [2]string{"StreamDriverPermittedPeers", peer})
+			}
+			params = append(params, tlsFileParams(forwarder.GetName(), *tls,
+				"StreamDriver.CAFile", "StreamDriver.CertFile", "StreamDriver.KeyFile")...)
+		}
+		if limit := forwarder.GetRateLimit(); limit != nil {
+			params = append(params,
+				[2]string{"RateLimit.Interval", fmt.Sprint(int(limit.Interval.Duration / time.Second))},
+				[2]string{"RateLimit.Burst", fmt.Sprint(limit.Messages + limit.Burst)})
+		}
+	case storage.LogForwarderOutputHTTP, storage.LogForwarderOutputElasticsearch:
+		u, err := url.Parse(forwarder.GetAddress())
+		if err != nil {
+			return "", trace.BadParameter("invalid address %q: %v", forwarder.GetAddress(), err)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		useHTTPS := "off"
+		if u.Scheme == "https" {
+			useHTTPS = "on"
+		}
+		if forwarder.GetOutput() == storage.LogForwarderOutputHTTP {
+			params = append(params,
+				[2]string{"type", "omhttp"},
+				[2]string{"server", u.Hostname()},
+				[2]string{"serverport", port},
+				[2]string{"restpath", strings.TrimPrefix(u.RequestURI(), "/")},
+				[2]string{"usehttps", useHTTPS},
+				[2]string{"template", template})
+		} else {
+			params = append(params,
+				[2]string{"type", "omelasticsearch"},
+				[2]string{"server", u.Hostname()},
+				[2]string{"serverport", port},
+				[2]string{"searchIndex", v2.Spec.Index},
+				[2]string{"usehttps", useHTTPS},
+				[2]string{"bulkmode", "on"},
+				[2]string{"template", template})
+		}
+		if tls := forwarder.GetTLS(); tls != nil {
+			params = append(params, tlsFileParams(forwarder.GetName(), *tls,
+				"tls.cacert", "tls.mycert", "tls.myprivkey")...)
+			if tls.InsecureSkipVerify {
+				params = append(params,
+					[2]string{"allowunsignedcerts", "on"},
+					[2]string{"skipverifyhost", "on"})
+			}
+		}
+	default:
+		return "", trace.BadParameter("unsupported output %q", forwarder.GetOutput())
+	}
+	if buffer := forwarder.GetBuffer(); buffer != nil {
+		// a blocked queue waits for space in the buffer indefinitely
+		timeout := "2147483647"
+		if buffer.Overflow == storage.LogForwarderOverflowDrop {
+			timeout = "0"
+		}
+		params = append(params,
+			[2]string{"queue.type", "LinkedList"},
+			[2]string{"queue.size", fmt.Sprint(buffer.Size)},
+			[2]string{"queue.timeoutEnqueue", timeout},
+			[2]string{"action.resumeRetryCount", "-1"})
+	}
+
+	var out []string
+	for _, param := range params {
+		out = append(out, fmt.Sprintf("%v=%v", param[0], quote(param[1])))
+	}
+	action := fmt.Sprintf("action(%v", strings.Join(out, " "))
+	if headers := forwarderHeaders(v2.Spec.Headers); len(headers) != 0 {
+		action = fmt.Sprintf("%v httpheaders=[%v]", action, strings.Join(headers, ", "))
+	}
+	return action + ")", nil
+}
+
+// forwarderHeaders returns the quoted additional headers of the http output
+func forwarderHeaders(values map[string]string) (headers []string) {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		headers = append(headers, quote(fmt.Sprintf("%v: %v", name, values[name])))
+	}
+	return headers
+}
+
+// tlsFileParams returns the action parameters that point to the TLS files of
+// the forwarder in the mounted log forwarders secret
+func tlsFileParams(name string, tls storage.LogForwarderTLS, ca, cert, key string) (params [][2]string) {
+	if tls.CACert != "" {
+		params = append(params, [2]string{ca, path.Join(defaults.LogForwardersDir, tlsFileName(name, tlsCAFile))})
+	}
+	if tls.ClientCert != "" {
+		params = append(params,
+			[2]string{cert, path.Join(defaults.LogForwardersDir, tlsFileName(name, tlsCertFile))},
+			[2]string{key, path.Join(defaults.LogForwardersDir, tlsFileName(name, tlsKeyFile))})
+	}
+	return params
+}
+
+// globToRegexp converts the pod name glob pattern to a regular expression
+func globToRegexp(pattern string) string {
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				buf.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			fmt.Fprintf(&buf, "[%v]", class)
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			buf.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// labelProperty returns the property name of the pod label with the specified key.
+// mmkubernetes replaces dots in label keys with underscores
+func labelProperty(key string) string {
+	return strings.Replace(key, ".", "_", -1)
+}
+
+// quote returns the value as rsyslog string constant
+func quote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return fmt.Sprintf(`"%v"`, value)
+}
+
+func appendModule(modules []string, module string) []string {
+	for _, existing := range modules {
+		if existing == module {
+			return modules
+		}
+	}
+	return append(modules, module)
+}
+
+// tlsFileName returns the name of the TLS file of the forwarder in the secret
+func tlsFileName(name, suffix string) string {
+	return fmt.Sprintf("%v.%v", name, suffix)
+}
+
+// isTLSFile returns true if the secret key specified with name is a TLS file
+// of the forwarder with the specified name
+func isTLSFile(key, name string) bool {
+	for _, suffix := range []string{tlsCAFile, tlsCertFile, tlsKeyFile} {
+		if key == tlsFileName(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// collectorJSONTemplate is the name of the rsyslog template for json format
+	collectorJSONTemplate = "gravity_json"
+	// containerLogPattern extracts the pod name and the namespace from the container log file name
+	containerLogPattern = `^.*/([^_/]+)_([^_/]+)_[^/]*$`
+
+	tlsCAFile   = "ca.pem"
+	tlsCertFile = "cert.pem"
+	tlsKeyFile  = "key.pem"
+)
@@ -0,0 +1,195 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"strings"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/storage"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	teleutils "github.com/gravitational/teleport/lib/utils"
+	"gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+)
+
+type LogCollectorSuite struct {
+	cert string
+	key  string
+}
+
+var _ = check.Suite(&LogCollectorSuite{})
+
+func (s *LogCollectorSuite) SetUpSuite(c *check.C) {
+	keyPair, err := teleutils.GenerateSelfSignedCert([]string{"logs.example.com"})
+	c.Assert(err, check.IsNil)
+	s.cert, s.key = string(keyPair.Cert), string(keyPair.PrivateKey)
+}
+
+func (s *LogCollectorSuite) TestRendersSyslogForwarder(c *check.C) {
+	forwarder := newLogForwarder(c, "syslog", storage.LogForwarderSpecV2{
+		Address: "logs.example.com:6514",
+		TLS: &storage.LogForwarderTLS{
+			CACert:     s.cert,
+			ServerName: "logs",
+		},
+		Filter: &storage.LogForwarderFilter{
+			Namespaces: []string{"default", "kube-system"},
+			Pods:       []string{"web-*"},
+			Labels:     map[string]string{"app.kubernetes.io": "web"},
+		},
+		RateLimit: &storage.LogForwarderRateLimit{Messages: 100, Burst: 20},
+		Buffer:    &storage.LogForwarderBuffer{Overflow: storage.LogForwarderOverflowDrop},
+	})
+
+	config, err := renderCollectorConfig([]storage.LogForwarder{forwarder})
+	c.Assert(err, check.IsNil)
+	c.Assert(config, check.Matches, `(?s).*module\(load="mmkubernetes"\).*`)
+	c.Assert(config, check.Not(check.Matches), `(?s).*module\(load="omhttp"\).*`)
+	c.Assert(lastLine(config), check.Equals, `}`)
+	c.Assert(config, check.Matches, `(?s).*`+
+		`if \$\.namespace == \["default", "kube-system"\] and \(re_match\(\$\.pod, "\^web-\.\*\$"\)\) `+
+		`and \$!kubernetes!labels!app_kubernetes_io == "web" then \{.*`)
+	c.Assert(config, check.Matches, `(?s).*action\(type="omfwd" target="logs.example.com" port="6514" `+
+		`protocol="tcp" template="RSYSLOG_SyslogProtocol23Format" StreamDriver="gtls" StreamDriverMode="1" `+
+		`StreamDriverAuthMode="x509/name" StreamDriverPermittedPeers="logs" `+
+		`StreamDriver.CAFile="/etc/gravity/log-forwarders/syslog.ca.pem" `+
+		`RateLimit.Interval="1" RateLimit.Burst="120" queue.type="LinkedList" queue.size="10000" `+
+		`queue.timeoutEnqueue="0" action.resumeRetryCount="-1"\).*`)
+}
+
+func (s *LogCollectorSuite) TestRendersHTTPForwarders(c *check.C) {
+	forwarders := []storage.LogForwarder{
+		newLogForwarder(c, "es", storage.LogForwarderSpecV2{
+			Address: "https://es.example.com:9200",
+			Output:  storage.LogForwarderOutputElasticsearch,
+			TLS: &storage.LogForwarderTLS{
+				ClientCert: s.cert,
+				ClientKey:  s.key,
+			},
+		}),
+		newLogForwarder(c, "hook", storage.LogForwarderSpecV2{
+			Address: "http://logs.example.com/ingest?source=gravity",
+			Output:  storage.LogForwarderOutputHTTP,
+			Format:  storage.LogForwarderFormatRFC5424,
+			Headers: map[string]string{"Authorization": `Bearer "token"`},
+		}),
+	}
+
+	config, err := renderCollectorConfig(forwarders)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(config), "\n")
+	c.Assert(lines[1], check.Equals, `module(load="omelasticsearch")`)
+	c.Assert(lines[2], check.Equals, `module(load="omhttp")`)
+	c.Assert(config, check.Not(check.Matches), `(?s).*mmkubernetes.*`)
+	c.Assert(config, check.Matches, `(?s).*\naction\(type="omelasticsearch" server="es.example.com" `+
+		`serverport="9200" searchIndex="gravity-logs" usehttps="on" bulkmode="on" template="gravity_json" `+
+		`tls.mycert="/etc/gravity/log-forwarders/es.cert.pem" `+
+		`tls.myprivkey="/etc/gravity/log-forwarders/es.key.pem"\)\n.*`)
+	c.Assert(lastLine(config), check.Equals, `action(type="omhttp" server="logs.example.com" `+
+		`serverport="80" restpath="ingest?source=gravity" usehttps="off" `+
+		`template="RSYSLOG_SyslogProtocol23Format" httpheaders=["Authorization: Bearer \"token\""])`)
+}
+
+func (s *LogCollectorSuite) TestRendersEmptyConfig(c *check.C) {
+	config, err := renderCollectorConfig(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Count(config, "\n"), check.Equals, 1)
+}
+
+func (s *LogCollectorSuite) TestConvertsPodPatterns(c *check.C) {
+	c.Assert(globToRegexp("web-*"), check.Equals, `^web-.*$`)
+	c.Assert(globToRegexp("db-?.x"), check.Equals, `^db-.\.x$`)
+	c.Assert(globToRegexp("app-[!0-9]"), check.Equals, `^app-[^0-9]$`)
+}
+
+func (s *LogCollectorSuite) TestMountsSecretOnce(c *check.C) {
+	spec := v1.PodSpec{
+		Containers: []v1.Container{{Name: "collector"}, {Name: "forwarder"}},
+	}
+	c.Assert(mountLogForwardersSecret(&spec), check.Equals, true)
+	c.Assert(spec.Volumes, check.HasLen, 1)
+	c.Assert(spec.Volumes[0].Secret.SecretName, check.Equals, defaults.LogForwardersSecret)
+	for _, container := range spec.Containers {
+		c.Assert(container.VolumeMounts, check.DeepEquals, []v1.VolumeMount{
+			{
+				Name:      logForwardersVolume,
+				MountPath: defaults.LogForwardersDir,
+				ReadOnly:  true,
+			},
+			{
+				Name:      logForwardersVolume,
+				MountPath: defaults.LogForwardersConfigPath,
+				SubPath:   defaults.LogForwardersConfigFile,
+				ReadOnly:  true,
+			},
+		})
+	}
+	c.Assert(mountLogForwardersSecret(&spec), check.Equals, false)
+}
+
+func (s *LogCollectorSuite) TestKeepsTLSMaterialInSecret(c *check.C) {
+	forwarder := newLogForwarder(c, "syslog", storage.LogForwarderSpecV2{
+		Address: "logs.example.com:6514",
+		TLS: &storage.LogForwarderTLS{
+			CACert:     s.cert,
+			ClientCert: s.cert,
+			ClientKey:  s.key,
+			ServerName: "logs",
+		},
+	})
+
+	data, err := marshalLogForwarder(forwarder)
+	c.Assert(err, check.IsNil)
+	stored, err := storage.GetLogForwarderMarshaler().Unmarshal(data)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.GetTLS(), check.DeepEquals, &storage.LogForwarderTLS{ServerName: "logs"})
+
+	files := map[string][]byte{defaults.LogForwardersConfigFile: []byte("config")}
+	setTLSFiles(files, forwarder.GetName(), forwarder.GetTLS())
+	c.Assert(files, check.DeepEquals, map[string][]byte{
+		defaults.LogForwardersConfigFile: []byte("config"),
+		"syslog.ca.pem":                  []byte(s.cert),
+		"syslog.cert.pem":                []byte(s.cert),
+		"syslog.key.pem":                 []byte(s.key),
+	})
+	c.Assert(withTLSFiles(stored, files).GetTLS(), check.DeepEquals, forwarder.GetTLS())
+	c.Assert(forwarder.GetTLS().ClientKey, check.Equals, s.key)
+	c.Assert(forwarder.WithoutSecrets().GetTLS().ClientKey, check.Equals, "")
+
+	setTLSFiles(files, forwarder.GetName(), nil)
+	c.Assert(files, check.DeepEquals, map[string][]byte{
+		defaults.LogForwardersConfigFile: []byte("config"),
+	})
+}
+
+func newLogForwarder(c *check.C, name string, spec storage.LogForwarderSpecV2) storage.LogForwarder {
+	forwarder := &storage.LogForwarderV2{
+		Kind:     storage.KindLogForwarder,
+		Version:  teleservices.V2,
+		Metadata: teleservices.Metadata{Name: name},
+		Spec:     spec,
+	}
+	c.Assert(forwarder.CheckAndSetDefaults(), check.IsNil)
+	return forwarder
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
@@ -24,11 +24,14 @@ import (
 
 	"github.com/gravitational/rigging"
 	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubelabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
-// GetLogForwarders returns a list of configured log forwarders
+// GetLogForwarders returns a list of configured log forwarders.
+// TLS client keys are not returned
 func (o *Operator) GetLogForwarders(key ops.SiteKey) ([]storage.LogForwarder, error) {
 	if o.cfg.LogForwarders == nil {
 		return nil, trace.BadParameter(
@@ -40,6 +43,9 @@ func (o *Operator) GetLogForwarders(key ops.SiteKey) ([]storage.LogForwarder, er
 		return nil, trace.Wrap(err)
 	}
 
+	for i, forwarder := range forwarders {
+		forwarders[i] = forwarder.WithoutSecrets()
+	}
 	return forwarders, nil
 }
 
@@ -77,7 +83,12 @@ func (o *Operator) CreateLogForwarder(key ops.SiteKey, forwarder storage.LogForw
 			"this operator does not support log forwarders management")
 	}
 
-	err := o.cfg.LogForwarders.Create(forwarder)
+	err := forwarder.CheckAndSetDefaults()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = o.cfg.LogForwarders.Create(forwarder)
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -97,7 +108,12 @@ func (o *Operator) UpdateLogForwarder(key ops.SiteKey, forwarder storage.LogForw
 			"this operator does not support log forwarders management")
 	}
 
-	err := o.cfg.LogForwarders.Update(forwarder)
+	err := forwarder.CheckAndSetDefaults()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = o.cfg.LogForwarders.Update(forwarder)
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -156,7 +172,8 @@ func NewLogForwardersControl(client *kubernetes.Clientset) LogForwardersControl
 	return &logForwardersControl{client}
 }
 
-// Get returns a list of log forwarders from config map
+// Get returns a list of log forwarders from config map with their
+// TLS material from the log forwarders secret
 func (c *logForwardersControl) Get() ([]storage.LogForwarder, error) {
 	configMap, err := c.client.Core().ConfigMaps(defaults.KubeSystemNamespace).Get(
 		defaults.LogForwardersConfigMap, metav1.GetOptions{})
@@ -164,13 +181,18 @@ func (c *logForwardersControl) Get() ([]storage.LogForwarder, error) {
 		return nil, rigging.ConvertError(err)
 	}
 
+	secret, err := c.getSecret()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	var forwarders []storage.LogForwarder
 	for _, data := range configMap.Data {
 		forwarder, err := storage.GetLogForwarderMarshaler().Unmarshal([]byte(data))
 		if err != nil {
 			return nil, trace.Wrap(err)
 		}
-		forwarders = append(forwarders, forwarder)
+		forwarders = append(forwarders, withTLSFiles(forwarder, secret.Data))
 	}
 
 	return forwarders, nil
@@ -186,7 +208,7 @@ func (c *logForwardersControl) Replace(forwarders []storage.LogForwarder) error
 
 	configMap.Data = make(map[string]string)
 	for _, forwarder := range forwarders {
-		bytes, err := storage.GetLogForwarderMarshaler().Marshal(forwarder)
+		bytes, err := marshalLogForwarder(forwarder)
 		if err != nil {
 			return trace.Wrap(err)
 		}
@@ -198,7 +220,16 @@ func (c *logForwardersControl) Replace(forwarders []storage.LogForwarder) error
 		return rigging.ConvertError(err)
 	}
 
-	return nil
+	return c.updateSecret(func(data map[string][]byte) {
+		for key := range data {
+			if key != defaults.LogForwardersConfigFile {
+				delete(data, key)
+			}
+		}
+		for _, forwarder := range forwarders {
+			setTLSFiles(data, forwarder.GetName(), forwarder.GetTLS())
+		}
+	})
 }
 
 // Create adds a new log forwarder to the forwarders config map
@@ -214,7 +245,7 @@ func (c *logForwardersControl) Create(forwarder storage.LogForwarder) error {
 		return trace.AlreadyExists("log forwarder %q already exists", forwarder.GetName())
 	}
 
-	bytes, err := storage.GetLogForwarderMarshaler().Marshal(forwarder)
+	bytes, err := marshalLogForwarder(forwarder)
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -230,7 +261,9 @@ func (c *logForwardersControl) Create(forwarder storage.LogForwarder) error {
 		return rigging.ConvertError(err)
 	}
 
-	return nil
+	return c.updateSecret(func(data map[string][]byte) {
+		setTLSFiles(data, forwarder.GetName(), forwarder.GetTLS())
+	})
 }
 
 // Update updates an existing log forwarder in the k8s config map
@@ -246,7 +279,7 @@ func (c *logForwardersControl) Update(forwarder storage.LogForwarder) error {
 		return trace.NotFound("log forwarder %q not found", forwarder.GetName())
 	}
 
-	bytes, err := storage.GetLogForwarderMarshaler().Marshal(forwarder)
+	bytes, err := marshalLogForwarder(forwarder)
 	if err != nil {
 		return trace.Wrap(err)
 	}
@@ -262,7 +295,9 @@ func (c *logForwardersControl) Update(forwarder storage.LogForwarder) error {
 		return rigging.ConvertError(err)
 	}
 
-	return nil
+	return c.updateSecret(func(data map[string][]byte) {
+		setTLSFiles(data, forwarder.GetName(), forwarder.GetTLS())
+	})
 }
 
 // Delete deletes the specified log forwarder from the k8s config map
@@ -285,15 +320,46 @@ func (c *logForwardersControl) Delete(name string) error {
 		return rigging.ConvertError(err)
 	}
 
-	return nil
+	return c.updateSecret(func(data map[string][]byte) {
+		setTLSFiles(data, name, nil)
+	})
 }
 
-// Reload forces log collector to reload forwarder configuration
+// Reload validates configured forwarders, renders the log collector
+// configuration into the log forwarders secret, makes sure the collector
+// mounts the secret and forces the collector to reload forwarder configuration
 func (c *logForwardersControl) Reload() error {
-	err := c.client.Core().Pods(defaults.KubeSystemNamespace).DeleteCollection(nil, metav1.ListOptions{
-		LabelSelector: utils.MakeSelector(map[string]string{
-			"role": "log-collector",
-		}).String(),
+	forwarders, err := c.Get()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	for _, forwarder := range forwarders {
+		err := forwarder.CheckAndSetDefaults()
+		if err != nil {
+			return trace.Wrap(err, "invalid log forwarder %q", forwarder.GetName())
+		}
+	}
+
+	config, err := renderCollectorConfig(forwarders)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = c.updateSecret(func(data map[string][]byte) {
+		data[defaults.LogForwardersConfigFile] = []byte(config)
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = c.mountSecret()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = c.client.Core().Pods(defaults.KubeSystemNamespace).DeleteCollection(nil, metav1.ListOptions{
+		LabelSelector: utils.MakeSelector(logCollectorLabels).String(),
 	})
 	if err != nil {
 		return rigging.ConvertError(err)
@@ -301,3 +367,200 @@ func (c *logForwardersControl) Reload() error {
 
 	return nil
 }
+
+// getSecret returns the log forwarders secret or an empty secret if
+// it has not been created yet
+func (c *logForwardersControl) getSecret() (*v1.Secret, error) {
+	secret, err := c.client.Core().Secrets(defaults.KubeSystemNamespace).Get(
+		defaults.LogForwardersSecret, metav1.GetOptions{})
+	err = rigging.ConvertError(err)
+	if err != nil && !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	if err != nil {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.LogForwardersSecret,
+				Namespace: defaults.KubeSystemNamespace,
+			},
+			Type: v1.SecretTypeOpaque,
+		}
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	return secret, nil
+}
+
+// updateSecret applies update to the contents of the log forwarders secret
+func (c *logForwardersControl) updateSecret(update func(data map[string][]byte)) error {
+	secret, err := c.getSecret()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	update(secret.Data)
+
+	if secret.ResourceVersion == "" {
+		_, err = c.client.Core().Secrets(defaults.KubeSystemNamespace).Create(secret)
+	} else {
+		_, err = c.client.Core().Secrets(defaults.KubeSystemNamespace).Update(secret)
+	}
+	if err != nil {
+		return rigging.ConvertError(err)
+	}
+
+	return nil
+}
+
+// mountSecret makes sure the log collector mounts the log forwarders secret
+// with the TLS material and the collector configuration
+func (c *logForwardersControl) mountSecret() error {
+	daemonSets := c.client.AppsV1().DaemonSets(defaults.KubeSystemNamespace)
+	list, err := daemonSets.List(metav1.ListOptions{})
+	if err != nil {
+		return rigging.ConvertError(err)
+	}
+
+	for _, daemonSet := range list.Items {
+		selector := kubelabels.SelectorFromSet(logCollectorLabels)
+		if !selector.Matches(kubelabels.Set(daemonSet.Spec.Template.Labels)) {
+			continue
+		}
+		if !mountLogForwardersSecret(&daemonSet.Spec.Template.Spec) {
+			continue
+		}
+		_, err := daemonSets.Update(&daemonSet)
+		if err != nil {
+			return rigging.ConvertError(err)
+		}
+	}
+
+	return nil
+}
+
+// mountLogForwardersSecret adds the log forwarders secret volume and mounts
+// to the log collector pod spec. Returns true if the spec has been updated
+func mountLogForwardersSecret(spec *v1.PodSpec) (updated bool) {
+	var found bool
+	for _, volume := range spec.Volumes {
+		if volume.Name == logForwardersVolume {
+			found = true
+			break
+		}
+	}
+	if !found {
+		optional := true
+		spec.Volumes = append(spec.Volumes, v1.Volume{
+			Name: logForwardersVolume,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName: defaults.LogForwardersSecret,
+					Optional:   &optional,
+				},
+			},
+		})
+		updated = true
+	}
+	mounts := []v1.VolumeMount{
+		{
+			Name:      logForwardersVolume,
+			MountPath: defaults.LogForwardersDir,
+			ReadOnly:  true,
+		},
+		{
+			Name:      logForwardersVolume,
+			MountPath: defaults.LogForwardersConfigPath,
+			SubPath:   defaults.LogForwardersConfigFile,
+			ReadOnly:  true,
+		},
+	}
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		for _, mount := range mounts {
+			if hasVolumeMount(*container, mount.MountPath) {
+				continue
+			}
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+			updated = true
+		}
+	}
+	return updated
+}
+
+func hasVolumeMount(container v1.Container, path string) bool {
+	for _, mount := range container.VolumeMounts {
+		if mount.MountPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalLogForwarder marshals the log forwarder for the config map
+// without its TLS material which is kept in the log forwarders secret
+func marshalLogForwarder(forwarder storage.LogForwarder) ([]byte, error) {
+	return storage.GetLogForwarderMarshaler().Marshal(withoutTLSFiles(forwarder))
+}
+
+// withoutTLSFiles returns a copy of the log forwarder without certificates and keys
+func withoutTLSFiles(forwarder storage.LogForwarder) storage.LogForwarder {
+	v2, ok := forwarder.(*storage.LogForwarderV2)
+	if !ok || v2.Spec.TLS == nil {
+		return forwarder
+	}
+	out := *v2
+	tls := *v2.Spec.TLS
+	tls.CACert, tls.ClientCert, tls.ClientKey = "", "", ""
+	out.Spec.TLS = &tls
+	return &out
+}
+
+// withTLSFiles returns a copy of the log forwarder with certificates and keys
+// from the log forwarders secret data
+func withTLSFiles(forwarder storage.LogForwarder, data map[string][]byte) storage.LogForwarder {
+	v2, ok := forwarder.(*storage.LogForwarderV2)
+	if !ok || v2.Spec.TLS == nil {
+		return forwarder
+	}
+	out := *v2
+	tls := *v2.Spec.TLS
+	tls.CACert = string(data[tlsFileName(forwarder.GetName(), tlsCAFile)])
+	tls.ClientCert = string(data[tlsFileName(forwarder.GetName(), tlsCertFile)])
+	tls.ClientKey = string(data[tlsFileName(forwarder.GetName(), tlsKeyFile)])
+	out.Spec.TLS = &tls
+	return &out
+}
+
+// setTLSFiles replaces the TLS files of the forwarder specified with name
+// in the log forwarders secret data
+func setTLSFiles(data map[string][]byte, name string, tls *storage.LogForwarderTLS) {
+	for key := range data {
+		if isTLSFile(key, name) {
+			delete(data, key)
+		}
+	}
+	if tls == nil {
+		return
+	}
+	files := map[string]string{
+		tlsCAFile:   tls.CACert,
+		tlsCertFile: tls.ClientCert,
+		tlsKeyFile:  tls.ClientKey,
+	}
+	for suffix, contents := range files {
+		if contents != "" {
+			data[tlsFileName(name, suffix)] = []byte(contents)
+		}
+	}
+}
+
+const (
+	// logForwardersVolume is the name of the log collector volume with the log forwarders secret
+	logForwardersVolume = "gravity-log-forwarders"
+)
+
+// logCollectorLabels selects the log collector pods
+var logCollectorLabels = map[string]string{
+	"role": "log-collector",
+}
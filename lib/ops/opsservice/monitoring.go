@@ -17,6 +17,9 @@ limitations under the License.
 package opsservice
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/ops"
@@ -25,6 +28,7 @@ import (
 
 	"github.com/gravitational/rigging"
 	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubelabels "k8s.io/apimachinery/pkg/labels"
@@ -78,6 +82,8 @@ func (o *Operator) GetAlerts(key ops.SiteKey) (alerts []storage.Alert, err error
 			errors = append(errors, err)
 			continue
 		}
+		// the alert handler posting to the cluster is managed by gravity
+		alert.Spec.Formula = monitoring.RemoveAlertEndpoint(alert.Spec.Formula)
 		alerts = append(alerts, alert)
 	}
 
@@ -88,7 +94,10 @@ func (o *Operator) GetAlerts(key ops.SiteKey) (alerts []storage.Alert, err error
 	return alerts, nil
 }
 
-// UpdateAlert updates the specified monitoring alert
+// UpdateAlert updates the specified monitoring alert.
+//
+// The alert is configured to also post to the cluster so the alert
+// is delivered to webhook, chat and incident management alert targets
 func (o *Operator) UpdateAlert(key ops.SiteKey, alert storage.Alert) error {
 	client, err := o.GetKubeClient()
 	if err != nil {
@@ -99,6 +108,15 @@ func (o *Operator) UpdateAlert(key ops.SiteKey, alert storage.Alert) error {
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	withEndpoint, err := storage.UnmarshalAlert(data)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	withEndpoint.Spec.Formula = monitoring.AddAlertEndpoint(withEndpoint.Spec.Formula)
+	data, err = storage.MarshalAlert(withEndpoint)
+	if err != nil {
+		return trace.Wrap(err)
+	}
 
 	labels := map[string]string{
 		constants.MonitoringType: constants.MonitoringTypeAlert,
@@ -140,8 +158,24 @@ func (o *Operator) DeleteAlert(key ops.SiteKey, name string) error {
 	return trace.Wrap(rigging.ConvertError(err))
 }
 
-// GetAlertTargets returns a list of configured monitoring alert targets
-func (o *Operator) GetAlertTargets(key ops.SiteKey) (targets []storage.AlertTarget, err error) {
+// GetAlertTargets returns a list of configured monitoring alert targets.
+//
+// Credentials of webhook, chat and incident management alert targets
+// are redacted
+func (o *Operator) GetAlertTargets(key ops.SiteKey) ([]storage.AlertTarget, error) {
+	targets, err := o.getAlertTargets()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for i, target := range targets {
+		targets[i] = target.WithoutSecrets()
+	}
+	return targets, nil
+}
+
+// getAlertTargets returns a list of configured monitoring alert targets
+// including credentials
+func (o *Operator) getAlertTargets() (targets []storage.AlertTarget, err error) {
 	client, err := o.GetKubeClient()
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -149,33 +183,69 @@ func (o *Operator) GetAlertTargets(key ops.SiteKey) (targets []storage.AlertTarg
 
 	data, err := getConfigMap(client.Core().ConfigMaps(defaults.MonitoringNamespace),
 		constants.AlertTargetConfigMap)
-	if err != nil {
-		if trace.IsNotFound(err) {
-			return nil, trace.NotFound("alert target not found")
-		}
+	if err != nil && !trace.IsNotFound(err) {
 		return nil, trace.Wrap(err)
 	}
+	if err == nil {
+		target, err := storage.UnmarshalAlertTarget([]byte(data))
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		targets = append(targets, target)
+	}
 
-	target, err := storage.UnmarshalAlertTarget([]byte(data))
+	// HTTP alert targets carry credentials and are kept in secrets
+	labels := kubelabels.Set{
+		constants.MonitoringType: constants.MonitoringTypeAlertTargetHTTP,
+	}
+	list, err := client.Core().Secrets(defaults.MonitoringNamespace).List(
+		metav1.ListOptions{LabelSelector: labels.String()})
 	if err != nil {
-		return nil, trace.Wrap(err)
+		return nil, trace.Wrap(rigging.ConvertError(err))
+	}
+	for _, secret := range list.Items {
+		data, ok := secret.Data[constants.ResourceSpecKey]
+		if !ok {
+			continue
+		}
+		target, err := storage.UnmarshalAlertTarget(data)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		targets = append(targets, target)
 	}
 
-	return []storage.AlertTarget{target}, nil
+	if len(targets) == 0 {
+		return nil, trace.NotFound("alert target not found")
+	}
+	return targets, nil
 }
 
-// UpdateAlertTarget updates the cluster monitoring alert target
+// UpdateAlertTarget updates the cluster monitoring alert target.
+//
+// There is a single email alert target per cluster which is delivered
+// by the monitoring stack. Webhook, chat and incident management alert
+// targets are identified by name
 func (o *Operator) UpdateAlertTarget(key ops.SiteKey, target storage.AlertTarget) error {
 	client, err := o.GetKubeClient()
 	if err != nil {
 		return trace.Wrap(err)
 	}
 
+	if err := target.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+
 	data, err := storage.MarshalAlertTarget(target)
 	if err != nil {
 		return trace.Wrap(err)
 	}
 
+	if target.GetType() != storage.AlertTargetEmail {
+		return updateAlertTargetSecret(client.Core().Secrets(defaults.MonitoringNamespace),
+			alertTargetSecretName(target.GetName()), data)
+	}
+
 	labels := map[string]string{
 		constants.MonitoringType: constants.MonitoringTypeAlertTarget,
 	}
@@ -183,20 +253,146 @@ func (o *Operator) UpdateAlertTarget(key ops.SiteKey, target storage.AlertTarget
 		constants.AlertTargetConfigMap, string(data), labels)
 }
 
-// DeleteAlertTarget deletes the cluster monitoring alert target
-func (o *Operator) DeleteAlertTarget(key ops.SiteKey) error {
+// DeleteAlertTarget deletes the cluster monitoring alert target with
+// the specified name. Empty name deletes the email alert target
+func (o *Operator) DeleteAlertTarget(key ops.SiteKey, name string) error {
 	client, err := o.GetKubeClient()
 	if err != nil {
 		return trace.Wrap(err)
 	}
 
-	err = rigging.ConvertError(client.Core().ConfigMaps(defaults.MonitoringNamespace).Delete(constants.AlertTargetConfigMap, nil))
+	configmaps := client.Core().ConfigMaps(defaults.MonitoringNamespace)
+	if name != "" {
+		err = rigging.ConvertError(client.Core().Secrets(defaults.MonitoringNamespace).Delete(
+			alertTargetSecretName(name), nil))
+		if !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+		// fall back to the email alert target
+		data, err := getConfigMap(configmaps, constants.AlertTargetConfigMap)
+		if err != nil {
+			if trace.IsNotFound(err) {
+				return trace.NotFound("alert target %q not found", name)
+			}
+			return trace.Wrap(err)
+		}
+		target, err := storage.UnmarshalAlertTarget([]byte(data))
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if target.GetName() != name {
+			return trace.NotFound("alert target %q not found", name)
+		}
+	}
+
+	err = rigging.ConvertError(configmaps.Delete(constants.AlertTargetConfigMap, nil))
 	if trace.IsNotFound(err) {
 		return trace.NotFound("no alert targets found")
 	}
 	return trace.Wrap(err)
 }
 
+// NotifyAlert delivers the alert posted to the cluster to the configured
+// webhook, chat and incident management alert targets.
+//
+// Delivery happens in the background with retries, its status can be
+// inspected with GetAlertDeliveries
+func (o *Operator) NotifyAlert(key ops.SiteKey, alert monitoring.Alert) error {
+	if o.cfg.Monitoring == nil {
+		return trace.BadParameter("monitoring is not configured")
+	}
+	if alert.ID == "" {
+		return trace.BadParameter("missing alert ID")
+	}
+	targets, err := o.getAlertTargets()
+	if err != nil {
+		if trace.IsNotFound(err) {
+			log.Debugf("No alert targets for alert %v.", alert.ID)
+			return nil
+		}
+		return trace.Wrap(err)
+	}
+	if alert.Cluster == "" {
+		alert.Cluster = key.SiteDomain
+	}
+	go func() {
+		err := o.cfg.Monitoring.NotifyAlert(context.TODO(), alert, targets)
+		if err != nil {
+			log.Warnf("Failed to deliver alert %v: %v.", alert.ID, trace.DebugReport(err))
+		}
+	}()
+	return nil
+}
+
+// ConfigureAlertEndpoint configures Kapacitor to post the alerts to
+// the cluster alert notification API as the cluster agent
+func (o *Operator) ConfigureAlertEndpoint(key ops.SiteKey) error {
+	if o.cfg.Monitoring == nil {
+		return trace.BadParameter("monitoring is not configured")
+	}
+	agent, err := storage.GetClusterAgentCreds(o.backend(), key.SiteDomain, true)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(o.cfg.Monitoring.ConfigureAlertEndpoint(monitoring.AlertEndpointConfig{
+		URL: fmt.Sprintf("%v/portal/v1/accounts/%v/sites/%v/monitoring/alerts/notify",
+			defaults.GravityServiceURL, key.AccountID, key.SiteDomain),
+		Username: agent.Email,
+		Password: agent.Password,
+	}))
+}
+
+// GetAlertDeliveries returns the recent alert deliveries
+func (o *Operator) GetAlertDeliveries(key ops.SiteKey) ([]monitoring.AlertDelivery, error) {
+	if o.cfg.Monitoring == nil {
+		return nil, trace.BadParameter("monitoring is not configured")
+	}
+	return o.cfg.Monitoring.GetAlertDeliveries()
+}
+
+// WriteMetric writes the metric to the cluster monitoring database
+func (o *Operator) WriteMetric(key ops.SiteKey, metric monitoring.Metric) error {
+	if o.cfg.Monitoring == nil {
+		return trace.BadParameter("monitoring is not configured")
+	}
+	return trace.Wrap(o.cfg.Monitoring.WriteMetric(metric))
+}
+
+// alertTargetSecretName returns the name of the Secret with the
+// alert target specified with name
+func alertTargetSecretName(name string) string {
+	return fmt.Sprintf("%v-%v", constants.MonitoringTypeAlertTargetHTTP, name)
+}
+
+func updateAlertTargetSecret(client corev1.SecretInterface, name string, data []byte) error {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaults.MonitoringNamespace,
+			Labels: map[string]string{
+				constants.MonitoringType: constants.MonitoringTypeAlertTargetHTTP,
+			},
+		},
+		Data: map[string][]byte{
+			constants.ResourceSpecKey: data,
+		},
+		Type: v1.SecretTypeOpaque,
+	}
+
+	_, err := client.Create(secret)
+	err = rigging.ConvertError(err)
+	if err == nil {
+		return nil
+	}
+
+	if !trace.IsAlreadyExists(err) {
+		return trace.Wrap(err)
+	}
+
+	_, err = client.Update(secret)
+	return trace.Wrap(rigging.ConvertError(err))
+}
+
 func getConfigMap(client corev1.ConfigMapInterface, name string) (string, error) {
 	config, err := client.Get(name, metav1.GetOptions{})
 	if err != nil {
@@ -0,0 +1,393 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"context"
+
+	"github.com/gravitational/gravity/lib/checks"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// UpdateNodeLabels adds and removes Kubernetes labels of a cluster node
+func (o *Operator) UpdateNodeLabels(req ops.UpdateNodeLabelsRequest) error {
+	err := req.Check()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(req.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	client, err := o.GetKubeClient()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return o.getOperationGroup(req.SiteKey()).updateClusterStateServer(req.Node,
+		func(server *storage.Server) error {
+			profile, err := cluster.app.Manifest.NodeProfiles.ByName(server.Role)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			return trace.Wrap(setNodeLabels(server, *profile, req.Add, req.Remove))
+		},
+		func(server storage.Server) error {
+			nodes := client.CoreV1().Nodes()
+			if len(req.Add) != 0 {
+				err := kubernetes.UpdateLabels(context.TODO(), nodes, server.KubeNodeID(), req.Add)
+				if err != nil {
+					return trace.Wrap(err)
+				}
+			}
+			if len(req.Remove) != 0 {
+				err := kubernetes.RemoveLabels(context.TODO(), nodes, server.KubeNodeID(), req.Remove)
+				if err != nil {
+					return trace.Wrap(err)
+				}
+			}
+			o.Infof("Updated labels of node %v: %v.", server.Hostname, server.Labels)
+			return nil
+		})
+}
+
+// UpdateNodeTaints adds and removes Kubernetes taints of a cluster node
+func (o *Operator) UpdateNodeTaints(req ops.UpdateNodeTaintsRequest) error {
+	err := req.Check()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(req.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	client, err := o.GetKubeClient()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return o.getOperationGroup(req.SiteKey()).updateClusterStateServer(req.Node,
+		func(server *storage.Server) error {
+			profile, err := cluster.app.Manifest.NodeProfiles.ByName(server.Role)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			return trace.Wrap(setNodeTaints(server, *profile, req.Add, req.Remove))
+		},
+		func(server storage.Server) error {
+			err := updateTaints(client.CoreV1().Nodes(), server.KubeNodeID(), req.Add, req.Remove)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			o.Infof("Updated taints of node %v: %v.", server.Hostname, server.Taints)
+			return nil
+		})
+}
+
+// UpdateNodeProfile changes the profile of a cluster node.
+//
+// Unless forced, the system information collected on the node is validated
+// against the requirements of the new profile.
+//
+// Labels and taints of the current profile are replaced with those of
+// the new profile. Runtime configuration of the node that depends on
+// the profile takes effect when the node configuration is regenerated
+// during the next cluster update
+func (o *Operator) UpdateNodeProfile(req ops.UpdateNodeProfileRequest) error {
+	err := req.Check()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(req.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	client, err := o.GetKubeClient()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	var info storage.System
+	if !req.Force {
+		info, err = storage.UnmarshalSystemInfo(req.SystemInfo)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	manifest := cluster.app.Manifest
+	var current, profile *schema.NodeProfile
+	var currentLabels map[string]string
+	return o.getOperationGroup(req.SiteKey()).updateClusterStateServer(req.Node,
+		func(server *storage.Server) error {
+			current, profile, err = checkNodeProfile(manifest, *server, req.Profile)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			if info != nil {
+				err = checks.CheckNodeProfile(*server, info, *current, *profile)
+				if err != nil {
+					return trace.Wrap(err)
+				}
+			}
+			currentLabels = getNodeLabels(*server, *current)
+			setNodeProfile(server, *profile)
+			return nil
+		},
+		func(server storage.Server) error {
+			nodes := client.CoreV1().Nodes()
+			labels := getNodeLabels(server, *profile)
+			var staleLabels []string
+			for key := range currentLabels {
+				if _, ok := labels[key]; !ok {
+					staleLabels = append(staleLabels, key)
+				}
+			}
+			err := kubernetes.UpdateLabels(context.TODO(), nodes, server.KubeNodeID(), labels)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			if len(staleLabels) != 0 {
+				err = kubernetes.RemoveLabels(context.TODO(), nodes, server.KubeNodeID(), staleLabels)
+				if err != nil {
+					return trace.Wrap(err)
+				}
+			}
+			err = updateTaints(nodes, server.KubeNodeID(), profile.Taints, current.Taints)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			o.Infof("Changed profile of node %v: %v -> %v.", server.Hostname,
+				current.Name, profile.Name)
+			return nil
+		})
+}
+
+// updateTaints adds and removes the specified taints of the Kubernetes node.
+// Taints to remove that the node does not have are ignored
+func updateTaints(client corev1.NodeInterface, nodeName string, add, remove []v1.Taint) error {
+	node, err := client.Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	var existing []v1.Taint
+	for _, taint := range remove {
+		if hasTaint(node.Spec.Taints, taint) && !hasTaint(add, taint) {
+			existing = append(existing, taint)
+		}
+	}
+	err = kubernetes.UpdateTaints(context.TODO(), client, nodeName, add, existing)
+	return trace.Wrap(err)
+}
+
+// reservedNodeLabels lists node labels managed by the cluster
+var reservedNodeLabels = []string{
+	defaults.KubernetesHostnameLabel,
+	defaults.KubernetesRoleLabel,
+	defaults.KubernetesAdvertiseIPLabel,
+}
+
+// setNodeLabels records the change of the server labels.
+// Labels managed by the cluster and labels of the server profile
+// can not be changed
+func setNodeLabels(server *storage.Server, profile schema.NodeProfile, add map[string]string, remove []string) error {
+	checkLabel := func(key string) error {
+		if utils.StringInSlice(reservedNodeLabels, key) {
+			return trace.BadParameter("label %q is managed by the cluster and can not be changed", key)
+		}
+		if _, ok := profile.Labels[key]; ok {
+			return trace.BadParameter("label %q is set by node profile %q and can not be changed",
+				key, profile.Name)
+		}
+		return nil
+	}
+	labels := make(map[string]string)
+	for key, value := range server.Labels {
+		labels[key] = value
+	}
+	for key, value := range add {
+		if err := checkLabel(key); err != nil {
+			return trace.Wrap(err)
+		}
+		labels[key] = value
+	}
+	for _, key := range remove {
+		if err := checkLabel(key); err != nil {
+			return trace.Wrap(err)
+		}
+		delete(labels, key)
+	}
+	server.Labels = nil
+	if len(labels) != 0 {
+		server.Labels = labels
+	}
+	return nil
+}
+
+// setNodeTaints records the change of the server taints.
+// Taints of the server profile can not be changed
+func setNodeTaints(server *storage.Server, profile schema.NodeProfile, add, remove []v1.Taint) error {
+	for _, taints := range [][]v1.Taint{add, remove} {
+		for _, taint := range taints {
+			if hasTaint(profile.Taints, taint) {
+				return trace.BadParameter("taint %q is set by node profile %q and can not be changed",
+					taint.ToString(), profile.Name)
+			}
+		}
+	}
+	taints := append([]v1.Taint{}, server.Taints...)
+	for _, taint := range remove {
+		taints = removeTaint(taints, taint)
+	}
+	for _, taint := range add {
+		taints = append(removeTaint(taints, v1.Taint{Key: taint.Key, Effect: taint.Effect}), taint)
+	}
+	server.Taints = nil
+	if len(taints) != 0 {
+		server.Taints = taints
+	}
+	return nil
+}
+
+// checkNodeProfile makes sure the server can be switched to the profile
+// with the specified name and returns the current and the new profiles
+func checkNodeProfile(manifest schema.Manifest, server storage.Server, name string) (current, profile *schema.NodeProfile, err error) {
+	if server.Role == name {
+		return nil, nil, trace.AlreadyExists("node %v already has profile %q",
+			server.Hostname, name)
+	}
+	current, err = manifest.NodeProfiles.ByName(server.Role)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	profile, err = manifest.NodeProfiles.ByName(name)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	for _, p := range []*schema.NodeProfile{current, profile} {
+		if p.ExpandPolicy == schema.ExpandPolicyFixed {
+			return nil, nil, trace.BadParameter("node profile %q has %v expand policy",
+				p.Name, p.ExpandPolicy)
+		}
+	}
+	if profile.ServiceRole != "" && string(profile.ServiceRole) != server.ClusterRole {
+		return nil, nil, trace.BadParameter("node profile %q requires %v role but node %v has %v role",
+			profile.Name, profile.ServiceRole, server.Hostname, server.ClusterRole)
+	}
+	currentRuntime, err := manifest.RuntimePackage(*current)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	runtime, err := manifest.RuntimePackage(*profile)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	if !currentRuntime.IsEqualTo(*runtime) {
+		return nil, nil, trace.BadParameter("node profile %q uses runtime %v but node %v runs %v",
+			profile.Name, runtime, server.Hostname, currentRuntime)
+	}
+	return current, profile, nil
+}
+
+// setNodeProfile records the new profile of the server.
+// Server labels and taints set by the new profile are dropped
+func setNodeProfile(server *storage.Server, profile schema.NodeProfile) {
+	server.Role = profile.Name
+	for key := range server.Labels {
+		if _, ok := profile.Labels[key]; ok {
+			delete(server.Labels, key)
+		}
+	}
+	if len(server.Labels) == 0 {
+		server.Labels = nil
+	}
+	var taints []v1.Taint
+	for _, taint := range server.Taints {
+		if !hasTaint(profile.Taints, taint) {
+			taints = append(taints, taint)
+		}
+	}
+	server.Taints = taints
+}
+
+// getNodeLabels returns labels a Kubernetes node should register with
+func getNodeLabels(server storage.Server, profile schema.NodeProfile) map[string]string {
+	labels := make(map[string]string)
+	for key, value := range profile.Labels {
+		labels[key] = value
+	}
+	for key, value := range server.Labels {
+		labels[key] = value
+	}
+	if _, ok := labels[defaults.KubernetesRoleLabel]; ok {
+		role := schema.ServiceRoleNode
+		if server.IsMaster() {
+			role = schema.ServiceRoleMaster
+		}
+		labels[defaults.KubernetesRoleLabel] = string(role)
+	}
+	labels[defaults.KubernetesAdvertiseIPLabel] = server.AdvertiseIP
+	return labels
+}
+
+// getNodeTaints returns taints a Kubernetes node should register with
+func getNodeTaints(server storage.Server, profile schema.NodeProfile) []v1.Taint {
+	return append(append([]v1.Taint{}, profile.Taints...), server.Taints...)
+}
+
+// hasTaint returns true if taints contain a taint with the same key
+// and, if specified, effect as match
+func hasTaint(taints []v1.Taint, match v1.Taint) bool {
+	for _, taint := range taints {
+		if matchTaint(taint, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTaint removes taints with the same key and, if specified,
+// effect as match
+func removeTaint(taints []v1.Taint, match v1.Taint) (result []v1.Taint) {
+	for _, taint := range taints {
+		if !matchTaint(taint, match) {
+			result = append(result, taint)
+		}
+	}
+	return result
+}
+
+func matchTaint(taint, match v1.Taint) bool {
+	return taint.Key == match.Key && (match.Effect == "" || taint.Effect == match.Effect)
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/suite"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+)
+
+type NodesSuite struct {
+	manifest schema.Manifest
+}
+
+var _ = check.Suite(&NodesSuite{})
+
+func (s *NodesSuite) SetUpTest(c *check.C) {
+	runtime := loc.MustParseLocator("gravitational.io/planet:1.0.0")
+	gpuRuntime := loc.MustParseLocator("gravitational.io/planet-gpu:1.0.0")
+	s.manifest = schema.Manifest{
+		SystemOptions: &schema.SystemOptions{
+			Dependencies: schema.SystemDependencies{
+				Runtime: &schema.Dependency{Locator: runtime},
+			},
+		},
+		NodeProfiles: schema.NodeProfiles{
+			{
+				Name:   "worker",
+				Labels: map[string]string{"role": "worker"},
+				Taints: []v1.Taint{{Key: "dedicated", Value: "worker", Effect: v1.TaintEffectNoSchedule}},
+			},
+			{
+				Name:   "db",
+				Labels: map[string]string{"role": "db", "disk": "ssd"},
+			},
+			{
+				Name:        "master",
+				ServiceRole: schema.ServiceRoleMaster,
+			},
+			{
+				Name:         "fixed",
+				ExpandPolicy: schema.ExpandPolicyFixed,
+			},
+			{
+				Name: "gpu",
+				SystemOptions: &schema.SystemOptions{
+					Dependencies: schema.SystemDependencies{
+						Runtime: &schema.Dependency{Locator: gpuRuntime},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *NodesSuite) TestSetsNodeLabels(c *check.C) {
+	profile := s.profile(c, "worker")
+	server := storage.Server{Role: "worker", Labels: map[string]string{"zone": "a", "rack": "1"}}
+
+	err := setNodeLabels(&server, profile, map[string]string{"zone": "b", "gpu": "true"}, []string{"rack"})
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Labels, check.DeepEquals, map[string]string{"zone": "b", "gpu": "true"})
+
+	err = setNodeLabels(&server, profile, nil, []string{"zone", "gpu"})
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Labels, check.IsNil)
+}
+
+func (s *NodesSuite) TestRejectsProfileAndSystemLabels(c *check.C) {
+	profile := s.profile(c, "worker")
+	server := storage.Server{Role: "worker"}
+	for _, key := range []string{"role", defaults.KubernetesAdvertiseIPLabel, defaults.KubernetesHostnameLabel} {
+		err := setNodeLabels(&server, profile, map[string]string{key: "value"}, nil)
+		c.Assert(trace.IsBadParameter(err), check.Equals, true, check.Commentf("label %v", key))
+		err = setNodeLabels(&server, profile, nil, []string{key})
+		c.Assert(trace.IsBadParameter(err), check.Equals, true, check.Commentf("label %v", key))
+	}
+	c.Assert(server.Labels, check.IsNil)
+}
+
+func (s *NodesSuite) TestSetsNodeTaints(c *check.C) {
+	profile := s.profile(c, "worker")
+	server := storage.Server{Role: "worker", Taints: []v1.Taint{
+		{Key: "maintenance", Value: "true", Effect: v1.TaintEffectNoSchedule},
+		{Key: "maintenance", Value: "true", Effect: v1.TaintEffectNoExecute},
+		{Key: "gpu", Value: "true", Effect: v1.TaintEffectPreferNoSchedule},
+	}}
+
+	err := setNodeTaints(&server, profile,
+		[]v1.Taint{{Key: "gpu", Value: "false", Effect: v1.TaintEffectPreferNoSchedule}},
+		[]v1.Taint{{Key: "maintenance"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Taints, check.DeepEquals, []v1.Taint{
+		{Key: "gpu", Value: "false", Effect: v1.TaintEffectPreferNoSchedule},
+	})
+
+	err = setNodeTaints(&server, profile, nil,
+		[]v1.Taint{{Key: "gpu", Effect: v1.TaintEffectPreferNoSchedule}})
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Taints, check.IsNil)
+}
+
+func (s *NodesSuite) TestRejectsProfileTaints(c *check.C) {
+	profile := s.profile(c, "worker")
+	server := storage.Server{Role: "worker"}
+	err := setNodeTaints(&server, profile,
+		[]v1.Taint{{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoSchedule}}, nil)
+	c.Assert(trace.IsBadParameter(err), check.Equals, true)
+	err = setNodeTaints(&server, profile, nil, []v1.Taint{{Key: "dedicated"}})
+	c.Assert(trace.IsBadParameter(err), check.Equals, true)
+	// taint with the same key and a different effect does not override the profile
+	err = setNodeTaints(&server, profile,
+		[]v1.Taint{{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoExecute}}, nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *NodesSuite) TestChecksNodeProfile(c *check.C) {
+	node := storage.Server{Hostname: "node-1", Role: "worker", ClusterRole: string(schema.ServiceRoleNode)}
+	current, profile, err := checkNodeProfile(s.manifest, node, "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(current.Name, check.Equals, "worker")
+	c.Assert(profile.Name, check.Equals, "db")
+
+	var testCases = []struct {
+		profile string
+		check   func(error) bool
+		comment string
+	}{
+		{profile: "worker", check: trace.IsAlreadyExists, comment: "same profile"},
+		{profile: "unknown", check: trace.IsNotFound, comment: "unknown profile"},
+		{profile: "master", check: trace.IsBadParameter, comment: "different service role"},
+		{profile: "fixed", check: trace.IsBadParameter, comment: "fixed expand policy"},
+		{profile: "gpu", check: trace.IsBadParameter, comment: "different runtime"},
+	}
+	for _, tc := range testCases {
+		_, _, err := checkNodeProfile(s.manifest, node, tc.profile)
+		c.Assert(tc.check(err), check.Equals, true, check.Commentf(tc.comment))
+	}
+}
+
+func (s *NodesSuite) TestSetsNodeProfile(c *check.C) {
+	server := storage.Server{
+		AdvertiseIP: "192.168.1.1",
+		Role:        "worker",
+		Labels:      map[string]string{"disk": "hdd", "zone": "a"},
+		Taints:      []v1.Taint{{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoExecute}},
+	}
+	setNodeProfile(&server, s.profile(c, "db"))
+	c.Assert(server.Role, check.Equals, "db")
+	c.Assert(server.Labels, check.DeepEquals, map[string]string{"zone": "a"})
+	c.Assert(server.Taints, check.DeepEquals, []v1.Taint{
+		{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoExecute},
+	})
+	c.Assert(getNodeLabels(server, s.profile(c, "db")), check.DeepEquals, map[string]string{
+		"role":                              "db",
+		"disk":                              "ssd",
+		"zone":                              "a",
+		defaults.KubernetesAdvertiseIPLabel: "192.168.1.1",
+	})
+	c.Assert(getNodeTaints(server, s.profile(c, "worker")), check.DeepEquals, []v1.Taint{
+		{Key: "dedicated", Value: "worker", Effect: v1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoExecute},
+	})
+}
+
+func (s *NodesSuite) TestUpdatesClusterStateServer(c *check.C) {
+	services := SetupTestServices(c)
+	operator := services.Operator
+	app, err := (&suite.OpsSuite{}).SetUpTestPackage(services.Apps, services.Packages, c)
+	c.Assert(err, check.IsNil)
+	account, err := operator.CreateAccount(ops.NewAccountRequest{Org: "nodes.test"})
+	c.Assert(err, check.IsNil)
+	cluster, err := operator.CreateSite(ops.NewSiteRequest{
+		AccountID:  account.ID,
+		AppPackage: app.String(),
+		Provider:   schema.ProvisionerOnPrem,
+		DomainName: "nodes.test",
+	})
+	c.Assert(err, check.IsNil)
+
+	backendCluster, err := services.Backend.GetSite(cluster.Domain)
+	c.Assert(err, check.IsNil)
+	backendCluster.ClusterState.Servers = storage.Servers{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1", Role: "worker"},
+		{Hostname: "node-2", AdvertiseIP: "192.168.1.2", Role: "worker"},
+	}
+	_, err = services.Backend.UpdateSite(*backendCluster)
+	c.Assert(err, check.IsNil)
+
+	group := operator.getOperationGroup(cluster.Key())
+	setZone := func(server *storage.Server) error {
+		server.Labels = map[string]string{"zone": "a"}
+		return nil
+	}
+	var applied []storage.Server
+	apply := func(server storage.Server) error {
+		applied = append(applied, server)
+		return nil
+	}
+	err = group.updateClusterStateServer("node-2", setZone, apply)
+	c.Assert(trace.IsCompareFailed(err), check.Equals, true, check.Commentf("%v", err))
+
+	backendCluster.State = ops.SiteStateActive
+	_, err = services.Backend.UpdateSite(*backendCluster)
+	c.Assert(err, check.IsNil)
+	err = group.updateClusterStateServer("unknown", setZone, apply)
+	c.Assert(trace.IsNotFound(err), check.Equals, true)
+	err = group.updateClusterStateServer("192.168.1.2", setZone, apply)
+	c.Assert(err, check.IsNil)
+	c.Assert(applied, check.HasLen, 1)
+	c.Assert(applied[0].Labels, check.DeepEquals, map[string]string{"zone": "a"})
+
+	backendCluster, err = services.Backend.GetSite(cluster.Domain)
+	c.Assert(err, check.IsNil)
+	c.Assert(backendCluster.ClusterState.Servers[0].Labels, check.IsNil)
+	c.Assert(backendCluster.ClusterState.Servers[1].Labels, check.DeepEquals,
+		map[string]string{"zone": "a"})
+
+	// the node is reverted in the cluster state if the change can not be applied
+	setRack := func(server *storage.Server) error {
+		server.Labels["rack"] = "1"
+		return nil
+	}
+	err = group.updateClusterStateServer("node-2", setRack, func(storage.Server) error {
+		return trace.ConnectionProblem(nil, "api server unavailable")
+	})
+	c.Assert(trace.IsConnectionProblem(err), check.Equals, true)
+
+	backendCluster, err = services.Backend.GetSite(cluster.Domain)
+	c.Assert(err, check.IsNil)
+	c.Assert(backendCluster.ClusterState.Servers[1].Labels, check.DeepEquals,
+		map[string]string{"zone": "a"})
+}
+
+func (s *NodesSuite) profile(c *check.C, name string) schema.NodeProfile {
+	profile, err := s.manifest.NodeProfiles.ByName(name)
+	c.Assert(err, check.IsNil)
+	return *profile
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/gravitational/trace"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
 )
 
 // operationGroup provides means for synchronizing simultaneous cluster operations
@@ -247,6 +248,39 @@ func (g *operationGroup) onSiteOperationComplete(key ops.SiteOperationKey) error
 		return trace.Wrap(err)
 	}
 
+	if operation.Type == ops.OperationReconfigureNetwork && operation.IsCompleted() {
+		site, err := g.operator.openSite(g.siteKey)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		err = site.updateNetworkConfiguration(*operation)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	if operation.Type == ops.OperationReconfigureNode && operation.IsCompleted() {
+		site, err := g.operator.openSite(g.siteKey)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		err = site.updateNodeAdvertiseAddr(*operation)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	if operation.Type == ops.OperationReconfigureDocker && operation.IsCompleted() {
+		site, err := g.operator.openSite(g.siteKey)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		err = site.updateNodeStorageDriver(*operation)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
 	operations, err := ops.GetActiveOperationsByType(g.siteKey, g.operator, operation.Type)
 	if err != nil && !trace.IsNotFound(err) {
 		return trace.Wrap(err)
@@ -303,6 +337,83 @@ func (g *operationGroup) addClusterStateServers(servers []storage.Server) error
 	return nil
 }
 
+// updateClusterStateServer updates the node with the specified hostname or
+// advertise address in the cluster state using the provided update function.
+//
+// Once the cluster state has been persisted, the updated node is passed to
+// apply to propagate the change to the cluster. If apply fails, the node
+// is reverted in the cluster state.
+//
+// The node can only be updated when the cluster is active
+func (g *operationGroup) updateClusterStateServer(node string, update func(*storage.Server) error, apply func(storage.Server) error) error {
+	g.Lock()
+	defer g.Unlock()
+
+	site, err := g.operator.backend().GetSite(g.siteKey.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if site.State != ops.SiteStateActive {
+		return trace.CompareFailed("cluster is %v, node configuration can only "+
+			"be changed in an active cluster", site.State)
+	}
+
+	server := findClusterNode(site.ClusterState.Servers, node)
+	if server == nil {
+		return trace.NotFound("node %q is not found in the cluster state", node)
+	}
+
+	previous := copyServer(*server)
+	updated := copyServer(*server)
+	if err := update(&updated); err != nil {
+		return trace.Wrap(err)
+	}
+
+	*server = updated
+	if _, err = g.operator.backend().UpdateSite(*site); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := apply(updated); err != nil {
+		*server = previous
+		if _, errRevert := g.operator.backend().UpdateSite(*site); errRevert != nil {
+			log.Errorf("Failed to revert node %v in the cluster state: %v.",
+				node, trace.DebugReport(errRevert))
+		}
+		return trace.Wrap(err)
+	}
+
+	return nil
+}
+
+// copyServer returns a copy of the server that does not share
+// labels and taints with the original
+func copyServer(server storage.Server) storage.Server {
+	if server.Labels != nil {
+		labels := make(map[string]string, len(server.Labels))
+		for key, value := range server.Labels {
+			labels[key] = value
+		}
+		server.Labels = labels
+	}
+	if server.Taints != nil {
+		server.Taints = append([]v1.Taint{}, server.Taints...)
+	}
+	return server
+}
+
+// findClusterNode returns the server with the specified hostname,
+// advertise address or Kubernetes node name
+func findClusterNode(servers []storage.Server, node string) *storage.Server {
+	for i, server := range servers {
+		if server.Hostname == node || server.AdvertiseIP == node || server.KubeNodeID() == node {
+			return &servers[i]
+		}
+	}
+	return nil
+}
+
 // removeClusterStateServers removes servers with the specified hostnames from the cluster state
 func (g *operationGroup) removeClusterStateServers(hostnames []string) error {
 	g.Lock()
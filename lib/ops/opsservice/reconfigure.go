@@ -0,0 +1,397 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+)
+
+// createReconfigureNetworkOperation creates a new operation to change the
+// pod/service subnets and the overlay network port of the cluster
+func (s *site) createReconfigureNetworkOperation(req ops.CreateClusterReconfigureNetworkOperationRequest) (*ops.SiteOperationKey, error) {
+	installOperation, err := ops.GetCompletedInstallOperation(s.key, s.service)
+	if err != nil {
+		return nil, trace.Wrap(err, "network can only be reconfigured on an installed cluster")
+	}
+
+	state := currentNetworkState(*installOperation)
+	if req.PodCIDR != "" {
+		state.Subnets.Overlay = req.PodCIDR
+	}
+	if req.ServiceCIDR != "" {
+		state.Subnets.Service = req.ServiceCIDR
+	}
+	if req.VxlanPort != 0 {
+		state.VxlanPort = req.VxlanPort
+	}
+	if state.Subnets == state.PrevSubnets && state.VxlanPort == state.PrevVxlanPort {
+		return nil, trace.BadParameter("the cluster already uses the requested network settings")
+	}
+
+	manifest := s.app.Manifest
+	if manifest.Hooks != nil && manifest.Hooks.NetworkInstall != nil &&
+		(state.Subnets.Overlay != state.PrevSubnets.Overlay || state.VxlanPort != state.PrevVxlanPort) {
+		return nil, trace.BadParameter("the application installs its own overlay network, " +
+			"only the service subnet can be changed")
+	}
+
+	err = utils.ValidateKubernetesSubnets(state.Subnets.Overlay, state.Subnets.Service)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err = utils.CheckSingleStack(state.Subnets.Overlay, state.Subnets.Service)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, server := range s.backendSite.ClusterState.Servers {
+		err := utils.CheckAddrNotInSubnets(server.AdvertiseIP, state.Subnets.Overlay, state.Subnets.Service)
+		if err != nil {
+			return nil, trace.Wrap(err, "node %v", server.Hostname)
+		}
+	}
+
+	op := ops.SiteOperation{
+		ID:                 uuid.New(),
+		AccountID:          s.key.AccountID,
+		SiteDomain:         s.key.SiteDomain,
+		Type:               ops.OperationReconfigureNetwork,
+		Created:            s.clock().UtcNow(),
+		Updated:            s.clock().UtcNow(),
+		State:              ops.OperationReconfigureNetworkInProgress,
+		ReconfigureNetwork: &state,
+	}
+
+	key, err := s.getOperationGroup().createSiteOperation(op)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return key, nil
+}
+
+// updateNetworkConfiguration persists the network settings applied by the
+// specified network reconfiguration operation with the install operation
+// so the subsequent operations (e.g. expand or update) use them
+func (s *site) updateNetworkConfiguration(operation ops.SiteOperation) error {
+	installOperation, err := ops.GetCompletedInstallOperation(s.key, s.service)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	reconfigured := reconfiguredInstallOperation(*installOperation, operation)
+	_, err = s.updateSiteOperation(&reconfigured)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	s.Infof("Updated cluster network configuration: subnets=%v, vxlan port=%v.",
+		operation.ReconfigureNetwork.Subnets, operation.ReconfigureNetwork.VxlanPort)
+	return nil
+}
+
+// createReconfigureNodeOperation creates a new operation to change the
+// advertise address of a cluster node
+func (s *site) createReconfigureNodeOperation(req ops.CreateClusterReconfigureNodeOperationRequest) (*ops.SiteOperationKey, error) {
+	installOperation, err := ops.GetCompletedInstallOperation(s.key, s.service)
+	if err != nil {
+		return nil, trace.Wrap(err, "node can only be reconfigured on an installed cluster")
+	}
+
+	server, err := s.backendSite.ClusterState.FindServerByIP(req.AdvertiseIP)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, other := range s.backendSite.ClusterState.Servers {
+		if net.ParseIP(other.AdvertiseIP).Equal(net.ParseIP(req.NewAdvertiseIP)) {
+			return nil, trace.AlreadyExists("address %v is already used by node %v",
+				req.NewAdvertiseIP, other.Hostname)
+		}
+	}
+
+	subnets := currentNetworkState(*installOperation).Subnets
+	err = utils.CheckAddrNotInSubnets(req.NewAdvertiseIP, subnets.Overlay, subnets.Service)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, cidr := range []string{subnets.Overlay, subnets.Service} {
+		if !utils.HasAddrFamily(cidr, req.NewAdvertiseIP) {
+			return nil, trace.BadParameter("address %v does not belong to the IP family "+
+				"of the cluster subnet %v", req.NewAdvertiseIP, cidr)
+		}
+	}
+
+	op := ops.SiteOperation{
+		ID:         uuid.New(),
+		AccountID:  s.key.AccountID,
+		SiteDomain: s.key.SiteDomain,
+		Type:       ops.OperationReconfigureNode,
+		Created:    s.clock().UtcNow(),
+		Updated:    s.clock().UtcNow(),
+		State:      ops.OperationReconfigureNodeInProgress,
+		Servers:    []storage.Server{*server},
+		ReconfigureNode: &storage.ReconfigureNodeOperationState{
+			Server:        *server,
+			AdvertiseAddr: req.NewAdvertiseIP,
+		},
+	}
+
+	key, err := s.getOperationGroup().createSiteOperation(op)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return key, nil
+}
+
+// updateNodeAdvertiseAddr records the new advertise address of the node
+// reconfigured by the specified operation in the cluster state
+func (s *site) updateNodeAdvertiseAddr(operation ops.SiteOperation) error {
+	state := operation.ReconfigureNode
+	cluster, err := s.backend().GetSite(s.key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	updated := false
+	for i, server := range cluster.ClusterState.Servers {
+		if server.AdvertiseIP == state.Server.AdvertiseIP {
+			cluster.ClusterState.Servers[i].AdvertiseIP = state.AdvertiseAddr
+			updated = true
+		}
+	}
+	if !updated {
+		return trace.NotFound("node %v is not in the cluster state", state.Server.AdvertiseIP)
+	}
+	_, err = s.backend().UpdateSite(*cluster)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	s.Infof("Updated advertise address of node %v: %v -> %v.", state.Server.Hostname,
+		state.Server.AdvertiseIP, state.AdvertiseAddr)
+	return nil
+}
+
+// createReconfigureDockerOperation creates a new operation to migrate
+// a cluster node to a different Docker storage driver
+func (s *site) createReconfigureDockerOperation(req ops.CreateClusterReconfigureDockerOperationRequest) (*ops.SiteOperationKey, error) {
+	_, err := ops.GetCompletedInstallOperation(s.key, s.service)
+	if err != nil {
+		return nil, trace.Wrap(err, "node can only be reconfigured on an installed cluster")
+	}
+
+	server, err := s.backendSite.ClusterState.FindServerByIP(req.AdvertiseIP)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	storageDriver := s.nodeStorageDriver(*server)
+	if storageDriver == req.StorageDriver {
+		return nil, trace.BadParameter("node %v already uses Docker storage driver %v",
+			server.Hostname, storageDriver)
+	}
+	if storageDriver != constants.DockerStorageDriverDevicemapper {
+		return nil, trace.BadParameter("only nodes using Docker storage driver %v can be migrated, "+
+			"node %v uses %v", constants.DockerStorageDriverDevicemapper, server.Hostname, storageDriver)
+	}
+
+	op := ops.SiteOperation{
+		ID:         uuid.New(),
+		AccountID:  s.key.AccountID,
+		SiteDomain: s.key.SiteDomain,
+		Type:       ops.OperationReconfigureDocker,
+		Created:    s.clock().UtcNow(),
+		Updated:    s.clock().UtcNow(),
+		State:      ops.OperationReconfigureDockerInProgress,
+		Servers:    []storage.Server{*server},
+		ReconfigureDocker: &storage.ReconfigureDockerOperationState{
+			Server:            *server,
+			StorageDriver:     req.StorageDriver,
+			PrevStorageDriver: storageDriver,
+		},
+	}
+
+	key, err := s.getOperationGroup().createSiteOperation(op)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return key, nil
+}
+
+// updateNodeStorageDriver records the Docker storage driver of the node
+// reconfigured by the specified operation in the cluster state.
+//
+// The devicemapper settings of the node are reset since the node
+// no longer uses the devicemapper pool
+func (s *site) updateNodeStorageDriver(operation ops.SiteOperation) error {
+	state := operation.ReconfigureDocker
+	cluster, err := s.backend().GetSite(s.key.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	updated := false
+	for i, server := range cluster.ClusterState.Servers {
+		if server.AdvertiseIP == state.Server.AdvertiseIP {
+			cluster.ClusterState.Servers[i].Docker = storage.Docker{StorageDriver: state.StorageDriver}
+			updated = true
+		}
+	}
+	if !updated {
+		return trace.NotFound("node %v is not in the cluster state", state.Server.AdvertiseIP)
+	}
+	_, err = s.backend().UpdateSite(*cluster)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	s.Infof("Updated Docker storage driver of node %v: %v -> %v.", state.Server.Hostname,
+		state.PrevStorageDriver, state.StorageDriver)
+	return nil
+}
+
+// nodeStorageDriver returns the Docker storage driver used by the specified node
+func (s *site) nodeStorageDriver(server storage.Server) string {
+	if server.Docker.StorageDriver != "" {
+		return server.Docker.StorageDriver
+	}
+	return s.dockerConfig().StorageDriver
+}
+
+// nextPlanetConfigVersion returns the version for the planet configuration
+// package of the specified node generated by the network reconfiguration operation.
+//
+// The version sorts higher than any existing configuration package version of the node
+// but lower than the next runtime version so the package is recognized as the latest
+// configuration until the runtime is updated
+func (s *site) nextPlanetConfigVersion(node remoteServer, planetVersion string) (string, error) {
+	filter, err := s.planetConfigPackage(node, planetVersion)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	latest, err := pack.FindLatestPackage(s.packages(), *filter)
+	if err != nil && !trace.IsNotFound(err) {
+		return "", trace.Wrap(err)
+	}
+	if latest == nil {
+		latest = filter
+	}
+	version, err := latest.SemVer()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return nextReconfiguredVersion(*version).String(), nil
+}
+
+// nextReconfiguredVersion returns the version following the specified version
+// of a reconfigured package
+func nextReconfiguredVersion(version semver.Version) semver.Version {
+	if version.PreRelease == "" {
+		// a version without pre-release sorts higher than any pre-release
+		// of the same version
+		version.Patch++
+		version.PreRelease = semver.PreRelease(fmt.Sprintf("%v.1", reconfiguredVersionPrefix))
+		return version
+	}
+	parts := strings.Split(string(version.PreRelease), ".")
+	for i := len(parts) - 2; i >= 0; i-- {
+		if parts[i] != reconfiguredVersionPrefix {
+			continue
+		}
+		revision, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			break
+		}
+		parts[i+1] = strconv.Itoa(revision + 1)
+		version.PreRelease = semver.PreRelease(strings.Join(parts, "."))
+		return version
+	}
+	version.PreRelease = semver.PreRelease(fmt.Sprintf("%v.%v.1", version.PreRelease, reconfiguredVersionPrefix))
+	return version
+}
+
+// currentNetworkState returns the state of the network reconfiguration
+// that describes the current cluster network settings
+func currentNetworkState(installOperation ops.SiteOperation) storage.ReconfigureNetworkOperationState {
+	subnets := installOperation.InstallExpand.Subnets
+	if subnets.IsEmpty() {
+		// Subnets are empty for older installations
+		subnets = storage.DefaultSubnets
+	}
+	vxlanPort := installOperation.InstallExpand.Vars.OnPrem.VxlanPort
+	if vxlanPort == 0 {
+		vxlanPort = defaults.VxlanPort
+	}
+	return storage.ReconfigureNetworkOperationState{
+		Subnets:       subnets,
+		VxlanPort:     vxlanPort,
+		PrevSubnets:   subnets,
+		PrevVxlanPort: vxlanPort,
+	}
+}
+
+// reconfiguredInstallOperation returns a copy of the install operation with
+// the network settings of the specified operation if it is a network
+// reconfiguration operation
+func reconfiguredInstallOperation(installOperation, operation ops.SiteOperation) ops.SiteOperation {
+	if operation.Type != ops.OperationReconfigureNetwork || operation.ReconfigureNetwork == nil ||
+		installOperation.InstallExpand == nil {
+		return installOperation
+	}
+	state := *operation.ReconfigureNetwork
+	installExpand := *installOperation.InstallExpand
+	installExpand.Subnets = state.Subnets
+	installExpand.Vars.OnPrem.PodCIDR = state.Subnets.Overlay
+	installExpand.Vars.OnPrem.ServiceCIDR = state.Subnets.Service
+	installExpand.Vars.OnPrem.VxlanPort = state.VxlanPort
+	installOperation.InstallExpand = &installExpand
+	return installOperation
+}
+
+// planetConfigVersion returns the version of the planet configuration package
+// to generate for the specified node during the given operation
+func (s *site) planetConfigVersion(operation ops.SiteOperation, node remoteServer, planetPackage loc.Locator) (string, error) {
+	if !isReconfigureOperation(operation) {
+		return planetPackage.Version, nil
+	}
+	version, err := s.nextPlanetConfigVersion(node, planetPackage.Version)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return version, nil
+}
+
+// isReconfigureOperation returns true if the specified operation
+// reconfigures the network or a node of an installed cluster
+func isReconfigureOperation(operation ops.SiteOperation) bool {
+	return operation.Type == ops.OperationReconfigureNetwork ||
+		operation.Type == ops.OperationReconfigureNode ||
+		operation.Type == ops.OperationReconfigureDocker
+}
+
+// reconfiguredVersionPrefix is the pre-release identifier that
+// marks versions of packages generated by the network reconfiguration
+const reconfiguredVersionPrefix = "reconfigured"
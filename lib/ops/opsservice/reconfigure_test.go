@@ -0,0 +1,416 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/suite"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/gravitational/trace"
+	"gopkg.in/check.v1"
+)
+
+type ReconfigureSuite struct {
+	operator *Operator
+	cluster  *ops.Site
+}
+
+var _ = check.Suite(&ReconfigureSuite{})
+
+func (s *ReconfigureSuite) SetUpTest(c *check.C) {
+	services := SetupTestServices(c)
+	s.operator = services.Operator
+
+	suite := &suite.OpsSuite{}
+	app, err := suite.SetUpTestPackage(services.Apps, services.Packages, c)
+	c.Assert(err, check.IsNil)
+
+	account, err := s.operator.CreateAccount(ops.NewAccountRequest{
+		Org: "reconfigure.test",
+	})
+	c.Assert(err, check.IsNil)
+
+	s.cluster, err = s.operator.CreateSite(ops.NewSiteRequest{
+		AccountID:  account.ID,
+		AppPackage: app.String(),
+		Provider:   schema.ProvisionerOnPrem,
+		DomainName: "reconfigure.test",
+	})
+	c.Assert(err, check.IsNil)
+
+	group := s.operator.getOperationGroup(s.cluster.Key())
+	key, err := group.createSiteOperation(ops.SiteOperation{
+		AccountID:  s.cluster.AccountID,
+		SiteDomain: s.cluster.Domain,
+		Type:       ops.OperationInstall,
+		State:      ops.OperationStateInstallInitiated,
+		InstallExpand: &storage.InstallExpandOperationState{
+			Subnets: storage.DefaultSubnets,
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = ops.CompleteOperation(*key, s.operator)
+	c.Assert(err, check.IsNil)
+
+	err = group.addClusterStateServers([]storage.Server{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1"},
+		{Hostname: "node-2", AdvertiseIP: "192.168.1.2"},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *ReconfigureSuite) TestReconfigureNetwork(c *check.C) {
+	key, err := s.operator.CreateClusterReconfigureNetworkOperation(ops.CreateClusterReconfigureNetworkOperationRequest{
+		AccountID:   s.cluster.AccountID,
+		ClusterName: s.cluster.Domain,
+		ServiceCIDR: "10.200.0.0/16",
+	})
+	c.Assert(err, check.IsNil)
+
+	operation, err := s.operator.GetSiteOperation(*key)
+	c.Assert(err, check.IsNil)
+	c.Assert(operation.State, check.Equals, ops.OperationReconfigureNetworkInProgress)
+	c.Assert(*operation.ReconfigureNetwork, check.DeepEquals, storage.ReconfigureNetworkOperationState{
+		Subnets:       storage.Subnets{Overlay: "10.244.0.0/16", Service: "10.200.0.0/16"},
+		VxlanPort:     8472,
+		PrevSubnets:   storage.DefaultSubnets,
+		PrevVxlanPort: 8472,
+	})
+	s.assertClusterState(c, ops.SiteStateReconfiguring)
+
+	err = ops.CompleteOperation(*key, s.operator)
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+
+	installOperation, err := ops.GetCompletedInstallOperation(s.cluster.Key(), s.operator)
+	c.Assert(err, check.IsNil)
+	c.Assert(installOperation.InstallExpand.Subnets, check.DeepEquals, storage.Subnets{
+		Overlay: "10.244.0.0/16",
+		Service: "10.200.0.0/16",
+	})
+	c.Assert(installOperation.InstallExpand.Vars.OnPrem.ServiceCIDR, check.Equals, "10.200.0.0/16")
+	c.Assert(installOperation.InstallExpand.Vars.OnPrem.VxlanPort, check.Equals, 8472)
+}
+
+func (s *ReconfigureSuite) TestFailedReconfigurationKeepsNetwork(c *check.C) {
+	key, err := s.operator.CreateClusterReconfigureNetworkOperation(ops.CreateClusterReconfigureNetworkOperationRequest{
+		AccountID:   s.cluster.AccountID,
+		ClusterName: s.cluster.Domain,
+		ServiceCIDR: "10.210.0.0/16",
+	})
+	c.Assert(err, check.IsNil)
+
+	err = ops.FailOperation(*key, s.operator, "failed")
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+
+	installOperation, err := ops.GetCompletedInstallOperation(s.cluster.Key(), s.operator)
+	c.Assert(err, check.IsNil)
+	c.Assert(installOperation.InstallExpand.Subnets, check.DeepEquals, storage.DefaultSubnets)
+}
+
+func (s *ReconfigureSuite) TestRejectsInvalidNetwork(c *check.C) {
+	var testCases = []struct {
+		req     ops.CreateClusterReconfigureNetworkOperationRequest
+		comment string
+	}{
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{},
+			comment: "no settings",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{ServiceCIDR: "10.100.0.0/16"},
+			comment: "same settings",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{ServiceCIDR: "10.244.0.0/20"},
+			comment: "service subnet overlaps with pod subnet",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{PodCIDR: "10.200.0.0/16"},
+			comment: "application installs its own overlay network",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{VxlanPort: 8999},
+			comment: "application installs its own overlay network",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{ServiceCIDR: "192.168.0.0/16"},
+			comment: "service subnet overlaps with node address",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNetworkOperationRequest{VxlanPort: 70000},
+			comment: "invalid port",
+		},
+	}
+	for _, tc := range testCases {
+		tc.req.AccountID = s.cluster.AccountID
+		tc.req.ClusterName = s.cluster.Domain
+		_, err := s.operator.CreateClusterReconfigureNetworkOperation(tc.req)
+		c.Assert(err, check.NotNil, check.Commentf(tc.comment))
+		c.Assert(trace.IsBadParameter(err), check.Equals, true, check.Commentf(tc.comment))
+	}
+	s.assertClusterState(c, ops.SiteStateActive)
+}
+
+func (s *ReconfigureSuite) TestReconfigureNode(c *check.C) {
+	key, err := s.operator.CreateClusterReconfigureNodeOperation(ops.CreateClusterReconfigureNodeOperationRequest{
+		AccountID:      s.cluster.AccountID,
+		ClusterName:    s.cluster.Domain,
+		AdvertiseIP:    "192.168.1.1",
+		NewAdvertiseIP: "192.168.2.1",
+	})
+	c.Assert(err, check.IsNil)
+
+	operation, err := s.operator.GetSiteOperation(*key)
+	c.Assert(err, check.IsNil)
+	c.Assert(operation.State, check.Equals, ops.OperationReconfigureNodeInProgress)
+	c.Assert(*operation.ReconfigureNode, check.DeepEquals, storage.ReconfigureNodeOperationState{
+		Server:        storage.Server{Hostname: "node-1", AdvertiseIP: "192.168.1.1"},
+		AdvertiseAddr: "192.168.2.1",
+	})
+	s.assertClusterState(c, ops.SiteStateReconfiguring)
+
+	err = ops.CompleteOperation(*key, s.operator)
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+	s.assertServerAddrs(c, "192.168.2.1", "192.168.1.2")
+}
+
+func (s *ReconfigureSuite) TestFailedReconfigurationKeepsNodeAddress(c *check.C) {
+	key, err := s.operator.CreateClusterReconfigureNodeOperation(ops.CreateClusterReconfigureNodeOperationRequest{
+		AccountID:      s.cluster.AccountID,
+		ClusterName:    s.cluster.Domain,
+		AdvertiseIP:    "192.168.1.2",
+		NewAdvertiseIP: "192.168.2.2",
+	})
+	c.Assert(err, check.IsNil)
+
+	err = ops.FailOperation(*key, s.operator, "failed")
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+	s.assertServerAddrs(c, "192.168.1.1", "192.168.1.2")
+}
+
+func (s *ReconfigureSuite) TestRejectsInvalidNodeAddress(c *check.C) {
+	var testCases = []struct {
+		req     ops.CreateClusterReconfigureNodeOperationRequest
+		check   func(error) bool
+		comment string
+	}{
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.1"},
+			check:   trace.IsBadParameter,
+			comment: "no new address",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.1", NewAdvertiseIP: "192.168.1.1"},
+			check:   trace.IsBadParameter,
+			comment: "same address",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.5", NewAdvertiseIP: "192.168.2.5"},
+			check:   trace.IsNotFound,
+			comment: "unknown node",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.1", NewAdvertiseIP: "192.168.1.2"},
+			check:   trace.IsAlreadyExists,
+			comment: "address of another node",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.1", NewAdvertiseIP: "10.100.0.10"},
+			check:   trace.IsBadParameter,
+			comment: "address in service subnet",
+		},
+		{
+			req:     ops.CreateClusterReconfigureNodeOperationRequest{AdvertiseIP: "192.168.1.1", NewAdvertiseIP: "fd00::10"},
+			check:   trace.IsBadParameter,
+			comment: "address family not in cluster subnets",
+		},
+	}
+	for _, tc := range testCases {
+		tc.req.AccountID = s.cluster.AccountID
+		tc.req.ClusterName = s.cluster.Domain
+		_, err := s.operator.CreateClusterReconfigureNodeOperation(tc.req)
+		c.Assert(err, check.NotNil, check.Commentf(tc.comment))
+		c.Assert(tc.check(err), check.Equals, true, check.Commentf("%v: %v", tc.comment, err))
+	}
+	s.assertClusterState(c, ops.SiteStateActive)
+}
+
+func (s *ReconfigureSuite) TestReconfigureDocker(c *check.C) {
+	s.setDevicemapper(c)
+	key, err := s.operator.CreateClusterReconfigureDockerOperation(ops.CreateClusterReconfigureDockerOperationRequest{
+		AccountID:     s.cluster.AccountID,
+		ClusterName:   s.cluster.Domain,
+		AdvertiseIP:   "192.168.1.1",
+		StorageDriver: constants.DockerStorageDriverOverlay2,
+	})
+	c.Assert(err, check.IsNil)
+
+	operation, err := s.operator.GetSiteOperation(*key)
+	c.Assert(err, check.IsNil)
+	c.Assert(operation.State, check.Equals, ops.OperationReconfigureDockerInProgress)
+	c.Assert(*operation.ReconfigureDocker, check.DeepEquals, storage.ReconfigureDockerOperationState{
+		Server: storage.Server{
+			Hostname:    "node-1",
+			AdvertiseIP: "192.168.1.1",
+			Docker:      storage.Docker{Device: storage.Device{Name: "/dev/xvdb"}},
+		},
+		StorageDriver:     constants.DockerStorageDriverOverlay2,
+		PrevStorageDriver: constants.DockerStorageDriverDevicemapper,
+	})
+	s.assertClusterState(c, ops.SiteStateReconfiguring)
+
+	err = ops.CompleteOperation(*key, s.operator)
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+	s.assertServerDocker(c,
+		storage.Docker{StorageDriver: constants.DockerStorageDriverOverlay2},
+		storage.Docker{Device: storage.Device{Name: "/dev/xvdc"}})
+
+	// the migrated node is not a candidate for another migration
+	_, err = s.operator.CreateClusterReconfigureDockerOperation(ops.CreateClusterReconfigureDockerOperationRequest{
+		AccountID:     s.cluster.AccountID,
+		ClusterName:   s.cluster.Domain,
+		AdvertiseIP:   "192.168.1.1",
+		StorageDriver: constants.DockerStorageDriverOverlay2,
+	})
+	c.Assert(trace.IsBadParameter(err), check.Equals, true, check.Commentf("%v", err))
+}
+
+func (s *ReconfigureSuite) TestFailedReconfigurationKeepsStorageDriver(c *check.C) {
+	s.setDevicemapper(c)
+	key, err := s.operator.CreateClusterReconfigureDockerOperation(ops.CreateClusterReconfigureDockerOperationRequest{
+		AccountID:     s.cluster.AccountID,
+		ClusterName:   s.cluster.Domain,
+		AdvertiseIP:   "192.168.1.2",
+		StorageDriver: constants.DockerStorageDriverOverlay2,
+	})
+	c.Assert(err, check.IsNil)
+
+	err = ops.FailOperation(*key, s.operator, "failed")
+	c.Assert(err, check.IsNil)
+	s.assertClusterState(c, ops.SiteStateActive)
+	s.assertServerDocker(c,
+		storage.Docker{Device: storage.Device{Name: "/dev/xvdb"}},
+		storage.Docker{Device: storage.Device{Name: "/dev/xvdc"}})
+}
+
+func (s *ReconfigureSuite) TestRejectsInvalidStorageDriver(c *check.C) {
+	var testCases = []struct {
+		req     ops.CreateClusterReconfigureDockerOperationRequest
+		check   func(error) bool
+		comment string
+	}{
+		{
+			req:     ops.CreateClusterReconfigureDockerOperationRequest{AdvertiseIP: "192.168.1.1", StorageDriver: "btrfs"},
+			check:   trace.IsBadParameter,
+			comment: "unsupported storage driver",
+		},
+		{
+			req:     ops.CreateClusterReconfigureDockerOperationRequest{AdvertiseIP: "192.168.1.5", StorageDriver: "overlay2"},
+			check:   trace.IsNotFound,
+			comment: "unknown node",
+		},
+		{
+			req:     ops.CreateClusterReconfigureDockerOperationRequest{AdvertiseIP: "192.168.1.2", StorageDriver: "overlay"},
+			check:   trace.IsBadParameter,
+			comment: "node already uses the storage driver",
+		},
+		{
+			req:     ops.CreateClusterReconfigureDockerOperationRequest{AdvertiseIP: "192.168.1.2", StorageDriver: "overlay2"},
+			check:   trace.IsBadParameter,
+			comment: "node does not use devicemapper",
+		},
+	}
+	cluster, err := s.operator.backend().GetSite(s.cluster.Domain)
+	c.Assert(err, check.IsNil)
+	cluster.ClusterState.Servers[1].Docker.StorageDriver = constants.DockerStorageDriverOverlay
+	_, err = s.operator.backend().UpdateSite(*cluster)
+	c.Assert(err, check.IsNil)
+	for _, tc := range testCases {
+		tc.req.AccountID = s.cluster.AccountID
+		tc.req.ClusterName = s.cluster.Domain
+		_, err := s.operator.CreateClusterReconfigureDockerOperation(tc.req)
+		c.Assert(err, check.NotNil, check.Commentf(tc.comment))
+		c.Assert(tc.check(err), check.Equals, true, check.Commentf("%v: %v", tc.comment, err))
+	}
+	s.assertClusterState(c, ops.SiteStateActive)
+}
+
+func (s *ReconfigureSuite) TestNextReconfiguredVersion(c *check.C) {
+	var testCases = []struct {
+		version  string
+		expected string
+	}{
+		{version: "5.5.0", expected: "5.5.1-reconfigured.1"},
+		{version: "5.5.0-11312", expected: "5.5.0-11312.reconfigured.1"},
+		{version: "5.5.0-11312.reconfigured.1", expected: "5.5.0-11312.reconfigured.2"},
+		{version: "5.5.1-reconfigured.9", expected: "5.5.1-reconfigured.10"},
+	}
+	for _, tc := range testCases {
+		version := semver.New(tc.version)
+		next := nextReconfiguredVersion(*version)
+		c.Assert(next.String(), check.Equals, tc.expected, check.Commentf(tc.version))
+		c.Assert(version.LessThan(next), check.Equals, true, check.Commentf(tc.version))
+	}
+	c.Assert(semver.New("5.5.1-reconfigured.1").LessThan(*semver.New("5.5.1")), check.Equals, true)
+}
+
+func (s *ReconfigureSuite) assertServerAddrs(c *check.C, addrs ...string) {
+	cluster, err := s.operator.GetSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	var actual []string
+	for _, server := range cluster.ClusterState.Servers {
+		actual = append(actual, server.AdvertiseIP)
+	}
+	c.Assert(actual, check.DeepEquals, addrs)
+}
+
+// setDevicemapper configures the cluster to use the devicemapper
+// storage driver with a dedicated device on each node
+func (s *ReconfigureSuite) setDevicemapper(c *check.C) {
+	cluster, err := s.operator.backend().GetSite(s.cluster.Domain)
+	c.Assert(err, check.IsNil)
+	cluster.ClusterState.Docker.StorageDriver = constants.DockerStorageDriverDevicemapper
+	cluster.ClusterState.Servers[0].Docker.Device = storage.Device{Name: "/dev/xvdb"}
+	cluster.ClusterState.Servers[1].Docker.Device = storage.Device{Name: "/dev/xvdc"}
+	_, err = s.operator.backend().UpdateSite(*cluster)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *ReconfigureSuite) assertServerDocker(c *check.C, docker ...storage.Docker) {
+	cluster, err := s.operator.GetSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	var actual []storage.Docker
+	for _, server := range cluster.ClusterState.Servers {
+		actual = append(actual, server.Docker)
+	}
+	c.Assert(actual, check.DeepEquals, docker)
+}
+
+func (s *ReconfigureSuite) assertClusterState(c *check.C, state string) {
+	cluster, err := s.operator.GetSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	c.Assert(cluster.State, check.Equals, state)
+}
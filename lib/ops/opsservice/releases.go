@@ -0,0 +1,301 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	appservice "github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/helm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+)
+
+// ReleaseClient manages application releases in the cluster
+type ReleaseClient interface {
+	// Install installs a chart as a new release
+	Install(helm.InstallParameters) (*helm.Release, error)
+	// List returns releases matching the provided parameters
+	List(helm.ListParameters) ([]helm.Release, error)
+	// Get returns the release with the specified name
+	Get(name string) (*helm.Release, error)
+	// Upgrade upgrades an existing release
+	Upgrade(helm.UpgradeParameters) (*helm.Release, error)
+	// Uninstall uninstalls the release with the specified name
+	Uninstall(name string) (*helm.Release, error)
+	// Close releases resources held by the client
+	Close() error
+}
+
+// ListReleases returns all application releases of the specified cluster
+func (o *Operator) ListReleases(key ops.SiteKey) ([]ops.Release, error) {
+	client, err := o.newReleaseClient()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer client.Close()
+	releases, err := client.List(helm.ListParameters{})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	result := make([]ops.Release, 0, len(releases))
+	for _, release := range releases {
+		result = append(result, *toRelease(release))
+	}
+	return result, nil
+}
+
+// GetRelease returns the application release with the specified name
+func (o *Operator) GetRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	client, err := o.newReleaseClient()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer client.Close()
+	release, err := client.Get(name)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return toRelease(*release), nil
+}
+
+// InstallRelease installs an application image or a chart from the cluster
+// package service as a new release.
+//
+// Application images have to be uploaded to the cluster beforehand.
+// Their Docker images are pushed to the cluster registries before
+// the release is installed
+func (o *Operator) InstallRelease(req ops.InstallReleaseRequest) (*ops.Release, error) {
+	ctx, err := o.releaseValuesContext(req.SiteKey())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	dir, err := ioutil.TempDir("", "release")
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(dir)
+	path, err := o.fetchReleaseChart(req.SiteKey(), req.Locator, dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	values, err := writeReleaseValues(req.Values, req.ValuesTemplate, dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	client, err := o.newReleaseClient()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer client.Close()
+	release, err := client.Install(helm.InstallParameters{
+		Path:      path,
+		Values:    values,
+		Set:       req.Set,
+		Name:      req.Name,
+		Namespace: req.Namespace,
+		Context:   ctx,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	o.Infof("Installed release %v from %v.", release.Name, req.Locator)
+	return toRelease(*release), nil
+}
+
+// UpgradeRelease upgrades an existing release to the specified application
+// image or chart from the cluster package service
+func (o *Operator) UpgradeRelease(req ops.UpgradeReleaseRequest) (*ops.Release, error) {
+	ctx, err := o.releaseValuesContext(req.SiteKey())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	client, err := o.newReleaseClient()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer client.Close()
+	release, err := client.Get(req.Release)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	dir, err := ioutil.TempDir("", "release")
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(dir)
+	path, err := o.fetchReleaseChart(req.SiteKey(), req.Locator, dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	values, err := writeReleaseValues(req.Values, req.ValuesTemplate, dir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	release, err = client.Upgrade(helm.UpgradeParameters{
+		Release: release.Name,
+		Path:    path,
+		Values:  values,
+		Set:     req.Set,
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	o.Infof("Upgraded release %v to %v.", release.Name, req.Locator)
+	return toRelease(*release), nil
+}
+
+// UninstallRelease uninstalls the release with the specified name
+func (o *Operator) UninstallRelease(key ops.SiteKey, name string) (*ops.Release, error) {
+	client, err := o.newReleaseClient()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer client.Close()
+	release, err := client.Uninstall(name)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	o.Infof("Uninstalled release %v.", release.Name)
+	return toRelease(*release), nil
+}
+
+func (o *Operator) newReleaseClient() (ReleaseClient, error) {
+	if o.cfg.NewReleaseClient != nil {
+		return o.cfg.NewReleaseClient()
+	}
+	client, config, err := utils.GetKubeClient("")
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return helm.NewClient(helm.ClientConfig{
+		KubeClient: client,
+		KubeConfig: config,
+	})
+}
+
+// fetchReleaseChart makes the chart referenced by locator available in dir
+// and returns the path to it.
+//
+// The locator either references a chart in the cluster chart repository
+// which is downloaded, or an application image which is unpacked after
+// its Docker images have been pushed to the cluster registries
+func (o *Operator) fetchReleaseChart(key ops.SiteKey, locator loc.Locator, dir string) (path string, err error) {
+	reader, err := helm.FetchChart(o.cfg.Packages, locator)
+	if err != nil && !trace.IsNotFound(err) {
+		return "", trace.Wrap(err)
+	}
+	if err == nil {
+		defer reader.Close()
+		path = filepath.Join(dir, helm.ChartFilename(locator.Name, locator.Version))
+		if err := utils.CopyReaderWithPerms(path, reader, defaults.SharedReadMask); err != nil {
+			return "", trace.Wrap(err)
+		}
+		return path, nil
+	}
+	if err := o.syncReleaseImages(key, locator); err != nil {
+		return "", trace.Wrap(err)
+	}
+	err = pack.Unpack(o.cfg.Packages, locator, dir, nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return filepath.Join(dir, defaults.ResourcesDir), nil
+}
+
+// syncReleaseImages pushes the Docker images of the specified application
+// and its dependencies to the registries on all cluster masters
+func (o *Operator) syncReleaseImages(key ops.SiteKey, locator loc.Locator) error {
+	cluster, err := o.GetSite(key)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, master := range cluster.ClusterState.Servers.Masters() {
+		registry := defaults.DockerRegistryAddr(master.AdvertiseIP)
+		o.Infof("Pushing images of %v to registry %v.", locator, registry)
+		// use the cert name of default registry, but connect via IP without relying on DNS
+		err := o.cfg.Apps.ExportApp(appservice.ExportAppRequest{
+			Package:         locator,
+			RegistryAddress: registry,
+			CertName:        constants.DockerRegistry,
+		})
+		if err != nil {
+			return trace.Wrap(err, "failed to push images of %v to registry %v",
+				locator, registry)
+		}
+	}
+	return nil
+}
+
+// releaseValuesContext returns the cluster facts release values can reference
+func (o *Operator) releaseValuesContext(key ops.SiteKey) (*helm.ValuesContext, error) {
+	cluster, err := o.GetSite(key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	flavor := cluster.Labels[ops.SiteLabelFlavor]
+	if flavor == "" {
+		flavor = cluster.App.Manifest.DefaultFlavor()
+	}
+	return &helm.ValuesContext{
+		Cluster: helm.ClusterFacts{
+			Name:            cluster.Domain,
+			RegistryAddress: constants.DockerRegistry,
+			NodeCount:       len(cluster.ClusterState.Servers),
+			Flavor:          flavor,
+		},
+	}, nil
+}
+
+// writeReleaseValues writes the values file contents into dir and returns
+// the list of values files to use.
+//
+// If template is set, the values are written as a values template
+func writeReleaseValues(values []byte, template bool, dir string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	path := filepath.Join(dir, "values.yaml")
+	if template {
+		path += helm.ValuesTemplateExtension
+	}
+	if err := ioutil.WriteFile(path, values, defaults.SharedReadMask); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	return []string{path}, nil
+}
+
+func toRelease(release helm.Release) *ops.Release {
+	return &ops.Release{
+		Name:        release.Name,
+		Status:      release.Status,
+		Chart:       release.Chart,
+		Namespace:   release.Namespace,
+		Updated:     release.Updated,
+		Revision:    release.Revision,
+		Description: release.Description,
+	}
+}
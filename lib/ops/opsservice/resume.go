@@ -37,6 +37,21 @@ func (o *Operator) ResumeShrink(key ops.SiteKey) (*ops.SiteOperationKey, error)
 	return opKey, nil
 }
 
+// ExecuteShrinkPhase executes or rolls back the specified phase of
+// the shrink operation plan
+func (o *Operator) ExecuteShrinkPhase(req ops.ShrinkPhaseRequest) error {
+	if err := req.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	site, err := o.openSite(req.Key.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(site.executeShrinkPhase(req))
+}
+
 func (s *site) resumeShrink() (*ops.SiteOperationKey, error) {
 	s.Debug("resume shrink operation")
 
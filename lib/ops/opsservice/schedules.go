@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateSchedule schedules a new operation
+func (o *Operator) CreateSchedule(req ops.CreateScheduleRequest) (*storage.Schedule, error) {
+	schedules, err := o.backend().GetSchedules(req.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	for _, schedule := range schedules {
+		if schedule.Operation == req.Operation && schedule.IsActive() {
+			return nil, trace.AlreadyExists("%v operation is already scheduled (%v), "+
+				"remove the existing schedule first", req.Operation, schedule.ID)
+		}
+	}
+	now := o.clock().UtcNow()
+	schedule, err := o.backend().CreateSchedule(storage.Schedule{
+		ClusterName: req.SiteDomain,
+		Operation:   req.Operation,
+		App:         req.App,
+		Window:      req.Window,
+		State:       storage.ScheduleStatePending,
+		Created:     now,
+		Updated:     now,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	log.Infof("Scheduled %v operation %v in window %v.", schedule.Operation, schedule.ID, schedule.Window)
+	return schedule, nil
+}
+
+// GetSchedules returns all scheduled operations of the cluster
+func (o *Operator) GetSchedules(key ops.SiteKey) ([]storage.Schedule, error) {
+	schedules, err := o.backend().GetSchedules(key.SiteDomain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes the scheduled operation by ID.
+// An operation that has already been started by the schedule keeps running
+// but is no longer restricted to the maintenance window
+func (o *Operator) DeleteSchedule(key ops.SiteKey, id string) error {
+	return trace.Wrap(o.backend().DeleteSchedule(key.SiteDomain, id))
+}
+
+// RunOnMaster executes the gravity command with the specified arguments
+// on one of the cluster master nodes and returns its output
+func (o *Operator) RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error) {
+	site, err := o.openSite(key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	server, err := site.getTeleportServer(schema.ServiceLabelRole, string(schema.ServiceRoleMaster))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	out, err := site.newTeleportRunner().Run(server, site.gravityCommand(args...)...)
+	if err != nil {
+		return out, trace.Wrap(err)
+	}
+	return out, nil
+}
+
+// RunOnNodes executes the gravity command with the specified arguments
+// on all cluster nodes one by one
+func (o *Operator) RunOnNodes(key ops.SiteKey, args ...string) error {
+	site, err := o.openSite(key)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	servers, err := site.getTeleportServers()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	runner := site.newTeleportRunner()
+	for _, server := range servers {
+		teleportServer, err := newTeleportServer(server)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		_, err = runner.Run(teleportServer, site.gravityCommand(args...)...)
+		if err != nil {
+			return trace.Wrap(err, "failed to run command on %v", teleportServer.Hostname)
+		}
+	}
+	return nil
+}
+
+func (s *site) newTeleportRunner() *teleportRunner {
+	return &teleportRunner{logRecorder{Entry: s.WithFields(log.Fields{})}, s.domainName, s.teleport()}
+}
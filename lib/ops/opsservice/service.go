@@ -120,6 +120,14 @@ type Config struct {
 
 	// LogForwarders allows to manage log forwarders via Kubernetes config maps
 	LogForwarders LogForwardersControl
+
+	// KubeClient is an optional Kubernetes client.
+	// If unspecified, the client is lazy-loaded from the in-cluster configuration
+	KubeClient *kubernetes.Clientset
+
+	// NewReleaseClient optionally overrides the way application release
+	// clients are created
+	NewReleaseClient func() (ReleaseClient, error)
 }
 
 // Operator implements Operator interface
@@ -153,6 +161,7 @@ func New(cfg Config) (*Operator, error) {
 	operator := &Operator{
 		cfg:             cfg,
 		mu:              sync.Mutex{},
+		kubeClient:      cfg.KubeClient,
 		providers:       map[ops.SiteKey]CloudProvider{},
 		operationGroups: map[ops.SiteKey]*operationGroup{},
 		FieldLogger:     log.WithField(trace.Component, constants.ComponentOps),
@@ -930,6 +939,19 @@ func (o *Operator) CreateSiteUninstallOperation(r ops.CreateSiteUninstallOperati
 	return key, nil
 }
 
+// ExecuteUninstallPhase executes or skips the specified phase of
+// the uninstall operation plan
+func (o *Operator) ExecuteUninstallPhase(req ops.UninstallPhaseRequest) error {
+	if err := req.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+	site, err := o.openSite(req.Key.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(site.executeUninstallPhase(req))
+}
+
 // CreateClusterGarbageCollectOperation creates a new garbage collection operation in the cluster
 func (o *Operator) CreateClusterGarbageCollectOperation(r ops.CreateClusterGarbageCollectOperationRequest) (*ops.SiteOperationKey, error) {
 	err := r.Check()
@@ -949,6 +971,63 @@ func (o *Operator) CreateClusterGarbageCollectOperation(r ops.CreateClusterGarba
 	return key, nil
 }
 
+// CreateClusterReconfigureNetworkOperation creates a new network reconfiguration operation in the cluster
+func (o *Operator) CreateClusterReconfigureNetworkOperation(r ops.CreateClusterReconfigureNetworkOperationRequest) (*ops.SiteOperationKey, error) {
+	err := r.Check()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(ops.SiteKey{AccountID: r.AccountID, SiteDomain: r.ClusterName})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	key, err := cluster.createReconfigureNetworkOperation(r)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return key, nil
+}
+
+// CreateClusterReconfigureNodeOperation creates a new node reconfiguration operation in the cluster
+func (o *Operator) CreateClusterReconfigureNodeOperation(r ops.CreateClusterReconfigureNodeOperationRequest) (*ops.SiteOperationKey, error) {
+	err := r.Check()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(ops.SiteKey{AccountID: r.AccountID, SiteDomain: r.ClusterName})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	key, err := cluster.createReconfigureNodeOperation(r)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return key, nil
+}
+
+// CreateClusterReconfigureDockerOperation creates a new Docker storage driver reconfiguration operation in the cluster
+func (o *Operator) CreateClusterReconfigureDockerOperation(r ops.CreateClusterReconfigureDockerOperationRequest) (*ops.SiteOperationKey, error) {
+	err := r.Check()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(ops.SiteKey{AccountID: r.AccountID, SiteDomain: r.ClusterName})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	key, err := cluster.createReconfigureDockerOperation(r)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return key, nil
+}
+
 func (o *Operator) SetOperationState(key ops.SiteOperationKey, req ops.SetOperationStateRequest) error {
 	o.Infof("%#v", req)
 	site, err := o.openSite(key.SiteKey())
@@ -23,6 +23,7 @@ import (
 
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/fsm"
 	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/schema"
 	"github.com/gravitational/gravity/lib/storage"
@@ -98,11 +99,21 @@ func (s *site) createShrinkOperation(req ops.CreateSiteShrinkOperationRequest) (
 		}
 	}
 
+	plan, err := s.newShrinkOperationPlan(*op, *server)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	key, err := s.getOperationGroup().createSiteOperation(*op)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
+	_, err = s.backend().CreateOperationPlan(*plan)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	s.reportProgress(ctx, ops.ProgressEntry{
 		State:      ops.ProgressStateInProgress,
 		Completion: 0,
@@ -155,12 +166,10 @@ func (s *site) validateShrinkRequest(req ops.CreateSiteShrinkOperationRequest, c
 	return server, nil
 }
 
-// shrinkOperationStart kicks off actuall uninstall process:
-// deprovisions servers, deletes packages
+// shrinkOperationStart kicks off actual node removal by executing
+// the operation plan
 func (s *site) shrinkOperationStart(ctx *operationContext) (err error) {
 	state := ctx.operation.Shrink
-	ctx.serversToRemove = state.Servers
-	force := state.Force
 
 	site, err := s.service.GetSite(s.key)
 	if err != nil {
@@ -181,229 +190,39 @@ func (s *site) shrinkOperationStart(ctx *operationContext) (err error) {
 		return nil
 	}
 
-	// if the operation was resumed, cloud provider might not be set
-	if s.service.getCloudProvider(s.key) == nil {
-		err = s.service.setCloudProviderFromRequest(
-			s.key, ctx.operation.Provisioner, &ctx.operation.Shrink.Vars)
-		if err != nil {
-			return trace.Wrap(err)
-		}
-	}
-
-	serverName := server.Hostname
-
-	if force {
-		ctx.RecordInfo("forcing %q removal", serverName)
-	} else {
-		ctx.RecordInfo("starting %q removal", serverName)
-	}
-
-	// shrink uses a couple of runners for the following purposes:
-	//  * teleport master runner is used to execute system commands that remove
-	//    the node from k8s, database, etc.
-	//  * agent runner runs on the removed node and is used to perform system
-	//    uninstall on it (if the node is online)
-	var masterRunner, agentRunner *serverRunner
-
-	masterRunner, err = s.getMasterRunner(ctx)
+	machine, err := s.newShrinkFSM(ctx)
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	// erase cloud provider info for this site which may contain sensitive information
+	// such as API keys
+	defer s.service.deleteCloudProvider(s.key)
 
-	// determine whether the node being removed is online and, if so, launch
-	// a shrink agent on it
-	online := false
-	var teleserver *teleportServer
-	if !state.NodeRemoved {
-		teleserver, err = s.getTeleportServerNoRetry(ops.Hostname, serverName)
-		if err != nil {
-			ctx.Warningf("node %q is offline: %v", serverName, trace.DebugReport(err))
-		} else {
-			agentRunner, err = s.launchAgent(ctx, *server)
-			if err != nil {
-				if !force {
-					return trace.Wrap(err)
-				}
-				ctx.Warningf("failed to launch agent on %q: %v", serverName, trace.DebugReport(err))
-			} else {
-				online = true
-			}
-		}
-	}
-
-	opKey := ctx.key()
-
-	// schedule some clean up actions to run regardless of the outcome of the operation
-	defer func() {
-		// erase cloud provider info for this site which may contain sensitive information
-		// such as API keys
-		s.service.deleteCloudProvider(s.key)
-		// stop running shrink agent
-		err := s.agentService().StopAgents(context.TODO(), opKey)
-		if err != nil {
-			ctx.Warningf("failed to stop shrink agent: %v", trace.DebugReport(err))
-		}
-	}()
-
-	if online {
-		ctx.RecordInfo("node %q is online", serverName)
+	if state.Force {
+		ctx.RecordInfo("forcing %q removal", server.Hostname)
 	} else {
-		ctx.RecordInfo("node %q is offline", serverName)
-	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 10,
-		Message:    "unregistering the node",
-	})
-
-	if err = s.unlabelNode(*server, masterRunner); err != nil {
-		if !force {
-			return trace.Wrap(err, "failed to unregister the node")
-		}
-		ctx.Warningf("failed to unregister the node, force continue: %v", trace.DebugReport(err))
-	}
-
-	if s.app.Manifest.HasHook(schema.HookNodeRemoving) {
-		s.reportProgress(ctx, ops.ProgressEntry{
-			State:      ops.ProgressStateInProgress,
-			Completion: 20,
-			Message:    "running pre-removal hooks",
-		})
-
-		if err = s.runHook(ctx, schema.HookNodeRemoving); err != nil {
-			if !force {
-				return trace.Wrap(err, "failed to run %v hook", schema.HookNodeRemoving)
-			}
-			ctx.Warningf("failed to run %v hook, force continue: %v", schema.HookNodeRemoving, trace.DebugReport(err))
-		}
-	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 30,
-		Message:    "removing the node from the cluster",
-	})
-
-	// delete node from the cluster
-	if teleserver != nil {
-		runner := s.newTeleportServerRunner(ctx, teleserver)
-		err = s.serfNodeLeave(runner)
-		if err != nil {
-			if !force {
-				return trace.Wrap(err, "failed to remove the node from the serf cluster")
-			}
-			ctx.Warnf("Failed to remove node %q from serf cluster: %v.", serverName, trace.DebugReport(err))
-		}
-	}
-	if err = s.removeNodeFromCluster(*server, masterRunner); err != nil {
-		if !force {
-			return trace.Wrap(err, "failed to remove the node from the cluster")
-		}
-		ctx.Warningf("Failed to remove node %q from the cluster, force continue: %v.",
-			serverName, trace.DebugReport(err))
+		ctx.RecordInfo("starting %q removal", server.Hostname)
 	}
 
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 40,
-		Message:    "removing the node from the database",
-	})
-
-	// remove etcd member
-	err = s.removeFromEtcd(ctx, masterRunner, *server)
-	// the node may be an etcd proxy and not a full member of the etcd cluster
-	if err != nil && !trace.IsNotFound(err) {
-		if !force {
-			return trace.Wrap(err, "failed to remove the node from the database")
-		}
-		ctx.Warningf("failed to remove the node from the database, force continue: %v", trace.DebugReport(err))
-	}
-
-	if online {
-		s.reportProgress(ctx, ops.ProgressEntry{
-			State:      ops.ProgressStateInProgress,
-			Completion: 50,
-			Message:    "uninstalling the system software",
-		})
-
-		if err = s.uninstallSystem(ctx, agentRunner); err != nil {
-			ctx.Warningf("error uninstalling the system software: %v", trace.DebugReport(err))
-		}
-	}
-
-	if isAWSProvisioner(ctx.operation.Provisioner) {
-		if !s.app.Manifest.HasHook(schema.HookNodesDeprovision) {
-			return trace.BadParameter("%v hook is not defined",
-				schema.HookNodesDeprovision)
-		}
-		ctx.Infof("using nodes deprovisioning hook")
-		err := s.runNodesDeprovisionHook(ctx)
-		if err != nil {
-			return trace.Wrap(err)
-		}
-		ctx.RecordInfo("nodes have been successfully deprovisioned")
-	}
-
-	if s.app.Manifest.HasHook(schema.HookNodeRemoved) {
-		s.reportProgress(ctx, ops.ProgressEntry{
-			State:      ops.ProgressStateInProgress,
-			Completion: 80,
-			Message:    "running post-removal hooks",
-		})
-
-		if err = s.runHook(ctx, schema.HookNodeRemoved); err != nil {
-			if !force {
-				return trace.Wrap(err, "failed to run %v hook", schema.HookNodeRemoved)
-			}
-			ctx.Warningf("failed to run %v hook, force continue: %v", schema.HookNodeRemoved, trace.DebugReport(err))
-		}
-	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 85,
-		Message:    "cleaning up packages",
-	})
-
-	provisionedServer := &ProvisionedServer{Server: *server}
-	if err = s.deletePackages(provisionedServer); err != nil {
-		if !force {
-			return trace.Wrap(err, "failed to clean up packages")
-		}
-		ctx.Warningf("failed to clean up packages, force continue: %v", trace.DebugReport(err))
-	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 90,
-		Message:    "waiting for operation to complete",
-	})
-
-	if err = s.waitForServerToDisappear(serverName); err != nil {
-		ctx.Warningf("failed to wait for server %v to disappear: %v", serverName, trace.DebugReport(err))
-	}
-
-	if err = s.removeClusterStateServers([]string{server.Hostname}); err != nil {
-		return trace.Wrap(err)
+	planErr := executeShrinkPlan(context.TODO(), machine)
+	if planErr != nil {
+		ctx.Warningf("Failed to execute plan: %v.", trace.DebugReport(planErr))
 	}
+	return trace.Wrap(machine.Complete(planErr))
+}
 
-	_, err = s.compareAndSwapOperationState(swap{
-		key:            opKey,
-		expectedStates: []string{ops.OperationStateShrinkInProgress},
-		newOpState:     ops.OperationStateCompleted,
-	})
-	if err != nil {
+// executeShrinkPlan executes the phases of the shrink operation plan
+// that have not completed yet.
+//
+// Phases left in progress by the process that has been executing the plan
+// before, e.g. a gravity site that has lost its leadership, are executed again
+func executeShrinkPlan(ctx context.Context, machine *fsm.FSM) error {
+	if err := machine.ResetInterruptedPhases(ctx); err != nil {
 		return trace.Wrap(err)
 	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateCompleted,
-		Completion: constants.Completed,
-		Message:    fmt.Sprintf("%v removed", serverName),
-	})
-
-	return nil
+	// the force flag of the operation makes individual phases tolerate
+	// failures, it does not force re-execution of completed phases
+	return trace.Wrap(machine.ExecutePlan(ctx, nil, false))
 }
 
 func (s *site) waitForServerToDisappear(hostname string) error {
@@ -553,6 +372,30 @@ func (s *site) deletePackages(server *ProvisionedServer) error {
 	return nil
 }
 
+// labelNode sets server profile labels on k8s node
+func (s *site) labelNode(server storage.Server, runner *serverRunner) error {
+	profile, err := s.app.Manifest.NodeProfiles.ByName(server.Role)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	var labelFlags []string
+	for label, value := range profile.Labels {
+		labelFlags = append(labelFlags, fmt.Sprintf("%s=%s", label, value))
+	}
+
+	command := s.planetEnterCommand(defaults.KubectlBin, "label", "nodes", "--overwrite",
+		fmt.Sprintf("-l=%v=%v", defaults.KubernetesHostnameLabel, server.KubeNodeID()))
+	command = append(command, labelFlags...)
+
+	err = utils.Retry(defaults.RetryInterval, defaults.RetryAttempts, func() error {
+		_, err := runner.Run(command...)
+		return trace.Wrap(err)
+	})
+
+	return trace.Wrap(err)
+}
+
 // unlabelNode deletes server profile labels from k8s node
 func (s *site) unlabelNode(server storage.Server, runner *serverRunner) error {
 	role := server.Role
@@ -0,0 +1,438 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// newShrinkFSM returns a state machine that executes the plan
+// of the shrink operation specified with ctx
+func (s *site) newShrinkFSM(ctx *operationContext) (*fsm.FSM, error) {
+	state := ctx.operation.Shrink
+	if state == nil || len(state.Servers) == 0 {
+		return nil, trace.BadParameter("%v is not a shrink operation", ctx.operation)
+	}
+	ctx.serversToRemove = state.Servers
+	// if the operation was resumed, cloud provider might not be set
+	if s.service.getCloudProvider(s.key) == nil {
+		err := s.service.setCloudProviderFromRequest(
+			s.key, ctx.operation.Provisioner, &state.Vars)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	engine := &shrinkEngine{
+		site:   s,
+		ctx:    ctx,
+		server: state.Servers[0],
+		force:  state.Force,
+	}
+	machine, err := fsm.New(fsm.Config{
+		Engine: engine,
+		Logger: ctx.Entry,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	machine.SetPreExec(engine.updateProgress)
+	return machine, nil
+}
+
+// executeShrinkPhase executes or rolls back the specified phase
+// of the shrink operation plan.
+//
+// Only failed operations can be resumed or have their phases executed manually:
+// an operation in progress is being executed by the cluster controller
+func (s *site) executeShrinkPhase(req ops.ShrinkPhaseRequest) (err error) {
+	operation, err := s.getSiteOperation(req.Key.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if operation.Type != ops.OperationShrink {
+		return trace.BadParameter("%v is not a shrink operation", operation)
+	}
+	switch operation.State {
+	case ops.OperationStateFailed:
+	case ops.OperationStateShrinkInProgress:
+		return trace.CompareFailed("operation %v is already in progress", operation.ID)
+	default:
+		return trace.BadParameter("operation %v is %v", operation.ID, operation.State)
+	}
+	// move the operation back into the in-progress state for the time
+	// of the execution so it cannot be resumed concurrently
+	_, err = s.compareAndSwapOperationState(swap{
+		key:            operation.Key(),
+		expectedStates: []string{ops.OperationStateFailed},
+		newOpState:     ops.OperationStateShrinkInProgress,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	var completed bool
+	defer func() {
+		if completed {
+			return
+		}
+		// the operation awaits more phases to be executed manually
+		_, swapErr := s.compareAndSwapOperationState(swap{
+			key:            operation.Key(),
+			expectedStates: []string{ops.OperationStateShrinkInProgress},
+			newOpState:     ops.OperationStateFailed,
+		})
+		if swapErr != nil && err == nil {
+			err = trace.Wrap(swapErr)
+		}
+	}()
+
+	if err := s.setSiteState(ops.SiteStateShrinking); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if req.PhaseID == fsm.RootPhase && !req.Rollback {
+		if err := s.executeOperation(operation.Key(), s.shrinkOperationStart); err != nil {
+			return trace.Wrap(err)
+		}
+		// the operation state is now managed by the operation execution
+		completed = true
+		return nil
+	}
+
+	ctx, err := s.newOperationContext(*operation)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer ctx.Close()
+	machine, err := s.newShrinkFSM(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer s.service.deleteCloudProvider(s.key)
+
+	params := fsm.Params{
+		PhaseID: req.PhaseID,
+		Force:   req.Force,
+	}
+	if req.Rollback {
+		return trace.Wrap(machine.RollbackPhase(context.TODO(), params))
+	}
+	if err := machine.ExecutePhase(context.TODO(), params); err != nil {
+		return trace.Wrap(err)
+	}
+	plan, err := machine.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if fsm.IsCompleted(plan) {
+		completed = true
+		return trace.Wrap(machine.Complete(nil))
+	}
+	return nil
+}
+
+// shrinkEngine is the fsm engine for the shrink operation.
+//
+// All phases are executed by the cluster controller which reaches the
+// cluster nodes using teleport and the shrink agent
+type shrinkEngine struct {
+	site *site
+	ctx  *operationContext
+	// server is the server being removed
+	server storage.Server
+	// force is whether the operation should proceed if a phase fails
+	force bool
+}
+
+// GetExecutor returns the executor for the specified phase
+func (e *shrinkEngine) GetExecutor(params fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+	executor := &shrinkExecutor{
+		FieldLogger: e.ctx.WithField(constants.FieldPhase, params.Phase.ID),
+		engine:      e,
+	}
+	switch params.Phase.ID {
+	case shrinkUnregisterPhase:
+		executor.execute = e.unregister
+		executor.rollback = e.register
+	case shrinkPreHookPhase:
+		executor.execute = e.runHook(schema.HookNodeRemoving)
+	case shrinkKubernetesPhase:
+		executor.execute = e.removeFromKubernetes
+	case shrinkEtcdPhase:
+		executor.execute = e.removeFromEtcd
+	case shrinkSystemPhase:
+		executor.execute = e.uninstallSystem
+	case shrinkDeprovisionPhase:
+		executor.execute = e.deprovision
+	case shrinkPostHookPhase:
+		executor.execute = e.runHook(schema.HookNodeRemoved)
+	case shrinkPackagesPhase:
+		executor.execute = e.deletePackages
+	case shrinkCleanupPhase:
+		executor.execute = e.cleanup
+	default:
+		return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+	}
+	return executor, nil
+}
+
+// ChangePhaseState creates a new changelog entry for the plan
+func (e *shrinkEngine) ChangePhaseState(ctx context.Context, change fsm.StateChange) error {
+	_, err := e.site.backend().CreateOperationPlanChange(storage.PlanChange{
+		ID:          uuid.New(),
+		ClusterName: e.ctx.operation.SiteDomain,
+		OperationID: e.ctx.operation.ID,
+		PhaseID:     change.Phase,
+		NewState:    change.State,
+		Error:       utils.ToRawTrace(change.Error),
+		Created:     e.site.clock().UtcNow(),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	e.ctx.Debugf("Applied %v.", change)
+	return nil
+}
+
+// GetPlan returns the up-to-date operation plan
+func (e *shrinkEngine) GetPlan() (*storage.OperationPlan, error) {
+	plan, err := e.site.service.GetOperationPlan(e.ctx.key())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return plan, nil
+}
+
+// RunCommand is not supported as all shrink phases are executed by the cluster controller
+func (e *shrinkEngine) RunCommand(ctx context.Context, runner fsm.RemoteRunner, server storage.Server, params fsm.Params) error {
+	return trace.BadParameter("shrink phases are executed by the cluster controller")
+}
+
+// Complete marks the operation completed if all phases of the plan
+// have completed. Failed operations are handled by the caller
+func (e *shrinkEngine) Complete(fsmErr error) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !fsm.IsCompleted(plan) {
+		if fsmErr == nil {
+			fsmErr = trace.BadParameter("not all phases have completed")
+		}
+		return trace.Wrap(fsmErr)
+	}
+	_, err = e.site.compareAndSwapOperationState(swap{
+		key:            e.ctx.key(),
+		expectedStates: []string{ops.OperationStateShrinkInProgress},
+		newOpState:     ops.OperationStateCompleted,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	e.site.reportProgress(e.ctx, ops.ProgressEntry{
+		State:      ops.ProgressStateCompleted,
+		Completion: constants.Completed,
+		Message:    fmt.Sprintf("%v removed", e.server.Hostname),
+	})
+	return nil
+}
+
+// updateProgress reports the progress of the operation before
+// each phase is executed
+func (e *shrinkEngine) updateProgress(ctx context.Context, params fsm.Params) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	phase, err := fsm.FindPhase(plan, params.PhaseID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	e.site.reportProgress(e.ctx, ops.ProgressEntry{
+		State:      ops.ProgressStateInProgress,
+		Completion: 100 / utils.Max(len(plan.Phases), 1) * (phase.Step - 1),
+		Step:       phase.Step,
+		Message:    phase.Description,
+	})
+	return nil
+}
+
+// tolerate returns nil if the operation is forced and err otherwise.
+// Forced operations remove the node even if some steps fail, for
+// example, when the node is offline
+func (e *shrinkEngine) tolerate(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	if !e.force {
+		return trace.Wrap(err, message)
+	}
+	e.ctx.Warningf("%v, force continue: %v.", message, trace.DebugReport(err))
+	return nil
+}
+
+func (e *shrinkEngine) unregister() error {
+	runner, err := e.site.getMasterRunner(e.ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return e.tolerate(e.site.unlabelNode(e.server, runner), "failed to unregister the node")
+}
+
+func (e *shrinkEngine) register() error {
+	runner, err := e.site.getMasterRunner(e.ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(e.site.labelNode(e.server, runner))
+}
+
+func (e *shrinkEngine) runHook(hook schema.HookType) func() error {
+	return func() error {
+		return e.tolerate(e.site.runHook(e.ctx, hook),
+			fmt.Sprintf("failed to run %v hook", hook))
+	}
+}
+
+func (e *shrinkEngine) removeFromKubernetes() error {
+	runner, err := e.site.getMasterRunner(e.ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	teleserver, err := e.site.getTeleportServerNoRetry(ops.Hostname, e.server.Hostname)
+	if err != nil {
+		e.ctx.Warningf("Node %q is offline: %v.", e.server.Hostname, trace.DebugReport(err))
+	} else {
+		err = e.site.serfNodeLeave(e.site.newTeleportServerRunner(e.ctx, teleserver))
+		if err := e.tolerate(err, "failed to remove the node from the serf cluster"); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return e.tolerate(e.site.removeNodeFromCluster(e.server, runner),
+		"failed to remove the node from the cluster")
+}
+
+func (e *shrinkEngine) removeFromEtcd() error {
+	runner, err := e.site.getMasterRunner(e.ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = e.site.removeFromEtcd(e.ctx, runner, e.server)
+	// the node may be an etcd proxy and not a full member of the etcd cluster
+	if trace.IsNotFound(err) {
+		return nil
+	}
+	return e.tolerate(err, "failed to remove the node from the database")
+}
+
+// uninstallSystem launches the shrink agent on the node being removed and
+// uninstalls the system software. Offline nodes are skipped
+func (e *shrinkEngine) uninstallSystem() error {
+	_, err := e.site.getTeleportServerNoRetry(ops.Hostname, e.server.Hostname)
+	if err != nil {
+		e.ctx.RecordInfo("node %q is offline", e.server.Hostname)
+		return nil
+	}
+	defer func() {
+		err := e.site.agentService().StopAgents(context.TODO(), e.ctx.key())
+		if err != nil {
+			e.ctx.Warningf("Failed to stop shrink agent: %v.", trace.DebugReport(err))
+		}
+	}()
+	runner, err := e.site.launchAgent(e.ctx, e.server)
+	if err != nil {
+		return e.tolerate(err, "failed to launch agent on the node")
+	}
+	e.ctx.RecordInfo("node %q is online", e.server.Hostname)
+	if err := e.site.uninstallSystem(e.ctx, runner); err != nil {
+		e.ctx.Warningf("Error uninstalling the system software: %v.", trace.DebugReport(err))
+	}
+	return nil
+}
+
+func (e *shrinkEngine) deprovision() error {
+	if !e.site.app.Manifest.HasHook(schema.HookNodesDeprovision) {
+		return trace.BadParameter("%v hook is not defined", schema.HookNodesDeprovision)
+	}
+	e.ctx.Info("Using nodes deprovisioning hook.")
+	if err := e.site.runNodesDeprovisionHook(e.ctx); err != nil {
+		return trace.Wrap(err)
+	}
+	e.ctx.RecordInfo("nodes have been successfully deprovisioned")
+	return nil
+}
+
+func (e *shrinkEngine) deletePackages() error {
+	err := e.site.deletePackages(&ProvisionedServer{Server: e.server})
+	return e.tolerate(err, "failed to clean up packages")
+}
+
+func (e *shrinkEngine) cleanup() error {
+	if err := e.site.waitForServerToDisappear(e.server.Hostname); err != nil {
+		e.ctx.Warningf("Failed to wait for server %v to disappear: %v.",
+			e.server.Hostname, trace.DebugReport(err))
+	}
+	return trace.Wrap(e.site.removeClusterStateServers([]string{e.server.Hostname}))
+}
+
+// shrinkExecutor executes a single phase of the shrink operation
+type shrinkExecutor struct {
+	// FieldLogger is used for logging
+	log.FieldLogger
+	engine *shrinkEngine
+	// execute implements the phase
+	execute func() error
+	// rollback optionally reverts the phase
+	rollback func() error
+}
+
+// PreCheck is no-op for shrink phases
+func (p *shrinkExecutor) PreCheck(ctx context.Context) error {
+	return nil
+}
+
+// PostCheck is no-op for shrink phases
+func (p *shrinkExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
+
+// Execute executes the phase
+func (p *shrinkExecutor) Execute(ctx context.Context) error {
+	return trace.Wrap(p.execute())
+}
+
+// Rollback reverts the phase. Phases that remove the node from the
+// cluster services cannot be reverted and are no-op: the node needs
+// to join the cluster again instead
+func (p *shrinkExecutor) Rollback(ctx context.Context) error {
+	if p.rollback == nil {
+		p.Warn("Phase cannot be rolled back.")
+		return nil
+	}
+	return trace.Wrap(p.rollback())
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+const (
+	// shrinkUnregisterPhase removes server profile labels from the node
+	shrinkUnregisterPhase = "/unregister"
+	// shrinkPreHookPhase runs the application's node removing hook
+	shrinkPreHookPhase = "/pre-hook"
+	// shrinkKubernetesPhase removes the node from the serf and kubernetes clusters
+	shrinkKubernetesPhase = "/kubernetes"
+	// shrinkEtcdPhase removes the node from the etcd cluster
+	shrinkEtcdPhase = "/etcd"
+	// shrinkSystemPhase uninstalls the system software from the node
+	shrinkSystemPhase = "/system"
+	// shrinkDeprovisionPhase deprovisions the node with the cloud provider
+	shrinkDeprovisionPhase = "/deprovision"
+	// shrinkPostHookPhase runs the application's node removed hook
+	shrinkPostHookPhase = "/post-hook"
+	// shrinkPackagesPhase deletes the node's packages from the cluster package service
+	shrinkPackagesPhase = "/packages"
+	// shrinkCleanupPhase removes the node from the cluster state
+	shrinkCleanupPhase = "/cleanup"
+)
+
+// newShrinkOperationPlan returns the plan for the shrink operation
+// that removes the specified server
+func (s *site) newShrinkOperationPlan(operation ops.SiteOperation, server storage.Server) (*storage.OperationPlan, error) {
+	if operation.Shrink == nil {
+		return nil, trace.BadParameter("%v is not a shrink operation", operation)
+	}
+	cluster, err := s.service.GetSite(s.key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	manifest := s.app.Manifest
+	var phases []storage.OperationPhase
+	addPhase := func(id, format string) {
+		phase := storage.OperationPhase{
+			ID:          id,
+			Description: fmt.Sprintf(format, server.Hostname),
+			Step:        len(phases) + 1,
+		}
+		if len(phases) != 0 {
+			phase.Requires = []string{phases[len(phases)-1].ID}
+		}
+		phases = append(phases, phase)
+	}
+	addPhase(shrinkUnregisterPhase, "Unregister node %v")
+	if manifest.HasHook(schema.HookNodeRemoving) {
+		addPhase(shrinkPreHookPhase, "Run pre-removal hook for node %v")
+	}
+	addPhase(shrinkKubernetesPhase, "Remove node %v from Kubernetes cluster")
+	addPhase(shrinkEtcdPhase, "Remove node %v from etcd cluster")
+	if !operation.Shrink.NodeRemoved {
+		addPhase(shrinkSystemPhase, "Uninstall system software from node %v")
+	}
+	if isAWSProvisioner(operation.Provisioner) {
+		addPhase(shrinkDeprovisionPhase, "Deprovision node %v")
+	}
+	if manifest.HasHook(schema.HookNodeRemoved) {
+		addPhase(shrinkPostHookPhase, "Run post-removal hook for node %v")
+	}
+	addPhase(shrinkPackagesPhase, "Delete packages of node %v")
+	addPhase(shrinkCleanupPhase, "Remove node %v from cluster state")
+	return &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Phases:        phases,
+		Servers:       cluster.ClusterState.Servers,
+		CreatedAt:     s.clock().UtcNow(),
+	}, nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/suite"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/check.v1"
+)
+
+type ShrinkPlanSuite struct {
+	operator *Operator
+	cluster  *ops.Site
+}
+
+var _ = check.Suite(&ShrinkPlanSuite{})
+
+func (s *ShrinkPlanSuite) SetUpTest(c *check.C) {
+	services := SetupTestServices(c)
+	s.operator = services.Operator
+
+	suite := &suite.OpsSuite{}
+	app, err := suite.SetUpTestPackage(services.Apps, services.Packages, c)
+	c.Assert(err, check.IsNil)
+
+	account, err := s.operator.CreateAccount(ops.NewAccountRequest{
+		Org: "shrinkplan.test",
+	})
+	c.Assert(err, check.IsNil)
+
+	s.cluster, err = s.operator.CreateSite(ops.NewSiteRequest{
+		AccountID:  account.ID,
+		AppPackage: app.String(),
+		Provider:   schema.ProvisionerOnPrem,
+		DomainName: "shrinkplan.test",
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *ShrinkPlanSuite) TestPlanPhasesAreSequential(c *check.C) {
+	plan := s.newPlan(c, schema.ProvisionerOnPrem, false)
+	c.Assert(phaseIDs(plan), check.DeepEquals, []string{
+		shrinkUnregisterPhase,
+		shrinkKubernetesPhase,
+		shrinkEtcdPhase,
+		shrinkSystemPhase,
+		shrinkPackagesPhase,
+		shrinkCleanupPhase,
+	})
+	for i, phase := range plan.Phases {
+		c.Assert(phase.Step, check.Equals, i+1)
+		if i == 0 {
+			c.Assert(phase.Requires, check.HasLen, 0)
+		} else {
+			c.Assert(phase.Requires, check.DeepEquals, []string{plan.Phases[i-1].ID})
+		}
+	}
+}
+
+func (s *ShrinkPlanSuite) TestPlanForRemovedNode(c *check.C) {
+	plan := s.newPlan(c, schema.ProvisionerAWSTerraform, true)
+	c.Assert(phaseIDs(plan), check.DeepEquals, []string{
+		shrinkUnregisterPhase,
+		shrinkKubernetesPhase,
+		shrinkEtcdPhase,
+		shrinkDeprovisionPhase,
+		shrinkPackagesPhase,
+		shrinkCleanupPhase,
+	})
+}
+
+func (s *ShrinkPlanSuite) TestResumesPlanWithInterruptedPhase(c *check.C) {
+	site, operation, plan := s.createOperation(c, ops.OperationStateShrinkInProgress)
+	// the previous leader completed the first phase and
+	// has been terminated while executing the second one
+	s.changePhaseState(c, plan.Phases[0].ID, storage.OperationPhaseStateCompleted)
+	s.changePhaseState(c, plan.Phases[1].ID, storage.OperationPhaseStateInProgress)
+
+	ctx := &operationContext{
+		Entry:     log.WithField("test", "shrink"),
+		operation: *operation,
+	}
+	engine := &recordingShrinkEngine{shrinkEngine: &shrinkEngine{
+		site:   site,
+		ctx:    ctx,
+		server: operation.Shrink.Servers[0],
+	}}
+	machine, err := fsm.New(fsm.Config{Engine: engine})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(executeShrinkPlan(context.TODO(), machine), check.IsNil)
+	c.Assert(engine.executed, check.DeepEquals, phaseIDs(plan)[1:])
+	resolved, err := s.operator.GetOperationPlan(operation.Key())
+	c.Assert(err, check.IsNil)
+	c.Assert(fsm.IsCompleted(resolved), check.Equals, true)
+}
+
+func (s *ShrinkPlanSuite) TestRejectsPhasesOfOperationInProgress(c *check.C) {
+	site, operation, _ := s.createOperation(c, ops.OperationStateShrinkInProgress)
+	for _, phaseID := range []string{fsm.RootPhase, shrinkEtcdPhase} {
+		err := site.executeShrinkPhase(ops.ShrinkPhaseRequest{
+			Key:     operation.Key(),
+			PhaseID: phaseID,
+		})
+		c.Assert(trace.IsCompareFailed(err), check.Equals, true, check.Commentf("%v", err))
+	}
+}
+
+func (s *ShrinkPlanSuite) TestRestoresFailedStateAfterPhaseFailure(c *check.C) {
+	site, operation, _ := s.createOperation(c, ops.OperationStateFailed)
+	err := site.executeShrinkPhase(ops.ShrinkPhaseRequest{
+		Key:     operation.Key(),
+		PhaseID: "/unknown",
+	})
+	c.Assert(err, check.NotNil)
+	failed, err := s.operator.GetSiteOperation(operation.Key())
+	c.Assert(err, check.IsNil)
+	c.Assert(failed.State, check.Equals, ops.OperationStateFailed)
+}
+
+// createOperation creates a shrink operation in the specified state
+// together with its plan
+func (s *ShrinkPlanSuite) createOperation(c *check.C, state string) (*site, *ops.SiteOperation, *storage.OperationPlan) {
+	site, err := s.operator.openSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	server := storage.Server{Hostname: "node-1", AdvertiseIP: "10.0.0.1"}
+	operation := ops.SiteOperation{
+		ID:          "op-1",
+		AccountID:   s.cluster.AccountID,
+		SiteDomain:  s.cluster.Domain,
+		Type:        ops.OperationShrink,
+		State:       state,
+		Provisioner: schema.ProvisionerOnPrem,
+		Created:     time.Now().UTC(),
+		Shrink: &storage.ShrinkOperationState{
+			Servers: []storage.Server{server},
+		},
+	}
+	_, err = s.operator.backend().CreateSiteOperation(storage.SiteOperation(operation))
+	c.Assert(err, check.IsNil)
+	plan, err := site.newShrinkOperationPlan(operation, server)
+	c.Assert(err, check.IsNil)
+	_, err = s.operator.backend().CreateOperationPlan(*plan)
+	c.Assert(err, check.IsNil)
+	return site, &operation, plan
+}
+
+func (s *ShrinkPlanSuite) changePhaseState(c *check.C, phaseID, state string) {
+	_, err := s.operator.backend().CreateOperationPlanChange(storage.PlanChange{
+		ID:          uuid.New(),
+		ClusterName: s.cluster.Domain,
+		OperationID: "op-1",
+		PhaseID:     phaseID,
+		NewState:    state,
+		Created:     time.Now().UTC(),
+	})
+	c.Assert(err, check.IsNil)
+}
+
+// recordingShrinkEngine records the phases of the shrink
+// operation plan instead of executing them
+type recordingShrinkEngine struct {
+	*shrinkEngine
+	executed []string
+}
+
+// GetExecutor returns the executor that records the specified phase
+func (e *recordingShrinkEngine) GetExecutor(params fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+	return &shrinkExecutor{
+		FieldLogger: e.ctx.Entry,
+		execute: func() error {
+			e.executed = append(e.executed, params.Phase.ID)
+			return nil
+		},
+	}, nil
+}
+
+func (s *ShrinkPlanSuite) newPlan(c *check.C, provisioner string, nodeRemoved bool) *storage.OperationPlan {
+	site, err := s.operator.openSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	server := storage.Server{Hostname: "node-1", AdvertiseIP: "10.0.0.1"}
+	plan, err := site.newShrinkOperationPlan(ops.SiteOperation{
+		ID:          "op-1",
+		AccountID:   s.cluster.AccountID,
+		SiteDomain:  s.cluster.Domain,
+		Type:        ops.OperationShrink,
+		Provisioner: provisioner,
+		Shrink: &storage.ShrinkOperationState{
+			Servers:     []storage.Server{server},
+			NodeRemoved: nodeRemoved,
+		},
+	}, server)
+	c.Assert(err, check.IsNil)
+	return plan
+}
+
+func phaseIDs(plan *storage.OperationPlan) (ids []string) {
+	for _, phase := range plan.Phases {
+		ids = append(ids, phase.ID)
+	}
+	return ids
+}
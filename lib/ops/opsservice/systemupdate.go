@@ -19,6 +19,7 @@ package opsservice
 import (
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
 	"github.com/gravitational/gravity/lib/schema"
 	"github.com/gravitational/gravity/lib/storage"
 
@@ -97,9 +98,17 @@ func (s *site) configurePlanetOnNode(
 		}
 	}
 
+	server := s.backendSite.ClusterState.Servers.FindByIP(node.AdvertiseIP)
+	if server != nil && server.Docker.StorageDriver != "" {
+		docker.StorageDriver = server.Docker.StorageDriver
+	}
+	if state := ctx.operation.ReconfigureDocker; state != nil && state.Server.AdvertiseIP == node.AdvertiseIP {
+		// The node is being migrated to a different storage driver
+		docker.StorageDriver = state.StorageDriver
+	}
+
 	var dockerRuntime storage.Docker
 	if docker.StorageDriver == constants.DockerStorageDriverDevicemapper {
-		server := s.backendSite.ClusterState.Servers.FindByIP(node.AdvertiseIP)
 		if server != nil {
 			dockerRuntime = server.Docker
 			if dockerRuntime.LVMSystemDirectory == "" {
@@ -117,7 +126,12 @@ func (s *site) configurePlanetOnNode(
 		return nil, trace.Wrap(err)
 	}
 
-	configPackage, err := s.planetConfigPackage(node, planetPackage.Version)
+	configVersion, err := s.planetConfigVersion(ctx.operation, node, *planetPackage)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	configPackage, err := s.planetConfigPackage(node, configVersion)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -138,6 +152,12 @@ func (s *site) configurePlanetOnNode(
 		return nil, trace.Wrap(err)
 	}
 
+	if resp != nil && isReconfigureOperation(ctx.operation) {
+		// Mark the package with the reconfiguration operation so it can
+		// be found by the nodes and removed on rollback
+		resp.Labels[pack.OperationIDLabel] = ctx.operation.ID
+	}
+
 	return resp, nil
 }
 
@@ -65,6 +65,13 @@ type TestServices struct {
 // SetupTestServices initializes backend and package and application services
 // that can be used in tests
 func SetupTestServices(c *check.C) TestServices {
+	return SetupTestServicesWithConfig(c, nil)
+}
+
+// SetupTestServicesWithConfig initializes test services like SetupTestServices
+// and lets the caller adjust the ops service configuration with configure,
+// e.g. to provide a Kubernetes client
+func SetupTestServicesWithConfig(c *check.C, configure func(*Config)) TestServices {
 	dir := c.MkDir()
 
 	backend, err := keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(dir, "bolt.db")})
@@ -114,7 +121,7 @@ func SetupTestServices(c *check.C) TestServices {
 		"localhost:0",
 		log)
 
-	opsService, err := New(Config{
+	config := Config{
 		StateDir:      dir,
 		Backend:       backend,
 		Agents:        agentService,
@@ -124,7 +131,11 @@ func SetupTestServices(c *check.C) TestServices {
 		Users:         usersService,
 		Apps:          appService,
 		ProcessID:     "p1",
-	})
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	opsService, err := New(config)
 	c.Assert(err, check.IsNil)
 
 	return TestServices{
@@ -17,7 +17,8 @@ limitations under the License.
 package opsservice
 
 import (
-	"github.com/gravitational/gravity/lib/constants"
+	"context"
+
 	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/ops/opsclient"
 	"github.com/gravitational/gravity/lib/schema"
@@ -25,7 +26,6 @@ import (
 
 	"github.com/gravitational/trace"
 	"github.com/pborman/uuid"
-	log "github.com/sirupsen/logrus"
 )
 
 // requestUninstall is called by cluster and makes a request to the remote
@@ -116,11 +116,21 @@ func (s *site) createUninstallOperation(req ops.CreateSiteUninstallOperationRequ
 		}
 	}
 
+	plan, err := s.newUninstallOperationPlan(*op)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	key, err := s.getOperationGroup().createSiteOperation(*op)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
+	_, err = s.backend().CreateOperationPlan(*plan)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	s.reportProgress(ctx, ops.ProgressEntry{
 		State:      ops.ProgressStateInProgress,
 		Completion: 0,
@@ -135,77 +145,56 @@ func (s *site) createUninstallOperation(req ops.CreateSiteUninstallOperationRequ
 	return key, nil
 }
 
-// uninstallOperationStart kicks off actuall uninstall process:
-// deprovisions servers, deletes packages
+// uninstallOperationStart executes the uninstall operation plan:
+// uninstalls the application, deprovisions or uninstalls the nodes
+// and deletes the cluster
 func (s *site) uninstallOperationStart(ctx *operationContext) error {
-	state := ctx.operation.Uninstall
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateInProgress,
-		Completion: 10,
-		Message:    "uninstalling applications",
-	})
-
-	// execute commands attempting to run uninstall hooks
-	err := s.uninstallUserApp(ctx)
+	machine, err := s.newUninstallFSM(ctx, false)
 	if err != nil {
-		if !state.Force {
-			return trace.Wrap(err, "failed to uninstall user app")
-		}
-		log.Warningf("forced uninstall: failed to uninstall user app: %v",
-			trace.DebugReport(err))
+		return trace.Wrap(err)
 	}
+	defer s.service.deleteCloudProvider(s.key)
 
-	// if user has supplied custom hooks, call them
-	if isAWSProvisioner(ctx.operation.Provisioner) {
-		if !s.app.Manifest.HasHook(schema.HookClusterDeprovision) {
-			return trace.BadParameter("%v hook is not defined",
-				schema.HookClusterDeprovision)
-		}
-		err := s.runClusterDeprovisionHook(ctx)
-		if err != nil {
-			return trace.Wrap(err)
-		}
+	planErr := machine.ExecutePlan(context.TODO(), nil, false)
+	if planErr != nil {
+		ctx.Warningf("Failed to execute uninstall plan: %v.", trace.DebugReport(planErr))
 	}
-
-	s.reportProgress(ctx, ops.ProgressEntry{
-		State:      ops.ProgressStateCompleted,
-		Completion: constants.Completed,
-		Message:    "uninstall completed",
-	})
-
-	return trace.Wrap(s.deleteSite())
+	return trace.Wrap(machine.Complete(planErr))
 }
 
+// uninstallUserApp runs the uninstall hook of the application followed
+// by the uninstall hooks of its dependencies.
+//
+// The pre-uninstall hook of the application is not run here since it is
+// executed by a separate phase of the uninstall plan, so it can be retried
+// independently of the uninstall hooks
 func (s *site) uninstallUserApp(ctx *operationContext) error {
-	log.Infof("uninstallUserApp")
-
 	s.reportProgress(ctx, ops.ProgressEntry{
 		State:      ops.ProgressStateInProgress,
 		Completion: 20,
 		Message:    "uninstalling user application",
 	})
 
-	runner := &teleportRunner{ctx, s.domainName, s.teleport()}
-
-	master, err := s.getTeleportServerNoRetry(schema.ServiceLabelRole,
-		string(schema.ServiceRoleMaster))
-	if err != nil {
-		return trace.Wrap(err)
-	}
-
-	userAppPackage, err := s.appPackage()
-	if err != nil {
-		return trace.Wrap(err)
+	if s.app.Manifest.HasHook(schema.HookUninstall) {
+		if err := s.runHook(ctx, schema.HookUninstall); err != nil {
+			return trace.Wrap(err)
+		}
 	}
 
-	command := s.planetGravityCommand("app", "package-uninstall", userAppPackage.String())
-	out, err := runner.Run(master, command...)
-	if err != nil {
-		return trace.Wrap(err)
+	for _, dependency := range s.app.Manifest.Dependencies.Apps {
+		app, err := s.appService.GetApp(dependency.Locator)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		for _, hook := range []schema.HookType{schema.HookUninstalling, schema.HookUninstall} {
+			if !app.Manifest.HasHook(hook) {
+				continue
+			}
+			if err := s.runPackageHook(ctx, dependency.Locator, hook); err != nil {
+				return trace.Wrap(err)
+			}
+		}
 	}
 
-	log.Infof("app uninstall output: %s", out)
-
 	return nil
 }
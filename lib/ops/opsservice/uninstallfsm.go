@@ -0,0 +1,345 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"context"
+	"path"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// newUninstallFSM returns a state machine that executes the plan
+// of the uninstall operation specified with ctx
+func (s *site) newUninstallFSM(ctx *operationContext, skip bool) (*fsm.FSM, error) {
+	state := ctx.operation.Uninstall
+	if state == nil {
+		return nil, trace.BadParameter("%v is not an uninstall operation", ctx.operation)
+	}
+	// if the operation was resumed, cloud provider might not be set
+	if s.service.getCloudProvider(s.key) == nil {
+		err := s.service.setCloudProviderFromRequest(
+			s.key, ctx.operation.Provisioner, &state.Vars)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	engine := &uninstallEngine{
+		site:  s,
+		ctx:   ctx,
+		force: state.Force,
+		skip:  skip,
+	}
+	machine, err := fsm.New(fsm.Config{
+		Engine: engine,
+		Logger: ctx.Entry,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	machine.SetPreExec(engine.updateProgress)
+	return machine, nil
+}
+
+// executeUninstallPhase executes or skips the specified phase
+// of the uninstall operation plan
+func (s *site) executeUninstallPhase(req ops.UninstallPhaseRequest) error {
+	if req.Skip && !isUninstallNodePhase(req.PhaseID) {
+		return trace.BadParameter("only node phases of %v can be skipped",
+			uninstallSystemPhase)
+	}
+	operation, err := s.getSiteOperation(req.Key.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if operation.Type != ops.OperationUninstall {
+		return trace.BadParameter("%v is not an uninstall operation", operation)
+	}
+	switch operation.State {
+	case ops.OperationStateUninstallInProgress:
+	case ops.OperationStateFailed:
+		// a failed operation is resumed by executing its remaining phases
+		// manually so move it back into the in-progress state
+		_, err = s.compareAndSwapOperationState(swap{
+			key:            operation.Key(),
+			expectedStates: []string{ops.OperationStateFailed},
+			newOpState:     ops.OperationStateUninstallInProgress,
+		})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if err := s.setSiteState(ops.SiteStateUninstalling); err != nil {
+			return trace.Wrap(err)
+		}
+	default:
+		return trace.BadParameter("operation %v is %v", operation.ID, operation.State)
+	}
+
+	if req.PhaseID == fsm.RootPhase {
+		return trace.Wrap(s.executeOperation(operation.Key(), s.uninstallOperationStart))
+	}
+
+	ctx, err := s.newOperationContext(*operation)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer ctx.Close()
+	machine, err := s.newUninstallFSM(ctx, req.Skip)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer s.service.deleteCloudProvider(s.key)
+
+	// the operation is removed along with the cluster by the last
+	// phase so there is nothing to complete afterwards
+	return trace.Wrap(machine.ExecutePhase(context.TODO(), fsm.Params{
+		PhaseID: req.PhaseID,
+		Force:   req.Force,
+	}))
+}
+
+// uninstallEngine is the fsm engine for the uninstall operation.
+//
+// All phases are executed by the Ops Center which reaches the
+// cluster nodes using teleport and the uninstall agent
+type uninstallEngine struct {
+	site *site
+	ctx  *operationContext
+	// force is whether the operation should proceed if a phase fails
+	force bool
+	// skip is whether node phases should be marked completed
+	// without uninstalling the node
+	skip bool
+}
+
+// GetExecutor returns the executor for the specified phase
+func (e *uninstallEngine) GetExecutor(params fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+	executor := &uninstallExecutor{
+		FieldLogger: e.ctx.WithField(constants.FieldPhase, params.Phase.ID),
+	}
+	switch {
+	case params.Phase.ID == uninstallPreHookPhase:
+		executor.execute = e.runPreUninstallHook
+	case params.Phase.ID == uninstallAppPhase:
+		executor.execute = e.uninstallApp
+	case params.Phase.ID == uninstallDeprovisionPhase:
+		executor.execute = e.deprovision
+	case isUninstallNodePhase(params.Phase.ID):
+		state := storage.ClusterState{Servers: params.Plan.Servers}
+		server, err := state.FindServer(path.Base(params.Phase.ID))
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		executor.execute = func() error {
+			return e.uninstallNode(*server)
+		}
+	case params.Phase.ID == uninstallDeregisterPhase:
+		executor.execute = e.deregister
+	default:
+		return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+	}
+	return executor, nil
+}
+
+// ChangePhaseState creates a new changelog entry for the plan
+func (e *uninstallEngine) ChangePhaseState(ctx context.Context, change fsm.StateChange) error {
+	if change.Phase == uninstallDeregisterPhase && change.State == storage.OperationPhaseStateCompleted {
+		// the plan has been removed along with the cluster
+		e.ctx.Debugf("Skip %v.", change)
+		return nil
+	}
+	_, err := e.site.backend().CreateOperationPlanChange(storage.PlanChange{
+		ID:          uuid.New(),
+		ClusterName: e.ctx.operation.SiteDomain,
+		OperationID: e.ctx.operation.ID,
+		PhaseID:     change.Phase,
+		NewState:    change.State,
+		Error:       utils.ToRawTrace(change.Error),
+		Created:     e.site.clock().UtcNow(),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	e.ctx.Debugf("Applied %v.", change)
+	return nil
+}
+
+// GetPlan returns the up-to-date operation plan
+func (e *uninstallEngine) GetPlan() (*storage.OperationPlan, error) {
+	plan, err := e.site.service.GetOperationPlan(e.ctx.key())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return plan, nil
+}
+
+// RunCommand is not supported as all uninstall phases are executed by the Ops Center
+func (e *uninstallEngine) RunCommand(ctx context.Context, runner fsm.RemoteRunner, server storage.Server, params fsm.Params) error {
+	return trace.BadParameter("uninstall phases are executed by the Ops Center")
+}
+
+// Complete finalizes the operation. Since the last phase of the plan
+// removes the cluster with all its operations, there is nothing left
+// to update unless the plan has not completed
+func (e *uninstallEngine) Complete(fsmErr error) error {
+	if fsmErr != nil {
+		return trace.Wrap(fsmErr)
+	}
+	_, err := e.site.service.GetSite(e.site.key)
+	if trace.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.BadParameter("cluster %v has not been deregistered", e.site.key.SiteDomain)
+}
+
+// updateProgress reports the progress of the operation before
+// each phase is executed
+func (e *uninstallEngine) updateProgress(ctx context.Context, params fsm.Params) error {
+	plan, err := e.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	phase, err := fsm.FindPhase(plan, params.PhaseID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	step := phase.Step
+	if isUninstallNodePhase(phase.ID) {
+		parent, err := fsm.FindPhase(plan, uninstallSystemPhase)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		step = parent.Step
+	}
+	e.site.reportProgress(e.ctx, ops.ProgressEntry{
+		State:      ops.ProgressStateInProgress,
+		Completion: 100 / utils.Max(len(plan.Phases), 1) * (step - 1),
+		Step:       step,
+		Message:    phase.Description,
+	})
+	return nil
+}
+
+// tolerate returns nil if the operation is forced and err otherwise
+func (e *uninstallEngine) tolerate(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	if !e.force {
+		return trace.Wrap(err, message)
+	}
+	e.ctx.Warningf("%v, force continue: %v.", message, trace.DebugReport(err))
+	return nil
+}
+
+func (e *uninstallEngine) runPreUninstallHook() error {
+	return e.tolerate(e.site.runHook(e.ctx, schema.HookUninstalling),
+		"failed to run pre-uninstall hook")
+}
+
+func (e *uninstallEngine) uninstallApp() error {
+	return e.tolerate(e.site.uninstallUserApp(e.ctx), "failed to uninstall user app")
+}
+
+func (e *uninstallEngine) deprovision() error {
+	return trace.Wrap(e.site.runClusterDeprovisionHook(e.ctx))
+}
+
+// uninstallNode launches the uninstall agent on the specified node and
+// uninstalls the system software.
+//
+// Unreachable nodes fail the phase unless the operation is forced or
+// the phase is explicitly skipped
+func (e *uninstallEngine) uninstallNode(server storage.Server) error {
+	if e.skip {
+		e.ctx.RecordInfo("skipped uninstalling node %v", server.Hostname)
+		return nil
+	}
+	_, err := e.site.getTeleportServerNoRetry(ops.Hostname, server.Hostname)
+	if err != nil {
+		return e.tolerate(trace.ConnectionProblem(err,
+			"node %v is unreachable, skip the phase to continue without it",
+			server.Hostname), "failed to uninstall the node")
+	}
+	e.ctx.serversToRemove = []storage.Server{server}
+	defer func() {
+		err := e.site.agentService().StopAgents(context.TODO(), e.ctx.key())
+		if err != nil {
+			e.ctx.Warningf("Failed to stop uninstall agent: %v.", trace.DebugReport(err))
+		}
+	}()
+	runner, err := e.site.launchAgent(e.ctx, server)
+	if err != nil {
+		return e.tolerate(err, "failed to launch agent on the node")
+	}
+	if err := e.site.uninstallSystem(e.ctx, runner); err != nil {
+		return e.tolerate(err, "failed to uninstall the node")
+	}
+	e.ctx.RecordInfo("node %v has been uninstalled", server.Hostname)
+	return nil
+}
+
+func (e *uninstallEngine) deregister() error {
+	e.site.reportProgress(e.ctx, ops.ProgressEntry{
+		State:      ops.ProgressStateCompleted,
+		Completion: constants.Completed,
+		Message:    "uninstall completed",
+	})
+	return trace.Wrap(e.site.deleteSite())
+}
+
+// uninstallExecutor executes a single phase of the uninstall operation
+type uninstallExecutor struct {
+	// FieldLogger is used for logging
+	log.FieldLogger
+	// execute implements the phase
+	execute func() error
+}
+
+// PreCheck is no-op for uninstall phases
+func (p *uninstallExecutor) PreCheck(ctx context.Context) error {
+	return nil
+}
+
+// PostCheck is no-op for uninstall phases
+func (p *uninstallExecutor) PostCheck(ctx context.Context) error {
+	return nil
+}
+
+// Execute executes the phase
+func (p *uninstallExecutor) Execute(ctx context.Context) error {
+	return trace.Wrap(p.execute())
+}
+
+// Rollback is no-op for uninstall phases: the application and the nodes
+// cannot be restored once removed, so the failed phase is retried instead
+func (p *uninstallExecutor) Rollback(ctx context.Context) error {
+	p.Warn("Phase cannot be rolled back.")
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+const (
+	// uninstallPreHookPhase runs the application's pre-uninstall hook
+	uninstallPreHookPhase = "/pre-hook"
+	// uninstallAppPhase runs the uninstall hooks of the application
+	// and its dependencies
+	uninstallAppPhase = "/app"
+	// uninstallDeprovisionPhase deprovisions the cluster with the cloud provider
+	uninstallDeprovisionPhase = "/deprovision"
+	// uninstallSystemPhase uninstalls the system software from the nodes,
+	// one subphase per node
+	uninstallSystemPhase = "/system"
+	// uninstallDeregisterPhase removes the cluster from the Ops Center
+	uninstallDeregisterPhase = "/deregister"
+)
+
+// newUninstallOperationPlan returns the plan for the uninstall operation
+func (s *site) newUninstallOperationPlan(operation ops.SiteOperation) (*storage.OperationPlan, error) {
+	if operation.Uninstall == nil {
+		return nil, trace.BadParameter("%v is not an uninstall operation", operation)
+	}
+	cluster, err := s.service.GetSite(s.key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	manifest := s.app.Manifest
+	var phases []storage.OperationPhase
+	addPhase := func(phase storage.OperationPhase) {
+		phase.Step = len(phases) + 1
+		if len(phases) != 0 {
+			phase.Requires = []string{phases[len(phases)-1].ID}
+		}
+		phases = append(phases, phase)
+	}
+	if manifest.HasHook(schema.HookUninstalling) {
+		addPhase(storage.OperationPhase{
+			ID:          uninstallPreHookPhase,
+			Description: "Run pre-uninstall hook",
+		})
+	}
+	addPhase(storage.OperationPhase{
+		ID:          uninstallAppPhase,
+		Description: fmt.Sprintf("Uninstall application %v", s.app.Package),
+	})
+	if isAWSProvisioner(operation.Provisioner) {
+		if !manifest.HasHook(schema.HookClusterDeprovision) {
+			return nil, trace.BadParameter("%v hook is not defined",
+				schema.HookClusterDeprovision)
+		}
+		addPhase(storage.OperationPhase{
+			ID:          uninstallDeprovisionPhase,
+			Description: "Deprovision cluster nodes",
+		})
+	} else if len(cluster.ClusterState.Servers) != 0 {
+		addPhase(newUninstallSystemPhase(cluster.ClusterState.Servers))
+	}
+	addPhase(storage.OperationPhase{
+		ID:          uninstallDeregisterPhase,
+		Description: "Deregister the cluster",
+	})
+	return &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Phases:        phases,
+		Servers:       cluster.ClusterState.Servers,
+		CreatedAt:     s.clock().UtcNow(),
+	}, nil
+}
+
+// newUninstallSystemPhase returns the phase that uninstalls the system
+// software from the specified servers.
+//
+// Masters are uninstalled last since the other nodes are reached
+// through the cluster controller running on masters
+func newUninstallSystemPhase(servers []storage.Server) storage.OperationPhase {
+	servers = append([]storage.Server(nil), servers...)
+	sort.SliceStable(servers, func(i, j int) bool {
+		return !servers[i].IsMaster() && servers[j].IsMaster()
+	})
+	phase := storage.OperationPhase{
+		ID:          uninstallSystemPhase,
+		Description: "Uninstall system software from the cluster nodes",
+	}
+	for _, server := range servers {
+		phase.Phases = append(phase.Phases, storage.OperationPhase{
+			ID:          path.Join(uninstallSystemPhase, server.Hostname),
+			Description: fmt.Sprintf("Uninstall system software from node %v", server.Hostname),
+		})
+	}
+	return phase
+}
+
+// isUninstallNodePhase returns true if the specified phase uninstalls
+// the system software from a single node
+func isUninstallNodePhase(phaseID string) bool {
+	return path.Dir(phaseID) == uninstallSystemPhase
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"context"
+
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/suite"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/check.v1"
+)
+
+type UninstallPlanSuite struct {
+	operator *Operator
+	cluster  *ops.Site
+}
+
+var _ = check.Suite(&UninstallPlanSuite{})
+
+func (s *UninstallPlanSuite) SetUpTest(c *check.C) {
+	services := SetupTestServices(c)
+	s.operator = services.Operator
+
+	suite := &suite.OpsSuite{}
+	app, err := suite.SetUpTestPackage(services.Apps, services.Packages, c)
+	c.Assert(err, check.IsNil)
+
+	account, err := s.operator.CreateAccount(ops.NewAccountRequest{
+		Org: "uninstallplan.test",
+	})
+	c.Assert(err, check.IsNil)
+
+	s.cluster, err = s.operator.CreateSite(ops.NewSiteRequest{
+		AccountID:  account.ID,
+		AppPackage: app.String(),
+		Provider:   schema.ProvisionerOnPrem,
+		DomainName: "uninstallplan.test",
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *UninstallPlanSuite) TestPlanWithoutNodes(c *check.C) {
+	site, err := s.operator.openSite(s.cluster.Key())
+	c.Assert(err, check.IsNil)
+	plan, err := site.newUninstallOperationPlan(ops.SiteOperation{
+		ID:          "op-1",
+		AccountID:   s.cluster.AccountID,
+		SiteDomain:  s.cluster.Domain,
+		Type:        ops.OperationUninstall,
+		Provisioner: schema.ProvisionerOnPrem,
+		Uninstall:   &storage.UninstallOperationState{},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(phaseIDs(plan), check.DeepEquals, []string{
+		uninstallAppPhase,
+		uninstallDeregisterPhase,
+	})
+	c.Assert(plan.Phases[1].Requires, check.DeepEquals, []string{uninstallAppPhase})
+}
+
+func (s *UninstallPlanSuite) TestUninstallsMastersLast(c *check.C) {
+	phase := newUninstallSystemPhase([]storage.Server{
+		{Hostname: "node-1", ClusterRole: string(schema.ServiceRoleMaster)},
+		{Hostname: "node-2", ClusterRole: string(schema.ServiceRoleNode)},
+		{Hostname: "node-3", ClusterRole: string(schema.ServiceRoleNode)},
+	})
+	var ids []string
+	for _, subphase := range phase.Phases {
+		ids = append(ids, subphase.ID)
+		c.Assert(isUninstallNodePhase(subphase.ID), check.Equals, true)
+	}
+	c.Assert(ids, check.DeepEquals, []string{
+		"/system/node-2",
+		"/system/node-3",
+		"/system/node-1",
+	})
+	c.Assert(isUninstallNodePhase(uninstallSystemPhase), check.Equals, false)
+	c.Assert(isUninstallNodePhase(uninstallAppPhase), check.Equals, false)
+}
+
+func (s *UninstallPlanSuite) TestPhasesRollbackIsNoop(c *check.C) {
+	executor := &uninstallExecutor{
+		FieldLogger: logrus.WithField(trace.Component, "uninstall"),
+		execute: func() error {
+			return trace.BadParameter("should not be executed")
+		},
+	}
+	c.Assert(executor.Rollback(context.TODO()), check.IsNil)
+}
@@ -19,6 +19,7 @@ package opsservice
 import (
 	"path/filepath"
 
+	"github.com/gravitational/gravity/lib/app"
 	"github.com/gravitational/gravity/lib/checks"
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/loc"
@@ -53,12 +54,20 @@ func (o *Operator) RotateSecrets(req ops.RotateSecretsRequest) (*ops.RotatePacka
 		return nil, trace.Wrap(err)
 	}
 
-	ctx, err := cluster.newOperationContext(*op)
+	operation := op
+	if req.OperationID != "" {
+		operation, err = o.GetSiteOperation(req.SiteOperationKey())
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
+	ctx, err := cluster.newOperationContext(*operation)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	resp, err := cluster.rotateSecrets(ctx, node, *op)
+	resp, err := cluster.rotateSecrets(ctx, node, reconfiguredInstallOperation(*op, *operation))
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -114,12 +123,7 @@ func (o *Operator) RotateTeleportConfig(req ops.RotateConfigPackageRequest) (mas
 }
 
 func (o *Operator) getNodeProfile(operation ops.SiteOperation, node storage.Server) (*schema.NodeProfile, error) {
-	updatePackage, err := operation.Update.Package()
-	if err != nil {
-		return nil, trace.Wrap(err)
-	}
-
-	updateApp, err := o.cfg.Apps.GetApp(*updatePackage)
+	updateApp, err := o.getOperationApp(operation)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -134,19 +138,42 @@ func (o *Operator) getNodeProfile(operation ops.SiteOperation, node storage.Serv
 	return nodeProfile, nil
 }
 
-// RotatePlanetConfig rotates planet configuration package for the server specified in the request
-func (o *Operator) RotatePlanetConfig(req ops.RotateConfigPackageRequest) (*ops.RotatePackageResponse, error) {
-	operation, err := o.GetSiteOperation(req.SiteOperationKey())
+// getOperationApp returns the application the configuration packages are
+// generated for during the specified operation: the update application for
+// the update operation and the installed application otherwise
+func (o *Operator) getOperationApp(operation ops.SiteOperation) (*app.Application, error) {
+	if operation.Type != ops.OperationUpdate {
+		cluster, err := o.GetSite(operation.ClusterKey())
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		application, err := o.cfg.Apps.GetApp(cluster.App.Package)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return application, nil
+	}
+
+	updatePackage, err := operation.Update.Package()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	updatePackage, err := operation.Update.Package()
+	application, err := o.cfg.Apps.GetApp(*updatePackage)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
+	return application, nil
+}
 
-	updateApp, err := o.cfg.Apps.GetApp(*updatePackage)
+// RotatePlanetConfig rotates planet configuration package for the server specified in the request
+func (o *Operator) RotatePlanetConfig(req ops.RotateConfigPackageRequest) (*ops.RotatePackageResponse, error) {
+	operation, err := o.GetSiteOperation(req.SiteOperationKey())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	updateApp, err := o.getOperationApp(*operation)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -221,7 +248,7 @@ func (o *Operator) RotatePlanetConfig(req ops.RotateConfigPackageRequest) (*ops.
 
 	ctx.update = updateContext{
 		masterIP:  master.AdvertiseIP,
-		installOp: *installOperation,
+		installOp: reconfiguredInstallOperation(*installOperation, *operation),
 		app:       *updateApp,
 		gravityPath: filepath.Join(
 			state.GravityUpdateDir(node.StateDir()), constants.GravityBin),
@@ -309,6 +336,8 @@ func (s *site) createUpdateOperation(req ops.CreateSiteAppUpdateOperationRequest
 		Provisioner: installOperation.Provisioner,
 		Update: &storage.UpdateOperationState{
 			UpdatePackage: req.App,
+			Strategy:      req.Strategy,
+			AutoRollback:  req.AutoRollback,
 		},
 	}
 
@@ -352,6 +381,11 @@ func (s *site) validateUpdateOperationRequest(req ops.CreateSiteAppUpdateOperati
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	if req.Strategy != nil {
+		if err := req.Strategy.Check(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
 	err = pack.CheckUpdatePackage(*currentPackage, *updatePackage)
 	if err != nil {
 		return trace.Wrap(err)
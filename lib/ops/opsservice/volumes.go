@@ -0,0 +1,162 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/devicemapper"
+	"github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CreatePersistentVolumes creates local persistent volumes for the filesystems provisioned on a node
+func (o *Operator) CreatePersistentVolumes(req ops.CreatePersistentVolumesRequest) error {
+	err := req.Check()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	cluster, err := o.openSite(req.SiteKey())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	volumes, err := GetPersistentVolumes(cluster.app.Manifest, req.Server)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	client, err := o.GetKubeClient()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(kubernetes.CreateLocalPersistentVolumes(client, volumes))
+}
+
+// GetPersistentVolumes returns local persistent volumes for the filesystems
+// provisioned on the server that the server profile exposes as persistent volumes
+func GetPersistentVolumes(m schema.Manifest, server storage.Server) ([]v1.PersistentVolume, error) {
+	profile, err := m.NodeProfiles.ByName(server.Role)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var volumes []v1.PersistentVolume
+	for _, device := range profile.Requirements.BlockDevices {
+		if device.Filesystem == nil || device.Filesystem.PersistentVolume == nil {
+			continue
+		}
+		assigned := findBlockDevice(server.BlockDevices, device.Name)
+		if assigned == nil {
+			return nil, trace.NotFound("no device has been assigned to block device %q on %v",
+				device.Name, server.Hostname)
+		}
+		volumes = append(volumes, newLocalPersistentVolume(server, device.Name,
+			*device.Filesystem, assigned.Device.SizeMB<<20))
+	}
+	for _, group := range profile.Requirements.VolumeGroups {
+		for _, volume := range group.LogicalVolumes {
+			if volume.Filesystem.PersistentVolume == nil {
+				continue
+			}
+			volumes = append(volumes, newLocalPersistentVolume(server,
+				fmt.Sprintf("%v-%v", group.Name, volume.Name),
+				volume.Filesystem, volume.Size.Bytes()))
+		}
+	}
+	return volumes, nil
+}
+
+// AssignBlockDevices assigns host devices to the block devices of the server
+// profile unless they have already been assigned.
+// The Docker and system state devices of the server are never assigned
+func AssignBlockDevices(m schema.Manifest, server *storage.Server, available storage.Devices) error {
+	if len(server.BlockDevices) != 0 {
+		return nil
+	}
+	profile, err := m.NodeProfiles.ByName(server.Role)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !profile.Requirements.HasBlockDevices() {
+		return nil
+	}
+	devices, err := devicemapper.AssignDevices(profile.Requirements.BlockDevices, available,
+		server.Docker.Device.Name, server.SystemState.Device.Name)
+	if err != nil {
+		return trace.Wrap(err, "server %v", server.Hostname)
+	}
+	server.BlockDevices = devices
+	return nil
+}
+
+func newLocalPersistentVolume(server storage.Server, name string, filesystem schema.Filesystem, sizeBytes uint64) v1.PersistentVolume {
+	storageClass := filesystem.PersistentVolume.StorageClass
+	if storageClass == "" {
+		storageClass = defaults.LocalStorageClass
+	}
+	return v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: strings.ToLower(fmt.Sprintf("%v-%v", server.Hostname, name)),
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: *resource.NewQuantity(int64(sizeBytes), resource.BinarySI),
+			},
+			AccessModes:                   []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
+			StorageClassName:              storageClass,
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				Local: &v1.LocalVolumeSource{Path: filesystem.Path},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      defaults.KubernetesHostnameLabel,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{server.KubeNodeID()},
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func findBlockDevice(devices []storage.BlockDevice, name string) *storage.BlockDevice {
+	for i, device := range devices {
+		if device.Name == name {
+			return &devices[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opsservice
+
+import (
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+)
+
+type VolumesSuite struct {
+	manifest schema.Manifest
+}
+
+var _ = check.Suite(&VolumesSuite{})
+
+func (s *VolumesSuite) SetUpTest(c *check.C) {
+	s.manifest = schema.Manifest{
+		NodeProfiles: schema.NodeProfiles{
+			{
+				Name: "db",
+				Requirements: schema.Requirements{
+					BlockDevices: []schema.BlockDevice{
+						{
+							Name:     "data",
+							Capacity: 10 * utils.Capacity(1<<30),
+							Filesystem: &schema.Filesystem{
+								Path:             "/var/lib/data",
+								PersistentVolume: &schema.PersistentVolume{StorageClass: "fast"},
+							},
+						},
+						{
+							Name:     "scratch",
+							Capacity: 10 * utils.Capacity(1<<30),
+							Filesystem: &schema.Filesystem{
+								Path: "/var/lib/scratch",
+							},
+						},
+						{
+							Name:        "pool",
+							Capacity:    50 * utils.Capacity(1<<30),
+							VolumeGroup: "vg0",
+						},
+					},
+					VolumeGroups: []schema.VolumeGroup{
+						{
+							Name: "vg0",
+							LogicalVolumes: []schema.LogicalVolume{
+								{
+									Name: "logs",
+									Size: 20 * utils.Capacity(1<<30),
+									Filesystem: schema.Filesystem{
+										Path:             "/var/log/app",
+										PersistentVolume: &schema.PersistentVolume{},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name: "worker",
+			},
+		},
+	}
+}
+
+func (s *VolumesSuite) TestAssignsBlockDevices(c *check.C) {
+	server := storage.Server{
+		Role:   "db",
+		Docker: storage.Docker{Device: storage.Device{Name: "/dev/xvdb"}},
+	}
+	available := storage.Devices{
+		{Name: "/dev/xvdb", Type: storage.DeviceDisk, SizeMB: 100 * 1024},
+		{Name: "/dev/xvdc", Type: storage.DeviceDisk, SizeMB: 100 * 1024},
+		{Name: "/dev/xvdd", Type: storage.DeviceDisk, SizeMB: 20 * 1024},
+		{Name: "/dev/xvde", Type: storage.DeviceDisk, SizeMB: 20 * 1024},
+	}
+
+	err := AssignBlockDevices(s.manifest, &server, available)
+	c.Assert(err, check.IsNil)
+	c.Assert(server.BlockDevices, check.DeepEquals, []storage.BlockDevice{
+		{Name: "data", Device: available[2]},
+		{Name: "scratch", Device: available[3]},
+		{Name: "pool", Device: available[1]},
+	})
+
+	// profiles without block devices are left intact
+	server = storage.Server{Role: "worker"}
+	err = AssignBlockDevices(s.manifest, &server, available)
+	c.Assert(err, check.IsNil)
+	c.Assert(server.BlockDevices, check.IsNil)
+}
+
+func (s *VolumesSuite) TestFailsToAssignMissingDevices(c *check.C) {
+	server := storage.Server{Role: "db", Hostname: "node-1"}
+	available := storage.Devices{
+		{Name: "/dev/xvdc", Type: storage.DeviceDisk, SizeMB: 20 * 1024},
+	}
+
+	err := AssignBlockDevices(s.manifest, &server, available)
+	c.Assert(trace.IsNotFound(err), check.Equals, true)
+	c.Assert(server.BlockDevices, check.IsNil)
+}
+
+func (s *VolumesSuite) TestGetsPersistentVolumes(c *check.C) {
+	server := storage.Server{
+		Role:     "db",
+		Hostname: "Node-1",
+		Nodename: "node-1",
+		BlockDevices: []storage.BlockDevice{
+			{Name: "data", Device: storage.Device{Name: "/dev/xvdd", SizeMB: 20 * 1024}},
+			{Name: "scratch", Device: storage.Device{Name: "/dev/xvde", SizeMB: 20 * 1024}},
+			{Name: "pool", Device: storage.Device{Name: "/dev/xvdc", SizeMB: 100 * 1024}},
+		},
+	}
+
+	volumes, err := GetPersistentVolumes(s.manifest, server)
+	c.Assert(err, check.IsNil)
+	c.Assert(volumes, check.HasLen, 2)
+
+	data := volumes[0]
+	c.Assert(data.Name, check.Equals, "node-1-data")
+	c.Assert(data.Spec.StorageClassName, check.Equals, "fast")
+	c.Assert(data.Spec.Local.Path, check.Equals, "/var/lib/data")
+	capacity := data.Spec.Capacity[v1.ResourceStorage]
+	c.Assert(capacity.Value(), check.Equals, int64(20<<30))
+	c.Assert(data.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values,
+		check.DeepEquals, []string{"node-1"})
+
+	logs := volumes[1]
+	c.Assert(logs.Name, check.Equals, "node-1-vg0-logs")
+	c.Assert(logs.Spec.StorageClassName, check.Equals, defaults.LocalStorageClass)
+	c.Assert(logs.Spec.Local.Path, check.Equals, "/var/log/app")
+	capacity = logs.Spec.Capacity[v1.ResourceStorage]
+	c.Assert(capacity.Value(), check.Equals, int64(20<<30))
+}
@@ -300,12 +300,15 @@ func (c *logForwardersCollection) Resources() (resources []teleservices.UnknownR
 // WriteText serializes collection in human-friendly text format
 func (c *logForwardersCollection) WriteText(w io.Writer) error {
 	t := goterm.NewTable(0, 10, 5, ' ', 0)
-	common.PrintTableHeader(t, []string{"Name", "Address", "Protocol"})
+	common.PrintTableHeader(t, []string{"Name", "Output", "Address", "Protocol", "Format", "TLS"})
 	for _, forwarder := range c.logForwarders {
-		fmt.Fprintf(t, "%v\t%v\t%v\n",
+		fmt.Fprintf(t, "%v\t%v\t%v\t%v\t%v\t%v\n",
 			forwarder.GetName(),
+			forwarder.GetOutput(),
 			forwarder.GetAddress(),
-			forwarder.GetProtocol())
+			formatProtocol(forwarder.GetProtocol()),
+			forwarder.GetFormat(),
+			forwarder.GetTLS() != nil)
 	}
 	_, err := io.WriteString(w, t.String())
 	return trace.Wrap(err)
@@ -474,9 +477,10 @@ type alertCollection []storage.Alert
 // WriteText serializes collection in human-friendly text format
 func (r alertTargetCollection) WriteText(w io.Writer) error {
 	t := goterm.NewTable(0, 10, 5, ' ', 0)
-	common.PrintTableHeader(t, []string{"Email"})
+	common.PrintTableHeader(t, []string{"Name", "Type", "Destination"})
 	for _, target := range r {
-		fmt.Fprintf(t, "%v\n", target.GetEmail())
+		fmt.Fprintf(t, "%v\t%v\t%v\n", target.GetName(), target.GetType(),
+			alertTargetDestination(target))
 	}
 	_, err := io.WriteString(w, t.String())
 	return trace.Wrap(err)
@@ -512,3 +516,26 @@ func (c alertTargetCollection) Resources() (resources []teleservices.UnknownReso
 }
 
 type alertTargetCollection []storage.AlertTarget
+
+// alertTargetDestination returns the address alerts are delivered to
+func alertTargetDestination(target storage.AlertTarget) string {
+	switch target.GetType() {
+	case storage.AlertTargetWebhook:
+		return target.GetWebhook().URL
+	case storage.AlertTargetSlack:
+		return target.GetSlack().URL
+	case storage.AlertTargetPagerDuty:
+		return target.GetPagerDuty().URL
+	default:
+		return target.GetEmail()
+	}
+}
+
+// formatProtocol returns the log forwarder protocol or a placeholder for
+// outputs that do not use one
+func formatProtocol(protocol string) string {
+	if protocol == "" {
+		return "-"
+	}
+	return protocol
+}
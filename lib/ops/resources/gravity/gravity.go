@@ -409,13 +409,17 @@ func (r *Resources) Remove(req resources.RemoveRequest) error {
 		}
 		r.Printf("Alert %q has been deleted\n", req.Name)
 	case storage.KindAlertTarget, "alerttargets":
-		if err := r.Operator.DeleteAlertTarget(r.cluster.Key()); err != nil {
+		if err := r.Operator.DeleteAlertTarget(r.cluster.Key(), req.Name); err != nil {
 			if trace.IsNotFound(err) && req.Force {
 				return nil
 			}
 			return trace.Wrap(err)
 		}
-		r.Println("Alert target has been deleted")
+		if req.Name != "" {
+			r.Printf("Alert target %q has been deleted\n", req.Name)
+		} else {
+			r.Println("Alert target has been deleted")
+		}
 	default:
 		return trace.BadParameter("unsupported resource %q, supported are: %v",
 			req.Kind, modules.Get().SupportedResourcesToRemove())
@@ -17,6 +17,7 @@ limitations under the License.
 package ops
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -29,6 +30,7 @@ import (
 
 	licenseapi "github.com/gravitational/license"
 	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
 )
 
 // GetInstallOperation returns an install operation for the specified siteKey
@@ -149,6 +151,52 @@ func GetLastShrinkOperation(siteKey SiteKey, operator Operator) (*SiteOperation,
 	return lastOperation, nil
 }
 
+// GetLastReconfigureNetworkOperation returns the last network reconfiguration operation
+//
+// If there're no operations or the last operation is not of type 'reconfigure network',
+// returns NotFound error
+func GetLastReconfigureNetworkOperation(siteKey SiteKey, operator Operator) (*SiteOperation, error) {
+	lastOperation, _, err := GetLastOperation(siteKey, operator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if lastOperation.Type != OperationReconfigureNetwork {
+		return nil, trace.NotFound("the last operation is not network reconfiguration: %v", lastOperation)
+	}
+	return lastOperation, nil
+}
+
+// GetLastReconfigureNodeOperation returns the last node reconfiguration operation
+//
+// If there're no operations or the last operation is not of type 'reconfigure node',
+// returns NotFound error
+func GetLastReconfigureNodeOperation(siteKey SiteKey, operator Operator) (*SiteOperation, error) {
+	lastOperation, _, err := GetLastOperation(siteKey, operator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if lastOperation.Type != OperationReconfigureNode {
+		return nil, trace.NotFound("the last operation is not node reconfiguration: %v", lastOperation)
+	}
+	return lastOperation, nil
+}
+
+// GetLastReconfigureDockerOperation returns the last Docker storage driver
+// reconfiguration operation
+//
+// If there're no operations or the last operation is not of type 'reconfigure docker',
+// returns NotFound error
+func GetLastReconfigureDockerOperation(siteKey SiteKey, operator Operator) (*SiteOperation, error) {
+	lastOperation, _, err := GetLastOperation(siteKey, operator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if lastOperation.Type != OperationReconfigureDocker {
+		return nil, trace.NotFound("the last operation is not Docker reconfiguration: %v", lastOperation)
+	}
+	return lastOperation, nil
+}
+
 // GetOperationWithProgress returns the operation and its progress for the provided operation key
 func GetOperationWithProgress(opKey SiteOperationKey, operator Operator) (*SiteOperation, *ProgressEntry, error) {
 	operation, err := operator.GetSiteOperation(opKey)
@@ -284,6 +332,46 @@ func FailOperation(key SiteOperationKey, operator Operator, message string) erro
 	})
 }
 
+// CheckMaintenanceWindow returns an error if the specified operation has been
+// started by a schedule whose maintenance window is closed at the given time.
+// Operations that have not been started by a schedule are not restricted
+func CheckMaintenanceWindow(key SiteOperationKey, operator Operator, now time.Time) error {
+	schedules, err := operator.GetSchedules(key.SiteKey())
+	if err != nil {
+		if trace.IsNotFound(err) {
+			// the cluster controller does not support schedules
+			return nil
+		}
+		return trace.Wrap(err)
+	}
+	for _, schedule := range schedules {
+		if schedule.OperationID != key.OperationID {
+			continue
+		}
+		if !schedule.Window.IsOpen(now) {
+			return trace.LimitExceeded("maintenance window (%v) of schedule %v is closed, "+
+				"the operation will resume at %v", schedule.Window, schedule.ID,
+				schedule.Window.Next(now).Format(constants.HumanDateFormat))
+		}
+	}
+	return nil
+}
+
+// MaintenanceWindowGate returns a plan gate that pauses execution of the
+// specified operation when its maintenance window closes.
+// The window is not enforced if it cannot be checked, e.g. while the
+// cluster controller is unavailable
+func MaintenanceWindowGate(key SiteOperationKey, operator Operator) func(context.Context, storage.OperationPhase) error {
+	return func(ctx context.Context, phase storage.OperationPhase) error {
+		err := CheckMaintenanceWindow(key, operator, time.Now())
+		if err != nil && !trace.IsLimitExceeded(err) {
+			log.Warnf("Failed to check maintenance window: %v.", trace.DebugReport(err))
+			return nil
+		}
+		return trace.Wrap(err)
+	}
+}
+
 // VerifyLicense verifies the provided license
 func VerifyLicense(packages pack.PackageService, license string) error {
 	parsed, err := licenseapi.ParseLicense(license)
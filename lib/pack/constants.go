@@ -55,6 +55,12 @@ const (
 	PurposeMetadata = "metadata"
 	// PurposeRPCCredentials marks a package as a package with agent RPC credentials
 	PurposeRPCCredentials = "rpc-secrets"
+	// PurposeHelmChart marks a package as a Helm chart archive
+	PurposeHelmChart = "helm-chart"
+	// PurposeEtcdSnapshot marks a package as a snapshot of the cluster etcd data
+	PurposeEtcdSnapshot = "etcd-snapshot"
+	// PurposeClusterBackup marks a package as a cluster backup being restored
+	PurposeClusterBackup = "cluster-backup"
 )
 
 // RuntimePackageLabels identifies the runtime package
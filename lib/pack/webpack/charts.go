@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webpack
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/helm"
+	"github.com/gravitational/gravity/lib/pack"
+
+	"github.com/ghodss/yaml"
+	"github.com/gravitational/roundtrip"
+	"github.com/gravitational/trace"
+	"github.com/julienschmidt/httprouter"
+)
+
+/* getChartIndex returns the index of the chart repository
+
+   GET /charts/:repository/index.yaml
+*/
+func (s *Server) getChartIndex(w http.ResponseWriter, r *http.Request, p httprouter.Params, service pack.PackageService) error {
+	index, err := helm.GenerateIndexFile(service, p.ByName("repository"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	_, err = w.Write(data)
+	return trace.Wrap(err)
+}
+
+/* getChart returns the chart archive
+
+   GET /charts/:repository/charts/:filename
+*/
+func (s *Server) getChart(w http.ResponseWriter, r *http.Request, p httprouter.Params, service pack.PackageService) error {
+	locator, err := helm.ChartLocator(p.ByName("repository"), p.ByName("filename"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	reader, err := helm.FetchChart(service, *locator)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	readSeeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		return trace.BadParameter("expected read seeker object")
+	}
+	filename := p.ByName("filename")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename=%v`, filename))
+	http.ServeContent(w, r, filename, time.Now(), readSeeker)
+	return nil
+}
+
+/* uploadChart stores the chart archive in the repository. The archive is
+   either the request body or the multipart form file named "chart", which
+   is compatible with the helm push plugin.
+
+   POST /charts/:repository/api/charts?force=true
+*/
+func (s *Server) uploadChart(w http.ResponseWriter, r *http.Request, p httprouter.Params, service pack.PackageService) error {
+	var upsert bool
+	if force := r.URL.Query().Get("force"); force != "" {
+		var err error
+		upsert, err = strconv.ParseBool(force)
+		if err != nil {
+			return trace.BadParameter("force should be either 'true' or 'false', got %v", force)
+		}
+	}
+	reader := io.Reader(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("chart")
+		if err != nil {
+			return trace.BadParameter("missing chart file: %v", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	version, err := helm.PushChart(service, p.ByName("repository"), reader, upsert)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	roundtrip.ReplyJSON(w, http.StatusCreated, map[string]interface{}{
+		"saved":   true,
+		"name":    version.Name,
+		"version": version.Version,
+	})
+	return nil
+}
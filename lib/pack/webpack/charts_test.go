@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gravitational/gravity/lib/helm"
+	"github.com/gravitational/gravity/lib/loc"
+
+	"github.com/ghodss/yaml"
+	. "gopkg.in/check.v1"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func (s *WebpackSuite) TestChartRepository(c *C) {
+	for _, version := range []string{"1.0.0", "1.2.0-beta.1", "1.1.0"} {
+		resp := s.chartRequest(c, "POST", "/charts/charts/api/charts", s.createChart(c, "my-chart", version))
+		c.Assert(resp.StatusCode, Equals, http.StatusCreated)
+	}
+
+	// uploading an existing version requires force
+	resp := s.chartRequest(c, "POST", "/charts/charts/api/charts", s.createChart(c, "my-chart", "1.0.0"))
+	c.Assert(resp.StatusCode, Equals, http.StatusConflict)
+	resp = s.chartRequest(c, "POST", "/charts/charts/api/charts?force=true", s.createChart(c, "my-chart", "1.0.0"))
+	c.Assert(resp.StatusCode, Equals, http.StatusCreated)
+
+	resp = s.chartRequest(c, "POST", "/charts/charts/api/charts", []byte("not a chart"))
+	c.Assert(resp.StatusCode, Equals, http.StatusBadRequest)
+
+	resp = s.chartRequest(c, "GET", "/charts/charts/index.yaml", nil)
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	var index helm.IndexFile
+	c.Assert(yaml.Unmarshal(data, &index), IsNil)
+	versions := index.Entries["my-chart"]
+	c.Assert(versions, HasLen, 3)
+	c.Assert(versions[0].Version, Equals, "1.2.0-beta.1")
+	c.Assert(versions[1].Version, Equals, "1.1.0")
+	c.Assert(versions[2].Version, Equals, "1.0.0")
+	c.Assert(versions[2].URLs, DeepEquals, []string{"charts/my-chart-1.0.0.tgz"})
+	c.Assert(versions[2].Digest, Not(Equals), "")
+
+	resp = s.chartRequest(c, "GET", "/charts/charts/charts/my-chart-1.2.0-beta.1.tgz", nil)
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	ch, err := chartutil.LoadArchive(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(ch.Metadata.Version, Equals, "1.2.0-beta.1")
+
+	resp = s.chartRequest(c, "GET", "/charts/charts/charts/my-chart-2.0.0.tgz", nil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (s *WebpackSuite) TestRejectsChartsOutsideChartRepository(c *C) {
+	resp := s.chartRequest(c, "POST", "/charts/gravitational.io/api/charts?force=true", s.createChart(c, "gravity", "1.0.0"))
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	// packages other than charts cannot be overwritten
+	c.Assert(s.packages.UpsertRepository(helm.ChartRepository, time.Time{}), IsNil)
+	_, err := s.packages.CreatePackage(loc.MustParseLocator("charts/plain:1.0.0"), bytes.NewBufferString("data"))
+	c.Assert(err, IsNil)
+	resp = s.chartRequest(c, "POST", "/charts/charts/api/charts?force=true", s.createChart(c, "plain", "1.0.0"))
+	c.Assert(resp.StatusCode, Equals, http.StatusConflict)
+}
+
+func (s *WebpackSuite) TestUploadsChartAsMultipartForm(c *C) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("chart", "my-chart-0.1.0.tgz")
+	c.Assert(err, IsNil)
+	_, err = part.Write(s.createChart(c, "my-chart", "0.1.0"))
+	c.Assert(err, IsNil)
+	c.Assert(writer.Close(), IsNil)
+
+	req, err := http.NewRequest("POST", s.webServer.URL+"/charts/charts/api/charts", &body)
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.SetBasicAuth(s.adminUser.GetName(), "admin-password")
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusCreated)
+
+	envelope, err := s.suite.S.ReadPackageEnvelope(mustChartLocator(c, "my-chart-0.1.0.tgz"))
+	c.Assert(err, IsNil)
+	c.Assert(envelope.RuntimeLabels, DeepEquals, map[string]string{"purpose": "helm-chart"})
+}
+
+func (s *WebpackSuite) TestParsesChartLocator(c *C) {
+	locator := mustChartLocator(c, "my-chart-1.0.0-rc.1.tgz")
+	c.Assert(locator.Name, Equals, "my-chart")
+	c.Assert(locator.Version, Equals, "1.0.0-rc.1")
+
+	_, err := helm.ChartLocator("charts", "my-chart.tgz")
+	c.Assert(err, NotNil)
+	_, err = helm.ChartLocator("charts", "my-chart-1.0.0.tar")
+	c.Assert(err, NotNil)
+}
+
+func (s *WebpackSuite) chartRequest(c *C, method, path string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, s.webServer.URL+path, bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	req.SetBasicAuth(s.adminUser.GetName(), "admin-password")
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp
+}
+
+func (s *WebpackSuite) createChart(c *C, name, version string) []byte {
+	path, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{
+			Name:       name,
+			Version:    version,
+			ApiVersion: chartutil.ApiVersionV1,
+		},
+	}, c.MkDir())
+	c.Assert(err, IsNil)
+	defer os.Remove(path)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	return data
+}
+
+func mustChartLocator(c *C, filename string) loc.Locator {
+	locator, err := helm.ChartLocator("charts", filename)
+	c.Assert(err, IsNil)
+	return *locator
+}
@@ -74,6 +74,12 @@ func NewHandler(cfg Config) (*Server, error) {
 	h.POST("/pack/v1/repositories/:repository/packages/:package_name/:package_version", h.needsAuth(h.updatePackageLabels))
 	h.DELETE("/pack/v1/repositories/:repository/packages/:package_name/:package_version", h.needsAuth(h.deletePackage))
 
+	// Helm chart repository API
+	h.GET("/charts/:repository/index.yaml", h.needsAuth(h.getChartIndex))
+	h.GET("/charts/:repository/charts/:filename", h.needsAuth(h.getChart))
+	h.HEAD("/charts/:repository/charts/:filename", h.needsAuth(h.getChart))
+	h.POST("/charts/:repository/api/charts", h.needsAuth(h.uploadChart))
+
 	return h, nil
 }
 
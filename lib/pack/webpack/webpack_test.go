@@ -30,6 +30,7 @@ import (
 	"github.com/gravitational/gravity/lib/blob/fs"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
 	"github.com/gravitational/gravity/lib/pack/localpack"
 	"github.com/gravitational/gravity/lib/pack/suite"
 	"github.com/gravitational/gravity/lib/storage"
@@ -51,6 +52,7 @@ type WebpackSuite struct {
 	server    *Server
 	backend   storage.Backend
 	suite     suite.PackageSuite
+	packages  pack.PackageService
 	webServer *httptest.Server
 	users     users.Identity
 	clock     *timetools.FreezedTime
@@ -105,6 +107,7 @@ func (s *WebpackSuite) SetUpTest(c *C) {
 		Objects:     objects,
 	})
 	c.Assert(err, IsNil)
+	s.packages = service
 	webHandler, err := NewHandler(Config{
 		Users:    s.users,
 		Packages: service,
@@ -112,6 +115,7 @@ func (s *WebpackSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 	mux := http.NewServeMux()
 	mux.Handle("/pack/", webHandler)
+	mux.Handle("/charts/", webHandler)
 	s.webServer = httptest.NewServer(mux)
 
 	// for regular test, let's be admins, so tests
@@ -43,7 +43,9 @@ import (
 	"github.com/gravitational/gravity/lib/clients"
 	cloudaws "github.com/gravitational/gravity/lib/cloudprovider/aws"
 	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/crd"
 	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/etcd"
 	"github.com/gravitational/gravity/lib/httplib"
 	"github.com/gravitational/gravity/lib/loc"
 	"github.com/gravitational/gravity/lib/modules"
@@ -60,6 +62,7 @@ import (
 	"github.com/gravitational/gravity/lib/rpc"
 	pb "github.com/gravitational/gravity/lib/rpc/proto"
 	rpcserver "github.com/gravitational/gravity/lib/rpc/server"
+	"github.com/gravitational/gravity/lib/schedule"
 	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/gravity/lib/storage/keyval"
 	"github.com/gravitational/gravity/lib/users"
@@ -87,8 +90,11 @@ import (
 	"github.com/gravitational/trace"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 type Process struct {
@@ -600,6 +606,129 @@ func (p *Process) startSiteStatusChecker(ctx context.Context) error {
 	}
 }
 
+// startCustomResourceController registers gravity custom resource
+// definitions and reconciles custom resources until the context is canceled
+func (p *Process) startCustomResourceController(ctx context.Context) error {
+	runner, ok := p.operator.(crd.Runner)
+	if !ok {
+		return trace.BadParameter("operator %T does not support custom resources", p.operator)
+	}
+	config, err := tryGetPrivilegedKubeConfig()
+	if err != nil {
+		p.Errorf("Failed to create Kubernetes client config: %v.", trace.DebugReport(err))
+		return trace.Wrap(err)
+	}
+	extensionsClient, err := apiextensionsclientset.NewForConfig(config)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = crd.EnsureDefinitions(extensionsClient)
+	if err != nil {
+		p.Errorf("Failed to create custom resource definitions: %v.", trace.DebugReport(err))
+		return trace.Wrap(err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	site, err := p.operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	controller, err := crd.New(crd.Config{
+		Client:      client,
+		Operator:    p.operator,
+		Runner:      runner,
+		Cluster:     site.Key(),
+		FieldLogger: p.WithField(trace.Component, "crd"),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(controller.Run(ctx))
+}
+
+// startScheduler starts operations scheduled in maintenance windows
+// until the context is canceled
+func (p *Process) startScheduler(ctx context.Context) error {
+	runner, ok := p.operator.(schedule.Runner)
+	if !ok {
+		return trace.BadParameter("operator %T does not support scheduled operations", p.operator)
+	}
+	site, err := p.operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	scheduler, err := schedule.New(schedule.Config{
+		Backend:     p.backend,
+		Operator:    p.operator,
+		Runner:      runner,
+		Cluster:     site.Key(),
+		FieldLogger: p.WithField(trace.Component, "scheduler"),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(scheduler.Run(ctx))
+}
+
+// startEtcdMaintainer takes etcd snapshots, defragments etcd members and
+// raises etcd alerts until the context is canceled
+func (p *Process) startEtcdMaintainer(ctx context.Context) error {
+	runner, ok := p.operator.(etcd.Runner)
+	if !ok {
+		return trace.BadParameter("operator %T does not support etcd maintenance", p.operator)
+	}
+	alerts, ok := p.operator.(etcd.Alerts)
+	if !ok {
+		return trace.BadParameter("operator %T does not support etcd alerts", p.operator)
+	}
+	site, err := p.operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	maintainer, err := etcd.NewMaintainer(etcd.MaintainerConfig{
+		Runner:      runner,
+		Notifier:    p.operator,
+		Alerts:      alerts,
+		Packages:    p.packages,
+		Cluster:     site.Key(),
+		FieldLogger: p.WithField(trace.Component, "etcd"),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(maintainer.Run(ctx))
+}
+
+// startAlertEndpoint configures kapacitor to post the alerts to the
+// cluster, retrying until it succeeds or the context is canceled
+func (p *Process) startAlertEndpoint(ctx context.Context) error {
+	configurer, ok := p.operator.(alertEndpointConfigurer)
+	if !ok {
+		return trace.BadParameter("operator %T does not support alert endpoint", p.operator)
+	}
+	site, err := p.operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = utils.RetryWithInterval(ctx, utils.NewUnlimitedExponentialBackOff(), func() error {
+		return configurer.ConfigureAlertEndpoint(site.Key())
+	})
+	if err != nil {
+		p.Warnf("Failed to configure alert endpoint: %v.", trace.DebugReport(err))
+		return trace.Wrap(err)
+	}
+	p.Info("Configured alert endpoint.")
+	return nil
+}
+
+// alertEndpointConfigurer configures kapacitor to post the alerts to the cluster
+type alertEndpointConfigurer interface {
+	// ConfigureAlertEndpoint configures the alert endpoint for the specified cluster
+	ConfigureAlertEndpoint(ops.SiteKey) error
+}
+
 // startElection starts leader election process and watches the changes
 func (p *Process) startElection() error {
 	// elect gravity site leader - all other sites will remain
@@ -780,7 +909,7 @@ func (p *Process) syncRegistry(site *ops.Site, leaderIP string) error {
 	p.Infof("Syncing registry.")
 	targetRegistry := constants.DockerRegistry
 	if leaderIP != "" {
-		targetRegistry = fmt.Sprintf("%s:%s", leaderIP, constants.DockerRegistryPort)
+		targetRegistry = defaults.DockerRegistryAddr(leaderIP)
 	}
 	start := time.Now()
 	// use the cert name of default registry, but connect via IP without relying on DNS
@@ -1085,14 +1214,16 @@ func (p *Process) initService(ctx context.Context) (err error) {
 		Backend: p.backend,
 	})
 
-	mon, err := monitoring.NewInfluxDB()
-	if err != nil {
-		return trace.Wrap(err)
-	}
-
 	var logs opsservice.LogForwardersControl
+	var deliveries monitoring.DeliveryStore
 	if p.inKubernetes() {
 		logs = opsservice.NewLogForwardersControl(client)
+		deliveries = monitoring.NewConfigMapDeliveryStore(client)
+	}
+
+	mon, err := monitoring.NewInfluxDB(deliveries)
+	if err != nil {
+		return trace.Wrap(err)
 	}
 
 	agentService := opsservice.NewAgentService(p.agentServer, peerStore,
@@ -1179,6 +1310,20 @@ func (p *Process) initService(ctx context.Context) (err error) {
 				"cluster requires backend with election capability")
 		}
 
+		// custom resource controller reconciles gravity resources
+		// managed with kubectl
+		p.RegisterClusterService(p.startCustomResourceController)
+
+		// scheduler starts operations in their maintenance windows
+		p.RegisterClusterService(p.startScheduler)
+
+		// etcd maintainer takes snapshots, defragments members and
+		// raises etcd alerts
+		p.RegisterClusterService(p.startEtcdMaintainer)
+
+		// alert endpoint configures kapacitor to post alerts to the cluster
+		p.RegisterClusterService(p.startAlertEndpoint)
+
 		p.Info("Running inside Kubernetes: starting leader election.")
 		// gravity site leader election
 		if err := p.startElection(); err != nil {
@@ -1351,6 +1496,20 @@ func (p *Process) ServeHealth() error {
 	return nil
 }
 
+func tryGetPrivilegedKubeConfig() (config *rest.Config, err error) {
+	_, err = utils.StatFile(constants.PrivilegedKubeconfig)
+	if err == nil || !trace.IsNotFound(err) {
+		_, config, err = utils.GetKubeClientFromPath(constants.PrivilegedKubeconfig)
+	} else {
+		_, config, err = utils.GetKubeClient("")
+	}
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return config, nil
+}
+
 func tryGetPrivilegedKubeClient() (client *kubernetes.Clientset, err error) {
 	_, err = utils.StatFile(constants.PrivilegedKubeconfig)
 	if err == nil || !trace.IsNotFound(err) {
@@ -1415,6 +1574,7 @@ func (p *Process) initMux(ctx context.Context) error {
 		mux.Handler(method, "/portalapi/v1/*portalapi", http.StripPrefix("/portalapi/v1", p.handlers.WebAPI))
 		mux.Handler(method, "/sites/*rest", p.handlers.Proxy)
 		mux.Handler(method, "/pack/*packages", p.handlers.Packages)
+		mux.Handler(method, "/charts/*charts", p.handlers.Packages)
 		mux.Handler(method, "/portal/*portal", p.handlers.Operator)
 		mux.Handler(method, "/t/*portal", p.handlers.Operator) // shortener for instructions tokens
 		mux.Handler(method, "/app/*apps", p.handlers.Apps)
@@ -0,0 +1,436 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsm
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/gravitational/gravity/lib/constants"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	libphase "github.com/gravitational/gravity/lib/reconfigure/internal/phases"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+// NewOperationPlan returns a new plan for the specified operation
+// and the given set of servers.
+//
+// The runtime is restarted on master nodes first and on regular nodes after
+// that, one node at a time, so the control plane is reconfigured before the nodes
+func NewOperationPlan(operation ops.SiteOperation, servers []storage.Server) (*storage.OperationPlan, error) {
+	masters, nodes := libfsm.SplitServers(servers)
+	if len(masters) == 0 {
+		return nil, trace.NotFound("no master servers found in cluster state")
+	}
+
+	if operation.ReconfigureNode != nil {
+		return newNodeOperationPlan(operation, servers)
+	}
+	if operation.ReconfigureDocker != nil {
+		return newDockerOperationPlan(operation, masters[0], servers)
+	}
+
+	builder := phaseBuilder{}
+
+	phases := phases{
+		*builder.validate(servers),
+		builder.configure(masters[0]),
+		*builder.restart(libphase.Masters, "Restart runtime on master nodes", masters),
+	}
+	if len(nodes) != 0 {
+		phases = append(phases,
+			*builder.restart(libphase.Nodes, "Restart runtime on regular nodes", nodes))
+	}
+	phases = append(phases,
+		builder.services(masters[0]),
+		builder.pods(masters[0]))
+
+	plan := &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Phases:        phases.asPhases(),
+		Servers:       servers,
+	}
+
+	return plan, nil
+}
+
+// newNodeOperationPlan returns a new plan for the operation that changes
+// the advertise address of a node.
+//
+// If the node is a master, the etcd peer address of the node is updated first
+// and the runtime is restarted on the remaining master nodes and regular nodes
+// after the node itself since their configuration references the masters
+func newNodeOperationPlan(operation ops.SiteOperation, servers []storage.Server) (*storage.OperationPlan, error) {
+	state := operation.ReconfigureNode
+	var server *storage.Server
+	var masters, nodes []storage.Server
+	for i := range servers {
+		switch {
+		case servers[i].AdvertiseIP == state.Server.AdvertiseIP:
+			server = &servers[i]
+		case servers[i].ClusterRole == string(schema.ServiceRoleMaster):
+			masters = append(masters, servers[i])
+		default:
+			nodes = append(nodes, servers[i])
+		}
+	}
+	if server == nil {
+		return nil, trace.NotFound("node %v not found in cluster state", state.Server.AdvertiseIP)
+	}
+	leader := *server
+	if len(masters) != 0 {
+		leader = masters[0]
+	}
+	isMaster := server.ClusterRole == string(schema.ServiceRoleMaster)
+
+	builder := phaseBuilder{}
+
+	phases := phases{builder.validateAddr(*server, state.AdvertiseAddr)}
+	if isMaster {
+		phases = append(phases, builder.etcd(*server))
+	}
+	phases = append(phases,
+		builder.configureNode(leader),
+		builder.restartNode(*server))
+	if isMaster && len(masters) != 0 {
+		phases = append(phases,
+			*builder.restart(libphase.Masters, "Restart runtime on master nodes", masters))
+	}
+	if isMaster && len(nodes) != 0 {
+		phases = append(phases,
+			*builder.restart(libphase.Nodes, "Restart runtime on regular nodes", nodes))
+	}
+	target := state.Target()
+	if state.Server.KubeNodeID() != target.KubeNodeID() {
+		phases = append(phases, builder.kubernetes(leader, *server))
+	}
+
+	plan := &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Phases:        phases.asPhases(),
+		Servers:       servers,
+	}
+
+	return plan, nil
+}
+
+// newDockerOperationPlan returns a new plan for the operation that migrates
+// a node to a different Docker storage driver.
+//
+// The node is drained and the images it has pulled from the cluster registry
+// are recorded before the runtime is restarted with the new storage driver.
+// The images are pulled again before the devicemapper pool is removed
+// and the node is made schedulable
+func newDockerOperationPlan(operation ops.SiteOperation, leader storage.Server, servers []storage.Server) (*storage.OperationPlan, error) {
+	state := operation.ReconfigureDocker
+	var server *storage.Server
+	for i := range servers {
+		if servers[i].AdvertiseIP == state.Server.AdvertiseIP {
+			server = &servers[i]
+		}
+	}
+	if server == nil {
+		return nil, trace.NotFound("node %v not found in cluster state", state.Server.AdvertiseIP)
+	}
+
+	builder := phaseBuilder{}
+
+	phases := phases{
+		builder.validateDocker(*server, state.StorageDriver),
+		builder.drain(leader, *server),
+		builder.configureDocker(leader),
+		builder.images(*server),
+		builder.restartDocker(*server, state.StorageDriver),
+		builder.reimport(*server),
+	}
+	if state.PrevStorageDriver == constants.DockerStorageDriverDevicemapper {
+		phases = append(phases, builder.devicemapper(*server))
+	}
+	phases = append(phases, builder.uncordon(leader, *server))
+
+	plan := &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Phases:        phases.asPhases(),
+		Servers:       servers,
+	}
+
+	return plan, nil
+}
+
+func (r phaseBuilder) validate(servers []storage.Server) *phase {
+	root := root(phase{
+		ID:          libphase.Validate,
+		Description: "Validate network settings",
+	})
+
+	for i, server := range servers {
+		node := r.node(server, root, "Validate network settings on node %q")
+		node.Data = &storage.OperationPhaseData{
+			Server: &servers[i],
+		}
+		root.AddParallel(node)
+	}
+	return &root
+}
+
+func (r phaseBuilder) configure(master storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Configure,
+		Description: "Generate runtime configuration packages",
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) restart(id, description string, servers []storage.Server) *phase {
+	root := root(phase{
+		ID:          id,
+		Description: description,
+	})
+
+	for i, server := range servers {
+		node := r.node(server, root, "Restart runtime on node %q")
+		node.Data = &storage.OperationPhaseData{
+			Server: &servers[i],
+		}
+		root.AddSequential(node)
+	}
+	return &root
+}
+
+func (r phaseBuilder) services(master storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Services,
+		Description: "Recreate services outside of the service subnet",
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) pods(master storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Pods,
+		Description: "Restart pods outside of the pod subnet",
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) validateAddr(server storage.Server, addr string) phase {
+	return root(phase{
+		ID:          libphase.Validate,
+		Description: fmt.Sprintf("Validate address %v on node %q", addr, server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) etcd(server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Etcd,
+		Description: fmt.Sprintf("Update etcd peer address of node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) configureNode(master storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Configure,
+		Description: "Generate secrets and runtime configuration packages",
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) restartNode(server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Node,
+		Description: fmt.Sprintf("Restart runtime on node %q with the new address", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) kubernetes(master, server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Kubernetes,
+		Description: fmt.Sprintf("Replace Kubernetes node object of node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) validateDocker(server storage.Server, storageDriver string) phase {
+	return root(phase{
+		ID:          libphase.Validate,
+		Description: fmt.Sprintf("Validate Docker storage driver %v on node %q", storageDriver, server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) drain(master, server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Drain,
+		Description: fmt.Sprintf("Drain node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) configureDocker(master storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Configure,
+		Description: "Generate runtime configuration package",
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) images(server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Images,
+		Description: fmt.Sprintf("Record images from the cluster registry on node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) restartDocker(server storage.Server, storageDriver string) phase {
+	return root(phase{
+		ID:          libphase.Node,
+		Description: fmt.Sprintf("Restart runtime on node %q with Docker storage driver %v", server.Hostname, storageDriver),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) reimport(server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Reimport,
+		Description: fmt.Sprintf("Pull images from the cluster registry on node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) devicemapper(server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Devicemapper,
+		Description: fmt.Sprintf("Remove devicemapper pool on node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &server,
+		},
+	})
+}
+
+func (r phaseBuilder) uncordon(master, server storage.Server) phase {
+	return root(phase{
+		ID:          libphase.Uncordon,
+		Description: fmt.Sprintf("Uncordon node %q", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server: &master,
+		},
+	})
+}
+
+func (r phaseBuilder) node(server storage.Server, parent phase, format string) phase {
+	return phase{
+		ID:          parent.ChildLiteral(server.Hostname),
+		Description: fmt.Sprintf(format, server.Hostname),
+	}
+}
+
+type phaseBuilder struct{}
+
+// AddSequential will append sub-phases which depend one upon another
+func (p *phase) AddSequential(sub ...phase) {
+	for i := range sub {
+		if len(p.Phases) > 0 {
+			sub[i].Require(phase(p.Phases[len(p.Phases)-1]))
+		}
+		p.Phases = append(p.Phases, storage.OperationPhase(sub[i]))
+	}
+}
+
+// AddParallel will append sub-phases which depend on parent only
+func (p *phase) AddParallel(sub ...phase) {
+	p.Phases = append(p.Phases, phases(sub).asPhases()...)
+}
+
+// Required adds the specified phases reqs as requirements for this phase
+func (p *phase) Require(reqs ...phase) *phase {
+	for _, req := range reqs {
+		p.Requires = append(p.Requires, req.ID)
+	}
+	return p
+}
+
+// ChildLiteral adds the specified sub phase ID as a child of this phase
+// and returns the resulting path
+func (p *phase) ChildLiteral(sub string) string {
+	if p == nil {
+		return path.Join("/", sub)
+	}
+	return path.Join(p.ID, sub)
+}
+
+// Root makes the specified phase root
+func root(sub phase) phase {
+	sub.ID = path.Join("/", sub.ID)
+	return sub
+}
+
+type phase storage.OperationPhase
+
+func (r phases) asPhases() (result []storage.OperationPhase) {
+	result = make([]storage.OperationPhase, 0, len(r))
+	for _, phase := range r {
+		result = append(result, storage.OperationPhase(phase))
+	}
+	return result
+}
+
+type phases []phase
@@ -0,0 +1,442 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsm
+
+import (
+	"testing"
+
+	"github.com/gravitational/gravity/lib/compare"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestFSM(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestSingleNodePlan(c *C) {
+	operation := ops.SiteOperation{
+		ID:         "1",
+		AccountID:  "0",
+		Type:       ops.OperationReconfigureNetwork,
+		SiteDomain: "cluster",
+	}
+	servers := []storage.Server{
+		{Hostname: "node-1", ClusterRole: string(schema.ServiceRoleMaster)},
+	}
+
+	plan, err := NewOperationPlan(operation, servers)
+	c.Assert(err, IsNil)
+	c.Assert(plan, compare.DeepEquals, &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Servers:       servers,
+		Phases: []storage.OperationPhase{
+			{
+				ID:          "/validate",
+				Description: "Validate network settings",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/validate/node-1",
+						Description: `Validate network settings on node "node-1"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[0],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/configure",
+				Description: "Generate runtime configuration packages",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/masters",
+				Description: "Restart runtime on master nodes",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/masters/node-1",
+						Description: `Restart runtime on node "node-1"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[0],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/services",
+				Description: "Recreate services outside of the service subnet",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/pods",
+				Description: "Restart pods outside of the pod subnet",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+		},
+	})
+}
+
+func (S) TestMultiNodePlan(c *C) {
+	operation := ops.SiteOperation{
+		ID:         "1",
+		AccountID:  "0",
+		Type:       ops.OperationReconfigureNetwork,
+		SiteDomain: "cluster",
+	}
+	servers := []storage.Server{
+		{Hostname: "node-1", ClusterRole: string(schema.ServiceRoleMaster)},
+		{Hostname: "node-2", ClusterRole: string(schema.ServiceRoleNode)},
+		{Hostname: "node-3", ClusterRole: string(schema.ServiceRoleMaster)},
+	}
+
+	plan, err := NewOperationPlan(operation, servers)
+	c.Assert(err, IsNil)
+	c.Assert(plan, compare.DeepEquals, &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Servers:       servers,
+		Phases: []storage.OperationPhase{
+			{
+				ID:          "/validate",
+				Description: "Validate network settings",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/validate/node-1",
+						Description: `Validate network settings on node "node-1"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[0],
+						},
+					},
+					{
+						ID:          "/validate/node-2",
+						Description: `Validate network settings on node "node-2"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[1],
+						},
+					},
+					{
+						ID:          "/validate/node-3",
+						Description: `Validate network settings on node "node-3"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[2],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/configure",
+				Description: "Generate runtime configuration packages",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/masters",
+				Description: "Restart runtime on master nodes",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/masters/node-1",
+						Description: `Restart runtime on node "node-1"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[0],
+						},
+					},
+					{
+						ID:          "/masters/node-3",
+						Description: `Restart runtime on node "node-3"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[2],
+						},
+						Requires: []string{"/masters/node-1"},
+					},
+				},
+			},
+			{
+				ID:          "/nodes",
+				Description: "Restart runtime on regular nodes",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/nodes/node-2",
+						Description: `Restart runtime on node "node-2"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[1],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/services",
+				Description: "Recreate services outside of the service subnet",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/pods",
+				Description: "Restart pods outside of the pod subnet",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+		},
+	})
+}
+
+func (S) TestMasterNodeAddressPlan(c *C) {
+	servers := []storage.Server{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1", ClusterRole: string(schema.ServiceRoleMaster)},
+		{Hostname: "node-2", AdvertiseIP: "192.168.1.2", ClusterRole: string(schema.ServiceRoleNode)},
+		{Hostname: "node-3", AdvertiseIP: "192.168.1.3", ClusterRole: string(schema.ServiceRoleMaster)},
+	}
+	operation := ops.SiteOperation{
+		ID:         "1",
+		AccountID:  "0",
+		Type:       ops.OperationReconfigureNode,
+		SiteDomain: "cluster",
+		ReconfigureNode: &storage.ReconfigureNodeOperationState{
+			Server:        servers[2],
+			AdvertiseAddr: "192.168.2.3",
+		},
+	}
+
+	plan, err := NewOperationPlan(operation, servers)
+	c.Assert(err, IsNil)
+	c.Assert(plan, compare.DeepEquals, &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Servers:       servers,
+		Phases: []storage.OperationPhase{
+			{
+				ID:          "/validate",
+				Description: `Validate address 192.168.2.3 on node "node-3"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[2],
+				},
+			},
+			{
+				ID:          "/etcd",
+				Description: `Update etcd peer address of node "node-3"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[2],
+				},
+			},
+			{
+				ID:          "/configure",
+				Description: "Generate secrets and runtime configuration packages",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/node",
+				Description: `Restart runtime on node "node-3" with the new address`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[2],
+				},
+			},
+			{
+				ID:          "/masters",
+				Description: "Restart runtime on master nodes",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/masters/node-1",
+						Description: `Restart runtime on node "node-1"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[0],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/nodes",
+				Description: "Restart runtime on regular nodes",
+				Phases: []storage.OperationPhase{
+					{
+						ID:          "/nodes/node-2",
+						Description: `Restart runtime on node "node-2"`,
+						Data: &storage.OperationPhaseData{
+							Server: &servers[1],
+						},
+					},
+				},
+			},
+			{
+				ID:          "/kubernetes",
+				Description: `Replace Kubernetes node object of node "node-3"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+		},
+	})
+}
+
+func (S) TestRegularNodeAddressPlan(c *C) {
+	servers := []storage.Server{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1", ClusterRole: string(schema.ServiceRoleMaster)},
+		{Hostname: "node-2", AdvertiseIP: "192.168.1.2", ClusterRole: string(schema.ServiceRoleNode),
+			Nodename: "node-2.example.com"},
+	}
+	operation := ops.SiteOperation{
+		ID:         "1",
+		AccountID:  "0",
+		Type:       ops.OperationReconfigureNode,
+		SiteDomain: "cluster",
+		ReconfigureNode: &storage.ReconfigureNodeOperationState{
+			Server:        servers[1],
+			AdvertiseAddr: "192.168.2.2",
+		},
+	}
+
+	plan, err := NewOperationPlan(operation, servers)
+	c.Assert(err, IsNil)
+	c.Assert(plan, compare.DeepEquals, &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Servers:       servers,
+		Phases: []storage.OperationPhase{
+			{
+				ID:          "/validate",
+				Description: `Validate address 192.168.2.2 on node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/configure",
+				Description: "Generate secrets and runtime configuration packages",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/node",
+				Description: `Restart runtime on node "node-2" with the new address`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+		},
+	})
+}
+
+func (S) TestDockerPlan(c *C) {
+	servers := []storage.Server{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1", ClusterRole: string(schema.ServiceRoleMaster)},
+		{Hostname: "node-2", AdvertiseIP: "192.168.1.2", ClusterRole: string(schema.ServiceRoleNode),
+			Docker: storage.Docker{Device: storage.Device{Name: "/dev/xvdb"}}},
+	}
+	operation := ops.SiteOperation{
+		ID:         "1",
+		AccountID:  "0",
+		Type:       ops.OperationReconfigureDocker,
+		SiteDomain: "cluster",
+		ReconfigureDocker: &storage.ReconfigureDockerOperationState{
+			Server:            servers[1],
+			StorageDriver:     "overlay2",
+			PrevStorageDriver: "devicemapper",
+		},
+	}
+
+	plan, err := NewOperationPlan(operation, servers)
+	c.Assert(err, IsNil)
+	c.Assert(plan, compare.DeepEquals, &storage.OperationPlan{
+		OperationID:   operation.ID,
+		OperationType: operation.Type,
+		AccountID:     operation.AccountID,
+		ClusterName:   operation.SiteDomain,
+		Servers:       servers,
+		Phases: []storage.OperationPhase{
+			{
+				ID:          "/validate",
+				Description: `Validate Docker storage driver overlay2 on node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/drain",
+				Description: `Drain node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/configure",
+				Description: "Generate runtime configuration package",
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+			{
+				ID:          "/images",
+				Description: `Record images from the cluster registry on node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/node",
+				Description: `Restart runtime on node "node-2" with Docker storage driver overlay2`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/reimport",
+				Description: `Pull images from the cluster registry on node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/devicemapper",
+				Description: `Remove devicemapper pool on node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[1],
+				},
+			},
+			{
+				ID:          "/uncordon",
+				Description: `Uncordon node "node-2"`,
+				Data: &storage.OperationPhaseData{
+					Server: &servers[0],
+				},
+			},
+		},
+	})
+}
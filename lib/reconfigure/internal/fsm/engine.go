@@ -0,0 +1,373 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	libpack "github.com/gravitational/gravity/lib/pack"
+	libphase "github.com/gravitational/gravity/lib/reconfigure/internal/phases"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// New returns a new state machine for network, node or Docker reconfiguration
+func New(config Config) (*libfsm.FSM, error) {
+	err := config.checkAndSetDefaults()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	engine := &engine{
+		Config: config,
+	}
+	machine, err := libfsm.New(libfsm.Config{
+		Engine: engine,
+		Runner: config.Runner,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	machine.SetPreExec(engine.UpdateProgress)
+	machine.SetPlanGate(ops.MaintenanceWindowGate(config.Operation.Key(), config.Operator))
+	return machine, nil
+}
+
+// Check validates the FSM config and sets some defaults
+func (r *Config) checkAndSetDefaults() (err error) {
+	if r.Operation == nil {
+		return trace.BadParameter("operation is required")
+	}
+	if r.Operation.ReconfigureNetwork == nil && r.Operation.ReconfigureNode == nil &&
+		r.Operation.ReconfigureDocker == nil {
+		return trace.BadParameter("operation %v is not a reconfiguration", r.Operation.ID)
+	}
+	if r.Packages == nil {
+		return trace.BadParameter("package service is required")
+	}
+	if r.LocalPackages == nil {
+		return trace.BadParameter("local package service is required")
+	}
+	if r.Operator == nil {
+		return trace.BadParameter("operator service is required")
+	}
+	if r.FieldLogger == nil {
+		r.FieldLogger = log.WithField(trace.Component, "fsm:reconfigure")
+	}
+	if r.Spec == nil {
+		r.Spec = configToExecutor(*r)
+	}
+	return nil
+}
+
+// Config describes configuration of the reconfiguration state machine
+type Config struct {
+	// Operation references the active network, node or Docker reconfiguration operation
+	Operation *ops.SiteOperation
+	// Packages is the cluster package service
+	Packages libpack.PackageService
+	// LocalPackages is the machine-local pack service
+	LocalPackages libpack.PackageService
+	// Operator is the cluster operator service
+	Operator ops.Operator
+	// Client is the optional Kubernetes client.
+	// It is only required for phases executed on master nodes
+	Client *kubernetes.Clientset
+	// FieldLogger is the logger
+	log.FieldLogger
+	// Spec specifies the function that resolves to an executor
+	Spec libfsm.FSMSpecFunc
+	// Runner specifies the remote command runner
+	Runner libfsm.RemoteRunner
+	// Silent controls whether the process outputs messages to stdout
+	localenv.Silent
+	// Emitter outputs progress messages to stdout
+	utils.Emitter
+}
+
+// UpdateProgress creates an appropriate progress entry in the operator
+func (r *engine) UpdateProgress(ctx context.Context, params libfsm.Params) error {
+	plan, err := r.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	phase, err := libfsm.FindPhase(plan, params.PhaseID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	key := r.Operation.Key()
+	entry := ops.ProgressEntry{
+		SiteDomain:  key.SiteDomain,
+		OperationID: key.OperationID,
+		Completion:  100 / utils.Max(len(plan.Phases), 1) * phase.Step,
+		Step:        phase.Step,
+		State:       ops.ProgressStateInProgress,
+		Message:     phase.Description,
+		Created:     time.Now().UTC(),
+	}
+	err = r.Operator.CreateProgressEntry(key, entry)
+	if err != nil {
+		r.Warnf("Failed to create progress entry %v: %v.", entry,
+			trace.DebugReport(err))
+	}
+	return nil
+}
+
+// Complete marks the operation as either completed or failed based
+// on the state of the operation plan
+func (r *engine) Complete(fsmErr error) error {
+	plan, err := r.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if libfsm.IsCompleted(plan) {
+		err = ops.CompleteOperation(r.Operation.Key(), r.Operator)
+	} else {
+		err = ops.FailOperation(r.Operation.Key(), r.Operator, trace.Unwrap(fsmErr).Error())
+	}
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	r.Debug("Marked operation complete.")
+	return nil
+}
+
+// ChangePhaseState creates an new changelog entry
+func (r *engine) ChangePhaseState(ctx context.Context, change libfsm.StateChange) error {
+	err := r.Operator.CreateOperationPlanChange(r.Operation.Key(),
+		storage.PlanChange{
+			ID:          uuid.New(),
+			ClusterName: r.Operation.SiteDomain,
+			OperationID: r.Operation.ID,
+			PhaseID:     change.Phase,
+			NewState:    change.State,
+			Error:       utils.ToRawTrace(change.Error),
+			Created:     time.Now().UTC(),
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	r.Debugf("Applied %v.", change)
+	return nil
+}
+
+// GetExecutor returns the appropriate phase executor based on the
+// provided parameters
+func (r *engine) GetExecutor(params libfsm.ExecutorParams, remote libfsm.Remote) (libfsm.PhaseExecutor, error) {
+	return r.Spec(params, remote)
+}
+
+// RunCommand executes the phase specified by params on the specified server
+// using the provided runner
+func (r *engine) RunCommand(ctx context.Context, runner libfsm.RemoteRunner, server storage.Server, params libfsm.Params) error {
+	command := "network"
+	switch {
+	case r.Operation.ReconfigureNode != nil:
+		command = "node"
+	case r.Operation.ReconfigureDocker != nil:
+		command = "docker"
+	}
+	args := []string{"reconfigure", command, "--phase", params.PhaseID}
+	if params.Force {
+		args = append(args, "--force")
+	}
+	return runner.Run(ctx, server, args...)
+}
+
+// RunRollbackCommand rolls back the phase specified by params on the specified
+// server using the provided runner
+func (r *engine) RunRollbackCommand(ctx context.Context, runner libfsm.RemoteRunner, server storage.Server, params libfsm.Params) error {
+	args := []string{"rollback", "--phase", params.PhaseID, fmt.Sprintf("--force=%v", params.Force)}
+	return runner.Run(ctx, server, args...)
+}
+
+// GetPlan returns the most up-to-date operation plan
+func (r *engine) GetPlan() (*storage.OperationPlan, error) {
+	plan, err := r.Operator.GetOperationPlan(r.Operation.Key())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return plan, nil
+}
+
+// engine is the network, node and Docker reconfiguration engine
+type engine struct {
+	// Config is the engine's configuration
+	Config
+}
+
+// configToExecutor returns a function that maps configuration and a set of parameters
+// to a phase executor
+func configToExecutor(config Config) libfsm.FSMSpecFunc {
+	if config.Operation.ReconfigureNode != nil {
+		return configToNodeExecutor(config)
+	}
+	if config.Operation.ReconfigureDocker != nil {
+		return configToDockerExecutor(config)
+	}
+	return func(params libfsm.ExecutorParams, remote libfsm.Remote) (libfsm.PhaseExecutor, error) {
+		state := *config.Operation.ReconfigureNetwork
+		switch {
+		case strings.HasPrefix(params.Phase.ID, libphase.Validate):
+			return libphase.NewValidate(params, state, remote)
+
+		case params.Phase.ID == libphase.Configure:
+			return libphase.NewConfigure(
+				params,
+				*config.Operation,
+				config.Operator,
+				config.Packages)
+
+		case strings.HasPrefix(params.Phase.ID, libphase.Masters),
+			strings.HasPrefix(params.Phase.ID, libphase.Nodes):
+			cluster, err := config.Operator.GetLocalSite()
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			return libphase.NewNode(
+				params,
+				config.Packages,
+				config.LocalPackages,
+				cluster.ServiceUser,
+				"",
+				remote)
+
+		case params.Phase.ID == libphase.Services:
+			return libphase.NewServices(params, state, config.Client)
+
+		case params.Phase.ID == libphase.Pods:
+			return libphase.NewPods(params, state, config.Client)
+
+		default:
+			return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+		}
+	}
+}
+
+// configToNodeExecutor returns a function that maps configuration and a set
+// of parameters to a phase executor of the node reconfiguration operation
+func configToNodeExecutor(config Config) libfsm.FSMSpecFunc {
+	return func(params libfsm.ExecutorParams, remote libfsm.Remote) (libfsm.PhaseExecutor, error) {
+		state := *config.Operation.ReconfigureNode
+		switch {
+		case params.Phase.ID == libphase.Validate:
+			return libphase.NewValidateAddr(params, state, remote)
+
+		case params.Phase.ID == libphase.Etcd:
+			return libphase.NewEtcd(params, state, remote)
+
+		case params.Phase.ID == libphase.Configure:
+			return libphase.NewConfigure(
+				params,
+				*config.Operation,
+				config.Operator,
+				config.Packages)
+
+		case params.Phase.ID == libphase.Node,
+			strings.HasPrefix(params.Phase.ID, libphase.Masters),
+			strings.HasPrefix(params.Phase.ID, libphase.Nodes):
+			cluster, err := config.Operator.GetLocalSite()
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			var advertiseAddr string
+			if params.Phase.ID == libphase.Node {
+				advertiseAddr = state.AdvertiseAddr
+			}
+			return libphase.NewNode(
+				params,
+				config.Packages,
+				config.LocalPackages,
+				cluster.ServiceUser,
+				advertiseAddr,
+				remote)
+
+		case params.Phase.ID == libphase.Kubernetes:
+			return libphase.NewKubernetes(params, state, config.Client)
+
+		default:
+			return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+		}
+	}
+}
+
+// configToDockerExecutor returns a function that maps configuration and a set
+// of parameters to a phase executor of the Docker reconfiguration operation
+func configToDockerExecutor(config Config) libfsm.FSMSpecFunc {
+	return func(params libfsm.ExecutorParams, remote libfsm.Remote) (libfsm.PhaseExecutor, error) {
+		state := *config.Operation.ReconfigureDocker
+		switch params.Phase.ID {
+		case libphase.Validate:
+			return libphase.NewValidateDocker(params, state, remote)
+
+		case libphase.Drain:
+			return libphase.NewDrain(params, state, config.Client)
+
+		case libphase.Configure:
+			return libphase.NewConfigure(
+				params,
+				*config.Operation,
+				config.Operator,
+				config.Packages)
+
+		case libphase.Images:
+			return libphase.NewImages(params, remote)
+
+		case libphase.Node:
+			cluster, err := config.Operator.GetLocalSite()
+			if err != nil {
+				return nil, trace.Wrap(err)
+			}
+			return libphase.NewNode(
+				params,
+				config.Packages,
+				config.LocalPackages,
+				cluster.ServiceUser,
+				"",
+				remote)
+
+		case libphase.Reimport:
+			return libphase.NewReimport(params, remote)
+
+		case libphase.Devicemapper:
+			return libphase.NewDevicemapper(params, state, remote)
+
+		case libphase.Uncordon:
+			return libphase.NewUncordon(params, state, config.Client)
+
+		default:
+			return nil, trace.BadParameter("unknown phase %q", params.Phase.ID)
+		}
+	}
+}
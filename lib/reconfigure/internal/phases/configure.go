@@ -0,0 +1,214 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewConfigure returns a new executor that generates runtime configuration
+// packages with the new network settings, the new node advertise address
+// or the new Docker storage driver for the cluster nodes
+func NewConfigure(params libfsm.ExecutorParams, operation ops.SiteOperation, operator ops.Operator, packages pack.PackageService) (*configureExecutor, error) {
+	if operation.ReconfigureNetwork == nil && operation.ReconfigureNode == nil &&
+		operation.ReconfigureDocker == nil {
+		return nil, trace.BadParameter("operation %v is not a reconfiguration", operation.ID)
+	}
+	return &configureExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:configure",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		operation:      operation,
+		operator:       operator,
+		packages:       packages,
+	}, nil
+}
+
+// Execute rotates the runtime configuration packages for all nodes.
+// If the service subnet changes, secrets packages of the master nodes are
+// rotated as well since the API server certificate includes the address
+// of the API server service
+func (r *configureExecutor) Execute(ctx context.Context) error {
+	if r.operation.ReconfigureNode != nil {
+		return trace.Wrap(r.configureNode())
+	}
+	if state := r.operation.ReconfigureDocker; state != nil {
+		r.Progress.NextStep("Generating configuration for node %v", state.Server.Hostname)
+		return trace.Wrap(r.rotatePlanetConfig(state.Server, r.Plan.Servers))
+	}
+	state := r.operation.ReconfigureNetwork
+	for _, server := range r.Plan.Servers {
+		r.Progress.NextStep("Generating configuration for node %v", server.Hostname)
+		if err := r.rotatePlanetConfig(server, r.Plan.Servers); err != nil {
+			return trace.Wrap(err)
+		}
+		if state.Subnets.Service == state.PrevSubnets.Service ||
+			server.ClusterRole != string(schema.ServiceRoleMaster) {
+			continue
+		}
+		if err := r.rotateSecrets(server); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// Rollback removes the packages generated by this operation
+// from the cluster package service
+func (r *configureExecutor) Rollback(context.Context) error {
+	return pack.ForeachPackageInRepo(r.packages, r.operation.SiteDomain,
+		func(e pack.PackageEnvelope) error {
+			if e.HasLabel(pack.OperationIDLabel, r.operation.ID) {
+				r.Infof("Removing package %v.", e.Locator)
+				return r.packages.DeletePackage(e.Locator)
+			}
+			return nil
+		})
+}
+
+// PreCheck is a no-op
+func (r *configureExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *configureExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// configureNode generates the secrets, runtime and teleport configuration
+// packages for the new advertise address of the reconfigured node.
+// If the node is a master, the runtime configuration of the other nodes
+// is rotated as well since it references the addresses of the masters
+func (r *configureExecutor) configureNode() error {
+	state := r.operation.ReconfigureNode
+	target := state.Target()
+	servers := make([]storage.Server, 0, len(r.Plan.Servers))
+	for _, server := range r.Plan.Servers {
+		if server.AdvertiseIP == state.Server.AdvertiseIP {
+			server = target
+		}
+		servers = append(servers, server)
+	}
+	r.Progress.NextStep("Generating configuration for node %v", target.Hostname)
+	if err := r.rotateSecrets(target); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := r.rotatePlanetConfig(target, servers); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := r.rotateTeleportConfig(target, servers); err != nil {
+		return trace.Wrap(err)
+	}
+	if target.ClusterRole != string(schema.ServiceRoleMaster) {
+		return nil
+	}
+	for _, server := range servers {
+		if server.AdvertiseIP == target.AdvertiseIP {
+			continue
+		}
+		r.Progress.NextStep("Generating configuration for node %v", server.Hostname)
+		if err := r.rotatePlanetConfig(server, servers); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (r *configureExecutor) rotatePlanetConfig(server storage.Server, servers []storage.Server) error {
+	resp, err := r.operator.RotatePlanetConfig(ops.RotateConfigPackageRequest{
+		AccountID:   r.operation.AccountID,
+		ClusterName: r.operation.SiteDomain,
+		OperationID: r.operation.ID,
+		Server:      server,
+		Servers:     servers,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = r.packages.UpsertPackage(resp.Locator, resp.Reader, pack.WithLabels(resp.Labels))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Debugf("Rotated planet config package for %v: %v.", server, resp.Locator)
+	return nil
+}
+
+func (r *configureExecutor) rotateSecrets(server storage.Server) error {
+	resp, err := r.operator.RotateSecrets(ops.RotateSecretsRequest{
+		AccountID:   r.operation.AccountID,
+		ClusterName: r.operation.SiteDomain,
+		OperationID: r.operation.ID,
+		Server:      server,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	_, err = r.packages.CreatePackage(resp.Locator, resp.Reader, pack.WithLabels(resp.Labels))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Debugf("Rotated secrets package for %v: %v.", server, resp.Locator)
+	return nil
+}
+
+func (r *configureExecutor) rotateTeleportConfig(server storage.Server, servers []storage.Server) error {
+	masterConf, nodeConf, err := r.operator.RotateTeleportConfig(ops.RotateConfigPackageRequest{
+		AccountID:   r.operation.AccountID,
+		ClusterName: r.operation.SiteDomain,
+		OperationID: r.operation.ID,
+		Server:      server,
+		Servers:     servers,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if masterConf != nil {
+		_, err = r.packages.UpsertPackage(masterConf.Locator, masterConf.Reader, pack.WithLabels(masterConf.Labels))
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		r.Debugf("Rotated teleport master config package for %v: %v.", server, masterConf.Locator)
+	}
+	_, err = r.packages.UpsertPackage(nodeConf.Locator, nodeConf.Reader, pack.WithLabels(nodeConf.Labels))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Debugf("Rotated teleport node config package for %v: %v.", server, nodeConf.Locator)
+	return nil
+}
+
+type configureExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	operation ops.SiteOperation
+	operator  ops.Operator
+	packages  pack.PackageService
+}
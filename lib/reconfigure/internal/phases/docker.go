@@ -0,0 +1,330 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/checks"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/devicemapper"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewValidateDocker returns a new executor that verifies that the node
+// supports the new Docker storage driver
+func NewValidateDocker(params libfsm.ExecutorParams, state storage.ReconfigureDockerOperationState, remote libfsm.Remote) (*validateDockerExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &validateDockerExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:validate",
+			"phase":         params.Phase.ID,
+		}),
+		server: *params.Phase.Data.Server,
+		state:  state,
+		remote: remote,
+	}, nil
+}
+
+// Execute makes sure the filesystem of the state directory
+// can host the new storage driver
+func (r *validateDockerExecutor) Execute(ctx context.Context) error {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	failed, err := schema.ValidateDocker(schema.Docker{StorageDriver: r.state.StorageDriver}, stateDir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(failed) != 0 {
+		return trace.BadParameter("node %v does not support Docker storage driver %v:\n%v",
+			r.server.Hostname, r.state.StorageDriver, checks.FormatFailedChecks(failed))
+	}
+	r.Infof("Node %v supports Docker storage driver %v.", r.server.Hostname, r.state.StorageDriver)
+	return nil
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *validateDockerExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *validateDockerExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// Rollback is a no-op
+func (r *validateDockerExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+type validateDockerExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	server storage.Server
+	state  storage.ReconfigureDockerOperationState
+	remote libfsm.Remote
+}
+
+// NewImages returns a new executor that records the images the node
+// has pulled from the cluster registry so they can be pulled again
+// once the node has been migrated to the new storage driver
+func NewImages(params libfsm.ExecutorParams, remote libfsm.Remote) (*imagesExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &imagesExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:images",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		server:         *params.Phase.Data.Server,
+		remote:         remote,
+	}, nil
+}
+
+// Execute lists the images from the cluster registry in the node's
+// Docker image store and saves them to the node's state directory.
+//
+// The list survives the runtime restart, so the phase that pulls
+// the images can be resumed
+func (r *imagesExecutor) Execute(ctx context.Context) error {
+	r.Progress.NextStep("Recording images on node %v", r.server.Hostname)
+	out, err := utils.RunInPlanetCommand(ctx, r.FieldLogger,
+		"docker", "images", "--format", "{{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return trace.Wrap(err, "failed to list images: %s", out)
+	}
+	images := registryImages(out)
+	path, err := imagesPath(r.Plan.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), defaults.SharedDirMask)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	err = ioutil.WriteFile(path, []byte(strings.Join(images, "\n")), defaults.SharedReadMask)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	r.Infof("Recorded %v image(-s) from the cluster registry in %v.", len(images), path)
+	return nil
+}
+
+// Rollback removes the list of recorded images
+func (r *imagesExecutor) Rollback(context.Context) error {
+	path, err := imagesPath(r.Plan.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *imagesExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *imagesExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+type imagesExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	server storage.Server
+	remote libfsm.Remote
+}
+
+// NewReimport returns a new executor that pulls the images recorded
+// before the migration from the cluster registry
+func NewReimport(params libfsm.ExecutorParams, remote libfsm.Remote) (*reimportExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &reimportExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:reimport",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		server:         *params.Phase.Data.Server,
+		remote:         remote,
+	}, nil
+}
+
+// Execute pulls the recorded images into the image store of the
+// new storage driver.
+//
+// Pulling an image that is already present is a no-op,
+// so the phase can be safely repeated
+func (r *reimportExecutor) Execute(ctx context.Context) error {
+	path, err := imagesPath(r.Plan.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	images := strings.Fields(string(data))
+	for i, image := range images {
+		r.Progress.NextStep("Pulling image %v (%v/%v)", image, i+1, len(images))
+		out, err := utils.RunInPlanetCommand(ctx, r.FieldLogger, "docker", "pull", image)
+		if err != nil {
+			return trace.Wrap(err, "failed to pull image %v: %s", image, out)
+		}
+		r.Infof("Pulled image %v.", image)
+	}
+	return nil
+}
+
+// Rollback is a no-op: the images are removed together
+// with the image store of the new storage driver
+func (r *reimportExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *reimportExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *reimportExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+type reimportExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	server storage.Server
+	remote libfsm.Remote
+}
+
+// NewDevicemapper returns a new executor that removes the devicemapper
+// pool of the node migrated to a different storage driver
+func NewDevicemapper(params libfsm.ExecutorParams, state storage.ReconfigureDockerOperationState, remote libfsm.Remote) (*devicemapperExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &devicemapperExecutor{
+		Entry: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:devicemapper",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		server:         *params.Phase.Data.Server,
+		state:          state,
+		remote:         remote,
+	}, nil
+}
+
+// Execute removes the devicemapper logical volume, volume group
+// and physical volume which releases the Docker device of the node
+func (r *devicemapperExecutor) Execute(ctx context.Context) error {
+	r.Progress.NextStep("Removing devicemapper pool on node %v", r.server.Hostname)
+	return trace.Wrap(devicemapper.Unmount(os.Stderr, r.Entry))
+}
+
+// Rollback recreates the devicemapper pool on the Docker device
+// of the node if the node had one
+func (r *devicemapperExecutor) Rollback(context.Context) error {
+	disk := r.state.Server.Docker.Device.Path()
+	if disk == "" {
+		r.Info("Node has no Docker device.")
+		return nil
+	}
+	r.Progress.NextStep("Creating devicemapper pool on node %v", r.server.Hostname)
+	return trace.Wrap(devicemapper.Mount(disk, os.Stderr, r.Entry))
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *devicemapperExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *devicemapperExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+type devicemapperExecutor struct {
+	// Entry is the logger the executor uses
+	*log.Entry
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	server storage.Server
+	state  storage.ReconfigureDockerOperationState
+	remote libfsm.Remote
+}
+
+// registryImages returns the images from the cluster registry
+// in the output of the docker images command
+func registryImages(out []byte) (images []string) {
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		image := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(image, fmt.Sprintf("%v/", constants.DockerRegistry)) ||
+			strings.HasSuffix(image, ":<none>") {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// imagesPath returns the path to the list of images
+// recorded by the specified operation
+func imagesPath(operationID string) (string, error) {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return filepath.Join(state.GravityUpdateDir(stateDir),
+		fmt.Sprintf("images-%v", operationID)), nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	libkubernetes "github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewDrain returns a new executor that drains the node
+// migrated to a different storage driver
+func NewDrain(params libfsm.ExecutorParams, state storage.ReconfigureDockerOperationState, client *kubernetes.Clientset) (*drainExecutor, error) {
+	if client == nil {
+		return nil, trace.BadParameter("phase %q requires a Kubernetes client", params.Phase.ID)
+	}
+	return &drainExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:drain",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		state:          state,
+		client:         client,
+	}, nil
+}
+
+// Execute marks the node unschedulable and evicts its pods
+func (r *drainExecutor) Execute(ctx context.Context) error {
+	r.Progress.NextStep("Draining node %v", r.state.Server.Hostname)
+	ctx, cancel := context.WithTimeout(ctx, defaults.DrainTimeout)
+	defer cancel()
+	err := libkubernetes.Drain(ctx, r.client, r.state.Server.KubeNodeID())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Infof("Drained node %v.", r.state.Server.Hostname)
+	return nil
+}
+
+// Rollback marks the node schedulable
+func (r *drainExecutor) Rollback(ctx context.Context) error {
+	return trace.Wrap(uncordon(ctx, r.client, r.state.Server))
+}
+
+// PreCheck is a no-op
+func (r *drainExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *drainExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+type drainExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	state  storage.ReconfigureDockerOperationState
+	client *kubernetes.Clientset
+}
+
+// NewUncordon returns a new executor that makes the node
+// migrated to a different storage driver schedulable again
+func NewUncordon(params libfsm.ExecutorParams, state storage.ReconfigureDockerOperationState, client *kubernetes.Clientset) (*uncordonExecutor, error) {
+	if client == nil {
+		return nil, trace.BadParameter("phase %q requires a Kubernetes client", params.Phase.ID)
+	}
+	return &uncordonExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:uncordon",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		state:          state,
+		client:         client,
+	}, nil
+}
+
+// Execute marks the node schedulable
+func (r *uncordonExecutor) Execute(ctx context.Context) error {
+	r.Progress.NextStep("Uncordoning node %v", r.state.Server.Hostname)
+	return trace.Wrap(uncordon(ctx, r.client, r.state.Server))
+}
+
+// Rollback is a no-op
+func (r *uncordonExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+// PreCheck is a no-op
+func (r *uncordonExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *uncordonExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+type uncordonExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	state  storage.ReconfigureDockerOperationState
+	client *kubernetes.Clientset
+}
+
+func uncordon(ctx context.Context, client *kubernetes.Clientset, server storage.Server) error {
+	err := libkubernetes.SetUnschedulable(ctx, client.CoreV1().Nodes(), server.KubeNodeID(), false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	log.Infof("Uncordoned node %v.", server.Hostname)
+	return nil
+}
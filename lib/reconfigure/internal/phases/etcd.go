@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/clients"
+	"github.com/gravitational/gravity/lib/defaults"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewEtcd returns a new executor that updates the peer address of the
+// etcd member running on the reconfigured node
+func NewEtcd(params libfsm.ExecutorParams, state storage.ReconfigureNodeOperationState, remote libfsm.Remote) (*etcdExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	client, err := newEtcdMembers(params.Plan.Servers)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &etcdExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:etcd",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		server:         *params.Phase.Data.Server,
+		state:          state,
+		etcd:           client,
+		remote:         remote,
+	}, nil
+}
+
+// Execute updates the peer URL of the node's etcd member to the new advertise address.
+// The member keeps serving the cluster until its runtime is restarted with the
+// new configuration
+func (r *etcdExecutor) Execute(ctx context.Context) error {
+	r.Progress.NextStep("Updating etcd peer address of node %v", r.server.Hostname)
+	return trace.Wrap(r.updatePeerURL(ctx, r.state.Server.AdvertiseIP, r.state.AdvertiseAddr))
+}
+
+// Rollback restores the peer URL of the node's etcd member
+func (r *etcdExecutor) Rollback(ctx context.Context) error {
+	r.Progress.NextStep("Restoring etcd peer address of node %v", r.server.Hostname)
+	return trace.Wrap(r.updatePeerURL(ctx, r.state.AdvertiseAddr, r.state.Server.AdvertiseIP))
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *etcdExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *etcdExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// updatePeerURL changes the peer URL of the etcd member from the address from
+// to the address to. It is a no-op if the member has already been updated
+func (r *etcdExecutor) updatePeerURL(ctx context.Context, from, to string) error {
+	members, err := r.etcd.List(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	member := findMemberByPeerURL(members, etcdPeerURL(from))
+	if member == nil {
+		if findMemberByPeerURL(members, etcdPeerURL(to)) != nil {
+			r.Infof("Etcd member already uses peer URL %v.", etcdPeerURL(to))
+			return nil
+		}
+		return trace.NotFound("no etcd member with peer URL %v", etcdPeerURL(from))
+	}
+	err = r.etcd.Update(ctx, member.ID, []string{etcdPeerURL(to)})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Infof("Updated peer URL of etcd member %v: %v -> %v.", member.Name,
+		etcdPeerURL(from), etcdPeerURL(to))
+	return nil
+}
+
+type etcdExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	server storage.Server
+	state  storage.ReconfigureNodeOperationState
+	etcd   etcd.MembersAPI
+	remote libfsm.Remote
+}
+
+// newEtcdMembers returns a client to the etcd members API talking
+// to the members running on the specified master servers
+func newEtcdMembers(servers []storage.Server) (etcd.MembersAPI, error) {
+	masters, _ := libfsm.SplitServers(servers)
+	var endpoints []string
+	for _, master := range masters {
+		endpoints = append(endpoints, fmt.Sprintf("https://%v",
+			utils.JoinHostPort(master.AdvertiseIP, defaults.EtcdAPIPort)))
+	}
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	client, err := clients.EtcdMembers(&clients.EtcdConfig{
+		Endpoints:  endpoints,
+		SecretsDir: state.SecretDir(stateDir),
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client, nil
+}
+
+// findMemberByPeerURL returns the member with the specified peer URL
+func findMemberByPeerURL(members []etcd.Member, peerURL string) *etcd.Member {
+	for i, member := range members {
+		if utils.StringInSlice(member.PeerURLs, peerURL) {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// etcdPeerURL returns the etcd peer URL for the specified address
+func etcdPeerURL(addr string) string {
+	return fmt.Sprintf("https://%v", utils.JoinHostPort(addr, defaults.EtcdPeerPort))
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/cenkalti/backoff"
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewKubernetes returns a new executor that replaces the Kubernetes node
+// registered under the previous advertise address of the reconfigured node
+// with the node registered under the new address
+func NewKubernetes(params libfsm.ExecutorParams, state storage.ReconfigureNodeOperationState, client *kubernetes.Clientset) (*kubernetesExecutor, error) {
+	if client == nil {
+		return nil, trace.BadParameter("phase %q requires a Kubernetes client", params.Phase.ID)
+	}
+	return &kubernetesExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:kubernetes",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		state:          state,
+		client:         client,
+	}, nil
+}
+
+// Execute waits for the node to register under the new advertise address,
+// transfers the labels, taints and schedulability from the node object
+// registered under the previous address and removes it
+func (r *kubernetesExecutor) Execute(ctx context.Context) error {
+	target := r.state.Target()
+	return trace.Wrap(r.replaceNode(ctx, r.state.Server.KubeNodeID(), target.KubeNodeID()))
+}
+
+// Rollback waits for the node to register under the previous advertise
+// address and replaces the node object registered under the new address
+func (r *kubernetesExecutor) Rollback(ctx context.Context) error {
+	target := r.state.Target()
+	return trace.Wrap(r.replaceNode(ctx, target.KubeNodeID(), r.state.Server.KubeNodeID()))
+}
+
+// PreCheck is a no-op
+func (r *kubernetesExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *kubernetesExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// replaceNode replaces the node object with the name from
+// with the node object with the name to
+func (r *kubernetesExecutor) replaceNode(ctx context.Context, from, to string) error {
+	if from == to {
+		return nil
+	}
+	nodes := r.client.CoreV1().Nodes()
+	prev, err := nodes.Get(from, metav1.GetOptions{})
+	err = rigging.ConvertError(err)
+	if trace.IsNotFound(err) {
+		r.Infof("Node %v has already been removed.", from)
+		return nil
+	}
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Progress.NextStep("Waiting for node %v to register", to)
+	var node *v1.Node
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = defaults.NodeHealthTimeout
+	err = utils.RetryWithInterval(ctx, b, func() error {
+		node, err = nodes.Get(to, metav1.GetOptions{})
+		return trace.Wrap(rigging.ConvertError(err))
+	})
+	if err != nil {
+		return trace.Wrap(err, "node %v has not registered", to)
+	}
+	copyNodeSettings(prev, node)
+	_, err = nodes.Update(node)
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	r.Infof("Removing node %v.", from)
+	err = rigging.ConvertError(nodes.Delete(from, &metav1.DeleteOptions{}))
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// copyNodeSettings copies the labels the node does not have, the taints and
+// the schedulability from the node object src to the node object dst
+func copyNodeSettings(src, dst *v1.Node) {
+	if dst.Labels == nil {
+		dst.Labels = make(map[string]string)
+	}
+	for key, value := range src.Labels {
+		if _, ok := dst.Labels[key]; !ok {
+			dst.Labels[key] = value
+		}
+	}
+	for _, taint := range src.Spec.Taints {
+		if !hasTaint(dst.Spec.Taints, taint) {
+			dst.Spec.Taints = append(dst.Spec.Taints, taint)
+		}
+	}
+	dst.Spec.Unschedulable = src.Spec.Unschedulable
+}
+
+func hasTaint(taints []v1.Taint, taint v1.Taint) bool {
+	for _, t := range taints {
+		if t.Key == taint.Key && t.Effect == taint.Effect {
+			return true
+		}
+	}
+	return false
+}
+
+type kubernetesExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	state  storage.ReconfigureNodeOperationState
+	client *kubernetes.Clientset
+}
@@ -0,0 +1,347 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/gravitational/gravity/lib/app/service"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/status"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/cenkalti/backoff"
+	"github.com/gravitational/configure"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewNode returns a new executor that restarts the runtime on the node
+// with the configuration generated for the new network settings.
+//
+// advertiseAddr specifies the new advertise address of the node if the
+// node is being reconfigured and is empty otherwise
+func NewNode(
+	params libfsm.ExecutorParams,
+	packages, localPackages pack.PackageService,
+	serviceUser storage.OSUser,
+	advertiseAddr string,
+	remote libfsm.Remote,
+) (*nodeExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	target := *params.Phase.Data.Server
+	if advertiseAddr != "" {
+		target.AdvertiseIP = advertiseAddr
+	}
+	return &nodeExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:node",
+			"phase":         params.Phase.ID,
+		}),
+		ExecutorParams: params,
+		server:         *params.Phase.Data.Server,
+		target:         target,
+		packages:       packages,
+		localPackages:  localPackages,
+		serviceUser:    serviceUser,
+		remote:         remote,
+	}, nil
+}
+
+// Execute pulls the configuration packages generated for the node,
+// installs the new secrets and teleport configuration if there are any
+// and restarts the runtime
+func (r *nodeExecutor) Execute(ctx context.Context) error {
+	var updates []pack.PackageEnvelope
+	err := pack.ForeachPackageInRepo(r.packages, r.Plan.ClusterName,
+		func(e pack.PackageEnvelope) error {
+			if e.HasLabels(r.operationLabels()) {
+				updates = append(updates, e)
+			}
+			return nil
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(updates) == 0 {
+		return trace.NotFound("no configuration packages found for node %v", r.server.Hostname)
+	}
+	for _, update := range updates {
+		r.Infof("Pulling package %v.", update.Locator)
+		_, err = service.PullPackage(service.PackagePullRequest{
+			FieldLogger: r.FieldLogger,
+			SrcPack:     r.packages,
+			DstPack:     r.localPackages,
+			Package:     update.Locator,
+			Upsert:      true,
+		})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	// after having pulled as root, update ownership on the blobs dir
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = utils.Chown(filepath.Join(stateDir, defaults.LocalDir),
+		r.serviceUser.UID, r.serviceUser.GID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	runtime, err := r.findRuntime()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, update := range updates {
+		switch {
+		case isSecretsPackage(update):
+			if err := r.reinstall(ctx, update.Locator, nil); err != nil {
+				return trace.Wrap(err)
+			}
+		case isTeleportConfigPackage(update):
+			if err := r.reinstallTeleport(ctx); err != nil {
+				return trace.Wrap(err)
+			}
+		case isPlanetConfigPackage(update):
+			// The configuration package generated for a new advertise address
+			// has a different name so it has to be explicitly marked as the
+			// runtime configuration
+			if err := r.setRuntimeConfig(*runtime, update.Locator); err != nil {
+				return trace.Wrap(err)
+			}
+		}
+	}
+	return trace.Wrap(r.restartRuntime(ctx, *runtime, r.target))
+}
+
+// Rollback removes the configuration packages pulled during this operation,
+// reinstalls the previous secrets and teleport configuration and restarts
+// the runtime with the previous configuration
+func (r *nodeExecutor) Rollback(ctx context.Context) error {
+	var removedSecrets, removedTeleportConfig bool
+	err := pack.ForeachPackage(r.localPackages, func(e pack.PackageEnvelope) error {
+		if !e.HasLabels(r.operationLabels()) {
+			return nil
+		}
+		r.Infof("Removing package %v.", e.Locator)
+		if isSecretsPackage(e) {
+			removedSecrets = true
+		}
+		if isTeleportConfigPackage(e) {
+			removedTeleportConfig = true
+		}
+		return r.localPackages.DeletePackage(e.Locator)
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	runtime, err := r.findRuntime()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := r.restoreRuntimeConfig(*runtime); err != nil {
+		return trace.Wrap(err)
+	}
+	if removedSecrets {
+		secrets, err := pack.FindLatestPackageWithLabels(r.localPackages, r.Plan.ClusterName,
+			map[string]string{
+				pack.AdvertiseIPLabel: r.server.AdvertiseIP,
+				pack.PurposeLabel:     pack.PurposePlanetSecrets,
+			})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if err := r.reinstall(ctx, *secrets, nil); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if removedTeleportConfig {
+		if err := r.reinstallTeleport(ctx); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	return trace.Wrap(r.restartRuntime(ctx, *runtime, r.server))
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *nodeExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *nodeExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// restartRuntime reinstalls the installed runtime package which restarts
+// it with the latest configuration package and waits for the runtime
+// to come up with the advertise address of the specified server
+func (r *nodeExecutor) restartRuntime(ctx context.Context, runtime loc.Locator, server storage.Server) error {
+	r.Progress.NextStep("Restarting runtime on node %v", r.server.Hostname)
+	err := r.reinstall(ctx, runtime, pack.RuntimePackageLabels)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = defaults.NodeHealthTimeout
+	err = utils.RetryWithInterval(ctx, b, func() error {
+		agentStatus, err := status.FromPlanetAgent(ctx, []storage.Server{server})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		for _, node := range agentStatus.Nodes {
+			if node.Status == status.NodeOffline {
+				return trace.NotFound("node %v is offline", r.server.Hostname)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return trace.Wrap(err, "runtime on node %v has not started", r.server.Hostname)
+	}
+	return nil
+}
+
+// findRuntime returns the runtime package installed on the node
+func (r *nodeExecutor) findRuntime() (*loc.Locator, error) {
+	runtime, err := pack.FindPackage(r.localPackages, func(e pack.PackageEnvelope) bool {
+		return e.HasLabels(pack.RuntimePackageLabels) && e.HasLabels(pack.InstalledLabels)
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &runtime.Locator, nil
+}
+
+// reinstallTeleport reinstalls the installed teleport package which
+// restarts it with the latest node configuration package
+func (r *nodeExecutor) reinstallTeleport(ctx context.Context) error {
+	teleport, err := pack.FindPackage(r.localPackages, func(e pack.PackageEnvelope) bool {
+		return e.Locator.Name == constants.TeleportPackage && e.HasLabels(pack.InstalledLabels)
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(r.reinstall(ctx, teleport.Locator, nil))
+}
+
+// setRuntimeConfig marks the specified package as the configuration
+// package of the runtime removing the mark from any other package
+func (r *nodeExecutor) setRuntimeConfig(runtime, configPackage loc.Locator) error {
+	configLabels := pack.ConfigLabels(runtime, pack.PurposePlanetConfig)
+	var prevPackages []loc.Locator
+	err := pack.ForeachPackage(r.localPackages, func(e pack.PackageEnvelope) error {
+		if !e.Locator.IsEqualTo(configPackage) && e.HasLabels(configLabels) {
+			prevPackages = append(prevPackages, e.Locator)
+		}
+		return nil
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, prevPackage := range prevPackages {
+		err = r.localPackages.UpdatePackageLabels(prevPackage, nil, []string{pack.ConfigLabel})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	err = r.localPackages.UpdatePackageLabels(configPackage, configLabels, nil)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	r.Infof("Set %v as the configuration package of %v.", configPackage, runtime)
+	return nil
+}
+
+// restoreRuntimeConfig marks the latest configuration package generated
+// for the previous address of the node as the configuration package of the
+// runtime if the runtime has been left without one
+func (r *nodeExecutor) restoreRuntimeConfig(runtime loc.Locator) error {
+	_, err := pack.FindConfigPackage(r.localPackages, runtime)
+	if err == nil || !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	configPackage, err := pack.FindLatestPackageWithLabels(r.localPackages, r.Plan.ClusterName,
+		map[string]string{
+			pack.AdvertiseIPLabel: r.server.AdvertiseIP,
+			pack.PurposeLabel:     pack.PurposePlanetConfig,
+		})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(r.setRuntimeConfig(runtime, *configPackage))
+}
+
+func (r *nodeExecutor) reinstall(ctx context.Context, locator loc.Locator, labels map[string]string) error {
+	args := []string{"--debug", "system", "reinstall", locator.String()}
+	if len(labels) != 0 {
+		kvs := configure.KeyVal(labels)
+		args = append(args, "--labels", kvs.String())
+	}
+	out, err := utils.RunGravityCommand(ctx, r.FieldLogger, args...)
+	if err != nil {
+		return trace.Wrap(err, "failed to reinstall %v: %s", locator, out)
+	}
+	r.Infof("Reinstalled %v.", locator)
+	return nil
+}
+
+// operationLabels returns the labels of the packages generated
+// for the node by this operation
+func (r *nodeExecutor) operationLabels() map[string]string {
+	return map[string]string{
+		pack.AdvertiseIPLabel: r.target.AdvertiseIP,
+		pack.OperationIDLabel: r.Plan.OperationID,
+	}
+}
+
+func isSecretsPackage(e pack.PackageEnvelope) bool {
+	return e.HasLabel(pack.PurposeLabel, pack.PurposePlanetSecrets)
+}
+
+func isPlanetConfigPackage(e pack.PackageEnvelope) bool {
+	return e.HasLabel(pack.PurposeLabel, pack.PurposePlanetConfig)
+}
+
+func isTeleportConfigPackage(e pack.PackageEnvelope) bool {
+	return e.HasLabel(pack.PurposeLabel, pack.PurposeTeleportNodeConfig)
+}
+
+type nodeExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	// ExecutorParams is common executor parameters
+	libfsm.ExecutorParams
+	server storage.Server
+	// target is the node's record with the advertise address
+	// the node has after the operation
+	target        storage.Server
+	packages      pack.PackageService
+	localPackages pack.PackageService
+	serviceUser   storage.OSUser
+	remote        libfsm.Remote
+}
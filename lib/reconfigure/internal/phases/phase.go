@@ -0,0 +1,58 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+const (
+	// Validate is the phase to validate the new network settings
+	// against the network configuration of the nodes
+	Validate = "/validate"
+	// Configure is the phase to generate configuration packages
+	// with the new network settings
+	Configure = "/configure"
+	// Masters is the phase to restart the runtime on master nodes
+	Masters = "/masters"
+	// Nodes is the phase to restart the runtime on regular nodes
+	Nodes = "/nodes"
+	// Services is the phase to recreate services outside of the new service subnet
+	Services = "/services"
+	// Pods is the phase to restart pods so they are assigned addresses
+	// from the new pod subnet
+	Pods = "/pods"
+	// Etcd is the phase to update the peer address of the etcd member
+	// running on the reconfigured node
+	Etcd = "/etcd"
+	// Node is the phase to restart the runtime on the reconfigured node
+	// with the new advertise address
+	Node = "/node"
+	// Kubernetes is the phase to replace the Kubernetes node object
+	// registered under the previous advertise address
+	Kubernetes = "/kubernetes"
+	// Drain is the phase to drain the node migrated to a different
+	// Docker storage driver
+	Drain = "/drain"
+	// Images is the phase to record the images the node has pulled
+	// from the cluster registry
+	Images = "/images"
+	// Reimport is the phase to pull the recorded images from the cluster
+	// registry after the node has been migrated to a different storage driver
+	Reimport = "/reimport"
+	// Devicemapper is the phase to remove the devicemapper pool
+	// of the migrated node
+	Devicemapper = "/devicemapper"
+	// Uncordon is the phase to make the migrated node schedulable again
+	Uncordon = "/uncordon"
+)
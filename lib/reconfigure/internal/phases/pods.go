@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"net"
+
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewPods returns a new executor that restarts the pods which have been
+// allocated an address outside of the new pod subnet
+func NewPods(params libfsm.ExecutorParams, state storage.ReconfigureNetworkOperationState, client *kubernetes.Clientset) (*podsExecutor, error) {
+	if client == nil {
+		return nil, trace.BadParameter("phase %q requires a Kubernetes client", params.Phase.ID)
+	}
+	return &podsExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:pods",
+			"phase":         params.Phase.ID,
+		}),
+		state:  state,
+		client: client,
+	}, nil
+}
+
+// Execute restarts the pods outside of the new pod subnet
+func (r *podsExecutor) Execute(context.Context) error {
+	return trace.Wrap(r.restartPods(r.state.Subnets.Overlay))
+}
+
+// Rollback restarts the pods outside of the previous pod subnet
+func (r *podsExecutor) Rollback(context.Context) error {
+	return trace.Wrap(r.restartPods(r.state.PrevSubnets.Overlay))
+}
+
+// PreCheck is a no-op
+func (r *podsExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *podsExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// restartPods deletes the pods with addresses outside of the specified
+// (possibly dual-stack) subnet so they are recreated by their controllers.
+// Pods using the host network and pods without a controller are left intact
+func (r *podsExecutor) restartPods(cidr string) error {
+	subnets, err := parseSubnets(cidr)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	pods, err := r.client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	for _, pod := range pods.Items {
+		ip := net.ParseIP(pod.Status.PodIP)
+		if pod.Spec.HostNetwork || ip == nil || subnetsContain(subnets, ip) {
+			continue
+		}
+		if len(pod.OwnerReferences) == 0 {
+			r.Warnf("Pod %v/%v is not managed by a controller and needs to be recreated manually.",
+				pod.Namespace, pod.Name)
+			continue
+		}
+		r.Infof("Restarting pod %v/%v with address %v.", pod.Namespace, pod.Name, pod.Status.PodIP)
+		err := r.client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+	}
+	return nil
+}
+
+type podsExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	state  storage.ReconfigureNetworkOperationState
+	client *kubernetes.Clientset
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"net"
+
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/rigging"
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewServices returns a new executor that recreates the services
+// which have been allocated an address outside of the new service subnet
+func NewServices(params libfsm.ExecutorParams, state storage.ReconfigureNetworkOperationState, client *kubernetes.Clientset) (*servicesExecutor, error) {
+	if client == nil {
+		return nil, trace.BadParameter("phase %q requires a Kubernetes client", params.Phase.ID)
+	}
+	return &servicesExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:services",
+			"phase":         params.Phase.ID,
+		}),
+		state:  state,
+		client: client,
+	}, nil
+}
+
+// Execute recreates the services outside of the new service subnet
+func (r *servicesExecutor) Execute(context.Context) error {
+	if r.state.Subnets.Service == r.state.PrevSubnets.Service {
+		r.Info("Service subnet has not changed.")
+		return nil
+	}
+	return trace.Wrap(r.recreateServices(r.state.Subnets.Service))
+}
+
+// Rollback recreates the services outside of the previous service subnet
+func (r *servicesExecutor) Rollback(context.Context) error {
+	if r.state.Subnets.Service == r.state.PrevSubnets.Service {
+		return nil
+	}
+	return trace.Wrap(r.recreateServices(r.state.PrevSubnets.Service))
+}
+
+// PreCheck is a no-op
+func (r *servicesExecutor) PreCheck(context.Context) error {
+	return nil
+}
+
+// PostCheck is a no-op
+func (r *servicesExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// recreateServices recreates all services with cluster IPs outside of the
+// specified (possibly dual-stack) subnet so they are allocated new addresses.
+// The API server service is only removed as it is recreated by the API server
+func (r *servicesExecutor) recreateServices(cidr string) error {
+	subnets, err := parseSubnets(cidr)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	services, err := r.client.CoreV1().Services(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return trace.Wrap(rigging.ConvertError(err))
+	}
+	for _, service := range services.Items {
+		ip := net.ParseIP(service.Spec.ClusterIP)
+		if ip == nil || subnetsContain(subnets, ip) {
+			// Skip headless services and services in the subnet
+			continue
+		}
+		r.Infof("Recreating service %v/%v with address %v.",
+			service.Namespace, service.Name, service.Spec.ClusterIP)
+		err := r.client.CoreV1().Services(service.Namespace).Delete(service.Name, &metav1.DeleteOptions{})
+		err = rigging.ConvertError(err)
+		if err != nil && !trace.IsNotFound(err) {
+			return trace.Wrap(err)
+		}
+		if isAPIServerService(service) {
+			continue
+		}
+		_, err = r.client.CoreV1().Services(service.Namespace).Create(newService(service))
+		if err != nil {
+			return trace.Wrap(rigging.ConvertError(err))
+		}
+	}
+	return nil
+}
+
+type servicesExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	state  storage.ReconfigureNetworkOperationState
+	client *kubernetes.Clientset
+}
+
+// newService returns a copy of the specified service without the
+// server-assigned attributes
+func newService(service v1.Service) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        service.Name,
+			Namespace:   service.Namespace,
+			Labels:      service.Labels,
+			Annotations: service.Annotations,
+		},
+		Spec: withoutClusterIP(service.Spec),
+	}
+}
+
+func withoutClusterIP(spec v1.ServiceSpec) v1.ServiceSpec {
+	spec.ClusterIP = ""
+	return spec
+}
+
+func isAPIServerService(service v1.Service) bool {
+	return service.Namespace == metav1.NamespaceDefault && service.Name == "kubernetes"
+}
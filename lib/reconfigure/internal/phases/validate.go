@@ -0,0 +1,191 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"context"
+	"net"
+
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/systeminfo"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewValidate returns a new executor that verifies that the new network
+// settings do not overlap with the networks of the node
+func NewValidate(params libfsm.ExecutorParams, state storage.ReconfigureNetworkOperationState, remote libfsm.Remote) (*validateExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &validateExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:validate",
+			"phase":         params.Phase.ID,
+		}),
+		server: *params.Phase.Data.Server,
+		state:  state,
+		remote: remote,
+	}, nil
+}
+
+// Execute checks the addresses of the node's network interfaces
+// against the new pod and service subnets
+func (r *validateExecutor) Execute(ctx context.Context) error {
+	ifaces, err := systeminfo.NetworkInterfaces()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(checkInterfaces(ifaces, r.state))
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *validateExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *validateExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// Rollback is a no-op
+func (r *validateExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+type validateExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	server storage.Server
+	state  storage.ReconfigureNetworkOperationState
+	remote libfsm.Remote
+}
+
+// checkInterfaces returns an error if any of the specified interfaces
+// has an address in the new pod or service subnet.
+// Interfaces in the current cluster subnets (e.g. the overlay network
+// interfaces) are not considered
+func checkInterfaces(ifaces []storage.NetworkInterface, state storage.ReconfigureNetworkOperationState) error {
+	for _, iface := range ifaces {
+		for _, addr := range iface.Addrs() {
+			if inSubnets(addr, state.PrevSubnets.Overlay, state.PrevSubnets.Service) {
+				continue
+			}
+			err := utils.CheckAddrNotInSubnets(addr, state.Subnets.Overlay, state.Subnets.Service)
+			if err != nil {
+				return trace.Wrap(err, "interface %v", iface.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// inSubnets returns true if the specified address belongs to any of
+// the provided (possibly dual-stack) subnets
+func inSubnets(addr string, cidrs ...string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		for _, block := range utils.SplitCIDRs(cidr) {
+			_, ipNet, err := net.ParseCIDR(block)
+			if err == nil && ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseSubnets parses the specified (possibly dual-stack) comma-separated
+// list of CIDR ranges
+func parseSubnets(cidrs string) (subnets []*net.IPNet, err error) {
+	for _, cidr := range utils.SplitCIDRs(cidrs) {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// subnetsContain returns true if any of the provided subnets contains ip
+func subnetsContain(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewValidateAddr returns a new executor that verifies that the new
+// advertise address is assigned to the reconfigured node
+func NewValidateAddr(params libfsm.ExecutorParams, state storage.ReconfigureNodeOperationState, remote libfsm.Remote) (*validateAddrExecutor, error) {
+	if params.Phase.Data == nil || params.Phase.Data.Server == nil {
+		return nil, trace.NotFound("no server specified for phase %q", params.Phase.ID)
+	}
+	return &validateAddrExecutor{
+		FieldLogger: log.WithFields(log.Fields{
+			trace.Component: "reconfigure:validate",
+			"phase":         params.Phase.ID,
+		}),
+		server: *params.Phase.Data.Server,
+		state:  state,
+		remote: remote,
+	}, nil
+}
+
+// Execute makes sure one of the node's network interfaces
+// has the new advertise address
+func (r *validateAddrExecutor) Execute(ctx context.Context) error {
+	err := systeminfo.HasInterface(r.state.AdvertiseAddr)
+	if err != nil {
+		return trace.Wrap(err, "assign address %v to node %v before changing its advertise address",
+			r.state.AdvertiseAddr, r.server.Hostname)
+	}
+	return nil
+}
+
+// PreCheck makes sure the phase is executed on the correct node
+func (r *validateAddrExecutor) PreCheck(ctx context.Context) error {
+	return trace.Wrap(r.remote.CheckServer(ctx, r.server))
+}
+
+// PostCheck is a no-op
+func (r *validateAddrExecutor) PostCheck(context.Context) error {
+	return nil
+}
+
+// Rollback is a no-op
+func (r *validateAddrExecutor) Rollback(context.Context) error {
+	return nil
+}
+
+type validateAddrExecutor struct {
+	// FieldLogger is the logger the executor uses
+	log.FieldLogger
+	server storage.Server
+	state  storage.ReconfigureNodeOperationState
+	remote libfsm.Remote
+}
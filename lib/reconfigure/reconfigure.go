@@ -0,0 +1,334 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconfigure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	libpack "github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/reconfigure/internal/fsm"
+	"github.com/gravitational/gravity/lib/rpc"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// New returns a new reconfigurer for the specified configuration
+func New(config Config) (*Reconfigurer, error) {
+	if err := config.checkAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return &Reconfigurer{
+		Config: config,
+	}, nil
+}
+
+// Run runs the network, node or Docker reconfiguration.
+// If the network or node reconfiguration fails, all started phases are rolled back.
+// The failed Docker reconfiguration is left to be resumed
+func (r *Reconfigurer) Run(ctx context.Context, force bool) error {
+	machine, err := r.init()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	errCh := make(chan error, 1)
+	updateCh := make(chan ops.ProgressEntry)
+	go func() {
+		errCh <- r.executePlan(ctx, machine, force)
+	}()
+	go pollProgress(ctx, updateCh, r.Operation.Key(), r.Operator)
+
+L:
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case progress := <-updateCh:
+			r.Emitter.PrintStep(progress.Message)
+		case err = <-errCh:
+			break L
+		}
+	}
+
+	return trace.Wrap(err)
+}
+
+// RunPhase runs the specified reconfiguration phase.
+func (r *Reconfigurer) RunPhase(ctx context.Context, phase string, phaseTimeout time.Duration, force bool) error {
+	if phase == libfsm.RootPhase {
+		return trace.Wrap(r.Run(ctx, force))
+	}
+
+	machine, err := r.init()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, phaseTimeout)
+	defer cancel()
+
+	progress := utils.NewProgress(ctx, fmt.Sprintf("Executing phase %q", phase), -1, false)
+	defer progress.Stop()
+
+	return trace.Wrap(machine.ExecutePhase(ctx, libfsm.Params{
+		PhaseID:  phase,
+		Progress: progress,
+		Force:    force,
+	}))
+}
+
+// RollbackPhase rolls back the specified reconfiguration phase.
+func (r *Reconfigurer) RollbackPhase(ctx context.Context, phase string, phaseTimeout time.Duration, force bool) error {
+	machine, err := r.init()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, phaseTimeout)
+	defer cancel()
+
+	progress := utils.NewProgress(ctx, fmt.Sprintf("Rolling back phase %q", phase), -1, false)
+	defer progress.Stop()
+
+	return trace.Wrap(machine.RollbackPhase(ctx, libfsm.Params{
+		PhaseID:  phase,
+		Progress: progress,
+		Force:    force,
+	}))
+}
+
+// Create creates the reconfiguration operation plan but does not start it.
+func (r *Reconfigurer) Create(ctx context.Context) error {
+	_, err := r.init()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return nil
+}
+
+func (r *Reconfigurer) init() (*libfsm.FSM, error) {
+	_, err := r.getOrCreateOperationPlan()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	machine, err := fsm.New(fsm.Config{
+		Operation:     r.Operation,
+		Operator:      r.Operator,
+		Packages:      r.Packages,
+		LocalPackages: r.LocalPackages,
+		Client:        r.Client,
+		Runner:        r.Runner,
+		FieldLogger: log.WithFields(
+			log.Fields{
+				trace.Component:            "fsm:reconfigure",
+				constants.FieldOperationID: r.Operation.ID,
+			}),
+		Silent:  r.Silent,
+		Emitter: r.Emitter,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return machine, nil
+}
+
+func (r *Reconfigurer) executePlan(ctx context.Context, machine *libfsm.FSM, force bool) error {
+	planErr := machine.ExecutePlan(ctx, nil, force)
+	if libfsm.IsPaused(planErr) {
+		// keep the operation and the agents running until it is resumed
+		r.Infof("%v.", planErr)
+		return trace.Wrap(planErr)
+	}
+	rolledBack := false
+	if planErr != nil {
+		r.Warnf("Failed to execute plan: %v.", trace.DebugReport(planErr))
+		if r.Operation.Type == ops.OperationReconfigureDocker {
+			// The storage driver migration phases can be repeated,
+			// so the operation is resumed rather than rolled back
+			// which would restart the runtime on the node once again
+			summary := fmt.Sprintf("%v failed: %v; fix the problem and resume the operation "+
+				"with 'gravity reconfigure docker --resume' or roll back the completed phases manually",
+				operationKind(*r.Operation), trace.UserMessage(planErr))
+			r.Emitter.PrintStep(summary)
+			planErr = trace.Errorf("%v", summary)
+		} else {
+			rolledBack, planErr = r.rollback(ctx, machine, planErr)
+		}
+	}
+
+	err := machine.Complete(planErr)
+	if err == nil {
+		err = planErr
+	}
+
+	var addrs []string
+	for _, server := range r.Servers {
+		addrs = append(addrs, server.AdvertiseIP)
+	}
+
+	// Keep the agents running as long as the operation can be resumed
+	// or rolled back manually
+	if planErr == nil || rolledBack {
+		if errShutdown := rpc.ShutdownAgents(ctx, addrs, r.FieldLogger, r.Runner); errShutdown != nil {
+			r.Warnf("Failed to shutdown agents: %v.", trace.DebugReport(errShutdown))
+		}
+	}
+	return trace.Wrap(err)
+}
+
+// rollback rolls back all started phases of the failed operation so the
+// cluster returns to the previous configuration.
+// It returns whether the rollback has succeeded and the error
+// to complete the operation with
+func (r *Reconfigurer) rollback(ctx context.Context, machine *libfsm.FSM, planErr error) (bool, error) {
+	kind := operationKind(*r.Operation)
+	r.Emitter.PrintStep("Rolling back the failed %v", kind)
+	rolledBack, err := machine.RollbackPlan(ctx, utils.NewNopProgress(), false)
+	summary := rollbackSummary(kind, planErr, rolledBack, err)
+	r.Info(summary)
+	r.Emitter.PrintStep(summary)
+	return err == nil, trace.Errorf("%v", summary)
+}
+
+// rollbackSummary returns a summary of the automatic rollback
+// of the operation of the specified kind
+func rollbackSummary(kind string, planErr error, rolledBack []string, rollbackErr error) string {
+	if rollbackErr != nil {
+		return fmt.Sprintf("%v failed: %v; automatic rollback failed after rolling back "+
+			"%v phase(s): %v, roll back the remaining phases manually",
+			kind, trace.UserMessage(planErr), len(rolledBack), trace.UserMessage(rollbackErr))
+	}
+	if len(rolledBack) == 0 {
+		return fmt.Sprintf("%v failed: %v; no phases needed to be rolled back",
+			kind, trace.UserMessage(planErr))
+	}
+	return fmt.Sprintf("%v failed: %v; rolled back %v phase(s): %v",
+		kind, trace.UserMessage(planErr), len(rolledBack), strings.Join(rolledBack, ", "))
+}
+
+// operationKind returns the human-readable kind of the specified
+// reconfiguration operation
+func operationKind(operation ops.SiteOperation) string {
+	switch operation.Type {
+	case ops.OperationReconfigureNode:
+		return "node reconfiguration"
+	case ops.OperationReconfigureDocker:
+		return "Docker storage driver migration"
+	}
+	return "network reconfiguration"
+}
+
+func (r *Config) checkAndSetDefaults() error {
+	if r.Operation == nil {
+		return trace.BadParameter("operation is required")
+	}
+	if r.Packages == nil {
+		return trace.BadParameter("package service is required")
+	}
+	if r.LocalPackages == nil {
+		return trace.BadParameter("local package service is required")
+	}
+	if r.Operator == nil {
+		return trace.BadParameter("cluster operator service is required")
+	}
+	if len(r.Servers) == 0 {
+		return trace.BadParameter("at least a single server is required")
+	}
+	if r.FieldLogger == nil {
+		r.FieldLogger = log.WithField(trace.Component, "reconfigure")
+	}
+	if r.Emitter == nil {
+		r.Emitter = utils.NopEmitter()
+	}
+	return nil
+}
+
+// Config describes configuration of the network, node or Docker reconfiguration
+type Config struct {
+	// Packages is the cluster package service
+	Packages libpack.PackageService
+	// LocalPackages is the service for packages local to the node
+	LocalPackages libpack.PackageService
+	// Operator is the cluster operator service
+	Operator ops.Operator
+	// Operation references the network, node or Docker reconfiguration operation
+	Operation *ops.SiteOperation
+	// Servers is the list of cluster servers
+	Servers []storage.Server
+	// Client is the optional Kubernetes client.
+	// It is only required when executing phases on master nodes
+	Client *kubernetes.Clientset
+	// Runner specifies the runner for remote commands
+	Runner libfsm.AgentRepository
+	// FieldLogger is the logger to use
+	log.FieldLogger
+	// Silent controls whether the process outputs messages to stdout
+	localenv.Silent
+	// Emitter outputs progress messages to stdout
+	utils.Emitter
+}
+
+// Reconfigurer executes the network, node or Docker reconfiguration operation
+type Reconfigurer struct {
+	// Config is the reconfigurer's configuration
+	Config
+}
+
+func pollProgress(ctx context.Context, updateCh chan<- ops.ProgressEntry, opKey ops.SiteOperationKey, operator ops.Operator) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	var lastProgress *ops.ProgressEntry
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			progress, err := operator.GetSiteOperationProgress(opKey)
+			if err != nil {
+				log.Warnf("Failed to query operation progress: %v.",
+					trace.DebugReport(err))
+				continue
+			}
+			if lastProgress == nil || !lastProgress.IsEqual(*progress) {
+				select {
+				case <-ctx.Done():
+					return
+				case updateCh <- *progress:
+				}
+			}
+			if progress.IsCompleted() {
+				return
+			}
+			lastProgress = progress
+		}
+	}
+}
@@ -175,8 +175,7 @@ func NewDeployServer(node storage.Server) DeployServer {
 		Role:        schema.ServiceRole(node.ClusterRole),
 		Hostname:    node.Hostname,
 		AdvertiseIP: node.AdvertiseIP,
-		NodeAddr: fmt.Sprintf("%v:%v", node.AdvertiseIP,
-			teledefaults.SSHServerListenPort),
+		NodeAddr:    utils.JoinHostPort(node.AdvertiseIP, teledefaults.SSHServerListenPort),
 	}
 }
 
@@ -21,6 +21,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"path/filepath"
 	"strconv"
 	"time"
@@ -253,7 +254,7 @@ func Credentials(secretsDir string) (server credentials.TransportCredentials, cl
 // otherwise, a default RPC agent port is added
 func AgentAddr(addr string) string {
 	host, port := utils.SplitHostPort(addr, strconv.Itoa(defaults.GravityRPCAgentPort))
-	return fmt.Sprintf("%v:%v", host, port)
+	return net.JoinHostPort(host, port)
 }
 
 // createPackage creates the secrets package pkg from archive in packages.
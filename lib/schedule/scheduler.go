@@ -0,0 +1,312 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schedule implements the scheduler that starts cluster operations
+// in their maintenance windows
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/sirupsen/logrus"
+)
+
+// Runner executes gravity commands on cluster nodes
+type Runner interface {
+	// RunOnMaster executes the gravity command with the specified arguments
+	// on one of the cluster master nodes and returns its output
+	RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error)
+	// RunOnNodes executes the gravity command with the specified arguments
+	// on all cluster nodes
+	RunOnNodes(key ops.SiteKey, args ...string) error
+}
+
+// Config defines the scheduler configuration
+type Config struct {
+	// Backend stores the scheduled operations
+	Backend storage.Schedules
+	// Operator is the cluster operator service
+	Operator ops.Operator
+	// Runner executes gravity commands on cluster nodes
+	Runner Runner
+	// Cluster identifies the local cluster
+	Cluster ops.SiteKey
+	// Interval is how often the schedules are checked
+	Interval time.Duration
+	// Clock is used to check maintenance windows, can be overridden in tests
+	Clock clockwork.Clock
+	// FieldLogger is used for logging
+	logrus.FieldLogger
+}
+
+func (c *Config) checkAndSetDefaults() error {
+	if c.Backend == nil {
+		return trace.BadParameter("missing Backend")
+	}
+	if c.Operator == nil {
+		return trace.BadParameter("missing Operator")
+	}
+	if c.Runner == nil {
+		return trace.BadParameter("missing Runner")
+	}
+	if c.Cluster.SiteDomain == "" {
+		return trace.BadParameter("missing Cluster")
+	}
+	if c.Interval == 0 {
+		c.Interval = defaults.ScheduleCheckInterval
+	}
+	if c.Clock == nil {
+		c.Clock = clockwork.NewRealClock()
+	}
+	if c.FieldLogger == nil {
+		c.FieldLogger = logrus.WithField(trace.Component, "scheduler")
+	}
+	return nil
+}
+
+// Scheduler starts scheduled operations once their maintenance windows open
+// and resumes operations paused when a window closed
+type Scheduler struct {
+	Config
+	// mu guards executing
+	mu sync.Mutex
+	// executing is the set of schedules with commands currently executing
+	executing map[string]struct{}
+	// wg tracks executing commands
+	wg sync.WaitGroup
+}
+
+// New returns a new scheduler
+func New(config Config) (*Scheduler, error) {
+	if err := config.checkAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Scheduler{
+		Config:    config,
+		executing: make(map[string]struct{}),
+	}, nil
+}
+
+// Run checks the schedules periodically until the context is canceled
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.Info("Starting scheduler.")
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Check(); err != nil {
+				s.Errorf("Failed to check schedules: %v.", trace.DebugReport(err))
+			}
+		case <-ctx.Done():
+			s.Info("Stopping scheduler.")
+			return nil
+		}
+	}
+}
+
+// Wait blocks until all executing commands have finished
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Check starts or resumes the operations whose maintenance windows are
+// open and updates the state of the started operations
+func (s *Scheduler) Check() error {
+	schedules, err := s.Backend.GetSchedules(s.Cluster.SiteDomain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, schedule := range schedules {
+		if !schedule.IsActive() || s.isExecuting(schedule.ID) {
+			continue
+		}
+		if err := s.check(schedule); err != nil {
+			s.WithField("schedule", schedule.ID).Warnf("Failed to check schedule: %v.",
+				trace.DebugReport(err))
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) check(schedule storage.Schedule) error {
+	if schedule.OperationID != "" {
+		done, err := s.syncOperationState(&schedule)
+		if err != nil || done {
+			return trace.Wrap(err)
+		}
+	}
+	if !schedule.Window.IsOpen(s.Clock.Now()) {
+		return nil
+	}
+	switch schedule.State {
+	case storage.ScheduleStatePending:
+		return trace.Wrap(s.start(schedule))
+	case storage.ScheduleStatePaused:
+		return trace.Wrap(s.resume(schedule))
+	}
+	// running schedules are either executing or have been started by
+	// another scheduler process and are updated once the operation finishes
+	return nil
+}
+
+// start creates the scheduled operation and starts executing it
+func (s *Scheduler) start(schedule storage.Schedule) error {
+	s.WithField("schedule", schedule.ID).Infof("Starting scheduled %v operation.", schedule.Operation)
+	if schedule.Operation == storage.ScheduledRotateCertificates {
+		return trace.Wrap(s.execute(schedule, func() error {
+			// regular nodes do not have the certificate authority package
+			// and read it from the cluster package service
+			return s.Runner.RunOnNodes(s.Cluster, "system", "rotate-certs", s.Cluster.SiteDomain)
+		}))
+	}
+	args := []string{"gc", "--manual", "--confirm", "--quiet"}
+	if schedule.Operation == storage.ScheduledUpdate {
+		args = []string{"upgrade", schedule.App, "--manual", "--quiet"}
+	}
+	out, err := s.Runner.RunOnMaster(s.Cluster, args...)
+	if err != nil {
+		return trace.Wrap(s.update(schedule, storage.ScheduleStateFailed,
+			"failed to create operation: %v", trace.UserMessage(err)))
+	}
+	schedule.OperationID = utils.LastLine(out)
+	if schedule.OperationID == "" {
+		return trace.Wrap(s.update(schedule, storage.ScheduleStateFailed,
+			"failed to create operation: no operation ID in output"))
+	}
+	return trace.Wrap(s.resume(schedule))
+}
+
+// resume executes the plan of the scheduled operation from the first
+// incomplete phase
+func (s *Scheduler) resume(schedule storage.Schedule) error {
+	args := []string{"gc", "--resume"}
+	if schedule.Operation == storage.ScheduledUpdate {
+		args = []string{"upgrade", "--resume"}
+	}
+	return trace.Wrap(s.execute(schedule, func() error {
+		_, err := s.Runner.RunOnMaster(s.Cluster, args...)
+		return trace.Wrap(err)
+	}))
+}
+
+// execute marks the schedule as running and invokes fn in the background
+func (s *Scheduler) execute(schedule storage.Schedule, fn func() error) error {
+	if err := s.update(schedule, storage.ScheduleStateRunning, "operation is running"); err != nil {
+		return trace.Wrap(err)
+	}
+	s.setExecuting(schedule.ID, true)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.setExecuting(schedule.ID, false)
+		err := fn()
+		if err := s.finish(schedule.ID, err); err != nil {
+			s.WithField("schedule", schedule.ID).Warnf("Failed to update schedule: %v.",
+				trace.DebugReport(err))
+		}
+	}()
+	return nil
+}
+
+// finish updates the schedule after the executed command has returned
+func (s *Scheduler) finish(id string, execErr error) error {
+	schedule, err := s.Backend.GetSchedule(s.Cluster.SiteDomain, id)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if schedule.OperationID == "" {
+		if execErr != nil {
+			return trace.Wrap(s.update(*schedule, storage.ScheduleStateFailed, "%v", trace.UserMessage(execErr)))
+		}
+		return trace.Wrap(s.update(*schedule, storage.ScheduleStateCompleted, "operation has completed"))
+	}
+	done, err := s.syncOperationState(schedule)
+	if err != nil || done {
+		return trace.Wrap(err)
+	}
+	// the operation is still active: plan execution has either been paused
+	// because the window closed or stopped on an error and can be resumed
+	message := "operation has been paused"
+	if execErr != nil {
+		message = trace.UserMessage(execErr)
+	}
+	return trace.Wrap(s.update(*schedule, storage.ScheduleStatePaused, "%v", message))
+}
+
+// syncOperationState updates the schedule if the operation it has started
+// has finished and returns true in this case
+func (s *Scheduler) syncOperationState(schedule *storage.Schedule) (done bool, err error) {
+	operation, err := s.Operator.GetSiteOperation(ops.SiteOperationKey{
+		AccountID:   s.Cluster.AccountID,
+		SiteDomain:  s.Cluster.SiteDomain,
+		OperationID: schedule.OperationID,
+	})
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return true, trace.Wrap(s.update(*schedule, storage.ScheduleStateFailed,
+				"operation %v not found", schedule.OperationID))
+		}
+		return false, trace.Wrap(err)
+	}
+	switch {
+	case operation.IsCompleted():
+		return true, trace.Wrap(s.update(*schedule, storage.ScheduleStateCompleted, "operation has completed"))
+	case operation.IsFailed():
+		return true, trace.Wrap(s.update(*schedule, storage.ScheduleStateFailed, "operation has failed"))
+	}
+	return false, nil
+}
+
+func (s *Scheduler) update(schedule storage.Schedule, state, format string, args ...interface{}) error {
+	schedule.State = state
+	schedule.Message = strings.TrimSpace(fmt.Sprintf(format, args...))
+	schedule.Updated = s.Clock.Now().UTC()
+	_, err := s.Backend.UpdateSchedule(schedule)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	s.WithField("schedule", schedule.ID).Infof("Schedule is %v: %v.", state, schedule.Message)
+	return nil
+}
+
+func (s *Scheduler) isExecuting(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.executing[id]
+	return ok
+}
+
+func (s *Scheduler) setExecuting(id string, executing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if executing {
+		s.executing[id] = struct{}{}
+	} else {
+		delete(s.executing, id)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/storage/keyval"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	. "gopkg.in/check.v1"
+)
+
+func TestScheduler(t *testing.T) { TestingT(t) }
+
+type SchedulerSuite struct {
+	backend  storage.Backend
+	clock    clockwork.FakeClock
+	operator *testOperator
+	runner   *testRunner
+	cluster  ops.SiteKey
+}
+
+var _ = Suite(&SchedulerSuite{})
+
+func (s *SchedulerSuite) SetUpTest(c *C) {
+	var err error
+	s.backend, err = keyval.NewBolt(keyval.BoltConfig{Path: filepath.Join(c.MkDir(), "bolt.db")})
+	c.Assert(err, IsNil)
+	s.cluster = ops.SiteKey{AccountID: defaults.SystemAccountID, SiteDomain: "example.com"}
+	_, err = s.backend.CreateSite(storage.Site{
+		AccountID: s.cluster.AccountID,
+		Domain:    s.cluster.SiteDomain,
+		Created:   time.Now(),
+	})
+	c.Assert(err, IsNil)
+	// Saturday
+	s.clock = clockwork.NewFakeClockAt(time.Date(2018, 6, 2, 1, 0, 0, 0, time.UTC))
+	s.operator = &testOperator{operations: make(map[string]string)}
+	s.runner = &testRunner{operator: s.operator}
+}
+
+func (s *SchedulerSuite) TearDownTest(c *C) {
+	c.Assert(s.backend.Close(), IsNil)
+}
+
+func (s *SchedulerSuite) TestStartsAndResumesOperationInWindow(c *C) {
+	scheduler := s.newScheduler(c)
+	schedule := s.createSchedule(c, storage.ScheduledUpdate)
+
+	// window is closed
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	c.Assert(s.runner.getCommands(), HasLen, 0)
+	s.assertState(c, schedule.ID, storage.ScheduleStatePending)
+
+	// window opens, operation is created and started, the plan is paused
+	// when the window closes
+	s.clock.Advance(2 * time.Hour)
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	c.Assert(s.runner.getCommands(), DeepEquals, []string{
+		"upgrade gravitational.io/app:2.0.0 --manual --quiet",
+		"upgrade --resume",
+	})
+	out := s.assertState(c, schedule.ID, storage.ScheduleStatePaused)
+	c.Assert(out.OperationID, Equals, "op1")
+
+	// window opens on the next day and the operation is resumed
+	s.clock.Advance(24 * time.Hour)
+	s.runner.complete = true
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	c.Assert(s.runner.getCommands(), HasLen, 3)
+	s.assertState(c, schedule.ID, storage.ScheduleStateCompleted)
+
+	// completed schedules are not started again
+	s.clock.Advance(7 * 24 * time.Hour)
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	c.Assert(s.runner.getCommands(), HasLen, 3)
+}
+
+func (s *SchedulerSuite) TestRotatesCertificatesOnAllNodes(c *C) {
+	scheduler := s.newScheduler(c)
+	schedule := s.createSchedule(c, storage.ScheduledRotateCertificates)
+	s.clock.Advance(2 * time.Hour)
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	c.Assert(s.runner.getCommands(), DeepEquals, []string{"nodes: system rotate-certs example.com"})
+	s.assertState(c, schedule.ID, storage.ScheduleStateCompleted)
+}
+
+func (s *SchedulerSuite) TestFailsScheduleIfOperationCannotBeCreated(c *C) {
+	scheduler := s.newScheduler(c)
+	schedule := s.createSchedule(c, storage.ScheduledGarbageCollect)
+	s.runner.err = trace.BadParameter("another operation is in progress")
+	s.clock.Advance(2 * time.Hour)
+	c.Assert(scheduler.Check(), IsNil)
+	scheduler.Wait()
+	out := s.assertState(c, schedule.ID, storage.ScheduleStateFailed)
+	c.Assert(out.Message, Equals, "failed to create operation: another operation is in progress")
+}
+
+func (s *SchedulerSuite) TestMaintenanceWindowGate(c *C) {
+	schedule := s.createSchedule(c, storage.ScheduledGarbageCollect)
+	schedule.OperationID = "op1"
+	_, err := s.backend.UpdateSchedule(*schedule)
+	c.Assert(err, IsNil)
+	s.operator.backend = s.backend
+
+	key := ops.SiteOperationKey{SiteDomain: s.cluster.SiteDomain, OperationID: "op1"}
+	err = ops.CheckMaintenanceWindow(key, s.operator, s.clock.Now())
+	c.Assert(trace.IsLimitExceeded(err), Equals, true)
+	err = ops.CheckMaintenanceWindow(key, s.operator, s.clock.Now().Add(2*time.Hour))
+	c.Assert(err, IsNil)
+	// operations not started by a schedule are not restricted
+	key.OperationID = "op2"
+	err = ops.CheckMaintenanceWindow(key, s.operator, s.clock.Now())
+	c.Assert(err, IsNil)
+}
+
+func (s *SchedulerSuite) newScheduler(c *C) *Scheduler {
+	scheduler, err := New(Config{
+		Backend:  s.backend,
+		Operator: s.operator,
+		Runner:   s.runner,
+		Cluster:  s.cluster,
+		Clock:    s.clock,
+	})
+	c.Assert(err, IsNil)
+	return scheduler
+}
+
+func (s *SchedulerSuite) createSchedule(c *C, operation string) *storage.Schedule {
+	schedule := storage.Schedule{
+		ClusterName: s.cluster.SiteDomain,
+		Operation:   operation,
+		Window: storage.MaintenanceWindow{
+			Days:     []string{"sat", "sun"},
+			Start:    "02:00",
+			Duration: 2 * time.Hour,
+		},
+		State: storage.ScheduleStatePending,
+	}
+	if operation == storage.ScheduledUpdate {
+		schedule.App = "gravitational.io/app:2.0.0"
+	}
+	out, err := s.backend.CreateSchedule(schedule)
+	c.Assert(err, IsNil)
+	return out
+}
+
+func (s *SchedulerSuite) assertState(c *C, id, state string) *storage.Schedule {
+	schedule, err := s.backend.GetSchedule(s.cluster.SiteDomain, id)
+	c.Assert(err, IsNil)
+	c.Assert(schedule.State, Equals, state, Commentf("message: %v", schedule.Message))
+	return schedule
+}
+
+// testRunner records executed commands and emulates the operation lifecycle
+type testRunner struct {
+	sync.Mutex
+	operator *testOperator
+	commands []string
+	// complete makes the resumed operation complete, otherwise the plan
+	// execution is paused
+	complete bool
+	// err is returned from all commands if set
+	err error
+}
+
+func (r *testRunner) RunOnMaster(key ops.SiteKey, args ...string) ([]byte, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.commands = append(r.commands, strings.Join(args, " "))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if args[len(args)-1] == "--quiet" {
+		r.operator.setState("op1", ops.OperationStateReady)
+		return []byte("op1"), nil
+	}
+	if r.complete {
+		r.operator.setState("op1", ops.OperationStateCompleted)
+		return nil, nil
+	}
+	return nil, trace.LimitExceeded("maintenance window is closed")
+}
+
+func (r *testRunner) RunOnNodes(key ops.SiteKey, args ...string) error {
+	r.Lock()
+	defer r.Unlock()
+	r.commands = append(r.commands, "nodes: "+strings.Join(args, " "))
+	return r.err
+}
+
+func (r *testRunner) getCommands() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string{}, r.commands...)
+}
+
+// testOperator returns operations with states set by the test runner
+type testOperator struct {
+	ops.Operator
+	sync.Mutex
+	backend    storage.Backend
+	operations map[string]string
+}
+
+func (o *testOperator) setState(id, state string) {
+	o.Lock()
+	defer o.Unlock()
+	o.operations[id] = state
+}
+
+func (o *testOperator) GetSiteOperation(key ops.SiteOperationKey) (*ops.SiteOperation, error) {
+	o.Lock()
+	defer o.Unlock()
+	state, ok := o.operations[key.OperationID]
+	if !ok {
+		return nil, trace.NotFound("operation %v not found", key.OperationID)
+	}
+	return &ops.SiteOperation{ID: key.OperationID, State: state}, nil
+}
+
+func (o *testOperator) GetSchedules(key ops.SiteKey) ([]storage.Schedule, error) {
+	return o.backend.GetSchedules(key.SiteDomain)
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -125,6 +126,21 @@ func (m Manifest) FindFlavor(name string) *Flavor {
 	return nil
 }
 
+// DefaultFlavor returns the name of the flavor installed when none has
+// been explicitly selected: the default flavor if set, or the first one
+func (m Manifest) DefaultFlavor() string {
+	if m.Installer == nil {
+		return ""
+	}
+	if m.Installer.Flavors.Default != "" {
+		return m.Installer.Flavors.Default
+	}
+	if len(m.Installer.Flavors.Items) != 0 {
+		return m.Installer.Flavors.Items[0].Name
+	}
+	return ""
+}
+
 // FlavorNames returns a list of all defined flavors
 func (m Manifest) FlavorNames() []string {
 	var names []string
@@ -561,6 +577,10 @@ type Requirements struct {
 	Volumes []Volume `json:"volumes,omitempty"`
 	// Devices describes devices that should be created inside container
 	Devices []Device `json:"devices,omitempty"`
+	// BlockDevices describes block devices to provision on the server
+	BlockDevices []BlockDevice `json:"blockDevices,omitempty"`
+	// VolumeGroups describes LVM volume groups to create from the block devices
+	VolumeGroups []VolumeGroup `json:"volumeGroups,omitempty"`
 	// CustomChecks lists additional preflight checks as inline scripts
 	CustomChecks []CustomCheck `json:"customChecks,omitempty"`
 }
@@ -640,6 +660,171 @@ type CustomCheck struct {
 	Script string `json:"script,omitempty"`
 }
 
+// BlockDevice describes a block device that is provisioned on the server.
+//
+// The device is either formatted and mounted, or added to an LVM volume group
+type BlockDevice struct {
+	// Name is the device short name for referencing
+	Name string `json:"name"`
+	// Capacity is the minimum required device capacity
+	Capacity utils.Capacity `json:"capacity,omitempty"`
+	// VolumeGroup is the name of the volume group to add the device to
+	VolumeGroup string `json:"volumeGroup,omitempty"`
+	// Filesystem defines the filesystem to create on the device
+	Filesystem *Filesystem `json:"filesystem,omitempty"`
+}
+
+// Check makes sure the block device is valid
+func (d BlockDevice) Check() error {
+	if d.Name == "" {
+		return trace.BadParameter("block device name cannot be empty")
+	}
+	if (d.VolumeGroup == "") == (d.Filesystem == nil) {
+		return trace.BadParameter("block device %q should specify either "+
+			"a volume group or a filesystem", d.Name)
+	}
+	if d.Filesystem != nil {
+		return trace.Wrap(d.Filesystem.Check(), "block device %q", d.Name)
+	}
+	return nil
+}
+
+// VolumeGroup describes an LVM volume group created from block devices
+type VolumeGroup struct {
+	// Name is the volume group name
+	Name string `json:"name"`
+	// ThinPool optionally defines a thin pool to create in the volume group
+	ThinPool *ThinPool `json:"thinPool,omitempty"`
+	// LogicalVolumes lists logical volumes to create in the volume group.
+	// If the group has a thin pool, the volumes are created as thin volumes
+	LogicalVolumes []LogicalVolume `json:"logicalVolumes,omitempty"`
+}
+
+// Check makes sure the volume group is valid
+func (g VolumeGroup) Check() error {
+	if g.Name == "" {
+		return trace.BadParameter("volume group name cannot be empty")
+	}
+	if g.ThinPool != nil && g.ThinPool.Name == "" {
+		return trace.BadParameter("thin pool name in volume group %q cannot be empty", g.Name)
+	}
+	for _, volume := range g.LogicalVolumes {
+		if volume.Name == "" {
+			return trace.BadParameter("logical volume name in volume group %q "+
+				"cannot be empty", g.Name)
+		}
+		if volume.Size == 0 {
+			return trace.BadParameter("logical volume %v/%v should specify size",
+				g.Name, volume.Name)
+		}
+		if err := volume.Filesystem.Check(); err != nil {
+			return trace.Wrap(err, "logical volume %v/%v", g.Name, volume.Name)
+		}
+	}
+	return nil
+}
+
+// ThinPool describes an LVM thin pool
+type ThinPool struct {
+	// Name is the thin pool name
+	Name string `json:"name"`
+	// Extents is the size of the thin pool in LVM extents, e.g. "95%VG"
+	Extents string `json:"extents,omitempty"`
+}
+
+// LogicalVolume describes an LVM logical volume
+type LogicalVolume struct {
+	// Name is the logical volume name
+	Name string `json:"name"`
+	// Size is the logical volume size
+	Size utils.Capacity `json:"size"`
+	// Filesystem defines the filesystem to create on the volume
+	Filesystem Filesystem `json:"filesystem"`
+}
+
+// Filesystem describes a filesystem created on a provisioned device
+type Filesystem struct {
+	// Type is the filesystem type, "ext4" or "xfs"
+	Type string `json:"type,omitempty"`
+	// Path is the directory to mount the filesystem at
+	Path string `json:"path"`
+	// UID sets the owner of the mount directory, defaults to the service user
+	UID *int `json:"uid,omitempty"`
+	// GID sets the group of the mount directory, defaults to the service group
+	GID *int `json:"gid,omitempty"`
+	// Mode sets file mode for the mount directory, accepts octal format
+	Mode string `json:"mode,omitempty"`
+	// PersistentVolume optionally exposes the filesystem as a local
+	// Kubernetes persistent volume
+	PersistentVolume *PersistentVolume `json:"persistentVolume,omitempty"`
+}
+
+// Check makes sure the filesystem is valid
+func (f Filesystem) Check() error {
+	if f.Type != "" && !utils.StringInSlice(constants.SupportedFilesystems, f.Type) {
+		return trace.BadParameter("unsupported filesystem %q, supported are: %v",
+			f.Type, constants.SupportedFilesystems)
+	}
+	if !filepath.IsAbs(f.Path) {
+		return trace.BadParameter("filesystem mount path %q should be absolute", f.Path)
+	}
+	if f.Mode != "" {
+		if _, err := strconv.ParseInt(f.Mode, 8, 32); err != nil {
+			return trace.BadParameter("invalid file mode %q for %v: "+
+				`must be an octal number, e.g. "0755"`, f.Mode, f.Path)
+		}
+	}
+	return nil
+}
+
+// FilesystemType returns the filesystem type, "ext4" by default
+func (f Filesystem) FilesystemType() string {
+	if f.Type != "" {
+		return f.Type
+	}
+	return constants.FilesystemExt4
+}
+
+// PersistentVolume describes a local persistent volume
+type PersistentVolume struct {
+	// StorageClass is the name of the storage class of the volume
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// Filesystems returns all filesystems provisioned for the node profile
+// with the names of the block devices or volume group/logical volume
+// they are created on
+func (r Requirements) Filesystems() map[string]Filesystem {
+	filesystems := make(map[string]Filesystem)
+	for _, device := range r.BlockDevices {
+		if device.Filesystem != nil {
+			filesystems[device.Name] = *device.Filesystem
+		}
+	}
+	for _, group := range r.VolumeGroups {
+		for _, volume := range group.LogicalVolumes {
+			filesystems[fmt.Sprintf("%v/%v", group.Name, volume.Name)] = volume.Filesystem
+		}
+	}
+	return filesystems
+}
+
+// HasBlockDevices returns true if the node profile has block devices to provision
+func (r Requirements) HasBlockDevices() bool {
+	return len(r.BlockDevices) != 0
+}
+
+// HasPersistentVolumes returns true if any of the filesystems of the node
+// profile is exposed as a local persistent volume
+func (r Requirements) HasPersistentVolumes() bool {
+	for _, filesystem := range r.Filesystems() {
+		if filesystem.PersistentVolume != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // DevicesForProfile returns a list of required devices for the specified profile
 func (m Manifest) DevicesForProfile(profileName string) ([]Device, error) {
 	profile, err := m.NodeProfiles.ByName(profileName)
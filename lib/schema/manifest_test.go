@@ -552,6 +552,129 @@ systemOptions:
 	c.Assert(err, NotNil)
 }
 
+func (s *ManifestSuite) TestParsesBlockDevices(c *C) {
+	bytes := []byte(`apiVersion: bundle.gravitational.io/v2
+kind: Bundle
+metadata:
+  name: myapp
+  resourceVersion: 0.0.1
+installer:
+  flavors:
+    items:
+      - name: one
+        nodes:
+          - profile: node
+            count: 1
+nodeProfiles:
+  - name: node
+    requirements:
+      blockDevices:
+      - name: data
+        capacity: 10GB
+        filesystem:
+          type: xfs
+          path: /var/lib/data
+          uid: 1000
+          mode: "0750"
+          persistentVolume:
+            storageClass: fast
+      - name: pool
+        capacity: 50GB
+        volumeGroup: vg0
+      volumeGroups:
+      - name: vg0
+        thinPool:
+          name: thin
+        logicalVolumes:
+        - name: logs
+          size: 20GB
+          filesystem:
+            path: /var/log/app`)
+	m, err := ParseManifestYAML(bytes)
+	c.Assert(err, IsNil)
+	reqs := m.NodeProfiles[0].Requirements
+	c.Assert(reqs.HasBlockDevices(), Equals, true)
+	c.Assert(reqs.HasPersistentVolumes(), Equals, true)
+	c.Assert(reqs.BlockDevices[0].Filesystem.FilesystemType(), Equals, "xfs")
+	c.Assert(*reqs.BlockDevices[0].Filesystem.UID, Equals, 1000)
+	c.Assert(reqs.VolumeGroups[0].ThinPool.Name, Equals, "thin")
+	filesystems := reqs.Filesystems()
+	c.Assert(filesystems["vg0/logs"].Path, Equals, "/var/log/app")
+	c.Assert(filesystems["vg0/logs"].FilesystemType(), Equals, "ext4")
+}
+
+func (s *ManifestSuite) TestInvalidBlockDevices(c *C) {
+	const header = `apiVersion: bundle.gravitational.io/v2
+kind: Bundle
+metadata:
+  name: myapp
+  resourceVersion: 0.0.1
+installer:
+  flavors:
+    items:
+      - name: one
+        nodes:
+          - profile: node
+            count: 1
+nodeProfiles:
+  - name: node
+    requirements:
+`
+	var testCases = []struct {
+		requirements string
+		comment      string
+	}{
+		{
+			requirements: `
+      blockDevices:
+      - name: data
+        capacity: 10GB`,
+			comment: "neither filesystem nor volume group",
+		},
+		{
+			requirements: `
+      blockDevices:
+      - name: data
+        capacity: 10GB
+        volumeGroup: vg0`,
+			comment: "unknown volume group",
+		},
+		{
+			requirements: `
+      blockDevices:
+      - name: data
+        capacity: 10GB
+        filesystem:
+          type: btrfs
+          path: /var/lib/data`,
+			comment: "unsupported filesystem",
+		},
+		{
+			requirements: `
+      blockDevices:
+      - name: data
+        capacity: 10GB
+        filesystem:
+          path: /var/lib/data
+      - name: logs
+        capacity: 10GB
+        filesystem:
+          path: /var/lib/data`,
+			comment: "duplicate mount path",
+		},
+		{
+			requirements: `
+      volumeGroups:
+      - name: vg0`,
+			comment: "volume group without devices",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := ParseManifestYAML([]byte(header + tc.requirements))
+		c.Assert(err, NotNil, Commentf(tc.comment))
+	}
+}
+
 func (s *ManifestSuite) TestCanOverrideBooleans(c *C) {
 	bytes := []byte(`apiVersion: bundle.gravitational.io/v2
 kind: Bundle
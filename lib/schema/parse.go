@@ -298,6 +298,63 @@ func checkRequirements(reqs Requirements) error {
 		errors = append(errors, device.Check())
 	}
 
+	errors = append(errors, checkBlockDevices(reqs))
+
+	return trace.NewAggregate(errors...)
+}
+
+// checkBlockDevices makes sure that block devices and volume groups
+// reference each other correctly and do not share mount paths
+func checkBlockDevices(reqs Requirements) error {
+	var errors []error
+	devices := make(map[string]bool)
+	groups := make(map[string]int)
+	for _, group := range reqs.VolumeGroups {
+		if err := group.Check(); err != nil {
+			errors = append(errors, err)
+		}
+		if _, ok := groups[group.Name]; ok {
+			errors = append(errors, trace.BadParameter(
+				"duplicate volume group %q", group.Name))
+		}
+		groups[group.Name] = 0
+	}
+	for _, device := range reqs.BlockDevices {
+		if err := device.Check(); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if devices[device.Name] {
+			errors = append(errors, trace.BadParameter(
+				"duplicate block device %q", device.Name))
+		}
+		devices[device.Name] = true
+		if device.VolumeGroup == "" {
+			continue
+		}
+		if _, ok := groups[device.VolumeGroup]; !ok {
+			errors = append(errors, trace.BadParameter(
+				"block device %q references unknown volume group %q",
+				device.Name, device.VolumeGroup))
+			continue
+		}
+		groups[device.VolumeGroup]++
+	}
+	for group, count := range groups {
+		if count == 0 {
+			errors = append(errors, trace.BadParameter(
+				"volume group %q has no block devices", group))
+		}
+	}
+	paths := make(map[string]string)
+	for name, filesystem := range reqs.Filesystems() {
+		if other, ok := paths[filesystem.Path]; ok {
+			errors = append(errors, trace.BadParameter(
+				"%v and %v are mounted at the same path %v",
+				other, name, filesystem.Path))
+		}
+		paths[filesystem.Path] = name
+	}
 	return trace.NewAggregate(errors...)
 }
 
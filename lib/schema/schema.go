@@ -262,6 +262,53 @@ const manifestSchema = `
                       }
                     }
                   },
+                  "blockDevices": {
+                    "type": "array",
+                    "items": {
+                      "type": "object",
+                      "required": ["name"],
+                      "additionalProperties": false,
+                      "properties": {
+                        "name": {"type": "string"},
+                        "capacity": {"type": "string"},
+                        "volumeGroup": {"type": "string"},
+                        "filesystem": {"$ref": "#/definitions/filesystem"}
+                      }
+                    }
+                  },
+                  "volumeGroups": {
+                    "type": "array",
+                    "items": {
+                      "type": "object",
+                      "required": ["name"],
+                      "additionalProperties": false,
+                      "properties": {
+                        "name": {"type": "string"},
+                        "thinPool": {
+                          "type": "object",
+                          "required": ["name"],
+                          "additionalProperties": false,
+                          "properties": {
+                            "name": {"type": "string"},
+                            "extents": {"type": "string"}
+                          }
+                        },
+                        "logicalVolumes": {
+                          "type": "array",
+                          "items": {
+                            "type": "object",
+                            "required": ["name", "size", "filesystem"],
+                            "additionalProperties": false,
+                            "properties": {
+                              "name": {"type": "string"},
+                              "size": {"type": "string"},
+                              "filesystem": {"$ref": "#/definitions/filesystem"}
+                            }
+                          }
+                        }
+                      }
+                    }
+                  },
                   "customChecks": {
                     "type": "array",
                     "items": {
@@ -637,6 +684,25 @@ const manifestSchema = `
         "disabled": {"type": "boolean"}
       }
     },
+    "filesystem": {
+      "type": "object",
+      "required": ["path"],
+      "additionalProperties": false,
+      "properties": {
+        "type": {"type": "string", "default": "ext4"},
+        "path": {"type": "string"},
+        "uid": {"type": "number"},
+        "gid": {"type": "number"},
+        "mode": {"type": "string"},
+        "persistentVolume": {
+          "type": "object",
+          "additionalProperties": false,
+          "properties": {
+            "storageClass": {"type": "string"}
+          }
+        }
+      }
+    },
     "systemOptions": {
       "type": "object",
       "additionalProperties": false,
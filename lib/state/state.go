@@ -88,6 +88,11 @@ func GravityUpdateDir(baseDir string) string {
 	return filepath.Join(baseDir, defaults.SiteDir, defaults.UpdateDir)
 }
 
+// GravityEtcdRestoreDir returns full path to the etcd restore directory
+func GravityEtcdRestoreDir(baseDir string) string {
+	return filepath.Join(baseDir, defaults.SiteDir, defaults.EtcdRestoreDir)
+}
+
 // GravityRPCAgentDir returns full path to the RPC agent directory
 func GravityRPCAgentDir(baseDir string) string {
 	return filepath.Join(baseDir, defaults.SiteDir, defaults.UpdateDir, defaults.AgentDir)
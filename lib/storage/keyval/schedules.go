@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyval
+
+import (
+	"sort"
+
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/pborman/uuid"
+)
+
+// CreateSchedule creates a new scheduled operation
+func (b *backend) CreateSchedule(schedule storage.Schedule) (*storage.Schedule, error) {
+	if err := schedule.Check(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if schedule.ID == "" {
+		schedule.ID = uuid.New()
+	}
+	if _, err := b.GetSite(schedule.ClusterName); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err := b.createVal(b.key(sitesP, schedule.ClusterName, schedulesP, schedule.ID), schedule, forever)
+	if err != nil {
+		if trace.IsAlreadyExists(err) {
+			return nil, trace.AlreadyExists("schedule %v already exists", schedule.ID)
+		}
+		return nil, trace.Wrap(err)
+	}
+	return &schedule, nil
+}
+
+// UpdateSchedule updates an existing scheduled operation
+func (b *backend) UpdateSchedule(schedule storage.Schedule) (*storage.Schedule, error) {
+	if err := schedule.Check(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err := b.updateVal(b.key(sitesP, schedule.ClusterName, schedulesP, schedule.ID), schedule, forever)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return nil, trace.NotFound("schedule %v not found", schedule.ID)
+		}
+		return nil, trace.Wrap(err)
+	}
+	return &schedule, nil
+}
+
+// GetSchedule returns the scheduled operation by ID
+func (b *backend) GetSchedule(clusterName, id string) (*storage.Schedule, error) {
+	if clusterName == "" {
+		return nil, trace.BadParameter("missing parameter ClusterName")
+	}
+	if id == "" {
+		return nil, trace.BadParameter("missing parameter ID")
+	}
+	var schedule storage.Schedule
+	err := b.getVal(b.key(sitesP, clusterName, schedulesP, id), &schedule)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return nil, trace.NotFound("schedule %v not found", id)
+		}
+		return nil, trace.Wrap(err)
+	}
+	utils.UTC(&schedule.Created)
+	utils.UTC(&schedule.Updated)
+	return &schedule, nil
+}
+
+// GetSchedules returns all scheduled operations of the cluster
+// sorted by creation time
+func (b *backend) GetSchedules(clusterName string) ([]storage.Schedule, error) {
+	if clusterName == "" {
+		return nil, trace.BadParameter("missing parameter ClusterName")
+	}
+	ids, err := b.getKeys(b.key(sitesP, clusterName, schedulesP))
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, trace.Wrap(err)
+	}
+	var out []storage.Schedule
+	for _, id := range ids {
+		schedule, err := b.GetSchedule(clusterName, id)
+		if err != nil {
+			if !trace.IsNotFound(err) {
+				return nil, trace.Wrap(err)
+			}
+			continue
+		}
+		out = append(out, *schedule)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out, nil
+}
+
+// DeleteSchedule deletes the scheduled operation by ID
+func (b *backend) DeleteSchedule(clusterName, id string) error {
+	if clusterName == "" {
+		return trace.BadParameter("missing parameter ClusterName")
+	}
+	if id == "" {
+		return trace.BadParameter("missing parameter ID")
+	}
+	err := b.deleteKey(b.key(sitesP, clusterName, schedulesP, id))
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return trace.NotFound("schedule %v not found", id)
+		}
+		return trace.Wrap(err)
+	}
+	return nil
+}
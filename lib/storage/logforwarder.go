@@ -19,6 +19,9 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -37,6 +40,20 @@ type LogForwarder interface {
 	GetAddress() string
 	// GetProtocol returns log forwarder protocol
 	GetProtocol() string
+	// GetOutput returns the type of log forwarder destination
+	GetOutput() string
+	// GetFormat returns the format of forwarded log messages
+	GetFormat() string
+	// GetTLS returns the log forwarder TLS configuration
+	GetTLS() *LogForwarderTLS
+	// GetFilter returns the filter that selects forwarded logs
+	GetFilter() *LogForwarderFilter
+	// GetRateLimit returns the log forwarder rate limit settings
+	GetRateLimit() *LogForwarderRateLimit
+	// GetBuffer returns the log forwarder buffering settings
+	GetBuffer() *LogForwarderBuffer
+	// WithoutSecrets returns a copy of the log forwarder without the TLS client key
+	WithoutSecrets() LogForwarder
 	// CheckAndSetDefaults validates log forwarder configuration
 	CheckAndSetDefaults() error
 }
@@ -115,6 +132,56 @@ func (l *LogForwarderV2) GetProtocol() string {
 	return l.Spec.Protocol
 }
 
+// GetOutput returns the type of log forwarder destination
+func (l *LogForwarderV2) GetOutput() string {
+	if l.Spec.Output == "" {
+		return LogForwarderOutputSyslog
+	}
+	return l.Spec.Output
+}
+
+// GetFormat returns the format of forwarded log messages
+func (l *LogForwarderV2) GetFormat() string {
+	if l.Spec.Format == "" {
+		if l.GetOutput() == LogForwarderOutputSyslog {
+			return LogForwarderFormatRFC5424
+		}
+		return LogForwarderFormatJSON
+	}
+	return l.Spec.Format
+}
+
+// GetTLS returns the log forwarder TLS configuration
+func (l *LogForwarderV2) GetTLS() *LogForwarderTLS {
+	return l.Spec.TLS
+}
+
+// GetFilter returns the filter that selects forwarded logs
+func (l *LogForwarderV2) GetFilter() *LogForwarderFilter {
+	return l.Spec.Filter
+}
+
+// GetRateLimit returns the log forwarder rate limit settings
+func (l *LogForwarderV2) GetRateLimit() *LogForwarderRateLimit {
+	return l.Spec.RateLimit
+}
+
+// GetBuffer returns the log forwarder buffering settings
+func (l *LogForwarderV2) GetBuffer() *LogForwarderBuffer {
+	return l.Spec.Buffer
+}
+
+// WithoutSecrets returns a copy of the log forwarder without the TLS client key
+func (l *LogForwarderV2) WithoutSecrets() LogForwarder {
+	forwarder := *l
+	if l.Spec.TLS != nil {
+		tls := *l.Spec.TLS
+		tls.ClientKey = ""
+		forwarder.Spec.TLS = &tls
+	}
+	return &forwarder
+}
+
 // CheckAndSetDefaults validates log forwarder configuration
 func (l *LogForwarderV2) CheckAndSetDefaults() error {
 	if l.Metadata.Name == "" {
@@ -123,23 +190,269 @@ func (l *LogForwarderV2) CheckAndSetDefaults() error {
 	if l.Spec.Address == "" {
 		return trace.BadParameter("missing parameter Address")
 	}
-	if l.Spec.Protocol != "" {
-		if l.Spec.Protocol != "tcp" && l.Spec.Protocol != "udp" {
+	l.Spec.Output = l.GetOutput()
+	switch l.Spec.Output {
+	case LogForwarderOutputSyslog:
+		if l.Spec.Protocol != "" {
+			if l.Spec.Protocol != "tcp" && l.Spec.Protocol != "udp" {
+				return trace.BadParameter(
+					"unsupported protocol %q, must be one of: tcp, udp", l.Spec.Protocol)
+			}
+		} else {
+			l.Spec.Protocol = "tcp"
+		}
+		if l.Spec.TLS != nil && l.Spec.Protocol != "tcp" {
+			return trace.BadParameter("TLS is only supported with tcp protocol")
+		}
+		if l.Spec.Index != "" || len(l.Spec.Headers) != 0 {
+			return trace.BadParameter("index and headers are not supported by %v output",
+				l.Spec.Output)
+		}
+	case LogForwarderOutputHTTP, LogForwarderOutputElasticsearch:
+		if l.Spec.Protocol != "" {
+			return trace.BadParameter("protocol is not supported by %v output, "+
+				"specify URL scheme in the address instead", l.Spec.Output)
+		}
+		u, err := url.Parse(l.Spec.Address)
+		if err != nil {
+			return trace.BadParameter("invalid address %q: %v", l.Spec.Address, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
 			return trace.BadParameter(
-				"unsupported protocol %q, must be one of: tcp, udp", l.Spec.Protocol)
+				"address %q should be a URL with http or https scheme", l.Spec.Address)
+		}
+		if l.Spec.TLS != nil && u.Scheme != "https" {
+			return trace.BadParameter("TLS requires https address, got %q", l.Spec.Address)
+		}
+		if l.Spec.Output == LogForwarderOutputElasticsearch && l.Spec.Index == "" {
+			l.Spec.Index = defaults.LogForwarderElasticsearchIndex
+		}
+		if l.Spec.Output == LogForwarderOutputHTTP && l.Spec.Index != "" {
+			return trace.BadParameter("index is only supported by %v output",
+				LogForwarderOutputElasticsearch)
+		}
+		if l.Spec.TLS != nil && l.Spec.TLS.ServerName != "" {
+			return trace.BadParameter("TLS server name is only supported by %v output",
+				LogForwarderOutputSyslog)
+		}
+		if l.Spec.RateLimit != nil {
+			return trace.BadParameter("rate limit is only supported by %v output",
+				LogForwarderOutputSyslog)
+		}
+	default:
+		return trace.BadParameter("unsupported output %q, must be one of: %v",
+			l.Spec.Output, strings.Join(logForwarderOutputs, ", "))
+	}
+	l.Spec.Format = l.GetFormat()
+	switch l.Spec.Format {
+	case LogForwarderFormatRFC5424:
+		if l.Spec.Output == LogForwarderOutputElasticsearch {
+			return trace.BadParameter("%v output only supports %v format",
+				LogForwarderOutputElasticsearch, LogForwarderFormatJSON)
+		}
+	case LogForwarderFormatJSON:
+	default:
+		return trace.BadParameter("unsupported format %q, must be one of: %v, %v",
+			l.Spec.Format, LogForwarderFormatRFC5424, LogForwarderFormatJSON)
+	}
+	if l.Spec.TLS != nil {
+		if err := l.Spec.TLS.Check(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if l.Spec.Filter != nil {
+		if err := l.Spec.Filter.Check(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if l.Spec.RateLimit != nil {
+		if err := l.Spec.RateLimit.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if l.Spec.Buffer != nil {
+		if err := l.Spec.Buffer.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
 		}
-	} else {
-		l.Spec.Protocol = "tcp"
 	}
 	return nil
 }
 
 // LogForwarderSpecV2 is the log forwarder spec
 type LogForwarderSpecV2 struct {
-	// Address is log forwarder address
+	// Address is log forwarder address: host:port for syslog output
+	// or URL for http and elasticsearch outputs
 	Address string `json:"address"`
-	// Protocol is log forwarder protocol
+	// Protocol is log forwarder protocol, only used by syslog output
 	Protocol string `json:"protocol,omitempty"`
+	// Output is the type of log destination: syslog, http or elasticsearch
+	Output string `json:"output,omitempty"`
+	// Format is the format of forwarded messages: rfc5424 or json
+	Format string `json:"format,omitempty"`
+	// Index is the Elasticsearch index logs are written to
+	Index string `json:"index,omitempty"`
+	// Headers is a list of additional headers sent with http requests
+	Headers map[string]string `json:"headers,omitempty"`
+	// TLS is an optional TLS configuration for the connection
+	TLS *LogForwarderTLS `json:"tls,omitempty"`
+	// Filter optionally limits the set of forwarded logs
+	Filter *LogForwarderFilter `json:"filter,omitempty"`
+	// RateLimit optionally limits the rate of forwarded messages
+	RateLimit *LogForwarderRateLimit `json:"rate_limit,omitempty"`
+	// Buffer configures buffering of messages that could not be delivered yet
+	Buffer *LogForwarderBuffer `json:"buffer,omitempty"`
+}
+
+// LogForwarderTLS defines TLS settings of the log forwarder connection
+type LogForwarderTLS struct {
+	// CACert is PEM-encoded certificate authority used to verify the server
+	CACert string `json:"ca_cert,omitempty"`
+	// ClientCert is PEM-encoded client certificate
+	ClientCert string `json:"client_cert,omitempty"`
+	// ClientKey is PEM-encoded client private key
+	ClientKey string `json:"client_key,omitempty"`
+	// ServerName overrides the server name used to verify its certificate
+	ServerName string `json:"server_name,omitempty"`
+	// InsecureSkipVerify disables verification of the server certificate
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// Check validates TLS settings
+func (t LogForwarderTLS) Check() error {
+	if t.CACert != "" {
+		if _, err := teleutils.ParseCertificatePEM([]byte(t.CACert)); err != nil {
+			return trace.BadParameter("invalid CA certificate: %v", err)
+		}
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return trace.BadParameter("client certificate and key should be provided together")
+	}
+	if t.ClientCert != "" {
+		if _, err := teleutils.ParseCertificatePEM([]byte(t.ClientCert)); err != nil {
+			return trace.BadParameter("invalid client certificate: %v", err)
+		}
+		if _, err := teleutils.ParsePrivateKeyPEM([]byte(t.ClientKey)); err != nil {
+			return trace.BadParameter("invalid client private key: %v", err)
+		}
+	}
+	return nil
+}
+
+// LogForwarderFilter selects logs to forward. Empty filter matches all logs,
+// otherwise a message should match all of the specified criteria
+type LogForwarderFilter struct {
+	// Namespaces is a list of Kubernetes namespaces to forward logs from
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Pods is a list of pod name glob patterns to forward logs from
+	Pods []string `json:"pods,omitempty"`
+	// Labels is a set of pod labels to match
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Check validates the filter
+func (f LogForwarderFilter) Check() error {
+	for _, namespace := range f.Namespaces {
+		if namespace == "" {
+			return trace.BadParameter("filter namespace can't be empty")
+		}
+	}
+	for _, pattern := range f.Pods {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return trace.BadParameter("invalid pod pattern %q: %v", pattern, err)
+		}
+	}
+	for key := range f.Labels {
+		if !filterLabelKey.MatchString(key) {
+			return trace.BadParameter("unsupported filter label key %q: "+
+				"only letters, digits, '.', '_' and '-' are allowed", key)
+		}
+	}
+	return nil
+}
+
+// LogForwarderRateLimit limits the rate of forwarded messages
+type LogForwarderRateLimit struct {
+	// Messages is the maximum number of messages forwarded per interval
+	Messages int `json:"messages"`
+	// Interval is the rate limit interval in whole seconds, one second by default
+	Interval teleservices.Duration `json:"interval,omitempty"`
+	// Burst is the number of messages allowed above the limit in short bursts
+	Burst int `json:"burst,omitempty"`
+}
+
+// CheckAndSetDefaults validates rate limit settings and sets defaults
+func (r *LogForwarderRateLimit) CheckAndSetDefaults() error {
+	if r.Messages <= 0 {
+		return trace.BadParameter("rate limit messages should be positive")
+	}
+	if r.Burst < 0 {
+		return trace.BadParameter("rate limit burst can't be negative")
+	}
+	if r.Interval.Duration < 0 {
+		return trace.BadParameter("rate limit interval can't be negative")
+	}
+	if r.Interval.Duration == 0 {
+		r.Interval.Duration = time.Second
+	}
+	if r.Interval.Duration%time.Second != 0 {
+		return trace.BadParameter("rate limit interval should be a whole number of seconds")
+	}
+	return nil
+}
+
+// LogForwarderBuffer configures buffering of undelivered messages
+type LogForwarderBuffer struct {
+	// Size is the maximum number of messages held in the buffer
+	Size int `json:"size,omitempty"`
+	// Overflow defines what happens when the buffer is full: block or drop
+	Overflow string `json:"overflow,omitempty"`
+}
+
+// CheckAndSetDefaults validates buffer settings and sets defaults
+func (b *LogForwarderBuffer) CheckAndSetDefaults() error {
+	if b.Size < 0 {
+		return trace.BadParameter("buffer size can't be negative")
+	}
+	if b.Size == 0 {
+		b.Size = defaults.LogForwarderBufferSize
+	}
+	switch b.Overflow {
+	case "":
+		b.Overflow = LogForwarderOverflowBlock
+	case LogForwarderOverflowBlock, LogForwarderOverflowDrop:
+	default:
+		return trace.BadParameter("unsupported buffer overflow %q, must be one of: %v, %v",
+			b.Overflow, LogForwarderOverflowBlock, LogForwarderOverflowDrop)
+	}
+	return nil
+}
+
+const (
+	// LogForwarderOutputSyslog forwards logs to a remote syslog server
+	LogForwarderOutputSyslog = "syslog"
+	// LogForwarderOutputHTTP posts logs to an HTTP endpoint
+	LogForwarderOutputHTTP = "http"
+	// LogForwarderOutputElasticsearch sends logs to Elasticsearch bulk API
+	LogForwarderOutputElasticsearch = "elasticsearch"
+
+	// LogForwarderFormatRFC5424 formats messages according to syslog RFC5424
+	LogForwarderFormatRFC5424 = "rfc5424"
+	// LogForwarderFormatJSON formats messages as JSON objects
+	LogForwarderFormatJSON = "json"
+
+	// LogForwarderOverflowBlock stops reading logs when the buffer is full
+	LogForwarderOverflowBlock = "block"
+	// LogForwarderOverflowDrop drops new messages when the buffer is full
+	LogForwarderOverflowDrop = "drop"
+)
+
+// filterLabelKey matches label keys supported by log forwarder filters
+var filterLabelKey = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+var logForwarderOutputs = []string{
+	LogForwarderOutputSyslog,
+	LogForwarderOutputHTTP,
+	LogForwarderOutputElasticsearch,
 }
 
 // LogForwarderV2Scheme is the log forwarder JSON schema
@@ -149,7 +462,59 @@ const LogForwarderV2Schema = `{
   "required": ["address"],
   "properties": {
     "address": {"type": "string"},
-    "protocol": {"type": "string"}
+    "protocol": {"type": "string", "enum": ["tcp", "udp"]},
+    "output": {"type": "string", "enum": ["syslog", "http", "elasticsearch"]},
+    "format": {"type": "string", "enum": ["rfc5424", "json"]},
+    "index": {"type": "string"},
+    "headers": {
+      "type": "object",
+      "patternProperties": {
+        "^.+$": {"type": "string"}
+      }
+    },
+    "tls": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "ca_cert": {"type": "string"},
+        "client_cert": {"type": "string"},
+        "client_key": {"type": "string"},
+        "server_name": {"type": "string"},
+        "insecure_skip_verify": {"type": "boolean"}
+      }
+    },
+    "filter": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "namespaces": {"type": "array", "items": {"type": "string"}},
+        "pods": {"type": "array", "items": {"type": "string"}},
+        "labels": {
+          "type": "object",
+          "patternProperties": {
+            "^.+$": {"type": "string"}
+          }
+        }
+      }
+    },
+    "rate_limit": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["messages"],
+      "properties": {
+        "messages": {"type": "number", "minimum": 1},
+        "interval": {"type": "string"},
+        "burst": {"type": "number", "minimum": 0}
+      }
+    },
+    "buffer": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "size": {"type": "number", "minimum": 0},
+        "overflow": {"type": "string", "enum": ["block", "drop"]}
+      }
+    }
   }
 }`
 
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"strings"
+	"time"
+
+	teleservices "github.com/gravitational/teleport/lib/services"
+	teleutils "github.com/gravitational/teleport/lib/utils"
+	"gopkg.in/check.v1"
+)
+
+type LogForwarderSuite struct{}
+
+var _ = check.Suite(&LogForwarderSuite{})
+
+func (s *LogForwarderSuite) TestUnmarshal(c *check.C) {
+	keyPair, err := teleutils.GenerateSelfSignedCert([]string{"logs.example.com"})
+	c.Assert(err, check.IsNil)
+
+	forwarder, err := GetLogForwarderMarshaler().Unmarshal([]byte(`kind: logforwarder
+version: v2
+metadata:
+  name: es
+spec:
+  address: https://logs.example.com:9200
+  output: elasticsearch
+  tls:
+    ca_cert: |
+` + indent(string(keyPair.Cert), "      ") + `
+  filter:
+    namespaces: [default, kube-system]
+    pods: ["web-*"]
+    labels:
+      app: web
+  buffer:
+    size: 500
+    overflow: drop`))
+	c.Assert(err, check.IsNil)
+	c.Assert(forwarder.CheckAndSetDefaults(), check.IsNil)
+	c.Assert(forwarder.GetOutput(), check.Equals, LogForwarderOutputElasticsearch)
+	c.Assert(forwarder.GetFormat(), check.Equals, LogForwarderFormatJSON)
+	c.Assert(forwarder.GetProtocol(), check.Equals, "")
+	c.Assert(forwarder.GetFilter(), check.DeepEquals, &LogForwarderFilter{
+		Namespaces: []string{"default", "kube-system"},
+		Pods:       []string{"web-*"},
+		Labels:     map[string]string{"app": "web"},
+	})
+	c.Assert(forwarder.GetBuffer().Overflow, check.Equals, LogForwarderOverflowDrop)
+	c.Assert(forwarder.(*LogForwarderV2).Spec.Index, check.Equals, "gravity-logs")
+
+	_, err = GetLogForwarderMarshaler().Unmarshal([]byte(`kind: logforwarder
+version: v2
+metadata:
+  name: bad
+spec:
+  address: 192.168.1.1:514
+  format: xml`))
+	c.Assert(err, check.NotNil, check.Commentf("schema should reject unknown format"))
+}
+
+func (s *LogForwarderSuite) TestDefaults(c *check.C) {
+	forwarder := NewLogForwarder("syslog", "192.168.1.1:514", "")
+	c.Assert(forwarder.CheckAndSetDefaults(), check.IsNil)
+	c.Assert(forwarder.GetOutput(), check.Equals, LogForwarderOutputSyslog)
+	c.Assert(forwarder.GetProtocol(), check.Equals, "tcp")
+	c.Assert(forwarder.GetFormat(), check.Equals, LogForwarderFormatRFC5424)
+
+	forwarder.(*LogForwarderV2).Spec.RateLimit = &LogForwarderRateLimit{Messages: 100}
+	c.Assert(forwarder.CheckAndSetDefaults(), check.IsNil)
+	c.Assert(forwarder.GetRateLimit().Interval.Duration, check.Equals, time.Second)
+}
+
+func (s *LogForwarderSuite) TestValidation(c *check.C) {
+	testCases := []struct {
+		spec    LogForwarderSpecV2
+		comment string
+	}{
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", Protocol: "udp", TLS: &LogForwarderTLS{}},
+			comment: "TLS over udp",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", Output: "kafka"},
+			comment: "unknown output",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "logs.example.com", Output: LogForwarderOutputHTTP},
+			comment: "http output without URL",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "http://logs.example.com", Output: LogForwarderOutputHTTP, Protocol: "tcp"},
+			comment: "protocol with http output",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "http://logs.example.com", Output: LogForwarderOutputHTTP, TLS: &LogForwarderTLS{}},
+			comment: "TLS with plain http address",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "https://es:9200", Output: LogForwarderOutputElasticsearch, Format: LogForwarderFormatRFC5424},
+			comment: "rfc5424 with elasticsearch output",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", TLS: &LogForwarderTLS{ClientCert: "cert"}},
+			comment: "client certificate without key",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", TLS: &LogForwarderTLS{CACert: "bad"}},
+			comment: "invalid CA certificate",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", Filter: &LogForwarderFilter{Pods: []string{"web-["}}},
+			comment: "invalid pod pattern",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", RateLimit: &LogForwarderRateLimit{}},
+			comment: "zero rate limit",
+		},
+		{
+			spec: LogForwarderSpecV2{Address: "192.168.1.1:514", RateLimit: &LogForwarderRateLimit{
+				Messages: 100,
+				Interval: teleservices.NewDuration(1500 * time.Millisecond),
+			}},
+			comment: "fractional rate limit interval",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "https://logs.example.com", Output: LogForwarderOutputHTTP, RateLimit: &LogForwarderRateLimit{Messages: 100}},
+			comment: "rate limit with http output",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "https://logs.example.com", Output: LogForwarderOutputHTTP, TLS: &LogForwarderTLS{ServerName: "logs"}},
+			comment: "TLS server name with http output",
+		},
+		{
+			spec:    LogForwarderSpecV2{Address: "192.168.1.1:514", Buffer: &LogForwarderBuffer{Overflow: "spill"}},
+			comment: "unknown buffer overflow",
+		},
+	}
+	for _, tc := range testCases {
+		forwarder := NewLogForwarder("test", "", "").(*LogForwarderV2)
+		forwarder.Spec = tc.spec
+		c.Assert(forwarder.CheckAndSetDefaults(), check.NotNil, check.Commentf(tc.comment))
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -19,6 +19,10 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"text/template"
+
+	"github.com/gravitational/gravity/lib/defaults"
 
 	teleservices "github.com/gravitational/teleport/lib/services"
 	teleutils "github.com/gravitational/teleport/lib/utils"
@@ -47,6 +51,19 @@ type AlertV2 struct {
 	Spec AlertSpecV2 `json:"spec"`
 }
 
+// NewAlert creates a new monitoring alert resource
+func NewAlert(name string, spec AlertSpecV2) Alert {
+	return &AlertV2{
+		Kind:    KindAlert,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name:      name,
+			Namespace: defaults.Namespace,
+		},
+		Spec: spec,
+	}
+}
+
 // GetFormula returns alert's kapacitor formula
 func (r *AlertV2) GetFormula() string {
 	return r.Spec.Formula
@@ -129,8 +146,18 @@ type AlertTarget interface {
 	teleservices.Resource
 	// CheckAndSetDefaults that the object is valid
 	CheckAndSetDefaults() error
+	// GetType returns the type of the alert target, e.g. "email" or "webhook"
+	GetType() string
 	// GetEmail returns the recipient's email
 	GetEmail() string
+	// GetWebhook returns the generic webhook target configuration
+	GetWebhook() *AlertWebhook
+	// GetSlack returns the chat webhook target configuration
+	GetSlack() *AlertSlack
+	// GetPagerDuty returns the incident management target configuration
+	GetPagerDuty() *AlertPagerDuty
+	// WithoutSecrets returns a copy of the alert target with credentials redacted
+	WithoutSecrets() AlertTarget
 }
 
 // AlertTargetV2 defines a monitoring alert target
@@ -145,18 +172,113 @@ type AlertTargetV2 struct {
 	Spec AlertTargetSpecV2 `json:"spec"`
 }
 
+// NewAlertTarget creates a new monitoring alert target resource
+func NewAlertTarget(name string, spec AlertTargetSpecV2) AlertTarget {
+	return &AlertTargetV2{
+		Kind:    KindAlertTarget,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name:      name,
+			Namespace: defaults.Namespace,
+		},
+		Spec: spec,
+	}
+}
+
+// GetType returns the type of the alert target
+func (r *AlertTargetV2) GetType() string {
+	switch {
+	case r.Spec.Webhook != nil:
+		return AlertTargetWebhook
+	case r.Spec.Slack != nil:
+		return AlertTargetSlack
+	case r.Spec.PagerDuty != nil:
+		return AlertTargetPagerDuty
+	default:
+		return AlertTargetEmail
+	}
+}
+
 // GetEmail returns recipient's email
 func (r *AlertTargetV2) GetEmail() string {
 	return r.Spec.Email
 }
 
+// GetWebhook returns the generic webhook target configuration
+func (r *AlertTargetV2) GetWebhook() *AlertWebhook {
+	return r.Spec.Webhook
+}
+
+// GetSlack returns the chat webhook target configuration
+func (r *AlertTargetV2) GetSlack() *AlertSlack {
+	return r.Spec.Slack
+}
+
+// GetPagerDuty returns the incident management target configuration
+func (r *AlertTargetV2) GetPagerDuty() *AlertPagerDuty {
+	return r.Spec.PagerDuty
+}
+
+// WithoutSecrets returns a copy of the alert target with the webhook
+// signing key, the chat webhook address and the routing key redacted
+func (r *AlertTargetV2) WithoutSecrets() AlertTarget {
+	target := *r
+	if r.Spec.Webhook != nil {
+		webhook := *r.Spec.Webhook
+		if webhook.Secret != "" {
+			webhook.Secret = RedactedValue
+		}
+		target.Spec.Webhook = &webhook
+	}
+	if r.Spec.Slack != nil {
+		slack := *r.Spec.Slack
+		slack.URL = RedactedValue
+		target.Spec.Slack = &slack
+	}
+	if r.Spec.PagerDuty != nil {
+		pagerDuty := *r.Spec.PagerDuty
+		pagerDuty.RoutingKey = RedactedValue
+		target.Spec.PagerDuty = &pagerDuty
+	}
+	return &target
+}
+
 // CheckAndSetDefaults checks validity of all parameters and sets defaults
 func (r *AlertTargetV2) CheckAndSetDefaults() error {
-	if r.Spec.Email == "" {
-		return trace.BadParameter("missing parameter Email")
+	var targets []string
+	if r.Spec.Email != "" {
+		targets = append(targets, AlertTargetEmail)
+	}
+	if r.Spec.Webhook != nil {
+		targets = append(targets, AlertTargetWebhook)
+		if err := r.Spec.Webhook.Check(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if r.Spec.Slack != nil {
+		targets = append(targets, AlertTargetSlack)
+		if r.Spec.Slack.URL == RedactedValue {
+			return trace.BadParameter("chat webhook URL is redacted, specify the actual value")
+		}
+		if err := checkAlertURL(r.Spec.Slack.URL); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if r.Spec.PagerDuty != nil {
+		targets = append(targets, AlertTargetPagerDuty)
+		if err := r.Spec.PagerDuty.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	switch len(targets) {
+	case 0:
+		return trace.BadParameter("alert target should define one of %v", alertTargetTypes)
+	case 1:
+		return nil
+	default:
+		return trace.BadParameter("alert target can only define one of %v, got %v",
+			alertTargetTypes, targets)
 	}
-
-	return nil
 }
 
 // UnmarshalAlertTarget unmarshals an alert target from JSON
@@ -195,19 +317,151 @@ func MarshalAlertTarget(target AlertTarget, opts ...teleservices.MarshalOption)
 	return json.Marshal(target)
 }
 
-// AlertTargetSpecV2 defines a monitoring alert target
+// AlertTargetSpecV2 defines a monitoring alert target.
+//
+// Exactly one of the targets must be set
 type AlertTargetSpecV2 struct {
 	// Email specifies recipient's email
-	Email string `json:"email"`
+	Email string `json:"email,omitempty"`
+	// Webhook specifies a generic HTTP webhook target
+	Webhook *AlertWebhook `json:"webhook,omitempty"`
+	// Slack specifies a Slack-compatible chat webhook target
+	Slack *AlertSlack `json:"slack,omitempty"`
+	// PagerDuty specifies a PagerDuty-compatible incident management target
+	PagerDuty *AlertPagerDuty `json:"pagerduty,omitempty"`
+}
+
+// AlertWebhook defines a generic HTTP webhook alert target
+type AlertWebhook struct {
+	// URL is the address alerts are posted to
+	URL string `json:"url"`
+	// Payload is an optional Go template of the JSON request body.
+	// The template is executed with the alert as data
+	Payload string `json:"payload,omitempty"`
+	// Secret is an optional key used to sign request bodies with HMAC-SHA256
+	Secret string `json:"secret,omitempty"`
+	// Headers specifies additional request headers
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Check makes sure the webhook configuration is valid
+func (r AlertWebhook) Check() error {
+	if r.Secret == RedactedValue {
+		return trace.BadParameter("webhook secret is redacted, specify the actual value")
+	}
+	if err := checkAlertURL(r.URL); err != nil {
+		return trace.Wrap(err)
+	}
+	if r.Payload != "" {
+		if _, err := template.New("payload").Parse(r.Payload); err != nil {
+			return trace.BadParameter("invalid webhook payload template: %v", err)
+		}
+	}
+	return nil
+}
+
+// AlertSlack defines a Slack-compatible chat webhook alert target
+type AlertSlack struct {
+	// URL is the incoming webhook address
+	URL string `json:"url"`
+	// Channel optionally overrides the channel configured for the webhook
+	Channel string `json:"channel,omitempty"`
+	// Username optionally overrides the name alerts are posted as
+	Username string `json:"username,omitempty"`
+}
+
+// AlertPagerDuty defines a PagerDuty-compatible incident management alert target
+type AlertPagerDuty struct {
+	// RoutingKey is the integration key of the service alerts are routed to
+	RoutingKey string `json:"routing_key"`
+	// URL is the events API address
+	URL string `json:"url,omitempty"`
 }
 
+// CheckAndSetDefaults makes sure the configuration is valid and sets defaults
+func (r *AlertPagerDuty) CheckAndSetDefaults() error {
+	if r.RoutingKey == "" {
+		return trace.BadParameter("missing parameter RoutingKey")
+	}
+	if r.RoutingKey == RedactedValue {
+		return trace.BadParameter("routing key is redacted, specify the actual value")
+	}
+	if r.URL == "" {
+		r.URL = AlertPagerDutyURL
+	}
+	return trace.Wrap(checkAlertURL(r.URL))
+}
+
+func checkAlertURL(addr string) error {
+	if addr == "" {
+		return trace.BadParameter("missing parameter URL")
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return trace.BadParameter("invalid URL %q: %v", addr, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return trace.BadParameter("URL %q should have http or https scheme", addr)
+	}
+	return nil
+}
+
+const (
+	// AlertTargetEmail is the type of the email alert target
+	AlertTargetEmail = "email"
+	// AlertTargetWebhook is the type of the generic webhook alert target
+	AlertTargetWebhook = "webhook"
+	// AlertTargetSlack is the type of the Slack-compatible alert target
+	AlertTargetSlack = "slack"
+	// AlertTargetPagerDuty is the type of the PagerDuty-compatible alert target
+	AlertTargetPagerDuty = "pagerduty"
+
+	// AlertPagerDutyURL is the default address of the incident management events API
+	AlertPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+	// RedactedValue replaces credentials in alert targets returned to clients
+	RedactedValue = "<redacted>"
+)
+
+// alertTargetTypes lists the supported alert target types
+var alertTargetTypes = []string{AlertTargetEmail, AlertTargetWebhook, AlertTargetSlack, AlertTargetPagerDuty}
+
 // AlertTargetSpecV2Schema is JSON schema for a monitoring alert target
 const AlertTargetSpecV2Schema = `{
   "type": "object",
   "additionalProperties": false,
-  "required": ["email"],
   "properties": {
-    "email": {"type": "string"}
+    "email": {"type": "string"},
+    "webhook": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["url"],
+      "properties": {
+        "url": {"type": "string"},
+        "payload": {"type": "string"},
+        "secret": {"type": "string"},
+        "headers": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "slack": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["url"],
+      "properties": {
+        "url": {"type": "string"},
+        "channel": {"type": "string"},
+        "username": {"type": "string"}
+      }
+    },
+    "pagerduty": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["routing_key"],
+      "properties": {
+        "routing_key": {"type": "string"},
+        "url": {"type": "string"}
+      }
+    }
   }
 }`
 
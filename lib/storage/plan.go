@@ -41,6 +41,8 @@ type OperationPlan struct {
 	Servers []Server `json:"servers"`
 	// GravityPackage is updated gravity package locator
 	GravityPackage loc.Locator `json:"gravity_package"`
+	// Strategy is the rollout strategy the plan has been generated with
+	Strategy *RolloutStrategy `json:"strategy,omitempty"`
 	// CreatedAt is the plan creation timestamp
 	CreatedAt time.Time `json:"created_at"`
 }
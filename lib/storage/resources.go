@@ -54,6 +54,10 @@ const (
 	KindSystemInfo = "systeminfo"
 	// KindEndpoints defines the Ops Center endpoints resource type
 	KindEndpoints = "endpoints"
+	// KindClusterSpec defines the declarative cluster specification
+	KindClusterSpec = "clusterspec"
+	// KindInstallConfig defines the install answer file
+	KindInstallConfig = "installconfig"
 )
 
 // SupportedGravityResources is a list of resources supported by
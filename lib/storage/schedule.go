@@ -0,0 +1,227 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/loc"
+
+	"github.com/gravitational/trace"
+)
+
+// Schedules manages operations scheduled to run in maintenance windows
+type Schedules interface {
+	// CreateSchedule creates a new scheduled operation
+	CreateSchedule(Schedule) (*Schedule, error)
+	// UpdateSchedule updates an existing scheduled operation
+	UpdateSchedule(Schedule) (*Schedule, error)
+	// GetSchedule returns the scheduled operation by ID
+	GetSchedule(clusterName, id string) (*Schedule, error)
+	// GetSchedules returns all scheduled operations of the cluster
+	GetSchedules(clusterName string) ([]Schedule, error)
+	// DeleteSchedule deletes the scheduled operation by ID
+	DeleteSchedule(clusterName, id string) error
+}
+
+// Schedule is a cluster operation that is started automatically once its
+// maintenance window opens
+type Schedule struct {
+	// ID uniquely identifies the schedule
+	ID string `json:"id"`
+	// ClusterName is the name of the cluster the schedule belongs to
+	ClusterName string `json:"cluster_name"`
+	// Operation is the type of the scheduled operation
+	Operation string `json:"operation"`
+	// App is the application package to update to, for update operations
+	App string `json:"app,omitempty"`
+	// Window is the maintenance window the operation is allowed to run in
+	Window MaintenanceWindow `json:"window"`
+	// State is the schedule state
+	State string `json:"state"`
+	// OperationID is the ID of the cluster operation started by the schedule
+	OperationID string `json:"operation_id,omitempty"`
+	// Message describes the last state transition
+	Message string `json:"message,omitempty"`
+	// Created is the schedule creation time
+	Created time.Time `json:"created"`
+	// Updated is the last time the schedule was updated
+	Updated time.Time `json:"updated"`
+}
+
+// Check makes sure the schedule is valid
+func (s Schedule) Check() error {
+	if s.ClusterName == "" {
+		return trace.BadParameter("missing cluster name")
+	}
+	switch s.Operation {
+	case ScheduledUpdate:
+		if s.App == "" {
+			return trace.BadParameter("update schedule requires an application package")
+		}
+		if _, err := loc.ParseLocator(s.App); err != nil {
+			return trace.Wrap(err)
+		}
+	case ScheduledGarbageCollect, ScheduledRotateCertificates:
+	default:
+		return trace.BadParameter("unsupported scheduled operation %q, supported are: %v",
+			s.Operation, strings.Join(ScheduledOperations, ", "))
+	}
+	return trace.Wrap(s.Window.Check())
+}
+
+// IsActive returns true if the schedule has not finished yet
+func (s Schedule) IsActive() bool {
+	return s.State != ScheduleStateCompleted && s.State != ScheduleStateFailed
+}
+
+// MaintenanceWindow is a weekly recurring time interval
+type MaintenanceWindow struct {
+	// Days lists the week days the window opens on, e.g. "sat", "sun".
+	// The window opens every day if empty
+	Days []string `json:"days,omitempty"`
+	// Start is the time of day the window opens at, in the 24-hour HH:MM
+	// format in UTC
+	Start string `json:"start"`
+	// Duration is how long the window stays open
+	Duration time.Duration `json:"duration"`
+}
+
+// Check makes sure the window is valid
+func (w MaintenanceWindow) Check() error {
+	for _, day := range w.Days {
+		if _, err := parseWeekday(day); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if _, err := w.startOffset(); err != nil {
+		return trace.Wrap(err)
+	}
+	if w.Duration <= 0 || w.Duration > 24*time.Hour {
+		return trace.BadParameter("maintenance window duration should be between 0 and 24h, got %v",
+			w.Duration)
+	}
+	return nil
+}
+
+// IsOpen returns true if the window is open at the specified time
+func (w MaintenanceWindow) IsOpen(now time.Time) bool {
+	now = now.UTC()
+	// the window that opened yesterday might still be open
+	for _, days := range []int{-1, 0} {
+		start, ok := w.startOn(now.AddDate(0, 0, days))
+		if ok && !now.Before(start) && now.Before(start.Add(w.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the time the window opens at next after the specified time
+func (w MaintenanceWindow) Next(now time.Time) time.Time {
+	now = now.UTC()
+	for days := 0; days <= 7; days++ {
+		start, ok := w.startOn(now.AddDate(0, 0, days))
+		if ok && start.After(now) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// String returns a human-readable description of the window
+func (w MaintenanceWindow) String() string {
+	days := "daily"
+	if len(w.Days) != 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%v %v UTC for %v", days, w.Start, w.Duration)
+}
+
+// startOn returns the time the window opens on the day of the specified
+// time, and false if the window does not open on that day
+func (w MaintenanceWindow) startOn(day time.Time) (time.Time, bool) {
+	if !w.opensOn(day.Weekday()) {
+		return time.Time{}, false
+	}
+	offset, err := w.startOffset()
+	if err != nil {
+		return time.Time{}, false
+	}
+	year, month, date := day.Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Add(offset), true
+}
+
+func (w MaintenanceWindow) opensOn(weekday time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if d, err := parseWeekday(day); err == nil && d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func (w MaintenanceWindow) startOffset() (time.Duration, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, trace.BadParameter("invalid maintenance window start %q, expected HH:MM", w.Start)
+	}
+	return time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := weekday.String()
+		if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+			return weekday, nil
+		}
+	}
+	return 0, trace.BadParameter("invalid week day %q, expected one of mon, tue, wed, thu, fri, sat, sun", day)
+}
+
+const (
+	// ScheduledUpdate is a scheduled application update
+	ScheduledUpdate = "update"
+	// ScheduledGarbageCollect is a scheduled garbage collection
+	ScheduledGarbageCollect = "gc"
+	// ScheduledRotateCertificates is a scheduled renewal of node certificates
+	ScheduledRotateCertificates = "rotate-certs"
+
+	// ScheduleStatePending means the schedule is waiting for its window
+	ScheduleStatePending = "pending"
+	// ScheduleStateRunning means the scheduled operation is being executed
+	ScheduleStateRunning = "running"
+	// ScheduleStatePaused means the scheduled operation has been paused
+	// because the window closed and will resume when it opens again
+	ScheduleStatePaused = "paused"
+	// ScheduleStateCompleted means the scheduled operation has completed
+	ScheduleStateCompleted = "completed"
+	// ScheduleStateFailed means the scheduled operation has failed
+	ScheduleStateFailed = "failed"
+)
+
+// ScheduledOperations lists operations that can be scheduled
+var ScheduledOperations = []string{
+	ScheduledUpdate,
+	ScheduledGarbageCollect,
+	ScheduledRotateCertificates,
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type MaintenanceWindowSuite struct{}
+
+var _ = check.Suite(&MaintenanceWindowSuite{})
+
+func (s *MaintenanceWindowSuite) TestWindow(c *check.C) {
+	// Saturday, 23:00 to Sunday, 03:00
+	window := MaintenanceWindow{Days: []string{"Sat"}, Start: "23:00", Duration: 4 * time.Hour}
+	c.Assert(window.Check(), check.IsNil)
+
+	saturday := time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC)
+	c.Assert(window.IsOpen(saturday.Add(22*time.Hour)), check.Equals, false)
+	c.Assert(window.IsOpen(saturday.Add(23*time.Hour)), check.Equals, true)
+	c.Assert(window.IsOpen(saturday.Add(26*time.Hour)), check.Equals, true)
+	c.Assert(window.IsOpen(saturday.Add(27*time.Hour)), check.Equals, false)
+	c.Assert(window.Next(saturday.Add(23*time.Hour)), check.Equals, saturday.AddDate(0, 0, 7).Add(23*time.Hour))
+	c.Assert(window.Next(saturday), check.Equals, saturday.Add(23*time.Hour))
+
+	// opens every day if days are not specified
+	window = MaintenanceWindow{Start: "02:30", Duration: time.Hour}
+	c.Assert(window.IsOpen(saturday.Add(3*time.Hour)), check.Equals, true)
+	c.Assert(window.IsOpen(saturday.AddDate(0, 0, 3).Add(3*time.Hour)), check.Equals, true)
+
+	for _, invalid := range []MaintenanceWindow{
+		{Start: "25:00", Duration: time.Hour},
+		{Start: "02:00"},
+		{Start: "02:00", Duration: 25 * time.Hour},
+		{Days: []string{"someday"}, Start: "02:00", Duration: time.Hour},
+	} {
+		c.Assert(invalid.Check(), check.NotNil, check.Commentf("%#v", invalid))
+	}
+}
@@ -55,6 +55,19 @@ type SMTPConfigV2 struct {
 	Spec SMTPConfigSpecV2 `json:"spec"`
 }
 
+// NewSMTPConfig creates a new SMTP configuration resource
+func NewSMTPConfig(spec SMTPConfigSpecV2) SMTPConfig {
+	return &SMTPConfigV2{
+		Kind:    KindSMTPConfig,
+		Version: teleservices.V2,
+		Metadata: teleservices.Metadata{
+			Name:      KindSMTPConfig,
+			Namespace: defaults.Namespace,
+		},
+		Spec: spec,
+	}
+}
+
 // GetHost returns SMTP host
 func (r *SMTPConfigV2) GetHost() string {
 	return r.Spec.Host
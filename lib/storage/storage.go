@@ -43,6 +43,7 @@ import (
 	"github.com/gravitational/trace"
 	"github.com/jonboulle/clockwork"
 	"github.com/tstranex/u2f"
+	"k8s.io/api/core/v1"
 )
 
 // Accounts collection modifies and updates account entries,
@@ -397,6 +398,9 @@ type Docker struct {
 	// LVMSystemDirectory specifies the location of lvm system directory
 	// if the storage driver is `devicemapper`
 	LVMSystemDirectory string `json:"system_directory"`
+	// StorageDriver overrides the cluster Docker storage driver on the node.
+	// It is set once the node has been migrated to a different storage driver
+	StorageDriver string `json:"storage_driver,omitempty"`
 }
 
 // SiteOperation represents any modification of the site,
@@ -431,6 +435,12 @@ type SiteOperation struct {
 	Uninstall *UninstallOperationState `json:"uninstall,omitempty"`
 	// Update is for updating application on the gravity site
 	Update *UpdateOperationState `json:"update,omitempty"`
+	// ReconfigureNetwork is set when the operation changes the cluster network settings
+	ReconfigureNetwork *ReconfigureNetworkOperationState `json:"reconfigure_network,omitempty"`
+	// ReconfigureNode is set when the operation changes the advertise address of a node
+	ReconfigureNode *ReconfigureNodeOperationState `json:"reconfigure_node,omitempty"`
+	// ReconfigureDocker is set when the operation changes the Docker storage driver of a node
+	ReconfigureDocker *ReconfigureDockerOperationState `json:"reconfigure_docker,omitempty"`
 }
 
 func (s *SiteOperation) Check() error {
@@ -1450,6 +1460,7 @@ type Backend interface {
 	ClusterImport
 	LegacyRoles
 	SystemMetadata
+	Schedules
 }
 
 const (
@@ -1534,6 +1545,15 @@ type Server struct {
 	User OSUser `json:"user"`
 	// Created is the timestamp when the server was created
 	Created time.Time `json:"created"`
+	// Labels lists Kubernetes node labels set on the server
+	// in addition to the labels of its profile
+	Labels map[string]string `json:"labels,omitempty"`
+	// Taints lists Kubernetes node taints set on the server
+	// in addition to the taints of its profile
+	Taints []v1.Taint `json:"taints,omitempty"`
+	// BlockDevices lists host devices assigned to the block devices
+	// of the server profile
+	BlockDevices []BlockDevice `json:"block_devices,omitempty"`
 }
 
 // StateDir returns directory where all gravity data is stored on this server
@@ -1610,6 +1630,14 @@ type SystemState struct {
 	StateDir string `json:"state_dir"`
 }
 
+// BlockDevice is a host device assigned to a block device of the server profile
+type BlockDevice struct {
+	// Name is the name of the block device in the server profile
+	Name string `json:"name"`
+	// Device is the assigned host device
+	Device Device `json:"device"`
+}
+
 // Devices defines a list of devices
 type Devices []Device
 
@@ -1944,6 +1972,98 @@ type UpdateOperationState struct {
 	ServerUpdates []ServerUpdate `json:"server_updates,omitempty"`
 	// Manual specifies whether this update operation was created in manual mode
 	Manual bool `json:"manual"`
+	// Strategy defines how regular nodes are rolled out during the update
+	Strategy *RolloutStrategy `json:"strategy,omitempty"`
+	// CanaryApproved is set once the update of the canary node has been approved
+	CanaryApproved bool `json:"canary_approved,omitempty"`
+	// AutoRollback specifies whether the started phases are rolled back
+	// automatically if the update fails
+	AutoRollback bool `json:"auto_rollback,omitempty"`
+}
+
+// ReconfigureNetworkOperationState describes the state of the network reconfiguration operation
+type ReconfigureNetworkOperationState struct {
+	// Subnets specifies the new pod and service subnets
+	Subnets Subnets `json:"subnets"`
+	// VxlanPort specifies the new overlay network port
+	VxlanPort int `json:"vxlan_port"`
+	// PrevSubnets specifies the pod and service subnets before the operation
+	PrevSubnets Subnets `json:"prev_subnets"`
+	// PrevVxlanPort specifies the overlay network port before the operation
+	PrevVxlanPort int `json:"prev_vxlan_port"`
+}
+
+// ReconfigureNodeOperationState describes the state of the operation
+// that changes the advertise address of a node
+type ReconfigureNodeOperationState struct {
+	// Server is the node being reconfigured as recorded before the operation
+	Server Server `json:"server"`
+	// AdvertiseAddr is the new advertise address of the node
+	AdvertiseAddr string `json:"advertise_addr"`
+}
+
+// Target returns the copy of the node record with the new advertise address
+func (s ReconfigureNodeOperationState) Target() Server {
+	server := s.Server
+	server.AdvertiseIP = s.AdvertiseAddr
+	return server
+}
+
+// ReconfigureDockerOperationState describes the state of the operation
+// that migrates a node to a different Docker storage driver
+type ReconfigureDockerOperationState struct {
+	// Server is the node being reconfigured as recorded before the operation
+	Server Server `json:"server"`
+	// StorageDriver is the new Docker storage driver of the node
+	StorageDriver string `json:"storage_driver"`
+	// PrevStorageDriver is the Docker storage driver of the node before the operation
+	PrevStorageDriver string `json:"prev_storage_driver"`
+}
+
+// RolloutStrategy defines how regular nodes are updated during the update operation
+type RolloutStrategy struct {
+	// Canary specifies whether a single regular node is updated first.
+	// The update pauses for approval once the canary node has passed
+	// the health checks and the application status hook
+	Canary bool `json:"canary,omitempty"`
+	// BatchSize is the number of regular nodes updated in parallel.
+	// Nodes are updated one by one if unspecified
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// Check makes sure the rollout strategy is valid
+func (s RolloutStrategy) Check() error {
+	if s.BatchSize < 0 {
+		return trace.BadParameter("batch size should be a positive number, got %v", s.BatchSize)
+	}
+	return nil
+}
+
+// IsSet returns true if the strategy requests a canary or a batched rollout
+func (s RolloutStrategy) IsSet() bool {
+	return s.Canary || s.BatchSize > 0
+}
+
+// GetBatchSize returns the number of regular nodes updated in parallel
+func (s RolloutStrategy) GetBatchSize() int {
+	if s.BatchSize < 1 {
+		return 1
+	}
+	return s.BatchSize
+}
+
+// String returns a textual representation of the rollout strategy
+func (s RolloutStrategy) String() string {
+	var parts []string
+	if s.Canary {
+		parts = append(parts, "canary")
+	}
+	if s.GetBatchSize() == 1 {
+		parts = append(parts, "one node at a time")
+	} else {
+		parts = append(parts, fmt.Sprintf("batches of %v nodes", s.BatchSize))
+	}
+	return strings.Join(parts, ", ")
 }
 
 // Package returns the update package locator
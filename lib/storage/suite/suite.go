@@ -1897,3 +1897,55 @@ func (s *StorageSuite) ClusterLogin(c *C) {
 	c.Assert(login.Email, Equals, anotherAgentEmail)
 	c.Assert(login.Password, Equals, anotherAgentKey)
 }
+
+func (s *StorageSuite) SchedulesCRUD(c *C) {
+	cluster, err := s.Backend.CreateSite(storage.Site{
+		AccountID: defaults.SystemAccountID,
+		Domain:    "t1",
+		Created:   now,
+	})
+	c.Assert(err, IsNil)
+
+	schedule := storage.Schedule{
+		ClusterName: cluster.Domain,
+		Operation:   storage.ScheduledGarbageCollect,
+		Window: storage.MaintenanceWindow{
+			Days:     []string{"sat", "sun"},
+			Start:    "02:00",
+			Duration: 4 * time.Hour,
+		},
+		State:   storage.ScheduleStatePending,
+		Created: now,
+		Updated: now,
+	}
+	out, err := s.Backend.CreateSchedule(schedule)
+	c.Assert(err, IsNil)
+	c.Assert(out.ID, Not(Equals), "")
+	schedule.ID = out.ID
+
+	out, err = s.Backend.GetSchedule(cluster.Domain, schedule.ID)
+	c.Assert(err, IsNil)
+	c.Assert(*out, DeepEquals, schedule)
+
+	schedule.State = storage.ScheduleStateRunning
+	schedule.OperationID = "op1"
+	_, err = s.Backend.UpdateSchedule(schedule)
+	c.Assert(err, IsNil)
+
+	schedules, err := s.Backend.GetSchedules(cluster.Domain)
+	c.Assert(err, IsNil)
+	c.Assert(schedules, DeepEquals, []storage.Schedule{schedule})
+
+	_, err = s.Backend.CreateSchedule(storage.Schedule{
+		ClusterName: cluster.Domain,
+		Operation:   storage.ScheduledUpdate,
+		Window:      schedule.Window,
+	})
+	c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("update schedule without app"))
+
+	err = s.Backend.DeleteSchedule(cluster.Domain, schedule.ID)
+	c.Assert(err, IsNil)
+
+	_, err = s.Backend.GetSchedule(cluster.Domain, schedule.ID)
+	c.Assert(trace.IsNotFound(err), Equals, true)
+}
@@ -19,6 +19,7 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/gravitational/gravity/lib/defaults"
@@ -229,7 +230,7 @@ type SystemSpecV2 struct {
 func (r SystemV2) String() string {
 	var ifaces []string
 	for name, iface := range r.Spec.NetworkInterfaces {
-		ifaces = append(ifaces, fmt.Sprintf("%v=%v", name, iface.IPv4))
+		ifaces = append(ifaces, fmt.Sprintf("%v=%v", name, strings.Join(iface.Addrs(), "/")))
 	}
 	return fmt.Sprintf("sysinfo(hostname=%v, interfaces=%v, cpus=%v, ramMB=%v, OS=%v, user=%v, lvm_dir=%v)",
 		r.Spec.Hostname,
@@ -264,6 +265,7 @@ const SystemSpecV2Schema = `{
         "required": ["ipv4_addr", "name"],
         "properties": {
           "ipv4_addr": {"type": "string"},
+          "ipv6_addr": {"type": "string"},
           "name": {"type": "string"}
         }
       }
@@ -410,10 +412,38 @@ type Swap struct {
 type NetworkInterface struct {
 	// IPv4 address assigned to the interface
 	IPv4 string `json:"ipv4_addr"`
+	// IPv6 is the global IPv6 address assigned to the interface
+	IPv6 string `json:"ipv6_addr,omitempty"`
 	// Name is the interface name
 	Name string `json:"name"`
 }
 
+// Addrs returns all IP addresses assigned to this interface.
+// The IPv4 address, if present, is always first
+func (r NetworkInterface) Addrs() (addrs []string) {
+	if r.IPv4 != "" {
+		addrs = append(addrs, r.IPv4)
+	}
+	if r.IPv6 != "" {
+		addrs = append(addrs, r.IPv6)
+	}
+	return addrs
+}
+
+// HasAddr returns true if the specified IP address is assigned to this interface
+func (r NetworkInterface) HasAddr(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ifaceAddr := range r.Addrs() {
+		if ip.Equal(net.ParseIP(ifaceAddr)) {
+			return true
+		}
+	}
+	return false
+}
+
 // Process represents a running process
 type Process struct {
 	// Name is the process executable name
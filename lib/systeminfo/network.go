@@ -37,14 +37,15 @@ func HasInterface(addr string) error {
 	}
 
 	for _, iface := range ifaces {
-		if iface.IPv4 == addr {
+		if iface.HasAddr(addr) {
 			return nil
 		}
 	}
 	return trace.NotFound("interface %q not found on this machine", addr)
 }
 
-// NetworkInterfaces returns the list of all network interfaces with IPv4 addresses on the host
+// NetworkInterfaces returns the list of all network interfaces with IPv4 or
+// global IPv6 addresses on the host
 func NetworkInterfaces() (result []storage.NetworkInterface, err error) {
 	netIfaces, err := net.Interfaces()
 	if err != nil {
@@ -62,21 +63,9 @@ func NetworkInterfaces() (result []storage.NetworkInterface, err error) {
 	return result, nil
 }
 
-// networkInterfaces returns the list of all network interfaces with IPv4 addresses on the host
+// networkInterfaces returns the list of all network interfaces with IPv4 or
+// global IPv6 addresses on the host
 func networkInterfaces(ifaces []net.Interface) (result map[string]storage.NetworkInterface, err error) {
-	getIPv4 := func(addrs []net.Addr) net.IP {
-		for _, ifaddr := range addrs {
-			switch ipnet := ifaddr.(type) {
-			case *net.IPNet:
-				v4 := ipnet.IP.To4()
-				if len(v4) != 0 {
-					return v4
-				}
-			}
-		}
-		return nil
-	}
-
 	result = make(map[string]storage.NetworkInterface)
 	for _, iface := range ifaces {
 		if iface.Name[:2] == "lo" {
@@ -87,14 +76,45 @@ func networkInterfaces(ifaces []net.Interface) (result map[string]storage.Networ
 			return nil, trace.Wrap(err)
 		}
 
-		ip := getIPv4(addrs)
-		// only record interfaces that have IPv4 addresses present
-		if len(ip) != 0 {
+		ipv4, ipv6 := interfaceAddrs(addrs)
+		// only record interfaces that have IP addresses present
+		if len(ipv4) != 0 || len(ipv6) != 0 {
 			result[iface.Name] = storage.NetworkInterface{
 				Name: iface.Name,
-				IPv4: ip.String(),
+				IPv4: formatIP(ipv4),
+				IPv6: formatIP(ipv6),
 			}
 		}
 	}
 	return result, nil
 }
+
+// interfaceAddrs returns the first IPv4 and the first global unicast IPv6
+// address from the specified list of interface addresses.
+// Link-local IPv6 addresses are skipped as they cannot be used to
+// communicate with other nodes without specifying a zone
+func interfaceAddrs(addrs []net.Addr) (ipv4, ipv6 net.IP) {
+	for _, ifaddr := range addrs {
+		ipnet, ok := ifaddr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			if ipv4 == nil {
+				ipv4 = v4
+			}
+			continue
+		}
+		if ipv6 == nil && ipnet.IP.IsGlobalUnicast() {
+			ipv6 = ipnet.IP
+		}
+	}
+	return ipv4, ipv6
+}
+
+func formatIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systeminfo
+
+import (
+	"net"
+
+	. "gopkg.in/check.v1"
+)
+
+type NetworkSuite struct{}
+
+var _ = Suite(&NetworkSuite{})
+
+func (r *NetworkSuite) TestInterfaceAddrs(c *C) {
+	var testCases = []struct {
+		addrs   []string
+		ipv4    string
+		ipv6    string
+		comment string
+	}{
+		{
+			addrs:   []string{"192.168.1.1/24"},
+			ipv4:    "192.168.1.1",
+			comment: "IPv4 only",
+		},
+		{
+			addrs:   []string{"fe80::1/64", "fd00::10/64"},
+			ipv6:    "fd00::10",
+			comment: "IPv6 only, link-local address is skipped",
+		},
+		{
+			addrs:   []string{"fe80::1/64", "2001:db8::1/64", "10.0.0.1/8", "10.0.0.2/8"},
+			ipv4:    "10.0.0.1",
+			ipv6:    "2001:db8::1",
+			comment: "dual-stack",
+		},
+		{
+			addrs:   []string{"fe80::1/64"},
+			comment: "no usable addresses",
+		},
+	}
+	for _, testCase := range testCases {
+		var addrs []net.Addr
+		for _, addr := range testCase.addrs {
+			ip, ipNet, err := net.ParseCIDR(addr)
+			c.Assert(err, IsNil)
+			addrs = append(addrs, &net.IPNet{IP: ip, Mask: ipNet.Mask})
+		}
+		ipv4, ipv6 := interfaceAddrs(addrs)
+		c.Assert(formatIP(ipv4), Equals, testCase.ipv4, Commentf(testCase.comment))
+		c.Assert(formatIP(ipv6), Equals, testCase.ipv6, Commentf(testCase.comment))
+	}
+}
@@ -192,6 +192,19 @@ type PackageServiceStatus struct {
 	Status string
 }
 
+// PackageServiceUnit describes the systemd unit of a package service
+type PackageServiceUnit struct {
+	// Package is the package the service runs
+	Package loc.Locator
+	// ConfigPackage is the configuration package the service is started with
+	ConfigPackage *loc.Locator
+	// DropIns lists drop-in files that override the unit
+	DropIns []string
+	// NeedsReload is whether the unit file has changed on disk
+	// since it was last loaded
+	NeedsReload bool
+}
+
 // ServiceManager is an interface for collaborating with system
 // service managers, e.g. systemd for host packages
 type ServiceManager interface {
@@ -225,6 +238,9 @@ type ServiceManager interface {
 	// StatusPackageService returns status of a package service
 	StatusPackageService(pkg loc.Locator) (string, error)
 
+	// GetPackageServiceUnit returns the systemd unit of a package service
+	GetPackageServiceUnit(pkg loc.Locator) (*PackageServiceUnit, error)
+
 	// InstallService installs a service with the system service manager
 	InstallService(NewServiceRequest) error
 
@@ -118,6 +118,59 @@ func parseUnit(unit string) *loc.Locator {
 	return loc
 }
 
+// parsePackageServiceUnit parses the properties of a package service unit
+// as output by systemctl show.
+//
+// The configuration package is taken from the start command which
+// has the form: gravity package command <command> <package> <config-package>
+func parsePackageServiceUnit(pkg loc.Locator, out string) *PackageServiceUnit {
+	unit := &PackageServiceUnit{Package: pkg}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "ExecStart":
+			unit.ConfigPackage = parseConfigPackage(parts[1])
+		case "DropInPaths":
+			if parts[1] != "" {
+				unit.DropIns = strings.Fields(parts[1])
+			}
+		case "NeedDaemonReload":
+			unit.NeedsReload = parts[1] == "yes"
+		}
+	}
+	return unit
+}
+
+// parseConfigPackage returns the configuration package from the ExecStart
+// property of the unit, e.g.:
+//
+//	{ path=/usr/bin/gravity ; argv[]=/usr/bin/gravity package command start <package> <config-package> ; ... }
+func parseConfigPackage(execStart string) *loc.Locator {
+	start := strings.Index(execStart, "argv[]=")
+	if start == -1 {
+		return nil
+	}
+	argv := execStart[start+len("argv[]="):]
+	if end := strings.Index(argv, " ;"); end != -1 {
+		argv = argv[:end]
+	}
+	args := strings.Fields(argv)
+	for i := 0; i+4 < len(args); i++ {
+		if args[i] != "package" || args[i+1] != "command" {
+			continue
+		}
+		configPackage, err := loc.ParseLocator(args[i+4])
+		if err != nil {
+			return nil
+		}
+		return configPackage
+	}
+	return nil
+}
+
 func (u *systemdUnit) serviceName() string {
 	return strings.Join([]string{
 		servicePrefix, u.pkg.Repository, u.pkg.Name, u.pkg.Version},
@@ -294,6 +347,16 @@ func (s *systemdManager) StatusPackageService(pkg loc.Locator) (string, error) {
 	return s.StatusService(newSystemdUnit(pkg).serviceName())
 }
 
+// GetPackageServiceUnit returns the systemd unit of a package service
+func (s *systemdManager) GetPackageServiceUnit(pkg loc.Locator) (*PackageServiceUnit, error) {
+	out, err := invokeSystemctl("show", newSystemdUnit(pkg).serviceName(),
+		"--property=ExecStart", "--property=DropInPaths", "--property=NeedDaemonReload")
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to show unit: %v", out)
+	}
+	return parsePackageServiceUnit(pkg, out), nil
+}
+
 // InstalService installs a new service with the system service manager
 func (s *systemdManager) InstallService(req NewServiceRequest) error {
 	if err := req.CheckAndSetDefaults(); err != nil {
@@ -170,3 +170,21 @@ WantedBy=local-fs.target
 		c.Assert(out.String(), compare.DeepEquals, testCase.expected, Commentf(testCase.comment))
 	}
 }
+
+func (s *SystemdSuite) TestParsesPackageServiceUnit(c *C) {
+	pkg := loc.MustParseLocator("gravitational.io/planet:0.0.1")
+	configPackage := loc.MustParseLocator("example.com/planet-config-10_0_0_1:0.0.2")
+	unit := parsePackageServiceUnit(pkg, `ExecStart={ path=/usr/bin/gravity ; argv[]=/usr/bin/gravity package command start gravitational.io/planet:0.0.1 example.com/planet-config-10_0_0_1:0.0.2 ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }
+DropInPaths=/etc/systemd/system/gravity__gravitational.io__planet__0.0.1.service.d/override.conf
+NeedDaemonReload=yes
+`)
+	c.Assert(unit, DeepEquals, &PackageServiceUnit{
+		Package:       pkg,
+		ConfigPackage: &configPackage,
+		DropIns:       []string{"/etc/systemd/system/gravity__gravitational.io__planet__0.0.1.service.d/override.conf"},
+		NeedsReload:   true,
+	})
+
+	unit = parsePackageServiceUnit(pkg, "ExecStart=\nDropInPaths=\nNeedDaemonReload=no\n")
+	c.Assert(unit, DeepEquals, &PackageServiceUnit{Package: pkg})
+}
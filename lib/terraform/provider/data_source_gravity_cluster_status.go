@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func dataSourceGravityClusterStatus() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceGravityClusterStatusRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"reason": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"app": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The cluster application package",
+			},
+			"nodes": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"hostname": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"advertise_addr": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"role": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceGravityClusterStatusRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+
+	cluster, err := client.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	nodes := make([]interface{}, 0, len(cluster.ClusterState.Servers))
+	for _, server := range cluster.ClusterState.Servers {
+		nodes = append(nodes, map[string]interface{}{
+			"hostname":       server.Hostname,
+			"advertise_addr": server.AdvertiseIP,
+			"role":           server.Role,
+		})
+	}
+
+	d.SetId(cluster.Domain)
+	d.Set("name", cluster.Domain)
+	d.Set("state", cluster.State)
+	d.Set("reason", string(cluster.Reason))
+	d.Set("app", cluster.App.Package.String())
+	if err := d.Set("nodes", nodes); err != nil {
+		return trace.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func dataSourceGravityEndpoints() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceGravityEndpointsRead,
+
+		Schema: map[string]*schema.Schema{
+			"endpoints": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"description": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"addresses": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceGravityEndpointsRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	endpoints, err := client.GetApplicationEndpoints(clusterKey)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	result := make([]interface{}, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		result = append(result, map[string]interface{}{
+			"name":        endpoint.Name,
+			"description": endpoint.Description,
+			"addresses":   endpoint.Addresses,
+		})
+	}
+
+	d.SetId(clusterKey.SiteDomain)
+	if err := d.Set("endpoints", result); err != nil {
+		return trace.Wrap(err)
+	}
+
+	return nil
+}
@@ -38,6 +38,18 @@ func Provider() terraform.ResourceProvider {
 			"gravity_log_forwarder":           resourceGravityLogForwarder(),
 			"gravity_tlskeypair":              resourceGravityTLSKeyPair(),
 			"gravity_cluster_auth_preference": resourceGravityClusterAuthPreference(),
+			"gravity_alert":                   resourceGravityAlert(),
+			"gravity_alert_target":            resourceGravityAlertTarget(),
+			"gravity_smtp":                    resourceGravitySMTP(),
+			"gravity_oidc_connector":          resourceGravityOIDC(),
+			"gravity_saml_connector":          resourceGravitySAML(),
+			"gravity_role":                    resourceGravityRole(),
+			"gravity_app_release":             resourceGravityAppRelease(),
+			"gravity_node":                    resourceGravityNode(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"gravity_cluster_status": dataSourceGravityClusterStatus(),
+			"gravity_endpoints":      dataSourceGravityEndpoints(),
 		},
 		ConfigureFunc: providerConfigure,
 	}
@@ -0,0 +1,570 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/helm"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/gravity/lib/ops/opshandler"
+	"github.com/gravitational/gravity/lib/ops/opsservice"
+	"github.com/gravitational/gravity/lib/ops/suite"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/users"
+
+	"github.com/gravitational/trace"
+	tfschema "github.com/hashicorp/terraform/helper/schema"
+	. "gopkg.in/check.v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestProvider(t *testing.T) { TestingT(t) }
+
+type ProviderSuite struct {
+	services  opsservice.TestServices
+	webServer *httptest.Server
+	kube      *httptest.Server
+	releases  *testReleaseClient
+	client    *opsclient.Client
+	cluster   storage.Site
+	app       loc.Locator
+}
+
+var _ = Suite(&ProviderSuite{})
+
+func (s *ProviderSuite) SetUpTest(c *C) {
+	s.kube = httptest.NewServer(newTestKubeAPI())
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: s.kube.URL})
+	c.Assert(err, IsNil)
+
+	s.releases = &testReleaseClient{releases: make(map[string]helm.Release)}
+	s.services = opsservice.SetupTestServicesWithConfig(c, func(config *opsservice.Config) {
+		config.KubeClient = kubeClient
+		config.NewReleaseClient = func() (opsservice.ReleaseClient, error) {
+			return s.releases, nil
+		}
+	})
+
+	role, err := users.NewAdminRole()
+	c.Assert(err, IsNil)
+	c.Assert(s.services.Users.UpsertRole(role, storage.Forever), IsNil)
+	c.Assert(s.services.Users.UpsertUser(storage.NewUser("admin@example.com", storage.UserSpecV2{
+		Password: "admin-password",
+		Type:     storage.AdminUser,
+		Roles:    []string{role.GetName()},
+	})), IsNil)
+
+	s.app = suite.SetUpTestPackage(c, s.services.Apps, s.services.Packages)
+	_, err = s.services.Operator.CreateAccount(ops.NewAccountRequest{
+		ID:  defaults.SystemAccountID,
+		Org: defaults.SystemAccountOrg,
+	})
+	c.Assert(err, IsNil)
+	_, err = s.services.Operator.CreateSite(ops.NewSiteRequest{
+		AppPackage: s.app.String(),
+		AccountID:  defaults.SystemAccountID,
+		Provider:   schema.ProviderOnPrem,
+		DomainName: "example.com",
+	})
+	c.Assert(err, IsNil)
+	cluster, err := s.services.Backend.GetSite("example.com")
+	c.Assert(err, IsNil)
+	cluster.Local = true
+	cluster.State = ops.SiteStateActive
+	cluster.ClusterState.Servers = storage.Servers{
+		{Hostname: "node-1", AdvertiseIP: "192.168.1.1", Role: "master"},
+	}
+	_, err = s.services.Backend.UpdateSite(*cluster)
+	c.Assert(err, IsNil)
+	s.cluster = *cluster
+
+	handler, err := opshandler.NewWebHandler(opshandler.WebHandlerConfig{
+		Users:        s.services.Users,
+		Operator:     s.services.Operator,
+		Applications: s.services.Apps,
+		Packages:     s.services.Packages,
+	})
+	c.Assert(err, IsNil)
+	s.webServer = httptest.NewServer(handler)
+
+	s.client, err = opsclient.NewAuthenticatedClient(
+		s.webServer.URL, "admin@example.com", "admin-password")
+	c.Assert(err, IsNil)
+
+	nodePollInterval = 10 * time.Millisecond
+}
+
+func (s *ProviderSuite) TearDownTest(c *C) {
+	if s.webServer != nil {
+		s.webServer.Close()
+	}
+	if s.kube != nil {
+		s.kube.Close()
+	}
+	if s.services.Backend != nil {
+		c.Assert(s.services.Backend.Close(), IsNil)
+	}
+	os.RemoveAll(s.services.Dir)
+}
+
+func (s *ProviderSuite) TestProviderSchema(c *C) {
+	provider := Provider().(*tfschema.Provider)
+	c.Assert(provider.InternalValidate(), IsNil)
+}
+
+func (s *ProviderSuite) TestAlert(c *C) {
+	resource := resourceGravityAlert()
+	d := resource.Data(nil)
+	c.Assert(d.Set("name", "cpu"), IsNil)
+	c.Assert(d.Set("formula", "cpu > 90"), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+	c.Assert(d.Id(), Equals, "cpu")
+
+	c.Assert(d.Set("formula", "cpu > 95"), IsNil)
+	c.Assert(resource.Update(d, s.client), IsNil)
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("name", "cpu"), IsNil)
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("formula"), Equals, "cpu > 95")
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestAlertTarget(c *C) {
+	resource := resourceGravityAlertTarget()
+	d := resource.Data(nil)
+	c.Assert(d.Set("name", "ops"), IsNil)
+	c.Assert(d.Set("slack", []interface{}{map[string]interface{}{
+		"url":     "https://hooks.slack.com/services/xxx",
+		"channel": "#alerts",
+	}}), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+
+	// the redacted webhook address is kept from the state
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("slack.0.url"), Equals, "https://hooks.slack.com/services/xxx")
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("name", "ops"), IsNil)
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("slack.0.url"), Equals, "")
+	c.Assert(d.Get("slack.0.channel"), Equals, "#alerts")
+	c.Assert(d.Get("email"), Equals, "")
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestSMTP(c *C) {
+	resource := resourceGravitySMTP()
+	d := resource.Data(nil)
+	c.Assert(d.Set("host", "smtp.example.com"), IsNil)
+	c.Assert(d.Set("port", 465), IsNil)
+	c.Assert(d.Set("username", "postmaster"), IsNil)
+	c.Assert(d.Set("password", "secret"), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+	c.Assert(d.Id(), Equals, storage.KindSMTPConfig)
+
+	d = resource.Data(nil)
+	d.SetId(storage.KindSMTPConfig)
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("host"), Equals, "smtp.example.com")
+	c.Assert(d.Get("port"), Equals, 465)
+	c.Assert(d.Get("username"), Equals, "postmaster")
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestOIDCConnector(c *C) {
+	resource := resourceGravityOIDC()
+	d := resource.Data(nil)
+	c.Assert(d.Set("name", "example"), IsNil)
+	c.Assert(d.Set("issuer_url", "https://accounts.example.com"), IsNil)
+	c.Assert(d.Set("client_id", "id"), IsNil)
+	c.Assert(d.Set("client_secret", "secret"), IsNil)
+	c.Assert(d.Set("redirect_url", "https://example.com/portalapi/v1/oidc/callback"), IsNil)
+	c.Assert(d.Set("claims_to_roles", []interface{}{map[string]interface{}{
+		"claim": "groups",
+		"value": "admins",
+		"roles": []interface{}{"@teleadmin"},
+	}}), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("name", "example"), IsNil)
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("issuer_url"), Equals, "https://accounts.example.com")
+	c.Assert(d.Get("client_secret"), Equals, "secret")
+	c.Assert(d.Get("claims_to_roles").(*tfschema.Set).Len(), Equals, 1)
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestRole(c *C) {
+	resource := resourceGravityRole()
+	d := resource.Data(nil)
+	c.Assert(d.Set("name", "developers"), IsNil)
+	c.Assert(d.Set("max_session_ttl", "8h0m0s"), IsNil)
+	c.Assert(d.Set("allow", []interface{}{map[string]interface{}{
+		"logins":            []interface{}{"ubuntu"},
+		"kubernetes_groups": []interface{}{"viewers"},
+		"node_labels":       map[string]interface{}{"env": "dev,qa"},
+		"rules": []interface{}{map[string]interface{}{
+			"resources": []interface{}{"app"},
+			"verbs":     []interface{}{"list", "read"},
+		}},
+	}}), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("name", "developers"), IsNil)
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("max_session_ttl"), Equals, "8h0m0s")
+	c.Assert(d.Get("allow.0.logins"), DeepEquals, []interface{}{"ubuntu"})
+	c.Assert(d.Get("allow.0.node_labels"), DeepEquals, map[string]interface{}{"env": "dev,qa"})
+	c.Assert(d.Get("allow.0.rules.0.verbs"), DeepEquals, []interface{}{"list", "read"})
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestAppRelease(c *C) {
+	resource := resourceGravityAppRelease()
+	d := resource.Data(nil)
+	c.Assert(d.Set("name", "app"), IsNil)
+	c.Assert(d.Set("app", s.app.String()), IsNil)
+	c.Assert(d.Set("namespace", "default"), IsNil)
+	c.Assert(d.Set("set", map[string]interface{}{"replicas": "3", "image.tag": "1.0"}), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+	c.Assert(d.Id(), Equals, "app")
+	c.Assert(d.Get("revision"), Equals, 1)
+	c.Assert(s.releases.lastSet, DeepEquals, []string{"image.tag=1.0", "replicas=3"})
+	c.Assert(s.releases.lastContext.Cluster.Name, Equals, "example.com")
+
+	c.Assert(d.Set("values", "replicas: 5"), IsNil)
+	c.Assert(resource.Update(d, s.client), IsNil)
+	c.Assert(d.Get("revision"), Equals, 2)
+
+	d = resource.Data(nil)
+	d.SetId("app")
+	c.Assert(resource.Read(d, s.client), IsNil)
+	c.Assert(d.Get("status"), Equals, "DEPLOYED")
+	c.Assert(d.Get("namespace"), Equals, "default")
+
+	c.Assert(resource.Delete(d, s.client), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestNode(c *C) {
+	resource := resourceGravityNode()
+	d := resource.Data(nil)
+	c.Assert(d.Set("advertise_addr", "192.168.1.1"), IsNil)
+	c.Assert(d.Set("role", "master"), IsNil)
+	c.Assert(resource.Create(d, s.client), IsNil)
+	c.Assert(d.Id(), Equals, "192.168.1.1")
+	c.Assert(d.Get("hostname"), Equals, "node-1")
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("advertise_addr", "192.168.1.1"), IsNil)
+	c.Assert(d.Set("role", "worker"), IsNil)
+	err := resource.Create(d, s.client)
+	c.Assert(trace.IsBadParameter(err), Equals, true, Commentf("%v", err))
+
+	d = resource.Data(nil)
+	c.Assert(d.Set("advertise_addr", "192.168.1.2"), IsNil)
+	exists, err := resource.Exists(d, s.client)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *ProviderSuite) TestNodeFailedExpand(c *C) {
+	_, err := s.services.Backend.CreateSiteOperation(storage.SiteOperation{
+		ID:         "op-1",
+		AccountID:  s.cluster.AccountID,
+		SiteDomain: s.cluster.Domain,
+		Type:       ops.OperationExpand,
+		Created:    time.Now().UTC(),
+		State:      ops.OperationStateFailed,
+		Servers: []storage.Server{
+			{Hostname: "node-2", AdvertiseIP: "192.168.1.2", Role: "worker"},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	resource := resourceGravityNode()
+	d := resource.Data(nil)
+	c.Assert(d.Set("advertise_addr", "192.168.1.2"), IsNil)
+	err = resourceGravityNodeCreate(d, s.client)
+	c.Assert(err, ErrorMatches, "operation op-1 adding node 192.168.1.2 has failed")
+}
+
+func (s *ProviderSuite) TestClusterStatus(c *C) {
+	source := dataSourceGravityClusterStatus()
+	d := source.Data(nil)
+	c.Assert(source.Read(d, s.client), IsNil)
+	c.Assert(d.Get("name"), Equals, "example.com")
+	c.Assert(d.Get("state"), Equals, ops.SiteStateActive)
+	c.Assert(d.Get("app"), Equals, s.app.String())
+	c.Assert(d.Get("nodes"), DeepEquals, []interface{}{map[string]interface{}{
+		"hostname":       "node-1",
+		"advertise_addr": "192.168.1.1",
+		"role":           "master",
+	}})
+}
+
+func (s *ProviderSuite) TestEndpoints(c *C) {
+	source := dataSourceGravityEndpoints()
+	d := source.Data(nil)
+	c.Assert(source.Read(d, s.client), IsNil)
+	c.Assert(d.Id(), Equals, "example.com")
+	c.Assert(d.Get("endpoints"), DeepEquals, []interface{}{})
+}
+
+// testReleaseClient is an in-memory release client
+type testReleaseClient struct {
+	sync.Mutex
+	releases    map[string]helm.Release
+	lastSet     []string
+	lastContext *helm.ValuesContext
+}
+
+func (r *testReleaseClient) Install(p helm.InstallParameters) (*helm.Release, error) {
+	r.Lock()
+	defer r.Unlock()
+	if _, err := os.Stat(p.Path); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	if _, ok := r.releases[p.Name]; ok {
+		return nil, trace.AlreadyExists("release %v already exists", p.Name)
+	}
+	r.lastSet, r.lastContext = p.Set, p.Context
+	release := helm.Release{
+		Name:      p.Name,
+		Namespace: p.Namespace,
+		Status:    "DEPLOYED",
+		Chart:     "app-0.0.1",
+		Revision:  1,
+		Updated:   time.Now().UTC(),
+	}
+	r.releases[p.Name] = release
+	return &release, nil
+}
+
+func (r *testReleaseClient) List(helm.ListParameters) ([]helm.Release, error) {
+	r.Lock()
+	defer r.Unlock()
+	var releases []helm.Release
+	for _, release := range r.releases {
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+func (r *testReleaseClient) Get(name string) (*helm.Release, error) {
+	r.Lock()
+	defer r.Unlock()
+	release, ok := r.releases[name]
+	if !ok {
+		return nil, trace.NotFound("release %v not found", name)
+	}
+	return &release, nil
+}
+
+func (r *testReleaseClient) Upgrade(p helm.UpgradeParameters) (*helm.Release, error) {
+	r.Lock()
+	defer r.Unlock()
+	release, ok := r.releases[p.Release]
+	if !ok {
+		return nil, trace.NotFound("release %v not found", p.Release)
+	}
+	for _, path := range p.Values {
+		if _, err := ioutil.ReadFile(path); err != nil {
+			return nil, trace.ConvertSystemError(err)
+		}
+	}
+	r.lastSet, r.lastContext = p.Set, p.Context
+	release.Revision++
+	release.Updated = time.Now().UTC()
+	r.releases[p.Release] = release
+	return &release, nil
+}
+
+func (r *testReleaseClient) Uninstall(name string) (*helm.Release, error) {
+	r.Lock()
+	defer r.Unlock()
+	release, ok := r.releases[name]
+	if !ok {
+		return nil, trace.NotFound("release %v not found", name)
+	}
+	delete(r.releases, name)
+	release.Status = "DELETED"
+	return &release, nil
+}
+
+func (r *testReleaseClient) Close() error {
+	return nil
+}
+
+// testKubeAPI is a minimal in-memory Kubernetes API server that stores
+// namespaced objects and serves empty lists for everything else
+type testKubeAPI struct {
+	sync.Mutex
+	// objects maps namespace/resource to the objects stored by name
+	objects map[string]map[string]map[string]interface{}
+}
+
+func newTestKubeAPI() *testKubeAPI {
+	return &testKubeAPI{objects: make(map[string]map[string]map[string]interface{})}
+}
+
+// testKubeKinds maps API resources to their kinds
+var testKubeKinds = map[string]string{
+	"configmaps": "ConfigMap",
+	"secrets":    "Secret",
+	"nodes":      "Node",
+	"namespaces": "Namespace",
+	"services":   "Service",
+}
+
+func (a *testKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+
+	// /api/v1/namespaces/<namespace>/<resource>[/<name>] or /api/v1/<resource>
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1"), "/"), "/")
+	var namespace, resource, name string
+	switch {
+	case len(parts) >= 3 && parts[0] == "namespaces":
+		namespace, resource = parts[1], parts[2]
+		if len(parts) > 3 {
+			name = parts[3]
+		}
+	case len(parts) == 1:
+		resource = parts[0]
+	default:
+		writeKubeStatus(w, http.StatusNotFound, "NotFound", r.URL.Path)
+		return
+	}
+	kind := testKubeKinds[resource]
+	key := fmt.Sprintf("%v/%v", namespace, resource)
+	objects := a.objects[key]
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		items := []interface{}{}
+		selector := r.URL.Query().Get("labelSelector")
+		for _, object := range objects {
+			if matchesLabels(object, selector) {
+				items = append(items, object)
+			}
+		}
+		writeKubeObject(w, http.StatusOK, map[string]interface{}{
+			"kind":       kind + "List",
+			"apiVersion": "v1",
+			"metadata":   map[string]interface{}{},
+			"items":      items,
+		})
+	case r.Method == http.MethodGet:
+		object, ok := objects[name]
+		if !ok {
+			writeKubeStatus(w, http.StatusNotFound, "NotFound", name)
+			return
+		}
+		writeKubeObject(w, http.StatusOK, object)
+	case r.Method == http.MethodPost || r.Method == http.MethodPut:
+		var object map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&object); err != nil {
+			writeKubeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		metadata, _ := object["metadata"].(map[string]interface{})
+		objectName, _ := metadata["name"].(string)
+		if _, ok := objects[objectName]; ok && r.Method == http.MethodPost {
+			writeKubeStatus(w, http.StatusConflict, "AlreadyExists", objectName)
+			return
+		}
+		if objects == nil {
+			objects = make(map[string]map[string]interface{})
+			a.objects[key] = objects
+		}
+		object["kind"], object["apiVersion"] = kind, "v1"
+		objects[objectName] = object
+		writeKubeObject(w, http.StatusOK, object)
+	case r.Method == http.MethodDelete:
+		if _, ok := objects[name]; !ok {
+			writeKubeStatus(w, http.StatusNotFound, "NotFound", name)
+			return
+		}
+		delete(objects, name)
+		writeKubeStatus(w, http.StatusOK, "", name)
+	default:
+		writeKubeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// matchesLabels returns true if the object labels match the selector
+// in key=value[,key=value] format
+func matchesLabels(object map[string]interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	metadata, _ := object["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	for _, requirement := range strings.Split(selector, ",") {
+		parts := strings.SplitN(requirement, "=", 2)
+		if len(parts) != 2 || labels[parts[0]] != parts[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeKubeObject(w http.ResponseWriter, code int, object interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(object)
+}
+
+func writeKubeStatus(w http.ResponseWriter, code int, reason, message string) {
+	status := "Failure"
+	if code == http.StatusOK {
+		status = "Success"
+	}
+	writeKubeObject(w, code, map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     status,
+		"reason":     reason,
+		"message":    message,
+		"code":       code,
+	})
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"log"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravityAlert() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravityAlertCreateOrUpdate,
+		Read:   resourceGravityAlertRead,
+		Update: resourceGravityAlertCreateOrUpdate,
+		Delete: resourceGravityAlertDelete,
+		Exists: resourceGravityAlertExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the alert",
+			},
+			"formula": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The Kapacitor formula of the alert",
+			},
+		},
+	}
+}
+
+func resourceGravityAlertCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+	alert := storage.NewAlert(name, storage.AlertSpecV2{
+		Formula: d.Get("formula").(string),
+	})
+	if err := alert.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = client.UpdateAlert(clusterKey, alert)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Alert %s updated", name)
+	d.SetId(name)
+	return nil
+}
+
+func resourceGravityAlertRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	alerts, err := client.GetAlerts(clusterKey)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	for _, alert := range alerts {
+		if alert.GetName() == name {
+			d.Set("formula", alert.GetFormula())
+			return nil
+		}
+	}
+
+	return trace.NotFound("alert %v not found", name)
+}
+
+func resourceGravityAlertDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	err = client.DeleteAlert(clusterKey, name)
+	return trace.Wrap(err)
+}
+
+func resourceGravityAlertExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravityAlertRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"log"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravityAlertTarget() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravityAlertTargetCreateOrUpdate,
+		Read:   resourceGravityAlertTargetRead,
+		Update: resourceGravityAlertTargetCreateOrUpdate,
+		Delete: resourceGravityAlertTargetDelete,
+		Exists: resourceGravityAlertTargetExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the alert target",
+			},
+			"email": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The email address alerts are sent to",
+				ConflictsWith: []string{"webhook", "slack", "pagerduty"},
+			},
+			"webhook": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Description:   "The generic HTTP webhook alerts are posted to",
+				ConflictsWith: []string{"email", "slack", "pagerduty"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"url": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"payload": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"secret": {
+							Type:      schema.TypeString,
+							Optional:  true,
+							Sensitive: true,
+						},
+						"headers": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+			"slack": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Description:   "The Slack-compatible chat webhook alerts are posted to",
+				ConflictsWith: []string{"email", "webhook", "pagerduty"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"url": {
+							Type:      schema.TypeString,
+							Required:  true,
+							Sensitive: true,
+						},
+						"channel": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"username": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"pagerduty": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Description:   "The PagerDuty-compatible service alerts are routed to",
+				ConflictsWith: []string{"email", "webhook", "slack"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"routing_key": {
+							Type:      schema.TypeString,
+							Required:  true,
+							Sensitive: true,
+						},
+						"url": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func resourceGravityAlertTargetCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+	target := storage.NewAlertTarget(name, newAlertTargetSpec(d))
+	if err := target.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = client.UpdateAlertTarget(clusterKey, target)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Alert target %s updated", name)
+	d.SetId(name)
+	return nil
+}
+
+func newAlertTargetSpec(d *schema.ResourceData) storage.AlertTargetSpecV2 {
+	spec := storage.AlertTargetSpecV2{
+		Email: d.Get("email").(string),
+	}
+	if v, ok := d.GetOk("webhook.0"); ok {
+		webhook := v.(map[string]interface{})
+		spec.Webhook = &storage.AlertWebhook{
+			URL:     webhook["url"].(string),
+			Payload: webhook["payload"].(string),
+			Secret:  webhook["secret"].(string),
+			Headers: ExpandStringMap(webhook["headers"].(map[string]interface{})),
+		}
+	}
+	if v, ok := d.GetOk("slack.0"); ok {
+		slack := v.(map[string]interface{})
+		spec.Slack = &storage.AlertSlack{
+			URL:      slack["url"].(string),
+			Channel:  slack["channel"].(string),
+			Username: slack["username"].(string),
+		}
+	}
+	if v, ok := d.GetOk("pagerduty.0"); ok {
+		pagerDuty := v.(map[string]interface{})
+		spec.PagerDuty = &storage.AlertPagerDuty{
+			RoutingKey: pagerDuty["routing_key"].(string),
+			URL:        pagerDuty["url"].(string),
+		}
+	}
+	return spec
+}
+
+func resourceGravityAlertTargetRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	targets, err := client.GetAlertTargets(clusterKey)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	for _, target := range targets {
+		if target.GetName() != name {
+			continue
+		}
+		// credentials are redacted by the cluster so the values
+		// are taken from the state before it is updated
+		var webhook, slack, pagerDuty []interface{}
+		if target := target.GetWebhook(); target != nil {
+			webhook = []interface{}{map[string]interface{}{
+				"url":     target.URL,
+				"payload": target.Payload,
+				"secret":  unredacted(d, "webhook.0.secret", target.Secret),
+				"headers": target.Headers,
+			}}
+		}
+		if target := target.GetSlack(); target != nil {
+			slack = []interface{}{map[string]interface{}{
+				"url":      unredacted(d, "slack.0.url", target.URL),
+				"channel":  target.Channel,
+				"username": target.Username,
+			}}
+		}
+		if target := target.GetPagerDuty(); target != nil {
+			pagerDuty = []interface{}{map[string]interface{}{
+				"routing_key": unredacted(d, "pagerduty.0.routing_key", target.RoutingKey),
+				"url":         target.URL,
+			}}
+		}
+		d.Set("email", target.GetEmail())
+		d.Set("webhook", webhook)
+		d.Set("slack", slack)
+		d.Set("pagerduty", pagerDuty)
+		return nil
+	}
+
+	return trace.NotFound("alert target %v not found", name)
+}
+
+// unredacted returns the value of the attribute specified with key from the
+// state if the cluster returned a redacted value
+func unredacted(d *schema.ResourceData, key, value string) string {
+	if value == storage.RedactedValue {
+		return d.Get(key).(string)
+	}
+	return value
+}
+
+func resourceGravityAlertTargetDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	err = client.DeleteAlertTarget(clusterKey, name)
+	return trace.Wrap(err)
+}
+
+func resourceGravityAlertTargetExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravityAlertTargetRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
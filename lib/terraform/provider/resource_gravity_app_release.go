@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravityAppRelease() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravityAppReleaseCreate,
+		Read:   resourceGravityAppReleaseRead,
+		Update: resourceGravityAppReleaseUpdate,
+		Delete: resourceGravityAppReleaseDelete,
+		Exists: resourceGravityAppReleaseExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the release",
+			},
+			"app": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The application image or chart to deploy, e.g. charts/nginx:1.0.0",
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     "default",
+				Description: "The namespace to install the release into",
+			},
+			"values": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The contents of the values file to deploy the release with",
+			},
+			"values_template": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether the values file is a template referencing the cluster facts",
+			},
+			"set": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "The values to deploy the release with",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"chart": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"revision": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceGravityAppReleaseCreate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+	locator, err := loc.ParseLocator(d.Get("app").(string))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	release, err := client.InstallRelease(ops.InstallReleaseRequest{
+		AccountID:      clusterKey.AccountID,
+		SiteDomain:     clusterKey.SiteDomain,
+		Locator:        *locator,
+		Name:           name,
+		Namespace:      d.Get("namespace").(string),
+		Values:         []byte(d.Get("values").(string)),
+		ValuesTemplate: d.Get("values_template").(bool),
+		Set:            releaseValues(d),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Release %s installed from %s", release.Name, locator)
+	d.SetId(release.Name)
+	setRelease(d, *release)
+	return nil
+}
+
+func resourceGravityAppReleaseRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	release, err := client.GetRelease(clusterKey, d.Id())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	d.Set("namespace", release.Namespace)
+	setRelease(d, *release)
+	return nil
+}
+
+func resourceGravityAppReleaseUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	locator, err := loc.ParseLocator(d.Get("app").(string))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	release, err := client.UpgradeRelease(ops.UpgradeReleaseRequest{
+		AccountID:      clusterKey.AccountID,
+		SiteDomain:     clusterKey.SiteDomain,
+		Release:        d.Id(),
+		Locator:        *locator,
+		Values:         []byte(d.Get("values").(string)),
+		ValuesTemplate: d.Get("values_template").(bool),
+		Set:            releaseValues(d),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Release %s upgraded to %s", release.Name, locator)
+	setRelease(d, *release)
+	return nil
+}
+
+func resourceGravityAppReleaseDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	_, err = client.UninstallRelease(clusterKey, d.Id())
+	return trace.Wrap(err)
+}
+
+func resourceGravityAppReleaseExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravityAppReleaseRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
+
+// releaseValues returns the values set on the release in key=value format
+// sorted by key
+func releaseValues(d *schema.ResourceData) []string {
+	values := ExpandStringMap(d.Get("set").(map[string]interface{}))
+	result := make([]string, 0, len(values))
+	for key, value := range values {
+		result = append(result, fmt.Sprintf("%v=%v", key, value))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func setRelease(d *schema.ResourceData, release ops.Release) {
+	d.Set("status", release.Status)
+	d.Set("chart", release.Chart)
+	d.Set("revision", release.Revision)
+}
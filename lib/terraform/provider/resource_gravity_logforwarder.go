@@ -34,7 +34,17 @@ func resourceGravityLogForwarder() *schema.Resource {
 			},
 			"protocol": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+			},
+			"output": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  storage.LogForwarderOutputSyslog,
+			},
+			"format": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
 			},
 		},
 	}
@@ -48,10 +58,7 @@ func resourceGravityLogForwarderCreate(d *schema.ResourceData, m interface{}) er
 	}
 
 	name := d.Get("name").(string)
-	address := d.Get("address").(string)
-	protocol := d.Get("protocol").(string)
-
-	forwarder := storage.NewLogForwarder(name, address, protocol)
+	forwarder := newLogForwarder(d)
 
 	err = client.CreateLogForwarder(clusterKey, forwarder)
 	if err != nil {
@@ -80,6 +87,8 @@ func resourceGravityLogForwarderRead(d *schema.ResourceData, m interface{}) erro
 		if forwarder.GetName() == name {
 			d.Set("address", forwarder.GetAddress())
 			d.Set("protocol", forwarder.GetProtocol())
+			d.Set("output", forwarder.GetOutput())
+			d.Set("format", forwarder.GetFormat())
 			return nil
 		}
 	}
@@ -94,16 +103,22 @@ func resourceGravityLogForwarderUpdate(d *schema.ResourceData, m interface{}) er
 		return trace.Wrap(err)
 	}
 
-	name := d.Get("name").(string)
-	address := d.Get("address").(string)
-	protocol := d.Get("protocol").(string)
-
-	forwarder := storage.NewLogForwarder(name, address, protocol)
+	forwarder := newLogForwarder(d)
 
 	err = client.UpdateLogForwarder(clusterKey, forwarder)
 	return trace.Wrap(err)
 }
 
+func newLogForwarder(d *schema.ResourceData) storage.LogForwarder {
+	forwarder := storage.NewLogForwarder(
+		d.Get("name").(string),
+		d.Get("address").(string),
+		d.Get("protocol").(string)).(*storage.LogForwarderV2)
+	forwarder.Spec.Output = d.Get("output").(string)
+	forwarder.Spec.Format = d.Get("format").(string)
+	return forwarder
+}
+
 func resourceGravityLogForwarderDelete(d *schema.ResourceData, m interface{}) error {
 	client := m.(*opsclient.Client)
 	clusterKey, err := client.LocalClusterKey()
@@ -0,0 +1,230 @@
+package provider
+
+import (
+	"log"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// nodePollInterval is how often the node state is polled while waiting
+// for a node to join or leave the cluster
+var nodePollInterval = 5 * time.Second
+
+func resourceGravityNode() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravityNodeCreate,
+		Read:   resourceGravityNodeRead,
+		Update: resourceGravityNodeUpdate,
+		Delete: resourceGravityNodeDelete,
+		Exists: resourceGravityNodeExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(30 * time.Minute),
+			Delete: schema.DefaultTimeout(30 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"advertise_addr": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The advertise IP address of the node",
+			},
+			"role": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "The expected role of the node",
+			},
+			"force": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether to remove the node even if it is offline",
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// resourceGravityNodeCreate waits for the node with the configured advertise
+// address to join the cluster.
+//
+// The node joins the cluster with "gravity join" executed on the node itself,
+// e.g. by a provisioner of the instance resource
+func resourceGravityNodeCreate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	addr := d.Get("advertise_addr").(string)
+	log.Printf("[INFO] Waiting for node %s to join the cluster", addr)
+
+	server, err := waitForNode(client, clusterKey, addr, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	role := d.Get("role").(string)
+	if role != "" && role != server.Role {
+		return trace.BadParameter("node %v joined with role %q, expected %q",
+			addr, server.Role, role)
+	}
+
+	log.Printf("[INFO] Node %s (%s) joined the cluster", server.Hostname, addr)
+	d.SetId(addr)
+	setNode(d, *server)
+	return nil
+}
+
+func resourceGravityNodeRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+
+	cluster, err := client.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	addr := d.Get("advertise_addr").(string)
+	server := cluster.ClusterState.Servers.FindByIP(addr)
+	if server == nil {
+		return trace.NotFound("node %v not found", addr)
+	}
+
+	setNode(d, *server)
+	return nil
+}
+
+// resourceGravityNodeUpdate only records the new settings as the
+// remaining attributes only affect node removal
+func resourceGravityNodeUpdate(d *schema.ResourceData, m interface{}) error {
+	return resourceGravityNodeRead(d, m)
+}
+
+// resourceGravityNodeDelete removes the node from the cluster and waits
+// for the shrink operation to complete
+func resourceGravityNodeDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+
+	cluster, err := client.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	addr := d.Get("advertise_addr").(string)
+	server := cluster.ClusterState.Servers.FindByIP(addr)
+	if server == nil {
+		log.Printf("[INFO] Node %s is not part of the cluster", addr)
+		return nil
+	}
+
+	key, err := client.CreateSiteShrinkOperation(ops.CreateSiteShrinkOperationRequest{
+		AccountID:  cluster.AccountID,
+		SiteDomain: cluster.Domain,
+		Servers:    []string{server.Hostname},
+		Force:      d.Get("force").(bool),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Removing node %s (%s), operation %s", server.Hostname, addr, key.OperationID)
+	return trace.Wrap(waitForOperation(client, *key, d.Timeout(schema.TimeoutDelete)))
+}
+
+func resourceGravityNodeExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravityNodeRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
+
+// waitForNode waits until the node with the specified advertise address is
+// part of the cluster and the expand operation that added it has completed
+func waitForNode(client *opsclient.Client, key ops.SiteKey, addr string, timeout time.Duration) (*storage.Server, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		cluster, err := client.GetLocalSite()
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		operations, err := client.GetSiteOperations(key)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		operation := lastNodeOperation(operations, ops.OperationExpand, addr)
+		if operation != nil && operation.IsFailed() {
+			return nil, trace.CompareFailed("operation %v adding node %v has failed",
+				operation.ID, addr)
+		}
+		server := cluster.ClusterState.Servers.FindByIP(addr)
+		if server != nil && (operation == nil || operation.IsCompleted()) {
+			return server, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, trace.LimitExceeded("timed out waiting for node %v to join the cluster", addr)
+		}
+		time.Sleep(nodePollInterval)
+	}
+}
+
+// waitForOperation waits until the specified operation completes
+func waitForOperation(client *opsclient.Client, key ops.SiteOperationKey, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		operation, err := client.GetSiteOperation(key)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if operation.IsFailed() {
+			return trace.CompareFailed("operation %v has failed", operation.ID)
+		}
+		if operation.IsCompleted() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return trace.LimitExceeded("timed out waiting for operation %v to complete", operation.ID)
+		}
+		time.Sleep(nodePollInterval)
+	}
+}
+
+// lastNodeOperation returns the most recent operation of the specified type
+// that includes the node with the specified advertise address
+func lastNodeOperation(operations ops.SiteOperations, operationType, addr string) *ops.SiteOperation {
+	var last *ops.SiteOperation
+	for _, operation := range operations {
+		if operation.Type != operationType {
+			continue
+		}
+		if storage.Servers(operation.Servers).FindByIP(addr) == nil {
+			continue
+		}
+		if last == nil || operation.Created.After(last.Created) {
+			op := ops.SiteOperation(operation)
+			last = &op
+		}
+	}
+	return last
+}
+
+func setNode(d *schema.ResourceData, server storage.Server) {
+	d.Set("hostname", server.Hostname)
+	d.Set("role", server.Role)
+}
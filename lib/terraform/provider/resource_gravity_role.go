@@ -0,0 +1,243 @@
+package provider
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravityRole() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravityRoleCreateOrUpdate,
+		Read:   resourceGravityRoleRead,
+		Update: resourceGravityRoleCreateOrUpdate,
+		Delete: resourceGravityRoleDelete,
+		Exists: resourceGravityRoleExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the role",
+			},
+			"max_session_ttl": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "The maximum duration of sessions of users with this role, e.g. 30h",
+			},
+			"allow": roleConditionsSchema("The resources users with this role are allowed to access"),
+			"deny":  roleConditionsSchema("The resources users with this role are denied access to"),
+		},
+	}
+}
+
+func roleConditionsSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: description,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"logins": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"kubernetes_groups": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"node_labels": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "Node labels to match, multiple values are comma-separated",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"rules": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"resources": {
+								Type:     schema.TypeList,
+								Required: true,
+								MinItems: 1,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"verbs": {
+								Type:     schema.TypeList,
+								Required: true,
+								MinItems: 1,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"where": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func parseRoleConditions(d *schema.ResourceData, key string) services.RoleConditions {
+	var conditions services.RoleConditions
+	v, ok := d.GetOk(key + ".0")
+	if !ok {
+		return conditions
+	}
+	m := v.(map[string]interface{})
+	conditions.Logins = ExpandStringList(m["logins"].([]interface{}))
+	conditions.KubeGroups = ExpandStringList(m["kubernetes_groups"].([]interface{}))
+	if labels := ExpandStringMap(m["node_labels"].(map[string]interface{})); len(labels) != 0 {
+		conditions.NodeLabels = make(services.Labels, len(labels))
+		for name, value := range labels {
+			conditions.NodeLabels[name] = utils.Strings(strings.Split(value, ","))
+		}
+	}
+	for _, rule := range m["rules"].([]interface{}) {
+		r := rule.(map[string]interface{})
+		conditions.Rules = append(conditions.Rules, services.Rule{
+			Resources: ExpandStringList(r["resources"].([]interface{})),
+			Verbs:     ExpandStringList(r["verbs"].([]interface{})),
+			Where:     r["where"].(string),
+		})
+	}
+	return conditions
+}
+
+func flattenRoleConditions(role services.Role, condition services.RoleConditionType) []interface{} {
+	logins := role.GetLogins(condition)
+	kubeGroups := role.GetKubeGroups(condition)
+	nodeLabels := role.GetNodeLabels(condition)
+	rules := role.GetRules(condition)
+	if len(logins) == 0 && len(kubeGroups) == 0 && len(nodeLabels) == 0 && len(rules) == 0 {
+		return nil
+	}
+	labels := make(map[string]interface{}, len(nodeLabels))
+	for name, values := range nodeLabels {
+		labels[name] = strings.Join(values, ",")
+	}
+	var rulesList []interface{}
+	for _, rule := range rules {
+		rulesList = append(rulesList, map[string]interface{}{
+			"resources": rule.Resources,
+			"verbs":     rule.Verbs,
+			"where":     rule.Where,
+		})
+	}
+	return []interface{}{map[string]interface{}{
+		"logins":            logins,
+		"kubernetes_groups": kubeGroups,
+		"node_labels":       labels,
+		"rules":             rulesList,
+	}}
+}
+
+func resourceGravityRoleCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	spec := services.RoleSpecV3{
+		Allow: parseRoleConditions(d, "allow"),
+		Deny:  parseRoleConditions(d, "deny"),
+	}
+	if v, ok := d.GetOk("max_session_ttl"); ok {
+		ttl, err := time.ParseDuration(v.(string))
+		if err != nil {
+			return trace.BadParameter("invalid max_session_ttl %q: %v", v, err)
+		}
+		spec.Options.MaxSessionTTL = services.NewDuration(ttl)
+	}
+
+	role, err := services.NewRole(name, spec)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = client.UpsertRole(clusterKey, role)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] Role %s created", name)
+	d.SetId(name)
+	return resourceGravityRoleRead(d, m)
+}
+
+func resourceGravityRoleRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	role, err := client.GetRole(clusterKey, name)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	d.Set("max_session_ttl", role.GetOptions().MaxSessionTTL.Value().String())
+	d.Set("allow", flattenRoleConditions(role, services.Allow))
+	d.Set("deny", flattenRoleConditions(role, services.Deny))
+	return nil
+}
+
+func resourceGravityRoleDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	err = client.DeleteRole(clusterKey, name)
+	return trace.Wrap(err)
+}
+
+func resourceGravityRoleExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravityRoleRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
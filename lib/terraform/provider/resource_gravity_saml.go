@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"log"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravitySAML() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravitySAMLCreateOrUpdate,
+		Read:   resourceGravitySAMLRead,
+		Update: resourceGravitySAMLCreateOrUpdate,
+		Delete: resourceGravitySAMLDelete,
+		Exists: resourceGravitySAMLExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the resource",
+			},
+			"acs": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The assertion consumer service URL",
+			},
+			"entity_descriptor": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The XML entity descriptor of the identity provider",
+			},
+			"entity_descriptor_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The URL of the entity descriptor of the identity provider",
+			},
+			"issuer": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"sso": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"audience": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"service_provider_issuer": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"display": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"attributes_to_roles": {
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"roles": {
+							Type:     schema.TypeList,
+							Required: true,
+							MinItems: 1,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func parseAttributeMapping(m map[string]interface{}) services.AttributeMapping {
+	return services.AttributeMapping{
+		Name:  m["name"].(string),
+		Value: m["value"].(string),
+		Roles: ExpandStringList(m["roles"].([]interface{})),
+	}
+}
+
+func resourceGravitySAMLCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	var mappings []services.AttributeMapping
+	if v := d.Get("attributes_to_roles").(*schema.Set); v.Len() > 0 {
+		mappings = make([]services.AttributeMapping, 0, v.Len())
+		for _, v := range v.List() {
+			mappings = append(mappings, parseAttributeMapping(v.(map[string]interface{})))
+		}
+	}
+
+	connector := services.NewSAMLConnector(
+		name,
+		services.SAMLConnectorSpecV2{
+			AssertionConsumerService: d.Get("acs").(string),
+			EntityDescriptor:         d.Get("entity_descriptor").(string),
+			EntityDescriptorURL:      d.Get("entity_descriptor_url").(string),
+			Issuer:                   d.Get("issuer").(string),
+			SSO:                      d.Get("sso").(string),
+			Audience:                 d.Get("audience").(string),
+			ServiceProviderIssuer:    d.Get("service_provider_issuer").(string),
+			Display:                  d.Get("display").(string),
+			AttributesToRoles:        mappings,
+		},
+	)
+
+	err = client.UpsertSAMLConnector(clusterKey, connector)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] SAML connector %s created", name)
+	d.SetId(name)
+	return nil
+}
+
+func resourceGravitySAMLRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	connector, err := client.GetSAMLConnector(clusterKey, name, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	d.Set("acs", connector.GetAssertionConsumerService())
+	d.Set("entity_descriptor", connector.GetEntityDescriptor())
+	d.Set("entity_descriptor_url", connector.GetEntityDescriptorURL())
+	d.Set("issuer", connector.GetIssuer())
+	d.Set("sso", connector.GetSSO())
+	d.Set("audience", connector.GetAudience())
+	d.Set("service_provider_issuer", connector.GetServiceProviderIssuer())
+	d.Set("display", connector.GetDisplay())
+
+	var attributesToRoles []interface{}
+	for _, mapping := range connector.GetAttributesToRoles() {
+		attributesToRoles = append(attributesToRoles, map[string]interface{}{
+			"name":  mapping.Name,
+			"value": mapping.Value,
+			"roles": mapping.Roles,
+		})
+	}
+	d.Set("attributes_to_roles", attributesToRoles)
+
+	return nil
+}
+
+func resourceGravitySAMLDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	name := d.Get("name").(string)
+
+	err = client.DeleteSAMLConnector(clusterKey, name)
+	return trace.Wrap(err)
+}
+
+func resourceGravitySAMLExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravitySAMLRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
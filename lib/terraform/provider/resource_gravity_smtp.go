@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"log"
+	"time"
+
+	"github.com/gravitational/gravity/lib/ops/opsclient"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/trace"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceGravitySMTP() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceGravitySMTPCreateOrUpdate,
+		Read:   resourceGravitySMTPRead,
+		Update: resourceGravitySMTPCreateOrUpdate,
+		Delete: resourceGravitySMTPDelete,
+		Exists: resourceGravitySMTPExists,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"host": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The SMTP server host",
+			},
+			"port": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Computed:    true,
+				Description: "The SMTP server port",
+			},
+			"username": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"password": {
+				Type:      schema.TypeString,
+				Required:  true,
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+func resourceGravitySMTPCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	config := storage.NewSMTPConfig(storage.SMTPConfigSpecV2{
+		Host:     d.Get("host").(string),
+		Port:     d.Get("port").(int),
+		Username: d.Get("username").(string),
+		Password: d.Get("password").(string),
+	})
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = client.UpdateSMTPConfig(clusterKey, config)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	log.Printf("[INFO] SMTP configuration updated")
+	d.SetId(config.GetName())
+	return resourceGravitySMTPRead(d, m)
+}
+
+func resourceGravitySMTPRead(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	config, err := client.GetSMTPConfig(clusterKey)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	d.Set("host", config.GetHost())
+	d.Set("port", config.GetPort())
+	d.Set("username", config.GetUsername())
+	d.Set("password", config.GetPassword())
+	return nil
+}
+
+func resourceGravitySMTPDelete(d *schema.ResourceData, m interface{}) error {
+	client := m.(*opsclient.Client)
+	clusterKey, err := client.LocalClusterKey()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = client.DeleteSMTPConfig(clusterKey)
+	return trace.Wrap(err)
+}
+
+func resourceGravitySMTPExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	err := resourceGravitySMTPRead(d, m)
+	if err != nil && trace.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, trace.Wrap(err)
+	}
+	return true, nil
+}
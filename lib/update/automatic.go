@@ -56,23 +56,29 @@ func AutomaticUpgrade(ctx context.Context, localEnv, updateEnv *localenv.LocalEn
 		Remote:            runner,
 	}
 
-	fsm, err := NewFSM(ctx, config)
+	machine, err := NewFSM(ctx, config)
 	if err != nil {
 		return trace.Wrap(err, "failed to load or initialize upgrade plan")
 	}
-	defer fsm.Close()
+	defer machine.Close()
 
 	progress := utils.NewProgress(ctx, "automatic upgrade", -1, false)
 	defer progress.Stop()
 
 	force := false
-	fsmErr := fsm.ExecutePlan(ctx, progress, force)
+	fsmErr := machine.ExecutePlan(ctx, progress, force)
+	if fsm.IsPaused(fsmErr) {
+		// keep the operation and the agents running until it is resumed
+		log.Infof("%v.", fsmErr)
+		return trace.Wrap(fsmErr)
+	}
 	if fsmErr != nil {
 		log.Warnf("Failed to execute plan: %v.", fsmErr)
+		fsmErr = rollbackOnFailure(ctx, machine, config.Operator, progress, fsmErr)
 		// fallthrough
 	}
 
-	err = fsm.Complete(fsmErr)
+	err = machine.Complete(fsmErr)
 	if err != nil {
 		return trace.Wrap(err)
 	}
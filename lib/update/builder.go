@@ -293,21 +293,93 @@ func (r phaseBuilder) masters(leadMaster runtimeServer, otherMasters runtimeServ
 	return &root
 }
 
-func (r phaseBuilder) nodes(leadMaster storage.Server, nodes []runtimeServer, supportsTaints bool) *phase {
+// nodes returns a new phase for upgrading regular nodes.
+// Nodes are updated in batches of the size specified with the rollout strategy,
+// nodes within a batch are updated in parallel.
+// Each batch requires the previous one so the rollout halts once a node
+// fails the post-update health check.
+// The health check is only added if the rollout strategy is set
+func (r phaseBuilder) nodes(leadMaster storage.Server, nodes []runtimeServer, supportsTaints bool,
+	strategy storage.RolloutStrategy) *phase {
 	root := root(phase{
 		ID:          "nodes",
 		Description: "Update regular nodes",
 	})
 
-	for _, server := range nodes {
-		node := r.node(server.Server, root, "Update system software on node %q")
-		node.AddSequential(r.commonNode(server.Server, server.runtime, leadMaster, supportsTaints,
-			waitsForEndpoints(true))...)
-		root.AddParallel(node)
+	withHealth := strategy.IsSet()
+	batchSize := strategy.GetBatchSize()
+	if batchSize == 1 {
+		for _, server := range nodes {
+			root.AddParallel(r.regularNode(server, root, leadMaster, supportsTaints, withHealth))
+		}
+		return &root
 	}
+
+	for i := 0; i < len(nodes); i += batchSize {
+		end := i + batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		batch := phase{
+			ID:          root.ChildLiteral(fmt.Sprintf("batch-%v", i/batchSize+1)),
+			Description: fmt.Sprintf("Update regular nodes %v", runtimeServers(nodes[i:end]).hostnames()),
+			Parallel:    true,
+		}
+		for _, server := range nodes[i:end] {
+			batch.AddParallel(r.regularNode(server, batch, leadMaster, supportsTaints, withHealth))
+		}
+		root.AddSequential(batch)
+	}
+	return &root
+}
+
+// canary returns a new phase that updates a single regular node first.
+// Once the node has passed the health check and the application status hook,
+// the operation is paused until the update of the canary node is approved
+func (r phaseBuilder) canary(leadMaster storage.Server, server runtimeServer, installedApp loc.Locator,
+	supportsTaints bool) *phase {
+	root := root(phase{
+		ID:          "canary",
+		Description: fmt.Sprintf("Update canary node %q", server.Hostname),
+	})
+
+	root.AddSequential(r.regularNode(server, root, leadMaster, supportsTaints, true))
+	root.AddSequential(phase{
+		ID:          root.ChildLiteral("status"),
+		Executor:    statusHook,
+		Description: "Run application status hook",
+		Data: &storage.OperationPhaseData{
+			Package: &installedApp,
+		},
+	}, phase{
+		ID:          root.ChildLiteral("approve"),
+		Executor:    approveCanary,
+		Description: fmt.Sprintf("Wait for the update of canary node %q to be approved", server.Hostname),
+	})
 	return &root
 }
 
+// regularNode returns a new phase for upgrading the specified regular node,
+// optionally followed by the post-update health check
+func (r phaseBuilder) regularNode(server runtimeServer, parent phase, leadMaster storage.Server,
+	supportsTaints, withHealth bool) phase {
+	node := r.node(server.Server, parent, "Update system software on node %q")
+	node.AddSequential(r.commonNode(server.Server, server.runtime, leadMaster, supportsTaints,
+		waitsForEndpoints(true))...)
+	if !withHealth {
+		return node
+	}
+	node.AddSequential(phase{
+		ID:          "health",
+		Executor:    nodeHealth,
+		Description: fmt.Sprintf("Wait for node %q to become healthy", server.Hostname),
+		Data: &storage.OperationPhaseData{
+			Server:     &server.Server,
+			ExecServer: &leadMaster,
+		}})
+	return node
+}
+
 func (r phaseBuilder) node(server storage.Server, parent phase, format string) phase {
 	return phase{
 		ID:          parent.ChildLiteral(server.Hostname),
@@ -471,6 +543,14 @@ func (r runtimeServers) asServers() (result []storage.Server) {
 	return result
 }
 
+func (r runtimeServers) hostnames() (result []string) {
+	result = make([]string, 0, len(r))
+	for _, server := range r {
+		result = append(result, server.Hostname)
+	}
+	return result
+}
+
 type runtimeServers []runtimeServer
 
 type runtimeServer struct {
@@ -78,6 +78,13 @@ func (f *fsmUpdateEngine) RunCommand(ctx context.Context, runner fsm.RemoteRunne
 	return runner.Run(ctx, server, args...)
 }
 
+// RunRollbackCommand rolls back the phase specified by params on the specified
+// server using the provided runner
+func (f *fsmUpdateEngine) RunRollbackCommand(ctx context.Context, runner fsm.RemoteRunner, server storage.Server, p fsm.Params) error {
+	args := []string{"rollback", "--phase", p.PhaseID, fmt.Sprintf("--force=%v", p.Force)}
+	return runner.Run(ctx, server, args...)
+}
+
 // PreExecute is no-op for the update engine
 func (f *fsmUpdateEngine) PreExecute(ctx context.Context, p fsm.Params) error {
 	return nil
@@ -117,7 +124,7 @@ func (f *fsmUpdateEngine) Complete(fsmErr error) error {
 		return trace.Wrap(err)
 	}
 
-	if !completed {
+	if !completed && !fsm.IsRolledBack(plan) {
 		return nil
 	}
 
@@ -126,6 +133,12 @@ func (f *fsmUpdateEngine) Complete(fsmErr error) error {
 		return trace.Wrap(err)
 	}
 
+	if !completed {
+		// the update has been rolled back, move the cluster
+		// back into active state without committing any changes
+		return trace.Wrap(f.activateCluster(*cluster))
+	}
+
 	err = f.commitClusterChanges(cluster, *op)
 	if err != nil {
 		return trace.Wrap(err)
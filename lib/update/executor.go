@@ -74,6 +74,13 @@ const (
 	updateEtcdRestartGravity = "etcd_restart_gravity"
 	// cleanupNode is the phase to clean up a node after the upgrade
 	cleanupNode = "cleanup_node"
+	// nodeHealth is the phase to wait for a node to become healthy after the upgrade
+	nodeHealth = "node_health"
+	// statusHook is the phase to run the application status hook
+	statusHook = "status_hook"
+	// approveCanary is the phase that pauses the operation until the canary
+	// node update has been approved
+	approveCanary = "approve_canary"
 )
 
 // fsmSpec returns the function that returns an appropriate phase executor
@@ -137,6 +144,12 @@ func fsmSpec(c FSMConfig) fsm.FSMSpecFunc {
 			return NewPhaseUpgradeGravitySiteRestart(c, p.Plan, p.Phase)
 		case cleanupNode:
 			return NewGarbageCollectPhase(p.Plan, p.Phase, remote)
+		case nodeHealth:
+			return NewPhaseNodeHealth(c, p.Plan, p.Phase)
+		case statusHook:
+			return NewPhaseStatusHook(c, p.Plan, p.Phase)
+		case approveCanary:
+			return NewPhaseApproveCanary(c, p.Plan, p.Phase)
 		default:
 			return nil, trace.BadParameter(
 				"phase %q requires executor %q (potential mismatch between upgrade versions)",
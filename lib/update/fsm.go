@@ -24,7 +24,6 @@ import (
 	"github.com/gravitational/gravity/lib/fsm"
 	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/pack"
-	"github.com/gravitational/gravity/lib/rpc"
 	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/gravity/lib/users"
 
@@ -97,6 +96,13 @@ func NewFSM(ctx context.Context, c FSMConfig) (*fsm.FSM, error) {
 		return nil, trace.Wrap(err)
 	}
 
+	if c.Operator != nil {
+		plan, err := updateEngine.GetPlan()
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		fsm.SetPlanGate(ops.MaintenanceWindowGate(clusterOperationKey(*plan), c.Operator))
+	}
 	return fsm, nil
 }
 
@@ -134,7 +140,7 @@ func ExecutePhase(ctx context.Context, config FSMConfig, params fsm.Params, skip
 	}
 
 	if params.PhaseID == fsm.RootPhase {
-		return trace.Wrap(resumeUpdate(ctx, machine, params, config.Remote))
+		return trace.Wrap(resumeUpdate(ctx, machine, params, config))
 	}
 
 	return trace.Wrap(machine.ExecutePhase(ctx, params))
@@ -158,10 +164,16 @@ func RollbackPhase(ctx context.Context, config FSMConfig, params fsm.Params, ski
 	return trace.Wrap(fsm.RollbackPhase(ctx, params))
 }
 
-func resumeUpdate(ctx context.Context, machine *fsm.FSM, p fsm.Params, runner rpc.AgentRepository) error {
+func resumeUpdate(ctx context.Context, machine *fsm.FSM, p fsm.Params, config FSMConfig) error {
 	fsmErr := machine.ExecutePlan(ctx, p.Progress, p.Force)
+	if fsm.IsPaused(fsmErr) {
+		// keep the operation and the agents running until it is resumed
+		logrus.Infof("%v.", fsmErr)
+		return trace.Wrap(fsmErr)
+	}
 	if fsmErr != nil {
 		logrus.Warnf("Failed to execute plan: %v.", fsmErr)
+		fsmErr = rollbackOnFailure(ctx, machine, config.Operator, p.Progress, fsmErr)
 		// fallthrough
 	}
 
@@ -176,7 +188,7 @@ func resumeUpdate(ctx context.Context, machine *fsm.FSM, p fsm.Params, runner rp
 
 	ctx, cancel := context.WithTimeout(ctx, defaults.RPCAgentShutdownTimeout)
 	defer cancel()
-	if err = ShutdownClusterAgents(ctx, runner); err != nil {
+	if err = ShutdownClusterAgents(ctx, config.Remote); err != nil {
 		logrus.Warnf("Failed to shutdown cluster agents: %v.", trace.DebugReport(err))
 	}
 	return nil
@@ -20,10 +20,14 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/ops/opsservice"
 	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
 
 	"github.com/gravitational/trace"
 	"github.com/sirupsen/logrus"
@@ -43,6 +47,7 @@ func (s *FSMSuite) SetUpTest(c *check.C) {
 	services := opsservice.SetupTestServices(c)
 	s.engine = &fsmUpdateEngine{
 		FSMConfig: FSMConfig{
+			Backend:      services.Backend,
 			LocalBackend: services.Backend,
 			Packages:     services.Packages,
 			Apps:         services.Apps,
@@ -157,6 +162,199 @@ func (s *FSMSuite) TestFSMExecutePhaseWithSubphases(c *check.C) {
 	})
 }
 
+func (s *FSMSuite) TestRollbackPlanFollowsRequirements(c *check.C) {
+	// /c is listed before /b but requires it, so it has to be rolled back first
+	plan := s.newRollbackPlan(c, map[string]string{
+		"/a": storage.OperationPhaseStateCompleted,
+		"/c": storage.OperationPhaseStateCompleted,
+		"/b": storage.OperationPhaseStateCompleted,
+		"/d": storage.OperationPhaseStateUnstarted,
+		"/e": storage.OperationPhaseStateRolledBack,
+	}, storage.OperationPhase{ID: "/a"},
+		storage.OperationPhase{ID: "/c", Requires: []string{"/b"}},
+		storage.OperationPhase{ID: "/b", Requires: []string{"/a"}},
+		storage.OperationPhase{ID: "/d", Requires: []string{"/a"}},
+		storage.OperationPhase{ID: "/e"})
+	recorder := s.recordRollbacks(nil)
+
+	rolledBack, err := s.fsm.RollbackPlan(context.TODO(), utils.NewNopProgress(), false)
+	c.Assert(err, check.IsNil)
+	// unstarted and already rolled back phases are skipped
+	c.Assert(rolledBack, check.DeepEquals, []string{"/c", "/b", "/a"})
+	c.Assert(recorder.rolledBack, check.DeepEquals, rolledBack)
+	checkStates(c, s.resolvePlan(c, plan), map[string]string{
+		"/a": storage.OperationPhaseStateRolledBack,
+		"/b": storage.OperationPhaseStateRolledBack,
+		"/c": storage.OperationPhaseStateRolledBack,
+		"/d": storage.OperationPhaseStateUnstarted,
+		"/e": storage.OperationPhaseStateRolledBack,
+	})
+}
+
+func (s *FSMSuite) TestRollbackPlanRequirementsOfParentPhases(c *check.C) {
+	// all subphases of /nodes require all subphases of /masters
+	s.newRollbackPlan(c, map[string]string{
+		"/masters/node-1": storage.OperationPhaseStateCompleted,
+		"/masters/node-2": storage.OperationPhaseStateCompleted,
+		"/nodes/node-3":   storage.OperationPhaseStateCompleted,
+		"/nodes/node-4":   storage.OperationPhaseStateFailed,
+	}, storage.OperationPhase{ID: "/nodes", Requires: []string{"/masters"}, Phases: []storage.OperationPhase{
+		{ID: "/nodes/node-3"},
+		{ID: "/nodes/node-4"},
+	}}, storage.OperationPhase{ID: "/masters", Phases: []storage.OperationPhase{
+		{ID: "/masters/node-1"},
+		{ID: "/masters/node-2", Requires: []string{"/masters/node-1"}},
+	}})
+	s.recordRollbacks(nil)
+
+	rolledBack, err := s.fsm.RollbackPlan(context.TODO(), utils.NewNopProgress(), false)
+	c.Assert(err, check.IsNil)
+	c.Assert(rolledBack, check.DeepEquals, []string{
+		"/nodes/node-4", "/nodes/node-3", "/masters/node-2", "/masters/node-1"})
+}
+
+func (s *FSMSuite) TestRollbackOnFailureStopsAtFailedPhase(c *check.C) {
+	plan := s.newRollbackPlan(c, map[string]string{
+		"/a": storage.OperationPhaseStateCompleted,
+		"/b": storage.OperationPhaseStateCompleted,
+		"/c": storage.OperationPhaseStateFailed,
+	}, storage.OperationPhase{ID: "/a"},
+		storage.OperationPhase{ID: "/b", Requires: []string{"/a"}},
+		storage.OperationPhase{ID: "/c", Requires: []string{"/b"}})
+	s.createUpdateOperation(c, plan, true)
+	recorder := s.recordRollbacks(map[string]error{"/b": trace.ConnectionProblem(nil, "node is down")})
+
+	err := rollbackOnFailure(context.TODO(), s.fsm, s.engine.Operator, nil, trace.BadParameter("phase /c failed"))
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Matches, "update failed: phase /c failed; automatic rollback failed "+
+		"after rolling back 1 phase\\(s\\): .*node is down.*")
+	c.Assert(recorder.rolledBack, check.DeepEquals, []string{"/c", "/b"})
+	checkStates(c, s.resolvePlan(c, plan), map[string]string{
+		"/a": storage.OperationPhaseStateCompleted,
+		"/b": storage.OperationPhaseStateFailed,
+		"/c": storage.OperationPhaseStateRolledBack,
+	})
+
+	// the partially rolled back operation fails and the cluster is not activated
+	c.Assert(s.engine.Complete(err), check.IsNil)
+	operation, err := s.engine.Operator.GetSiteOperation(clusterOperationKey(plan))
+	c.Assert(err, check.IsNil)
+	c.Assert(operation.State, check.Equals, ops.OperationStateFailed)
+	cluster, err := s.engine.Backend.GetLocalSite(defaults.SystemAccountID)
+	c.Assert(err, check.IsNil)
+	c.Assert(cluster.State, check.Equals, ops.SiteStateUpdating)
+}
+
+func (s *FSMSuite) TestCompleteActivatesRolledBackCluster(c *check.C) {
+	plan := s.newRollbackPlan(c, map[string]string{
+		"/a": storage.OperationPhaseStateCompleted,
+		"/b": storage.OperationPhaseStateFailed,
+		"/c": storage.OperationPhaseStateUnstarted,
+	}, storage.OperationPhase{ID: "/a"},
+		storage.OperationPhase{ID: "/b", Requires: []string{"/a"}},
+		storage.OperationPhase{ID: "/c", Requires: []string{"/b"}})
+	s.createUpdateOperation(c, plan, true)
+	s.recordRollbacks(nil)
+
+	err := rollbackOnFailure(context.TODO(), s.fsm, s.engine.Operator, nil, trace.BadParameter("phase /b failed"))
+	c.Assert(err, check.ErrorMatches, "update failed: phase /b failed; rolled back 2 phase\\(s\\): /b, /a")
+	c.Assert(fsm.IsRolledBack(s.resolvePlan(c, plan)), check.Equals, true)
+
+	c.Assert(s.engine.Complete(err), check.IsNil)
+	operation, err := s.engine.Operator.GetSiteOperation(clusterOperationKey(plan))
+	c.Assert(err, check.IsNil)
+	c.Assert(operation.State, check.Equals, ops.OperationStateFailed)
+	cluster, err := s.engine.Backend.GetLocalSite(defaults.SystemAccountID)
+	c.Assert(err, check.IsNil)
+	c.Assert(cluster.State, check.Equals, ops.SiteStateActive)
+}
+
+func (s *FSMSuite) TestRollbackOnFailureWithoutAutoRollback(c *check.C) {
+	plan := s.newRollbackPlan(c, map[string]string{
+		"/a": storage.OperationPhaseStateFailed,
+	}, storage.OperationPhase{ID: "/a"})
+	s.createUpdateOperation(c, plan, false)
+	recorder := s.recordRollbacks(nil)
+
+	fsmErr := trace.BadParameter("phase /a failed")
+	err := rollbackOnFailure(context.TODO(), s.fsm, s.engine.Operator, nil, fsmErr)
+	c.Assert(err, check.Equals, fsmErr)
+	c.Assert(recorder.rolledBack, check.HasLen, 0)
+}
+
+func (s *FSMSuite) TestRollbackOnFailureKeepsUpdateError(c *check.C) {
+	// the operation does not exist
+	s.newRollbackPlan(c, map[string]string{
+		"/a": storage.OperationPhaseStateFailed,
+	}, storage.OperationPhase{ID: "/a"})
+
+	err := rollbackOnFailure(context.TODO(), s.fsm, s.engine.Operator, nil, trace.BadParameter("phase /a failed"))
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Matches, "(?s).*phase /a failed.*")
+}
+
+// newRollbackPlan sets up the plan with the specified phases and phase states
+// as the plan of the update engine
+func (s *FSMSuite) newRollbackPlan(c *check.C, states map[string]string, phases ...storage.OperationPhase) storage.OperationPlan {
+	plan := storage.OperationPlan{
+		OperationID:   "operation-1",
+		OperationType: ops.OperationUpdate,
+		AccountID:     defaults.SystemAccountID,
+		ClusterName:   "example.com",
+		Phases:        phases,
+	}
+	s.engine.plan = &plan
+	for id, state := range states {
+		if state == storage.OperationPhaseStateUnstarted {
+			continue
+		}
+		err := s.engine.ChangePhaseState(context.TODO(), fsm.StateChange{Phase: id, State: state})
+		c.Assert(err, check.IsNil)
+	}
+	return plan
+}
+
+// createUpdateOperation creates the cluster in updating state and the update
+// operation of the specified plan
+func (s *FSMSuite) createUpdateOperation(c *check.C, plan storage.OperationPlan, autoRollback bool) {
+	_, err := s.engine.Backend.CreateSite(storage.Site{
+		AccountID: plan.AccountID,
+		Domain:    plan.ClusterName,
+		Created:   time.Now().UTC(),
+		State:     ops.SiteStateUpdating,
+		Local:     true,
+		App:       storage.Package{Repository: "gravitational.io", Name: "app", Version: "1.0.0"},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.engine.Backend.CreateSiteOperation(storage.SiteOperation{
+		ID:         plan.OperationID,
+		AccountID:  plan.AccountID,
+		SiteDomain: plan.ClusterName,
+		Type:       plan.OperationType,
+		State:      ops.OperationStateUpdateInProgress,
+		Created:    time.Now().UTC(),
+		Update: &storage.UpdateOperationState{
+			UpdatePackage: "gravitational.io/app:2.0.0",
+			AutoRollback:  autoRollback,
+		},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+// recordRollbacks replaces the phase executors with the ones that record
+// phase rollbacks and fail to roll back the phases specified with failures
+func (s *FSMSuite) recordRollbacks(failures map[string]error) *rollbackRecorder {
+	recorder := &rollbackRecorder{failures: failures}
+	s.engine.Spec = func(p fsm.ExecutorParams, remote fsm.Remote) (fsm.PhaseExecutor, error) {
+		return &recordingPhase{
+			FieldLogger: logrus.WithField(trace.Component, "fsm-suite"),
+			id:          p.Phase.ID,
+			recorder:    recorder,
+		}, nil
+	}
+	return recorder
+}
+
 func (s *FSMSuite) resolvePlan(c *check.C, plan storage.OperationPlan) *storage.OperationPlan {
 	changelog, err := s.engine.LocalBackend.GetOperationPlanChangelog(plan.ClusterName, plan.OperationID)
 	c.Assert(err, check.IsNil)
@@ -220,3 +418,29 @@ func (p *testPhase2) Execute(context.Context) error {
 func (p *testPhase2) Rollback(context.Context) error {
 	return nil
 }
+
+// rollbackRecorder records the order of phase rollbacks
+type rollbackRecorder struct {
+	rolledBack []string
+	failures   map[string]error
+}
+
+type recordingPhase struct {
+	logrus.FieldLogger
+	id       string
+	recorder *rollbackRecorder
+}
+
+func (p *recordingPhase) PreCheck(context.Context) error {
+	return nil
+}
+func (p *recordingPhase) PostCheck(context.Context) error {
+	return nil
+}
+func (p *recordingPhase) Execute(context.Context) error {
+	return nil
+}
+func (p *recordingPhase) Rollback(context.Context) error {
+	p.recorder.rolledBack = append(p.recorder.rolledBack, p.id)
+	return p.recorder.failures[p.id]
+}
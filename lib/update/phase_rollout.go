@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/kubernetes"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/status"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	kubeapi "k8s.io/client-go/kubernetes"
+)
+
+// phaseNodeHealth defines the operation of waiting for a node to become
+// healthy after its system software has been updated
+type phaseNodeHealth struct {
+	kubernetesOperation
+	log.FieldLogger
+}
+
+// NewPhaseNodeHealth returns a new executor for the node health check
+func NewPhaseNodeHealth(c FSMConfig, plan storage.OperationPlan, phase storage.OperationPhase) (*phaseNodeHealth, error) {
+	op, err := newKubernetesOperation(c, plan, phase)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &phaseNodeHealth{
+		kubernetesOperation: *op,
+		FieldLogger:         log.NewEntry(log.New()),
+	}, nil
+}
+
+// Execute waits for the node to become healthy.
+// The rollout halts if the node does not become healthy in time
+func (p *phaseNodeHealth) Execute(ctx context.Context) error {
+	err := retry(ctx, func() error {
+		return trace.Wrap(checkNodeHealth(ctx, p.Client, p.Server))
+	}, defaults.NodeHealthTimeout)
+	if err != nil {
+		return trace.Wrap(err, "node %q is not healthy after the update, halting the rollout",
+			p.Server.Hostname)
+	}
+	return nil
+}
+
+// Rollback is a no-op for this phase
+func (p *phaseNodeHealth) Rollback(context.Context) error {
+	return nil
+}
+
+// checkNodeHealth verifies that the Kubernetes node is ready and that the
+// planet agent reports the node as healthy
+func checkNodeHealth(ctx context.Context, client *kubeapi.Clientset, server storage.Server) error {
+	node, err := kubernetes.GetNode(client, server)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status != v1.ConditionTrue {
+			return trace.BadParameter("node %q is not ready: %v", server.Hostname, condition.Message)
+		}
+	}
+	agentStatus, err := status.FromPlanetAgent(ctx, []storage.Server{server})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, node := range agentStatus.Nodes {
+		if node.Status != status.NodeHealthy {
+			return trace.BadParameter("node %q is %v, failed probes: %v",
+				server.Hostname, node.Status, strings.Join(node.FailedProbes, "; "))
+		}
+	}
+	return nil
+}
+
+// phaseStatusHook is the executor for the application status hook
+type phaseStatusHook struct {
+	log.FieldLogger
+	phaseApp
+}
+
+// NewPhaseStatusHook returns a new executor for running the application status hook
+func NewPhaseStatusHook(c FSMConfig, plan storage.OperationPlan, phase storage.OperationPhase) (*phaseStatusHook, error) {
+	cluster, err := c.Operator.GetLocalSite()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if phase.Data == nil || phase.Data.Package == nil {
+		return nil, trace.NotFound("no package specified for phase %q", phase.ID)
+	}
+	return &phaseStatusHook{
+		FieldLogger: log.NewEntry(log.New()),
+		phaseApp: phaseApp{
+			Apps:           c.Apps,
+			Client:         c.Client,
+			GravityPackage: plan.GravityPackage,
+			Package:        *phase.Data.Package,
+			Servers:        plan.Servers,
+			ServiceUser:    cluster.ServiceUser,
+		}}, nil
+}
+
+// Execute runs the status hook of the application
+func (p *phaseStatusHook) Execute(ctx context.Context) error {
+	err := p.runHooks(ctx, schema.HookStatus)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// Rollback is a no-op for this phase
+func (p *phaseStatusHook) Rollback(context.Context) error {
+	return nil
+}
+
+// phaseApproveCanary pauses the operation until the update
+// of the canary node has been approved
+type phaseApproveCanary struct {
+	log.FieldLogger
+	// Backend is the cluster backend
+	Backend storage.Backend
+	// Plan is the operation plan
+	Plan storage.OperationPlan
+	// Phase is the phase being executed
+	Phase storage.OperationPhase
+}
+
+// NewPhaseApproveCanary returns a new executor that waits for the canary update approval
+func NewPhaseApproveCanary(c FSMConfig, plan storage.OperationPlan, phase storage.OperationPhase) (*phaseApproveCanary, error) {
+	return &phaseApproveCanary{
+		FieldLogger: log.NewEntry(log.New()),
+		Backend:     c.Backend,
+		Plan:        plan,
+		Phase:       phase,
+	}, nil
+}
+
+// Execute completes if the update of the canary node has been approved
+// and pauses the plan execution otherwise
+func (p *phaseApproveCanary) Execute(context.Context) error {
+	operation, err := p.Backend.GetSiteOperation(p.Plan.ClusterName, p.Plan.OperationID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if operation.Update != nil && operation.Update.CanaryApproved {
+		p.Info("Update of the canary node has been approved.")
+		return nil
+	}
+	return trace.Wrap(&fsm.PausedError{
+		PhaseID: p.Phase.ID,
+		Err: trace.CompareFailed("canary node has been updated and is waiting for approval, " +
+			"run 'gravity upgrade --approve' to update the remaining nodes"),
+	})
+}
+
+// Rollback is a no-op for this phase
+func (p *phaseApproveCanary) Rollback(context.Context) error {
+	return nil
+}
+
+// PreCheck makes sure this phase is being executed on a master node
+func (p *phaseApproveCanary) PreCheck(context.Context) error {
+	return trace.Wrap(fsm.CheckMasterServer(p.Plan.Servers))
+}
+
+// PostCheck is no-op for this phase
+func (p *phaseApproveCanary) PostCheck(context.Context) error {
+	return nil
+}
@@ -284,6 +284,12 @@ func newOperationPlan(p newPlanParams) (*storage.OperationPlan, error) {
 		GravityPackage: *gravityPackage,
 	}
 
+	var strategy storage.RolloutStrategy
+	if p.operation.Update != nil && p.operation.Update.Strategy != nil {
+		strategy = *p.operation.Update.Strategy
+		plan.Strategy = &strategy
+	}
+
 	builder := phaseBuilder{}
 	initPhase := *builder.init(p.installedApp.Package, p.updateApp.Package)
 	checksPhase := *builder.checks(p.installedApp.Package, p.updateApp.Package).Require(initPhase)
@@ -328,8 +334,15 @@ func newOperationPlan(p newPlanParams) (*storage.OperationPlan, error) {
 
 	mastersPhase := *builder.masters(leadMaster, masters[1:], supportsTaints).
 		Require(checksPhase, bootstrapPhase, preUpdatePhase)
-	nodesPhase := *builder.nodes(leadMaster.Server, nodes, supportsTaints).
+	nodesPhase := *builder.nodes(leadMaster.Server, nodes, supportsTaints, strategy).
 		Require(mastersPhase)
+	var canaryPhase *phase
+	if strategy.Canary && len(nodes) != 0 {
+		canaryPhase = builder.canary(leadMaster.Server, nodes[0], p.installedApp.Package, supportsTaints).
+			Require(mastersPhase)
+		nodesPhase = *builder.nodes(leadMaster.Server, nodes[1:], supportsTaints, strategy).
+			Require(*canaryPhase)
+	}
 
 	runtimeUpdates, err := app.GetUpdatedDependencies(p.installedRuntime, p.updateRuntime)
 	if err != nil && !trace.IsNotFound(err) {
@@ -388,6 +401,9 @@ func newOperationPlan(p newPlanParams) (*storage.OperationPlan, error) {
 		}
 
 		phases = append(phases, bootstrapPhase, mastersPhase)
+		if canaryPhase != nil {
+			phases = append(phases, *canaryPhase)
+		}
 		if len(nodesPhase.Phases) > 0 {
 			phases = append(phases, nodesPhase)
 		}
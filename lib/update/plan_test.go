@@ -76,7 +76,7 @@ func (s *PlanSuite) TestPlanWithRuntimeUpdate(c *check.C) {
 	leadMaster := runtimeServer{params.servers[0], runtimeLoc}
 	coreDNS := *builder.corednsPhase(leadMaster.Server)
 	masters := *builder.masters(leadMaster, servers[1:2], false).Require(checks, bootstrap, preUpdate, coreDNS)
-	nodes := *builder.nodes(leadMaster.Server, servers[2:], false).Require(masters)
+	nodes := *builder.nodes(leadMaster.Server, servers[2:], false, storage.RolloutStrategy{}).Require(masters)
 	etcd := *builder.etcdPlan(leadMaster.Server, params.servers[1:2], params.servers[2:], "1.0.0", "2.0.0")
 	migration := builder.migration(leadMaster.Server, params)
 	c.Assert(migration, check.NotNil)
@@ -119,6 +119,12 @@ func (s *PlanSuite) TestPlanWithRuntimeUpdate(c *check.C) {
 
 	// verify
 	compare.DeepCompare(c, *obtainedPlan, plan)
+	// regular nodes are not health checked without a rollout strategy
+	node := obtainedPlan.Phases[6].Phases[0]
+	c.Assert(node.ID, check.Equals, "/nodes/node-3")
+	for _, phase := range node.Phases {
+		c.Assert(phase.Executor, check.Not(check.Equals), nodeHealth)
+	}
 }
 
 func (s *PlanSuite) TestPlanWithoutRuntimeUpdate(c *check.C) {
@@ -160,6 +166,76 @@ func (s *PlanSuite) TestPlanWithoutRuntimeUpdate(c *check.C) {
 	compare.DeepCompare(c, *obtainedPlan, plan)
 }
 
+func (s *PlanSuite) TestPlanWithCanaryRollout(c *check.C) {
+	runtimeLoc1 := loc.MustParseLocator("gravitational.io/runtime:1.0.0")
+	appLoc1 := loc.MustParseLocator("gravitational.io/app:1.0.0")
+	runtimeLoc2 := loc.MustParseLocator("gravitational.io/runtime:2.0.0")
+	appLoc2 := loc.MustParseLocator("gravitational.io/app:2.0.0")
+
+	_, params := newTestPlan(c, params{
+		installedRuntime:         runtimeLoc1,
+		installedApp:             appLoc1,
+		updateRuntime:            runtimeLoc2,
+		updateApp:                appLoc2,
+		installedRuntimeManifest: installedRuntimeManifest,
+		installedAppManifest:     installedAppManifest,
+		updateRuntimeManifest:    updateRuntimeManifest,
+		updateAppManifest:        updateAppManifest,
+	})
+	params.operation.Update = &storage.UpdateOperationState{
+		Strategy: &storage.RolloutStrategy{Canary: true},
+	}
+
+	obtainedPlan, err := newOperationPlan(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(obtainedPlan.Strategy, check.DeepEquals, params.operation.Update.Strategy)
+
+	var ids []string
+	for _, phase := range obtainedPlan.Phases {
+		ids = append(ids, phase.ID)
+	}
+	// the only regular node is updated as a canary so there is no nodes phase
+	c.Assert(ids, check.DeepEquals, []string{"/init", "/checks", "/pre-update", "/bootstrap",
+		"/masters", "/canary", "/etcd", "/migration", "/config", "/runtime", "/app", "/gc"})
+
+	canary := obtainedPlan.Phases[5]
+	c.Assert(canary.Requires, check.DeepEquals, []string{"/masters"})
+	c.Assert(canary.Phases, check.HasLen, 3)
+	c.Assert(canary.Phases[0].ID, check.Equals, "/canary/node-3")
+	c.Assert(canary.Phases[0].Phases[len(canary.Phases[0].Phases)-1].Executor, check.Equals, nodeHealth)
+	c.Assert(canary.Phases[1].Executor, check.Equals, statusHook)
+	c.Assert(*canary.Phases[1].Data.Package, check.Equals, appLoc1)
+	c.Assert(canary.Phases[2].Executor, check.Equals, approveCanary)
+	c.Assert(canary.Phases[2].Requires, check.DeepEquals, []string{"/canary/status"})
+}
+
+func (s *PlanSuite) TestNodesInBatches(c *check.C) {
+	runtimeLoc := loc.MustParseLocator("gravitational.io/planet:2.0.0")
+	var servers runtimeServers
+	for _, hostname := range []string{"node-1", "node-2", "node-3"} {
+		servers = append(servers, runtimeServer{storage.Server{Hostname: hostname}, runtimeLoc})
+	}
+	leadMaster := storage.Server{Hostname: "master"}
+
+	nodes := phaseBuilder{}.nodes(leadMaster, servers, false, storage.RolloutStrategy{BatchSize: 2})
+	c.Assert(nodes.Phases, check.HasLen, 2)
+
+	batch := nodes.Phases[0]
+	c.Assert(batch.ID, check.Equals, "/nodes/batch-1")
+	c.Assert(batch.Parallel, check.Equals, true)
+	c.Assert(batch.Phases, check.HasLen, 2)
+	c.Assert(batch.Phases[0].ID, check.Equals, "/nodes/batch-1/node-1")
+	c.Assert(batch.Phases[1].ID, check.Equals, "/nodes/batch-1/node-2")
+	node := batch.Phases[0].Phases
+	c.Assert(node[len(node)-1].Executor, check.Equals, nodeHealth)
+
+	batch = nodes.Phases[1]
+	c.Assert(batch.ID, check.Equals, "/nodes/batch-2")
+	c.Assert(batch.Requires, check.DeepEquals, []string{"/nodes/batch-1"})
+	c.Assert(batch.Phases, check.HasLen, 1)
+	c.Assert(batch.Phases[0].ID, check.Equals, "/nodes/batch-2/node-3")
+}
+
 func newTestPlan(c *check.C, p params) (storage.OperationPlan, newPlanParams) {
 	servers := []storage.Server{
 		{
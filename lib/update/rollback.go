@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// rollbackOnFailure rolls back all started phases of the failed update
+// operation if the operation has been created with automatic rollback enabled.
+// It returns the error to complete the operation with
+func rollbackOnFailure(ctx context.Context, machine *fsm.FSM, operator ops.Operator, progress utils.Progress, fsmErr error) error {
+	plan, err := machine.GetPlan()
+	if err != nil {
+		return trace.NewAggregate(fsmErr, err)
+	}
+	operation, err := operator.GetSiteOperation(clusterOperationKey(*plan))
+	if err != nil {
+		return trace.NewAggregate(fsmErr, err)
+	}
+	if operation.Update == nil || !operation.Update.AutoRollback {
+		return fsmErr
+	}
+	log.Warnf("Update failed, rolling back: %v.", trace.DebugReport(fsmErr))
+	if progress == nil {
+		progress = utils.NewNopProgress()
+	}
+	progress.NextStep("Rolling back the failed update")
+	force := false
+	rolledBack, err := machine.RollbackPlan(ctx, progress, force)
+	summary := rollbackSummary(fsmErr, rolledBack, err)
+	log.Info(summary)
+	progress.NextStep(summary)
+	return trace.Errorf("%v", summary)
+}
+
+// rollbackSummary returns a summary of the automatic rollback
+func rollbackSummary(fsmErr error, rolledBack []string, rollbackErr error) string {
+	if rollbackErr != nil {
+		return fmt.Sprintf("update failed: %v; automatic rollback failed after rolling back "+
+			"%v phase(s): %v, roll back the remaining phases manually",
+			trace.UserMessage(fsmErr), len(rolledBack), trace.UserMessage(rollbackErr))
+	}
+	if len(rolledBack) == 0 {
+		return fmt.Sprintf("update failed: %v; no phases needed to be rolled back",
+			trace.UserMessage(fsmErr))
+	}
+	return fmt.Sprintf("update failed: %v; rolled back %v phase(s): %v",
+		trace.UserMessage(fsmErr), len(rolledBack), strings.Join(rolledBack, ", "))
+}
@@ -17,8 +17,9 @@ limitations under the License.
 package utils
 
 import (
-	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/gravitational/trace"
 	netutils "k8s.io/apimachinery/pkg/util/net"
@@ -56,9 +57,36 @@ func (a Address) EqualPort(other Address) bool {
 	return a.Port == other.Port
 }
 
-// String returns the address string
+// String returns the address string.
+// IPv6 addresses are enclosed in brackets
 func (a Address) String() string {
-	return fmt.Sprintf("%v:%v", a.Addr, a.Port)
+	return net.JoinHostPort(a.Addr, strconv.Itoa(int(a.Port)))
+}
+
+// JoinHostPort combines the specified host and port into a network address.
+// IPv6 addresses are enclosed in brackets
+func JoinHostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// IsIPv6 returns true if the specified address is an IPv6 address
+func IsIPv6(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() == nil
+}
+
+// SplitCIDRs returns the list of CIDR ranges from the specified
+// comma-separated list as used for dual-stack networks, e.g.
+//
+//   "10.244.0.0/16,fd00:244::/56"
+func SplitCIDRs(cidrs string) (result []string) {
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr != "" {
+			result = append(result, cidr)
+		}
+	}
+	return result
 }
 
 // SelectVPCSubnet returns a /24 subnet that does not overlap with the provided subnet blocks
@@ -108,45 +136,110 @@ func SelectSubnet(blocks []string) (string, error) {
 	return "", trace.NotFound("no /16 subnet found in private network range")
 }
 
+// HasAddrFamily returns true if the specified comma-separated list of CIDR
+// ranges includes a range of the same IP family as the provided address
+func HasAddrFamily(cidrs, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range SplitCIDRs(cidrs) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil && (ipNet.IP.To4() == nil) == (ip.To4() == nil) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateKubernetesSubnets makes sure that the provided CIDR ranges can be used as
-// pod/service Kubernetes subnets
+// pod/service Kubernetes subnets.
+// Each range is either a single IPv4 or IPv6 CIDR or, for dual-stack clusters,
+// a comma-separated pair of IPv4 and IPv6 CIDRs
 func ValidateKubernetesSubnets(podCIDR, serviceCIDR string) error {
-	var podNet, serviceNet *net.IPNet
-	var err error
-
 	// make sure the pod subnet is valid
-	if podCIDR != "" {
-		_, podNet, err = net.ParseCIDR(podCIDR)
-		if err != nil {
+	podNets, err := parseDualStackCIDRs("pod", podCIDR)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, podNet := range podNets {
+		// the pod network should be big enough so k8s can allocate
+		// a /24 (IPv4) or a /64 (IPv6) subnet to each node
+		ones, bits := podNet.Mask.Size()
+		if bits == net.IPv4len*8 && ones > minPodIPv4PrefixLen {
 			return trace.BadParameter(
-				"invalid pod network CIDR: %v", podCIDR)
+				"pod network should be a minimum of /%v: %v", minPodIPv4PrefixLen, podNet)
 		}
-
-		// the pod network should be /16 minimum so k8s can allocate /24 to each node
-		ones, _ := podNet.Mask.Size()
-		if ones > 16 {
+		if bits == net.IPv6len*8 && ones > minPodIPv6PrefixLen {
 			return trace.BadParameter(
-				"pod network should be a minimum of /16: %v", podCIDR)
+				"IPv6 pod network should be a minimum of /%v: %v", minPodIPv6PrefixLen, podNet)
 		}
 	}
 
 	// make sure the service subnet is valid
-	if serviceCIDR != "" {
-		_, serviceNet, err = net.ParseCIDR(serviceCIDR)
-		if err != nil {
+	serviceNets, err := parseDualStackCIDRs("service", serviceCIDR)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, serviceNet := range serviceNets {
+		// k8s limits the size of the service IP range
+		ones, bits := serviceNet.Mask.Size()
+		if bits == net.IPv6len*8 && ones < maxServiceIPv6PrefixLen {
 			return trace.BadParameter(
-				"invalid service network CIDR: %v", serviceCIDR)
+				"IPv6 service network should be a maximum of /%v: %v", maxServiceIPv6PrefixLen, serviceNet)
 		}
 	}
 
+	// make sure both subnets use the same IP families
+	if len(podNets) != 0 && len(serviceNets) != 0 && ipFamilies(podNets) != ipFamilies(serviceNets) {
+		return trace.BadParameter(
+			"pod and service subnets should use the same IP families: %v and %v", podCIDR, serviceCIDR)
+	}
+
 	// make sure the subnets do not overlap
-	if podNet != nil && serviceNet != nil {
-		if podNet.Contains(serviceNet.IP) || serviceNet.Contains(podNet.IP) {
+	for _, podNet := range podNets {
+		for _, serviceNet := range serviceNets {
+			if podNet.Contains(serviceNet.IP) || serviceNet.Contains(podNet.IP) {
+				return trace.BadParameter(
+					"pod and service subnets should not overlap")
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckSingleStack returns an error if any of the specified subnets is
+// a dual-stack list of CIDR ranges.
+// The Kubernetes runtime cannot run dual-stack networks yet
+func CheckSingleStack(cidrs ...string) error {
+	for _, cidr := range cidrs {
+		if len(SplitCIDRs(cidr)) > 1 {
 			return trace.BadParameter(
-				"pod and service subnets should not overlap")
+				"dual-stack subnets are not supported, specify a single IPv4 or IPv6 range: %v", cidr)
 		}
 	}
+	return nil
+}
 
+// CheckAddrNotInSubnets returns an error if the specified IP address
+// belongs to any of the provided (possibly dual-stack) CIDR ranges
+func CheckAddrNotInSubnets(addr string, cidrs ...string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return trace.BadParameter("invalid IP address: %v", addr)
+	}
+	for _, cidr := range cidrs {
+		for _, block := range SplitCIDRs(cidr) {
+			_, ipNet, err := net.ParseCIDR(block)
+			if err != nil {
+				return trace.BadParameter("invalid CIDR: %v", block)
+			}
+			if ipNet.Contains(ip) {
+				return trace.BadParameter("address %v overlaps with subnet %v", addr, block)
+			}
+		}
+	}
 	return nil
 }
 
@@ -180,6 +273,60 @@ func LocalIPNetworks() (blocks []net.IPNet, err error) {
 	return blocks, nil
 }
 
+// parseDualStackCIDRs parses the specified comma-separated list of CIDR ranges
+// with at most one range per IP family.
+// name names the network in error messages
+func parseDualStackCIDRs(name, cidrs string) (ipNets []*net.IPNet, err error) {
+	families := make(map[ipFamily]bool)
+	for _, cidr := range SplitCIDRs(cidrs) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, trace.BadParameter(
+				"invalid %v network CIDR: %v", name, cidr)
+		}
+		family := ipNetFamily(ipNet)
+		if families[family] {
+			return nil, trace.BadParameter(
+				"%v network should specify at most one IPv4 and one IPv6 CIDR: %v", name, cidrs)
+		}
+		families[family] = true
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+// ipFamilies returns the set of IP families of the provided networks
+func ipFamilies(ipNets []*net.IPNet) (families ipFamily) {
+	for _, ipNet := range ipNets {
+		families |= ipNetFamily(ipNet)
+	}
+	return families
+}
+
+func ipNetFamily(ipNet *net.IPNet) ipFamily {
+	if ipNet.IP.To4() != nil {
+		return ipFamilyV4
+	}
+	return ipFamilyV6
+}
+
+// ipFamily is a bit set of IP address families
+type ipFamily int
+
+const (
+	ipFamilyV4 ipFamily = 1 << iota
+	ipFamilyV6
+)
+
+const (
+	// minPodIPv4PrefixLen is the minimum size of the IPv4 pod network
+	minPodIPv4PrefixLen = 16
+	// minPodIPv6PrefixLen is the minimum size of the IPv6 pod network
+	minPodIPv6PrefixLen = 56
+	// maxServiceIPv6PrefixLen is the maximum size of the IPv6 service network
+	maxServiceIPv6PrefixLen = 108
+)
+
 // parseCIDRs returns a list of IP networks parsed from the provided list
 func parseCIDRs(blocks []string) ([]net.IPNet, error) {
 	ipNets := make([]net.IPNet, 0, len(blocks))
@@ -157,6 +157,45 @@ func (s *NetSuite) TestValidateKubernetesSubnets(c *check.C) {
 			ok:          false,
 			description: "pod and service subnets overlap",
 		},
+		{
+			podCIDR:     "fd00:244::/56",
+			serviceCIDR: "fd00:100::/112",
+			ok:          true,
+			description: "IPv6 subnets should validate",
+		},
+		{
+			podCIDR:     "10.244.0.0/16,fd00:244::/56",
+			serviceCIDR: "10.100.0.0/16, fd00:100::/112",
+			ok:          true,
+			description: "dual-stack subnets should validate",
+		},
+		{
+			podCIDR:     "fd00:244::/64",
+			ok:          false,
+			description: "IPv6 pod subnet is too small",
+		},
+		{
+			serviceCIDR: "fd00:100::/64",
+			ok:          false,
+			description: "IPv6 service subnet is too big",
+		},
+		{
+			podCIDR:     "10.244.0.0/16,10.245.0.0/16",
+			ok:          false,
+			description: "pod subnet specifies two IPv4 ranges",
+		},
+		{
+			podCIDR:     "10.244.0.0/16,fd00:244::/56",
+			serviceCIDR: "10.100.0.0/16",
+			ok:          false,
+			description: "pod and service subnets use different IP families",
+		},
+		{
+			podCIDR:     "fd00:244::/56",
+			serviceCIDR: "fd00:244::/112",
+			ok:          false,
+			description: "IPv6 pod and service subnets overlap",
+		},
 	}
 	for _, tc := range testCases {
 		err := ValidateKubernetesSubnets(tc.podCIDR, tc.serviceCIDR)
@@ -167,3 +206,45 @@ func (s *NetSuite) TestValidateKubernetesSubnets(c *check.C) {
 		}
 	}
 }
+
+func (s *NetSuite) TestCheckAddrNotInSubnets(c *check.C) {
+	c.Assert(CheckAddrNotInSubnets("192.168.1.1", "10.244.0.0/16", "10.100.0.0/16"), check.IsNil)
+	c.Assert(CheckAddrNotInSubnets("192.168.1.1", "", "10.100.0.0/16"), check.IsNil)
+	c.Assert(CheckAddrNotInSubnets("10.100.5.1", "10.244.0.0/16", "10.100.0.0/16"),
+		check.ErrorMatches, "address 10.100.5.1 overlaps with subnet 10.100.0.0/16")
+	c.Assert(trace.IsBadParameter(CheckAddrNotInSubnets("node-1", "10.100.0.0/16")), check.Equals, true)
+	c.Assert(trace.IsBadParameter(CheckAddrNotInSubnets("10.100.5.1", "10.100.0.0")), check.Equals, true)
+}
+
+func (s *NetSuite) TestCheckAddrNotInDualStackSubnets(c *check.C) {
+	c.Assert(CheckAddrNotInSubnets("fd00:1::1", "10.244.0.0/16,fd00:244::/56"), check.IsNil)
+	c.Assert(CheckAddrNotInSubnets("fd00:244::1", "10.244.0.0/16,fd00:244::/56"),
+		check.ErrorMatches, "address fd00:244::1 overlaps with subnet fd00:244::/56")
+	c.Assert(CheckAddrNotInSubnets("10.244.1.1", "10.244.0.0/16,fd00:244::/56"),
+		check.ErrorMatches, "address 10.244.1.1 overlaps with subnet 10.244.0.0/16")
+}
+
+func (s *NetSuite) TestCheckSingleStack(c *check.C) {
+	c.Assert(CheckSingleStack("10.244.0.0/16", "fd00:100::/112", ""), check.IsNil)
+	c.Assert(trace.IsBadParameter(CheckSingleStack("10.244.0.0/16", "10.100.0.0/16,fd00:100::/112")),
+		check.Equals, true)
+}
+
+func (s *NetSuite) TestHasAddrFamily(c *check.C) {
+	c.Assert(HasAddrFamily("10.244.0.0/16", "192.168.1.1"), check.Equals, true)
+	c.Assert(HasAddrFamily("10.244.0.0/16", "fd00::1"), check.Equals, false)
+	c.Assert(HasAddrFamily("fd00:244::/56", "192.168.1.1"), check.Equals, false)
+	c.Assert(HasAddrFamily("10.244.0.0/16,fd00:244::/56", "fd00::1"), check.Equals, true)
+	c.Assert(HasAddrFamily("10.244.0.0/16", "node-1"), check.Equals, false)
+}
+
+func (s *NetSuite) TestFormatsAddress(c *check.C) {
+	c.Assert(Address{Addr: "192.168.1.1", Port: 3012}.String(), check.Equals, "192.168.1.1:3012")
+	c.Assert(Address{Addr: "fd00::1", Port: 3012}.String(), check.Equals, "[fd00::1]:3012")
+	c.Assert(JoinHostPort("fd00::1", 32009), check.Equals, "[fd00::1]:32009")
+	c.Assert(JoinHostPort("example.com", 32009), check.Equals, "example.com:32009")
+
+	addr, err := NewAddress("[fd00::1]:3012")
+	c.Assert(err, check.IsNil)
+	c.Assert(*addr, check.Equals, Address{Addr: "fd00::1", Port: 3012})
+}
@@ -20,7 +20,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net"
 	"net/url"
@@ -69,8 +68,8 @@ func ParseOpsCenterAddress(in, defaultPort string) string {
 	if err != nil {
 		return ""
 	}
-	if !strings.Contains(u.Host, ":") {
-		u.Host = fmt.Sprintf("%v:%v", u.Host, defaultPort)
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
 	}
 	u.Path = ""
 	return u.String()
@@ -86,13 +85,15 @@ func URLSplitHostPort(in, defaultPort string) (string, string, error) {
 	return host, port, nil
 }
 
-// SplitHostPort extracts host name without port from host
+// SplitHostPort extracts host name without port from host.
+// IPv6 addresses can be specified either in brackets (with or without port)
+// or bare (without port)
 func SplitHostPort(in, defaultPort string) (host string, port string) {
-	parts := strings.SplitN(in, ":", 2)
-	if len(parts) == 2 {
-		return parts[0], parts[1]
+	host, port, err := net.SplitHostPort(in)
+	if err == nil {
+		return host, port
 	}
-	return parts[0], defaultPort
+	return strings.TrimSuffix(strings.TrimPrefix(in, "["), "]"), defaultPort
 }
 
 // ParseHostPort parses the provided address as host:port
@@ -115,15 +116,7 @@ func URLHostname(address string) (string, error) {
 		return "", trace.Wrap(err, "failed parsing url %v", address)
 	}
 
-	if !strings.Contains(targetURL.Host, ":") {
-		return targetURL.Host, nil
-	}
-
-	hostname, _, err := net.SplitHostPort(targetURL.Host)
-	if err != nil {
-		return "", trace.Wrap(err, "failed target host %v", targetURL.Host)
-	}
-	return hostname, nil
+	return targetURL.Hostname(), nil
 }
 
 // ParseLabels parses a string like "a=b,c=d" as a map
@@ -215,3 +215,38 @@ func (s ParseSuite) TestParseZoneOverride(c *check.C) {
 		c.Assert(ns, check.Equals, testCase.outNs, testCase.comment)
 	}
 }
+
+func (s ParseSuite) TestSplitHostPort(c *check.C) {
+	var testCases = []struct {
+		in   string
+		host string
+		port string
+	}{
+		{in: "192.168.1.1", host: "192.168.1.1", port: "3012"},
+		{in: "192.168.1.1:3009", host: "192.168.1.1", port: "3009"},
+		{in: "example.com:3009", host: "example.com", port: "3009"},
+		{in: "fd00::1", host: "fd00::1", port: "3012"},
+		{in: "[fd00::1]", host: "fd00::1", port: "3012"},
+		{in: "[fd00::1]:3009", host: "fd00::1", port: "3009"},
+	}
+	for _, tc := range testCases {
+		host, port := SplitHostPort(tc.in, "3012")
+		c.Assert(host, check.Equals, tc.host, check.Commentf(tc.in))
+		c.Assert(port, check.Equals, tc.port, check.Commentf(tc.in))
+	}
+}
+
+func (s ParseSuite) TestParseOpsCenterAddress(c *check.C) {
+	var testCases = []struct {
+		in  string
+		out string
+	}{
+		{in: "opscenter.example.com", out: "https://opscenter.example.com:443"},
+		{in: "https://opscenter.example.com:32009/web", out: "https://opscenter.example.com:32009"},
+		{in: "[fd00::1]", out: "https://[fd00::1]:443"},
+		{in: "https://[fd00::1]:32009", out: "https://[fd00::1]:32009"},
+	}
+	for _, tc := range testCases {
+		c.Assert(ParseOpsCenterAddress(tc.in, "443"), check.Equals, tc.out, check.Commentf(tc.in))
+	}
+}
@@ -110,3 +110,9 @@ func CombineLabels(labels ...map[string]string) (result map[string]string) {
 	}
 	return result
 }
+
+// LastLine returns the last non-empty line of the command output
+func LastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -287,3 +287,9 @@ func (s *UtilsSuite) TestTrimPathPrefix(c *C) {
 		c.Assert(TrimPathPrefix(t.path, t.prefix...), Equals, t.result)
 	}
 }
+
+func (s *UtilsSuite) TestLastLine(c *C) {
+	c.Assert(LastLine([]byte("Updating cluster\n6e3bd23a-f1ea-4e0a\n\n")), Equals, "6e3bd23a-f1ea-4e0a")
+	c.Assert(LastLine([]byte(" 6e3bd23a-f1ea-4e0a ")), Equals, "6e3bd23a-f1ea-4e0a")
+	c.Assert(LastLine(nil), Equals, "")
+}
@@ -55,6 +55,7 @@ func New(config Config) (*libfsm.FSM, error) {
 	}
 
 	machine.SetPreExec(engine.UpdateProgress)
+	machine.SetPlanGate(ops.MaintenanceWindowGate(config.Operation.Key(), config.Operator))
 	return machine, nil
 }
 
@@ -144,6 +144,11 @@ func (r *Collector) init() (*libfsm.FSM, error) {
 
 func (r *Collector) executePlan(ctx context.Context, machine *libfsm.FSM, force bool) error {
 	planErr := machine.ExecutePlan(ctx, nil, force)
+	if libfsm.IsPaused(planErr) {
+		// keep the operation and the agents running until it is resumed
+		r.Infof("%v.", planErr)
+		return trace.Wrap(planErr)
+	}
 	if planErr != nil {
 		r.Warnf("Failed to execute plan: %v.", trace.DebugReport(planErr))
 	}
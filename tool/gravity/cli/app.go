@@ -27,9 +27,11 @@ import (
 	"strconv"
 
 	appservice "github.com/gravitational/gravity/lib/app"
+	"github.com/gravitational/gravity/lib/app/diff"
 	"github.com/gravitational/gravity/lib/app/resources"
 	"github.com/gravitational/gravity/lib/app/service"
 	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/httplib"
 	"github.com/gravitational/gravity/lib/loc"
@@ -451,6 +453,18 @@ func unpackAppResources(env *localenv.LocalEnvironment, loc loc.Locator, dir, op
 	return nil
 }
 
+func diffApps(env *localenv.LocalEnvironment, from, to loc.Locator, opsCenterURL string, format constants.Format) error {
+	apps, err := env.AppService(opsCenterURL, localenv.AppConfig{}, httplib.WithDialTimeout(dialTimeout))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	result, err := diff.Compare(apps, from, to)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(diff.Write(os.Stdout, *result, format))
+}
+
 func localAppEnviron() (registryHostPort string, err error) {
 	host, err := pickSiteHost()
 	if err != nil {
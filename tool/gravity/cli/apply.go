@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/gravitational/gravity/lib/clusterspec"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/loc"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops/resources/gravity"
+	"github.com/gravitational/gravity/tool/common"
+
+	"github.com/gravitational/trace"
+)
+
+// applyClusterSpec computes the difference between the cluster and the
+// specification in filename, displays it and applies the changes
+func applyClusterSpec(
+	env *localenv.LocalEnvironment,
+	getUpgradeEnv func() (*localenv.LocalEnvironment, error),
+	filename string,
+	dryRun, confirmed bool,
+	format constants.Format,
+) error {
+	reader, err := common.GetReader(filename)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	spec, err := clusterspec.Unmarshal(data)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if spec.Metadata.Name != cluster.Domain {
+		return trace.BadParameter("specification is for cluster %q, this is cluster %q",
+			spec.Metadata.Name, cluster.Domain)
+	}
+	gravityResources, err := gravity.New(gravity.Config{
+		Operator:    operator,
+		CurrentUser: env.CurrentUser(),
+		Silent:      env.Silent,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	changes, err := clusterspec.Diff(*spec, *cluster, gravityResources)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = clusterspec.Write(os.Stdout, changes, format)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if dryRun {
+		printManualChanges(env, changes)
+		return nil
+	}
+	if err := clusterspec.CheckChanges(changes); err != nil {
+		return trace.Wrap(err)
+	}
+	if !hasAutomaticChanges(changes) {
+		printManualChanges(env, changes)
+		return nil
+	}
+	if !confirmed {
+		if err := enforceConfirmation("Apply the changes?"); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	err = clusterspec.Apply(clusterspec.ApplyConfig{
+		Resources: gravityResources,
+		Upgrade: func(app loc.Locator) error {
+			upgradeEnv, err := getUpgradeEnv()
+			if err != nil {
+				return trace.Wrap(err)
+			}
+			defer upgradeEnv.Close()
+			return trace.Wrap(updateTrigger(env, upgradeEnv, app.String(), false, nil, false))
+		},
+	}, changes)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	printManualChanges(env, changes)
+	return nil
+}
+
+func hasAutomaticChanges(changes []clusterspec.Change) bool {
+	for _, change := range changes {
+		if !change.IsManual() {
+			return true
+		}
+	}
+	return false
+}
+
+func printManualChanges(env *localenv.LocalEnvironment, changes []clusterspec.Change) {
+	for _, change := range changes {
+		switch change.Action {
+		case clusterspec.ActionExpand:
+			env.Printf("Node profile %q requires more nodes (%v), "+
+				"use 'gravity join' on the new nodes to add them.\n", change.Name, change.Details)
+		case clusterspec.ActionShrink:
+			env.Printf("Node profile %q has extra nodes (%v), the specification will be rejected, "+
+				"use 'gravity remove' to remove them first.\n", change.Name, change.Details)
+		}
+	}
+}
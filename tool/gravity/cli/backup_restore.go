@@ -18,24 +18,23 @@ package cli
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gravitational/gravity/lib/app"
-	"github.com/gravitational/gravity/lib/app/hooks"
 	"github.com/gravitational/gravity/lib/archive"
-	"github.com/gravitational/gravity/lib/defaults"
+	libbackup "github.com/gravitational/gravity/lib/backup"
 	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/pack"
 	"github.com/gravitational/gravity/lib/schema"
 	"github.com/gravitational/gravity/lib/utils"
 
 	dockerarchive "github.com/docker/docker/pkg/archive"
-	teleutils "github.com/gravitational/teleport/lib/utils"
 	"github.com/gravitational/trace"
-	"k8s.io/api/core/v1"
+	"github.com/sirupsen/logrus"
 )
 
 func backup(env *localenv.LocalEnvironment, tarball string, timeout time.Duration, follow, silent bool) (err error) {
@@ -47,30 +46,7 @@ func backup(env *localenv.LocalEnvironment, tarball string, timeout time.Duratio
 	progress.NextStep("backing up to %v", tarball)
 	return runBackupRestore(env, "backup",
 		func(env *localenv.LocalEnvironment, backupPath string, req *app.HookRunRequest) error {
-			req.Hook = schema.HookBackup
-			if timeout != 0 {
-				req.Timeout = timeout
-			}
-			apps, err := env.SiteApps()
-			if err != nil {
-				return trace.Wrap(err)
-			}
-			ref, err := app.StreamAppHook(
-				ctx, apps, *req, getStreamingWriter(silent, follow))
-			if err != nil {
-				return trace.Wrap(err)
-			}
-			defer func() {
-				err := apps.DeleteAppHookJob(ctx, *ref)
-				if err != nil {
-					log.Warningf("failed to delete hook %v: %v",
-						ref, trace.DebugReport(err))
-				}
-				if err = os.RemoveAll(backupPath); err != nil {
-					log.Errorf("failed to remove backup directory %s: %v", backupPath, err)
-				}
-			}()
-			err = compressDirectory(backupPath, tarball)
+			err := backupApp(ctx, env, backupPath, req, tarball, timeout, follow, silent)
 			if err != nil {
 				return trace.Wrap(err)
 			}
@@ -79,6 +55,124 @@ func backup(env *localenv.LocalEnvironment, tarball string, timeout time.Duratio
 		})
 }
 
+// backupCluster writes a cluster backup bundle for disaster recovery
+// into the specified tarball.
+//
+// In addition to the results of the application backup hook, the bundle
+// contains the cluster state and the cluster packages and can be restored
+// on a new set of nodes with gravity install --restore
+func backupCluster(env *localenv.LocalEnvironment, tarball string, timeout time.Duration, follow, silent bool) (err error) {
+	ctx := context.Background()
+	cluster, server, err := getLocalEtcdMaster(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	hasAppBackup := cluster.App.Manifest.HasHook(schema.HookBackup)
+	steps := 4
+	if hasAppBackup {
+		steps++
+	}
+	// if we're streaming logs to stdout, no much sense in showing our progress indicator
+	noProgress := silent || follow
+	progress := utils.NewProgress(ctx, "backup", steps, noProgress)
+	defer progress.Stop()
+	// keep the bundle contents on the same filesystem as the resulting tarball
+	dir, err := ioutil.TempDir(filepath.Dir(tarball), ".gravity-backup")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle, err := libbackup.New(dir, libbackup.Metadata{
+		ClusterName:  cluster.Domain,
+		Application:  cluster.App.Package,
+		Created:      time.Now().UTC(),
+		Servers:      cluster.ClusterState.Servers,
+		HasAppBackup: hasAppBackup,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	clusterEnv, err := env.NewClusterEnvironment()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer clusterEnv.Backend.Close()
+
+	progress.NextStep("exporting cluster state")
+	if err := libbackup.ExportState(clusterEnv.Backend, bundle.StatePath()); err != nil {
+		return trace.Wrap(err)
+	}
+
+	progress.NextStep("exporting cluster packages")
+	if err := exportBundlePackages(clusterEnv.Packages, bundle); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if hasAppBackup {
+		progress.NextStep("running application backup hook")
+		req, backupPath, err := libbackup.HookRequest(cluster.App.Package, *server)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		err = backupApp(ctx, env, backupPath, req, bundle.AppPath(), timeout, follow, silent)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	progress.NextStep("writing backup to %v", tarball)
+	f, err := os.Create(tarball)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+	if err := bundle.Write(f); err != nil {
+		return trace.Wrap(err)
+	}
+	progress.NextStep("backup is written to %v", tarball)
+	return nil
+}
+
+// exportBundlePackages copies the cluster packages into the bundle
+func exportBundlePackages(packages pack.PackageService, bundle *libbackup.Bundle) error {
+	bundlePackages, backend, err := bundle.Packages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer backend.Close()
+	err = libbackup.ExportPackages(packages, bundlePackages, bundle.ClusterName, logrus.WithField(trace.Component, "backup"))
+	return trace.Wrap(err)
+}
+
+// backupApp runs the application backup hook and compresses its results
+// into the specified tarball
+func backupApp(ctx context.Context, env *localenv.LocalEnvironment, backupPath string, req *app.HookRunRequest, tarball string, timeout time.Duration, follow, silent bool) error {
+	req.Hook = schema.HookBackup
+	if timeout != 0 {
+		req.Timeout = timeout
+	}
+	apps, err := env.SiteApps()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	ref, err := app.StreamAppHook(
+		ctx, apps, *req, getStreamingWriter(silent, follow))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer func() {
+		err := apps.DeleteAppHookJob(ctx, *ref)
+		if err != nil {
+			log.Warningf("failed to delete hook %v: %v",
+				ref, trace.DebugReport(err))
+		}
+		if err = os.RemoveAll(backupPath); err != nil {
+			log.Errorf("failed to remove backup directory %s: %v", backupPath, err)
+		}
+	}()
+	return trace.Wrap(compressDirectory(backupPath, tarball))
+}
+
 func restore(env *localenv.LocalEnvironment, tarball string, timeout time.Duration, follow, silent bool) error {
 	ctx := context.Background()
 	// if we're streaming logs to stdout, no much sense in showing our progress indicator
@@ -139,31 +233,7 @@ func runBackupRestore(env *localenv.LocalEnvironment, operation string,
 
 	log.Infof("running %v for %v on %v", operation, site.App.Package, node.KubeNodeID())
 
-	id, err := teleutils.CryptoRandomHex(3)
-	if err != nil {
-		return trace.Wrap(err, "failed to generate random ID")
-	}
-
-	req := &app.HookRunRequest{
-		Application: site.App.Package,
-		Volumes: []v1.Volume{{
-			Name: hooks.VolumeBackup,
-			VolumeSource: v1.VolumeSource{
-				HostPath: &v1.HostPathVolumeSource{
-					Path: fmt.Sprintf("/ext/state/%v/backup", id),
-				},
-			},
-		}},
-		VolumeMounts: []v1.VolumeMount{{
-			Name:      hooks.VolumeBackup,
-			MountPath: hooks.ContainerBackupDir,
-		}},
-		NodeSelector: map[string]string{
-			defaults.KubernetesHostnameLabel: node.KubeNodeID(),
-		},
-	}
-
-	backupDir, err := localenv.InGravity(fmt.Sprintf("planet/state/%v/backup", id))
+	req, backupDir, err := libbackup.HookRequest(site.App.Package, *node)
 	if err != nil {
 		return trace.Wrap(err)
 	}
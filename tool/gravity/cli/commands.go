@@ -130,6 +130,8 @@ type Application struct {
 	AppHookCmd AppHookCmd
 	// AppUnpackCmd unpacks specified app resources
 	AppUnpackCmd AppUnpackCmd
+	// AppDiffCmd shows the difference between two application packages
+	AppDiffCmd AppDiffCmd
 	// WizardCmd starts installer in UI mode
 	WizardCmd WizardCmd
 	// AppPackageCmd displays the name of app in installer tarball
@@ -142,6 +144,8 @@ type Application struct {
 	OpsDisconnectCmd OpsDisconnectCmd
 	// OpsListCmd lists ops credentials
 	OpsListCmd OpsListCmd
+	// OpsUninstallCmd manages the uninstall operation of a cluster
+	OpsUninstallCmd OpsUninstallCmd
 	// OpsAgentCmd launches install agent
 	OpsAgentCmd OpsAgentCmd
 	// PackCmd combines subcommands for package service
@@ -275,6 +279,14 @@ type Application struct {
 	// GarbageCollectCmd prunes unused resources (package/journal files/docker images)
 	// in the cluster
 	GarbageCollectCmd GarbageCollectCmd
+	// ReconfigureCmd combines cluster reconfiguration subcommands
+	ReconfigureCmd ReconfigureCmd
+	// ReconfigureNetworkCmd changes the network settings of the cluster
+	ReconfigureNetworkCmd ReconfigureNetworkCmd
+	// ReconfigureNodeCmd changes the advertise address of a cluster node
+	ReconfigureNodeCmd ReconfigureNodeCmd
+	// ReconfigureDockerCmd migrates a cluster node to a different Docker storage driver
+	ReconfigureDockerCmd ReconfigureDockerCmd
 	// PlanetCmd combines planet subcommands
 	PlanetCmd PlanetCmd
 	// [DEPRECATED] PlanetEnterCmd enters planet container
@@ -295,6 +307,34 @@ type Application struct {
 	ResourceRemoveCmd ResourceRemoveCmd
 	// ResourceGetCmd shows specified resource
 	ResourceGetCmd ResourceGetCmd
+	// ApplyCmd applies a cluster specification
+	ApplyCmd ApplyCmd
+	// ScheduleCmd combines subcommands for scheduled operations
+	ScheduleCmd ScheduleCmd
+	// ScheduleCreateCmd schedules an operation in a maintenance window
+	ScheduleCreateCmd ScheduleCreateCmd
+	// ScheduleListCmd lists scheduled operations
+	ScheduleListCmd ScheduleListCmd
+	// ScheduleRemoveCmd removes a scheduled operation
+	ScheduleRemoveCmd ScheduleRemoveCmd
+	// EtcdCmd combines etcd maintenance subcommands
+	EtcdCmd EtcdCmd
+	// EtcdSnapshotCmd takes a snapshot of the etcd data
+	EtcdSnapshotCmd EtcdSnapshotCmd
+	// EtcdRestoreCmd restores the etcd data from a snapshot
+	EtcdRestoreCmd EtcdRestoreCmd
+	// EtcdStatusCmd displays the status of etcd members
+	EtcdStatusCmd EtcdStatusCmd
+	// EtcdDefragCmd defragments etcd members
+	EtcdDefragCmd EtcdDefragCmd
+	// NodeCmd combines subcommands that change cluster node configuration
+	NodeCmd NodeCmd
+	// NodeLabelCmd adds or removes node labels
+	NodeLabelCmd NodeLabelCmd
+	// NodeTaintCmd adds or removes node taints
+	NodeTaintCmd NodeTaintCmd
+	// NodeProfileCmd changes the node profile
+	NodeProfileCmd NodeProfileCmd
 }
 
 // VersionCmd displays the binary version
@@ -313,6 +353,21 @@ func (r InstallCmd) DNSConfig() (config storage.DNSConfig) {
 	return config
 }
 
+// explicitFlags is a set of names of the command flags specified
+// on the command line as opposed to the flags set from defaults
+type explicitFlags map[string]bool
+
+// record is a command action that collects the flags specified
+// on the command line
+func (r explicitFlags) record(ctx *kingpin.ParseContext) error {
+	for _, element := range ctx.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			r[flag.Model().Name] = true
+		}
+	}
+	return nil
+}
+
 // InstallCmd launches cluster installation
 type InstallCmd struct {
 	*kingpin.CmdClause
@@ -378,6 +433,12 @@ type InstallCmd struct {
 	DNSHosts *[]string
 	// DNSZones is a list of DNS zone overrides
 	DNSZones *[]string
+	// From is the path to the install configuration file
+	From *string
+	// Restore is the path to the cluster backup bundle to restore
+	Restore *string
+	// ExplicitFlags lists the flags specified on the command line
+	ExplicitFlags explicitFlags
 }
 
 // JoinCmd joins to the installer or existing cluster
@@ -415,6 +476,10 @@ type JoinCmd struct {
 	Complete *bool
 	// OperationID is the ID of the operation created via UI
 	OperationID *string
+	// From is the path to the install configuration file
+	From *string
+	// ExplicitFlags lists the flags specified on the command line
+	ExplicitFlags explicitFlags
 }
 
 // AutoJoinCmd uses cloud provider info to join existing cluster
@@ -450,6 +515,10 @@ type RemoveCmd struct {
 	Force *bool
 	// Confirm suppresses confirmation prompt
 	Confirm *bool
+	// Phase is the specific phase of the operation to execute
+	Phase *string
+	// Resume resumes the aborted operation
+	Resume *bool
 }
 
 // PlanCmd displays operation plan
@@ -569,6 +638,14 @@ type UpgradeCmd struct {
 	Resume *bool
 	// SkipVersionCheck suppresses version mismatch errors
 	SkipVersionCheck *bool
+	// Canary updates a single regular node first and waits for approval
+	Canary *bool
+	// BatchSize is the number of regular nodes updated in parallel
+	BatchSize *int
+	// Approve approves the canary node update and resumes the operation
+	Approve *bool
+	// AutoRollback rolls back the update automatically if it fails
+	AutoRollback *bool
 }
 
 // StatusCmd displays cluster status
@@ -584,6 +661,12 @@ type StatusCmd struct {
 	Seconds *int
 	// Output is output format
 	Output *constants.Format
+	// Drift displays differences between the node and the expected cluster state
+	Drift *bool
+	// Repair repairs the detected drift
+	Repair *bool
+	// Local limits drift detection to the local node
+	Local *bool
 }
 
 // StatusResetCmd resets cluster to active state
@@ -600,6 +683,8 @@ type BackupCmd struct {
 	Timeout *time.Duration
 	// Follow tails operation logs
 	Follow *bool
+	// Cluster creates a cluster backup bundle for disaster recovery
+	Cluster *bool
 }
 
 // RestoreCmd launches app restore hook
@@ -650,6 +735,10 @@ type AppInstallCmd struct {
 	RegistryCert *string
 	// RegistryKey is a registry client private key path.
 	RegistryKey *string
+	// TrustedKeys is a list of public key files image locks are accepted from.
+	TrustedKeys *[]string
+	// RequireSignature rejects images without an image lock signed by a trusted key.
+	RequireSignature *bool
 }
 
 // AppListCmd shows all application releases.
@@ -676,6 +765,10 @@ type AppUpgradeCmd struct {
 	RegistryCert *string
 	// RegistryKey is a registry client private key path.
 	RegistryKey *string
+	// TrustedKeys is a list of public key files image locks are accepted from.
+	TrustedKeys *[]string
+	// RequireSignature rejects images without an image lock signed by a trusted key.
+	RequireSignature *bool
 }
 
 // AppRollbackCmd rolls back a release.
@@ -714,6 +807,10 @@ type AppSyncCmd struct {
 	RegistryCert *string
 	// RegistryKey is a registry client private key path.
 	RegistryKey *string
+	// TrustedKeys is a list of public key files image locks are accepted from.
+	TrustedKeys *[]string
+	// RequireSignature rejects images without an image lock signed by a trusted key.
+	RequireSignature *bool
 }
 
 // AppImportCmd imports app into cluster
@@ -850,6 +947,19 @@ type AppUnpackCmd struct {
 	ServiceUID *string
 }
 
+// AppDiffCmd shows the difference between two application packages
+type AppDiffCmd struct {
+	*kingpin.CmdClause
+	// From is the older application package
+	From *loc.Locator
+	// To is the newer application package
+	To *loc.Locator
+	// OpsCenterURL is app service URL to compare apps in
+	OpsCenterURL *string
+	// Format is the output format
+	Format *constants.Format
+}
+
 // WizardCmd starts installer in UI mode
 type WizardCmd struct {
 	*kingpin.CmdClause
@@ -892,6 +1002,24 @@ type OpsListCmd struct {
 	*kingpin.CmdClause
 }
 
+// OpsUninstallCmd displays or executes the plan of the
+// cluster uninstall operation
+type OpsUninstallCmd struct {
+	*kingpin.CmdClause
+	// Cluster is the name of the cluster being uninstalled
+	Cluster *string
+	// Phase is the specific phase of the operation to execute
+	Phase *string
+	// Resume resumes the failed operation
+	Resume *bool
+	// Force forces phase execution
+	Force *bool
+	// Skip marks the node phase completed without executing it
+	Skip *bool
+	// Output is the output format of the plan
+	Output *constants.Format
+}
+
 // OpsAgentCmd launches install agent
 type OpsAgentCmd struct {
 	*kingpin.CmdClause
@@ -1479,6 +1607,71 @@ type GarbageCollectCmd struct {
 	Force *bool
 }
 
+// ReconfigureCmd combines cluster reconfiguration subcommands
+type ReconfigureCmd struct {
+	*kingpin.CmdClause
+}
+
+// ReconfigureNetworkCmd changes the pod/service subnets and the
+// overlay network port of the cluster
+type ReconfigureNetworkCmd struct {
+	*kingpin.CmdClause
+	// PodCIDR is the new pod subnet
+	PodCIDR *string
+	// ServiceCIDR is the new service subnet
+	ServiceCIDR *string
+	// VxlanPort is the new overlay network port
+	VxlanPort *int
+	// Phase is the specific phase to run
+	Phase *string
+	// PhaseTimeout is the phase execution timeout
+	PhaseTimeout *time.Duration
+	// Resume is whether to resume a failed network reconfiguration
+	Resume *bool
+	// Manual is whether the operation is not executed automatically
+	Manual *bool
+	// Force forces phase execution
+	Force *bool
+}
+
+// ReconfigureNodeCmd changes the advertise address of a cluster node
+type ReconfigureNodeCmd struct {
+	*kingpin.CmdClause
+	// Server is the hostname or the current advertise address of the node
+	Server *string
+	// AdvertiseAddr is the new advertise address of the node
+	AdvertiseAddr *string
+	// Phase is the specific phase to run
+	Phase *string
+	// PhaseTimeout is the phase execution timeout
+	PhaseTimeout *time.Duration
+	// Resume is whether to resume a failed node reconfiguration
+	Resume *bool
+	// Manual is whether the operation is not executed automatically
+	Manual *bool
+	// Force forces phase execution
+	Force *bool
+}
+
+// ReconfigureDockerCmd migrates a cluster node to a different Docker storage driver
+type ReconfigureDockerCmd struct {
+	*kingpin.CmdClause
+	// Server is the hostname or the advertise address of the node
+	Server *string
+	// StorageDriver is the new Docker storage driver of the node
+	StorageDriver *string
+	// Phase is the specific phase to run
+	Phase *string
+	// PhaseTimeout is the phase execution timeout
+	PhaseTimeout *time.Duration
+	// Resume is whether to resume a failed storage driver migration
+	Resume *bool
+	// Manual is whether the operation is not executed automatically
+	Manual *bool
+	// Force forces phase execution
+	Force *bool
+}
+
 // GarbageCollectPlanCmd displays the plan of the garbage collection operation
 type GarbageCollectPlanCmd struct {
 	*kingpin.CmdClause
@@ -1569,3 +1762,121 @@ type ResourceGetCmd struct {
 	// User is resource owner
 	User *string
 }
+
+// ApplyCmd brings the cluster to the state described by a cluster specification
+type ApplyCmd struct {
+	*kingpin.CmdClause
+	// Filename is path to file with the cluster specification
+	Filename *string
+	// DryRun displays the changes without applying them
+	DryRun *bool
+	// Confirm suppresses confirmation prompt
+	Confirm *bool
+	// Output is output format
+	Output *constants.Format
+}
+
+// ScheduleCmd combines subcommands for scheduled operations
+type ScheduleCmd struct {
+	*kingpin.CmdClause
+}
+
+// ScheduleCreateCmd schedules an operation in a maintenance window
+type ScheduleCreateCmd struct {
+	*kingpin.CmdClause
+	// Operation is the type of the operation to schedule
+	Operation *string
+	// App is the application package to update to
+	App *string
+	// Days lists week days the maintenance window opens on
+	Days *[]string
+	// Start is the time of day the maintenance window opens at
+	Start *string
+	// Duration is the maintenance window duration
+	Duration *time.Duration
+}
+
+// ScheduleListCmd lists scheduled operations
+type ScheduleListCmd struct {
+	*kingpin.CmdClause
+	// Format is the output format
+	Format *constants.Format
+}
+
+// ScheduleRemoveCmd removes a scheduled operation
+type ScheduleRemoveCmd struct {
+	*kingpin.CmdClause
+	// ID is the schedule ID
+	ID *string
+}
+
+// EtcdCmd combines etcd maintenance subcommands
+type EtcdCmd struct {
+	*kingpin.CmdClause
+}
+
+// EtcdSnapshotCmd takes a snapshot of the etcd data
+type EtcdSnapshotCmd struct {
+	*kingpin.CmdClause
+	// Retain is the number of most recent snapshots to keep
+	Retain *int
+}
+
+// EtcdRestoreCmd restores the etcd data from a snapshot
+type EtcdRestoreCmd struct {
+	*kingpin.CmdClause
+	// Version is the version of the snapshot to restore
+	Version *string
+	// Confirm suppresses the confirmation prompt
+	Confirm *bool
+	// Resume resumes the interrupted restore
+	Resume *bool
+	// Rollback rolls back the interrupted restore
+	Rollback *bool
+}
+
+// EtcdStatusCmd displays the status of etcd members
+type EtcdStatusCmd struct {
+	*kingpin.CmdClause
+	// Output is the output format
+	Output *constants.Format
+}
+
+// EtcdDefragCmd defragments etcd members
+type EtcdDefragCmd struct {
+	*kingpin.CmdClause
+}
+
+// NodeCmd combines subcommands that change cluster node configuration
+type NodeCmd struct {
+	*kingpin.CmdClause
+}
+
+// NodeLabelCmd adds or removes node labels
+type NodeLabelCmd struct {
+	*kingpin.CmdClause
+	// Node is the hostname or the advertise address of the node
+	Node *string
+	// Labels lists labels to add as key=value and to remove as key-
+	Labels *[]string
+}
+
+// NodeTaintCmd adds or removes node taints
+type NodeTaintCmd struct {
+	*kingpin.CmdClause
+	// Node is the hostname or the advertise address of the node
+	Node *string
+	// Taints lists taints to add as key=value:effect and to remove as key:effect- or key-
+	Taints *[]string
+}
+
+// NodeProfileCmd changes the node profile
+type NodeProfileCmd struct {
+	*kingpin.CmdClause
+	// Node is the hostname or the advertise address of the node
+	Node *string
+	// Profile is the name of the new node profile
+	Profile *string
+	// Force skips the node requirements check
+	Force *bool
+}
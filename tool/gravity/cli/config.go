@@ -18,14 +18,20 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 
+	libbackup "github.com/gravitational/gravity/lib/backup"
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/expand"
 	"github.com/gravitational/gravity/lib/install"
+	"github.com/gravitational/gravity/lib/installconfig"
 	"github.com/gravitational/gravity/lib/loc"
 	"github.com/gravitational/gravity/lib/localenv"
 	"github.com/gravitational/gravity/lib/pack"
@@ -106,6 +112,13 @@ type InstallConfig struct {
 	// It can be overridden with this value (i.e. when cluster name does not
 	// conform to the GCE tag requirements)
 	NodeTags []string
+	// From is the path to the install configuration file
+	From string
+	// Restore is the path to the cluster backup to restore the cluster from
+	Restore string
+	// explicitFlags lists the flags specified on the command line.
+	// They take precedence over the install configuration file
+	explicitFlags explicitFlags
 	// NewProcess is used to launch gravity API server process
 	NewProcess process.NewGravityProcess
 }
@@ -150,6 +163,10 @@ func NewInstallConfig(g *Application) InstallConfig {
 		ServiceUID: *g.InstallCmd.ServiceUID,
 		ServiceGID: *g.InstallCmd.ServiceGID,
 		NodeTags:   *g.InstallCmd.GCENodeTags,
+		From:       *g.InstallCmd.From,
+		Restore:    *g.InstallCmd.Restore,
+
+		explicitFlags: g.InstallCmd.ExplicitFlags,
 	}
 }
 
@@ -183,6 +200,16 @@ func (i *InstallConfig) CheckAndSetDefaults() (err error) {
 		}
 		return trace.Wrap(err)
 	}
+	if i.From != "" {
+		if err := i.applyInstallConfig(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if i.Restore != "" {
+		if err := i.checkRestore(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
 	if i.InstallToken == "" {
 		if i.InstallToken, err = teleutils.CryptoRandomHex(6); err != nil {
 			return trace.Wrap(err)
@@ -206,6 +233,114 @@ func (i *InstallConfig) CheckAndSetDefaults() (err error) {
 	return nil
 }
 
+// applyInstallConfig populates the configuration from the install configuration
+// file and validates the file against the manifest of the application being installed
+func (i *InstallConfig) applyInstallConfig() error {
+	config, err := readInstallConfig(i.From)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	spec := config.Spec
+	flags := i.explicitFlags
+	for _, setting := range []struct {
+		flag   string
+		target *string
+		value  string
+	}{
+		{"cluster", &i.SiteDomain, spec.Cluster},
+		{"app", &i.AppPackage, spec.App},
+		{"token", &i.InstallToken, spec.Token},
+		{"cloud-provider", &i.CloudProvider, spec.CloudProvider},
+		{"config", &i.ResourcesPath, spec.ResourcesPath},
+		{"pod-network-cidr", &i.PodCIDR, spec.Network.PodCIDR},
+		{"service-cidr", &i.ServiceCIDR, spec.Network.ServiceCIDR},
+		{"storage-driver", &i.Docker.StorageDriver, spec.Docker.StorageDriver},
+		{"service-uid", &i.ServiceUID, spec.ServiceUser.UID},
+		{"service-gid", &i.ServiceGID, spec.ServiceUser.GID},
+		{"flavor", &i.Flavor, spec.Flavor},
+	} {
+		if err := flags.setString(setting.flag, setting.target, setting.value); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	if err := flags.setInt("vxlan-port", &i.VxlanPort, spec.Network.VxlanPort); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := flags.setInt("dns-port", &i.DNSConfig.Port, spec.DNS.Port); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := flags.setStrings("dns-listen-addr", &i.DNSConfig.Addrs, spec.DNS.ListenAddrs); err != nil {
+		return trace.Wrap(err)
+	}
+	i.DNSHosts = append(i.DNSHosts, spec.DNS.HostOverrides()...)
+	i.DNSZones = append(i.DNSZones, spec.DNS.ZoneOverrides()...)
+	i.Docker.Args = append(i.Docker.Args, spec.Docker.Args...)
+	i.NodeTags = append(i.NodeTags, spec.GCENodeTags...)
+	config.Spec.Flavor = i.Flavor
+
+	locator, err := i.GetAppPackage()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env, err := localenv.New(i.ReadStateDir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer env.Close()
+	app, err := env.Apps.GetApp(*locator)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := config.Validate(app.Manifest); err != nil {
+		return trace.Wrap(err, "install configuration %v does not match application %v",
+			i.From, locator)
+	}
+	i.Flavor = config.Spec.Flavor
+
+	node, err := localInstallConfigNode(*config, i.AdvertiseAddr)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	i.AdvertiseAddr = node.AdvertiseAddr
+	if err := flags.applyNode(*node, &i.Role, &i.SystemDevice, &i.DockerDevice, &i.Mounts); err != nil {
+		return trace.Wrap(err)
+	}
+	log.Infof("Applied install configuration %v for node %v.", i.From, i.AdvertiseAddr)
+	return nil
+}
+
+// checkRestore makes sure the cluster backup can be restored with the
+// application being installed and sets the cluster name to the name
+// of the backed up cluster
+func (i *InstallConfig) checkRestore() error {
+	if i.Mode != constants.InstallModeCLI {
+		return trace.BadParameter("cluster can only be restored from backup in %v install mode",
+			constants.InstallModeCLI)
+	}
+	metadata, err := libbackup.ReadMetadata(i.Restore)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if i.SiteDomain != "" && i.SiteDomain != metadata.ClusterName {
+		return trace.BadParameter("backup of cluster %v can not be restored as cluster %v",
+			metadata.ClusterName, i.SiteDomain)
+	}
+	locator, err := i.GetAppPackage()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if locator.Repository != metadata.Application.Repository || locator.Name != metadata.Application.Name {
+		return trace.BadParameter("backup of application %v can not be restored with application %v",
+			metadata.Application, locator)
+	}
+	if locator.Version != metadata.Application.Version {
+		log.Warnf("Restoring backup of %v with %v.", metadata.Application, locator)
+	}
+	i.SiteDomain = metadata.ClusterName
+	log.Infof("Restoring cluster %v backed up at %v.", metadata.ClusterName, metadata.Created)
+	return nil
+}
+
 // GetAdvertiseAddr return the advertise address provided in the config, or
 // asks the user to choose it among the host's interfaces
 func (i *InstallConfig) GetAdvertiseAddr() (string, error) {
@@ -339,6 +474,7 @@ func (i *InstallConfig) ToInstallerConfig(env *localenv.LocalEnvironment) (*inst
 		ServiceUser:   i.ServiceUser,
 		GCENodeTags:   i.NodeTags,
 		NewProcess:    i.NewProcess,
+		Restore:       i.Restore,
 	}, nil
 }
 
@@ -396,6 +532,11 @@ type JoinConfig struct {
 	Phase string
 	// OperationID is ID of existing join operation
 	OperationID string
+	// From is the path to the install configuration file
+	From string
+	// explicitFlags lists the flags specified on the command line.
+	// They take precedence over the install configuration file
+	explicitFlags explicitFlags
 }
 
 // NewJoinConfig populates join configuration from the provided CLI application
@@ -415,11 +556,19 @@ func NewJoinConfig(g *Application) JoinConfig {
 		Manual:        *g.JoinCmd.Manual,
 		Phase:         *g.JoinCmd.Phase,
 		OperationID:   *g.JoinCmd.OperationID,
+		From:          *g.JoinCmd.From,
+
+		explicitFlags: g.JoinCmd.ExplicitFlags,
 	}
 }
 
 // CheckAndSetDefaults validates the configuration and sets default values
 func (j *JoinConfig) CheckAndSetDefaults() (err error) {
+	if j.From != "" {
+		if err := j.applyInstallConfig(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
 	j.CloudProvider, err = install.ValidateCloudProvider(j.CloudProvider)
 	if err != nil {
 		return trace.Wrap(err)
@@ -427,6 +576,35 @@ func (j *JoinConfig) CheckAndSetDefaults() (err error) {
 	return nil
 }
 
+// applyInstallConfig populates the configuration from the settings
+// of this node in the install configuration file
+func (j *JoinConfig) applyInstallConfig() error {
+	config, err := readInstallConfig(j.From)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	node, err := localInstallConfigNode(*config, j.AdvertiseAddr)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if j.PeerAddrs == "" {
+		j.PeerAddrs = strings.Join(config.Peers(*node), ",")
+	}
+	flags := j.explicitFlags
+	if err := flags.setString("token", &j.Token, config.Spec.Token); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := flags.setString("cloud-provider", &j.CloudProvider, config.Spec.CloudProvider); err != nil {
+		return trace.Wrap(err)
+	}
+	j.AdvertiseAddr = node.AdvertiseAddr
+	if err := flags.applyNode(*node, &j.Role, &j.SystemDevice, &j.DockerDevice, &j.Mounts); err != nil {
+		return trace.Wrap(err)
+	}
+	log.Infof("Applied install configuration %v for node %v.", j.From, j.AdvertiseAddr)
+	return nil
+}
+
 // GetAdvertiseAddr return the advertise address provided in the config, or
 // picks one among the host's interfaces
 func (j *JoinConfig) GetAdvertiseAddr() (string, error) {
@@ -516,3 +694,121 @@ func convertMounts(mounts map[string]string) (result []*proto.Mount) {
 	}
 	return result
 }
+
+// readInstallConfig reads the install configuration from the specified file
+func readInstallConfig(path string) (*installconfig.InstallConfigV2, error) {
+	data, err := utils.ReadPath(path)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	config, err := installconfig.Unmarshal(data)
+	if err != nil {
+		return nil, trace.Wrap(err, "invalid install configuration %v", path)
+	}
+	return config, nil
+}
+
+// localInstallConfigNode returns the node of the install configuration
+// with the specified advertise address or, if the address is not set,
+// the node with one of this host's addresses
+func localInstallConfigNode(config installconfig.InstallConfigV2, advertiseAddr string) (*installconfig.NodeV2, error) {
+	blocks, err := utils.LocalIPNetworks()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	node, err := config.LocalNode(advertiseAddr, blocks)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return node, nil
+}
+
+// applyNode populates the node settings from the node's block
+// in the install configuration file
+func (r explicitFlags) applyNode(node installconfig.NodeV2, role, systemDevice, dockerDevice *string, mounts *map[string]string) error {
+	if err := r.setString("role", role, node.Role); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := r.setString("system-device", systemDevice, node.SystemDevice); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := r.setString("docker-device", dockerDevice, node.DockerDevice); err != nil {
+		return trace.Wrap(err)
+	}
+	if len(node.Mounts) == 0 {
+		return nil
+	}
+	if !r["mount"] {
+		*mounts = node.Mounts
+		return nil
+	}
+	if !reflect.DeepEqual(*mounts, node.Mounts) {
+		return trace.BadParameter("--mount=%v conflicts with %v from the install configuration file",
+			formatMounts(*mounts), formatMounts(node.Mounts))
+	}
+	return nil
+}
+
+// setString sets the value pointed to by target to value from the install
+// configuration file unless value is empty.
+// If the flag has been specified on the command line, the value from the
+// file must match the flag value
+func (r explicitFlags) setString(flag string, target *string, value string) error {
+	if value == "" {
+		return nil
+	}
+	if !r[flag] {
+		*target = value
+		return nil
+	}
+	if *target != value {
+		return trace.BadParameter("--%v=%v conflicts with %v from the install configuration file", flag, *target, value)
+	}
+	return nil
+}
+
+// setInt sets the value pointed to by target to value from the install
+// configuration file unless value is zero.
+// If the flag has been specified on the command line, the value from the
+// file must match the flag value
+func (r explicitFlags) setInt(flag string, target *int, value int) error {
+	if value == 0 {
+		return nil
+	}
+	if !r[flag] {
+		*target = value
+		return nil
+	}
+	if *target != value {
+		return trace.BadParameter("--%v=%v conflicts with %v from the install configuration file", flag, *target, value)
+	}
+	return nil
+}
+
+// setStrings sets the list pointed to by target to values from the install
+// configuration file unless values is empty.
+// If the flag has been specified on the command line, the values from the
+// file must match the flag values
+func (r explicitFlags) setStrings(flag string, target *[]string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if !r[flag] {
+		*target = values
+		return nil
+	}
+	if !teleutils.StringSlicesEqual(*target, values) {
+		return trace.BadParameter("--%v=%v conflicts with %v from the install configuration file", flag,
+			strings.Join(*target, ","), strings.Join(values, ","))
+	}
+	return nil
+}
+
+func formatMounts(mounts map[string]string) string {
+	var result []string
+	for name, path := range mounts {
+		result = append(result, fmt.Sprintf("%v:%v", name, path))
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
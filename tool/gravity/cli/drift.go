@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/drift"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/systemservice"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// statusDrift displays the differences between packages, services and their
+// configuration installed on the cluster nodes and the state expected by the
+// cluster and optionally repairs them.
+//
+// Unless local is set, the drift is detected on each node through the RPC agents
+func statusDrift(env *localenv.LocalEnvironment, format constants.Format, repair, local bool) error {
+	if local {
+		return statusDriftLocal(env, format, repair)
+	}
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	ctx := context.TODO()
+	servers := cluster.ClusterState.Servers
+	runner, err := deployClusterAgents(ctx, env, cluster.Domain, servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer runner.Close()
+	defer func() {
+		err := shutdownClusterAgents(ctx, servers, runner, logrus.WithField(trace.Component, "drift"))
+		if err != nil {
+			logrus.Warnf("Failed to shut down agents: %v.", trace.DebugReport(err))
+		}
+	}()
+	reports, err := drift.Collect(ctx, runner, servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = drift.Write(os.Stdout, reports, format)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !repair {
+		return nil
+	}
+	err = drift.Repair(ctx, runner, reports, os.Stdout)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// statusDriftLocal displays the drift detected on this node
+// and optionally repairs it
+func statusDriftLocal(env *localenv.LocalEnvironment, format constants.Format, repair bool) error {
+	clusterEnv, err := env.NewClusterEnvironment()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := clusterEnv.Operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	server, err := findLocalServer(*cluster)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	services, err := systemservice.New()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	config := drift.Config{
+		Operator:        clusterEnv.Operator,
+		ClusterPackages: clusterEnv.ClusterPackages,
+		LocalPackages:   env.Packages,
+		Services:        services,
+		Server:          *server,
+	}
+	report, err := drift.Detect(config)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !repair {
+		return trace.Wrap(drift.Write(os.Stdout, []drift.Report{*report}, format))
+	}
+	if report.IsEmpty() {
+		env.Printf("No drift detected on node %v (%v).\n", server.Hostname, server.AdvertiseIP)
+		return nil
+	}
+	plan, err := drift.NewRepairPlan(*report)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			env.Printf("The drift detected on node %v (%v) can not be repaired automatically, "+
+				"the node might need to be updated with the cluster.\n", server.Hostname, server.AdvertiseIP)
+			return nil
+		}
+		return trace.Wrap(err)
+	}
+	env.Printf("Repairing drift on node %v (%v):\n", server.Hostname, server.AdvertiseIP)
+	fsm.FormatOperationPlanText(os.Stdout, *plan)
+	machine, err := drift.NewRepairFSM(config, *plan)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	progress := utils.NewProgress(context.TODO(), "Repair drift", len(fsm.FlattenPlan(plan)), false)
+	defer progress.Stop()
+	err = machine.ExecutePlan(context.TODO(), progress, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Println("Drift repaired. Run 'gravity status --drift' to verify.")
+	return nil
+}
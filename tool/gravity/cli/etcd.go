@@ -0,0 +1,381 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/etcd"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/utils"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// etcdSnapshot takes a snapshot of the etcd data on the local master node
+// and stores it in the cluster package service
+func etcdSnapshot(env *localenv.LocalEnvironment, retain int) error {
+	cluster, _, err := getLocalEtcdMaster(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	packages, err := env.ClusterPackages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Println("Taking etcd snapshot.")
+	created := time.Now()
+	path, err := etcd.Backup(context.TODO(), logrus.WithField(trace.Component, "etcd"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer os.Remove(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+	snapshot, err := etcd.CreateSnapshot(packages, cluster.Domain, created, f, retain)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Etcd snapshot %v (%v) has been saved.\n", snapshot.Locator.Version,
+		humanize.Bytes(uint64(snapshot.SizeBytes)))
+	return nil
+}
+
+// etcdRestoreConfig describes the etcd restore
+type etcdRestoreConfig struct {
+	// version is the version of the snapshot to restore
+	version string
+	// confirmed suppresses the confirmation prompt
+	confirmed bool
+	// resume resumes the interrupted restore
+	resume bool
+	// rollback rolls back the interrupted restore
+	rollback bool
+}
+
+// etcdRestore replaces the etcd data on all master nodes with
+// the data from the snapshot with the specified version, or the
+// most recent snapshot if the version is empty.
+//
+// The restore plan is stored in the restore environment so the restore
+// can be resumed or rolled back while etcd and the cluster API are down.
+// A failed restore is rolled back automatically
+func etcdRestore(env, restoreEnv *localenv.LocalEnvironment, config etcdRestoreConfig) error {
+	if config.resume && config.rollback {
+		return trace.BadParameter("--resume and --rollback cannot be used together")
+	}
+	if config.resume || config.rollback {
+		return resumeEtcdRestore(env, restoreEnv, config.rollback)
+	}
+	previous, err := etcd.GetRestorePlan(restoreEnv.Backend)
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	if previous != nil && !libfsm.IsCompleted(previous) && !libfsm.IsRolledBack(previous) {
+		return trace.BadParameter("another etcd restore is in progress, resume it with " +
+			"'gravity etcd restore --resume' or roll it back with 'gravity etcd restore --rollback'")
+	}
+	cluster, server, err := getLocalEtcdMaster(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	packages, err := env.ClusterPackages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	snapshot, err := etcd.FindSnapshot(packages, cluster.Domain, config.version)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if !config.confirmed {
+		env.Printf("Etcd data on all master nodes will be replaced with the snapshot "+
+			"%v taken %v. All changes made since then will be lost. Are you sure?\n",
+			snapshot.Locator.Version, humanize.Time(snapshot.Created))
+		resp, err := confirm()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if !resp {
+			env.Println("Action cancelled by user.")
+			return nil
+		}
+	}
+	plan, err := etcd.NewRestorePlan(cluster.Domain, snapshot.Locator, *server, cluster.ClusterState.Servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	ctx := context.TODO()
+	runner, err := deployEtcdAgents(ctx, env, cluster)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := etcd.CreateRestorePlan(restoreEnv.Backend, *plan); err != nil {
+		shutdownEtcdAgents(ctx, plan.Servers, runner)
+		return trace.Wrap(err)
+	}
+	env.Printf("Restoring etcd snapshot %v.\n", snapshot.Locator.Version)
+	return trace.Wrap(runEtcdRestore(ctx, env, restoreEnv, packages, runner, false))
+}
+
+// resumeEtcdRestore resumes or rolls back the interrupted etcd restore
+// using the RPC agents deployed by the restore
+func resumeEtcdRestore(env, restoreEnv *localenv.LocalEnvironment, rollback bool) error {
+	plan, err := etcd.GetRestorePlan(restoreEnv.Backend)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return trace.NotFound("there is no etcd restore to resume or roll back")
+		}
+		return trace.Wrap(err)
+	}
+	if libfsm.IsCompleted(plan) || libfsm.IsRolledBack(plan) {
+		return trace.BadParameter("the last etcd restore has already been completed or rolled back")
+	}
+	packages, err := env.ClusterPackages()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	creds, err := libfsm.GetClientCredentials()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	runner := libfsm.NewAgentRunner(creds)
+	return trace.Wrap(runEtcdRestore(context.TODO(), env, restoreEnv, packages, runner, rollback))
+}
+
+// runEtcdRestore executes or rolls back the stored restore plan.
+// If the execution fails, the plan is rolled back. The agents are shut down
+// once the plan has been completed or rolled back, otherwise they are kept
+// running so the restore can be resumed
+func runEtcdRestore(ctx context.Context, env, restoreEnv *localenv.LocalEnvironment, packages pack.PackageService, runner libfsm.AgentRepository, rollback bool) error {
+	client, _, err := utils.GetKubeClientFromPath(constants.PrivilegedKubeconfig)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	machine, err := etcd.NewRestoreFSM(etcd.RestoreConfig{
+		Backend:  restoreEnv.Backend,
+		Agents:   runner,
+		Packages: packages,
+		Client:   client,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	plan, err := machine.GetPlan()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	progress := utils.NewProgress(ctx, "Restoring etcd snapshot", -1, false)
+	defer progress.Stop()
+	var execErr error
+	if !rollback {
+		execErr = machine.ExecutePlan(ctx, progress, false)
+		if execErr != nil {
+			env.Printf("Failed to restore etcd snapshot, rolling back: %v.\n", trace.UserMessage(execErr))
+		}
+	}
+	if rollback || execErr != nil {
+		if _, err := machine.RollbackPlan(ctx, progress, false); err != nil {
+			env.Println("Failed to roll back the etcd restore. Fix the problem and roll it back " +
+				"with 'gravity etcd restore --rollback' or resume it with 'gravity etcd restore --resume'.")
+			return trace.NewAggregate(execErr, err)
+		}
+	}
+	if err := machine.Complete(execErr); err != nil {
+		logrus.Warnf("Failed to complete etcd restore: %v.", trace.DebugReport(err))
+	}
+	shutdownEtcdAgents(ctx, plan.Servers, runner)
+	if execErr != nil {
+		return trace.Wrap(execErr, "etcd restore has been rolled back")
+	}
+	if rollback {
+		env.Println("Etcd restore has been rolled back.")
+		return nil
+	}
+	env.Println("Etcd snapshot has been restored.")
+	return nil
+}
+
+// etcdStatus displays the status of etcd members and the available snapshots
+func etcdStatus(env *localenv.LocalEnvironment, format constants.Format) error {
+	cluster, _, err := getLocalEtcdMaster(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	client, err := newEtcdClient(cluster.ClusterState.Servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer client.Close()
+	status, err := etcd.GetStatus(context.TODO(), client)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	switch format {
+	case constants.EncodingText:
+		packages, err := env.ClusterPackages()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		snapshots, err := etcd.GetSnapshots(packages, cluster.Domain)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		printEtcdStatus(*status, snapshots)
+		return nil
+	case constants.EncodingJSON:
+		data, err := json.MarshalIndent(status, "", "    ")
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	return trace.BadParameter("unsupported output format %q, supported are: %v, %v",
+		format, constants.EncodingText, constants.EncodingJSON)
+}
+
+// etcdDefrag defragments etcd members one at a time
+func etcdDefrag(env *localenv.LocalEnvironment) error {
+	cluster, _, err := getLocalEtcdMaster(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	client, err := newEtcdClient(cluster.ClusterState.Servers)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer client.Close()
+	env.Println("Defragmenting etcd members.")
+	err = etcd.Defragment(context.TODO(), client, logrus.WithField(trace.Component, "etcd"))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Println("Etcd members have been defragmented.")
+	return nil
+}
+
+func printEtcdStatus(status etcd.Status, snapshots []etcd.Snapshot) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "Member\tID\tEndpoint\tVersion\tDB Size\tLeader\tStatus\n")
+	for _, member := range status.Members {
+		memberStatus := "healthy"
+		if !member.Healthy() {
+			memberStatus = member.Error
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			member.Name,
+			member.ID,
+			member.Endpoint,
+			member.Version,
+			humanize.Bytes(uint64(member.DBSize)),
+			member.Leader,
+			memberStatus)
+	}
+	w.Flush()
+	fmt.Printf("\nRaft term: %v\n", status.RaftTerm)
+	if len(status.Alarms) != 0 {
+		fmt.Println("\nActive alarms:")
+		for _, alarm := range status.Alarms {
+			fmt.Printf("    * %v on member %v\n", alarm.Type, alarm.MemberID)
+		}
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("\nThere are no etcd snapshots.")
+		return
+	}
+	fmt.Println("\nSnapshots:")
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "Version\tCreated\tSize\n")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%v\t%v\t%v\n",
+			snapshot.Locator.Version,
+			snapshot.Created.Format(constants.HumanDateFormat),
+			humanize.Bytes(uint64(snapshot.SizeBytes)))
+	}
+	w.Flush()
+}
+
+// getLocalEtcdMaster returns the local cluster and the local server,
+// which must be a master node
+func getLocalEtcdMaster(env *localenv.LocalEnvironment) (*ops.Site, *storage.Server, error) {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	server, err := findLocalServer(*cluster)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	if !server.IsMaster() {
+		return nil, nil, trace.BadParameter("this command can only be executed on one of the master nodes")
+	}
+	return cluster, server, nil
+}
+
+func newEtcdClient(servers []storage.Server) (etcdClient, error) {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	client, err := etcd.NewClient(servers, state.SecretDir(stateDir))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return client, nil
+}
+
+// etcdClient is the etcd client that can be closed
+type etcdClient interface {
+	etcd.Client
+	// Close closes the client connections
+	Close() error
+}
+
+// deployEtcdAgents deploys RPC agents on the cluster master nodes
+func deployEtcdAgents(ctx context.Context, env *localenv.LocalEnvironment, cluster *ops.Site) (libfsm.AgentRepository, error) {
+	masters, _ := libfsm.SplitServers(cluster.ClusterState.Servers)
+	return deployClusterAgents(ctx, env, cluster.Domain, masters)
+}
+
+// shutdownEtcdAgents shuts down the RPC agents on the cluster master nodes
+func shutdownEtcdAgents(ctx context.Context, masters []storage.Server, runner libfsm.AgentRepository) {
+	err := shutdownClusterAgents(ctx, masters, runner, logrus.WithField(trace.Component, "etcd"))
+	if err != nil {
+		logrus.Warnf("Failed to shut down agents: %v.", trace.DebugReport(err))
+	}
+}
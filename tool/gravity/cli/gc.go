@@ -18,6 +18,7 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/gravitational/gravity/lib/app/docker"
@@ -66,6 +67,11 @@ func garbageCollect(env *localenv.LocalEnvironment, manual, confirmed bool) erro
 	if err != nil {
 		return trace.Wrap(err)
 	}
+
+	if env.Silent {
+		fmt.Printf("%v", collector.Operation.ID)
+		return nil
+	}
 	env.Println(`
 The garbage collection operation has been created in manual mode.
 
@@ -24,9 +24,13 @@ import (
 	"text/tabwriter"
 
 	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/helm"
+	"github.com/gravitational/gravity/lib/loc"
 	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/pack"
+	"github.com/gravitational/gravity/lib/utils"
 
 	"github.com/gravitational/trace"
 )
@@ -77,29 +81,20 @@ type releaseHistoryConfig struct {
 }
 
 func releaseInstall(env *localenv.LocalEnvironment, conf releaseInstallConfig) error {
-	imageEnv, err := localenv.NewImageEnvironment(conf.Image)
-	if err != nil {
-		return trace.Wrap(err)
-	}
-	err = appSyncEnv(env, imageEnv, appSyncConfig{
-		Image:          conf.Image,
-		registryConfig: conf.registryConfig,
-	})
+	tmp, err := ioutil.TempDir("", "")
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	env.PrintStep("Installing application %v:%v",
-		imageEnv.Manifest.Metadata.Name,
-		imageEnv.Manifest.Metadata.ResourceVersion)
-	tmp, err := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+	source, err := prepareChart(env, conf.Image, conf.registryConfig, tmp)
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	defer os.RemoveAll(tmp)
-	err = pack.Unpack(imageEnv.Packages, imageEnv.Manifest.Locator(), tmp, nil)
+	valuesContext, err := getValuesContext(env, conf.Values)
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	env.PrintStep("Installing %v %v:%v", source.kind, source.name, source.version)
 	helmClient, err := helm.NewClient(helm.ClientConfig{
 		DNSAddress: env.DNS.Addr(),
 	})
@@ -108,11 +103,12 @@ func releaseInstall(env *localenv.LocalEnvironment, conf releaseInstallConfig) e
 	}
 	defer helmClient.Close()
 	release, err := helmClient.Install(helm.InstallParameters{
-		Path:      filepath.Join(tmp, "resources"),
+		Path:      source.path,
 		Values:    conf.Values,
 		Set:       conf.Set,
 		Name:      conf.Name,
 		Namespace: conf.Namespace,
+		Context:   valuesContext,
 	})
 	if err != nil {
 		return trace.Wrap(err)
@@ -121,6 +117,123 @@ func releaseInstall(env *localenv.LocalEnvironment, conf releaseInstallConfig) e
 	return nil
 }
 
+// chartSource describes a chart prepared for installation
+type chartSource struct {
+	// kind is the kind of the chart source, application or chart
+	kind string
+	// name is the application or chart name
+	name string
+	// version is the application or chart version
+	version string
+	// path is the path to the chart directory or archive
+	path string
+}
+
+// prepareChart makes the chart specified with image available in dir.
+//
+// The image is either a path to an application image, which is synced
+// with the cluster and unpacked, or a locator of a chart in the cluster
+// chart repository, e.g. charts/nginx:1.0.0, which is downloaded
+func prepareChart(env *localenv.LocalEnvironment, image string, registry registryConfig, dir string) (*chartSource, error) {
+	source, err := fetchRepositoryChart(env, image, dir)
+	if err == nil {
+		return source, nil
+	}
+	if !trace.IsNotFound(err) {
+		return nil, trace.Wrap(err)
+	}
+	imageEnv, err := localenv.NewImageEnvironment(image)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer imageEnv.Close()
+	err = appSyncEnv(env, imageEnv, appSyncConfig{
+		Image:          image,
+		registryConfig: registry,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err = pack.Unpack(imageEnv.Packages, imageEnv.Manifest.Locator(), dir, nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &chartSource{
+		kind:    "application",
+		name:    imageEnv.Manifest.Metadata.Name,
+		version: imageEnv.Manifest.Metadata.ResourceVersion,
+		path:    filepath.Join(dir, defaults.ResourcesDir),
+	}, nil
+}
+
+// fetchRepositoryChart downloads the chart specified with image from the
+// cluster chart repository into dir.
+//
+// Returns trace.NotFound if image does not reference a chart in the repository
+func fetchRepositoryChart(env *localenv.LocalEnvironment, image, dir string) (*chartSource, error) {
+	if _, err := os.Stat(image); err == nil {
+		return nil, trace.NotFound("%v is a local file", image)
+	}
+	locator, err := loc.ParseLocator(image)
+	if err != nil {
+		return nil, trace.NotFound("%v is not a chart reference", image)
+	}
+	packages, err := env.ClusterPackages()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	reader, err := helm.FetchChart(packages, *locator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer reader.Close()
+	path := filepath.Join(dir, helm.ChartFilename(locator.Name, locator.Version))
+	if err := utils.CopyReaderWithPerms(path, reader, defaults.SharedReadMask); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &chartSource{
+		kind:    "chart",
+		name:    locator.Name,
+		version: locator.Version,
+		path:    path,
+	}, nil
+}
+
+// getValuesContext returns the cluster facts values templates can reference.
+//
+// Returns nil if none of the specified values files is a template
+func getValuesContext(env *localenv.LocalEnvironment, valueFiles []string) (*helm.ValuesContext, error) {
+	var templates []string
+	for _, path := range valueFiles {
+		if helm.IsValuesTemplate(path) {
+			templates = append(templates, path)
+		}
+	}
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to query cluster facts for values templates %v", templates)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to query cluster facts for values templates %v", templates)
+	}
+	flavor := cluster.Labels[ops.SiteLabelFlavor]
+	if flavor == "" {
+		flavor = cluster.App.Manifest.DefaultFlavor()
+	}
+	return &helm.ValuesContext{
+		Cluster: helm.ClusterFacts{
+			Name:            cluster.Domain,
+			RegistryAddress: constants.DockerRegistry,
+			NodeCount:       len(cluster.ClusterState.Servers),
+			Flavor:          flavor,
+		},
+	}, nil
+}
+
 func releaseList(env *localenv.LocalEnvironment) error {
 	helmClient, err := helm.NewClient(helm.ClientConfig{
 		DNSAddress: env.DNS.Addr(),
@@ -161,37 +274,33 @@ func releaseUpgrade(env *localenv.LocalEnvironment, conf releaseUpgradeConfig) e
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	imageEnv, err := localenv.NewImageEnvironment(conf.Image)
+	tmp, err := ioutil.TempDir("", "")
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	err = appSyncEnv(env, imageEnv, appSyncConfig{
-		Image:          conf.Image,
-		registryConfig: conf.registryConfig,
-	})
-	env.PrintStep("Upgrading release %v (%v) to version %v",
-		release.Name, release.Chart,
-		imageEnv.Manifest.Metadata.ResourceVersion)
-	tmp, err := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+	source, err := prepareChart(env, conf.Image, conf.registryConfig, tmp)
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	defer os.RemoveAll(tmp)
-	err = pack.Unpack(imageEnv.Packages, imageEnv.Manifest.Locator(), tmp, nil)
+	valuesContext, err := getValuesContext(env, conf.Values)
 	if err != nil {
 		return trace.Wrap(err)
 	}
+	env.PrintStep("Upgrading release %v (%v) to version %v",
+		release.Name, release.Chart, source.version)
 	release, err = helmClient.Upgrade(helm.UpgradeParameters{
 		Release: release.Name,
-		Path:    filepath.Join(tmp, "resources"),
+		Path:    source.path,
 		Values:  conf.Values,
 		Set:     conf.Set,
+		Context: valuesContext,
 	})
 	if err != nil {
 		return trace.Wrap(err)
 	}
 	env.PrintStep("Upgraded release %v to version %v", release.Name,
-		imageEnv.Manifest.Metadata.ResourceVersion)
+		source.version)
 	return nil
 }
 
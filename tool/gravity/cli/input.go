@@ -23,7 +23,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/gravity/lib/systeminfo"
 
 	"github.com/fatih/color"
@@ -62,9 +61,9 @@ func validDomain(v string) (string, error) {
 // selectInterface returns IP address of the network interface selected
 // for the installation
 //
-// If the machine has a single network interface (not counting loopback),
+// If the machine has a single IP address (not counting loopback),
 // it is returned right away. Otherwise, a user is shown a prompt dialog
-// where they can pick an interface.
+// where they can pick an address among both IPv4 and IPv6 addresses.
 func selectInterface() (addr string, autoselected bool, err error) {
 	ifaces, err := systeminfo.NetworkInterfaces()
 	if err != nil {
@@ -73,28 +72,29 @@ func selectInterface() (addr string, autoselected bool, err error) {
 	if len(ifaces) == 0 {
 		return "", false, trace.Errorf("no network interfaces found")
 	}
-	if len(ifaces) == 1 {
-		return ifaces[0].IPv4, true, nil
+	var addrs []string
+	for _, iface := range ifaces {
+		addrs = append(addrs, iface.Addrs()...)
+	}
+	if len(addrs) == 1 {
+		return addrs[0], true, nil
 	}
 	fmt.Printf("\nSelect an interface for the installer to listen on:\n\n")
 
-	num2iface := make(map[string]storage.NetworkInterface)
-	number := 0
-	for _, iface := range ifaces {
-		if iface.IPv4 != "" && iface.IPv4 != "<nil>" {
-			number += 1
-			num2iface[fmt.Sprintf("%v", number)] = iface
-			fmt.Printf("%v. %v\n", number, iface.IPv4)
-		}
+	num2addr := make(map[string]string)
+	for i, addr := range addrs {
+		number := i + 1
+		num2addr[fmt.Sprintf("%v", number)] = addr
+		fmt.Printf("%v. %v\n", number, addr)
 	}
 	fmt.Printf(color.YellowString("\nNote: Target servers should be able to connect to this IP\n"))
 
-	addr, err = readCheck(fmt.Sprintf("\nSelect interface number [%v-%v]", 1, number), func(number string) (string, error) {
-		iface, ok := num2iface[number]
+	addr, err = readCheck(fmt.Sprintf("\nSelect interface number [%v-%v]", 1, len(addrs)), func(number string) (string, error) {
+		addr, ok := num2addr[number]
 		if !ok {
 			return "", fmt.Errorf("select interface number")
 		}
-		return iface.IPv4, nil
+		return addr, nil
 	})
 	if err != nil {
 		return "", false, trace.Wrap(err)
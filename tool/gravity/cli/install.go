@@ -257,6 +257,15 @@ func remove(env *localenv.LocalEnvironment, c removeConfig) error {
 	}
 
 	fmt.Printf("launched operation %q, use 'gravity status' to poll its progress\n", key.OperationID)
+	fmt.Printf(`
+To view the operation plan, run:
+
+$ gravity plan
+
+If the operation fails, it can be resumed from the failed step with:
+
+$ sudo gravity remove --resume
+`)
 	return nil
 }
 
@@ -445,7 +454,7 @@ func findLocalServer(site ops.Site) (*storage.Server, error) {
 
 	var ips []string
 	for _, iface := range ifaces {
-		ips = append(ips, iface.IPv4)
+		ips = append(ips, iface.Addrs()...)
 	}
 
 	server, err := findServer(site, ips)
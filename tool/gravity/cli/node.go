@@ -0,0 +1,231 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gravitational/gravity/lib/checks"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/state"
+	"github.com/gravitational/gravity/lib/storage"
+	"github.com/gravitational/gravity/lib/systeminfo"
+
+	"github.com/gravitational/trace"
+	"k8s.io/api/core/v1"
+)
+
+func updateNodeLabels(env *localenv.LocalEnvironment, node string, specs []string) error {
+	add, remove, err := parseNodeLabels(specs)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = operator.UpdateNodeLabels(ops.UpdateNodeLabelsRequest{
+		AccountID:  cluster.AccountID,
+		SiteDomain: cluster.Domain,
+		Node:       node,
+		Add:        add,
+		Remove:     remove,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Labels of node %v have been updated.\n", node)
+	return nil
+}
+
+func updateNodeTaints(env *localenv.LocalEnvironment, node string, specs []string) error {
+	add, remove, err := parseNodeTaints(specs)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = operator.UpdateNodeTaints(ops.UpdateNodeTaintsRequest{
+		AccountID:  cluster.AccountID,
+		SiteDomain: cluster.Domain,
+		Node:       node,
+		Add:        add,
+		Remove:     remove,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Taints of node %v have been updated.\n", node)
+	return nil
+}
+
+func updateNodeProfile(env *localenv.LocalEnvironment, node, profileName string, force bool) error {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	server, err := findServer(*cluster, []string{node})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	profile, err := cluster.App.Manifest.NodeProfiles.ByName(profileName)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	local, err := findLocalServer(*cluster)
+	if err != nil && !trace.IsNotFound(err) {
+		return trace.Wrap(err)
+	}
+	switch {
+	case local != nil && local.AdvertiseIP == server.AdvertiseIP:
+		err := checkNodeRequirements(*profile)
+		if err != nil && !force {
+			return trace.Wrap(err)
+		}
+		if err != nil {
+			env.PrintStep("Ignoring failed requirements checks: %v", err)
+		}
+	case !force:
+		return trace.BadParameter("requirements of profile %q can only be validated when "+
+			"the command is run on node %v, use --force to change the profile without "+
+			"validation", profileName, server.Hostname)
+	}
+	var systemInfo []byte
+	if !force {
+		info, err := systeminfo.New()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		systemInfo, err = storage.MarshalSystemInfo(info)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+	err = operator.UpdateNodeProfile(ops.UpdateNodeProfileRequest{
+		AccountID:  cluster.AccountID,
+		SiteDomain: cluster.Domain,
+		Node:       node,
+		Profile:    profileName,
+		SystemInfo: systemInfo,
+		Force:      force,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Node %v now has profile %q. Runtime configuration of the profile "+
+		"will be applied to the node during the next cluster update.\n", node, profileName)
+	return nil
+}
+
+// checkNodeRequirements verifies this node against the requirements of
+// the specified profile.
+// CPU, RAM, volume and block device requirements are also validated by
+// the cluster against the system information of the node.
+// Port requirements are not checked since the ports are used by
+// the running cluster
+func checkNodeRequirements(profile schema.NodeProfile) error {
+	stateDir, err := state.GetStateDir()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	requirements := profile.Requirements
+	requirements.Network.Ports = nil
+	failed, err := schema.ValidateRequirements(requirements, stateDir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(failed) != 0 {
+		return trace.BadParameter("node does not satisfy the requirements of profile %q:\n%v",
+			profile.Name, checks.FormatFailedChecks(failed))
+	}
+	for _, device := range profile.Requirements.Devices {
+		matches, err := filepath.Glob(device.Path)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if len(matches) == 0 {
+			return trace.BadParameter("node does not have device %v required by profile %q",
+				device.Path, profile.Name)
+		}
+	}
+	return nil
+}
+
+// parseNodeLabels parses labels to add specified as key=value and
+// labels to remove specified as key-
+func parseNodeLabels(specs []string) (add map[string]string, remove []string, err error) {
+	for _, spec := range specs {
+		if strings.HasSuffix(spec, "-") {
+			remove = append(remove, strings.TrimSuffix(spec, "-"))
+			continue
+		}
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, nil, trace.BadParameter("invalid label %q, expected key=value or key-", spec)
+		}
+		if add == nil {
+			add = make(map[string]string)
+		}
+		add[parts[0]] = parts[1]
+	}
+	return add, remove, nil
+}
+
+// parseNodeTaints parses taints to add specified as key=value:effect
+// and taints to remove specified as key:effect- or key-
+func parseNodeTaints(specs []string) (add, remove []v1.Taint, err error) {
+	for _, spec := range specs {
+		if strings.HasSuffix(spec, "-") {
+			parts := strings.SplitN(strings.TrimSuffix(spec, "-"), ":", 2)
+			taint := v1.Taint{Key: parts[0]}
+			if len(parts) == 2 {
+				taint.Effect = v1.TaintEffect(parts[1])
+			}
+			remove = append(remove, taint)
+			continue
+		}
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, nil, trace.BadParameter("invalid taint %q, expected key=value:effect, "+
+				"key:effect- or key-", spec)
+		}
+		parts := strings.SplitN(spec[:i], "=", 2)
+		taint := v1.Taint{Key: parts[0], Effect: v1.TaintEffect(spec[i+1:])}
+		if len(parts) == 2 {
+			taint.Value = parts[1]
+		}
+		add = append(add, taint)
+	}
+	return add, remove, nil
+}
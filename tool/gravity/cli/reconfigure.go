@@ -0,0 +1,378 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	libfsm "github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/httplib"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/reconfigure"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+type reconfigureNetworkParams struct {
+	// podCIDR is the new pod subnet
+	podCIDR string
+	// serviceCIDR is the new service subnet
+	serviceCIDR string
+	// vxlanPort is the new overlay network port
+	vxlanPort int
+	// manual is whether the operation is not executed automatically
+	manual bool
+}
+
+type reconfigureNodeParams struct {
+	// server identifies the node to reconfigure by its hostname
+	// or advertise address. Defaults to the local node if unspecified
+	server string
+	// advertiseAddr is the new advertise address of the node
+	advertiseAddr string
+	// manual is whether the operation is not executed automatically
+	manual bool
+}
+
+type reconfigureDockerParams struct {
+	// server identifies the node to migrate by its hostname
+	// or advertise address. Defaults to the local node if unspecified
+	server string
+	// storageDriver is the new Docker storage driver of the node
+	storageDriver string
+	// manual is whether the operation is not executed automatically
+	manual bool
+}
+
+func reconfigureNetwork(env *localenv.LocalEnvironment, p reconfigureNetworkParams) error {
+	reconfigurer, err := newReconfigurer(env, func(operator ops.Operator, cluster ops.Site) (*ops.SiteOperationKey, error) {
+		return operator.CreateClusterReconfigureNetworkOperation(
+			ops.CreateClusterReconfigureNetworkOperationRequest{
+				AccountID:   cluster.AccountID,
+				ClusterName: cluster.Domain,
+				PodCIDR:     p.podCIDR,
+				ServiceCIDR: p.serviceCIDR,
+				VxlanPort:   p.vxlanPort,
+			})
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(runReconfigurer(env, reconfigurer, "network", p.manual))
+}
+
+func reconfigureNode(env *localenv.LocalEnvironment, p reconfigureNodeParams) error {
+	if p.advertiseAddr == "" {
+		return trace.BadParameter("new advertise address is required")
+	}
+	reconfigurer, err := newReconfigurer(env, func(operator ops.Operator, cluster ops.Site) (*ops.SiteOperationKey, error) {
+		server, err := findReconfiguredServer(cluster, p.server)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return operator.CreateClusterReconfigureNodeOperation(
+			ops.CreateClusterReconfigureNodeOperationRequest{
+				AccountID:      cluster.AccountID,
+				ClusterName:    cluster.Domain,
+				AdvertiseIP:    server.AdvertiseIP,
+				NewAdvertiseIP: p.advertiseAddr,
+			})
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(runReconfigurer(env, reconfigurer, "node", p.manual))
+}
+
+func reconfigureDocker(env *localenv.LocalEnvironment, p reconfigureDockerParams) error {
+	reconfigurer, err := newReconfigurer(env, func(operator ops.Operator, cluster ops.Site) (*ops.SiteOperationKey, error) {
+		server, err := findReconfiguredServer(cluster, p.server)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return operator.CreateClusterReconfigureDockerOperation(
+			ops.CreateClusterReconfigureDockerOperationRequest{
+				AccountID:     cluster.AccountID,
+				ClusterName:   cluster.Domain,
+				AdvertiseIP:   server.AdvertiseIP,
+				StorageDriver: p.storageDriver,
+			})
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(runReconfigurer(env, reconfigurer, "docker", p.manual))
+}
+
+// findReconfiguredServer returns the server identified by the specified
+// hostname or advertise address, or the local server if unspecified
+func findReconfiguredServer(cluster ops.Site, server string) (*storage.Server, error) {
+	if server == "" {
+		return findLocalServer(cluster)
+	}
+	return findServer(cluster, []string{server})
+}
+
+// runReconfigurer executes the operation of the specified reconfigurer or
+// only creates its plan in manual mode.
+// command is the reconfigure subcommand that executes the operation phases
+func runReconfigurer(env *localenv.LocalEnvironment, reconfigurer *reconfigure.Reconfigurer, command string, manual bool) error {
+	ctx := context.TODO()
+	if !manual {
+		err := reconfigurer.Run(ctx, false)
+		return trace.Wrap(err)
+	}
+
+	err := reconfigurer.Create(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if env.Silent {
+		fmt.Printf("%v", reconfigurer.Operation.ID)
+		return nil
+	}
+	env.Printf(`
+The %[1]v reconfiguration operation has been created in manual mode.
+
+To view the operation plan, run:
+
+$ gravity plan
+
+To reconfigure the %[1]v, execute each phase in the order it appears in
+the plan by running:
+
+$ sudo gravity reconfigure %[1]v --phase=<phase-id>
+
+To roll back a phase, run:
+
+$ sudo gravity rollback --phase=<phase-id>
+
+To resume automatic reconfiguration from any point, run:
+
+$ gravity reconfigure %[1]v --resume
+`, command)
+	return nil
+}
+
+// createOperationFunc creates a new reconfiguration operation in the specified cluster
+type createOperationFunc func(operator ops.Operator, cluster ops.Site) (*ops.SiteOperationKey, error)
+
+func newReconfigurer(env *localenv.LocalEnvironment, createOperation createOperationFunc) (*reconfigure.Reconfigurer, error) {
+	clusterPackages, err := env.ClusterPackages()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	teleportClient, err := env.TeleportClient(constants.Localhost)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to create a teleport client")
+	}
+
+	proxy, err := teleportClient.ConnectToProxy(context.TODO())
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to connect to teleport proxy")
+	}
+
+	key, err := createOperation(operator, *cluster)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return nil, trace.NotImplemented(
+				"cluster operator does not implement the API required for cluster reconfiguration. " +
+					"Please make sure you're running the command on a compatible cluster.")
+		}
+		return nil, trace.Wrap(err)
+	}
+
+	defer func() {
+		r := recover()
+		triggered := err == nil && r == nil
+		if !triggered {
+			if errDelete := operator.DeleteSiteOperation(*key); errDelete != nil {
+				log.Warnf("Failed to clean up reconfiguration operation %v: %v.",
+					key, trace.DebugReport(errDelete))
+			}
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	operation, err := operator.GetSiteOperation(*key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	clusterEnv, err := env.NewClusterEnvironment()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if clusterEnv.Client == nil {
+		return nil, trace.BadParameter("this operation can only be executed on one of the master nodes")
+	}
+
+	ctx := context.TODO()
+	req := deployAgentsRequest{
+		clusterState: cluster.ClusterState,
+		clusterName:  cluster.Domain,
+		clusterEnv:   clusterEnv,
+		proxy:        proxy,
+	}
+	creds, err := deployAgents(ctx, env, req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	runner := libfsm.NewAgentRunner(creds)
+
+	reconfigurer, err := reconfigure.New(reconfigure.Config{
+		Packages:      clusterPackages,
+		LocalPackages: env.Packages,
+		Operator:      operator,
+		Operation:     operation,
+		Servers:       cluster.ClusterState.Servers,
+		Client:        clusterEnv.Client,
+		Silent:        env.Silent,
+		Runner:        runner,
+		Emitter:       env,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return reconfigurer, nil
+}
+
+func reconfigurePhase(env *localenv.LocalEnvironment, phase string, phaseTimeout time.Duration, force bool) error {
+	reconfigurer, err := getReconfigurer(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = reconfigurer.RunPhase(context.TODO(), phase, phaseTimeout, force)
+	return trace.Wrap(err)
+}
+
+func rollbackReconfigurePhase(env *localenv.LocalEnvironment, p rollbackParams) error {
+	reconfigurer, err := getReconfigurer(env)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	err = reconfigurer.RollbackPhase(context.TODO(), p.phaseID, p.timeout, p.force)
+	return trace.Wrap(err)
+}
+
+// getReconfigurer returns the reconfigurer for the active network,
+// node or Docker reconfiguration operation
+func getReconfigurer(env *localenv.LocalEnvironment) (*reconfigure.Reconfigurer, error) {
+	clusterPackages, err := env.ClusterPackages()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	operation, err := getLastReconfigureOperation(cluster.Key(), operator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	// Kubernetes client is only available on master nodes
+	client, _, err := httplib.GetClusterKubeClient(env.DNS.Addr())
+	if err != nil {
+		log.Debugf("Failed to create Kubernetes client: %v.", trace.DebugReport(err))
+	}
+
+	creds, err := libfsm.GetClientCredentials()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	runner := libfsm.NewAgentRunner(creds)
+
+	reconfigurer, err := reconfigure.New(reconfigure.Config{
+		Packages:      clusterPackages,
+		LocalPackages: env.Packages,
+		Operator:      operator,
+		Operation:     operation,
+		Servers:       cluster.ClusterState.Servers,
+		Client:        client,
+		Silent:        env.Silent,
+		Runner:        runner,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return reconfigurer, nil
+}
+
+// hasReconfigureOperation returns true if the last cluster operation
+// is a network, node or Docker reconfiguration operation.
+// The operation might have already failed if the automatic rollback has not
+// succeeded in which case the remaining phases are rolled back manually
+func hasReconfigureOperation(env *localenv.LocalEnvironment) bool {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return false
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return false
+	}
+	_, err = getLastReconfigureOperation(cluster.Key(), operator)
+	return err == nil
+}
+
+// getLastReconfigureOperation returns the last cluster operation
+// if it is a network, node or Docker reconfiguration operation
+func getLastReconfigureOperation(key ops.SiteKey, operator ops.Operator) (*ops.SiteOperation, error) {
+	operation, err := ops.GetLastReconfigureNetworkOperation(key, operator)
+	if err == nil || !trace.IsNotFound(err) {
+		return operation, trace.Wrap(err)
+	}
+	operation, err = ops.GetLastReconfigureNodeOperation(key, operator)
+	if err == nil || !trace.IsNotFound(err) {
+		return operation, trace.Wrap(err)
+	}
+	operation, err = ops.GetLastReconfigureDockerOperation(key, operator)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return operation, nil
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/gravitational/gravity/lib/loc"
 	"github.com/gravitational/gravity/lib/modules"
 	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/gravity/lib/utils"
 	"github.com/gravitational/gravity/tool/common"
 
@@ -55,6 +56,8 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.VersionCmd.Output = common.Format(g.VersionCmd.Flag("output", "Output format, text or json").Short('o').Default(string(constants.EncodingText)))
 
 	g.InstallCmd.CmdClause = g.Command("install", "Install cluster on this node")
+	g.InstallCmd.ExplicitFlags = explicitFlags{}
+	g.InstallCmd.Action(g.InstallCmd.ExplicitFlags.record)
 	g.InstallCmd.Path = g.InstallCmd.Arg("appdir", "Path to directory with application package. Uses current directory by default").String()
 	g.InstallCmd.AdvertiseAddr = g.InstallCmd.Flag("advertise-addr", "The IP address to advertise").String()
 	g.InstallCmd.Token = g.InstallCmd.Flag("token", "Unique install token to authorize other nodes to join the cluster").String()
@@ -69,8 +72,8 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.InstallCmd.DockerDevice = g.InstallCmd.Flag("docker-device", "Device to use for docker storage").Hidden().String()
 	g.InstallCmd.SystemDevice = g.InstallCmd.Flag("system-device", "Device to use for system data directory").Hidden().String()
 	g.InstallCmd.Mounts = configure.KeyValParam(g.InstallCmd.Flag("mount", "One or several mounts in form <mount-name>:<path>, e.g. data:/var/lib/data"))
-	g.InstallCmd.PodCIDR = g.InstallCmd.Flag("pod-network-cidr", "Subnet range for pods. Must be a minimum of /16").Default(defaults.PodSubnet).String()
-	g.InstallCmd.ServiceCIDR = g.InstallCmd.Flag("service-cidr", "Subnet range for services").Default(defaults.ServiceSubnet).String()
+	g.InstallCmd.PodCIDR = g.InstallCmd.Flag("pod-network-cidr", "Subnet range for pods. Must be a minimum of /16 for IPv4 and /56 for IPv6. Defaults to an IPv6 range if the advertise address is IPv6").Default(defaults.PodSubnet).String()
+	g.InstallCmd.ServiceCIDR = g.InstallCmd.Flag("service-cidr", "Subnet range for services. Defaults to an IPv6 range if the advertise address is IPv6").Default(defaults.ServiceSubnet).String()
 	g.InstallCmd.VxlanPort = g.InstallCmd.Flag("vxlan-port", "Custom overlay network port").Default(strconv.Itoa(defaults.VxlanPort)).Int()
 	g.InstallCmd.DNSListenAddrs = g.InstallCmd.Flag("dns-listen-addr", "Custom listen address for in-cluster DNS").
 		Default(defaults.DNSListenAddr).IPList()
@@ -97,8 +100,12 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.InstallCmd.GCENodeTags = g.InstallCmd.Flag("gce-node-tag", "Override node tag on the instance in GCE required for load balanacing. Defaults to cluster name.").Strings()
 	g.InstallCmd.DNSHosts = g.InstallCmd.Flag("dns-host", "Specify an IP address that will be returned for the given domain within the cluster. Accepts <domain>/<ip> format. Can be specified multiple times.").Hidden().Strings()
 	g.InstallCmd.DNSZones = g.InstallCmd.Flag("dns-zone", "Specify an upstream server for the given zone within the cluster. Accepts <zone>/<nameserver> format where <nameserver> can be either <ip> or <ip>:<port>. Can be specified multiple times.").Strings()
+	g.InstallCmd.From = g.InstallCmd.Flag("from", "Install configuration file with the settings of the cluster and all of its nodes").String()
+	g.InstallCmd.Restore = g.InstallCmd.Flag("restore", "Cluster backup created with gravity backup --cluster to restore the cluster from").String()
 
 	g.JoinCmd.CmdClause = g.Command("join", "Join existing cluster or on-going install operation")
+	g.JoinCmd.ExplicitFlags = explicitFlags{}
+	g.JoinCmd.Action(g.JoinCmd.ExplicitFlags.record)
 	g.JoinCmd.PeerAddr = g.JoinCmd.Arg("peer-addrs", "One or several IP addresses of cluster node to join, as comma-separated values").String()
 	g.JoinCmd.AdvertiseAddr = g.JoinCmd.Flag("advertise-addr", "IP address to advertise").String()
 	g.JoinCmd.Token = g.JoinCmd.Flag("token", "Unique install token to authorize this node to join the cluster").String()
@@ -115,6 +122,7 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.JoinCmd.Force = g.JoinCmd.Flag("force", "Force phase execution").Bool()
 	g.JoinCmd.Complete = g.JoinCmd.Flag("complete", "Complete join operation").Bool()
 	g.JoinCmd.OperationID = g.JoinCmd.Flag("operation-id", "ID of the operation that was created via UI").Hidden().String()
+	g.JoinCmd.From = g.JoinCmd.Flag("from", "Install configuration file with the settings of the cluster and all of its nodes").String()
 
 	g.AutoJoinCmd.CmdClause = g.Command("autojoin", "Use cloud provider data to join a node to existing cluster")
 	g.AutoJoinCmd.ClusterName = g.AutoJoinCmd.Arg("cluster-name", "Cluster name used for discovery").Required().String()
@@ -129,9 +137,11 @@ func RegisterCommands(app *kingpin.Application) *Application {
 
 	g.RemoveCmd.CmdClause = g.Command("remove", "Remove a node from the cluster")
 	g.RemoveCmd.Node = g.RemoveCmd.Arg("node", "Node to remove: can be IP address, hostname or name from `kubectl get nodes` output)").
-		Required().String()
-	g.RemoveCmd.Force = g.RemoveCmd.Flag("force", "Force removal of offline node").Bool()
+		String()
+	g.RemoveCmd.Force = g.RemoveCmd.Flag("force", "Force removal of offline node or force phase execution").Bool()
 	g.RemoveCmd.Confirm = g.RemoveCmd.Flag("confirm", "Do not ask for confirmation").Bool()
+	g.RemoveCmd.Phase = g.RemoveCmd.Flag("phase", "Specific phase of the node removal operation to execute").String()
+	g.RemoveCmd.Resume = g.RemoveCmd.Flag("resume", "Resume the aborted node removal operation").Bool()
 
 	g.PlanCmd.CmdClause = g.Command("plan", "Display a plan for an ongoing operation")
 	g.PlanCmd.Init = g.PlanCmd.Flag("init", "Initialize operation plan").Bool()
@@ -164,6 +174,10 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.UpgradeCmd.Complete = g.UpgradeCmd.Flag("complete", "Complete update operation").Bool()
 	g.UpgradeCmd.Resume = g.UpgradeCmd.Flag("resume", "Resume upgrade from the last failed step").Bool()
 	g.UpgradeCmd.SkipVersionCheck = g.UpgradeCmd.Flag("skip-version-check", "Bypass version compatibility check").Hidden().Bool()
+	g.UpgradeCmd.Canary = g.UpgradeCmd.Flag("canary", "Update a single regular node first and pause the operation until the update is approved").Bool()
+	g.UpgradeCmd.BatchSize = g.UpgradeCmd.Flag("batch-size", "Number of regular nodes to update in parallel").Default("1").Int()
+	g.UpgradeCmd.Approve = g.UpgradeCmd.Flag("approve", "Approve the canary node update and resume the operation").Bool()
+	g.UpgradeCmd.AutoRollback = g.UpgradeCmd.Flag("auto-rollback", "Automatically roll back all started phases if the upgrade fails").Bool()
 
 	g.UpdateUploadCmd.CmdClause = g.UpdateCmd.Command("upload", "Upload update package to locally running site").Hidden()
 	g.UpdateUploadCmd.OpsCenterURL = g.UpdateUploadCmd.Flag("ops-url", "Optional OpsCenter URL to upload new packages to (defaults to local gravity site)").Default(defaults.GravityServiceURL).String()
@@ -185,6 +199,9 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.StatusCmd.OperationID = g.StatusCmd.Flag("operation-id", "Check status of operation with given ID").Short('o').String()
 	g.StatusCmd.Seconds = g.StatusCmd.Flag("seconds", "Continuously display status every N seconds").Short('s').Int()
 	g.StatusCmd.Output = common.Format(g.StatusCmd.Flag("output", "output format: json or text").Default(string(constants.EncodingText)))
+	g.StatusCmd.Drift = g.StatusCmd.Flag("drift", "Compare packages, services and their configuration installed on the cluster nodes with the expected cluster state").Bool()
+	g.StatusCmd.Repair = g.StatusCmd.Flag("repair", "Repair the drift detected with --drift").Bool()
+	g.StatusCmd.Local = g.StatusCmd.Flag("local", "Only detect drift on this node").Bool()
 
 	// reset cluster state, for debugging/emergencies
 	g.StatusResetCmd.CmdClause = g.Command("status-reset", "Reset the cluster state to 'active'").Hidden()
@@ -194,6 +211,7 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.BackupCmd.Tarball = g.BackupCmd.Arg("to", "Tarball to create with results of the backup hook").Required().String()
 	g.BackupCmd.Timeout = g.BackupCmd.Flag("timeout", "Active deadline for the backup job, in Go duration format (e.g. 30s, 5m, etc.). If not specified, the value from manifest is used. If that is not specified as well, the default value of 20 minutes is used").Duration()
 	g.BackupCmd.Follow = g.BackupCmd.Flag("follow", "Output backup job logs to the stdout").Bool()
+	g.BackupCmd.Cluster = g.BackupCmd.Flag("cluster", "Create a cluster backup for disaster recovery that in addition to the application backup includes the cluster state and packages. Kubernetes objects are not included. Restore it with gravity install --restore").Bool()
 
 	g.CheckCmd.CmdClause = g.Command("check", "check host environment to match manifest")
 	g.CheckCmd.ManifestFile = g.CheckCmd.Arg("manifest", "application manifest in YAML format").Default(defaults.ManifestFileName).String()
@@ -211,27 +229,31 @@ func RegisterCommands(app *kingpin.Application) *Application {
 
 	// helm-specific flags
 	g.AppInstallCmd.CmdClause = g.AppCmd.Command("install", "Install an application from the specified application image.")
-	g.AppInstallCmd.Image = g.AppInstallCmd.Arg("image", "Specifies application image to install. Can be an image tarball, an unpacked image tarball, or an image name in the form of <name>:<version>.").Required().String()
+	g.AppInstallCmd.Image = g.AppInstallCmd.Arg("image", "Specifies application image to install. Can be an image tarball, an unpacked image tarball, or a chart from the cluster chart repository in the form of <repository>/<chart>:<version>.").Required().String()
 	g.AppInstallCmd.Name = g.AppInstallCmd.Flag("name", "Release name. If not specified, will be auto-generated.").String()
 	g.AppInstallCmd.Namespace = g.AppInstallCmd.Flag("namespace", "Namespace to install release into.").Default(defaults.Namespace).String()
 	g.AppInstallCmd.Set = g.AppInstallCmd.Flag("set", "Set values on the command line. Can specify multiple or comma-separated: key1=val1,key2=val2.").Strings()
-	g.AppInstallCmd.Values = g.AppInstallCmd.Flag("values", "Set values from the provided YAML file.").Strings()
+	g.AppInstallCmd.Values = g.AppInstallCmd.Flag("values", "Set values from the provided YAML file. Files with the .tpl extension are rendered as templates with the cluster facts.").Strings()
 	g.AppInstallCmd.Registry = g.AppInstallCmd.Flag("registry", "Address of Docker registry to push application images to.").String()
 	g.AppInstallCmd.RegistryCA = g.AppInstallCmd.Flag("registry-ca", "Docker registry CA certificate path.").String()
 	g.AppInstallCmd.RegistryCert = g.AppInstallCmd.Flag("registry-cert", "Docker registry client certificate path.").String()
 	g.AppInstallCmd.RegistryKey = g.AppInstallCmd.Flag("registry-key", "Docker registry client private key path.").String()
+	g.AppInstallCmd.TrustedKeys = g.AppInstallCmd.Flag("trusted-key", "Public key file to verify the application image lock signature with. Can be repeated.").Strings()
+	g.AppInstallCmd.RequireSignature = g.AppInstallCmd.Flag("require-signature", "Reject application images without an image lock signed by one of the trusted keys.").Bool()
 
 	g.AppListCmd.CmdClause = g.AppCmd.Command("ls", "Show all application releases.")
 
 	g.AppUpgradeCmd.CmdClause = g.AppCmd.Command("upgrade", "Upgrade a release using the specified application image.")
 	g.AppUpgradeCmd.Release = g.AppUpgradeCmd.Arg("release", "Release name to upgrade.").Required().String()
-	g.AppUpgradeCmd.Image = g.AppUpgradeCmd.Arg("image", "Specifies application image to install. Can be an image tarball, an unpacked image tarball, or an image name in the form of <name>:<version>.").Required().String()
+	g.AppUpgradeCmd.Image = g.AppUpgradeCmd.Arg("image", "Specifies application image to install. Can be an image tarball, an unpacked image tarball, or a chart from the cluster chart repository in the form of <repository>/<chart>:<version>.").Required().String()
 	g.AppUpgradeCmd.Set = g.AppUpgradeCmd.Flag("set", "Set values on the command line. Can specify multiple or comma-separated: key1=val1,key2=val2.").Strings()
-	g.AppUpgradeCmd.Values = g.AppUpgradeCmd.Flag("values", "Set values from the provided YAML file.").Strings()
+	g.AppUpgradeCmd.Values = g.AppUpgradeCmd.Flag("values", "Set values from the provided YAML file. Files with the .tpl extension are rendered as templates with the cluster facts.").Strings()
 	g.AppUpgradeCmd.Registry = g.AppUpgradeCmd.Flag("registry", "Address of Docker registry to push application images to.").String()
 	g.AppUpgradeCmd.RegistryCA = g.AppUpgradeCmd.Flag("registry-ca", "Docker registry CA certificate path.").String()
 	g.AppUpgradeCmd.RegistryCert = g.AppUpgradeCmd.Flag("registry-cert", "Docker registry client certificate path.").String()
 	g.AppUpgradeCmd.RegistryKey = g.AppUpgradeCmd.Flag("registry-key", "Docker registry client private key path.").String()
+	g.AppUpgradeCmd.TrustedKeys = g.AppUpgradeCmd.Flag("trusted-key", "Public key file to verify the application image lock signature with. Can be repeated.").Strings()
+	g.AppUpgradeCmd.RequireSignature = g.AppUpgradeCmd.Flag("require-signature", "Reject application images without an image lock signed by one of the trusted keys.").Bool()
 
 	g.AppRollbackCmd.CmdClause = g.AppCmd.Command("rollback", "Rollback a release.")
 	g.AppRollbackCmd.Release = g.AppRollbackCmd.Arg("release", "Release name to rollback.").Required().String()
@@ -249,6 +271,8 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.AppSyncCmd.RegistryCA = g.AppSyncCmd.Flag("registry-ca", "Docker registry CA certificate path.").String()
 	g.AppSyncCmd.RegistryCert = g.AppSyncCmd.Flag("registry-cert", "Docker registry client certificate path.").String()
 	g.AppSyncCmd.RegistryKey = g.AppSyncCmd.Flag("registry-key", "Docker registry client private key path.").String()
+	g.AppSyncCmd.TrustedKeys = g.AppSyncCmd.Flag("trusted-key", "Public key file to verify the application image lock signature with. Can be repeated.").Strings()
+	g.AppSyncCmd.RequireSignature = g.AppSyncCmd.Flag("require-signature", "Reject application images without an image lock signed by one of the trusted keys.").Bool()
 
 	// import gravity application
 	g.AppImportCmd.CmdClause = g.AppCmd.Command("import", "Import application into gravity").Hidden()
@@ -315,6 +339,13 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.AppHookCmd.HookName = g.AppHookCmd.Arg("hook-name", fmt.Sprintf("name of the hook (one of %v)", schema.AllHooks())).Required().String()
 	g.AppHookCmd.Env = g.AppHookCmd.Flag("env", "additional environment variables to provide to hook job as key=value pairs. Can be specified multiple times").StringMap()
 
+	// show the difference between two application packages
+	g.AppDiffCmd.CmdClause = g.AppCmd.Command("diff", "Show changes between two versions of an application package.")
+	g.AppDiffCmd.From = Locator(g.AppDiffCmd.Arg("from", "older application package").Required())
+	g.AppDiffCmd.To = Locator(g.AppDiffCmd.Arg("to", "newer application package").Required())
+	g.AppDiffCmd.OpsCenterURL = g.AppDiffCmd.Flag("ops-url", "optional remote Ops Center URL").String()
+	g.AppDiffCmd.Format = common.Format(g.AppDiffCmd.Flag("output", "Output format, text or json").Short('o').Default(string(constants.EncodingText)))
+
 	// unpack application resources
 	g.AppUnpackCmd.CmdClause = g.AppCmd.Command("unpack", "unpack application resources").Hidden()
 	g.AppUnpackCmd.Package = Locator(g.AppUnpackCmd.Arg("pkg", "application package").Required())
@@ -341,6 +372,14 @@ func RegisterCommands(app *kingpin.Application) *Application {
 
 	g.OpsListCmd.CmdClause = g.OpsCmd.Command("ls", "list connected OpsCenters").Hidden()
 
+	g.OpsUninstallCmd.CmdClause = g.OpsCmd.Command("uninstall", "Display or execute the plan of the cluster uninstall operation")
+	g.OpsUninstallCmd.Cluster = g.OpsUninstallCmd.Arg("cluster", "Name of the cluster being uninstalled").Required().String()
+	g.OpsUninstallCmd.Phase = g.OpsUninstallCmd.Flag("phase", "Specific phase of the uninstall operation to execute").String()
+	g.OpsUninstallCmd.Resume = g.OpsUninstallCmd.Flag("resume", "Resume the failed uninstall operation").Bool()
+	g.OpsUninstallCmd.Force = g.OpsUninstallCmd.Flag("force", "Force phase execution").Bool()
+	g.OpsUninstallCmd.Skip = g.OpsUninstallCmd.Flag("skip", "Skip the node uninstall phase, e.g. when the node is unreachable").Bool()
+	g.OpsUninstallCmd.Output = common.Format(g.OpsUninstallCmd.Flag("output", "Output format for the plan, text, json or yaml").Short('o').Default(string(constants.EncodingText)))
+
 	// TODO: move this functionality to crpcAgent
 	g.OpsAgentCmd.CmdClause = g.OpsCmd.Command("agent", "Start an agent to perform a set of tasks").Hidden()
 	g.OpsAgentCmd.PackageAddr = g.OpsAgentCmd.Arg("package-addr", "Address of the package service").Required().String()
@@ -634,6 +673,48 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.GarbageCollectCmd.Confirmed = g.GarbageCollectCmd.Flag("confirm", "Confirm to remove unrelated docker images").Short('c').Bool()
 	g.GarbageCollectCmd.Force = g.GarbageCollectCmd.Flag("force", "Force phase execution").Bool()
 
+	// changing cluster configuration
+	g.ReconfigureCmd.CmdClause = g.Command("reconfigure", "Change configuration of the cluster")
+	g.ReconfigureNetworkCmd.CmdClause = g.ReconfigureCmd.Command("network", "Change pod/service subnets and the overlay network port of the cluster")
+	g.ReconfigureNetworkCmd.PodCIDR = g.ReconfigureNetworkCmd.Flag("pod-network-cidr", "New subnet range for pods. Must be a minimum of /16 for IPv4 and /56 for IPv6").String()
+	g.ReconfigureNetworkCmd.ServiceCIDR = g.ReconfigureNetworkCmd.Flag("service-cidr", "New subnet range for services").String()
+	g.ReconfigureNetworkCmd.VxlanPort = g.ReconfigureNetworkCmd.Flag("vxlan-port", "New overlay network port").Int()
+	g.ReconfigureNetworkCmd.Phase = g.ReconfigureNetworkCmd.Flag("phase", "Specific phase to execute").String()
+	g.ReconfigureNetworkCmd.PhaseTimeout = g.ReconfigureNetworkCmd.Flag("timeout", "Phase execution timeout").
+		Default(defaults.PhaseTimeout).
+		Hidden().
+		Duration()
+	g.ReconfigureNetworkCmd.Resume = g.ReconfigureNetworkCmd.Flag("resume", "Resume aborted operation").Bool()
+	g.ReconfigureNetworkCmd.Manual = g.ReconfigureNetworkCmd.Flag("manual", "Do not start the operation automatically").Short('m').Bool()
+	g.ReconfigureNetworkCmd.Force = g.ReconfigureNetworkCmd.Flag("force", "Force phase execution").Bool()
+
+	g.ReconfigureNodeCmd.CmdClause = g.ReconfigureCmd.Command("node", "Change the advertise address of a cluster node")
+	g.ReconfigureNodeCmd.Server = g.ReconfigureNodeCmd.Flag("server", "Hostname or current advertise address of the node to reconfigure. Defaults to the local node").String()
+	g.ReconfigureNodeCmd.AdvertiseAddr = g.ReconfigureNodeCmd.Flag("advertise-addr", "New advertise address of the node. The address must already be assigned to one of the node's network interfaces").String()
+	g.ReconfigureNodeCmd.Phase = g.ReconfigureNodeCmd.Flag("phase", "Specific phase to execute").String()
+	g.ReconfigureNodeCmd.PhaseTimeout = g.ReconfigureNodeCmd.Flag("timeout", "Phase execution timeout").
+		Default(defaults.PhaseTimeout).
+		Hidden().
+		Duration()
+	g.ReconfigureNodeCmd.Resume = g.ReconfigureNodeCmd.Flag("resume", "Resume aborted operation").Bool()
+	g.ReconfigureNodeCmd.Manual = g.ReconfigureNodeCmd.Flag("manual", "Do not start the operation automatically").Short('m').Bool()
+	g.ReconfigureNodeCmd.Force = g.ReconfigureNodeCmd.Flag("force", "Force phase execution").Bool()
+
+	g.ReconfigureDockerCmd.CmdClause = g.ReconfigureCmd.Command("docker", "Migrate a cluster node from devicemapper to a different Docker storage driver")
+	g.ReconfigureDockerCmd.Server = g.ReconfigureDockerCmd.Flag("server", "Hostname or advertise address of the node to migrate. Defaults to the local node").String()
+	g.ReconfigureDockerCmd.StorageDriver = g.ReconfigureDockerCmd.Flag("storage-driver",
+		fmt.Sprintf("New Docker storage driver of the node, one of %v", constants.DockerSupportedTargetDrivers)).
+		Default(constants.DockerStorageDriverOverlay2).
+		String()
+	g.ReconfigureDockerCmd.Phase = g.ReconfigureDockerCmd.Flag("phase", "Specific phase to execute").String()
+	g.ReconfigureDockerCmd.PhaseTimeout = g.ReconfigureDockerCmd.Flag("timeout", "Phase execution timeout").
+		Default(defaults.PhaseTimeout).
+		Hidden().
+		Duration()
+	g.ReconfigureDockerCmd.Resume = g.ReconfigureDockerCmd.Flag("resume", "Resume aborted operation").Bool()
+	g.ReconfigureDockerCmd.Manual = g.ReconfigureDockerCmd.Flag("manual", "Do not start the operation automatically").Short('m').Bool()
+	g.ReconfigureDockerCmd.Force = g.ReconfigureDockerCmd.Flag("force", "Force phase execution").Bool()
+
 	// system clean up tasks
 	systemGCCmd := g.SystemCmd.Command("gc", "Run system clean up tasks")
 
@@ -697,6 +778,52 @@ func RegisterCommands(app *kingpin.Application) *Application {
 	g.ResourceGetCmd.WithSecrets = g.ResourceGetCmd.Flag("with-secrets", "include secret properties like private keys").Default("false").Bool()
 	g.ResourceGetCmd.User = g.ResourceGetCmd.Flag("user", "user to display resources for, defaults to currently logged in user").String()
 
+	// apply a declarative cluster specification
+	g.ApplyCmd.CmdClause = g.Command("apply", "Bring the cluster to the state described by a cluster specification, e.g. gravity apply cluster.yaml")
+	g.ApplyCmd.Filename = g.ApplyCmd.Arg("filename", "cluster specification file").Required().String()
+	g.ApplyCmd.DryRun = g.ApplyCmd.Flag("dry-run", "Only display the changes, do not apply them").Bool()
+	g.ApplyCmd.Confirm = g.ApplyCmd.Flag("confirm", "Apply the changes without asking for confirmation").Short('c').Bool()
+	g.ApplyCmd.Output = common.Format(g.ApplyCmd.Flag("output", "output format for the changes: json or text").Default(string(constants.EncodingText)))
+
+	// operations scheduled in maintenance windows
+	g.ScheduleCmd.CmdClause = g.Command("schedule", "Manage operations scheduled in maintenance windows")
+	g.ScheduleCreateCmd.CmdClause = g.ScheduleCmd.Command("create", "Schedule an operation to run in a maintenance window, e.g. gravity schedule create gc --days=sat,sun --start=02:00 --duration=4h")
+	g.ScheduleCreateCmd.Operation = g.ScheduleCreateCmd.Arg("operation", fmt.Sprintf("operation to schedule, one of %v", strings.Join(storage.ScheduledOperations, ", "))).Required().Enum(storage.ScheduledOperations...)
+	g.ScheduleCreateCmd.App = g.ScheduleCreateCmd.Arg("app", "Application version to update to, in the 'name:version' or 'name' (for latest version) format. Only used with the update operation").String()
+	g.ScheduleCreateCmd.Days = g.ScheduleCreateCmd.Flag("days", "Week days the maintenance window opens on, e.g. sat,sun. Opens every day if unspecified").Strings()
+	g.ScheduleCreateCmd.Start = g.ScheduleCreateCmd.Flag("start", "Time of day the maintenance window opens at, in the HH:MM format in UTC").Required().String()
+	g.ScheduleCreateCmd.Duration = g.ScheduleCreateCmd.Flag("duration", "Maintenance window duration, e.g. 4h").Required().Duration()
+	g.ScheduleListCmd.CmdClause = g.ScheduleCmd.Command("ls", "List scheduled operations")
+	g.ScheduleListCmd.Format = common.Format(g.ScheduleListCmd.Flag("format", "output format, e.g. 'text' or 'json'").Default(string(constants.EncodingText)))
+	g.ScheduleRemoveCmd.CmdClause = g.ScheduleCmd.Command("rm", "Remove a scheduled operation")
+	g.ScheduleRemoveCmd.ID = g.ScheduleRemoveCmd.Arg("id", "ID of the schedule to remove").Required().String()
+
+	// etcd maintenance
+	g.EtcdCmd.CmdClause = g.Command("etcd", "Manage cluster etcd: snapshots, defragmentation and status")
+	g.EtcdSnapshotCmd.CmdClause = g.EtcdCmd.Command("snapshot", "Take a snapshot of the etcd data and store it in the cluster package service")
+	g.EtcdSnapshotCmd.Retain = g.EtcdSnapshotCmd.Flag("retain", "Number of most recent snapshots to keep").Default(strconv.Itoa(defaults.EtcdSnapshotRetention)).Int()
+	g.EtcdRestoreCmd.CmdClause = g.EtcdCmd.Command("restore", "Replace the etcd data on all master nodes with the data from a snapshot")
+	g.EtcdRestoreCmd.Version = g.EtcdRestoreCmd.Arg("version", "Version of the snapshot to restore, as shown by gravity etcd status. Defaults to the most recent snapshot").String()
+	g.EtcdRestoreCmd.Confirm = g.EtcdRestoreCmd.Flag("confirm", "Restore the snapshot without asking for confirmation").Short('c').Bool()
+	g.EtcdRestoreCmd.Resume = g.EtcdRestoreCmd.Flag("resume", "Resume the interrupted restore").Bool()
+	g.EtcdRestoreCmd.Rollback = g.EtcdRestoreCmd.Flag("rollback", "Roll back the interrupted restore and bring back the etcd data from before the restore").Bool()
+	g.EtcdStatusCmd.CmdClause = g.EtcdCmd.Command("status", "Display the status of etcd members and the available snapshots")
+	g.EtcdStatusCmd.Output = common.Format(g.EtcdStatusCmd.Flag("output", "output format, e.g. 'text' or 'json'").Default(string(constants.EncodingText)))
+	g.EtcdDefragCmd.CmdClause = g.EtcdCmd.Command("defrag", "Defragment etcd members one at a time")
+
+	// node configuration
+	g.NodeCmd.CmdClause = g.Command("node", "Change labels, taints and profile of cluster nodes")
+	g.NodeLabelCmd.CmdClause = g.NodeCmd.Command("label", "Add or remove Kubernetes labels of a node")
+	g.NodeLabelCmd.Node = g.NodeLabelCmd.Arg("node", "Node to update: IP address, hostname or name from `kubectl get nodes` output").Required().String()
+	g.NodeLabelCmd.Labels = g.NodeLabelCmd.Arg("labels", "Labels to add as key=value or to remove as key-").Required().Strings()
+	g.NodeTaintCmd.CmdClause = g.NodeCmd.Command("taint", "Add or remove Kubernetes taints of a node")
+	g.NodeTaintCmd.Node = g.NodeTaintCmd.Arg("node", "Node to update: IP address, hostname or name from `kubectl get nodes` output").Required().String()
+	g.NodeTaintCmd.Taints = g.NodeTaintCmd.Arg("taints", "Taints to add as key=value:effect or to remove as key:effect- or key-").Required().Strings()
+	g.NodeProfileCmd.CmdClause = g.NodeCmd.Command("profile", "Change the profile of a node")
+	g.NodeProfileCmd.Node = g.NodeProfileCmd.Arg("node", "Node to update: IP address, hostname or name from `kubectl get nodes` output").Required().String()
+	g.NodeProfileCmd.Profile = g.NodeProfileCmd.Arg("profile", "Name of the new node profile").Required().String()
+	g.NodeProfileCmd.Force = g.NodeProfileCmd.Flag("force", "Change the profile even if the node does not satisfy the profile requirements").Bool()
+
 	return g
 }
 
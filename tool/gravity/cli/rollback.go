@@ -40,5 +40,15 @@ func rollbackOperationPhase(env, updateEnv, joinEnv *localenv.LocalEnvironment,
 	if joinEnv != nil && hasExpandOperation(joinEnv) {
 		return rollbackJoinPhase(env, joinEnv, p)
 	}
+	if hasShrinkOperation(env) {
+		return executeShrinkPhase(env, shrinkPhaseParams{
+			phaseID:  p.phaseID,
+			force:    p.force,
+			rollback: true,
+		})
+	}
+	if hasReconfigureOperation(env) {
+		return rollbackReconfigurePhase(env, p)
+	}
 	return rollbackInstallPhase(env, p)
 }
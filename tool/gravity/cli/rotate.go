@@ -53,7 +53,7 @@ func rotateCertificates(env *localenv.LocalEnvironment, o rotateOptions) (err er
 		archive, err = readCertAuthorityFromFile(o.caPath)
 		env.Printf("Using certificate authority from %v\n", o.caPath)
 	} else {
-		archive, err = readCertAuthorityPackage(env.Packages, o.clusterName)
+		archive, err = readCertAuthority(env, o.clusterName)
 	}
 	if err != nil {
 		return trace.Wrap(err)
@@ -174,6 +174,22 @@ func certToCSR(cert *x509.Certificate) csr.CertificateRequest {
 	return req
 }
 
+// readCertAuthority returns the cluster certificate authority from the local
+// package service or, on regular nodes that do not have the package,
+// from the cluster package service
+func readCertAuthority(env *localenv.LocalEnvironment, clusterName string) (utils.TLSArchive, error) {
+	archive, err := readCertAuthorityPackage(env.Packages, clusterName)
+	if err == nil || !trace.IsNotFound(err) {
+		return archive, trace.Wrap(err)
+	}
+	packages, err := env.ClusterPackages()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	env.Println("Using certificate authority from the cluster")
+	return readCertAuthorityPackage(packages, clusterName)
+}
+
 func readCertAuthorityPackage(packages pack.PackageService, clusterName string) (utils.TLSArchive, error) {
 	locator, err := loc.ParseLocator(fmt.Sprintf("%v/%v:0.0.1", clusterName,
 		constants.CertAuthorityPackage))
@@ -252,6 +252,41 @@ func deployAgents(ctx context.Context, env *localenv.LocalEnvironment, req deplo
 	return clientCreds, nil
 }
 
+// deployClusterAgents deploys RPC agents on the specified cluster servers
+func deployClusterAgents(ctx context.Context, env *localenv.LocalEnvironment, clusterName string, servers []storage.Server) (fsm.AgentRepository, error) {
+	clusterEnv, err := env.NewClusterEnvironment()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	teleportClient, err := env.TeleportClient(constants.Localhost)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to create a teleport client")
+	}
+	proxy, err := teleportClient.ConnectToProxy(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to connect to teleport proxy")
+	}
+	creds, err := deployAgents(ctx, env, deployAgentsRequest{
+		clusterState: storage.ClusterState{Servers: servers},
+		clusterName:  clusterName,
+		clusterEnv:   clusterEnv,
+		proxy:        proxy,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return fsm.NewAgentRunner(creds), nil
+}
+
+// shutdownClusterAgents shuts down the RPC agents on the specified cluster servers
+func shutdownClusterAgents(ctx context.Context, servers []storage.Server, runner fsm.AgentRepository, logger logrus.FieldLogger) error {
+	var addrs []string
+	for _, server := range servers {
+		addrs = append(addrs, server.AdvertiseIP)
+	}
+	return trace.Wrap(rpc.ShutdownAgents(ctx, addrs, logger, runner))
+}
+
 func deployUpdateAgents(ctx context.Context, localEnv, updateEnv *localenv.LocalEnvironment, req deployAgentsRequest) error {
 	deployReq, err := newDeployAgentsRequest(ctx, req)
 	if err != nil {
@@ -36,6 +36,7 @@ import (
 	"github.com/gravitational/gravity/lib/localenv"
 	"github.com/gravitational/gravity/lib/process"
 	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
 	"github.com/gravitational/gravity/lib/systemservice"
 	"github.com/gravitational/gravity/lib/utils"
 
@@ -179,6 +180,13 @@ func InitAndCheck(g *Application, cmd string) error {
 		g.BackupCmd.FullCommand(),
 		g.RestoreCmd.FullCommand(),
 		g.GarbageCollectCmd.FullCommand(),
+		g.ReconfigureNetworkCmd.FullCommand(),
+		g.ReconfigureNodeCmd.FullCommand(),
+		g.ReconfigureDockerCmd.FullCommand(),
+		g.EtcdSnapshotCmd.FullCommand(),
+		g.EtcdRestoreCmd.FullCommand(),
+		g.EtcdStatusCmd.FullCommand(),
+		g.EtcdDefragCmd.FullCommand(),
 		g.SystemGCRegistryCmd.FullCommand(),
 		g.CheckCmd.FullCommand():
 		if err := checkRunningAsRoot(); err != nil {
@@ -334,7 +342,9 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 		return updateTrigger(localEnv,
 			upgradeEnv,
 			*g.UpdateTriggerCmd.App,
-			*g.UpdateTriggerCmd.Manual)
+			*g.UpdateTriggerCmd.Manual,
+			nil,
+			false)
 	case g.UpgradeCmd.FullCommand():
 		if *g.UpgradeCmd.Resume {
 			*g.UpgradeCmd.Phase = fsm.RootPhase
@@ -351,10 +361,27 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 		if *g.UpgradeCmd.Complete {
 			return completeUpgrade(localEnv, upgradeEnv)
 		}
+		if *g.UpgradeCmd.Approve {
+			return approveUpgrade(localEnv, upgradeEnv,
+				upgradePhaseParams{
+					force:            *g.UpgradeCmd.Force,
+					skipVersionCheck: *g.UpgradeCmd.SkipVersionCheck,
+					timeout:          *g.UpgradeCmd.Timeout,
+				})
+		}
+		var strategy *storage.RolloutStrategy
+		if *g.UpgradeCmd.Canary || *g.UpgradeCmd.BatchSize != 1 {
+			strategy = &storage.RolloutStrategy{
+				Canary:    *g.UpgradeCmd.Canary,
+				BatchSize: *g.UpgradeCmd.BatchSize,
+			}
+		}
 		return updateTrigger(localEnv,
 			upgradeEnv,
 			*g.UpgradeCmd.App,
-			*g.UpgradeCmd.Manual)
+			*g.UpgradeCmd.Manual,
+			strategy,
+			*g.UpgradeCmd.AutoRollback)
 	case g.RollbackCmd.FullCommand():
 		return rollbackOperationPhase(localEnv,
 			upgradeEnv,
@@ -379,6 +406,16 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			confirmed: *g.LeaveCmd.Confirm,
 		})
 	case g.RemoveCmd.FullCommand():
+		phase := *g.RemoveCmd.Phase
+		if *g.RemoveCmd.Resume {
+			phase = fsm.RootPhase
+		}
+		if phase != "" {
+			return executeShrinkPhase(localEnv, shrinkPhaseParams{
+				phaseID: phase,
+				force:   *g.RemoveCmd.Force,
+			})
+		}
 		return remove(localEnv, removeConfig{
 			server:    *g.RemoveCmd.Node,
 			force:     *g.RemoveCmd.Force,
@@ -391,6 +428,9 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			quiet:       *g.Silent,
 			format:      *g.StatusCmd.Output,
 		}
+		if *g.StatusCmd.Drift || *g.StatusCmd.Repair {
+			return statusDrift(localEnv, *g.StatusCmd.Output, *g.StatusCmd.Repair, *g.StatusCmd.Local)
+		}
 		if *g.StatusCmd.Tail {
 			return tailStatus(localEnv, *g.StatusCmd.OperationID)
 		}
@@ -412,10 +452,12 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			Set:       *g.AppInstallCmd.Set,
 			Values:    *g.AppInstallCmd.Values,
 			registryConfig: registryConfig{
-				Registry: *g.AppInstallCmd.Registry,
-				CAPath:   *g.AppInstallCmd.RegistryCA,
-				CertPath: *g.AppInstallCmd.RegistryCert,
-				KeyPath:  *g.AppInstallCmd.RegistryKey,
+				Registry:         *g.AppInstallCmd.Registry,
+				CAPath:           *g.AppInstallCmd.RegistryCA,
+				CertPath:         *g.AppInstallCmd.RegistryCert,
+				KeyPath:          *g.AppInstallCmd.RegistryKey,
+				TrustedKeys:      *g.AppInstallCmd.TrustedKeys,
+				RequireSignature: *g.AppInstallCmd.RequireSignature,
 			},
 		})
 	case g.AppListCmd.FullCommand():
@@ -427,10 +469,12 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			Set:     *g.AppUpgradeCmd.Set,
 			Values:  *g.AppUpgradeCmd.Values,
 			registryConfig: registryConfig{
-				Registry: *g.AppUpgradeCmd.Registry,
-				CAPath:   *g.AppUpgradeCmd.RegistryCA,
-				CertPath: *g.AppUpgradeCmd.RegistryCert,
-				KeyPath:  *g.AppUpgradeCmd.RegistryKey,
+				Registry:         *g.AppUpgradeCmd.Registry,
+				CAPath:           *g.AppUpgradeCmd.RegistryCA,
+				CertPath:         *g.AppUpgradeCmd.RegistryCert,
+				KeyPath:          *g.AppUpgradeCmd.RegistryKey,
+				TrustedKeys:      *g.AppUpgradeCmd.TrustedKeys,
+				RequireSignature: *g.AppUpgradeCmd.RequireSignature,
 			},
 		})
 	case g.AppRollbackCmd.FullCommand():
@@ -450,10 +494,12 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 		return appSync(localEnv, appSyncConfig{
 			Image: *g.AppSyncCmd.Image,
 			registryConfig: registryConfig{
-				Registry: *g.AppSyncCmd.Registry,
-				CAPath:   *g.AppSyncCmd.RegistryCA,
-				CertPath: *g.AppSyncCmd.RegistryCert,
-				KeyPath:  *g.AppSyncCmd.RegistryKey,
+				Registry:         *g.AppSyncCmd.Registry,
+				CAPath:           *g.AppSyncCmd.RegistryCA,
+				CertPath:         *g.AppSyncCmd.RegistryCert,
+				KeyPath:          *g.AppSyncCmd.RegistryKey,
+				TrustedKeys:      *g.AppSyncCmd.TrustedKeys,
+				RequireSignature: *g.AppSyncCmd.RequireSignature,
 			},
 		})
 		// internal (hidden) app commands
@@ -534,6 +580,12 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			*g.AppUnpackCmd.Dir,
 			*g.AppUnpackCmd.OpsCenterURL,
 			*g.AppUnpackCmd.ServiceUID)
+	case g.AppDiffCmd.FullCommand():
+		return diffApps(localEnv,
+			*g.AppDiffCmd.From,
+			*g.AppDiffCmd.To,
+			*g.AppDiffCmd.OpsCenterURL,
+			*g.AppDiffCmd.Format)
 	// package commands
 	case g.PackImportCmd.FullCommand():
 		return importPackage(localEnv,
@@ -605,6 +657,20 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			*g.OpsDisconnectCmd.OpsCenterURL)
 	case g.OpsListCmd.FullCommand():
 		return listOpsCenters(localEnv)
+	case g.OpsUninstallCmd.FullCommand():
+		phase := *g.OpsUninstallCmd.Phase
+		if *g.OpsUninstallCmd.Resume {
+			phase = fsm.RootPhase
+		}
+		if phase == "" {
+			return displayUninstallPlan(localEnv, *g.OpsUninstallCmd.Cluster, *g.OpsUninstallCmd.Output)
+		}
+		return executeUninstallPhase(localEnv, uninstallPhaseParams{
+			clusterName: *g.OpsUninstallCmd.Cluster,
+			phaseID:     phase,
+			force:       *g.OpsUninstallCmd.Force,
+			skip:        *g.OpsUninstallCmd.Skip,
+		})
 	case g.UserCreateCmd.FullCommand():
 		return createUser(localEnv,
 			*g.UserCreateCmd.OpsCenterURL,
@@ -687,6 +753,13 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 	case g.SystemStepDownCmd.FullCommand():
 		return stepDown(localEnv)
 	case g.BackupCmd.FullCommand():
+		if *g.BackupCmd.Cluster {
+			return backupCluster(localEnv,
+				*g.BackupCmd.Tarball,
+				*g.BackupCmd.Timeout,
+				*g.BackupCmd.Follow,
+				*g.Silent)
+		}
 		return backup(localEnv,
 			*g.BackupCmd.Tarball,
 			*g.BackupCmd.Timeout,
@@ -752,6 +825,49 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 				*g.GarbageCollectCmd.Force)
 		}
 		return garbageCollect(localEnv, *g.GarbageCollectCmd.Manual, *g.GarbageCollectCmd.Confirmed)
+	case g.ReconfigureNetworkCmd.FullCommand():
+		phase := *g.ReconfigureNetworkCmd.Phase
+		if *g.ReconfigureNetworkCmd.Resume {
+			phase = fsm.RootPhase
+		}
+		if phase != "" {
+			return reconfigurePhase(localEnv, phase, *g.ReconfigureNetworkCmd.PhaseTimeout,
+				*g.ReconfigureNetworkCmd.Force)
+		}
+		return reconfigureNetwork(localEnv, reconfigureNetworkParams{
+			podCIDR:     *g.ReconfigureNetworkCmd.PodCIDR,
+			serviceCIDR: *g.ReconfigureNetworkCmd.ServiceCIDR,
+			vxlanPort:   *g.ReconfigureNetworkCmd.VxlanPort,
+			manual:      *g.ReconfigureNetworkCmd.Manual,
+		})
+	case g.ReconfigureNodeCmd.FullCommand():
+		phase := *g.ReconfigureNodeCmd.Phase
+		if *g.ReconfigureNodeCmd.Resume {
+			phase = fsm.RootPhase
+		}
+		if phase != "" {
+			return reconfigurePhase(localEnv, phase, *g.ReconfigureNodeCmd.PhaseTimeout,
+				*g.ReconfigureNodeCmd.Force)
+		}
+		return reconfigureNode(localEnv, reconfigureNodeParams{
+			server:        *g.ReconfigureNodeCmd.Server,
+			advertiseAddr: *g.ReconfigureNodeCmd.AdvertiseAddr,
+			manual:        *g.ReconfigureNodeCmd.Manual,
+		})
+	case g.ReconfigureDockerCmd.FullCommand():
+		phase := *g.ReconfigureDockerCmd.Phase
+		if *g.ReconfigureDockerCmd.Resume {
+			phase = fsm.RootPhase
+		}
+		if phase != "" {
+			return reconfigurePhase(localEnv, phase, *g.ReconfigureDockerCmd.PhaseTimeout,
+				*g.ReconfigureDockerCmd.Force)
+		}
+		return reconfigureDocker(localEnv, reconfigureDockerParams{
+			server:        *g.ReconfigureDockerCmd.Server,
+			storageDriver: *g.ReconfigureDockerCmd.StorageDriver,
+			manual:        *g.ReconfigureDockerCmd.Manual,
+		})
 	case g.SystemGCJournalCmd.FullCommand():
 		return removeUnusedJournalFiles(localEnv,
 			*g.SystemGCJournalCmd.MachineIDFile,
@@ -809,6 +925,48 @@ func Execute(g *Application, cmd string, extraArgs []string) error {
 			*g.ResourceGetCmd.WithSecrets,
 			*g.ResourceGetCmd.Format,
 			*g.ResourceGetCmd.User)
+	case g.ApplyCmd.FullCommand():
+		return applyClusterSpec(localEnv, g.UpgradeEnv,
+			*g.ApplyCmd.Filename,
+			*g.ApplyCmd.DryRun,
+			*g.ApplyCmd.Confirm,
+			*g.ApplyCmd.Output)
+	case g.ScheduleCreateCmd.FullCommand():
+		return createSchedule(localEnv, scheduleOptions{
+			operation: *g.ScheduleCreateCmd.Operation,
+			app:       *g.ScheduleCreateCmd.App,
+			days:      *g.ScheduleCreateCmd.Days,
+			start:     *g.ScheduleCreateCmd.Start,
+			duration:  *g.ScheduleCreateCmd.Duration,
+		})
+	case g.ScheduleListCmd.FullCommand():
+		return listSchedules(localEnv, *g.ScheduleListCmd.Format)
+	case g.ScheduleRemoveCmd.FullCommand():
+		return removeSchedule(localEnv, *g.ScheduleRemoveCmd.ID)
+	case g.EtcdSnapshotCmd.FullCommand():
+		return etcdSnapshot(localEnv, *g.EtcdSnapshotCmd.Retain)
+	case g.EtcdRestoreCmd.FullCommand():
+		restoreEnv, err := g.EtcdRestoreEnv()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		defer restoreEnv.Close()
+		return etcdRestore(localEnv, restoreEnv, etcdRestoreConfig{
+			version:   *g.EtcdRestoreCmd.Version,
+			confirmed: *g.EtcdRestoreCmd.Confirm,
+			resume:    *g.EtcdRestoreCmd.Resume,
+			rollback:  *g.EtcdRestoreCmd.Rollback,
+		})
+	case g.EtcdStatusCmd.FullCommand():
+		return etcdStatus(localEnv, *g.EtcdStatusCmd.Output)
+	case g.EtcdDefragCmd.FullCommand():
+		return etcdDefrag(localEnv)
+	case g.NodeLabelCmd.FullCommand():
+		return updateNodeLabels(localEnv, *g.NodeLabelCmd.Node, *g.NodeLabelCmd.Labels)
+	case g.NodeTaintCmd.FullCommand():
+		return updateNodeTaints(localEnv, *g.NodeTaintCmd.Node, *g.NodeTaintCmd.Taints)
+	case g.NodeProfileCmd.FullCommand():
+		return updateNodeProfile(localEnv, *g.NodeProfileCmd.Node, *g.NodeProfileCmd.Profile, *g.NodeProfileCmd.Force)
 	case g.RPCAgentDeployCmd.FullCommand():
 		return rpcAgentDeploy(localEnv, *g.RPCAgentDeployCmd.Args)
 	case g.RPCAgentInstallCmd.FullCommand():
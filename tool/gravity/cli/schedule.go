@@ -0,0 +1,188 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+	"github.com/gravitational/gravity/lib/storage"
+
+	"github.com/gravitational/trace"
+)
+
+// scheduleOptions describes an operation to schedule
+type scheduleOptions struct {
+	// operation is the type of the operation to schedule
+	operation string
+	// app is the application to update to, for update operations
+	app string
+	// days lists week days the maintenance window opens on
+	days []string
+	// start is the time of day the maintenance window opens at
+	start string
+	// duration is the maintenance window duration
+	duration time.Duration
+}
+
+func createSchedule(env *localenv.LocalEnvironment, o scheduleOptions) error {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	req := ops.CreateScheduleRequest{
+		AccountID:  cluster.AccountID,
+		SiteDomain: cluster.Domain,
+		Operation:  o.operation,
+		Window: storage.MaintenanceWindow{
+			Days:     splitDays(o.days),
+			Start:    o.start,
+			Duration: o.duration,
+		},
+	}
+	if err := req.Window.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+	switch {
+	case o.operation == storage.ScheduledUpdate:
+		update, err := resolveUpdate(env, cluster, o.app)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		req.App = update.Package.String()
+	case o.app != "":
+		return trace.BadParameter("application can only be specified for the %v operation",
+			storage.ScheduledUpdate)
+	}
+	schedule, err := operator.CreateSchedule(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Scheduled %v operation %v, the maintenance window opens %v.\n",
+		schedule.Operation, schedule.ID, describeNextWindow(schedule.Window, time.Now()))
+	return nil
+}
+
+func listSchedules(env *localenv.LocalEnvironment, format constants.Format) error {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	schedules, err := operator.GetSchedules(cluster.Key())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	switch format {
+	case constants.EncodingText:
+		printSchedules(schedules)
+		return nil
+	case constants.EncodingJSON:
+		if schedules == nil {
+			schedules = []storage.Schedule{}
+		}
+		data, err := json.MarshalIndent(schedules, "", "    ")
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	return trace.BadParameter("unsupported output format %q, supported are: %v, %v",
+		format, constants.EncodingText, constants.EncodingJSON)
+}
+
+func removeSchedule(env *localenv.LocalEnvironment, id string) error {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = operator.DeleteSchedule(cluster.Key(), id)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	env.Printf("Schedule %v has been removed.\n", id)
+	return nil
+}
+
+func printSchedules(schedules []storage.Schedule) {
+	if len(schedules) == 0 {
+		fmt.Println("There are no scheduled operations.")
+		return
+	}
+	now := time.Now()
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "ID\tOperation\tWindow\tNext Window\tState\tOperation ID\tMessage\n")
+	for _, schedule := range schedules {
+		operation := schedule.Operation
+		if schedule.App != "" {
+			operation = fmt.Sprintf("%v to %v", operation, schedule.App)
+		}
+		nextWindow := ""
+		if schedule.IsActive() {
+			nextWindow = describeNextWindow(schedule.Window, now)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			schedule.ID,
+			operation,
+			schedule.Window,
+			nextWindow,
+			schedule.State,
+			schedule.OperationID,
+			schedule.Message)
+	}
+	w.Flush()
+}
+
+func describeNextWindow(window storage.MaintenanceWindow, now time.Time) string {
+	if window.IsOpen(now) {
+		return "now"
+	}
+	return window.Next(now).Format(constants.HumanDateFormat)
+}
+
+// splitDays accepts week days specified either as separate flags
+// or as a comma-separated list
+func splitDays(values []string) (days []string) {
+	for _, value := range values {
+		for _, day := range strings.Split(value, ",") {
+			if day = strings.TrimSpace(day); day != "" {
+				days = append(days, strings.ToLower(day))
+			}
+		}
+	}
+	return days
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+
+	"github.com/gravitational/trace"
+)
+
+// shrinkPhaseParams combines parameters for a shrink operation phase
+type shrinkPhaseParams struct {
+	// phaseID is the ID of the phase to execute or rollback
+	phaseID string
+	// force allows to force phase execution
+	force bool
+	// rollback specifies whether the phase should be rolled back
+	rollback bool
+}
+
+// executeShrinkPhase executes or rolls back the specified phase of the
+// last shrink operation
+func executeShrinkPhase(env *localenv.LocalEnvironment, p shrinkPhaseParams) error {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	operation, err := ops.GetLastShrinkOperation(cluster.Key(), operator)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = operator.ExecuteShrinkPhase(ops.ShrinkPhaseRequest{
+		Key:      operation.Key(),
+		PhaseID:  p.phaseID,
+		Force:    p.force,
+		Rollback: p.rollback,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if p.phaseID == fsm.RootPhase && !p.rollback {
+		fmt.Printf("resumed operation %q, use 'gravity status' to poll its progress\n",
+			operation.ID)
+	}
+	return nil
+}
+
+// hasShrinkOperation returns true if the last cluster operation is
+// an unfinished shrink operation
+func hasShrinkOperation(env *localenv.LocalEnvironment) bool {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return false
+	}
+	cluster, err := operator.GetLocalSite()
+	if err != nil {
+		return false
+	}
+	operation, err := ops.GetLastShrinkOperation(cluster.Key(), operator)
+	if err != nil {
+		return false
+	}
+	return !operation.IsCompleted()
+}
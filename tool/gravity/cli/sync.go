@@ -24,6 +24,7 @@ import (
 	"github.com/gravitational/gravity/lib/httplib"
 	"github.com/gravitational/gravity/lib/localenv"
 
+	"github.com/docker/libtrust"
 	"github.com/gravitational/trace"
 )
 
@@ -44,16 +45,48 @@ type registryConfig struct {
 	CertPath string
 	// KeyPath is a client key path for a registry.
 	KeyPath string
+	// TrustedKeys is a list of public key files image locks are accepted from.
+	TrustedKeys []string
+	// RequireSignature rejects images without an image lock signed by a trusted key.
+	RequireSignature bool
 }
 
 // imageService returns a new registry client for this config.
 func (c registryConfig) imageService() (docker.ImageService, error) {
+	policy, err := c.lockPolicy()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
 	return docker.NewImageService(docker.RegistryConnectionRequest{
 		RegistryAddress: c.Registry,
 		CACertPath:      c.CAPath,
 		ClientCertPath:  c.CertPath,
 		ClientKeyPath:   c.KeyPath,
-	})
+	}, docker.WithLockPolicy(*policy))
+}
+
+// clusterImageService returns a new client for the specified cluster registry.
+func (c registryConfig) clusterImageService(registry string) (docker.ImageService, error) {
+	policy, err := c.lockPolicy()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return docker.NewClusterImageService(registry, docker.WithLockPolicy(*policy))
+}
+
+// lockPolicy returns the image lock verification policy for this config.
+func (c registryConfig) lockPolicy() (*docker.LockPolicy, error) {
+	policy := docker.LockPolicy{
+		RequireSignature: c.RequireSignature,
+	}
+	for _, path := range c.TrustedKeys {
+		key, err := libtrust.LoadPublicKeyFile(path)
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to load trusted key from %v", path)
+		}
+		policy.TrustedKeys = append(policy.TrustedKeys, key)
+	}
+	return &policy, nil
 }
 
 func appSync(env *localenv.LocalEnvironment, conf appSyncConfig) error {
@@ -80,7 +113,7 @@ func appSyncEnv(env *localenv.LocalEnvironment, imageEnv *localenv.ImageEnvironm
 		}
 		for _, registry := range registries {
 			env.PrintStep("Pushing application images to Docker registry %v", registry)
-			imageService, err := docker.NewClusterImageService(registry)
+			imageService, err := conf.clusterImageService(registry)
 			if err != nil {
 				return trace.Wrap(err)
 			}
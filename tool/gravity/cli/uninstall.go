@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/fsm"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
+
+	"github.com/gravitational/trace"
+)
+
+// uninstallPhaseParams combines parameters for an uninstall operation phase
+type uninstallPhaseParams struct {
+	// clusterName is the name of the cluster being uninstalled
+	clusterName string
+	// phaseID is the ID of the phase to execute
+	phaseID string
+	// force allows to force phase execution
+	force bool
+	// skip marks the node phase completed without executing it
+	skip bool
+}
+
+// displayUninstallPlan displays the plan of the last uninstall operation
+// of the specified cluster
+func displayUninstallPlan(env *localenv.LocalEnvironment, clusterName string, format constants.Format) error {
+	operator, operation, err := getUninstallOperation(env, clusterName)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	plan, err := operator.GetOperationPlan(operation.Key())
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(outputPlan(*plan, format))
+}
+
+// executeUninstallPhase executes or skips the specified phase of the
+// last uninstall operation of the specified cluster
+func executeUninstallPhase(env *localenv.LocalEnvironment, p uninstallPhaseParams) error {
+	operator, operation, err := getUninstallOperation(env, p.clusterName)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	err = operator.ExecuteUninstallPhase(ops.UninstallPhaseRequest{
+		Key:     operation.Key(),
+		PhaseID: p.phaseID,
+		Force:   p.force,
+		Skip:    p.skip,
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if p.phaseID == fsm.RootPhase {
+		fmt.Printf("resumed operation %q\n", operation.ID)
+	}
+	return nil
+}
+
+// getUninstallOperation returns the last uninstall operation of the
+// specified cluster managed by this Ops Center
+func getUninstallOperation(env *localenv.LocalEnvironment, clusterName string) (ops.Operator, *ops.SiteOperation, error) {
+	operator, err := env.SiteOperator()
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	cluster, err := operator.GetSiteByDomain(clusterName)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	operation, _, err := ops.GetLastUninstallOperation(cluster.Key(), operator)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	return operator, operation, nil
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/pack"
 	"github.com/gravitational/gravity/lib/schema"
+	"github.com/gravitational/gravity/lib/storage"
 
 	"github.com/gravitational/trace"
 )
@@ -53,6 +54,8 @@ func updateTrigger(
 	upgradeEnv *localenv.LocalEnvironment,
 	appPackage string,
 	manual bool,
+	strategy *storage.RolloutStrategy,
+	autoRollback bool,
 ) error {
 	clusterEnv, err := localEnv.NewClusterEnvironment()
 	if err != nil {
@@ -90,9 +93,11 @@ func updateTrigger(
 	}
 
 	opKey, err := operator.CreateSiteAppUpdateOperation(ops.CreateSiteAppUpdateOperationRequest{
-		AccountID:  cluster.AccountID,
-		SiteDomain: cluster.Domain,
-		App:        app.Package.String(),
+		AccountID:    cluster.AccountID,
+		SiteDomain:   cluster.Domain,
+		App:          app.Package.String(),
+		Strategy:     strategy,
+		AutoRollback: autoRollback,
 	})
 	if err != nil {
 		return trace.Wrap(err)
@@ -201,6 +206,21 @@ Please update this installation to a minimum required runtime version (%q) befor
 // updatePackage specifies an optional (potentially incomplete) package name of the update package.
 // If unspecified, the currently installed application package is used.
 func checkForUpdate(env *localenv.LocalEnvironment, operator ops.Operator, site *ops.Site, updatePackage string) (*appservice.Application, error) {
+	update, err := resolveUpdate(env, site, updatePackage)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	env.Printf("Upgrading application %v from %v to %v.\n",
+		update.Package.Name, site.App.Package.Version, update.Package.Version)
+
+	return update, nil
+}
+
+// resolveUpdate returns the update package specified with the optional
+// (potentially incomplete) package name after verifying it can be used
+// to update the cluster
+func resolveUpdate(env *localenv.LocalEnvironment, site *ops.Site, updatePackage string) (*appservice.Application, error) {
 	// if app package was not provided, default to the latest version of
 	// the currently installed app
 	if updatePackage == "" {
@@ -231,9 +251,6 @@ func checkForUpdate(env *localenv.LocalEnvironment, operator ops.Operator, site
 		return nil, trace.Wrap(err)
 	}
 
-	env.Printf("Upgrading application %v from %v to %v.\n",
-		update.Package.Name, site.App.Package.Version, update.Package.Version)
-
 	return update, nil
 }
 
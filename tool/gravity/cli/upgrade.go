@@ -24,6 +24,7 @@ import (
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/fsm"
 	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/ops"
 	"github.com/gravitational/gravity/lib/update"
 	"github.com/gravitational/gravity/lib/utils"
 
@@ -166,3 +167,37 @@ func completeUpgrade(localEnv, updateEnv *localenv.LocalEnvironment) error {
 	updateEnv.Printf("cluster has been activated\n")
 	return nil
 }
+
+// approveUpgrade approves the update of the canary node and resumes
+// the update operation
+func approveUpgrade(localEnv, updateEnv *localenv.LocalEnvironment, p upgradePhaseParams) error {
+	clusterEnv, err := localEnv.NewClusterEnvironment()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cluster, err := clusterEnv.Operator.GetLocalSite()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	operations, err := ops.GetActiveOperationsByType(cluster.Key(), clusterEnv.Operator, ops.OperationUpdate)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if len(operations) == 0 {
+		return trace.NotFound("no active update operation found")
+	}
+	operation, err := clusterEnv.Backend.GetSiteOperation(cluster.Domain, operations[0].ID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if operation.Update == nil || operation.Update.Strategy == nil || !operation.Update.Strategy.Canary {
+		return trace.BadParameter("update operation %v does not use canary rollout", operation.ID)
+	}
+	operation.Update.CanaryApproved = true
+	if _, err := clusterEnv.Backend.UpdateSiteOperation(*operation); err != nil {
+		return trace.Wrap(err)
+	}
+	localEnv.Println("Update of the canary node has been approved, resuming the operation.")
+	p.phaseID = fsm.RootPhase
+	return trace.Wrap(executeUpgradePhase(localEnv, updateEnv, p))
+}
@@ -49,6 +49,20 @@ func (g *Application) UpgradeEnv() (*localenv.LocalEnvironment, error) {
 	return g.getEnv(state.GravityUpdateDir(dir))
 }
 
+// EtcdRestoreEnv returns an instance of the local environment where
+// the etcd restore plan is stored
+func (g *Application) EtcdRestoreEnv() (*localenv.LocalEnvironment, error) {
+	dir, err := state.GetStateDir()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	restoreDir := state.GravityEtcdRestoreDir(dir)
+	if err := os.MkdirAll(restoreDir, defaults.SharedDirMask); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	return g.getEnv(restoreDir)
+}
+
 // JoinEnv returns an instance of local environment where join-specific data is stored
 func (g *Application) JoinEnv() (*localenv.LocalEnvironment, error) {
 	err := os.MkdirAll(defaults.GravityJoinDir, defaults.SharedDirMask)
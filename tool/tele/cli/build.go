@@ -19,10 +19,12 @@ package cli
 import (
 	"context"
 
+	"github.com/gravitational/gravity/lib/app/docker"
 	"github.com/gravitational/gravity/lib/app/service"
 	"github.com/gravitational/gravity/lib/builder"
 	"github.com/gravitational/gravity/lib/utils"
 
+	"github.com/docker/libtrust"
 	"github.com/gravitational/trace"
 )
 
@@ -66,3 +68,28 @@ func build(ctx context.Context, params BuildParameters, req service.VendorReques
 	defer installerBuilder.Close()
 	return builder.Build(ctx, installerBuilder)
 }
+
+// parsePlatforms parses the list of platforms in os/arch[/variant] format
+func parsePlatforms(specs []string) (platforms []docker.Platform, err error) {
+	for _, spec := range specs {
+		platform, err := docker.ParsePlatform(spec)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		platforms = append(platforms, *platform)
+	}
+	return platforms, nil
+}
+
+// loadSigningKey loads the private key to sign the image lock with.
+// Returns nil key if path is empty
+func loadSigningKey(path string) (libtrust.PrivateKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	key, err := libtrust.LoadKeyFile(path)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to load signing key from %v", path)
+	}
+	return key, nil
+}
@@ -43,6 +43,8 @@ type Application struct {
 	ListCmd ListCmd
 	// PullCmd downloads app installer from Ops Center
 	PullCmd PullCmd
+	// DiffCmd shows the difference between two app installers
+	DiffCmd DiffCmd
 }
 
 // VersionCmd outputs the binary version
@@ -79,6 +81,14 @@ type BuildCmd struct {
 	SkipVersionCheck *bool
 	// Parallel defines the number of tasks to execute concurrently
 	Parallel *int
+	// NoDocker pulls images directly from registries without a docker daemon
+	NoDocker *bool
+	// Platforms lists platforms to vendor multi-platform images for
+	Platforms *[]string
+	// PinDigests rewrites image references to immutable digests
+	PinDigests *bool
+	// SigningKey is the path to the private key to sign the image lock with
+	SigningKey *string
 }
 
 type ListCmd struct {
@@ -101,3 +111,14 @@ type PullCmd struct {
 	// Force overwrites existing tarball
 	Force *bool
 }
+
+// DiffCmd shows the difference between applications in two installer tarballs
+type DiffCmd struct {
+	*kingpin.CmdClause
+	// From is the older installer tarball
+	From *string
+	// To is the newer installer tarball
+	To *string
+	// Output is the output format
+	Output *constants.Format
+}
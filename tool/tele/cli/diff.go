@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitational/gravity/lib/app/diff"
+	"github.com/gravitational/gravity/lib/archive"
+	"github.com/gravitational/gravity/lib/constants"
+	"github.com/gravitational/gravity/lib/defaults"
+	"github.com/gravitational/gravity/lib/localenv"
+	"github.com/gravitational/gravity/lib/schema"
+
+	"github.com/gravitational/trace"
+)
+
+// diffInstallers outputs the difference between the applications
+// packaged in the installer tarballs fromPath and toPath
+func diffInstallers(fromPath, toPath string, format constants.Format) error {
+	from, err := readInstallerApp(fromPath)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	to, err := readInstallerApp(toPath)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	result, err := diff.Compute(*from, *to)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(diff.Write(os.Stdout, *result, format))
+}
+
+// readInstallerApp unpacks the installer tarball at path and reads
+// the application package it was built for
+func readInstallerApp(path string) (*diff.Package, error) {
+	tarball, err := os.Open(path)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer tarball.Close()
+	unpackedDir, err := ioutil.TempDir("", "tele-diff")
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(unpackedDir)
+	if err := archive.Extract(tarball, unpackedDir); err != nil {
+		return nil, trace.Wrap(err, "failed to unpack %v", path)
+	}
+	manifest, err := schema.ParseManifest(filepath.Join(unpackedDir, defaults.ManifestFileName))
+	if err != nil {
+		return nil, trace.Wrap(err, "%v does not look like an installer tarball", path)
+	}
+	env, err := localenv.New(unpackedDir)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer env.Close()
+	pkg, err := diff.ReadPackage(env.Apps, manifest.Locator())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return pkg, nil
+}
@@ -19,6 +19,7 @@ package cli
 import (
 	"fmt"
 
+	"github.com/gravitational/gravity/lib/app/docker"
 	"github.com/gravitational/gravity/lib/constants"
 	"github.com/gravitational/gravity/lib/defaults"
 	"github.com/gravitational/gravity/lib/loc"
@@ -54,6 +55,10 @@ func RegisterCommands(app *kingpin.Application) Application {
 	tele.BuildCmd.SetDeps = loc.LocatorSlice(tele.BuildCmd.Flag("set-dep", "Rewrite dependencies section in the application manifest file during vendoring, e.g. 'gravitational.io/site-app:0.0.39' will overwrite dependency to 'gravitational.io/site-app:0.0.39'").Hidden())
 	tele.BuildCmd.SkipVersionCheck = tele.BuildCmd.Flag("skip-version-check", "Skip version compatibility check").Hidden().Bool()
 	tele.BuildCmd.Parallel = tele.BuildCmd.Flag("parallel", "Specifies the number of concurrent tasks. If < 0, the number of tasks is not restricted, if unspecified, then tasks are capped at the number of logical CPU cores").Int()
+	tele.BuildCmd.NoDocker = tele.BuildCmd.Flag("no-docker", "Pull images directly from registries into OCI image layouts instead of using the local Docker daemon").Bool()
+	tele.BuildCmd.Platforms = tele.BuildCmd.Flag("platform", "Platform to vendor multi-platform images for, in os/arch[/variant] format, can be repeated").Default(docker.DefaultPlatform.String()).Strings()
+	tele.BuildCmd.PinDigests = tele.BuildCmd.Flag("pin-digests", "Rewrite image references in the application resources to immutable digests and record an image lock in the application").Bool()
+	tele.BuildCmd.SigningKey = tele.BuildCmd.Flag("signing-key", "Path to the private key to sign the image lock with, implies --pin-digests").String()
 
 	tele.ListCmd.CmdClause = app.Command("ls", "Display a list of user applications published in remote Ops Center")
 	tele.ListCmd.Runtimes = tele.ListCmd.Flag("runtimes", "Show only runtimes").Short('r').Bool()
@@ -65,5 +70,10 @@ func RegisterCommands(app *kingpin.Application) Application {
 	tele.PullCmd.OutFile = tele.PullCmd.Flag("output", "Name of downloaded tarball, defaults to <name>-<version>.tar").Short('o').String()
 	tele.PullCmd.Force = tele.PullCmd.Flag("force", "Overwrite existing tarball").Short('f').Bool()
 
+	tele.DiffCmd.CmdClause = app.Command("diff", "Show changes between the applications in two installer tarballs")
+	tele.DiffCmd.From = tele.DiffCmd.Arg("from", "Path to the older installer tarball").Required().ExistingFile()
+	tele.DiffCmd.To = tele.DiffCmd.Arg("to", "Path to the newer installer tarball").Required().ExistingFile()
+	tele.DiffCmd.Output = common.Format(tele.DiffCmd.Flag("output", "Output format, text or json").Short('o').Default(string(constants.EncodingText)))
+
 	return tele
 }
@@ -50,6 +50,14 @@ func Run(tele Application) error {
 	case tele.VersionCmd.FullCommand():
 		return printVersion(*tele.VersionCmd.Output)
 	case tele.BuildCmd.FullCommand():
+		platforms, err := parsePlatforms(*tele.BuildCmd.Platforms)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		signingKey, err := loadSigningKey(*tele.BuildCmd.SigningKey)
+		if err != nil {
+			return trace.Wrap(err)
+		}
 		return build(context.Background(), BuildParameters{
 			StateDir:         *tele.StateDir,
 			ManifestPath:     *tele.BuildCmd.ManifestPath,
@@ -68,9 +76,17 @@ func Run(tele Application) error {
 			SetDeps:                *tele.BuildCmd.SetDeps,
 			Parallel:               *tele.BuildCmd.Parallel,
 			VendorRuntime:          true,
+			Daemonless:             *tele.BuildCmd.NoDocker,
+			Platforms:              platforms,
+			PinDigests:             *tele.BuildCmd.PinDigests || signingKey != nil,
+			SigningKey:             signingKey,
 		})
 	}
 
+	if cmd == tele.DiffCmd.FullCommand() {
+		return diffInstallers(*tele.DiffCmd.From, *tele.DiffCmd.To, *tele.DiffCmd.Output)
+	}
+
 	keystoreDir := *tele.StateDir
 	if *tele.StateDir == "" {
 		*tele.StateDir, err = ioutil.TempDir("", "tele")